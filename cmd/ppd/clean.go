@@ -2,15 +2,17 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/stratosnet/sds/cmd/common"
 	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/pp/file/sliceindex"
 	"github.com/stratosnet/sds/pp/setting"
 )
 
@@ -55,15 +57,39 @@ func cleanStorage(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
-	cmdString := fmt.Sprintf(`find %s -type f -not -newermt "$(date -d @%d)" -exec sudo rm -rf {} \;`, setting.Config.Home.StoragePath, uint64(DEFAULT_UNIX_TIME))
-	c := exec.Command("sh", "-c", cmdString)
-	out, err := c.CombinedOutput()
+	if err = file.InitSliceStore(); err != nil {
+		return err
+	}
+	created, err := file.InitSliceIndex()
 	if err != nil {
-		fmt.Println(err.Error())
+		fmt.Println("Failed opening the slice index")
 		return err
 	}
+	defer file.CloseSliceIndex()
+	if created {
+		fmt.Println("Indexing the stored slices...")
+		if _, err = file.RebuildSliceIndex(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	// the slices stored before the default time are removed, with their references and origin
+	var oldSlices []string
+	file.RangeIndexedSlices(func(meta sliceindex.SliceMeta) bool {
+		if meta.StoredTime < DEFAULT_UNIX_TIME {
+			oldSlices = append(oldSlices, meta.Hash)
+		}
+		return true
+	})
+	removed := 0
+	for _, sliceHash := range oldSlices {
+		if err = file.DeleteSlice(sliceHash); err != nil {
+			fmt.Println("Failed removing slice", sliceHash, err.Error())
+			continue
+		}
+		removed++
+	}
 
-	// Print output (if any)
-	fmt.Println(string(out))
+	fmt.Printf("%v old slices removed from the storage\n", removed)
 	return nil
 }
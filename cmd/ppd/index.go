@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stratosnet/sds/pp/file"
+)
+
+// rebuildIndex indexes again the stored slices while the node is stopped, when the slice index is too corrupted for
+// the node to start
+func rebuildIndex(_ *cobra.Command, _ []string) error {
+	if err := file.InitSliceStore(); err != nil {
+		return err
+	}
+	if err := file.ResetSliceIndex(); err != nil {
+		return err
+	}
+	defer file.CloseSliceIndex()
+
+	fmt.Println("Indexing the stored slices...")
+	count, err := file.RebuildSliceIndex(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Slice index rebuilt with %v slices\n", count)
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/stratosnet/sds/cmd/common"
+	"github.com/stratosnet/sds/pp/serv"
 	"github.com/stratosnet/sds/pp/setting"
 )
 
@@ -18,6 +19,11 @@ func main() {
 	verCmd := getVersionCmd()
 	exportCmd := getExportCmd()
 	cleanCmd := getCleanCmd()
+	mountCmd := getMountCmd()
+	tokenCmd := getTokenCmd()
+	signerCmd := getSignerCmd()
+	txCmd := getTxCmd()
+	indexCmd := getIndexCmd()
 
 	rootCmd.AddCommand(nodeCmd)
 	rootCmd.AddCommand(terminalCmd)
@@ -25,6 +31,11 @@ func main() {
 	rootCmd.AddCommand(verCmd)
 	rootCmd.AddCommand(exportCmd)
 	rootCmd.AddCommand(cleanCmd)
+	rootCmd.AddCommand(mountCmd)
+	rootCmd.AddCommand(tokenCmd)
+	rootCmd.AddCommand(signerCmd)
+	rootCmd.AddCommand(txCmd)
+	rootCmd.AddCommand(indexCmd)
 
 	err := rootCmd.Execute()
 	if err != nil {
@@ -70,6 +81,72 @@ func getCleanCmd() *cobra.Command {
 	return nodeCmd
 }
 
+func getIndexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "manage the index of the stored slices",
+	}
+
+	rebuildCmd := &cobra.Command{
+		Use:     "rebuild",
+		Short:   "rebuild the slice index from the stored slices, the node must be stopped",
+		PreRunE: terminalPreRunE,
+		RunE:    rebuildIndex,
+	}
+
+	cmd.AddCommand(rebuildCmd)
+	return cmd
+}
+
+func getMountCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "mount <dir>",
+		Short:   "mount the files of the node wallet as a read-only filesystem",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: terminalPreRunE,
+		RunE:    mount,
+	}
+	cmd.Flags().Int64(cacheSizeFlag, serv.DefaultMountCacheSize, "size limit of the local slice cache, in MiB")
+	return cmd
+}
+
+func getTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "manage the bearer tokens of the JSON-RPC api",
+	}
+
+	mintCmd := &cobra.Command{
+		Use:     "mint",
+		Short:   "create a token allowed to call the given namespaces or methods",
+		PreRunE: terminalPreRunE,
+		RunE:    mintToken,
+	}
+	mintCmd.Flags().String(tokenNameFlag, "", "name of the token, to recognize it later")
+	mintCmd.Flags().StringSlice(tokenScopeFlag, []string{"user"}, "namespaces (eg: owner), methods (eg: owner_requestSend), gateway for the http gateway, or * the token can call")
+	mintCmd.Flags().Duration(tokenTtlFlag, 0, "validity of the token (eg: 720h), 0 means no expiry")
+
+	revokeCmd := &cobra.Command{
+		Use:     "revoke <id>",
+		Short:   "delete a token",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: terminalPreRunE,
+		RunE:    revokeToken,
+	}
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Short:   "list the tokens",
+		PreRunE: terminalPreRunE,
+		RunE:    listTokens,
+	}
+
+	cmd.AddCommand(mintCmd)
+	cmd.AddCommand(revokeCmd)
+	cmd.AddCommand(listCmd)
+	return cmd
+}
+
 func getTerminalCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "terminal",
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/stratosnet/sds/cmd/common"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/serv"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/rpc"
+)
+
+const (
+	cacheSizeFlag = "cache-size"
+)
+
+// mount asks the node to mount the files of its wallet in a directory, and unmounts it when interrupted
+func mount(cmd *cobra.Command, args []string) error {
+	dir, err := utils.Absolute(args[0])
+	if err != nil {
+		return err
+	}
+	cacheSize, _ := cmd.Flags().GetInt64(cacheSizeFlag)
+
+	c, err := rpc.Dial(setting.IpcEndpoint)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	terminalId := uuid.New().String()
+	var result serv.CmdResult
+	if err = c.Call(&result, "sds_mount", []string{terminalId, dir, strconv.FormatInt(cacheSize, 10)}); err != nil {
+		return err
+	}
+	fmt.Println(result.Msg)
+	fmt.Println("Press Ctrl+C to unmount")
+
+	<-common.GetQuitChannel()
+	if err = c.Call(&result, "sds_unmount", []string{terminalId, dir}); err != nil {
+		return err
+	}
+	fmt.Println(result.Msg)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/stratosnet/sds/cmd/common"
+	"github.com/stratosnet/sds/framework/utils/console"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
+)
+
+const (
+	signerSocketFlag   = "socket"
+	signerKeystoreFlag = "keystore"
+	signerPolicyFlag   = "policy"
+)
+
+// runSigner keeps the wallet key in its own process, and signs for the node within the limits of a policy
+func runSigner(cmd *cobra.Command, _ []string) error {
+	socketPath, _ := cmd.Flags().GetString(signerSocketFlag)
+	keystorePath, _ := cmd.Flags().GetString(signerKeystoreFlag)
+	policyPath, _ := cmd.Flags().GetString(signerPolicyFlag)
+	if socketPath == "" {
+		socketPath = filepath.Join(setting.GetRootPath(), "signer.sock")
+	}
+
+	if err := common.RegisterDenoms(); err != nil {
+		return err
+	}
+	policy, err := signer.LoadPolicy(policyPath)
+	if err != nil {
+		return err
+	}
+	password, err := console.Stdin.PromptPassword("Enter wallet password: ")
+	if err != nil {
+		return errors.New("couldn't read wallet password from console: " + err.Error())
+	}
+	localSigner, err := signer.LoadKeystore(keystorePath, password)
+	if err != nil {
+		return errors.Wrap(err, "failed unlocking the wallet")
+	}
+
+	_ = os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	if err = os.Chmod(socketPath, 0600); err != nil {
+		return err
+	}
+
+	server := signer.NewServer(localSigner, policy, func(description string) bool {
+		confirmed, err := console.Stdin.PromptConfirm(fmt.Sprintf("Sign transaction %v?", description))
+		return err == nil && confirmed
+	})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	fmt.Printf("Signer listening on %v%v\n", signer.UNIX_SCHEME, socketPath)
+
+	<-common.GetQuitChannel()
+	return nil
+}
+
+func getSignerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "signer",
+		Short: "keep the wallet key in a separate process signing for the node",
+		RunE:  runSigner,
+	}
+	cmd.Flags().String(signerSocketFlag, "", "path of the unix socket to listen on (default <home>/signer.sock)")
+	cmd.Flags().String(signerKeystoreFlag, "", "wallet keystore file")
+	cmd.Flags().String(signerPolicyFlag, "", "policy file limiting what the node can sign, everything but deriving secrets is allowed without it")
+	_ = cmd.MarkFlagRequired(signerKeystoreFlag)
+	return cmd
+}
@@ -45,15 +45,27 @@ func run(cmd *cobra.Command, args []string, isExec bool) {
 		"startmining                                                    start mining\n" +
 		"prepay <amount> <fee> [--beneficiary=<beneficiary>] [--gas=<gas>]\n" +
 		"                                                               prepay stos to get ozone\n" +
-		"put <filepath> [--isEncrypted=<isEncrypted>] [--nodeTier=<nodeTier>] [--allowHigherTier=<allowHigherTier>]\n" +
-		"                                                               upload file, need to consume ozone\n" +
+		"put <filepath> [--isEncrypted=<isEncrypted>] [--envelope=<envelope>] [--recipients=<pubkey1,pubkey2>]\n" +
+		"    [--erasure=<dataShards+parityShards>] [--dedup=<dedup>] [--nodeTier=<nodeTier>] [--allowHigherTier=<allowHigherTier>]\n" +
+		"                                                               upload file, need to consume ozone. --envelope encrypts the file with a\n" +
+		"                                                               random key wrapped for this wallet and the optional recipients.\n" +
+		"                                                               --erasure stores each slice as Reed-Solomon shards instead of replicas.\n" +
+		"                                                               --dedup cuts slices at content-defined boundaries, so that slices\n" +
+		"                                                               already stored for other files are not uploaded again\n" +
+		"put <filepath> --resume=true                                   resume the unfinished upload of a file without slicing it again\n" +
+		"encryptionkey                                                  show the public key other wallets can wrap encrypted files for\n" +
+		"rewrap <filehash> <pubkey1,pubkey2>                            wrap the key of an encrypted file for a new set of recipients\n" +
+		"importenvelope <filehash> <envelope>                           import the key envelope of an encrypted file shared with this wallet\n" +
 		"putstream <filepath> [--nodeTier=<nodeTier>] [--allowHigherTier=<allowHigherTier>]\n" +
 		"                                                               upload video file for streaming, need to consume ozone. (alpha version, encode format config impossible)\n" +
+		"putdir <dirpath> [--workers=<workers>]                         upload the files of a directory tree, then a signed manifest of the tree\n" +
+		"                                                               to download it with getdir. --workers is the number of concurrent uploads\n" +
 		"list <filename>                                                query uploaded file by self\n" +
 		"list <page id>                                                 query all files owned by the wallet, paginated\n" +
 		"delete <filehash>                                              delete file\n" +
 		"get <sdm://account/filehash> <saveAs>                          download file, need to consume ozone\n" +
 		"                                                               e.g: get sdm://st1jn9skjsnxv26mekd8eu8a8aquh34v0m4mwgahg/v05ahm50ugfjrgd3ga8mqi6bqka32ks3dooe1p9g\n" +
+		"getdir <manifest_filehash> [saveDir] [--workers=<workers>]     download a directory uploaded with putdir, need to consume ozone\n" +
 		"sharefile <filehash> <duration> <is_private> [--ipfsCid=<cid>]\n" +
 		"                                                               share an uploaded file\n" +
 		"allshare                                                       list all shared files\n" +
@@ -74,12 +86,17 @@ func run(cmd *cobra.Command, args []string, isExec bool) {
 		"downgradeinfo                                                  get information of last downgrade happened on this pp node\n" +
 		"replicas                                                       check or set the expect replicas of a file\n" +
 		"performancemeasure                                             turn on performance measurement log for 60 seconds\n" +
+		"scrub [start|stop|status]                                      re-verify the stored slices in the background, or show the progress of the scrub\n" +
+		"index [rebuild]                                                show the number of indexed slices, or index the stored slices again\n" +
 		"withdraw <amount> <fee> [--targetAddr=<targetAddr>] [--gas=<gas>]\n" +
 		"                                                               withdraw matured reward (from address is the configured node wallet)\n" +
 		"send <toAddress> <amount> <fee> [--gas=<gas>]                  sending coins to another account (from address is the configured node wallet)\n" +
 		"updateinfo <fee> [--moniker=<moniker>] [--identity=<identity>] [--website=<website>]\n" +
 		"           [--security_contact=<security_contact>] [--details=<details>] [--gas=<gas>]\n" +
-		"                                                               update pp node info, including the beneficiary address from config file\n"
+		"                                                               update pp node info, including the beneficiary address from config file\n" +
+		"txstatus [txHash]                                              show the txs broadcast by the node recently, or one of them\n" +
+		"webhook [list|add <url> [event,...]|remove <id>|test <id>|log [id]]\n" +
+		"                                                               manage the webhooks notified of the file and node events, or show the last notifications\n"
 
 	terminalId := uuid.New().String()
 
@@ -149,6 +166,10 @@ func run(cmd *cobra.Command, args []string, isExec bool) {
 		return callRpc(c, terminalId, "uploadStream", param)
 	}
 
+	uploadDir := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "uploadDir", param)
+	}
+
 	backupStatus := func(line string, param []string) bool {
 		return callRpc(c, terminalId, "backupStatus", param)
 	}
@@ -161,6 +182,10 @@ func run(cmd *cobra.Command, args []string, isExec bool) {
 		return callRpc(c, terminalId, "download", param)
 	}
 
+	downloadDir := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "downloadDir", param)
+	}
+
 	deleteFn := func(line string, param []string) bool {
 		return callRpc(c, terminalId, "deleteFn", param)
 	}
@@ -228,6 +253,12 @@ func run(cmd *cobra.Command, args []string, isExec bool) {
 	performanceMeasure := func(line string, param []string) bool {
 		return callRpc(c, terminalId, "performanceMeasure", param)
 	}
+	scrub := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "scrub", param)
+	}
+	index := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "index", param)
+	}
 	replica := func(line string, param []string) bool {
 		return callRpc(c, terminalId, "replica", param)
 	}
@@ -238,10 +269,30 @@ func run(cmd *cobra.Command, args []string, isExec bool) {
 		return callRpc(c, terminalId, "send", param)
 	}
 
+	txStatus := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "txStatus", param)
+	}
+
+	webhook := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "webhook", param)
+	}
+
 	updateInfo := func(line string, param []string) bool {
 		return callRpc(c, terminalId, "updateInfo", param)
 	}
 
+	encryptionKey := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "encryptionKey", param)
+	}
+
+	rewrapEnvelope := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "rewrapEnvelope", param)
+	}
+
+	importEnvelope := func(line string, param []string) bool {
+		return callRpc(c, terminalId, "importEnvelope", param)
+	}
+
 	nc := make(chan utils.LogMsg)
 	sub, err := c.Subscribe(context.Background(), "sdslog", nc, "logSubscription", terminalId)
 	if err != nil {
@@ -269,9 +320,14 @@ func run(cmd *cobra.Command, args []string, isExec bool) {
 	console.Mystdin.RegisterProcessFunc("u", upload, true)
 	console.Mystdin.RegisterProcessFunc("put", upload, true)
 	console.Mystdin.RegisterProcessFunc("putstream", uploadStream, true)
+	console.Mystdin.RegisterProcessFunc("putdir", uploadDir, true)
+	console.Mystdin.RegisterProcessFunc("encryptionkey", encryptionKey, true)
+	console.Mystdin.RegisterProcessFunc("rewrap", rewrapEnvelope, true)
+	console.Mystdin.RegisterProcessFunc("importenvelope", importEnvelope, true)
 	console.Mystdin.RegisterProcessFunc("backupStatus", backupStatus, true)
 	console.Mystdin.RegisterProcessFunc("d", download, true)
 	console.Mystdin.RegisterProcessFunc("get", download, true)
+	console.Mystdin.RegisterProcessFunc("getdir", downloadDir, true)
 	console.Mystdin.RegisterProcessFunc("list", list, true)
 	console.Mystdin.RegisterProcessFunc("ls", list, true)
 	console.Mystdin.RegisterProcessFunc("delete", deleteFn, true)
@@ -296,8 +352,12 @@ func run(cmd *cobra.Command, args []string, isExec bool) {
 	console.Mystdin.RegisterProcessFunc("downgradeinfo", downgradeInfo, true)
 	console.Mystdin.RegisterProcessFunc("performancemeasure", performanceMeasure, true)
 	console.Mystdin.RegisterProcessFunc("replicas", replica, true)
+	console.Mystdin.RegisterProcessFunc("scrub", scrub, true)
+	console.Mystdin.RegisterProcessFunc("index", index, true)
 	console.Mystdin.RegisterProcessFunc("withdraw", withdraw, true)
 	console.Mystdin.RegisterProcessFunc("send", send, true)
+	console.Mystdin.RegisterProcessFunc("txstatus", txStatus, true)
+	console.Mystdin.RegisterProcessFunc("webhook", webhook, true)
 	console.Mystdin.RegisterProcessFunc("updateinfo", updateInfo, true)
 
 	if isExec {
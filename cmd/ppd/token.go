@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stratosnet/sds/pp/namespace"
+)
+
+const (
+	tokenNameFlag  = "name"
+	tokenScopeFlag = "scope"
+	tokenTtlFlag   = "ttl"
+)
+
+// mintToken creates an RPC token and prints its secret, which is not stored by the node
+func mintToken(cmd *cobra.Command, _ []string) error {
+	name, _ := cmd.Flags().GetString(tokenNameFlag)
+	scopes, _ := cmd.Flags().GetStringSlice(tokenScopeFlag)
+	ttl, _ := cmd.Flags().GetDuration(tokenTtlFlag)
+
+	value, token, err := namespace.NewRpcTokenStore(namespace.DefaultRpcTokenPath()).Mint(name, scopes, ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Println("id:     ", token.Id)
+	fmt.Println("scopes: ", strings.Join(token.Scopes, ","))
+	fmt.Println("expires:", formatTokenExpiry(token))
+	fmt.Println("token:  ", value)
+	fmt.Println("Save the token now, it cannot be displayed again. Send it in the \"Authorization: Bearer <token>\" header")
+	return nil
+}
+
+// revokeToken deletes an RPC token. The running node stops accepting it immediately
+func revokeToken(_ *cobra.Command, args []string) error {
+	if err := namespace.NewRpcTokenStore(namespace.DefaultRpcTokenPath()).Revoke(args[0]); err != nil {
+		return err
+	}
+	fmt.Println("Revoked token", args[0])
+	return nil
+}
+
+func listTokens(_ *cobra.Command, _ []string) error {
+	tokens, err := namespace.NewRpcTokenStore(namespace.DefaultRpcTokenPath()).List()
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No RPC token")
+		return nil
+	}
+	for _, token := range tokens {
+		fmt.Printf("%v  name: %v  scopes: %v  created: %v  expires: %v\n", token.Id, token.Name,
+			strings.Join(token.Scopes, ","), time.Unix(token.CreatedAt, 0).Format(time.RFC3339), formatTokenExpiry(token))
+	}
+	return nil
+}
+
+func formatTokenExpiry(token namespace.RpcToken) string {
+	if token.ExpiresAt == 0 {
+		return "never"
+	}
+	expiry := time.Unix(token.ExpiresAt, 0).Format(time.RFC3339)
+	if token.Expired() {
+		expiry += " (expired)"
+	}
+	return expiry
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/cosmos/cosmos-proto/anyutil"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/stratosnet/sds/cmd/common"
+	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+	"github.com/stratosnet/sds/framework/utils/console"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
+	"github.com/stratosnet/sds/pp/tx"
+	txclienttx "github.com/stratosnet/sds/tx-client/tx"
+	txclienttypes "github.com/stratosnet/sds/tx-client/types"
+)
+
+const (
+	txFeeFlag               = "fee"
+	txGasFlag               = "gas"
+	txMemoFlag              = "memo"
+	txFromFlag              = "from"
+	txOutputFlag            = "output"
+	txKeystoreFlag          = "keystore"
+	txTargetFlag            = "target"
+	txBeneficiaryFlag       = "beneficiary"
+	txP2pPubKeyFlag         = "p2p-pubkey"
+	txP2pAddressFlag        = "p2p-address"
+	txMultisigThresholdFlag = "multisig-threshold"
+	txMultisigPubKeysFlag   = "multisig-pubkeys"
+	txMultisigSignersFlag   = "multisig-signers"
+)
+
+func txPreRunE(cmd *cobra.Command, _ []string) error {
+	if _, _, err := common.LoadConfig(cmd); err != nil {
+		return err
+	}
+	return common.RegisterDenoms()
+}
+
+// generateTx writes an unsigned tx with the given msg, signed later by the --from account
+func generateTx(cmd *cobra.Command, from fwtypes.WalletAddress, msg proto.Message) error {
+	feeStr, _ := cmd.Flags().GetString(txFeeFlag)
+	gas, _ := cmd.Flags().GetUint64(txGasFlag)
+	memo, _ := cmd.Flags().GetString(txMemoFlag)
+
+	fee, err := txclienttypes.ParseCoinNormalized(feeStr)
+	if err != nil {
+		return errors.Wrap(err, "invalid fee")
+	}
+	txFee := txclienttypes.TxFee{Fee: fee, Gas: gas, Simulate: gas == 0}
+
+	multisigKey, err := getMultisigKey(cmd)
+	if err != nil {
+		return err
+	}
+
+	msgAny, err := anyutil.New(msg)
+	if err != nil {
+		return err
+	}
+	offlineTx, err := txclienttx.GenerateOfflineTx([]*anypb.Any{msgAny}, txFee, memo, setting.Config.Blockchain.ChainId,
+		from.String(), multisigKey, setting.Config.Blockchain.GasAdjustment)
+	if err != nil {
+		return err
+	}
+	return writeTxJson(cmd, offlineTx)
+}
+
+func getMultisigKey(cmd *cobra.Command) (*txclienttx.MultisigKey, error) {
+	threshold, _ := cmd.Flags().GetUint32(txMultisigThresholdFlag)
+	pubKeysStr, _ := cmd.Flags().GetStringSlice(txMultisigPubKeysFlag)
+	signers, _ := cmd.Flags().GetIntSlice(txMultisigSignersFlag)
+	if threshold == 0 && len(pubKeysStr) == 0 {
+		return nil, nil
+	}
+
+	var pubKeys []fwcryptotypes.PubKey
+	for _, pubKeyStr := range pubKeysStr {
+		pubKey, err := fwtypes.WalletPubKeyFromBech32(pubKeyStr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid multisig public key %v", pubKeyStr)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	return &txclienttx.MultisigKey{Threshold: threshold, PubKeys: pubKeys, Signers: signers}, nil
+}
+
+// getFromAddress returns the --from account, the node wallet by default
+func getFromAddress(cmd *cobra.Command) (fwtypes.WalletAddress, error) {
+	from, _ := cmd.Flags().GetString(txFromFlag)
+	if from == "" {
+		from = setting.Config.Keys.WalletAddress
+	}
+	address, err := fwtypes.WalletAddressFromBech32(from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --%v address [%v]", txFromFlag, from)
+	}
+	return address, nil
+}
+
+// getWalletFlag returns a wallet address flag, or the --from account when it is not set
+func getWalletFlag(cmd *cobra.Command, flag string, from fwtypes.WalletAddress) (fwtypes.WalletAddress, error) {
+	value, _ := cmd.Flags().GetString(flag)
+	if value == "" {
+		return from, nil
+	}
+	address, err := fwtypes.WalletAddressFromBech32(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --%v address [%v]", flag, value)
+	}
+	return address, nil
+}
+
+func generateWithdrawTx(cmd *cobra.Command, args []string) error {
+	amount, err := txclienttypes.ParseCoinNormalized(args[0])
+	if err != nil {
+		return errors.Wrap(err, "invalid amount")
+	}
+	from, err := getFromAddress(cmd)
+	if err != nil {
+		return err
+	}
+	target, err := getWalletFlag(cmd, txTargetFlag, from)
+	if err != nil {
+		return err
+	}
+	return generateTx(cmd, from, txclienttx.BuildWithdrawMsg(amount, from, target))
+}
+
+func generateSendTx(cmd *cobra.Command, args []string) error {
+	to, err := fwtypes.WalletAddressFromBech32(args[0])
+	if err != nil {
+		return errors.Wrap(err, "invalid recipient address")
+	}
+	amount, err := txclienttypes.ParseCoinNormalized(args[1])
+	if err != nil {
+		return errors.Wrap(err, "invalid amount")
+	}
+	from, err := getFromAddress(cmd)
+	if err != nil {
+		return err
+	}
+	return generateTx(cmd, from, txclienttx.BuildSendMsg(from, to, amount))
+}
+
+func generateCreateResourceNodeTx(cmd *cobra.Command, args []string) error {
+	deposit, err := txclienttypes.ParseCoinNormalized(args[0])
+	if err != nil {
+		return errors.Wrap(err, "invalid deposit")
+	}
+	p2pPubKeyStr, _ := cmd.Flags().GetString(txP2pPubKeyFlag)
+	p2pPubKey, err := fwtypes.P2PPubKeyFromBech32(p2pPubKeyStr)
+	if err != nil {
+		return errors.Wrap(err, "invalid p2p public key")
+	}
+	from, err := getFromAddress(cmd)
+	if err != nil {
+		return err
+	}
+	beneficiary, err := getWalletFlag(cmd, txBeneficiaryFlag, from)
+	if err != nil {
+		return err
+	}
+	msg, err := txclienttx.BuildCreateResourceNodeMsg(0, p2pPubKey, deposit, from, beneficiary)
+	if err != nil {
+		return err
+	}
+	return generateTx(cmd, from, msg)
+}
+
+func generateUpdateDepositTx(cmd *cobra.Command, args []string) error {
+	depositDelta, err := txclienttypes.ParseCoinNormalized(args[0])
+	if err != nil {
+		return errors.Wrap(err, "invalid deposit delta")
+	}
+	p2pAddressStr, _ := cmd.Flags().GetString(txP2pAddressFlag)
+	if p2pAddressStr == "" {
+		p2pAddressStr = setting.Config.Keys.P2PAddress
+	}
+	p2pAddress, err := fwtypes.P2PAddressFromBech32(p2pAddressStr)
+	if err != nil {
+		return errors.Wrapf(err, "invalid p2p address [%v]", p2pAddressStr)
+	}
+	from, err := getFromAddress(cmd)
+	if err != nil {
+		return err
+	}
+	return generateTx(cmd, from, txclienttx.BuildUpdateResourceNodeDepositMsg(p2pAddress, from, depositDelta))
+}
+
+// signTx signs an unsigned tx with a wallet keystore. A member of a multisig account writes its signature instead
+func signTx(cmd *cobra.Command, args []string) error {
+	offlineTx, err := readTxJson(args[0])
+	if err != nil {
+		return err
+	}
+	keystorePath, _ := cmd.Flags().GetString(txKeystoreFlag)
+	password, err := console.Stdin.PromptPassword("Enter wallet password: ")
+	if err != nil {
+		return errors.New("couldn't read wallet password from console: " + err.Error())
+	}
+	walletSigner, err := signer.LoadKeystore(keystorePath, password)
+	if err != nil {
+		return errors.Wrap(err, "failed unlocking the wallet")
+	}
+
+	if offlineTx.IsMultisig() {
+		signature, err := offlineTx.SignMultisig(walletSigner)
+		if err != nil {
+			return err
+		}
+		return writeTxJson(cmd, signature)
+	}
+	if err = offlineTx.Sign(walletSigner); err != nil {
+		return err
+	}
+	return writeTxJson(cmd, offlineTx)
+}
+
+// multisignTx combines the signatures of the members of a multisig account
+func multisignTx(cmd *cobra.Command, args []string) error {
+	offlineTx, err := readTxJson(args[0])
+	if err != nil {
+		return err
+	}
+	var signatures []*txclienttx.OfflineSignature
+	for _, path := range args[1:] {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		signature := &txclienttx.OfflineSignature{}
+		if err = json.Unmarshal(data, signature); err != nil {
+			return errors.Wrapf(err, "invalid signature file %v", path)
+		}
+		signatures = append(signatures, signature)
+	}
+	if err = offlineTx.CombineSignatures(signatures); err != nil {
+		return err
+	}
+	return writeTxJson(cmd, offlineTx)
+}
+
+// broadcastTx broadcasts a signed tx, and waits for it to be included in a block
+func broadcastTx(cmd *cobra.Command, args []string) error {
+	offlineTx, err := readTxJson(args[0])
+	if err != nil {
+		return err
+	}
+	txBytes, err := offlineTx.TxBytes()
+	if err != nil {
+		return err
+	}
+	trackedTx, err := tx.BroadcastAndWait(context.Background(), txBytes, nil, tx.TX_CONFIRM_TIMEOUT)
+	if trackedTx.Hash != "" {
+		fmt.Println(trackedTx.String())
+	}
+	return err
+}
+
+func readTxJson(path string) (*txclienttx.OfflineTx, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	offlineTx := &txclienttx.OfflineTx{}
+	if err = json.Unmarshal(data, offlineTx); err != nil {
+		return nil, errors.Wrapf(err, "invalid tx file %v", path)
+	}
+	return offlineTx, nil
+}
+
+// writeTxJson writes a tx or a signature to the --output file, or to stdout
+func writeTxJson(cmd *cobra.Command, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	output, _ := cmd.Flags().GetString(txOutputFlag)
+	if output == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	return os.WriteFile(output, data, 0600)
+}
+
+func getTxCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tx",
+		Short: "build, sign and broadcast transactions offline, to keep the wallet key on another machine",
+	}
+	cmd.PersistentFlags().StringP(txOutputFlag, "o", "", "file to write the result to (default stdout)")
+
+	generateCmd := &cobra.Command{
+		Use:   "generate",
+		Short: "write an unsigned transaction, with the account number and sequence of the signer",
+	}
+	generateCmd.PersistentFlags().String(txFeeFlag, "", "transaction fee (eg: 0.01stos)")
+	generateCmd.PersistentFlags().Uint64(txGasFlag, 0, "gas limit, simulated when 0")
+	generateCmd.PersistentFlags().String(txMemoFlag, "", "memo of the transaction")
+	generateCmd.PersistentFlags().String(txFromFlag, "", "account signing the transaction (default the node wallet)")
+	generateCmd.PersistentFlags().Uint32(txMultisigThresholdFlag, 0, "signatures needed when --from is a multisig account")
+	generateCmd.PersistentFlags().StringSlice(txMultisigPubKeysFlag, nil, "public keys of the multisig account, in the order of the account")
+	generateCmd.PersistentFlags().IntSlice(txMultisigSignersFlag, nil, "indexes of the multisig members signing (default the first threshold members)")
+	_ = generateCmd.MarkPersistentFlagRequired(txFeeFlag)
+
+	withdrawCmd := &cobra.Command{
+		Use:     "withdraw <amount>",
+		Short:   "withdraw the mining rewards",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: txPreRunE,
+		RunE:    generateWithdrawTx,
+	}
+	withdrawCmd.Flags().String(txTargetFlag, "", "account receiving the rewards (default --from)")
+
+	sendCmd := &cobra.Command{
+		Use:     "send <to> <amount>",
+		Short:   "send tokens to another account",
+		Args:    cobra.ExactArgs(2),
+		PreRunE: txPreRunE,
+		RunE:    generateSendTx,
+	}
+
+	createResourceNodeCmd := &cobra.Command{
+		Use:     "create-resource-node <deposit>",
+		Short:   "register a resource node with a deposit",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: txPreRunE,
+		RunE:    generateCreateResourceNodeTx,
+	}
+	createResourceNodeCmd.Flags().String(txP2pPubKeyFlag, "", "p2p public key of the node")
+	createResourceNodeCmd.Flags().String(txBeneficiaryFlag, "", "account receiving the rewards of the node (default --from)")
+	_ = createResourceNodeCmd.MarkFlagRequired(txP2pPubKeyFlag)
+
+	updateDepositCmd := &cobra.Command{
+		Use:     "update-deposit <delta>",
+		Short:   "add to the deposit of a resource node",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: txPreRunE,
+		RunE:    generateUpdateDepositTx,
+	}
+	updateDepositCmd.Flags().String(txP2pAddressFlag, "", "p2p address of the node (default the node of the config)")
+
+	generateCmd.AddCommand(withdrawCmd)
+	generateCmd.AddCommand(sendCmd)
+	generateCmd.AddCommand(createResourceNodeCmd)
+	generateCmd.AddCommand(updateDepositCmd)
+
+	signCmd := &cobra.Command{
+		Use:   "sign <tx file>",
+		Short: "sign a transaction with a wallet keystore, without connecting to the chain",
+		Args:  cobra.ExactArgs(1),
+		RunE:  signTx,
+	}
+	signCmd.Flags().String(txKeystoreFlag, "", "wallet keystore file")
+	_ = signCmd.MarkFlagRequired(txKeystoreFlag)
+
+	multisignCmd := &cobra.Command{
+		Use:   "multisign <tx file> <signature file>...",
+		Short: "combine the signatures of the members of a multisig account",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  multisignTx,
+	}
+
+	broadcastCmd := &cobra.Command{
+		Use:     "broadcast <tx file>",
+		Short:   "broadcast a signed transaction and wait for it to be included",
+		Args:    cobra.ExactArgs(1),
+		PreRunE: txPreRunE,
+		RunE:    broadcastTx,
+	}
+
+	cmd.AddCommand(generateCmd)
+	cmd.AddCommand(signCmd)
+	cmd.AddCommand(multisignCmd)
+	cmd.AddCommand(broadcastCmd)
+	return cmd
+}
@@ -22,15 +22,9 @@ import (
 	"github.com/stratosnet/sds/framework/metrics"
 	"github.com/stratosnet/sds/framework/msg"
 	"github.com/stratosnet/sds/framework/msg/header"
-	fwtypes "github.com/stratosnet/sds/framework/types"
 	"github.com/stratosnet/sds/framework/utils"
 )
 
-var (
-	maxDownloadRate uint64
-	maxUploadRate   uint64
-)
-
 const (
 	LOG_MODULE_START      = "start: "
 	LOG_MODULE_WRITELOOP  = "writeLoop: "
@@ -68,6 +62,8 @@ type options struct {
 	logOpen     bool
 	minAppVer   uint16
 	p2pAddress  string
+	p2pPubKey   []byte
+	p2pSigner   msg.Signer
 	serverIp    net.IP
 	serverPort  uint16
 	contextkv   []ContextKV
@@ -168,6 +164,14 @@ func P2pAddressOption(p2pAddress string) ClientOption {
 	}
 }
 
+// P2pKeyOption sets the P2P key used to prove ownership of the local P2P address during the handshake
+func P2pKeyOption(p2pPubKey []byte, signer msg.Signer) ClientOption {
+	return func(o *options) {
+		o.p2pPubKey = p2pPubKey
+		o.p2pSigner = signer
+	}
+}
+
 // ServerIpOption sets the IP used by the server conn when establishing the handshake
 func ServerIpOption(serverIp net.IP) ClientOption {
 	return func(o *options) {
@@ -248,14 +252,6 @@ func (cc *ClientConn) GetName() string {
 	return name
 }
 
-func SetMaxDownloadRate(rate uint64) {
-	maxDownloadRate = rate
-}
-
-func SetMaxUploadRate(rate uint64) {
-	maxUploadRate = rate
-}
-
 // GetIP get connection ip
 func (cc *ClientConn) GetIP() string {
 	cc.mu.Lock()
@@ -364,7 +360,17 @@ func (cc *ClientConn) handshake() error {
 	peerPubKeyBytes := tmpKeyMsg[:fwed25519.PubKeySize]
 
 	peerPubKey := fwed25519.PubKeyFromBytes(peerPubKeyBytes)
-	peerSignature := tmpKeyMsg[fwed25519.PubKeySize:]
+	peerSignature := tmpKeyMsg[fwed25519.PubKeySize : fwed25519.PubKeySize+fwed25519.SignatureSize]
+	version := byte(core.HandshakeVersionLegacy)
+	if len(tmpKeyMsg) > fwed25519.PubKeySize+fwed25519.SignatureSize {
+		version = tmpKeyMsg[fwed25519.PubKeySize+fwed25519.SignatureSize]
+	}
+	if version == core.HandshakeVersionLegacy && !core.AcceptLegacyHandshake {
+		return errors.New("Server doesn't support handshake authentication")
+	}
+	if version > core.HandshakeVersionAuth {
+		version = core.HandshakeVersionAuth
+	}
 	if !peerPubKey.VerifySignature([]byte(core.HandshakeMessage), peerSignature) {
 		return errors.New("Invalid signature in tmp key from peer")
 	}
@@ -376,8 +382,12 @@ func (cc *ClientConn) handshake() error {
 	}
 	cc.sharedKey = sharedPrivKeyBytes
 
-	// Send local p2p address
-	encryptedMsg, err := core.Pack(sharedPrivKeyBytes, []byte(cc.GetLocalP2pAddress()))
+	// Send local p2p address, signed with the p2p key over both tmp keys
+	authMsg, err := core.CreateHandshakeAuth(version, cc.GetLocalP2pAddress(), cc.opts.p2pPubKey, cc.opts.p2pSigner, tmpPubKeyBytes, peerPubKeyBytes)
+	if err != nil {
+		return err
+	}
+	encryptedMsg, err := core.Pack(sharedPrivKeyBytes, authMsg)
 	if err != nil {
 		return err
 	}
@@ -385,15 +395,22 @@ func (cc *ClientConn) handshake() error {
 		return err
 	}
 
-	// Read remote p2p address
-	p2pAddressBytes, _, err := core.Unpack(cc.spbConn, sharedPrivKeyBytes, utils.MessageBeatLen)
+	// Read remote p2p address and verify that the remote holds the matching p2p key
+	peerAuthMsg, _, err := core.Unpack(cc.spbConn, sharedPrivKeyBytes, utils.MessageBeatLen)
+	if err != nil {
+		return err
+	}
+	remoteP2pAddress, peerVersion, err := core.VerifyHandshakeAuth(peerAuthMsg, tmpPubKeyBytes, peerPubKeyBytes)
 	if err != nil {
 		return err
 	}
-	cc.remoteP2pAddress = string(p2pAddressBytes)
-	if _, err = fwtypes.P2PAddressFromBech32(cc.remoteP2pAddress); err != nil {
-		return errors.Wrap(err, "incorrect P2pAddress")
+	if peerVersion != version {
+		return errors.Errorf("Server replied with handshake version [%v] instead of [%v]", peerVersion, version)
+	}
+	if version == core.HandshakeVersionLegacy {
+		utils.WarnLog(fmt.Sprintf("P2pAddress [%v] accepted the legacy handshake, its ownership isn't verified", remoteP2pAddress))
 	}
+	cc.remoteP2pAddress = remoteP2pAddress
 
 	return cc.spbConn.SetDeadline(time.Time{}) // Remove handshake timeout
 }
@@ -420,6 +437,7 @@ func (cc *ClientConn) Start() {
 	err = cc.handshake()
 	if err != nil {
 		Mylog(cc.opts.logOpen, LOG_MODULE_START, fmt.Sprintf("handshake error %v -> %v, %v", cc.spbConn.LocalAddr(), cc.spbConn.RemoteAddr(), err.Error()))
+		metrics.ConnHandshakeFailures.WithLabelValues("client").Inc()
 		cc.ClientClose(true)
 		return
 	}
@@ -650,7 +668,6 @@ func readLoop(c core.WriteCloser, wg *sync.WaitGroup) {
 
 	var msgH header.MessageHead
 	var msgS msg.MessageSign
-	var lr utils.LimitRate
 	var headerBytes []byte
 	var n int
 	var err error
@@ -735,13 +752,8 @@ func readLoop(c core.WriteCloser, wg *sync.WaitGroup) {
 						Mylog(cc.opts.logOpen, LOG_MODULE_READLOOP, "read server body err: "+err.Error())
 						return
 					}
-					if cmd == header.RspDownloadSlice.Id {
-						if maxDownloadRate > 0 {
-							lr.SetRate(maxDownloadRate)
-							lr.Limit()
-						}
-					}
 				}
+				core.ShapeTraffic(core.TRAFFIC_INBOUND, cmd, cc.remoteP2pAddress, int(secondPartLen))
 
 				// handle the second part after all bytes are received
 				if uint32(i) == secondPartLen {
@@ -848,7 +860,6 @@ func writeLoop(c core.WriteCloser, wg *sync.WaitGroup) {
 }
 
 func (cc *ClientConn) writePacket(m *msg.RelayMsgBuf) error {
-	var lr utils.LimitRate
 	var encodedHeader []byte
 	var encodedData []byte
 	var err error
@@ -894,6 +905,7 @@ func (cc *ClientConn) writePacket(m *msg.RelayMsgBuf) error {
 		return errors.Wrap(err, "server cannot encrypt msg")
 	}
 	writeStart := time.Now()
+	core.ShapeTraffic(core.TRAFFIC_OUTBOUND, cmd, cc.remoteP2pAddress, len(encodedData))
 	for i := 0; i < len(encodedData); i = i + n {
 		if len(encodedData)-i < 1024 {
 			onereadlen = len(encodedData) - i
@@ -903,12 +915,6 @@ func (cc *ClientConn) writePacket(m *msg.RelayMsgBuf) error {
 			break
 		}
 		cc.secondWriteFlowA = cc.secondWriteAtomA.AddAndGetNew(int64(n))
-		if cmd == header.ReqUploadFileSlice.Id {
-			if maxUploadRate > 0 {
-				lr.SetRate(maxUploadRate)
-				lr.Limit()
-			}
-		}
 	}
 	writeEnd := time.Now()
 	costTime := writeEnd.Sub(writeStart).Milliseconds() + 1 // +1 in case of LT 1 ms
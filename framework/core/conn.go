@@ -17,7 +17,6 @@ import (
 	"github.com/stratosnet/sds/framework/metrics"
 	fwmsg "github.com/stratosnet/sds/framework/msg"
 	"github.com/stratosnet/sds/framework/msg/header"
-	fwtypes "github.com/stratosnet/sds/framework/types"
 	"github.com/stratosnet/sds/framework/utils"
 )
 
@@ -204,7 +203,7 @@ func (sc *ServerConn) handshake() (error, bool) {
 		}
 
 		// Write the connection type as first fwmsg
-		firstMessage := CreateFirstMessage(ConnTypeHandshake, nil, 0, channelId)
+		firstMessage := CreateHandshakeFirstMessage(channelId)
 		if err = WriteFull(handshakeConn, firstMessage); err != nil {
 			return err, false
 		}
@@ -242,23 +241,32 @@ func (sc *ServerConn) handshake() (error, bool) {
 		}
 		sc.sharedKey = sharedPrivKeyBytes
 
-		// Send local p2p address
-		encryptedMsg, err := Pack(sharedPrivKeyBytes, []byte(sc.GetLocalP2pAddress()))
+		// Read remote p2p address first. The client signs it only when this node advertised HandshakeVersionAuth,
+		// and the reply uses the same format so older clients can still parse it
+		peerAuthMsg, _, err := Unpack(sc.spbConn, sharedPrivKeyBytes, utils.MessageBeatLen)
 		if err != nil {
 			return err, false
 		}
-		if err = WriteFull(sc.spbConn, encryptedMsg); err != nil {
+		remoteP2pAddress, version, err := VerifyHandshakeAuth(peerAuthMsg, tmpPubKeyBytes, peerPubKeyBytes)
+		if err != nil {
 			return err, false
 		}
+		if version == HandshakeVersionLegacy {
+			utils.WarnLog(fmt.Sprintf("P2pAddress [%v] connected with the legacy handshake, its ownership isn't verified", remoteP2pAddress))
+		}
+		sc.remoteP2pAddress = remoteP2pAddress
 
-		// Read remote p2p address
-		p2pAddressBytes, _, err := Unpack(sc.spbConn, sharedPrivKeyBytes, utils.MessageBeatLen)
+		// Send local p2p address, signed with the p2p key over both tmp keys
+		authMsg, err := CreateHandshakeAuth(version, sc.GetLocalP2pAddress(), sc.belong.opts.p2pPubKey, sc.belong.opts.p2pSigner, tmpPubKeyBytes, peerPubKeyBytes)
+		if err != nil {
+			return err, false
+		}
+		encryptedMsg, err := Pack(sharedPrivKeyBytes, authMsg)
 		if err != nil {
 			return err, false
 		}
-		sc.remoteP2pAddress = string(p2pAddressBytes)
-		if _, err = fwtypes.P2PAddressFromBech32(sc.remoteP2pAddress); err != nil {
-			return errors.Wrap(err, "incorrect P2pAddress"), false
+		if err = WriteFull(sc.spbConn, encryptedMsg); err != nil {
+			return err, false
 		}
 
 		_ = handshakeConn.Close()
@@ -269,7 +277,8 @@ func (sc *ServerConn) handshake() (error, bool) {
 			return err, false
 		}
 
-		// Write tmp key to channel for the corresponding client conn
+		// Write tmp key and the advertised handshake version to channel for the corresponding client conn
+		buffer = append(buffer, serverIP[0])
 		value, ok := HandshakeChanMap.Load(strconv.FormatUint(uint64(channelId), 10))
 		if !ok {
 			return errors.Errorf("No corresponding client conn was found for %v", sc.GetLocalAddr()), false
@@ -295,6 +304,7 @@ func (sc *ServerConn) Start() {
 	err, isHandshakeConn := sc.handshake()
 	if err != nil {
 		Mylog(sc.belong.opts.logOpen, LOG_MODULE_START, fmt.Sprintf("handshake error %v -> %v, %v", sc.spbConn.LocalAddr(), sc.spbConn.RemoteAddr(), err.Error()))
+		metrics.ConnHandshakeFailures.WithLabelValues("server").Inc()
 		sc.Close()
 		return
 	}
@@ -511,6 +521,7 @@ func readLoop(c WriteCloser, wg *sync.WaitGroup) {
 						return
 					}
 				}
+				ShapeTraffic(TRAFFIC_INBOUND, msgH.Cmd, sc.remoteP2pAddress, int(secondPartLen))
 
 				// handle the second part after all bytes are received
 				if uint32(i) == secondPartLen {
@@ -684,6 +695,7 @@ func (sc *ServerConn) writePacket(m *fwmsg.RelayMsgBuf) error {
 	}
 
 	writeStart := time.Now()
+	ShapeTraffic(TRAFFIC_OUTBOUND, cmd, sc.remoteP2pAddress, len(encodedData))
 	for i := 0; i < len(encodedData); i = i + n {
 		if len(encodedData)-i < 1024 {
 			onereadlen = len(encodedData) - i
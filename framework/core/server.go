@@ -49,6 +49,8 @@ type options struct {
 	maxflow        int
 	minAppVersion  uint16
 	p2pAddress     string
+	p2pPubKey      []byte
+	p2pSigner      msg.Signer
 	contextkv      []ContextKV
 	readTimeout    int64
 }
@@ -373,6 +375,14 @@ func P2pAddressOption(p2pAddress string) ServerOption {
 	}
 }
 
+// P2pKeyOption sets the P2P key used to prove ownership of the local P2P address during the handshake
+func P2pKeyOption(p2pPubKey []byte, signer msg.Signer) ServerOption {
+	return func(o *options) {
+		o.p2pPubKey = p2pPubKey
+		o.p2pSigner = signer
+	}
+}
+
 func ReadDeadlineOption(timeout int64) ServerOption {
 	return func(o *options) {
 		o.readTimeout = timeout
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"sync/atomic"
+)
+
+// Directions of the traffic passed to the bandwidth shaper
+const (
+	TRAFFIC_INBOUND = iota
+	TRAFFIC_OUTBOUND
+)
+
+// BandwidthShaper delays the messages going over the bandwidth allowed to the node
+type BandwidthShaper interface {
+	// Shape blocks until n bytes of a message of type cmd can be sent to or received from a peer
+	Shape(direction int, cmd uint8, peer string, n int)
+}
+
+type shaperHolder struct {
+	shaper BandwidthShaper
+}
+
+var bandwidthShaper atomic.Value
+
+// SetBandwidthShaper sets the shaper used by all the server and client connections. nil disables the shaping
+func SetBandwidthShaper(shaper BandwidthShaper) {
+	bandwidthShaper.Store(shaperHolder{shaper: shaper})
+}
+
+// ShapeTraffic waits for the bandwidth shaper to let n bytes of a message through
+func ShapeTraffic(direction int, cmd uint8, peer string, n int) {
+	if holder, ok := bandwidthShaper.Load().(shaperHolder); ok && holder.shaper != nil {
+		holder.shaper.Shape(direction, cmd, peer, n)
+	}
+}
@@ -1,6 +1,11 @@
 package core
 
-import "context"
+import (
+	"context"
+
+	fwed25519 "github.com/stratosnet/sds/framework/crypto/ed25519"
+	fwmsg "github.com/stratosnet/sds/framework/msg"
+)
 
 const (
 	// This is either a client creating a connection, or a temporary connection made for a handshake
@@ -10,10 +15,21 @@ const (
 	ConnTypeHandshake = "handshke"
 
 	HandshakeMessage = "sds_handshake"
+	// After the ECDH, each side proves it owns its P2P address: P2P address (44) + P2P pubkey (32) + signature (64)
+	HandshakeAuthSize = fwmsg.P2pAddressBech32Length + fwed25519.PubKeySize + fwed25519.SignatureSize
+
+	// The server advertises its handshake version in the otherwise unused IP bytes of the handshake conn first message.
+	// Older nodes leave them empty, which reads as HandshakeVersionLegacy
+	HandshakeVersionLegacy = 0 // P2P address sent as is, without proof of ownership
+	HandshakeVersionAuth   = 1 // P2P address sent with a signature from the P2P key (see HandshakeAuthSize)
 
 	EncryptionHeaderSize = EncryptionNonceSize + EncryptionLengthSize // Nonce (8) + data length (4)
 	EncryptionNonceSize  = 8
 	EncryptionLengthSize = 4
 )
 
+// AcceptLegacyHandshake lets nodes that don't sign their P2P address during the handshake connect for a transition
+// period, so they receive a bad version response instead of a dropped connection
+var AcceptLegacyHandshake = true
+
 type WriteHookFunc func(ctx context.Context, packetId, costTime int64, conn WriteCloser)
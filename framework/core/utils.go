@@ -8,7 +8,10 @@ import (
 
 	"github.com/pkg/errors"
 
+	fwed25519 "github.com/stratosnet/sds/framework/crypto/ed25519"
 	"github.com/stratosnet/sds/framework/crypto/encryption"
+	fwmsg "github.com/stratosnet/sds/framework/msg"
+	fwtypes "github.com/stratosnet/sds/framework/types"
 )
 
 func WriteFull(c net.Conn, data []byte) error {
@@ -46,6 +49,81 @@ func ParseFirstMessage(data []byte) (string, net.IP, uint16, uint32, error) {
 	return connType, ip, serverPort, channelId, nil
 }
 
+// handshakeAuthMessage returns the message signed with the P2P key during the handshake.
+// It covers the tmp keys of both sides, so the signature can't be replayed on another connection
+func handshakeAuthMessage(signerTmpPubKey, peerTmpPubKey []byte) []byte {
+	signMsg := make([]byte, 0, len(HandshakeMessage)+len(signerTmpPubKey)+len(peerTmpPubKey))
+	signMsg = append(signMsg, HandshakeMessage...)
+	signMsg = append(signMsg, signerTmpPubKey...)
+	return append(signMsg, peerTmpPubKey...)
+}
+
+// CreateHandshakeFirstMessage builds the first message of the handshake conn, advertising the local handshake version
+func CreateHandshakeFirstMessage(channelId uint32) []byte {
+	buffer := CreateFirstMessage(ConnTypeHandshake, nil, 0, channelId)
+	buffer[8] = HandshakeVersionAuth
+	return buffer
+}
+
+// CreateHandshakeAuth builds the message proving that the local node holds the private key of its P2P address.
+// With HandshakeVersionLegacy, only the P2P address is sent
+func CreateHandshakeAuth(version byte, p2pAddress string, p2pPubKey []byte, signer fwmsg.Signer, localTmpPubKey, peerTmpPubKey []byte) ([]byte, error) {
+	if len(p2pAddress) != fwmsg.P2pAddressBech32Length {
+		return nil, errors.Errorf("invalid local P2pAddress [%v]", p2pAddress)
+	}
+	if version == HandshakeVersionLegacy {
+		return []byte(p2pAddress), nil
+	}
+	if signer == nil || len(p2pPubKey) != fwed25519.PubKeySize {
+		return nil, errors.New("missing P2P key for handshake authentication")
+	}
+	signature, err := signer(handshakeAuthMessage(localTmpPubKey, peerTmpPubKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't sign handshake with P2P key")
+	}
+	if len(signature) != fwed25519.SignatureSize {
+		return nil, errors.Errorf("invalid handshake signature size [%v]", len(signature))
+	}
+
+	buffer := make([]byte, HandshakeAuthSize)
+	i := copy(buffer, p2pAddress)
+	i += copy(buffer[i:], p2pPubKey)
+	copy(buffer[i:], signature)
+	return buffer, nil
+}
+
+// VerifyHandshakeAuth checks that the peer signed both tmp keys with the P2P key matching its claimed P2P address.
+// It returns the authenticated P2P address of the peer and the handshake version it used.
+// A bare P2P address from an older node is only accepted while AcceptLegacyHandshake is set
+func VerifyHandshakeAuth(data, localTmpPubKey, peerTmpPubKey []byte) (string, byte, error) {
+	if len(data) == fwmsg.P2pAddressBech32Length && AcceptLegacyHandshake {
+		p2pAddress := string(data)
+		if _, err := fwtypes.P2PAddressFromBech32(p2pAddress); err != nil {
+			return "", 0, errors.Wrap(err, "incorrect P2pAddress")
+		}
+		return p2pAddress, HandshakeVersionLegacy, nil
+	}
+	if len(data) != HandshakeAuthSize {
+		return "", 0, errors.Errorf("invalid handshake auth size [%v]", len(data))
+	}
+	i := fwmsg.P2pAddressBech32Length
+	p2pAddress := string(data[:i])
+	p2pPubKey := data[i : i+fwed25519.PubKeySize]
+	i += fwed25519.PubKeySize
+	signature := data[i:]
+
+	if _, err := fwtypes.P2PAddressFromBech32(p2pAddress); err != nil {
+		return "", 0, errors.Wrap(err, "incorrect P2pAddress")
+	}
+	if !fwtypes.VerifyP2pAddrBytes(p2pPubKey, p2pAddress) {
+		return "", 0, errors.Errorf("P2pAddress [%v] doesn't match public key", p2pAddress)
+	}
+	if !fwtypes.VerifyP2pSignBytes(p2pPubKey, signature, handshakeAuthMessage(peerTmpPubKey, localTmpPubKey)) {
+		return "", 0, errors.Errorf("invalid handshake signature from P2pAddress [%v]", p2pAddress)
+	}
+	return p2pAddress, HandshakeVersionAuth, nil
+}
+
 func Pack(privKey, plaintext []byte) ([]byte, error) {
 	// set nonce to 0 when message is non-encrypted packed
 	packHead := make([]byte, EncryptionHeaderSize)
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"testing"
+
+	fwed25519 "github.com/stratosnet/sds/framework/crypto/ed25519"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+)
+
+func TestHandshakeAuth(t *testing.T) {
+	p2pKey := fwed25519.GenPrivKey()
+	p2pAddress := fwtypes.P2PAddress(p2pKey.PubKey().Address()).String()
+	localTmpPubKey := fwed25519.GenPrivKey().PubKey().Bytes()
+	peerTmpPubKey := fwed25519.GenPrivKey().PubKey().Bytes()
+
+	authMsg, err := CreateHandshakeAuth(HandshakeVersionAuth, p2pAddress, p2pKey.PubKey().Bytes(), p2pKey.Sign, localTmpPubKey, peerTmpPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The peer verifies with the tmp keys seen from its side of the connection
+	verifiedAddress, version, err := VerifyHandshakeAuth(authMsg, peerTmpPubKey, localTmpPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifiedAddress != p2pAddress || version != HandshakeVersionAuth {
+		t.Fatalf("expected P2pAddress %v with version %v, got %v with version %v", p2pAddress, HandshakeVersionAuth, verifiedAddress, version)
+	}
+
+	// Replaying the auth message on a connection with other tmp keys must fail
+	otherTmpPubKey := fwed25519.GenPrivKey().PubKey().Bytes()
+	if _, _, err = VerifyHandshakeAuth(authMsg, otherTmpPubKey, localTmpPubKey); err == nil {
+		t.Fatal("handshake auth should not verify with different tmp keys")
+	}
+
+	// Claiming another P2P address with our own key must fail
+	otherAddress := fwtypes.P2PAddress(fwed25519.GenPrivKey().PubKey().Address()).String()
+	forged := make([]byte, len(authMsg))
+	copy(forged, authMsg)
+	copy(forged, otherAddress)
+	if _, _, err = VerifyHandshakeAuth(forged, peerTmpPubKey, localTmpPubKey); err == nil {
+		t.Fatal("handshake auth should not verify with a P2P address that doesn't match the public key")
+	}
+
+	if _, err = CreateHandshakeAuth(HandshakeVersionAuth, p2pAddress, nil, nil, localTmpPubKey, peerTmpPubKey); err == nil {
+		t.Fatal("handshake auth should not be created without a P2P key")
+	}
+}
+
+func TestLegacyHandshakeAuth(t *testing.T) {
+	defer func(accept bool) { AcceptLegacyHandshake = accept }(AcceptLegacyHandshake)
+	p2pAddress := fwtypes.P2PAddress(fwed25519.GenPrivKey().PubKey().Address()).String()
+	localTmpPubKey := fwed25519.GenPrivKey().PubKey().Bytes()
+	peerTmpPubKey := fwed25519.GenPrivKey().PubKey().Bytes()
+
+	authMsg, err := CreateHandshakeAuth(HandshakeVersionLegacy, p2pAddress, nil, nil, localTmpPubKey, peerTmpPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(authMsg) != p2pAddress {
+		t.Fatalf("legacy handshake should only send the P2P address, got %v", string(authMsg))
+	}
+
+	AcceptLegacyHandshake = true
+	verifiedAddress, version, err := VerifyHandshakeAuth(authMsg, peerTmpPubKey, localTmpPubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifiedAddress != p2pAddress || version != HandshakeVersionLegacy {
+		t.Fatalf("expected P2pAddress %v with version %v, got %v with version %v", p2pAddress, HandshakeVersionLegacy, verifiedAddress, version)
+	}
+
+	AcceptLegacyHandshake = false
+	if _, _, err = VerifyHandshakeAuth(authMsg, peerTmpPubKey, localTmpPubKey); err == nil {
+		t.Fatal("legacy handshake should be rejected once AcceptLegacyHandshake is unset")
+	}
+}
@@ -0,0 +1,200 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	DataKeySize = 32
+
+	envelopeVersion  = 1
+	maxRecipients    = 255
+	sealedKeySize    = DataKeySize + 16 // AES-GCM appends a 16 bytes tag
+	wrappedKeySize   = 2*ed25519.PublicKeySize + 8 + sealedKeySize
+	envelopeHeadSize = 2 // version (1) + number of recipients (1)
+)
+
+// WrappedKey is the data key of a file, encrypted for one recipient with a key derived from an ephemeral ECDH exchange
+type WrappedKey struct {
+	RecipientPubKey []byte
+	EphemeralPubKey []byte
+	Nonce           uint64
+	SealedKey       []byte
+}
+
+// Envelope holds the data key of a file, wrapped for each recipient allowed to decrypt the file
+type Envelope struct {
+	Keys []WrappedKey
+}
+
+// NewDataKey generates a random AES-256 key to encrypt the content of a file
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// SealEnvelope wraps the data key for each of the given ed25519 public keys
+func SealEnvelope(dataKey []byte, recipientPubKeys ...[]byte) (*Envelope, error) {
+	if len(recipientPubKeys) == 0 {
+		return nil, errors.New("an envelope needs at least one recipient")
+	}
+	envelope := &Envelope{}
+	for _, pubKey := range recipientPubKeys {
+		if err := envelope.AddRecipient(dataKey, pubKey); err != nil {
+			return nil, err
+		}
+	}
+	return envelope, nil
+}
+
+// AddRecipient wraps the data key for one more public key. Recipients already in the envelope are ignored
+func (e *Envelope) AddRecipient(dataKey, recipientPubKey []byte) error {
+	if len(dataKey) != DataKeySize {
+		return fmt.Errorf("invalid data key size %v", len(dataKey))
+	}
+	if len(recipientPubKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid recipient public key size %v", len(recipientPubKey))
+	}
+	if e.HasRecipient(recipientPubKey) {
+		return nil
+	}
+	if len(e.Keys) >= maxRecipients {
+		return fmt.Errorf("an envelope can't have more than %v recipients", maxRecipients)
+	}
+
+	ephemeralPubKey, ephemeralPrivKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	kek, err := keyEncryptionKey(ephemeralPrivKey, recipientPubKey, ephemeralPubKey, recipientPubKey)
+	if err != nil {
+		return err
+	}
+	nonceBytes := make([]byte, 8)
+	if _, err = rand.Read(nonceBytes); err != nil {
+		return err
+	}
+	nonce := binary.BigEndian.Uint64(nonceBytes)
+	sealedKey, err := EncryptAES(kek, dataKey, nonce)
+	if err != nil {
+		return err
+	}
+
+	e.Keys = append(e.Keys, WrappedKey{
+		RecipientPubKey: append([]byte{}, recipientPubKey...),
+		EphemeralPubKey: ephemeralPubKey,
+		Nonce:           nonce,
+		SealedKey:       sealedKey,
+	})
+	return nil
+}
+
+// HasRecipient returns true if the data key is wrapped for the given public key
+func (e *Envelope) HasRecipient(pubKey []byte) bool {
+	for _, key := range e.Keys {
+		if bytes.Equal(key.RecipientPubKey, pubKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// Open unwraps the data key with the ed25519 private key of one of the recipients
+func (e *Envelope) Open(privKey []byte) ([]byte, error) {
+	if len(privKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key size %v", len(privKey))
+	}
+	pubKey := ed25519.PrivateKey(privKey).Public().(ed25519.PublicKey)
+	for _, key := range e.Keys {
+		if !bytes.Equal(key.RecipientPubKey, pubKey) {
+			continue
+		}
+		kek, err := keyEncryptionKey(privKey, key.EphemeralPubKey, key.EphemeralPubKey, pubKey)
+		if err != nil {
+			return nil, err
+		}
+		return DecryptAES(kek, key.SealedKey, key.Nonce, false)
+	}
+	return nil, errors.New("the envelope is not wrapped for this key")
+}
+
+// Rewrap opens the envelope with privKey, and wraps the data key again for a new set of recipients.
+// This is used to share a file, or to move a file to a new key without re-encrypting its content
+func (e *Envelope) Rewrap(privKey []byte, recipientPubKeys ...[]byte) (*Envelope, error) {
+	dataKey, err := e.Open(privKey)
+	if err != nil {
+		return nil, err
+	}
+	return SealEnvelope(dataKey, recipientPubKeys...)
+}
+
+// Bytes serializes the envelope
+func (e *Envelope) Bytes() []byte {
+	data := make([]byte, envelopeHeadSize, envelopeHeadSize+len(e.Keys)*wrappedKeySize)
+	data[0] = envelopeVersion
+	data[1] = byte(len(e.Keys))
+	for _, key := range e.Keys {
+		data = append(data, key.RecipientPubKey...)
+		data = append(data, key.EphemeralPubKey...)
+		data = binary.BigEndian.AppendUint64(data, key.Nonce)
+		data = append(data, key.SealedKey...)
+	}
+	return data
+}
+
+// EnvelopeSize returns the size of a serialized envelope with the given number of recipients
+func EnvelopeSize(recipients int) int {
+	return envelopeHeadSize + recipients*wrappedKeySize
+}
+
+// EnvelopeFromBytes parses a serialized envelope
+func EnvelopeFromBytes(data []byte) (*Envelope, error) {
+	if len(data) < envelopeHeadSize {
+		return nil, errors.New("envelope is too short")
+	}
+	if data[0] != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %v", data[0])
+	}
+	count := int(data[1])
+	if len(data) != EnvelopeSize(count) {
+		return nil, fmt.Errorf("invalid envelope size %v for %v recipients", len(data), count)
+	}
+
+	envelope := &Envelope{}
+	pos := envelopeHeadSize
+	for i := 0; i < count; i++ {
+		key := WrappedKey{}
+		key.RecipientPubKey = append([]byte{}, data[pos:pos+ed25519.PublicKeySize]...)
+		pos += ed25519.PublicKeySize
+		key.EphemeralPubKey = append([]byte{}, data[pos:pos+ed25519.PublicKeySize]...)
+		pos += ed25519.PublicKeySize
+		key.Nonce = binary.BigEndian.Uint64(data[pos : pos+8])
+		pos += 8
+		key.SealedKey = append([]byte{}, data[pos:pos+sealedKeySize]...)
+		pos += sealedKeySize
+		envelope.Keys = append(envelope.Keys, key)
+	}
+	return envelope, nil
+}
+
+// keyEncryptionKey derives the key used to wrap a data key from the ECDH shared secret, bound to both public keys
+func keyEncryptionKey(ourPrivKey, peerPubKey, ephemeralPubKey, recipientPubKey []byte) ([]byte, error) {
+	shared, err := ECDH(ourPrivKey, peerPubKey)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	hash.Write(shared)
+	hash.Write(ephemeralPubKey)
+	hash.Write(recipientPubKey)
+	return hash.Sum(nil), nil
+}
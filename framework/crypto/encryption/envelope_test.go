@@ -0,0 +1,66 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	publicA, privateA, _ := ed25519.GenerateKey(nil)
+	publicB, privateB, _ := ed25519.GenerateKey(nil)
+	publicC, privateC, _ := ed25519.GenerateKey(nil)
+
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal("Couldn't generate data key: " + err.Error())
+	}
+	envelope, err := SealEnvelope(dataKey, publicA, publicB, publicA)
+	if err != nil {
+		t.Fatal("Couldn't seal envelope: " + err.Error())
+	}
+	if len(envelope.Keys) != 2 {
+		t.Fatalf("Duplicate recipients should be ignored, got %v wrapped keys", len(envelope.Keys))
+	}
+
+	parsed, err := EnvelopeFromBytes(envelope.Bytes())
+	if err != nil {
+		t.Fatal("Couldn't parse envelope: " + err.Error())
+	}
+	for _, privKey := range [][]byte{privateA, privateB} {
+		opened, err := parsed.Open(privKey)
+		if err != nil {
+			t.Fatal("Couldn't open envelope: " + err.Error())
+		}
+		if !bytes.Equal(opened, dataKey) {
+			t.Fatal("The unwrapped key should be the data key")
+		}
+	}
+	if _, err = parsed.Open(privateC); err == nil {
+		t.Fatal("A key that is not a recipient should not open the envelope")
+	}
+
+	// Move the file to C without B
+	rewrapped, err := parsed.Rewrap(privateA, publicA, publicC)
+	if err != nil {
+		t.Fatal("Couldn't rewrap envelope: " + err.Error())
+	}
+	opened, err := rewrapped.Open(privateC)
+	if err != nil || !bytes.Equal(opened, dataKey) {
+		t.Fatal("The new recipient should open the rewrapped envelope")
+	}
+	if _, err = rewrapped.Open(privateB); err == nil {
+		t.Fatal("A removed recipient should not open the rewrapped envelope")
+	}
+
+	// A tampered wrapped key must not open
+	tampered := rewrapped.Bytes()
+	tampered[len(tampered)-1] ^= 0xff
+	tamperedEnvelope, err := EnvelopeFromBytes(tampered)
+	if err != nil {
+		t.Fatal("Couldn't parse envelope: " + err.Error())
+	}
+	if _, err = tamperedEnvelope.Open(privateC); err == nil {
+		t.Fatal("A tampered envelope should not open")
+	}
+}
@@ -162,6 +162,24 @@ func CalcSliceHash(data []byte, fileHash string, sliceNumber uint64) (string, er
 	return sliceCid.Encode(encoder), nil
 }
 
+// CalcContentSliceHash calculates the hash of a deduplicated slice. It only depends on the slice data, so identical
+// slices of different files share the same hash
+func CalcContentSliceHash(data []byte) string {
+	sliceHash, _ := mh.Sum(data, mh.KECCAK_256, hashLen)
+	sliceCid := cid.NewCidV1(cid.Raw, sliceHash)
+	encoder, _ := mbase.NewEncoder(mbase.Base32hex)
+	return sliceCid.Encode(encoder)
+}
+
+// VerifySliceHash checks that sliceHash is either the regular hash or the content hash of the slice data
+func VerifySliceHash(data []byte, fileHash string, sliceNumber uint64, sliceHash string) (bool, error) {
+	calculated, err := CalcSliceHash(data, fileHash, sliceNumber)
+	if err != nil {
+		return false, err
+	}
+	return calculated == sliceHash || CalcContentSliceHash(data) == sliceHash, nil
+}
+
 func uint64ToBytes(n uint64) []byte {
 	byteBuf := bytes.NewBuffer([]byte{})
 	_ = binary.Write(byteBuf, binary.BigEndian, n)
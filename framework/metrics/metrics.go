@@ -28,4 +28,12 @@ var (
 		},
 		[]string{"ip_address"},
 	)
+
+	ConnHandshakeFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sp_conn_handshake_failures",
+			Help: ": number of connections closed because the handshake failed",
+		},
+		[]string{"type"},
+	)
 )
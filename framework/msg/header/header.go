@@ -149,6 +149,10 @@ const (
 	MSG_ID_REQ_VERIFY_RESULT
 	MSG_ID_RSP_VERIFY_RESULT
 	MSG_ID_RSP_VERIFY_DOWNLOAD_RESULT
+	MSG_ID_REQ_REPORT_CORRUPTED_SLICE
+	MSG_ID_RSP_REPORT_CORRUPTED_SLICE
+	MSG_ID_REQ_GET_SLICE_ORIGIN
+	MSG_ID_RSP_GET_SLICE_ORIGIN
 	NUMBER_MESSAGE_TYPES
 )
 
@@ -290,6 +294,11 @@ var (
 	ReqClearExpiredShareLinks MsgType
 	RspClearExpiredShareLinks MsgType
 
+	ReqReportCorruptedSlice MsgType
+	RspReportCorruptedSlice MsgType
+	ReqGetSliceOrigin       MsgType
+	RspGetSliceOrigin       MsgType
+
 	registeredMessages [NUMBER_MESSAGE_TYPES]*MsgType
 )
 
@@ -447,6 +456,12 @@ func init() {
 
 	registerOneMessageType(&ReqClearExpiredShareLinks, MSG_ID_REQ_CLEAR_EXPIRED_SHARE_LINKS, "ReqCESL")
 	registerOneMessageType(&RspClearExpiredShareLinks, MSG_ID_RSP_CLEAR_EXPIRED_SHARE_LINKS, "RspCESL")
+
+	// stored slices checked by the scrub
+	registerOneMessageType(&ReqReportCorruptedSlice, MSG_ID_REQ_REPORT_CORRUPTED_SLICE, "ReqRCS")
+	registerOneMessageType(&RspReportCorruptedSlice, MSG_ID_RSP_REPORT_CORRUPTED_SLICE, "RspRCS")
+	registerOneMessageType(&ReqGetSliceOrigin, MSG_ID_REQ_GET_SLICE_ORIGIN, "ReqGSO")
+	registerOneMessageType(&RspGetSliceOrigin, MSG_ID_RSP_GET_SLICE_ORIGIN, "RspGSO")
 }
 
 func GetMsgTypeFromId(id uint8) *MsgType {
@@ -546,6 +561,10 @@ func GetReqIdFromRspId(reqId uint8) uint8 {
 		return MSG_ID_REQ_BLS_SIGNATURE
 	case MSG_ID_RSP_CLEAR_EXPIRED_SHARE_LINKS:
 		return MSG_ID_REQ_CLEAR_EXPIRED_SHARE_LINKS
+	case MSG_ID_RSP_REPORT_CORRUPTED_SLICE:
+		return MSG_ID_REQ_REPORT_CORRUPTED_SLICE
+	case MSG_ID_RSP_GET_SLICE_ORIGIN:
+		return MSG_ID_REQ_GET_SLICE_ORIGIN
 	default:
 		return MSG_ID_INVALID
 	}
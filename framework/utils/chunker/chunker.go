@@ -0,0 +1,146 @@
+// Package chunker cuts data at content-defined boundaries, using a gear rolling hash (FastCDC).
+// Inserting or removing bytes only changes the chunks around the edit, the following chunks keep the same boundaries.
+package chunker
+
+import (
+	"io"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+// gear maps each byte value to a pseudo-random number. It must be the same on every node, so it is generated from a fixed seed
+var gear [256]uint64
+
+func init() {
+	seed := uint64(0x5d5d5d5d5d5d5d5d)
+	for i := range gear {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunk is the position of a chunk in the data
+type Chunk struct {
+	Offset uint64
+	Length uint64
+}
+
+// Chunker reads a stream and returns its chunks. Chunks are between minSize and maxSize bytes, and avgSize bytes on average
+type Chunker struct {
+	r       io.Reader
+	minSize int
+	avgSize int
+	maxSize int
+	maskS   uint64 // harder to match, used before avgSize
+	maskL   uint64 // easier to match, used after avgSize
+	mem     []byte
+	buf     []byte
+	offset  uint64
+	eof     bool
+}
+
+// New creates a Chunker reading from r. avgSize is rounded down to a power of 2
+func New(r io.Reader, minSize, avgSize, maxSize int) (*Chunker, error) {
+	if minSize <= 0 || minSize > avgSize || avgSize > maxSize {
+		return nil, errors.Errorf("invalid chunk sizes: min %v, avg %v, max %v", minSize, avgSize, maxSize)
+	}
+	avgBits := bits.Len(uint(avgSize)) - 1
+	if avgBits < 2 || avgBits > 62 {
+		return nil, errors.Errorf("invalid average chunk size %v", avgSize)
+	}
+	return &Chunker{
+		r:       r,
+		minSize: minSize,
+		avgSize: 1 << avgBits,
+		maxSize: maxSize,
+		maskS:   ^uint64(0) << (64 - avgBits - 1),
+		maskL:   ^uint64(0) << (64 - avgBits + 1),
+		mem:     make([]byte, maxSize),
+	}, nil
+}
+
+// Next returns the next chunk, or io.EOF once all the data was chunked
+func (c *Chunker) Next() (Chunk, error) {
+	if err := c.fill(); err != nil {
+		return Chunk{}, err
+	}
+	if len(c.buf) == 0 {
+		return Chunk{}, io.EOF
+	}
+	length := c.cutPoint(c.buf)
+	chunk := Chunk{Offset: c.offset, Length: uint64(length)}
+	c.buf = c.buf[length:]
+	c.offset += uint64(length)
+	return chunk, nil
+}
+
+// All returns all the chunks of the stream
+func (c *Chunker) All() ([]Chunk, error) {
+	var chunks []Chunk
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+// fill makes sure the buffer holds maxSize bytes, unless the end of the stream was reached
+func (c *Chunker) fill() error {
+	if c.eof || len(c.buf) >= c.maxSize {
+		return nil
+	}
+	n := copy(c.mem, c.buf)
+	for n < c.maxSize {
+		read, err := c.r.Read(c.mem[n:])
+		n += read
+		if err == io.EOF {
+			c.eof = true
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed reading data to chunk")
+		}
+	}
+	c.buf = c.mem[:n]
+	return nil
+}
+
+func (c *Chunker) cutPoint(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	if n > c.maxSize {
+		n = c.maxSize
+	}
+	normal := c.avgSize
+	if normal > n {
+		normal = n
+	}
+
+	var hash uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
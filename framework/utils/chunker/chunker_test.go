@@ -0,0 +1,55 @@
+package chunker
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func chunkAll(t *testing.T, data []byte) []Chunk {
+	c, err := New(bytes.NewReader(data), 1024, 4096, 16384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := c.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunks
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := chunkAll(t, data)
+	var offset uint64
+	for i, chunk := range chunks {
+		if chunk.Offset != offset {
+			t.Fatalf("chunk %v starts at %v, expected %v", i, chunk.Offset, offset)
+		}
+		if chunk.Length > 16384 || (chunk.Length < 1024 && i != len(chunks)-1) {
+			t.Fatalf("chunk %v has an invalid length %v", i, chunk.Length)
+		}
+		offset += chunk.Length
+	}
+	if offset != uint64(len(data)) {
+		t.Fatalf("chunks cover %v bytes, expected %v", offset, len(data))
+	}
+
+	// Inserting data at the beginning only changes the first chunks
+	edited := append([]byte("some inserted bytes"), data...)
+	contents := make(map[string]bool)
+	for _, chunk := range chunks {
+		contents[string(data[chunk.Offset:chunk.Offset+chunk.Length])] = true
+	}
+	shared := 0
+	for _, chunk := range chunkAll(t, edited) {
+		if contents[string(edited[chunk.Offset:chunk.Offset+chunk.Length])] {
+			shared++
+		}
+	}
+	if shared < len(chunks)-2 {
+		t.Fatalf("only %v of %v chunks are unchanged after inserting data", shared, len(chunks))
+	}
+}
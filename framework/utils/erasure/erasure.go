@@ -0,0 +1,184 @@
+// Package erasure implements a systematic Reed-Solomon erasure code over GF(2^8)
+package erasure
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	MaxTotalShards = 255
+)
+
+var (
+	ErrTooFewShards     = errors.New("too few shards to reconstruct the data")
+	ErrShardSizeInvalid = errors.New("shards must all have the same size")
+)
+
+// Encoder splits data into dataShards shards, and computes parityShards extra shards.
+// The data can be rebuilt from any dataShards of the dataShards+parityShards shards
+type Encoder struct {
+	dataShards   int
+	parityShards int
+	matrix       matrix // (dataShards+parityShards) x dataShards. The top rows are the identity matrix
+}
+
+// New creates an encoder for the given number of data and parity shards
+func New(dataShards, parityShards int) (*Encoder, error) {
+	if dataShards <= 0 || parityShards <= 0 {
+		return nil, errors.New("the number of data and parity shards must be positive")
+	}
+	if dataShards+parityShards > MaxTotalShards {
+		return nil, fmt.Errorf("can't have more than %v shards in total", MaxTotalShards)
+	}
+
+	// A vandermonde matrix multiplied by the inverse of its top square keeps every square subset invertible,
+	// and makes the code systematic: data shards are stored as they are
+	vm := vandermonde(dataShards+parityShards, dataShards)
+	top, err := vm.subMatrix(0, dataShards).invert()
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		matrix:       vm.multiply(top),
+	}, nil
+}
+
+// DataShards returns the number of data shards
+func (e *Encoder) DataShards() int {
+	return e.dataShards
+}
+
+// ParityShards returns the number of parity shards
+func (e *Encoder) ParityShards() int {
+	return e.parityShards
+}
+
+// Split cuts data into equally sized data shards, padded with zeros, and allocates empty parity shards
+func (e *Encoder) Split(data []byte) [][]byte {
+	shardSize := (len(data) + e.dataShards - 1) / e.dataShards
+	if shardSize == 0 {
+		shardSize = 1
+	}
+	padded := make([]byte, shardSize*(e.dataShards+e.parityShards))
+	copy(padded, data)
+
+	shards := make([][]byte, e.dataShards+e.parityShards)
+	for i := range shards {
+		shards[i] = padded[i*shardSize : (i+1)*shardSize : (i+1)*shardSize]
+	}
+	return shards
+}
+
+// Encode computes the parity shards from the data shards. All shards must have the same size
+func (e *Encoder) Encode(shards [][]byte) error {
+	if len(shards) != e.dataShards+e.parityShards {
+		return fmt.Errorf("expected %v shards, got %v", e.dataShards+e.parityShards, len(shards))
+	}
+	shardSize, err := checkShardSize(shards, false)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < e.parityShards; i++ {
+		if len(shards[e.dataShards+i]) != shardSize {
+			return ErrShardSizeInvalid
+		}
+		e.matrix[e.dataShards+i].mulShards(shards[:e.dataShards], shards[e.dataShards+i])
+	}
+	return nil
+}
+
+// Reconstruct rebuilds the missing shards. Missing shards must be nil or empty, and at least DataShards shards must be present
+func (e *Encoder) Reconstruct(shards [][]byte) error {
+	if len(shards) != e.dataShards+e.parityShards {
+		return fmt.Errorf("expected %v shards, got %v", e.dataShards+e.parityShards, len(shards))
+	}
+	shardSize, err := checkShardSize(shards, true)
+	if err != nil {
+		return err
+	}
+
+	var present []int
+	for i, shard := range shards {
+		if len(shard) != 0 {
+			present = append(present, i)
+		}
+	}
+	if len(present) < e.dataShards {
+		return ErrTooFewShards
+	}
+	if len(present) == len(shards) {
+		return nil
+	}
+
+	// Rebuild the data shards from the first dataShards shards present
+	present = present[:e.dataShards]
+	sub := make(matrix, e.dataShards)
+	subShards := make([][]byte, e.dataShards)
+	for i, index := range present {
+		sub[i] = e.matrix[index]
+		subShards[i] = shards[index]
+	}
+	decode, err := sub.invert()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < e.dataShards; i++ {
+		if len(shards[i]) != 0 {
+			continue
+		}
+		shards[i] = make([]byte, shardSize)
+		decode[i].mulShards(subShards, shards[i])
+	}
+
+	// Then compute the missing parity shards again
+	for i := e.dataShards; i < len(shards); i++ {
+		if len(shards[i]) != 0 {
+			continue
+		}
+		shards[i] = make([]byte, shardSize)
+		e.matrix[i].mulShards(shards[:e.dataShards], shards[i])
+	}
+	return nil
+}
+
+// Join concatenates the data shards and trims the padding added by Split
+func (e *Encoder) Join(shards [][]byte, size int) ([]byte, error) {
+	if len(shards) < e.dataShards {
+		return nil, ErrTooFewShards
+	}
+	data := make([]byte, 0, size)
+	for _, shard := range shards[:e.dataShards] {
+		if len(shard) == 0 {
+			return nil, ErrTooFewShards
+		}
+		data = append(data, shard...)
+	}
+	if len(data) < size {
+		return nil, errors.New("shards are too short for the requested size")
+	}
+	return data[:size], nil
+}
+
+func checkShardSize(shards [][]byte, allowMissing bool) (int, error) {
+	size := 0
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			if allowMissing {
+				continue
+			}
+			return 0, ErrShardSizeInvalid
+		}
+		if size == 0 {
+			size = len(shard)
+		} else if len(shard) != size {
+			return 0, ErrShardSizeInvalid
+		}
+	}
+	if size == 0 {
+		return 0, ErrShardSizeInvalid
+	}
+	return size, nil
+}
@@ -0,0 +1,53 @@
+package erasure
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestReconstruct(t *testing.T) {
+	encoder, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1000+rand.Intn(1000))
+	rand.Read(data)
+
+	shards := encoder.Split(data)
+	if err = encoder.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any 2 missing shards can be rebuilt
+	for i := 0; i < len(shards); i++ {
+		for j := i + 1; j < len(shards); j++ {
+			damaged := make([][]byte, len(shards))
+			copy(damaged, shards)
+			damaged[i] = nil
+			damaged[j] = nil
+			if err = encoder.Reconstruct(damaged); err != nil {
+				t.Fatalf("couldn't reconstruct without shards %v and %v: %v", i, j, err)
+			}
+			for k := range shards {
+				if !bytes.Equal(damaged[k], shards[k]) {
+					t.Fatalf("shard %v is wrong after reconstruction without shards %v and %v", k, i, j)
+				}
+			}
+			joined, err := encoder.Join(damaged, len(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Fatal("joined data is different from the original data")
+			}
+		}
+	}
+
+	damaged := make([][]byte, len(shards))
+	copy(damaged, shards)
+	damaged[0], damaged[3], damaged[5] = nil, nil, nil
+	if err = encoder.Reconstruct(damaged); err != ErrTooFewShards {
+		t.Fatalf("expected ErrTooFewShards, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package erasure
+
+import "errors"
+
+// GF(2^8) arithmetic, generated by the polynomial x^8 + x^4 + x^3 + x^2 + 1
+const fieldPolynomial = 0x11d
+
+var (
+	expTable [510]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= fieldPolynomial
+		}
+	}
+}
+
+func galMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func galDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
+
+func galExp(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])*n)%255]
+}
+
+// row is a row of coefficients of a matrix
+type row []byte
+
+// mulShards sets out to the linear combination of the shards with the coefficients of the row
+func (r row) mulShards(shards [][]byte, out []byte) {
+	for i := range out {
+		out[i] = 0
+	}
+	for i, coefficient := range r {
+		if coefficient == 0 {
+			continue
+		}
+		shard := shards[i]
+		if coefficient == 1 {
+			for j := range out {
+				out[j] ^= shard[j]
+			}
+			continue
+		}
+		for j := range out {
+			out[j] ^= galMul(coefficient, shard[j])
+		}
+	}
+}
+
+type matrix []row
+
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for i := range m {
+		m[i] = make(row, cols)
+	}
+	return m
+}
+
+func vandermonde(rows, cols int) matrix {
+	m := newMatrix(rows, cols)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			m[r][c] = galExp(byte(r), c)
+		}
+	}
+	return m
+}
+
+func (m matrix) subMatrix(from, to int) matrix {
+	sub := newMatrix(to-from, len(m[0]))
+	for i := from; i < to; i++ {
+		copy(sub[i-from], m[i])
+	}
+	return sub
+}
+
+func (m matrix) multiply(other matrix) matrix {
+	result := newMatrix(len(m), len(other[0]))
+	for r := range m {
+		for c := range other[0] {
+			var value byte
+			for i := range m[r] {
+				value ^= galMul(m[r][i], other[i][c])
+			}
+			result[r][c] = value
+		}
+	}
+	return result
+}
+
+// invert returns the inverse of a square matrix, using a Gauss-Jordan elimination
+func (m matrix) invert() (matrix, error) {
+	size := len(m)
+	work := newMatrix(size, 2*size)
+	for r := range m {
+		copy(work[r], m[r])
+		work[r][size+r] = 1
+	}
+
+	for c := 0; c < size; c++ {
+		if work[c][c] == 0 {
+			for r := c + 1; r < size; r++ {
+				if work[r][c] != 0 {
+					work[c], work[r] = work[r], work[c]
+					break
+				}
+			}
+		}
+		if work[c][c] == 0 {
+			return nil, errors.New("matrix is singular")
+		}
+		if work[c][c] != 1 {
+			scale := galDiv(1, work[c][c])
+			for i := range work[c] {
+				work[c][i] = galMul(work[c][i], scale)
+			}
+		}
+		for r := 0; r < size; r++ {
+			if r == c || work[r][c] == 0 {
+				continue
+			}
+			factor := work[r][c]
+			for i := range work[r] {
+				work[r][i] ^= galMul(factor, work[c][i])
+			}
+		}
+	}
+
+	inverse := newMatrix(size, size)
+	for r := range work {
+		copy(inverse[r], work[r][size:])
+	}
+	return inverse, nil
+}
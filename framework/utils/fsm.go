@@ -39,16 +39,23 @@ func (s State) string() string {
 	return s.Name
 }
 
-func (fsm *Fsm) RunFsm(ctx context.Context, e uint64) {
+// RunFsm applies an event to the state machine, and returns the states before and after the event
+func (fsm *Fsm) RunFsm(ctx context.Context, e uint64) (State, State) {
 	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
 	oldState := fsm.stateList[fsm.stateId]
 	item := fsm.StateTransTable[fsm.stateId][e]
 	fsm.stateId = item.NewState
 	if item.Action != nil {
 		item.Action(ctx)
 	}
-	DebugLogf("RunFsm: S.%v ---E.%v---> S.%v", oldState.string(), fsm.eventList[e].string(), fsm.stateList[fsm.stateId].string())
-	fsm.mutex.Unlock()
+	newState := fsm.stateList[fsm.stateId]
+	DebugLogf("RunFsm: S.%v ---E.%v---> S.%v", oldState.string(), fsm.eventList[e].string(), newState.string())
+	return oldState, newState
+}
+
+func (fsm *Fsm) GetEvent(e uint64) Event {
+	return fsm.eventList[e]
 }
 
 func (fsm *Fsm) GetState() State {
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunFsm(t *testing.T) {
+	states := []State{{Id: 0, Name: "OFF"}, {Id: 1, Name: "ON"}}
+	events := []Event{{Id: 0, Name: "PRESS"}, {Id: 1, Name: "IGNORED"}}
+	actions := 0
+	var fsm Fsm
+	err := fsm.InitFsm(states, events, func(f *Fsm) {
+		f.StateTransTable = [][]TransitionItem{
+			{{NewState: 1, Action: func(ctx context.Context) { actions++ }}, {NewState: 0}},
+			{{NewState: 0}, {NewState: 1}},
+		}
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := fsm.RunFsm(context.Background(), 0)
+	if from.Name != "OFF" || to.Name != "ON" || fsm.GetState().Name != "ON" || actions != 1 {
+		t.Fatalf("unexpected transition %v -> %v, %v actions", from.Name, to.Name, actions)
+	}
+	from, to = fsm.RunFsm(context.Background(), 1)
+	if from.Id != to.Id || to.Name != "ON" {
+		t.Fatalf("unexpected transition %v -> %v", from.Name, to.Name)
+	}
+	if fsm.GetEvent(1).Name != "IGNORED" {
+		t.Fatal("wrong event")
+	}
+}
@@ -96,16 +96,18 @@ func NewErrorJson(errcode int, msg string) *jsonResult {
 }
 
 type MyHTTPServ struct {
-	routeMap map[string]*myHTTPHandler
-	timeout  time.Duration
-	port     string
+	routeMap    map[string]*myHTTPHandler
+	streamRoute map[string]*myHTTPHandler
+	timeout     time.Duration
+	port        string
 }
 
 func MyNewHTTPServ(port string) *MyHTTPServ {
 	return &MyHTTPServ{
-		routeMap: make(map[string]*myHTTPHandler),
-		timeout:  30 * time.Second,
-		port:     port,
+		routeMap:    make(map[string]*myHTTPHandler),
+		streamRoute: make(map[string]*myHTTPHandler),
+		timeout:     30 * time.Second,
+		port:        port,
 	}
 }
 
@@ -130,13 +132,27 @@ func (hs *MyHTTPServ) MyRoute(url string, h funcMyHandler) {
 	hs.routeMap[url] = handler
 }
 
+// MyStreamRoute registers a handler that is not subject to the server timeout, for responses streamed over a long time
+func (hs *MyHTTPServ) MyStreamRoute(url string, h funcMyHandler) {
+	hs.streamRoute[url] = &myHTTPHandler{fh: h}
+}
+
 func (hs *MyHTTPServ) MyStart(ctx context.Context) {
 	mux := http.NewServeMux()
 	for url, handler := range hs.routeMap {
 		mux.Handle(url, handler)
 		utils.DebugLog("register route: ", url)
 	}
-	h := http.TimeoutHandler(mux, hs.timeout, "http time out!")
+	var h http.Handler = http.TimeoutHandler(mux, hs.timeout, "http time out!")
+	if len(hs.streamRoute) > 0 {
+		streamMux := http.NewServeMux()
+		streamMux.Handle("/", h)
+		for url, handler := range hs.streamRoute {
+			streamMux.Handle(url, handler)
+			utils.DebugLog("register stream route: ", url)
+		}
+		h = streamMux
+	}
 	utils.Log("Start HTTP Server...")
 	server := &http.Server{Addr: ":" + hs.port, Handler: h}
 	server.BaseContext = func(listener net.Listener) context.Context {
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket limits a flow to a rate in bytes per second, allowing bursts up to its capacity. Bytes taken beyond the
+// available tokens are owed, and delay the next takers
+type TokenBucket struct {
+	mtx    sync.Mutex
+	rate   float64 // 0 means unlimited
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate, burst uint64) *TokenBucket {
+	b := &TokenBucket{}
+	b.SetRate(rate, burst)
+	return b
+}
+
+// SetRate changes the rate of the bucket. The burst defaults to one second of traffic
+func (b *TokenBucket) SetRate(rate, burst uint64) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if burst == 0 {
+		burst = rate
+	}
+	b.rate = float64(rate)
+	b.burst = float64(burst)
+	if b.tokens > b.burst || b.last.IsZero() {
+		b.tokens = b.burst
+	}
+}
+
+func (b *TokenBucket) GetRate() uint64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return uint64(b.rate)
+}
+
+// Reserve takes n bytes from the bucket, and returns how long to wait before using them
+func (b *TokenBucket) Reserve(n int, now time.Time) time.Duration {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Wait blocks until n bytes can be used
+func (b *TokenBucket) Wait(n int) {
+	if wait := b.Reserve(n, time.Now()); wait > 0 {
+		time.Sleep(wait)
+	}
+}
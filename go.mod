@@ -12,6 +12,7 @@ require (
 	github.com/glendc/go-external-ip v0.1.0
 	github.com/google/uuid v1.3.1
 	github.com/gorilla/websocket v1.5.0
+	github.com/hanwen/go-fuse/v2 v2.4.0
 	github.com/ipfs/go-cid v0.3.2
 	github.com/klauspost/compress v1.17.2
 	github.com/multiformats/go-multibase v0.2.0
@@ -90,3 +91,9 @@ require (
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	lukechampine.com/blake3 v1.1.6 // indirect
 )
+
+replace github.com/stratosnet/sds/framework => ./framework
+
+replace github.com/stratosnet/sds/sds-msg => ./sds-msg
+
+replace github.com/stratosnet/sds/tx-client => ./tx-client
@@ -10,6 +10,7 @@ import (
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/pp"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
 	"github.com/stratosnet/sds/tx-client/grpc"
 )
 
@@ -52,6 +53,10 @@ func CreateWallet(ctx context.Context, password, name, mnemonic, hdPath string)
 }
 
 func GetWalletAddress(ctx context.Context) error {
+	if setting.Config.Keys.WalletSigner != "" {
+		return connectWalletSigner(ctx, setting.Config.Keys.WalletAddress, setting.Config.Keys.WalletSigner)
+	}
+
 	files, err := os.ReadDir(setting.Config.Home.AccountsPath)
 
 	if len(files) == 0 {
@@ -87,6 +92,23 @@ func GetWalletAddress(ctx context.Context) error {
 	return errors.New("could not find the account file corresponds to the configured wallet address")
 }
 
+// connectWalletSigner uses a signer process for the wallet, so the node never decrypts the keystore
+func connectWalletSigner(ctx context.Context, walletAddress, signerAddress string) error {
+	remote, err := signer.DialRemoteSigner(signerAddress)
+	if err != nil {
+		return err
+	}
+	if fwtypes.WalletAddress(remote.PubKey().Address()).String() != walletAddress {
+		_ = remote.Close()
+		return errors.New("the wallet of the signer is not the configured wallet address")
+	}
+	setting.WalletSigner = remote
+	setting.WalletPublicKey = remote.PubKey()
+	setting.WalletAddress = walletAddress
+	pp.Log(ctx, "wallet signer connected ", walletAddress)
+	return getBeneficiaryAddress(ctx, walletAddress)
+}
+
 func getBeneficiaryAddress(ctx context.Context, walletAddressBech32 string) error {
 	if setting.Config.Keys.BeneficiaryAddress == "" {
 		setting.BeneficiaryAddress = walletAddressBech32
@@ -121,7 +143,7 @@ func getWalletPublicKey(ctx context.Context, filePath, password string) bool {
 		pp.ErrorLog(ctx, "getWalletPublicKey DecryptKey", err)
 		return false
 	}
-	setting.WalletPrivateKey = key.PrivateKey
+	setting.WalletSigner = signer.NewLocalSigner(key.PrivateKey)
 	setting.WalletPublicKey = key.PrivateKey.PubKey()
 
 	bech32PubKey, _ := fwtypes.WalletPubKeyToBech32(setting.WalletPublicKey)
@@ -0,0 +1,490 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/crypto"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/framework/utils/httpserv"
+	"github.com/stratosnet/sds/sds-msg/protos"
+	msgutils "github.com/stratosnet/sds/sds-msg/utils"
+
+	rpc_api "github.com/stratosnet/sds/pp/api/rpc"
+	"github.com/stratosnet/sds/pp/bandwidth"
+	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/pp/namespace"
+	"github.com/stratosnet/sds/pp/requests"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
+	"github.com/stratosnet/sds/pp/task"
+)
+
+const (
+	GatewayFilePath  = "/sdm/"
+	GatewaySharePath = "/sds/"
+	// GatewayScope is the scope of the rpc tokens accepted by the gateway
+	GatewayScope = "gateway"
+
+	// sniffLen is the number of bytes used to detect the content type of a file
+	sniffLen = 512
+	// maxGatewayCacheEntries is the number of files whose content type and share link are kept by the gateway
+	maxGatewayCacheEntries = 4096
+)
+
+var errGatewayUnsupported = errors.New("encrypted, erasure coded and video stream files can't be served by the gateway")
+
+var (
+	gatewayTokens     *namespace.RpcTokenStore
+	gatewayTokensOnce sync.Once
+)
+
+var (
+	// sniffedContentTypes keeps the detected content type of the files served by the gateway, by file hash
+	sniffedContentTypes = newGatewayCache(maxGatewayCacheEntries)
+	// sharedFileHashes keeps the file hash of the share links served by the gateway, to revalidate them without the SP
+	sharedFileHashes = newGatewayCache(maxGatewayCacheEntries)
+)
+
+// GatewayFile serves the content of a file by its sdm path, /sdm/<owner>/<fileHash>. The local wallet pays for the
+// traffic, so the request needs a token with the gateway scope
+func GatewayFile(w http.ResponseWriter, req *http.Request) {
+	if !authorizeGateway(w, req) {
+		return
+	}
+	owner, fileHash, err := parseFilePath(req.URL.Path)
+	if err != nil {
+		gatewayError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The content of a file never changes, no need to ask the SP to revalidate it
+	if etagMatches(req.Header.Get("If-None-Match"), fileHash) {
+		w.Header().Set("ETag", fileETag(fileHash))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	serveGateway(w, req, func(ctx context.Context) (*protos.RspFileStorageInfo, error) {
+		return requestGatewayFile(ctx, fwtypes.DataMeshId{Owner: owner, Hash: fileHash})
+	})
+}
+
+// GatewayShare serves the content of a shared file by its link, /sds/<link>[/<password>] or /sds/<link>?password=<password>
+func GatewayShare(w http.ResponseWriter, req *http.Request) {
+	if !authorizeGateway(w, req) {
+		return
+	}
+	shareLink, err := fwtypes.ParseShareLink(fwtypes.SHARED_DATA_MESH_PROTOCOL + strings.TrimPrefix(req.URL.Path, GatewaySharePath))
+	if err != nil || shareLink.Link == "" {
+		gatewayError(w, http.StatusBadRequest, "invalid share link")
+		return
+	}
+	if password := req.URL.Query().Get("password"); password != "" {
+		shareLink.Password = password
+	}
+	if fileHash, ok := sharedFileHashes.get(shareLink.Link); ok && etagMatches(req.Header.Get("If-None-Match"), fileHash) {
+		w.Header().Set("ETag", fileETag(fileHash))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	serveGateway(w, req, func(ctx context.Context) (*protos.RspFileStorageInfo, error) {
+		fInfo, err := requestGatewayShare(ctx, *shareLink)
+		if err == nil {
+			sharedFileHashes.add(shareLink.Link, fInfo.FileHash)
+		}
+		return fInfo, err
+	})
+}
+
+// authorizeGateway checks the token of a request, and answers 401 when it isn't allowed to use the gateway
+func authorizeGateway(w http.ResponseWriter, req *http.Request) bool {
+	gatewayTokensOnce.Do(func() {
+		gatewayTokens = namespace.NewRpcTokenStore(namespace.DefaultRpcTokenPath())
+	})
+	if err := gatewayTokens.Authorize(req, GatewayScope); err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		gatewayError(w, http.StatusUnauthorized, err.Error())
+		return false
+	}
+	return true
+}
+
+// serveGateway answers a GET or HEAD request with the requested range of a file. open requests the storage info used
+// to fetch the slices, each slice being fetched at most once per storage info and only for the bytes in the range
+func serveGateway(w http.ResponseWriter, req *http.Request, open func(ctx context.Context) (*protos.RspFileStorageInfo, error)) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		gatewayError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	ctx := req.Context()
+
+	fInfo, err := open(ctx)
+	if err != nil {
+		utils.ErrorLog("gateway failed to get file storage info", err)
+		gatewayError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer closeGatewaySession(ctx, fInfo)
+
+	reader, err := newGatewayReader(ctx, fInfo)
+	if err != nil {
+		gatewayError(w, http.StatusNotImplemented, err.Error())
+		return
+	}
+
+	etag := fileETag(fInfo.FileHash)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Access-Control-Expose-Headers", "Accept-Ranges, Content-Length, Content-Range, ETag")
+	if etagMatches(req.Header.Get("If-None-Match"), fInfo.FileHash) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rangeHeader := req.Header.Get("Range")
+	// A range is only valid for the version of the file given in If-Range
+	if ifRange := req.Header.Get("If-Range"); ifRange != "" && ifRange != etag {
+		rangeHeader = ""
+	}
+	start, end, partial, err := parseByteRange(rangeHeader, fInfo.FileSize)
+	if err != nil {
+		w.Header().Set("Content-Range", "bytes */"+strconv.FormatUint(fInfo.FileSize, 10))
+		gatewayError(w, http.StatusRequestedRangeNotSatisfiable, err.Error())
+		return
+	}
+
+	contentType, err := reader.contentType(fInfo.FileName, start, end, req.Method == http.MethodHead)
+	if err != nil {
+		utils.ErrorLog("gateway failed to detect content type of file", fInfo.FileHash, err)
+		gatewayError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatUint(end-start, 10))
+	if fInfo.FileName != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": fInfo.FileName}))
+	}
+	if partial {
+		w.Header().Set("Content-Range", "bytes "+strconv.FormatUint(start, 10)+"-"+strconv.FormatUint(end-1, 10)+"/"+strconv.FormatUint(fInfo.FileSize, 10))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	// The headers are sent, a failure can only be reported by closing the connection before Content-Length bytes
+	if err = reader.copy(w, start, end); err != nil {
+		utils.ErrorLog("gateway failed to send file", fInfo.FileHash, err)
+	}
+}
+
+func requestGatewayFile(ctx context.Context, fileHandle fwtypes.DataMeshId) (*protos.RspFileStorageInfo, error) {
+	sn, _, err := handleGetOzone(ctx, setting.WalletAddress)
+	if err != nil {
+		return nil, err
+	}
+	reqTime := time.Now().Unix()
+	sig, err := gatewaySignature(signer.MSG_DOWNLOAD, msgutils.GetFileDownloadWalletSignMessage(fileHandle.Hash, setting.WalletAddress, sn, reqTime))
+	if err != nil {
+		return nil, err
+	}
+	res := namespace.RequestRangeDownload(ctx, reqDownloadMsg(fileHandle.String(), sig, reqTime))
+	if res.Return != rpc_api.DOWNLOAD_OK {
+		return nil, errors.New("failed requesting storage info of file " + fileHandle.Hash + ", return " + res.Return)
+	}
+	return loadGatewaySession(fileHandle.Hash, res.ReqId)
+}
+
+func requestGatewayShare(ctx context.Context, shareLink fwtypes.ShareDataMeshId) (*protos.RspFileStorageInfo, error) {
+	sn, _, err := handleGetOzone(ctx, setting.WalletAddress)
+	if err != nil {
+		return nil, err
+	}
+	reqTime := time.Now().Unix()
+	sig, err := gatewaySignature(signer.MSG_DOWNLOAD, msgutils.GetDownloadShareFileWalletSignMessage(shareLink.Link, setting.WalletAddress, sn, reqTime))
+	if err != nil {
+		return nil, err
+	}
+	res := namespace.RequestRangeShared(ctx, reqGetSharedMsg(shareLink, sig, reqTime))
+	if res.Return != rpc_api.DOWNLOAD_OK {
+		return nil, errors.New("failed requesting storage info of share link " + shareLink.Link + ", return " + res.Return)
+	}
+	return loadGatewaySession(res.FileHash, res.ReqId)
+}
+
+func loadGatewaySession(fileHash, reqId string) (*protos.RspFileStorageInfo, error) {
+	f, ok := task.DownloadFileMap.Load(fileHash + reqId)
+	if !ok {
+		return nil, errors.New("missing storage info of file " + fileHash)
+	}
+	return f.(*protos.RspFileStorageInfo), nil
+}
+
+func closeGatewaySession(ctx context.Context, fInfo *protos.RspFileStorageInfo) {
+	task.CleanDownloadFileAndConnMap(ctx, fInfo.FileHash, fInfo.ReqId)
+	task.DeleteDownloadTask(fInfo.FileHash, fInfo.WalletAddress, fInfo.ReqId)
+	file.CleanFileHash(fInfo.FileHash + fInfo.ReqId)
+}
+
+func gatewaySignature(msgType, msg string) (*rpc_api.Signature, error) {
+	sign, err := setting.WalletSigner.Sign(msgType, []byte(msg))
+	if err != nil {
+		return nil, errors.Wrap(err, "wallet failed to sign message")
+	}
+	pubkey, err := fwtypes.WalletPubKeyToBech32(setting.WalletPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc_api.Signature{Address: setting.WalletAddress, Pubkey: pubkey, Signature: hex.EncodeToString(sign)}, nil
+}
+
+// gatewayReader reads a file from the storage PPs holding its slices
+type gatewayReader struct {
+	ctx       context.Context
+	fInfo     *protos.RspFileStorageInfo
+	slices    []*protos.DownloadSliceInfo // sorted by slice number
+	sliceSize uint64
+
+	// the beginning of the file fetched to sniff the content type, as the first slice can't be requested twice
+	head []byte
+}
+
+// newGatewayReader checks that the slices of a file cut it in equal parts, as GetSliceOffset computes them
+func newGatewayReader(ctx context.Context, fInfo *protos.RspFileStorageInfo) (*gatewayReader, error) {
+	if fInfo.EncryptionTag != "" || fInfo.ErasureDataShards != 0 || crypto.IsVideoStream(fInfo.FileHash) {
+		return nil, errGatewayUnsupported
+	}
+	slices := make([]*protos.DownloadSliceInfo, len(fInfo.SliceInfo))
+	copy(slices, fInfo.SliceInfo)
+	sort.Slice(slices, func(i, j int) bool { return slices[i].SliceNumber < slices[j].SliceNumber })
+
+	reader := &gatewayReader{ctx: ctx, fInfo: fInfo, slices: slices}
+	if len(slices) == 0 {
+		if fInfo.FileSize != 0 {
+			return nil, errors.New("missing slices of file " + fInfo.FileHash)
+		}
+		return reader, nil
+	}
+	if slices[0].SliceOffset == nil {
+		return nil, errGatewayUnsupported
+	}
+	reader.sliceSize = slices[0].SliceOffset.SliceOffsetEnd - slices[0].SliceOffset.SliceOffsetStart
+	sliceCount := uint64(len(slices))
+	for i, slice := range slices {
+		expected := requests.GetSliceOffset(uint64(i+1), sliceCount, reader.sliceSize, fInfo.FileSize)
+		if slice.SliceNumber != uint64(i+1) || slice.SliceOffset == nil || slice.SliceStorageInfo == nil || slice.StoragePpInfo == nil ||
+			slice.SliceOffset.SliceOffsetStart != expected.SliceOffsetStart || slice.SliceOffset.SliceOffsetEnd != expected.SliceOffsetEnd {
+			return nil, errGatewayUnsupported
+		}
+	}
+	return reader, nil
+}
+
+// sliceAt returns the slice containing offset
+func (r *gatewayReader) sliceAt(offset uint64) *protos.DownloadSliceInfo {
+	index := uint64(len(r.slices) - 1)
+	if r.sliceSize > 0 && offset/r.sliceSize < index {
+		index = offset / r.sliceSize
+	}
+	return r.slices[index]
+}
+
+// fetch downloads the bytes [start, end) of the file, which are all in slice
+func (r *gatewayReader) fetch(slice *protos.DownloadSliceInfo, start, end uint64) ([]byte, error) {
+	if end <= uint64(len(r.head)) {
+		return r.head[start:end], nil
+	}
+	data, err := namespace.DownloadSliceRange(r.ctx, r.fInfo.FileHash, r.fInfo.ReqId, slice, start, end)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed downloading slice %v of file %v", slice.SliceNumber, r.fInfo.FileHash)
+	}
+	return data, nil
+}
+
+// copy writes the bytes of the file in [start, end) to w, slice by slice
+func (r *gatewayReader) copy(w http.ResponseWriter, start, end uint64) error {
+	flusher, _ := w.(http.Flusher)
+	for pos := start; pos < end; {
+		slice := r.sliceAt(pos)
+		chunkEnd := end
+		if slice.SliceOffset.SliceOffsetEnd < chunkEnd {
+			chunkEnd = slice.SliceOffset.SliceOffsetEnd
+		}
+		data, err := r.fetch(slice, pos, chunkEnd)
+		if err != nil {
+			return err
+		}
+		if _, err = bandwidth.WriteShaped(w, bandwidth.CLASS_DOWNLOAD, data); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		pos = chunkEnd
+	}
+	return nil
+}
+
+// contentType returns the content type given by the file extension, or detected from the first bytes of the file, so
+// that every range of a file gets the same one. When a GET response starts in the first slice, the bytes sniffed are
+// fetched along with the beginning of the response
+func (r *gatewayReader) contentType(fileName string, start, end uint64, head bool) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(fileName)); contentType != "" {
+		return contentType, nil
+	}
+	if contentType, ok := sniffedContentTypes.get(r.fInfo.FileHash); ok {
+		return contentType, nil
+	}
+	if len(r.slices) == 0 {
+		return "application/octet-stream", nil
+	}
+	first := r.slices[0]
+	fetchEnd := uint64(sniffLen)
+	if !head && start < first.SliceOffset.SliceOffsetEnd && end > fetchEnd {
+		fetchEnd = end
+	}
+	if fetchEnd > first.SliceOffset.SliceOffsetEnd {
+		fetchEnd = first.SliceOffset.SliceOffsetEnd
+	}
+	data, err := r.fetch(first, 0, fetchEnd)
+	if err != nil {
+		return "", err
+	}
+	r.head = data
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	contentType := http.DetectContentType(data)
+	sniffedContentTypes.add(r.fInfo.FileHash, contentType)
+	return contentType, nil
+}
+
+// parseByteRange parses a Range header with a single byte range, and returns the range [start, end) to send. Malformed
+// headers and headers with several ranges are ignored, the whole file is sent
+func parseByteRange(header string, size uint64) (start, end uint64, partial bool, err error) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, size, false, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+	if first == "" {
+		// suffix range: the last bytes of the file
+		suffix, parseErr := strconv.ParseUint(last, 10, 64)
+		if parseErr != nil {
+			return 0, size, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, errors.New("unsatisfiable range " + header)
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size, true, nil
+	}
+	start, parseErr := strconv.ParseUint(first, 10, 64)
+	if parseErr != nil {
+		return 0, size, false, nil
+	}
+	end = size
+	if last != "" {
+		lastByte, parseErr := strconv.ParseUint(last, 10, 64)
+		if parseErr != nil || lastByte < start {
+			return 0, size, false, nil
+		}
+		if lastByte+1 < end {
+			end = lastByte + 1
+		}
+	}
+	if start >= size {
+		return 0, 0, false, errors.New("unsatisfiable range " + header)
+	}
+	return start, end, true, nil
+}
+
+func fileETag(fileHash string) string {
+	return `"` + fileHash + `"`
+}
+
+// etagMatches checks if an If-None-Match header contains the etag of a file
+func etagMatches(header, fileHash string) bool {
+	if header == "" {
+		return false
+	}
+	etag := fileETag(fileHash)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func gatewayError(w http.ResponseWriter, code int, msg string) {
+	w.WriteHeader(code)
+	_, _ = w.Write(httpserv.NewErrorJson(code, msg).ToBytes())
+}
+
+// gatewayCache is a map of strings keeping its most recently used entries
+type gatewayCache struct {
+	mtx        sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // least recently used at the front
+}
+
+type gatewayCacheEntry struct {
+	key, value string
+}
+
+func newGatewayCache(maxEntries int) *gatewayCache {
+	return &gatewayCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (c *gatewayCache) get(key string) (string, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.lru.MoveToBack(element)
+	return element.Value.(*gatewayCacheEntry).value, true
+}
+
+func (c *gatewayCache) add(key, value string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*gatewayCacheEntry).value = value
+		c.lru.MoveToBack(element)
+		return
+	}
+	c.entries[key] = c.lru.PushBack(&gatewayCacheEntry{key: key, value: value})
+	for c.lru.Len() > c.maxEntries {
+		entry := c.lru.Remove(c.lru.Front()).(*gatewayCacheEntry)
+		delete(c.entries, entry.key)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stratosnet/sds/pp/namespace"
+)
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end uint64
+		partial    bool
+		wantErr    bool
+	}{
+		{header: "", start: 0, end: 1000},
+		{header: "bytes=0-", start: 0, end: 1000, partial: true},
+		{header: "bytes=100-199", start: 100, end: 200, partial: true},
+		{header: "bytes=900-5000", start: 900, end: 1000, partial: true},
+		{header: "bytes=-100", start: 900, end: 1000, partial: true},
+		{header: "bytes=-5000", start: 0, end: 1000, partial: true},
+		{header: "bytes=0-9,20-29", start: 0, end: 1000},
+		{header: "bytes=abc", start: 0, end: 1000},
+		{header: "items=0-9", start: 0, end: 1000},
+		{header: "bytes=200-100", start: 0, end: 1000},
+		{header: "bytes=1000-", wantErr: true},
+		{header: "bytes=-0", wantErr: true},
+	}
+	for _, tt := range tests {
+		start, end, partial, err := parseByteRange(tt.header, 1000)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%q: unexpected error %v", tt.header, err)
+		}
+		if err == nil && (start != tt.start || end != tt.end || partial != tt.partial) {
+			t.Fatalf("%q: expected [%v, %v) partial=%v, got [%v, %v) partial=%v", tt.header, tt.start, tt.end, tt.partial, start, end, partial)
+		}
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	fileHash := "v05ahm52iirbq55177uii2bmbsmmcemnjtm740s8"
+	for header, expected := range map[string]bool{
+		"":                              false,
+		"*":                             true,
+		`"` + fileHash + `"`:            true,
+		`"other", W/"` + fileHash + `"`: true,
+		`"other"`:                       false,
+		fileHash:                        false,
+	} {
+		if etagMatches(header, fileHash) != expected {
+			t.Fatalf("%q: expected %v", header, expected)
+		}
+	}
+}
+
+func TestAuthorizeGateway(t *testing.T) {
+	store := namespace.NewRpcTokenStore(filepath.Join(t.TempDir(), "rpc_tokens.json"))
+	gatewayToken, _, err := store.Mint("cdn", []string{GatewayScope}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userToken, _, err := store.Mint("user", []string{"user"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gatewayTokensOnce.Do(func() {})
+	gatewayTokens = store
+
+	for _, test := range []struct {
+		header, query string
+		allowed       bool
+	}{
+		{"", "", false},
+		{"Bearer " + userToken, "", false},
+		{"Bearer sds_invalid", "", false},
+		{"Bearer " + gatewayToken, "", true},
+		{"", gatewayToken, true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, GatewayFilePath+"owner/hash?token="+test.query, nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		w := httptest.NewRecorder()
+		if authorizeGateway(w, req) != test.allowed {
+			t.Fatalf("request with header [%v] and query [%v] should be allowed: %v", test.header, test.query, test.allowed)
+		}
+		if !test.allowed && w.Code != http.StatusUnauthorized {
+			t.Fatalf("a refused request should get 401, got %v", w.Code)
+		}
+	}
+}
+
+func TestGatewayCache(t *testing.T) {
+	cache := newGatewayCache(2)
+	cache.add("a", "text/plain")
+	cache.add("b", "image/png")
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	cache.add("c", "video/mp4")
+	if _, ok := cache.get("b"); ok {
+		t.Fatal("b is the least recently used entry, it should be evicted")
+	}
+	if value, ok := cache.get("a"); !ok || value != "text/plain" {
+		t.Fatalf("a should still be cached, got %v", value)
+	}
+	if value, ok := cache.get("c"); !ok || value != "video/mp4" {
+		t.Fatalf("c should be cached, got %v", value)
+	}
+}
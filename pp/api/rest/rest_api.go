@@ -16,6 +16,8 @@ func StartHTTPServ(ctx context.Context) {
 	httpServ.MyRoute("/prepareSharedVideoFileCache/", corsHandler(api.PrepareSharedVideoFileCache))
 	httpServ.MyRoute("/getVideoSliceCache/", corsHandler(api.GetVideoSliceCache))
 	httpServ.MyRoute("/findVideoSlice/", corsHandler(api.GetVideoSlice))
+	httpServ.MyStreamRoute(api.GatewayFilePath, corsHandler(api.GatewayFile))
+	httpServ.MyStreamRoute(api.GatewaySharePath, corsHandler(api.GatewayShare))
 	httpServ.MyStart(ctx)
 }
 
@@ -1,6 +1,9 @@
 package rpc
 
 import (
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/tx"
+	"github.com/stratosnet/sds/pp/webhook"
 	"github.com/stratosnet/sds/sds-msg/protos"
 )
 
@@ -18,11 +21,13 @@ const (
 	WRONG_WALLET_ADDRESS          string = "-12"
 	CONFLICT_WITH_ANOTHER_SESSION string = "-13"
 	SESSION_STOPPED               string = "-14"
+	TX_FAILED                     string = "-15"
 
 	UPLOAD_DATA     string = "1"
 	DOWNLOAD_OK     string = "2"
 	DL_OK_ASK_INFO  string = "3"
 	SHARED_DL_START string = "4"
+	TX_PENDING      string = "5"
 	SUCCESS         string = "0"
 )
 
@@ -36,6 +41,7 @@ type ParamReqUploadFile struct {
 	AllowHigherTier bool      `json:"allow_higher_tier"`
 	ReqTime         int64     `json:"req_time"`
 	SequenceNumber  string    `json:"sequencenumber"`
+	Resume          bool      `json:"resume,omitempty"` // pick up the unfinished upload of this file instead of uploading it again
 }
 
 // upload: upload file data
@@ -247,7 +253,8 @@ type ParamReqPrepay struct {
 }
 
 type PrepayResult struct {
-	Return string `json:"return"`
+	Return string        `json:"return"`
+	Tx     *tx.TrackedTx `json:"tx,omitempty"`
 }
 
 // startmining: request to startmining
@@ -281,7 +288,8 @@ type ParamReqWithdraw struct {
 }
 
 type WithdrawResult struct {
-	Return string `json:"return"`
+	Return string        `json:"return"`
+	Tx     *tx.TrackedTx `json:"tx,omitempty"`
 }
 
 type ParamReqSend struct {
@@ -292,7 +300,8 @@ type ParamReqSend struct {
 }
 
 type SendResult struct {
-	Return string `json:"return"`
+	Return string        `json:"return"`
+	Tx     *tx.TrackedTx `json:"tx,omitempty"`
 }
 
 type ParamReqSync struct {
@@ -329,6 +338,85 @@ type ServiceStatusResult struct {
 	Message string `json:"message"`
 }
 
+type ParamReqStateHistory struct {
+	Limit uint64 `json:"limit"`
+}
+
+type StateTransition struct {
+	Time  int64  `json:"time"`
+	Event string `json:"event"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Cause string `json:"cause"`
+}
+
+type StateHistoryResult struct {
+	Return      string            `json:"return"`
+	State       string            `json:"state"`
+	Transitions []StateTransition `json:"transitions"`
+}
+
+type ParamReqScrub struct {
+	Action string `json:"action"` // "start", "stop" or "status"
+}
+
+type ScrubStatus struct {
+	Running         bool     `json:"running"`
+	StartTime       int64    `json:"start_time"`
+	EndTime         int64    `json:"end_time"`
+	Scanned         uint64   `json:"scanned"`
+	Verified        uint64   `json:"verified"`
+	Corrupted       uint64   `json:"corrupted"`
+	Skipped         uint64   `json:"skipped"`
+	OriginRequested uint64   `json:"origin_requested"`
+	BytesRead       uint64   `json:"bytes_read"`
+	CorruptedSlices []string `json:"corrupted_slices"`
+	Error           string   `json:"error"`
+}
+
+type ScrubResult struct {
+	Return  string      `json:"return"`
+	Message string      `json:"message,omitempty"`
+	Status  ScrubStatus `json:"status"`
+}
+
+type ParamReqBandwidth struct {
+	Config  *setting.BandwidthConfig `json:"config,omitempty"` // the limits are unchanged when nil
+	Persist bool                     `json:"persist"`          // save the new limits to the configuration file
+}
+
+type BandwidthResult struct {
+	Return         string                  `json:"return"`
+	Message        string                  `json:"message,omitempty"`
+	Config         setting.BandwidthConfig `json:"config"`
+	ActiveSchedule string                  `json:"active_schedule"`
+}
+
+type ParamReqWebhook struct {
+	Action string   `json:"action"`           // "add", "remove", "test" or "list"
+	Id     string   `json:"id,omitempty"`     // webhook removed or tested
+	Url    string   `json:"url,omitempty"`    // http(s) url, or Unix socket (eg: "unix:///run/myapp.sock") of the webhook added
+	Events []string `json:"events,omitempty"` // events notified to the webhook added, all of them when empty
+	Secret string   `json:"secret,omitempty"` // key signing the notifications, generated when empty
+}
+
+type WebhookResult struct {
+	Return   string            `json:"return"`
+	Message  string            `json:"message,omitempty"`
+	Webhook  *webhook.Webhook  `json:"webhook,omitempty"` // the webhook added, with its secret
+	Webhooks []webhook.Webhook `json:"webhooks"`
+}
+
+type ParamReqWebhookDeliveries struct {
+	WebhookId string `json:"webhook_id"` // all the webhooks when empty
+	Limit     uint64 `json:"limit"`
+}
+
+type WebhookDeliveriesResult struct {
+	Return     string             `json:"return"`
+	Deliveries []webhook.Delivery `json:"deliveries"`
+}
+
 type ParamReqUpdatePPInfo struct {
 	Moniker         string `json:"moniker"`
 	Identity        string `json:"identity"`
@@ -340,6 +428,28 @@ type ParamReqUpdatePPInfo struct {
 }
 
 type UpdatePPInfoResult struct {
-	Return  string `json:"return"`
-	Message string `json:"message"`
+	Return  string        `json:"return"`
+	Message string        `json:"message"`
+	Tx      *tx.TrackedTx `json:"tx,omitempty"`
+}
+
+// TxReturn is the return of a request whose tx was broadcast
+func TxReturn(trackedTx tx.TrackedTx) string {
+	switch trackedTx.Status {
+	case tx.TX_INCLUDED:
+		return SUCCESS
+	case tx.TX_PENDING:
+		return TX_PENDING
+	default:
+		return TX_FAILED
+	}
+}
+
+type ParamReqTxStatus struct {
+	TxHash string `json:"tx_hash"` // all the recent txs when empty
+}
+
+type TxStatusResult struct {
+	Return string         `json:"return"`
+	Txs    []tx.TrackedTx `json:"txs"`
 }
@@ -0,0 +1,291 @@
+package s3
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const bucketFileExt = ".json"
+
+var (
+	bucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+	errNoSuchBucket      = errors.New("the specified bucket does not exist")
+	errBucketExists      = errors.New("the requested bucket name is not available")
+	errBucketNotEmpty    = errors.New("the bucket you tried to delete is not empty")
+	errNoSuchKey         = errors.New("the specified key does not exist")
+	errInvalidBucketName = errors.New("the specified bucket is not valid")
+)
+
+// objectInfo maps an object key to the SDS file holding its content
+type objectInfo struct {
+	Key          string `json:"key"`
+	FileHash     string `json:"file_hash"`
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag"`
+	ContentType  string `json:"content_type,omitempty"`
+	LastModified int64  `json:"last_modified"` // unix milliseconds
+}
+
+// bucket is a namespace of object keys inside the files of a wallet
+type bucket struct {
+	Name      string                 `json:"name"`
+	CreatedAt int64                  `json:"created_at"` // unix milliseconds
+	Objects   map[string]*objectInfo `json:"objects"`
+}
+
+// bucketIndex persists the buckets of each wallet. SDS has no notion of keys or folders, so the index is the only
+// place where the object keys are stored. The content itself is stored in SDS, one file per distinct content
+type bucketIndex struct {
+	dir     string
+	mtx     sync.Mutex
+	wallets map[string]map[string]*bucket
+}
+
+func newBucketIndex(dir string) *bucketIndex {
+	return &bucketIndex{
+		dir:     dir,
+		wallets: make(map[string]map[string]*bucket),
+	}
+}
+
+func (b *bucketIndex) createBucket(wallet, name string) error {
+	if !bucketNameRegex.MatchString(name) {
+		return errInvalidBucketName
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	buckets, err := b.load(wallet)
+	if err != nil {
+		return err
+	}
+	if _, ok := buckets[name]; ok {
+		return errBucketExists
+	}
+	bkt := &bucket{Name: name, CreatedAt: time.Now().UnixMilli(), Objects: make(map[string]*objectInfo)}
+	if err = b.save(wallet, bkt); err != nil {
+		return err
+	}
+	buckets[name] = bkt
+	return nil
+}
+
+func (b *bucketIndex) deleteBucket(wallet, name string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	buckets, err := b.load(wallet)
+	if err != nil {
+		return err
+	}
+	bkt, ok := buckets[name]
+	if !ok {
+		return errNoSuchBucket
+	}
+	if len(bkt.Objects) > 0 {
+		return errBucketNotEmpty
+	}
+	if err = os.Remove(filepath.Join(b.dir, wallet, name+bucketFileExt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(buckets, name)
+	return nil
+}
+
+// listBuckets returns the buckets of a wallet sorted by name
+func (b *bucketIndex) listBuckets(wallet string) ([]bucket, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	buckets, err := b.load(wallet)
+	if err != nil {
+		return nil, err
+	}
+	var list []bucket
+	for _, bkt := range buckets {
+		list = append(list, bucket{Name: bkt.Name, CreatedAt: bkt.CreatedAt})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+func (b *bucketIndex) bucketExists(wallet, name string) (bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	buckets, err := b.load(wallet)
+	if err != nil {
+		return false, err
+	}
+	_, ok := buckets[name]
+	return ok, nil
+}
+
+func (b *bucketIndex) getObject(wallet, bucketName, key string) (objectInfo, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	bkt, err := b.bucket(wallet, bucketName)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	object, ok := bkt.Objects[key]
+	if !ok {
+		return objectInfo{}, errNoSuchKey
+	}
+	return *object, nil
+}
+
+// putObject stores the object in the bucket, and returns the object it replaced, if any
+func (b *bucketIndex) putObject(wallet, bucketName string, object objectInfo) (*objectInfo, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	bkt, err := b.bucket(wallet, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	previous := bkt.Objects[object.Key]
+	bkt.Objects[object.Key] = &object
+	if err = b.save(wallet, bkt); err != nil {
+		if previous != nil {
+			bkt.Objects[object.Key] = previous
+		} else {
+			delete(bkt.Objects, object.Key)
+		}
+		return nil, err
+	}
+	return previous, nil
+}
+
+// deleteObject removes a key from the bucket. Deleting a key that doesn't exist is not an error, as in S3
+func (b *bucketIndex) deleteObject(wallet, bucketName, key string) (*objectInfo, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	bkt, err := b.bucket(wallet, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := bkt.Objects[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(bkt.Objects, key)
+	if err = b.save(wallet, bkt); err != nil {
+		bkt.Objects[key] = object
+		return nil, err
+	}
+	return object, nil
+}
+
+// listObjects returns the objects of a bucket whose key starts with prefix, sorted by key
+func (b *bucketIndex) listObjects(wallet, bucketName, prefix string) ([]objectInfo, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	bkt, err := b.bucket(wallet, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	var objects []objectInfo
+	for key, object := range bkt.Objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, *object)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// isFileReferenced checks if any key of any bucket of the wallet still points to the SDS file
+func (b *bucketIndex) isFileReferenced(wallet, fileHash string) (bool, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	buckets, err := b.load(wallet)
+	if err != nil {
+		return false, err
+	}
+	for _, bkt := range buckets {
+		for _, object := range bkt.Objects {
+			if object.FileHash == fileHash {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (b *bucketIndex) bucket(wallet, name string) (*bucket, error) {
+	buckets, err := b.load(wallet)
+	if err != nil {
+		return nil, err
+	}
+	bkt, ok := buckets[name]
+	if !ok {
+		return nil, errNoSuchBucket
+	}
+	return bkt, nil
+}
+
+func (b *bucketIndex) load(wallet string) (map[string]*bucket, error) {
+	if buckets, ok := b.wallets[wallet]; ok {
+		return buckets, nil
+	}
+
+	buckets := make(map[string]*bucket)
+	files, err := os.ReadDir(filepath.Join(b.dir, wallet))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), bucketFileExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(b.dir, wallet, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		bkt := &bucket{}
+		if err = json.Unmarshal(data, bkt); err != nil {
+			return nil, errors.Wrapf(err, "invalid bucket file [%v]", file.Name())
+		}
+		if bkt.Objects == nil {
+			bkt.Objects = make(map[string]*objectInfo)
+		}
+		buckets[bkt.Name] = bkt
+	}
+	b.wallets[wallet] = buckets
+	return buckets, nil
+}
+
+func (b *bucketIndex) save(wallet string, bkt *bucket) error {
+	data, err := json.Marshal(bkt)
+	if err != nil {
+		return err
+	}
+	walletDir := filepath.Join(b.dir, wallet)
+	if err = os.MkdirAll(walletDir, 0700); err != nil {
+		return err
+	}
+	path := filepath.Join(walletDir, bkt.Name+bucketFileExt)
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
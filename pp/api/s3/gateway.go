@@ -0,0 +1,291 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+
+	"github.com/stratosnet/sds/pp/api/sdsclient"
+	"github.com/stratosnet/sds/pp/namespace"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+const (
+	gatewayFolder   = "s3gateway"
+	bucketsFolder   = "buckets"
+	cacheFolder     = "cache"
+	spoolFolder     = "spool"
+	multipartFolder = "multipart"
+
+	xmlNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+)
+
+// Gateway is an S3-compatible HTTP server in front of the user rpc api. Buckets are namespaces of keys inside the
+// files of a wallet, and the SigV4 access keys are mapped to the wallet signing the requests
+type Gateway struct {
+	ctx        context.Context
+	dir        string
+	region     string
+	accessKeys map[string]setting.S3AccessKey
+	index      *bucketIndex
+	client     *sdsclient.Client
+	fileLocks  sync.Map // map[fileHash]*sync.Mutex
+}
+
+// StartS3Gateway starts the S3-compatible gateway when a port is configured for it
+func StartS3Gateway(ctx context.Context) {
+	gateway, err := NewGateway(ctx, filepath.Join(setting.GetRootPath(), gatewayFolder), setting.Config.S3Gateway)
+	if err != nil {
+		utils.ErrorLog("couldn't start the S3 gateway", err)
+		return
+	}
+	server := &http.Server{
+		Addr:              ":" + setting.Config.S3Gateway.Port,
+		Handler:           gateway,
+		ReadHeaderTimeout: 30 * time.Second,
+		BaseContext: func(listener net.Listener) context.Context {
+			return ctx
+		},
+	}
+	go gateway.cleanCache()
+	utils.Log("Start S3 gateway on port", setting.Config.S3Gateway.Port)
+	if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		utils.ErrorLog("S3 gateway stopped", err)
+	}
+}
+
+func NewGateway(ctx context.Context, dir string, config setting.S3GatewayConfig) (*Gateway, error) {
+	if config.Region == "" {
+		return nil, errors.New("missing region for the S3 gateway")
+	}
+	accessKeys := make(map[string]setting.S3AccessKey)
+	for _, key := range config.AccessKeys {
+		if key.AccessKey == "" || key.SecretKey == "" || key.WalletAddress == "" {
+			return nil, errors.New("S3 gateway access keys need an access key, a secret key and a wallet address")
+		}
+		if key.WalletAddress != setting.WalletAddress {
+			utils.ErrorLogf("S3 gateway access key %v uses wallet %v, which can't be signed for by this node", key.AccessKey, key.WalletAddress)
+		}
+		accessKeys[key.AccessKey] = key
+	}
+	if len(accessKeys) == 0 {
+		return nil, errors.New("no access key configured for the S3 gateway")
+	}
+	for _, folder := range []string{bucketsFolder, cacheFolder, spoolFolder, multipartFolder} {
+		if err := os.MkdirAll(filepath.Join(dir, folder), 0700); err != nil {
+			return nil, errors.Wrap(err, "couldn't create S3 gateway folder")
+		}
+	}
+
+	return &Gateway{
+		ctx:        ctx,
+		dir:        dir,
+		region:     config.Region,
+		accessKeys: accessKeys,
+		index:      newBucketIndex(filepath.Join(dir, bucketsFolder)),
+		client:     sdsclient.NewClient(namespace.RpcPubApi()),
+	}, nil
+}
+
+// s3Request is an authenticated request, with the bucket and key parsed from its path
+type s3Request struct {
+	*http.Request
+	auth   *sigV4Auth
+	key    setting.S3AccessKey
+	signer *sdsclient.WalletSigner
+	bucket string
+	object string
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := g.authenticate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Only path-style requests are supported: /bucket/key
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	req.bucket, req.object, _ = strings.Cut(path, "/")
+	query := r.URL.Query()
+
+	switch {
+	case req.bucket == "":
+		if r.Method != http.MethodGet {
+			writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		g.listBuckets(w, req)
+	case req.object == "":
+		switch {
+		case r.Method == http.MethodPut:
+			g.createBucket(w, req)
+		case r.Method == http.MethodDelete:
+			g.deleteBucket(w, req)
+		case r.Method == http.MethodHead:
+			g.headBucket(w, req)
+		case r.Method == http.MethodGet:
+			g.listObjects(w, req)
+		case r.Method == http.MethodPost && query.Has("delete"):
+			g.deleteObjects(w, req)
+		default:
+			writeError(w, r, errMethodNotAllowed)
+		}
+	default:
+		switch {
+		case r.Method == http.MethodPut && query.Has("uploadId"):
+			g.uploadPart(w, req)
+		case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+			writeError(w, r, errNotImplemented)
+		case r.Method == http.MethodPut:
+			g.putObject(w, req)
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			g.getObject(w, req)
+		case r.Method == http.MethodDelete && query.Has("uploadId"):
+			g.abortMultipartUpload(w, req)
+		case r.Method == http.MethodDelete:
+			g.deleteObject(w, req)
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			g.createMultipartUpload(w, req)
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			g.completeMultipartUpload(w, req)
+		default:
+			writeError(w, r, errMethodNotAllowed)
+		}
+	}
+}
+
+func (g *Gateway) authenticate(r *http.Request) (*s3Request, error) {
+	auth, err := parseSigV4(r)
+	if err != nil {
+		return nil, &apiError{code: "AccessDenied", status: http.StatusForbidden, message: err.Error()}
+	}
+	key, ok := g.accessKeys[auth.accessKey]
+	if !ok {
+		return nil, errInvalidAccessKeyId
+	}
+	if err = auth.verify(r, key.SecretKey, g.region, time.Now()); err != nil {
+		if err == errSignatureMismatch {
+			return nil, errSignatureDoesNotMatch
+		}
+		return nil, &apiError{code: "AccessDenied", status: http.StatusForbidden, message: err.Error()}
+	}
+	signer, err := sdsclient.NodeWalletSigner(key.WalletAddress)
+	if err != nil {
+		return nil, &apiError{code: "AccessDenied", status: http.StatusForbidden, message: err.Error()}
+	}
+	return &s3Request{Request: r, auth: auth, key: key, signer: signer}, nil
+}
+
+// lockFile serializes the operations on the cached content of a file
+func (g *Gateway) lockFile(fileHash string) func() {
+	value, _ := g.fileLocks.LoadOrStore(fileHash, &sync.Mutex{})
+	mtx := value.(*sync.Mutex)
+	mtx.Lock()
+	return mtx.Unlock
+}
+
+func (g *Gateway) cachePath(fileHash string) string {
+	return filepath.Join(g.dir, cacheFolder, fileHash)
+}
+
+func (g *Gateway) spoolPath() string {
+	return filepath.Join(g.dir, spoolFolder, uuid.NewString())
+}
+
+// apiError is an error returned to the S3 client
+type apiError struct {
+	code    string
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+var (
+	errMethodNotAllowed      = &apiError{"MethodNotAllowed", http.StatusMethodNotAllowed, "the specified method is not allowed against this resource"}
+	errNotImplemented        = &apiError{"NotImplemented", http.StatusNotImplemented, "this operation is not supported by the SDS gateway"}
+	errInvalidAccessKeyId    = &apiError{"InvalidAccessKeyId", http.StatusForbidden, "the access key id you provided does not exist in our records"}
+	errSignatureDoesNotMatch = &apiError{"SignatureDoesNotMatch", http.StatusForbidden, "the request signature we calculated does not match the signature you provided"}
+	errContentSha256Mismatch = &apiError{"XAmzContentSHA256Mismatch", http.StatusBadRequest, "the provided 'x-amz-content-sha256' header does not match what was computed"}
+	errBadDigest             = &apiError{"BadDigest", http.StatusBadRequest, "the Content-MD5 you specified did not match what we received"}
+	errMalformedXML          = &apiError{"MalformedXML", http.StatusBadRequest, "the XML you provided was not well-formed"}
+	errNoSuchUpload          = &apiError{"NoSuchUpload", http.StatusNotFound, "the specified multipart upload does not exist"}
+	errInvalidPart           = &apiError{"InvalidPart", http.StatusBadRequest, "one or more of the specified parts could not be found"}
+	errInvalidPartOrder      = &apiError{"InvalidPartOrder", http.StatusBadRequest, "the list of parts was not in ascending order"}
+	errEntityTooSmall        = &apiError{"EntityTooSmall", http.StatusBadRequest, "your proposed upload is smaller than the minimum allowed object size"}
+	errInvalidArgument       = &apiError{"InvalidArgument", http.StatusBadRequest, "invalid argument"}
+)
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestId string   `xml:"RequestId"`
+}
+
+func toAPIError(err error) *apiError {
+	switch err {
+	case errNoSuchBucket:
+		return &apiError{"NoSuchBucket", http.StatusNotFound, err.Error()}
+	case errBucketExists:
+		return &apiError{"BucketAlreadyOwnedByYou", http.StatusConflict, err.Error()}
+	case errBucketNotEmpty:
+		return &apiError{"BucketNotEmpty", http.StatusConflict, err.Error()}
+	case errNoSuchKey:
+		return &apiError{"NoSuchKey", http.StatusNotFound, err.Error()}
+	case errInvalidBucketName:
+		return &apiError{"InvalidBucketName", http.StatusBadRequest, err.Error()}
+	}
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr
+	}
+	if _, ok := err.(*sdsclient.RpcError); ok {
+		return &apiError{"ServiceUnavailable", http.StatusServiceUnavailable, err.Error()}
+	}
+	return &apiError{"InternalError", http.StatusInternalServerError, err.Error()}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+	if apiErr.status >= http.StatusInternalServerError {
+		utils.ErrorLogf("S3 gateway %v %v failed: %v", r.Method, r.URL.Path, err)
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(apiErr.status)
+		return
+	}
+	writeXML(w, apiErr.status, errorResponse{
+		Code:      apiErr.code,
+		Message:   apiErr.message,
+		Resource:  r.URL.Path,
+		RequestId: uuid.NewString(),
+	})
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		utils.ErrorLog("S3 gateway couldn't marshal response", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,285 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	multipartMetaFile = "upload.json"
+	minPartSize       = 5 << 20
+	maxPartNumber     = 10000
+)
+
+// multipartUpload is an ongoing multipart upload. The parts are stored in its folder until the upload is completed,
+// then concatenated and uploaded to SDS as a single file
+type multipartUpload struct {
+	Wallet      string               `json:"wallet"`
+	Bucket      string               `json:"bucket"`
+	Key         string               `json:"key"`
+	ContentType string               `json:"content_type,omitempty"`
+	CreatedAt   int64                `json:"created_at"` // unix milliseconds
+	Parts       map[int]uploadedPart `json:"parts"`
+}
+
+type uploadedPart struct {
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadId string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+var multipartMtx sync.Mutex
+
+func (g *Gateway) multipartDir(uploadId string) string {
+	return filepath.Join(g.dir, multipartFolder, uploadId)
+}
+
+// loadMultipartUpload reads an upload, and checks that it belongs to the bucket and key of the request
+func (g *Gateway) loadMultipartUpload(req *s3Request, uploadId string) (*multipartUpload, error) {
+	if _, err := uuid.Parse(uploadId); err != nil {
+		return nil, errNoSuchUpload
+	}
+	data, err := os.ReadFile(filepath.Join(g.multipartDir(uploadId), multipartMetaFile))
+	if os.IsNotExist(err) {
+		return nil, errNoSuchUpload
+	}
+	if err != nil {
+		return nil, err
+	}
+	upload := &multipartUpload{}
+	if err = json.Unmarshal(data, upload); err != nil {
+		return nil, err
+	}
+	if upload.Wallet != req.signer.Address() || upload.Bucket != req.bucket || upload.Key != req.object {
+		return nil, errNoSuchUpload
+	}
+	return upload, nil
+}
+
+func (g *Gateway) saveMultipartUpload(uploadId string, upload *multipartUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(g.multipartDir(uploadId), multipartMetaFile)
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (g *Gateway) createMultipartUpload(w http.ResponseWriter, req *s3Request) {
+	exists, err := g.index.bucketExists(req.signer.Address(), req.bucket)
+	if err != nil || !exists {
+		writeError(w, req.Request, errNoSuchBucket)
+		return
+	}
+
+	uploadId := uuid.NewString()
+	if err = os.MkdirAll(g.multipartDir(uploadId), 0700); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	upload := &multipartUpload{
+		Wallet:      req.signer.Address(),
+		Bucket:      req.bucket,
+		Key:         req.object,
+		ContentType: req.Header.Get("Content-Type"),
+		CreatedAt:   time.Now().UnixMilli(),
+		Parts:       make(map[int]uploadedPart),
+	}
+	if err = g.saveMultipartUpload(uploadId, upload); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		Xmlns:    xmlNamespace,
+		Bucket:   req.bucket,
+		Key:      req.object,
+		UploadId: uploadId,
+	})
+}
+
+func (g *Gateway) uploadPart(w http.ResponseWriter, req *s3Request) {
+	uploadId := req.URL.Query().Get("uploadId")
+	partNumber, err := strconv.Atoi(req.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		writeError(w, req.Request, errInvalidArgument)
+		return
+	}
+	if _, err = g.loadMultipartUpload(req, uploadId); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+
+	spoolPath := g.spoolPath()
+	defer removeFile(spoolPath)
+	size, md5sum, err := g.spoolBody(req, spoolPath)
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+
+	multipartMtx.Lock()
+	defer multipartMtx.Unlock()
+	// Reload the upload, in case it was aborted or other parts were added while this part was received
+	upload, err := g.loadMultipartUpload(req, uploadId)
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	if err = os.Rename(spoolPath, filepath.Join(g.multipartDir(uploadId), strconv.Itoa(partNumber))); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	etag := hex.EncodeToString(md5sum)
+	upload.Parts[partNumber] = uploadedPart{ETag: etag, Size: size}
+	if err = g.saveMultipartUpload(uploadId, upload); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(etag))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *Gateway) completeMultipartUpload(w http.ResponseWriter, req *s3Request) {
+	uploadId := req.URL.Query().Get("uploadId")
+	var request completeMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(req.Body, 2<<20)).Decode(&request); err != nil || len(request.Parts) == 0 {
+		writeError(w, req.Request, errMalformedXML)
+		return
+	}
+
+	multipartMtx.Lock()
+	upload, err := g.loadMultipartUpload(req, uploadId)
+	if err == nil {
+		// Nothing else can happen to this upload once its completion started
+		err = os.Remove(filepath.Join(g.multipartDir(uploadId), multipartMetaFile))
+	}
+	multipartMtx.Unlock()
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	defer func() {
+		_ = os.RemoveAll(g.multipartDir(uploadId))
+	}()
+
+	spoolPath := g.spoolPath()
+	defer removeFile(spoolPath)
+	size, etag, err := g.concatParts(uploadId, upload, request)
+	if err == nil {
+		err = os.Rename(filepath.Join(g.multipartDir(uploadId), "complete"), spoolPath)
+	}
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+
+	req.Header.Set("Content-Type", upload.ContentType)
+	object, err := g.storeObject(req, spoolPath, size, etag)
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Xmlns:  xmlNamespace,
+		Bucket: req.bucket,
+		Key:    req.object,
+		ETag:   strconv.Quote(object.ETag),
+	})
+}
+
+// concatParts checks the list of parts of the completion request, and writes them to a single file.
+// The ETag of a multipart object is the md5 of the md5 of its parts, followed by the number of parts
+func (g *Gateway) concatParts(uploadId string, upload *multipartUpload, request completeMultipartUpload) (int64, string, error) {
+	out, err := os.OpenFile(filepath.Join(g.multipartDir(uploadId), "complete"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+
+	etagHash := md5.New()
+	var size int64
+	for i, part := range request.Parts {
+		if i > 0 && part.PartNumber <= request.Parts[i-1].PartNumber {
+			return 0, "", errInvalidPartOrder
+		}
+		uploaded, ok := upload.Parts[part.PartNumber]
+		if !ok || strings.Trim(part.ETag, "\"") != uploaded.ETag {
+			return 0, "", errInvalidPart
+		}
+		if i < len(request.Parts)-1 && uploaded.Size < minPartSize {
+			return 0, "", errEntityTooSmall
+		}
+		md5sum, _ := hex.DecodeString(uploaded.ETag)
+		etagHash.Write(md5sum)
+
+		in, err := os.Open(filepath.Join(g.multipartDir(uploadId), strconv.Itoa(part.PartNumber)))
+		if err != nil {
+			return 0, "", err
+		}
+		n, err := io.Copy(out, in)
+		_ = in.Close()
+		if err != nil {
+			return 0, "", err
+		}
+		size += n
+	}
+	if err = out.Close(); err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(etagHash.Sum(nil)) + "-" + strconv.Itoa(len(request.Parts)), nil
+}
+
+func (g *Gateway) abortMultipartUpload(w http.ResponseWriter, req *s3Request) {
+	uploadId := req.URL.Query().Get("uploadId")
+	multipartMtx.Lock()
+	defer multipartMtx.Unlock()
+	if _, err := g.loadMultipartUpload(req, uploadId); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	if err := os.RemoveAll(g.multipartDir(uploadId)); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
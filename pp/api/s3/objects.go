@@ -0,0 +1,532 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stratosnet/sds/framework/crypto"
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+const (
+	s3TimeFormat       = "2006-01-02T15:04:05.000Z"
+	defaultMaxKeys     = 1000
+	cacheRetention     = 24 * time.Hour
+	cacheCleanInterval = time.Hour
+	multipartRetention = 7 * 24 * time.Hour
+)
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name       `xml:"ListAllMyBucketsResult"`
+	Xmlns   string         `xml:"xmlns,attr"`
+	Owner   owner          `xml:"Owner"`
+	Buckets []bucketResult `xml:"Buckets>Bucket"`
+}
+
+type bucketResult struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Marker                string         `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []objectResult `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type objectResult struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
+
+type deletedObject struct {
+	Key string `xml:"Key"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (g *Gateway) listBuckets(w http.ResponseWriter, req *s3Request) {
+	buckets, err := g.index.listBuckets(req.signer.Address())
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	result := listAllMyBucketsResult{
+		Xmlns: xmlNamespace,
+		Owner: owner{ID: req.signer.Address(), DisplayName: req.signer.Address()},
+	}
+	for _, bkt := range buckets {
+		result.Buckets = append(result.Buckets, bucketResult{
+			Name:         bkt.Name,
+			CreationDate: time.UnixMilli(bkt.CreatedAt).UTC().Format(s3TimeFormat),
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (g *Gateway) createBucket(w http.ResponseWriter, req *s3Request) {
+	if err := g.index.createBucket(req.signer.Address(), req.bucket); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	w.Header().Set("Location", "/"+req.bucket)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *Gateway) deleteBucket(w http.ResponseWriter, req *s3Request) {
+	if err := g.index.deleteBucket(req.signer.Address(), req.bucket); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) headBucket(w http.ResponseWriter, req *s3Request) {
+	exists, err := g.index.bucketExists(req.signer.Address(), req.bucket)
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	if !exists {
+		writeError(w, req.Request, errNoSuchBucket)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// listObjects handles both ListObjectsV2 and the original ListObjects, which only differ by their pagination fields
+func (g *Gateway) listObjects(w http.ResponseWriter, req *s3Request) {
+	query := req.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	v2 := query.Get("list-type") == "2"
+	maxKeys := defaultMaxKeys
+	if value := query.Get("max-keys"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeError(w, req.Request, errInvalidArgument)
+			return
+		}
+		if parsed < maxKeys {
+			maxKeys = parsed
+		}
+	}
+
+	result := listBucketResult{
+		Xmlns:     xmlNamespace,
+		Name:      req.bucket,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   maxKeys,
+	}
+	var marker string
+	if v2 {
+		result.StartAfter = query.Get("start-after")
+		result.ContinuationToken = query.Get("continuation-token")
+		marker = result.StartAfter
+		if result.ContinuationToken != "" {
+			token, err := b64.RawURLEncoding.DecodeString(result.ContinuationToken)
+			if err != nil {
+				writeError(w, req.Request, errInvalidArgument)
+				return
+			}
+			marker = string(token)
+		}
+	} else {
+		result.Marker = query.Get("marker")
+		marker = result.Marker
+	}
+
+	objects, err := g.index.listObjects(req.signer.Address(), req.bucket, prefix)
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+
+	var last string
+	for _, object := range objects {
+		// Skip the entries returned by the previous pages. A marker ending with the delimiter is a common prefix
+		if object.Key <= marker || (delimiter != "" && strings.HasSuffix(marker, delimiter) && strings.HasPrefix(object.Key, marker)) {
+			continue
+		}
+		entry := object.Key
+		isPrefix := false
+		if delimiter != "" {
+			if i := strings.Index(object.Key[len(prefix):], delimiter); i >= 0 {
+				entry = object.Key[:len(prefix)+i+len(delimiter)]
+				isPrefix = true
+			}
+		}
+		if isPrefix && entry == last {
+			continue
+		}
+		if result.KeyCount >= maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: entry})
+		} else {
+			result.Contents = append(result.Contents, objectResult{
+				Key:          object.Key,
+				LastModified: time.UnixMilli(object.LastModified).UTC().Format(s3TimeFormat),
+				ETag:         strconv.Quote(object.ETag),
+				Size:         object.Size,
+				StorageClass: "STANDARD",
+			})
+		}
+		result.KeyCount++
+		last = entry
+	}
+	if result.IsTruncated {
+		if v2 {
+			result.NextContinuationToken = b64.RawURLEncoding.EncodeToString([]byte(last))
+		} else {
+			result.NextMarker = last
+		}
+	}
+
+	if query.Get("encoding-type") == "url" {
+		result.EncodingType = "url"
+		result.Prefix = url.QueryEscape(result.Prefix)
+		result.Delimiter = url.QueryEscape(result.Delimiter)
+		result.StartAfter = url.QueryEscape(result.StartAfter)
+		result.Marker = url.QueryEscape(result.Marker)
+		result.NextMarker = url.QueryEscape(result.NextMarker)
+		for i := range result.Contents {
+			result.Contents[i].Key = url.QueryEscape(result.Contents[i].Key)
+		}
+		for i := range result.CommonPrefixes {
+			result.CommonPrefixes[i].Prefix = url.QueryEscape(result.CommonPrefixes[i].Prefix)
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (g *Gateway) putObject(w http.ResponseWriter, req *s3Request) {
+	exists, err := g.index.bucketExists(req.signer.Address(), req.bucket)
+	if err != nil || !exists {
+		writeError(w, req.Request, errNoSuchBucket)
+		return
+	}
+
+	spoolPath := g.spoolPath()
+	defer removeFile(spoolPath)
+	size, md5sum, err := g.spoolBody(req, spoolPath)
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+
+	object, err := g.storeObject(req, spoolPath, size, hex.EncodeToString(md5sum))
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(object.ETag))
+	w.WriteHeader(http.StatusOK)
+}
+
+// spoolBody writes the request body to a file, and checks it against the payload hash and Content-MD5 of the request
+func (g *Gateway) spoolBody(req *s3Request, spoolPath string) (int64, []byte, error) {
+	var body io.Reader = req.Body
+	switch {
+	case req.auth.payloadHash == streamingPayload:
+		body = newChunkedReader(req.Body, req.auth, req.key.SecretKey)
+	case req.auth.payloadHash != unsignedPayload && !isSha256Hex(req.auth.payloadHash):
+		return 0, nil, errNotImplemented
+	}
+
+	f, err := os.OpenFile(spoolPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, nil, err
+	}
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, md5Hash, sha256Hash), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if err == errSignatureMismatch {
+			return 0, nil, errSignatureDoesNotMatch
+		}
+		return 0, nil, err
+	}
+
+	if isSha256Hex(req.auth.payloadHash) && hex.EncodeToString(sha256Hash.Sum(nil)) != req.auth.payloadHash {
+		return 0, nil, errContentSha256Mismatch
+	}
+	md5sum := md5Hash.Sum(nil)
+	if contentMD5 := req.Header.Get("Content-Md5"); contentMD5 != "" && contentMD5 != b64.StdEncoding.EncodeToString(md5sum) {
+		return 0, nil, errBadDigest
+	}
+	return size, md5sum, nil
+}
+
+// storeObject uploads the spooled content to SDS, unless the wallet already stores the same content, and points the key to it
+func (g *Gateway) storeObject(req *s3Request, spoolPath string, size int64, etag string) (objectInfo, error) {
+	fileHash, err := crypto.CalcFileHash(spoolPath, "", crypto.SDS_CODEC)
+	if err != nil {
+		return objectInfo{}, err
+	}
+
+	unlock := g.lockFile(fileHash)
+	err = g.client.Upload(req.Context(), req.signer, spoolPath, path.Base(req.object), fileHash)
+	if err == nil {
+		// Keep the content in the cache, as objects are often read right after being written
+		if _, statErr := os.Stat(g.cachePath(fileHash)); os.IsNotExist(statErr) {
+			_ = os.Rename(spoolPath, g.cachePath(fileHash))
+		}
+	}
+	unlock()
+	if err != nil {
+		return objectInfo{}, err
+	}
+
+	object := objectInfo{
+		Key:          req.object,
+		FileHash:     fileHash,
+		Size:         size,
+		ETag:         etag,
+		ContentType:  req.Header.Get("Content-Type"),
+		LastModified: time.Now().UnixMilli(),
+	}
+	previous, err := g.index.putObject(req.signer.Address(), req.bucket, object)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	if previous != nil && previous.FileHash != fileHash {
+		g.releaseFile(req, previous.FileHash)
+	}
+	return object, nil
+}
+
+// releaseFile deletes a file from SDS once no key of the wallet points to it anymore
+func (g *Gateway) releaseFile(req *s3Request, fileHash string) {
+	referenced, err := g.index.isFileReferenced(req.signer.Address(), fileHash)
+	if err != nil || referenced {
+		return
+	}
+	unlock := g.lockFile(fileHash)
+	defer unlock()
+	removeFile(g.cachePath(fileHash))
+	if err = g.client.Delete(req.Context(), req.signer, fileHash); err != nil {
+		utils.ErrorLogf("S3 gateway couldn't delete file %v: %v", fileHash, err)
+	}
+}
+
+func (g *Gateway) getObject(w http.ResponseWriter, req *s3Request) {
+	object, err := g.index.getObject(req.signer.Address(), req.bucket, req.object)
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+
+	lastModified := time.UnixMilli(object.LastModified)
+	w.Header().Set("ETag", strconv.Quote(object.ETag))
+	w.Header().Set("Accept-Ranges", "bytes")
+	contentType := object.ContentType
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if req.Method == http.MethodHead {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	f, err := g.openCachedFile(req, object)
+	if err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	// ServeContent handles the Range and conditional headers
+	http.ServeContent(w, req.Request, path.Base(object.Key), lastModified, f)
+}
+
+// openCachedFile opens the content of an object, downloading it from SDS when it is not in the cache
+func (g *Gateway) openCachedFile(req *s3Request, object objectInfo) (*os.File, error) {
+	unlock := g.lockFile(object.FileHash)
+	defer unlock()
+
+	cachePath := g.cachePath(object.FileHash)
+	if info, err := os.Stat(cachePath); err == nil && info.Size() == object.Size {
+		now := time.Now()
+		_ = os.Chtimes(cachePath, now, now)
+		return os.Open(cachePath)
+	}
+
+	spoolPath := g.spoolPath()
+	defer removeFile(spoolPath)
+	f, err := os.OpenFile(spoolPath, os.O_CREATE|os.O_RDWR|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = g.client.Download(req.Context(), req.signer, object.FileHash, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Rename(spoolPath, cachePath); err != nil {
+		return nil, err
+	}
+	return os.Open(cachePath)
+}
+
+func (g *Gateway) deleteObject(w http.ResponseWriter, req *s3Request) {
+	if err := g.removeObject(req, req.object); err != nil {
+		writeError(w, req.Request, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) deleteObjects(w http.ResponseWriter, req *s3Request) {
+	var request deleteRequest
+	if err := xml.NewDecoder(io.LimitReader(req.Body, 2<<20)).Decode(&request); err != nil {
+		writeError(w, req.Request, errMalformedXML)
+		return
+	}
+
+	result := deleteResult{Xmlns: xmlNamespace}
+	for _, object := range request.Objects {
+		if err := g.removeObject(req, object.Key); err != nil {
+			apiErr := toAPIError(err)
+			result.Errors = append(result.Errors, deleteError{Key: object.Key, Code: apiErr.code, Message: apiErr.message})
+			continue
+		}
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: object.Key})
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+func (g *Gateway) removeObject(req *s3Request, key string) error {
+	object, err := g.index.deleteObject(req.signer.Address(), req.bucket, key)
+	if err != nil {
+		return err
+	}
+	if object != nil {
+		g.releaseFile(req, object.FileHash)
+	}
+	return nil
+}
+
+// cleanCache removes the cached contents that haven't been used for a while, and the abandoned multipart uploads
+func (g *Gateway) cleanCache() {
+	ticker := time.NewTicker(cacheCleanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		files, err := os.ReadDir(g.cachePath(""))
+		if err != nil {
+			utils.ErrorLog("S3 gateway couldn't read the cache folder", err)
+			continue
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil || time.Since(info.ModTime()) < cacheRetention {
+				continue
+			}
+			unlock := g.lockFile(f.Name())
+			removeFile(g.cachePath(f.Name()))
+			unlock()
+		}
+
+		uploads, err := os.ReadDir(g.multipartDir(""))
+		if err != nil {
+			utils.ErrorLog("S3 gateway couldn't read the multipart folder", err)
+			continue
+		}
+		for _, upload := range uploads {
+			info, err := upload.Info()
+			if err != nil || time.Since(info.ModTime()) < multipartRetention {
+				continue
+			}
+			if err = os.RemoveAll(g.multipartDir(upload.Name())); err != nil {
+				utils.ErrorLogf("S3 gateway couldn't remove multipart upload %v: %v", upload.Name(), err)
+			}
+		}
+	}
+}
+
+func removeFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		utils.ErrorLogf("S3 gateway couldn't remove file %v: %v", path, err)
+	}
+}
+
+func isSha256Hex(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
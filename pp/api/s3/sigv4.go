@@ -0,0 +1,240 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/utils/sigv4"
+)
+
+const (
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	maxRequestTimeSkew = 15 * time.Minute
+	maxPresignExpiry   = 7 * 24 * time.Hour
+)
+
+var errSignatureMismatch = errors.New("the request signature does not match")
+
+// sigV4Auth is the parsed SigV4 authentication of a request, from the Authorization header or from a presigned url
+type sigV4Auth struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       time.Time
+	presigned     bool
+	payloadHash   string
+}
+
+func (a *sigV4Auth) scope() string {
+	return sigv4.Scope(a.date, a.region, a.service)
+}
+
+// parseSigV4 extracts the SigV4 authentication fields of a request
+func parseSigV4(r *http.Request) (*sigV4Auth, error) {
+	auth := &sigV4Auth{}
+	var credential, signedHeaders, amzDate string
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		if query.Get("X-Amz-Algorithm") != sigv4.Algorithm {
+			return nil, errors.New("unsupported signature algorithm")
+		}
+		auth.presigned = true
+		credential = query.Get("X-Amz-Credential")
+		signedHeaders = query.Get("X-Amz-SignedHeaders")
+		auth.signature = query.Get("X-Amz-Signature")
+		amzDate = query.Get("X-Amz-Date")
+		auth.payloadHash = unsignedPayload
+	} else {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, sigv4.Algorithm+" ") {
+			return nil, errors.New("missing or unsupported authorization header")
+		}
+		for _, field := range strings.Split(strings.TrimPrefix(header, sigv4.Algorithm+" "), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch key {
+			case "Credential":
+				credential = value
+			case "SignedHeaders":
+				signedHeaders = value
+			case "Signature":
+				auth.signature = value
+			}
+		}
+		amzDate = r.Header.Get("X-Amz-Date")
+		auth.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if auth.payloadHash == "" {
+			auth.payloadHash = emptyPayloadHash
+		}
+	}
+
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != sigv4.Terminator {
+		return nil, errors.New("malformed credential scope")
+	}
+	auth.accessKey, auth.date, auth.region, auth.service = parts[0], parts[1], parts[2], parts[3]
+	if signedHeaders == "" || auth.signature == "" {
+		return nil, errors.New("missing signed headers or signature")
+	}
+	auth.signedHeaders = strings.Split(signedHeaders, ";")
+
+	var err error
+	auth.amzDate, err = time.Parse(sigv4.TimeFormat, amzDate)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid X-Amz-Date")
+	}
+	if auth.amzDate.Format(sigv4.DateFormat) != auth.date {
+		return nil, errors.New("credential scope date doesn't match X-Amz-Date")
+	}
+	return auth, nil
+}
+
+// verify checks the request signature with the secret key of the access key, and that the request hasn't expired
+func (a *sigV4Auth) verify(r *http.Request, secretKey, region string, now time.Time) error {
+	if a.region != region || a.service != "s3" {
+		return errors.Errorf("credential scope %v is not valid for this gateway", a.scope())
+	}
+	if a.presigned {
+		expires, err := strconv.ParseInt(r.URL.Query().Get("X-Amz-Expires"), 10, 64)
+		if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+			return errors.New("invalid X-Amz-Expires")
+		}
+		if now.Before(a.amzDate.Add(-maxRequestTimeSkew)) || now.After(a.amzDate.Add(time.Duration(expires)*time.Second)) {
+			return errors.New("the presigned url has expired")
+		}
+	} else if now.Sub(a.amzDate) > maxRequestTimeSkew || a.amzDate.Sub(now) > maxRequestTimeSkew {
+		return errors.New("the difference between the request time and the server's time is too large")
+	}
+
+	key := sigv4.SigningKey(secretKey, a.date, a.region, a.service)
+	expected := hex.EncodeToString(sigv4.HmacSHA256(key, []byte(a.stringToSign(canonicalRequest(r, a)))))
+	if !hmac.Equal([]byte(expected), []byte(a.signature)) {
+		return errSignatureMismatch
+	}
+	return nil
+}
+
+func (a *sigV4Auth) stringToSign(canonicalRequest string) string {
+	return sigv4.StringToSign(a.amzDate.Format(sigv4.TimeFormat), a.scope(), canonicalRequest)
+}
+
+func canonicalQuery(query url.Values, presigned bool) string {
+	if presigned {
+		return sigv4.CanonicalQuery(query, "X-Amz-Signature")
+	}
+	return sigv4.CanonicalQuery(query)
+}
+
+func canonicalRequest(r *http.Request, a *sigV4Auth) string {
+	var headers strings.Builder
+	for _, name := range a.signedHeaders {
+		var value string
+		switch {
+		case name == "host":
+			value = r.Host
+		case name == "content-length" && r.Header.Get("Content-Length") == "":
+			value = strconv.FormatInt(r.ContentLength, 10)
+		default:
+			value = strings.Join(r.Header.Values(name), ",")
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		sigv4.CanonicalURI(r.URL),
+		canonicalQuery(r.URL.Query(), a.presigned),
+		headers.String(),
+		strings.Join(a.signedHeaders, ";"),
+		a.payloadHash,
+	}, "\n")
+}
+
+// chunkedReader decodes an aws-chunked body, verifying the signature chain of the chunks
+type chunkedReader struct {
+	reader    *bufio.Reader
+	auth      *sigV4Auth
+	key       []byte
+	prevSig   string
+	remaining []byte
+	done      bool
+}
+
+func newChunkedReader(body io.Reader, auth *sigV4Auth, secretKey string) *chunkedReader {
+	return &chunkedReader{
+		reader:  bufio.NewReader(body),
+		auth:    auth,
+		key:     sigv4.SigningKey(secretKey, auth.date, auth.region, auth.service),
+		prevSig: auth.signature,
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.remaining) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.remaining)
+	c.remaining = c.remaining[n:]
+	return n, nil
+}
+
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return errors.Wrap(err, "malformed chunk header")
+	}
+	sizeHex, params, _ := strings.Cut(strings.TrimSpace(line), ";")
+	size, err := strconv.ParseUint(sizeHex, 16, 32)
+	if err != nil {
+		return errors.Wrap(err, "malformed chunk size")
+	}
+	signature := strings.TrimPrefix(params, "chunk-signature=")
+
+	data := make([]byte, size+2)
+	if _, err = io.ReadFull(c.reader, data); err != nil {
+		return errors.Wrap(err, "truncated chunk")
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		return errors.New("malformed chunk trailer")
+	}
+	data = data[:size]
+
+	dataHash := sha256.Sum256(data)
+	stringToSign := strings.Join([]string{
+		sigv4.ChunkAlgorithm,
+		c.auth.amzDate.Format(sigv4.TimeFormat),
+		c.auth.scope(),
+		c.prevSig,
+		emptyPayloadHash,
+		hex.EncodeToString(dataHash[:]),
+	}, "\n")
+	expected := hex.EncodeToString(sigv4.HmacSHA256(c.key, []byte(stringToSign)))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errSignatureMismatch
+	}
+	c.prevSig = signature
+	c.remaining = data
+	c.done = size == 0
+	return nil
+}
@@ -0,0 +1,280 @@
+package sdsclient
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	fwtypes "github.com/stratosnet/sds/framework/types"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/sds-msg/protos"
+	msgutils "github.com/stratosnet/sds/sds-msg/utils"
+
+	rpc_api "github.com/stratosnet/sds/pp/api/rpc"
+	"github.com/stratosnet/sds/pp/setting"
+	ppsigner "github.com/stratosnet/sds/pp/signer"
+)
+
+const (
+	uploadDesiredTier    = 2
+	uploadStatusInterval = 5 * time.Second
+	uploadTimeout        = time.Hour
+)
+
+// WalletSigner signs the wallet signatures required by the user rpc api
+type WalletSigner struct {
+	address string
+	pubkey  string // bech32
+	signer  ppsigner.Signer
+}
+
+// NodeWalletSigner returns a signer for a wallet. Only the wallet of this node is available to sign
+func NodeWalletSigner(walletAddress string) (*WalletSigner, error) {
+	if setting.WalletAddress == "" || setting.WalletSigner == nil {
+		return nil, errors.New("the node wallet is not loaded")
+	}
+	if walletAddress != setting.WalletAddress {
+		return nil, errors.Errorf("wallet %v can't be signed for by this node", walletAddress)
+	}
+	pubkey, err := fwtypes.WalletPubKeyToBech32(setting.WalletPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &WalletSigner{address: walletAddress, pubkey: pubkey, signer: setting.WalletSigner}, nil
+}
+
+// Address is the wallet signing the requests
+func (s *WalletSigner) Address() string {
+	return s.address
+}
+
+func (s *WalletSigner) Sign(msgType, msg string) (rpc_api.Signature, error) {
+	sign, err := s.signer.Sign(msgType, []byte(msg))
+	if err != nil {
+		return rpc_api.Signature{}, errors.Wrap(err, "wallet failed to sign message")
+	}
+	return rpc_api.Signature{Address: s.address, Pubkey: s.pubkey, Signature: hex.EncodeToString(sign)}, nil
+}
+
+// RpcError is a failed result returned by the user rpc api
+type RpcError struct {
+	Method string
+	Result string
+	Detail string
+}
+
+func (e *RpcError) Error() string {
+	if e.Detail == "" {
+		return e.Method + " failed with return " + e.Result
+	}
+	return e.Method + " failed with return " + e.Result + ": " + e.Detail
+}
+
+// Client drives the upload, download and delete flows of the user rpc api in process, the same way a remote rpc client
+// would
+type Client struct {
+	api RpcPubApi
+}
+
+// RpcPubApi is the part of the user rpc api used by the client
+type RpcPubApi interface {
+	RequestUpload(ctx context.Context, param rpc_api.ParamReqUploadFile) rpc_api.Result
+	UploadData(ctx context.Context, param rpc_api.ParamUploadData) rpc_api.Result
+	UploadSign(ctx context.Context, param rpc_api.ParamUploadSign) rpc_api.Result
+	GetFileStatus(ctx context.Context, param rpc_api.ParamGetFileStatus) rpc_api.FileStatusResult
+	RequestDownload(ctx context.Context, param rpc_api.ParamReqDownloadFile) rpc_api.Result
+	DownloadData(ctx context.Context, param rpc_api.ParamDownloadData) rpc_api.Result
+	DownloadedFileInfo(ctx context.Context, param rpc_api.ParamDownloadFileInfo) rpc_api.Result
+	RequestDeleteFile(ctx context.Context, param rpc_api.ParamReqDeleteFile) rpc_api.Result
+	RequestGetOzone(ctx context.Context, param rpc_api.ParamReqGetOzone) rpc_api.GetOzoneResult
+}
+
+func NewClient(api RpcPubApi) *Client {
+	return &Client{api: api}
+}
+
+func (c *Client) sequenceNumber(ctx context.Context, signer *WalletSigner) (string, error) {
+	res := c.api.RequestGetOzone(ctx, rpc_api.ParamReqGetOzone{WalletAddr: signer.address})
+	if res.Return != rpc_api.SUCCESS {
+		return "", &RpcError{Method: "RequestGetOzone", Result: res.Return}
+	}
+	return res.SequenceNumber, nil
+}
+
+// Upload stores the file at filePath in SDS, and waits until the SP reports the upload as finished
+func (c *Client) Upload(ctx context.Context, signer *WalletSigner, filePath, fileName, fileHash string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	status, err := c.FileStatus(ctx, signer, fileHash)
+	if err != nil {
+		return err
+	}
+	if status.UserHasFile && status.FileUploadState == protos.FileUploadState_FINISHED {
+		return nil // Same content already uploaded by this wallet
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	sn, err := c.sequenceNumber(ctx, signer)
+	if err != nil {
+		return err
+	}
+	reqTime := time.Now().Unix()
+	sig, err := signer.Sign(ppsigner.MSG_UPLOAD, msgutils.GetFileUploadWalletSignMessage(fileHash, signer.address, sn, reqTime))
+	if err != nil {
+		return err
+	}
+	res := c.api.RequestUpload(ctx, rpc_api.ParamReqUploadFile{
+		FileName:        fileName,
+		FileSize:        int(info.Size()),
+		FileHash:        fileHash,
+		Signature:       sig,
+		ReqTime:         reqTime,
+		DesiredTier:     uploadDesiredTier,
+		AllowHigherTier: true,
+		SequenceNumber:  sn,
+	})
+
+	for res.Return == rpc_api.UPLOAD_DATA {
+		data := make([]byte, *res.OffsetEnd-*res.OffsetStart)
+		if _, err = f.ReadAt(data, int64(*res.OffsetStart)); err != nil {
+			return errors.Wrap(err, "failed reading file data")
+		}
+		reqTime = time.Now().Unix()
+		sig, err = signer.Sign(ppsigner.MSG_UPLOAD, msgutils.GetFileUploadWalletSignMessage(fileHash, signer.address, sn, reqTime))
+		if err != nil {
+			return err
+		}
+		res = c.api.UploadData(ctx, rpc_api.ParamUploadData{
+			FileHash:       fileHash,
+			Data:           b64.StdEncoding.EncodeToString(data),
+			Signature:      sig,
+			ReqTime:        reqTime,
+			SequenceNumber: sn,
+		})
+	}
+	if res.Return != rpc_api.SUCCESS {
+		return &RpcError{Method: "UploadData", Result: res.Return, Detail: res.Detail}
+	}
+
+	// The upload itself needs a new sequence number
+	if sn, err = c.sequenceNumber(ctx, signer); err != nil {
+		return err
+	}
+	reqTime = time.Now().Unix()
+	sig, err = signer.Sign(ppsigner.MSG_UPLOAD, msgutils.GetFileUploadWalletSignMessage(fileHash, signer.address, sn, reqTime))
+	if err != nil {
+		return err
+	}
+	res = c.api.UploadSign(ctx, rpc_api.ParamUploadSign{FileHash: fileHash, Signature: sig, ReqTime: reqTime, SequenceNumber: sn})
+	if res.Return != rpc_api.SUCCESS {
+		return &RpcError{Method: "UploadSign", Result: res.Return, Detail: res.Detail}
+	}
+	return c.waitUploadFinished(ctx, signer, fileHash)
+}
+
+func (c *Client) waitUploadFinished(ctx context.Context, signer *WalletSigner, fileHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+	ticker := time.NewTicker(uploadStatusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("timed out waiting for the upload of file %v to finish", fileHash)
+		case <-ticker.C:
+		}
+		status, err := c.FileStatus(ctx, signer, fileHash)
+		if err != nil {
+			utils.DebugLogf("couldn't query the status of file %v: %v", fileHash, err)
+			continue
+		}
+		switch status.FileUploadState {
+		case protos.FileUploadState_FINISHED:
+			return nil
+		case protos.FileUploadState_FAILED:
+			return errors.Errorf("the upload of file %v failed: %v", fileHash, status.Error)
+		}
+	}
+}
+
+func (c *Client) FileStatus(ctx context.Context, signer *WalletSigner, fileHash string) (rpc_api.FileStatusResult, error) {
+	reqTime := time.Now().Unix()
+	sig, err := signer.Sign(ppsigner.MSG_FILE_INFO, msgutils.GetFileStatusWalletSignMessage(fileHash, signer.address, reqTime))
+	if err != nil {
+		return rpc_api.FileStatusResult{}, err
+	}
+	res := c.api.GetFileStatus(ctx, rpc_api.ParamGetFileStatus{FileHash: fileHash, Signature: sig, ReqTime: reqTime})
+	if res.Return != rpc_api.SUCCESS {
+		return res, &RpcError{Method: "GetFileStatus", Result: res.Return, Detail: res.Error}
+	}
+	return res, nil
+}
+
+// Download writes the content of a file owned by the signer's wallet to dst
+func (c *Client) Download(ctx context.Context, signer *WalletSigner, fileHash string, dst *os.File) error {
+	sn, err := c.sequenceNumber(ctx, signer)
+	if err != nil {
+		return err
+	}
+	reqTime := time.Now().Unix()
+	sig, err := signer.Sign(ppsigner.MSG_DOWNLOAD, msgutils.GetFileDownloadWalletSignMessage(fileHash, signer.address, sn, reqTime))
+	if err != nil {
+		return err
+	}
+	res := c.api.RequestDownload(ctx, rpc_api.ParamReqDownloadFile{
+		FileHandle: fwtypes.DATA_MESH_PROTOCOL + signer.address + "/" + fileHash,
+		Signature:  sig,
+		ReqTime:    reqTime,
+	})
+	reqId := res.ReqId
+
+	var fileSize uint64
+	for res.Return == rpc_api.DOWNLOAD_OK {
+		data, err := b64.StdEncoding.DecodeString(res.FileData)
+		if err != nil {
+			return errors.Wrap(err, "invalid file data")
+		}
+		if uint64(len(data)) != *res.OffsetEnd-*res.OffsetStart {
+			return errors.Errorf("wrong size for the downloaded data: expected %v, got %v", *res.OffsetEnd-*res.OffsetStart, len(data))
+		}
+		if _, err = dst.WriteAt(data, int64(*res.OffsetStart)); err != nil {
+			return err
+		}
+		fileSize += uint64(len(data))
+		res = c.api.DownloadData(ctx, rpc_api.ParamDownloadData{FileHash: fileHash, ReqId: reqId})
+	}
+	if res.Return != rpc_api.DL_OK_ASK_INFO {
+		return &RpcError{Method: "DownloadData", Result: res.Return, Detail: res.Detail}
+	}
+	res = c.api.DownloadedFileInfo(ctx, rpc_api.ParamDownloadFileInfo{FileHash: fileHash, FileSize: fileSize, ReqId: reqId})
+	if res.Return != rpc_api.SUCCESS {
+		return &RpcError{Method: "DownloadedFileInfo", Result: res.Return, Detail: res.Detail}
+	}
+	return nil
+}
+
+func (c *Client) Delete(ctx context.Context, signer *WalletSigner, fileHash string) error {
+	reqTime := time.Now().Unix()
+	sig, err := signer.Sign(ppsigner.MSG_DELETE, msgutils.DeleteFileWalletSignMessage(fileHash, signer.address, reqTime))
+	if err != nil {
+		return err
+	}
+	res := c.api.RequestDeleteFile(ctx, rpc_api.ParamReqDeleteFile{FileHash: fileHash, Signature: sig, ReqTime: reqTime})
+	if res.Return != rpc_api.SUCCESS {
+		return &RpcError{Method: "RequestDeleteFile", Result: res.Return, Detail: res.Detail}
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package sdsclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/crypto"
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+// DEFAULT_DIR_WORKERS is the number of files uploaded or downloaded at the same time by default
+const DEFAULT_DIR_WORKERS = 4
+
+// UploadDir uploads the regular files of a directory tree, then a signed manifest of the tree. It returns the file hash
+// of the manifest. Files with the same content are uploaded once
+func (c *Client) UploadDir(ctx context.Context, signer *WalletSigner, root string, workers int) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", errors.Errorf("%v is not a directory", root)
+	}
+	manifest := &Manifest{Version: MANIFEST_VERSION, Name: filepath.Base(root), CreatedTime: time.Now().Unix()}
+	if !isLocalPath(manifest.Name) {
+		return "", errors.Errorf("directory %v can't be uploaded", root)
+	}
+
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := ManifestEntry{Path: filepath.ToSlash(rel), Mode: uint32(info.Mode())}
+		switch {
+		case d.IsDir():
+		case info.Mode().IsRegular():
+			entry.Size = info.Size()
+		default:
+			utils.DebugLogf("skipping %v, not a regular file", p)
+			return nil
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed walking the directory")
+	}
+
+	err = runWorkers(ctx, workers, len(manifest.Entries), func(ctx context.Context, i int) error {
+		entry := &manifest.Entries[i]
+		if entry.IsDir() || entry.Size == 0 {
+			return nil
+		}
+		fileHash, err := crypto.CalcFileHash(localPath(root, entry.Path), "", crypto.SDS_CODEC)
+		if err != nil {
+			return errors.Wrapf(err, "failed hashing [%v]", entry.Path)
+		}
+		entry.FileHash = fileHash
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	contents := uniqueContents(manifest.Entries)
+	err = runWorkers(ctx, workers, len(contents), func(ctx context.Context, i int) error {
+		entry := manifest.Entries[contents[i][0]]
+		if err := c.Upload(ctx, signer, localPath(root, entry.Path), path.Base(entry.Path), entry.FileHash); err != nil {
+			return errors.Wrapf(err, "failed uploading [%v]", entry.Path)
+		}
+		utils.DebugLogf("uploaded [%v] with file hash %v", entry.Path, entry.FileHash)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err = manifest.Sign(signer); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp("", "sds-manifest-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed writing the manifest")
+	}
+	manifestHash, err := crypto.CalcFileHash(tmp.Name(), "", crypto.SDS_CODEC)
+	if err != nil {
+		return "", err
+	}
+	if err = c.Upload(ctx, signer, tmp.Name(), manifest.Name+MANIFEST_SUFFIX, manifestHash); err != nil {
+		return "", errors.Wrap(err, "failed uploading the manifest")
+	}
+	return manifestHash, nil
+}
+
+// DownloadDir restores the tree of a manifest into a new directory named after the uploaded one, inside dest
+func (c *Client) DownloadDir(ctx context.Context, signer *WalletSigner, manifestHash, dest string, workers int) (*Manifest, error) {
+	tmp, err := os.CreateTemp("", "sds-manifest-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	err = c.Download(ctx, signer, manifestHash, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed downloading the manifest")
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := ParseManifest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root := filepath.Join(dest, manifest.Name)
+	if _, err = os.Stat(root); err == nil {
+		return nil, errors.Errorf("%v already exists", root)
+	}
+	if err = os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	for _, entry := range manifest.Entries {
+		dir := localPath(root, entry.Path)
+		if !entry.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		if !entry.IsDir() && entry.Size == 0 {
+			if err = os.WriteFile(localPath(root, entry.Path), nil, 0600); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	contents := uniqueContents(manifest.Entries)
+	err = runWorkers(ctx, workers, len(contents), func(ctx context.Context, i int) error {
+		first := manifest.Entries[contents[i][0]]
+		firstPath := localPath(root, first.Path)
+		if err := c.downloadTo(ctx, signer, first, firstPath); err != nil {
+			return errors.Wrapf(err, "failed downloading [%v]", first.Path)
+		}
+		for _, j := range contents[i][1:] {
+			if err := copyFile(firstPath, localPath(root, manifest.Entries[j].Path)); err != nil {
+				return errors.Wrapf(err, "failed copying [%v]", manifest.Entries[j].Path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Children come after their parent in the manifest, so restricting a parent doesn't prevent changing its children
+	for i := len(manifest.Entries) - 1; i >= 0; i-- {
+		entry := manifest.Entries[i]
+		if err = os.Chmod(localPath(root, entry.Path), os.FileMode(entry.Mode).Perm()); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+func (c *Client) downloadTo(ctx context.Context, signer *WalletSigner, entry ManifestEntry, filePath string) error {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	err = c.Download(ctx, signer, entry.FileHash, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if info.Size() != entry.Size {
+		return errors.Errorf("wrong size: expected %v, got %v", entry.Size, info.Size())
+	}
+	return nil
+}
+
+// uniqueContents groups the indexes of the files with the same file hash, in the order of the entries
+func uniqueContents(entries []ManifestEntry) [][]int {
+	var contents [][]int
+	groups := make(map[string]int)
+	for i, entry := range entries {
+		if entry.FileHash == "" {
+			continue
+		}
+		if group, ok := groups[entry.FileHash]; ok {
+			contents[group] = append(contents[group], i)
+			continue
+		}
+		groups[entry.FileHash] = len(contents)
+		contents = append(contents, []int{i})
+	}
+	return contents
+}
+
+func localPath(root, manifestPath string) string {
+	return filepath.Join(root, filepath.FromSlash(manifestPath))
+}
+
+func copyFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// runWorkers calls fn for the indexes from 0 to n-1 with a pool of workers, and stops at the first error
+func runWorkers(ctx context.Context, workers, n int, fn func(ctx context.Context, i int) error) error {
+	if workers <= 0 {
+		workers = DEFAULT_DIR_WORKERS
+	}
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	errCh := make(chan error, 1)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(workerCtx, i); err != nil {
+					select {
+					case errCh <- err:
+					default:
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+
+loop:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-workerCtx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,119 @@
+package sdsclient
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	fwtypes "github.com/stratosnet/sds/framework/types"
+
+	ppsigner "github.com/stratosnet/sds/pp/signer"
+)
+
+const (
+	MANIFEST_VERSION = 1
+	// MANIFEST_SUFFIX is appended to the name of the uploaded directory to name its manifest file
+	MANIFEST_SUFFIX = ".sdsdir"
+)
+
+// ManifestEntry is a file or a directory of an uploaded tree
+type ManifestEntry struct {
+	Path     string `json:"path"`                // slash separated, relative to the root of the tree
+	FileHash string `json:"file_hash,omitempty"` // empty for directories and empty files
+	Size     int64  `json:"size"`
+	Mode     uint32 `json:"mode"` // os.FileMode
+}
+
+func (e ManifestEntry) IsDir() bool {
+	return os.FileMode(e.Mode).IsDir()
+}
+
+// Manifest lists the files of an uploaded directory. It is stored in SDS as a file of its own, signed by the wallet
+// that uploaded the tree
+type Manifest struct {
+	Version     int             `json:"version"`
+	Name        string          `json:"name"`
+	Owner       string          `json:"owner"`
+	Pubkey      string          `json:"pubkey"` // bech32
+	CreatedTime int64           `json:"created_time"`
+	Entries     []ManifestEntry `json:"entries"`
+	Signature   string          `json:"signature"` // hex
+}
+
+// signMessage is the content of the manifest covered by its signature
+func (m *Manifest) signMessage() (string, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (m *Manifest) Sign(signer *WalletSigner) error {
+	m.Owner = signer.address
+	m.Pubkey = signer.pubkey
+	msg, err := m.signMessage()
+	if err != nil {
+		return err
+	}
+	sign, err := signer.signer.Sign(ppsigner.MSG_MANIFEST, []byte(msg))
+	if err != nil {
+		return errors.Wrap(err, "wallet failed to sign the manifest")
+	}
+	m.Signature = hex.EncodeToString(sign)
+	return nil
+}
+
+// Verify checks the version, the signature and the paths of the manifest
+func (m *Manifest) Verify() error {
+	if m.Version != MANIFEST_VERSION {
+		return errors.Errorf("unsupported manifest version %v", m.Version)
+	}
+	if !isLocalPath(m.Name) || strings.Contains(m.Name, "/") {
+		return errors.Errorf("invalid manifest name [%v]", m.Name)
+	}
+	if !fwtypes.VerifyWalletAddr(m.Pubkey, m.Owner) {
+		return errors.New("the manifest public key doesn't match its owner")
+	}
+	msg, err := m.signMessage()
+	if err != nil {
+		return err
+	}
+	if !fwtypes.VerifyWalletSign(m.Pubkey, m.Signature, msg) {
+		return errors.New("invalid manifest signature")
+	}
+	for _, entry := range m.Entries {
+		if !isLocalPath(entry.Path) {
+			return errors.Errorf("invalid path [%v] in the manifest", entry.Path)
+		}
+		if !entry.IsDir() && entry.Size > 0 && entry.FileHash == "" {
+			return errors.Errorf("missing file hash for [%v] in the manifest", entry.Path)
+		}
+	}
+	return nil
+}
+
+// isLocalPath checks that a manifest path stays inside the root of the tree
+func isLocalPath(p string) bool {
+	if p == "" || strings.Contains(p, "\\") || path.IsAbs(p) || path.Clean(p) != p {
+		return false
+	}
+	return p != "." && p != ".." && !strings.HasPrefix(p, "../")
+}
+
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrap(err, "invalid manifest")
+	}
+	if err := m.Verify(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,117 @@
+package sdsclient
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/crypto/secp256k1"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+
+	ppsigner "github.com/stratosnet/sds/pp/signer"
+)
+
+func TestManifestSignature(t *testing.T) {
+	privKey, err := secp256k1.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkey, err := fwtypes.WalletPubKeyToBech32(privKey.PubKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &WalletSigner{address: fwtypes.WalletAddress(privKey.PubKey().Address()).String(), pubkey: pubkey, signer: ppsigner.NewLocalSigner(privKey)}
+
+	manifest := &Manifest{
+		Version: MANIFEST_VERSION,
+		Name:    "project",
+		Entries: []ManifestEntry{
+			{Path: "src", Mode: 0x800001ed},
+			{Path: "src/main.go", FileHash: "v05ahm50ugfjrgd3ga8mqi6bqka32ks3dooe1p9g", Size: 100, Mode: 0644},
+			{Path: "empty", Mode: 0600},
+		},
+	}
+	if err = manifest.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if err = manifest.Verify(); err != nil {
+		t.Fatalf("the signed manifest should be valid: %v", err)
+	}
+
+	manifest.Entries[1].FileHash = "v05ahm50ugfjrgd3ga8mqi6bqka32ks3dooe1p9h"
+	if err = manifest.Verify(); err == nil {
+		t.Fatal("a modified manifest should be invalid")
+	}
+
+	manifest.Entries[1].Path = "../main.go"
+	if err = manifest.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if err = manifest.Verify(); err == nil {
+		t.Fatal("a manifest with a path outside of the tree should be invalid")
+	}
+}
+
+func TestIsLocalPath(t *testing.T) {
+	for p, want := range map[string]bool{
+		"a":         true,
+		"a/b.txt":   true,
+		"..a":       true,
+		"":          false,
+		".":         false,
+		"..":        false,
+		"../a":      false,
+		"a/../../b": false,
+		"/etc":      false,
+		"a//b":      false,
+		"a/":        false,
+		`a\b`:       false,
+	} {
+		if got := isLocalPath(p); got != want {
+			t.Errorf("isLocalPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestUniqueContents(t *testing.T) {
+	entries := []ManifestEntry{
+		{Path: "a", FileHash: "x"},
+		{Path: "b"},
+		{Path: "c", FileHash: "y"},
+		{Path: "d", FileHash: "x"},
+	}
+	want := [][]int{{0, 3}, {2}}
+	if got := uniqueContents(entries); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestRunWorkers(t *testing.T) {
+	var count int64
+	err := runWorkers(context.Background(), 3, 100, func(ctx context.Context, i int) error {
+		atomic.AddInt64(&count, 1)
+		return nil
+	})
+	if err != nil || count != 100 {
+		t.Fatalf("all the jobs should run: count %v, err %v", count, err)
+	}
+
+	failure := errors.New("failure")
+	count = 0
+	err = runWorkers(context.Background(), 2, 1000, func(ctx context.Context, i int) error {
+		atomic.AddInt64(&count, 1)
+		if i == 10 {
+			return failure
+		}
+		return nil
+	})
+	if err != failure {
+		t.Fatalf("the first error should be returned, got %v", err)
+	}
+	if count >= 1000 {
+		t.Fatal("the jobs should stop after an error")
+	}
+}
@@ -31,11 +31,13 @@ import (
 	msgutils "github.com/stratosnet/sds/sds-msg/utils"
 
 	rpc_api "github.com/stratosnet/sds/pp/api/rpc"
+	"github.com/stratosnet/sds/pp/bandwidth"
 	"github.com/stratosnet/sds/pp/event"
 	"github.com/stratosnet/sds/pp/file"
 	"github.com/stratosnet/sds/pp/namespace"
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
 	"github.com/stratosnet/sds/pp/task"
 )
 
@@ -361,13 +363,13 @@ func streamVideoP2PHelper(w http.ResponseWriter, req *http.Request) {
 		_, _ = w.Write(httpserv.NewErrorJson(setting.FAILCode, "failed to get video slice").ToBytes())
 		return
 	}
-	if segment == streamInfo.HeaderFile {
+	if segment == streamInfo.HeaderFile || filepath.Ext(segment) == ".m3u8" {
 		w.Header().Set("Content-Type", "application/x-mpegURL")
 	} else if segment != "" {
 		w.Header().Set("Content-Type", "video/MP2T")
 	}
 	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	_, _ = w.Write(data)
+	_, _ = bandwidth.WriteShaped(w, bandwidth.CLASS_STREAMING, data)
 }
 
 func streamVideoHttp(w http.ResponseWriter, req *http.Request) {
@@ -457,7 +459,7 @@ func GetVideoSlice(w http.ResponseWriter, req *http.Request) {
 	}
 
 	utils.DebugLog("Found the slice and return", body)
-	_, _ = w.Write(video)
+	_, _ = bandwidth.WriteShaped(w, bandwidth.CLASS_STREAMING, video)
 
 	sendReportStreamResult(req.Context(), body, sliceHash, true)
 }
@@ -712,7 +714,7 @@ func getWalletSignFromLocal(req *http.Request, keyword string) (*rpc_api.Signatu
 		return nil, 0, err
 	}
 	nowSec := time.Now().Unix()
-	sign, err := setting.WalletPrivateKey.Sign([]byte(msgutils.GetFileDownloadWalletSignMessage(keyword, setting.WalletAddress, sn, nowSec)))
+	sign, err := setting.WalletSigner.Sign(signer.MSG_DOWNLOAD, []byte(msgutils.GetFileDownloadWalletSignMessage(keyword, setting.WalletAddress, sn, nowSec)))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -0,0 +1,68 @@
+package bandwidth
+
+import (
+	"io"
+	"sync"
+
+	"github.com/stratosnet/sds/framework/core"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+var (
+	shaper    *Shaper
+	shaperMtx sync.Mutex
+)
+
+// Init creates the shaper of the node from the configuration, and applies it to the P2P connections
+func Init() error {
+	s, err := NewShaper(setting.Config.Bandwidth)
+	if err != nil {
+		return err
+	}
+	shaperMtx.Lock()
+	shaper = s
+	shaperMtx.Unlock()
+	core.SetBandwidthShaper(s)
+	return nil
+}
+
+func getShaper() *Shaper {
+	shaperMtx.Lock()
+	defer shaperMtx.Unlock()
+	return shaper
+}
+
+// SetConfig changes the bandwidth limits while the node runs. The configuration file is updated when persist is true
+func SetConfig(config setting.BandwidthConfig, persist bool) error {
+	s := getShaper()
+	if s == nil {
+		if err := Init(); err != nil {
+			return err
+		}
+		s = getShaper()
+	}
+	if err := s.SetConfig(config); err != nil {
+		return err
+	}
+	setting.Config.Bandwidth = config
+	if persist {
+		return setting.FlushConfig()
+	}
+	return nil
+}
+
+// GetConfig returns the bandwidth limits of the node, and the name of the schedule applied
+func GetConfig() (setting.BandwidthConfig, string) {
+	if s := getShaper(); s != nil {
+		return s.GetConfig()
+	}
+	return setting.Config.Bandwidth, ""
+}
+
+// WriteShaped writes data to a client outside the P2P network, like the HTTP clients of the streaming servers
+func WriteShaped(w io.Writer, class string, data []byte) (int, error) {
+	if s := getShaper(); s != nil {
+		return s.WriteShaped(w, class, data)
+	}
+	return w.Write(data)
+}
@@ -0,0 +1,89 @@
+package bandwidth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// schedule is a parsed setting.BandwidthSchedule. Times are minutes since midnight
+type schedule struct {
+	days  map[time.Weekday]bool // every day when empty
+	start int
+	end   int
+}
+
+func parseSchedules(configs []setting.BandwidthSchedule) ([]schedule, error) {
+	var schedules []schedule
+	for _, config := range configs {
+		sched := schedule{days: make(map[time.Weekday]bool)}
+		for _, day := range config.Days {
+			key := strings.ToLower(day)
+			if len(key) > 3 {
+				key = key[:3]
+			}
+			weekday, ok := weekdays[key]
+			if !ok {
+				return nil, errors.Errorf("invalid day [%v] in bandwidth schedule [%v]", day, config.Name)
+			}
+			sched.days[weekday] = true
+		}
+		var err error
+		if sched.start, err = parseClock(config.Start); err != nil {
+			return nil, errors.Wrapf(err, "invalid start of bandwidth schedule [%v]", config.Name)
+		}
+		if sched.end, err = parseClock(config.End); err != nil {
+			return nil, errors.Wrapf(err, "invalid end of bandwidth schedule [%v]", config.Name)
+		}
+		schedules = append(schedules, sched)
+	}
+	return schedules, nil
+}
+
+// parseClock returns the minutes since midnight of a "15:04" time. An empty time is midnight
+func parseClock(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// matches checks if the schedule applies at a local time. A schedule ending before it starts runs over midnight, and
+// its days are the days it starts
+func (s schedule) matches(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	day := now.Weekday()
+	switch {
+	case s.start == s.end:
+		return s.onDay(day)
+	case s.start < s.end:
+		return s.onDay(day) && minute >= s.start && minute < s.end
+	case minute >= s.start:
+		return s.onDay(day)
+	case minute < s.end:
+		return s.onDay((day + 6) % 7)
+	default:
+		return false
+	}
+}
+
+func (s schedule) onDay(day time.Weekday) bool {
+	return len(s.days) == 0 || s.days[day]
+}
@@ -0,0 +1,236 @@
+package bandwidth
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stratosnet/sds/framework/core"
+	"github.com/stratosnet/sds/framework/msg/header"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+// Traffic classes
+const (
+	CLASS_UPLOAD       = "upload"
+	CLASS_BACKUP       = "backup"
+	CLASS_VERIFICATION = "verification"
+	CLASS_DOWNLOAD     = "download"
+	CLASS_STREAMING    = "streaming"
+	CLASS_OTHER        = "other"
+)
+
+const (
+	// scheduleCheckInterval is how often the shaper checks which schedule applies
+	scheduleCheckInterval = time.Minute
+	// peerIdleTimeout is how long the buckets of a peer are kept after its last message
+	peerIdleTimeout = 10 * time.Minute
+	// writeChunkSize is the size of the chunks written by WriteShaped
+	writeChunkSize = 64 * 1024
+)
+
+var messageClasses = map[uint8]string{
+	header.ReqUploadFileSlice.Id:  CLASS_UPLOAD,
+	header.ReqBackupFileSlice.Id:  CLASS_BACKUP,
+	header.RspTransferDownload.Id: CLASS_BACKUP,
+	header.RspVerifyDownload.Id:   CLASS_VERIFICATION,
+	header.RspDownloadSlice.Id:    CLASS_DOWNLOAD,
+}
+
+// MessageClass returns the traffic class of a message type
+func MessageClass(cmd uint8) string {
+	if class, ok := messageClasses[cmd]; ok {
+		return class
+	}
+	return CLASS_OTHER
+}
+
+// buckets limits the inbound and outbound traffic of a flow, indexed by direction
+type buckets [2]*utils.TokenBucket
+
+func newBuckets(limits setting.BandwidthLimits) *buckets {
+	b := &buckets{utils.NewTokenBucket(0, 0), utils.NewTokenBucket(0, 0)}
+	b.set(limits)
+	return b
+}
+
+func (b *buckets) set(limits setting.BandwidthLimits) {
+	b[core.TRAFFIC_INBOUND].SetRate(limits.Inbound*1024, 0) // KB to B
+	b[core.TRAFFIC_OUTBOUND].SetRate(limits.Outbound*1024, 0)
+}
+
+type peerBuckets struct {
+	*buckets
+	lastUsed int64
+}
+
+// Shaper limits the bandwidth of the node, of each peer and of each traffic class with token buckets. The limits
+// change with the schedules of the configuration
+type Shaper struct {
+	mtx       sync.RWMutex
+	schedules []schedule
+	config    setting.BandwidthConfig
+	active    int // index of the schedule applied, -1 for the default limits
+	profile   setting.BandwidthProfile
+	node      *buckets
+	classes   map[string]*buckets
+	peers     *sync.Map // key: peer p2p address, value: *peerBuckets
+	lastCheck int64
+	now       func() time.Time
+}
+
+func NewShaper(config setting.BandwidthConfig) (*Shaper, error) {
+	s := &Shaper{
+		active:  -1,
+		node:    newBuckets(setting.BandwidthLimits{}),
+		classes: make(map[string]*buckets),
+		peers:   &sync.Map{},
+		now:     time.Now,
+	}
+	for _, class := range []string{CLASS_UPLOAD, CLASS_BACKUP, CLASS_VERIFICATION, CLASS_DOWNLOAD, CLASS_STREAMING} {
+		s.classes[class] = newBuckets(setting.BandwidthLimits{})
+	}
+	if err := s.SetConfig(config); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetConfig changes the limits and schedules of the shaper, effective immediately
+func (s *Shaper) SetConfig(config setting.BandwidthConfig) error {
+	schedules, err := parseSchedules(config.Schedules)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	s.config = config
+	s.schedules = schedules
+	s.mtx.Unlock()
+	s.refresh(true)
+	return nil
+}
+
+// GetConfig returns the configuration of the shaper, and the name of the schedule applied. The name is empty when the
+// default limits apply
+func (s *Shaper) GetConfig() (setting.BandwidthConfig, string) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.active < 0 {
+		return s.config, ""
+	}
+	return s.config, s.config.Schedules[s.active].Name
+}
+
+// refresh applies the limits of the schedule matching the current time, and drops the buckets of idle peers
+func (s *Shaper) refresh(force bool) {
+	now := s.now()
+	if force {
+		atomic.StoreInt64(&s.lastCheck, now.UnixNano())
+	} else {
+		last := atomic.LoadInt64(&s.lastCheck)
+		if now.UnixNano()-last < int64(scheduleCheckInterval) || !atomic.CompareAndSwapInt64(&s.lastCheck, last, now.UnixNano()) {
+			return
+		}
+	}
+
+	s.mtx.Lock()
+	active := -1
+	for i, sched := range s.schedules {
+		if sched.matches(now) {
+			active = i
+			break
+		}
+	}
+	changed := force || active != s.active
+	if changed {
+		s.active = active
+		s.profile = s.config.Default
+		if active >= 0 {
+			s.profile = s.config.Schedules[active].Limits
+			utils.Logf("bandwidth schedule [%v] applied", s.config.Schedules[active].Name)
+		}
+		s.node.set(s.profile.Node)
+		s.classes[CLASS_UPLOAD].set(s.profile.Upload)
+		s.classes[CLASS_BACKUP].set(s.profile.Backup)
+		s.classes[CLASS_VERIFICATION].set(s.profile.Verification)
+		s.classes[CLASS_DOWNLOAD].set(s.profile.Download)
+		s.classes[CLASS_STREAMING].set(s.profile.Streaming)
+	}
+	peerLimits := s.profile.Peer
+	s.mtx.Unlock()
+
+	s.peers.Range(func(key, value interface{}) bool {
+		peer := value.(*peerBuckets)
+		if now.Unix()-atomic.LoadInt64(&peer.lastUsed) > int64(peerIdleTimeout.Seconds()) {
+			s.peers.Delete(key)
+		} else if changed {
+			peer.set(peerLimits)
+		}
+		return true
+	})
+}
+
+func (s *Shaper) peerBuckets(peer string) *buckets {
+	now := s.now().Unix()
+	if value, ok := s.peers.Load(peer); ok {
+		pb := value.(*peerBuckets)
+		atomic.StoreInt64(&pb.lastUsed, now)
+		return pb.buckets
+	}
+	s.mtx.RLock()
+	limits := s.profile.Peer
+	s.mtx.RUnlock()
+	value, _ := s.peers.LoadOrStore(peer, &peerBuckets{buckets: newBuckets(limits), lastUsed: now})
+	return value.(*peerBuckets).buckets
+}
+
+// Reserve takes n bytes from the buckets of the node, of the peer and of the class, and returns how long to wait before
+// using them. The peer is ignored when empty
+func (s *Shaper) Reserve(direction int, class, peer string, n int) time.Duration {
+	s.refresh(false)
+	now := s.now()
+	wait := s.node[direction].Reserve(n, now)
+	if peer != "" {
+		if w := s.peerBuckets(peer)[direction].Reserve(n, now); w > wait {
+			wait = w
+		}
+	}
+	if b, ok := s.classes[class]; ok {
+		if w := b[direction].Reserve(n, now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// Wait blocks until n bytes of the class can go through
+func (s *Shaper) Wait(direction int, class, peer string, n int) {
+	if wait := s.Reserve(direction, class, peer, n); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Shape implements core.BandwidthShaper for the messages of the P2P connections
+func (s *Shaper) Shape(direction int, cmd uint8, peer string, n int) {
+	s.Wait(direction, MessageClass(cmd), peer, n)
+}
+
+// WriteShaped writes data in chunks, as fast as the outbound limits of the node and of the class allow
+func (s *Shaper) WriteShaped(w io.Writer, class string, data []byte) (int, error) {
+	written := 0
+	for written < len(data) {
+		end := written + writeChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		s.Wait(core.TRAFFIC_OUTBOUND, class, "", end-written)
+		n, err := w.Write(data[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
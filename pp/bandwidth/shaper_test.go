@@ -0,0 +1,107 @@
+package bandwidth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stratosnet/sds/framework/core"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+func TestScheduleMatches(t *testing.T) {
+	schedules, err := parseSchedules([]setting.BandwidthSchedule{
+		{Name: "office", Days: []string{"Mon", "tuesday"}, Start: "09:00", End: "17:30"},
+		{Name: "night", Days: []string{"fri"}, Start: "22:00", End: "06:00"},
+		{Name: "weekend", Days: []string{"sat", "sun"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2024-01-01 is a Monday
+	day := func(offset, hour, minute int) time.Time {
+		return time.Date(2024, 1, 1+offset, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		sched int
+		now   time.Time
+		want  bool
+	}{
+		{0, day(0, 9, 0), true},
+		{0, day(1, 17, 29), true},
+		{0, day(1, 17, 30), false},
+		{0, day(2, 12, 0), false},
+		{1, day(4, 23, 0), true},
+		{1, day(5, 5, 59), true},
+		{1, day(5, 6, 0), false},
+		{1, day(4, 5, 0), false},
+		{2, day(5, 0, 0), true},
+		{2, day(6, 23, 59), true},
+		{2, day(0, 12, 0), false},
+	}
+	for i, test := range tests {
+		if got := schedules[test.sched].matches(test.now); got != test.want {
+			t.Errorf("test %v: schedule %v at %v: got %v, want %v", i, test.sched, test.now, got, test.want)
+		}
+	}
+
+	for _, invalid := range []setting.BandwidthSchedule{
+		{Name: "day", Days: []string{"someday"}},
+		{Name: "start", Start: "25:00", End: "06:00"},
+		{Name: "end", Start: "01:00", End: "6pm"},
+	} {
+		if _, err = parseSchedules([]setting.BandwidthSchedule{invalid}); err == nil {
+			t.Errorf("schedule %v should be invalid", invalid.Name)
+		}
+	}
+}
+
+func TestShaperReserve(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local) // Monday
+	config := setting.BandwidthConfig{
+		Default: setting.BandwidthProfile{
+			Node:   setting.BandwidthLimits{Outbound: 100},
+			Upload: setting.BandwidthLimits{Outbound: 10},
+		},
+		Schedules: []setting.BandwidthSchedule{
+			{Name: "night", Start: "22:00", End: "06:00", Limits: setting.BandwidthProfile{Peer: setting.BandwidthLimits{Inbound: 1}}},
+		},
+	}
+	s, err := NewShaper(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+	s.refresh(true)
+	if _, active := s.GetConfig(); active != "" {
+		t.Fatalf("no schedule should apply at noon, got %v", active)
+	}
+
+	// The burst is one second of traffic, and the debt delays the next takers
+	if wait := s.Reserve(core.TRAFFIC_OUTBOUND, CLASS_UPLOAD, "peer", 10*1024); wait != 0 {
+		t.Fatalf("the burst should go through, waited %v", wait)
+	}
+	if wait := s.Reserve(core.TRAFFIC_OUTBOUND, CLASS_UPLOAD, "peer", 5*1024); wait != 500*time.Millisecond {
+		t.Fatalf("upload should wait 500ms, waited %v", wait)
+	}
+	if wait := s.Reserve(core.TRAFFIC_OUTBOUND, CLASS_DOWNLOAD, "peer", 50*1024); wait != 0 {
+		t.Fatalf("download has no class limit, waited %v", wait)
+	}
+	if wait := s.Reserve(core.TRAFFIC_OUTBOUND, CLASS_DOWNLOAD, "peer", 50*1024); wait != 150*time.Millisecond {
+		t.Fatalf("the node limit should apply, waited %v", wait)
+	}
+	if wait := s.Reserve(core.TRAFFIC_INBOUND, CLASS_OTHER, "peer", 1<<30); wait != 0 {
+		t.Fatalf("inbound is unlimited, waited %v", wait)
+	}
+
+	now = now.Add(11 * time.Hour)
+	if wait := s.Reserve(core.TRAFFIC_INBOUND, CLASS_OTHER, "peer", 2*1024); wait != time.Second {
+		t.Fatalf("the night peer limit should apply, waited %v", wait)
+	}
+	if _, active := s.GetConfig(); active != "night" {
+		t.Fatalf("the night schedule should apply, got %v", active)
+	}
+	if wait := s.Reserve(core.TRAFFIC_OUTBOUND, CLASS_UPLOAD, "peer", 1<<30); wait != 0 {
+		t.Fatalf("outbound is unlimited at night, waited %v", wait)
+	}
+}
@@ -113,6 +113,6 @@ func NoticeActivatedPP(ctx context.Context, conn core.WriteCloser) {
 	utils.Log("get NoticeActivatedPP", target.Result.State, target.Result.Msg)
 
 	setting.State = msgtypes.PP_ACTIVE
-	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_RSP_ACTIVATED)
+	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_RSP_ACTIVATED, "SP notified the activation of the node")
 	utils.Log("This PP node is now active, waiting for state change to be completed")
 }
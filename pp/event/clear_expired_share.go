@@ -2,6 +2,12 @@ package event
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alex023/clock"
+	"github.com/google/uuid"
 
 	"github.com/stratosnet/sds/framework/core"
 	"github.com/stratosnet/sds/framework/msg/header"
@@ -12,9 +18,105 @@ import (
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
+	"github.com/stratosnet/sds/pp/webhook"
 	"github.com/stratosnet/sds/sds-msg/protos"
+	msgutils "github.com/stratosnet/sds/sds-msg/utils"
+)
+
+const shareExpiryCheckInterval = 10 * time.Minute
+
+// shareExpiryCheck looks for the share links expired in (from, to], through the pages of share links of the wallet
+type shareExpiryCheck struct {
+	from     int64
+	to       int64
+	received uint64
+}
+
+var (
+	shareExpiryClock = clock.NewClock()
+	shareExpiryJob   clock.Job
+
+	// shareExpiryChecks are the share link requests of the expiry check waiting for the SP, by remote req id
+	shareExpiryChecks = &sync.Map{}
+	// lastShareExpiry is the time until which the expired share links were notified
+	lastShareExpiry atomic.Int64
 )
 
+// StartShareExpiryJob notifies the webhooks of each share link of the wallet once it expires
+func StartShareExpiryJob(ctx context.Context) {
+	lastShareExpiry.Store(time.Now().Unix())
+	utils.Log("Starting ShareExpiryJob......")
+	shareExpiryJob, _ = shareExpiryClock.AddJobRepeat(shareExpiryCheckInterval, 0, checkShareExpiry(ctx))
+}
+
+func StopShareExpiryJob() {
+	if shareExpiryJob != nil {
+		utils.Log("Stopping ShareExpiryJob......")
+		shareExpiryJob.Cancel()
+	}
+}
+
+func checkShareExpiry(ctx context.Context) func() {
+	return func() {
+		if setting.WalletAddress == "" || !webhook.Subscribed(webhook.EVENT_SHARE_EXPIRED) {
+			return
+		}
+		// the pages of the previous check that weren't answered are given up, their links are looked for again
+		shareExpiryChecks.Range(func(key, _ any) bool {
+			shareExpiryChecks.Delete(key)
+			return true
+		})
+		reqShareExpiryPage(ctx, &shareExpiryCheck{from: lastShareExpiry.Load(), to: time.Now().Unix()}, 0)
+	}
+}
+
+func reqShareExpiryPage(ctx context.Context, check *shareExpiryCheck, page uint64) {
+	nowSec := time.Now().Unix()
+	wsignMsg := msgutils.ShareLinkWalletSignMessage(setting.WalletAddress, nowSec)
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_SHARE, []byte(wsignMsg))
+	if err != nil {
+		utils.ErrorLog("failed signing the share link request of the expiry check", err)
+		return
+	}
+	reqId := uuid.New().String()
+	shareExpiryChecks.Store(reqId, check)
+	GetAllShareLink(core.RegisterRemoteReqId(ctx, reqId), setting.WalletAddress, page, setting.WalletPublicKey.Bytes(), wsign, nowSec)
+}
+
+// handleShareExpiryPage notifies the share links of a page that expired during the check, and requests the next page.
+// It returns false when the response doesn't belong to an expiry check
+func handleShareExpiryPage(ctx context.Context, target *protos.RspShareLink) bool {
+	value, found := shareExpiryChecks.LoadAndDelete(core.GetRemoteReqId(ctx))
+	if !found {
+		return false
+	}
+	check := value.(*shareExpiryCheck)
+	if target.Result.State != protos.ResultState_RES_SUCCESS {
+		utils.DebugLog("failed listing the share links for the expiry check:", target.Result.Msg)
+		return true
+	}
+
+	for _, info := range target.ShareInfo {
+		if info.ExpTime > check.from && info.ExpTime <= check.to {
+			webhook.Publish(webhook.EVENT_SHARE_EXPIRED, webhook.ShareEvent{
+				ShareId:   info.ShareId,
+				ShareLink: info.ShareLink,
+				FileHash:  info.FileHash,
+				FileName:  info.Name,
+				ExpTime:   info.ExpTime,
+			})
+		}
+	}
+	check.received += uint64(len(target.ShareInfo))
+	if len(target.ShareInfo) > 0 && check.received < target.TotalFileNumber {
+		reqShareExpiryPage(ctx, check, target.PageId+1)
+		return true
+	}
+	lastShareExpiry.Store(check.to)
+	return true
+}
+
 func ClearExpiredShareLinks(ctx context.Context, walletAddr string, walletPubkey, wsign []byte, reqTime int64) {
 	if setting.CheckLogin() {
 		p2pserver.GetP2pServer(ctx).SendMessageToSPServer(ctx, requests.ClearExpiredShareLinksData(
@@ -0,0 +1,33 @@
+package event
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stratosnet/sds/framework/core"
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+func TestHandleShareExpiryPage(t *testing.T) {
+	target := &protos.RspShareLink{
+		Result:          &protos.Result{State: protos.ResultState_RES_SUCCESS},
+		ShareInfo:       []*protos.ShareLinkInfo{{ShareId: "a", ExpTime: 150}},
+		TotalFileNumber: 1,
+	}
+	core.StoreRemoteReqId(1, "other")
+	core.StoreRemoteReqId(2, "check")
+	if handleShareExpiryPage(core.CreateContextWithReqId(context.Background(), 1), target) {
+		t.Fatal("the responses of other requests should be left to the rpc")
+	}
+
+	shareExpiryChecks.Store("check", &shareExpiryCheck{from: 100, to: 200})
+	if !handleShareExpiryPage(core.CreateContextWithReqId(context.Background(), 2), target) {
+		t.Fatal("the response of the expiry check should be handled")
+	}
+	if last := lastShareExpiry.Load(); last != 200 {
+		t.Fatalf("the check should be complete after the last page, last expiry %v", last)
+	}
+	if _, found := shareExpiryChecks.Load("check"); found {
+		t.Fatal("the check should be removed once answered")
+	}
+}
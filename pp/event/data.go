@@ -31,7 +31,7 @@ func reqActivateData(ctx context.Context, amount txclienttypes.Coin, txFee txcli
 		return nil, err
 	}
 	signatureKeys := []*txclienttypes.SignatureKey{
-		{Address: setting.WalletAddress, PrivateKey: setting.WalletPrivateKey.Bytes(), Type: txclienttypes.SignatureSecp256k1},
+		{Address: setting.WalletAddress, Signer: setting.WalletSigner, Type: txclienttypes.SignatureSecp256k1},
 	}
 
 	chainId := setting.Config.Blockchain.ChainId
@@ -63,7 +63,7 @@ func reqUpdateDepositData(ctx context.Context, depositDelta txclienttypes.Coin,
 
 	txMsg := txclienttx.BuildUpdateResourceNodeDepositMsg(networkAddr, ownerAddr, depositDelta)
 	signatureKeys := []*txclienttypes.SignatureKey{
-		{Address: setting.WalletAddress, PrivateKey: setting.WalletPrivateKey.Bytes(), Type: txclienttypes.SignatureSecp256k1},
+		{Address: setting.WalletAddress, Signer: setting.WalletSigner, Type: txclienttypes.SignatureSecp256k1},
 	}
 
 	chainId := setting.Config.Blockchain.ChainId
@@ -94,7 +94,7 @@ func reqDeactivateData(ctx context.Context, txFee txclienttypes.TxFee) (*protos.
 
 	txMsg := txclienttx.BuildRemoveResourceNodeMsg(nodeAddress, ownerAddress)
 	signatureKeys := []*txclienttypes.SignatureKey{
-		{Address: setting.WalletAddress, PrivateKey: setting.WalletPrivateKey.Bytes(), Type: txclienttypes.SignatureSecp256k1},
+		{Address: setting.WalletAddress, Signer: setting.WalletSigner, Type: txclienttypes.SignatureSecp256k1},
 	}
 
 	chainId := setting.Config.Blockchain.ChainId
@@ -127,7 +127,7 @@ func reqPrepayData(ctx context.Context, beneficiary fwtypes.WalletAddress, amoun
 
 	txMsg := txclienttx.BuildPrepayMsg(senderAddress, beneficiary, amount)
 	signatureKeys := []*txclienttypes.SignatureKey{
-		{Address: setting.WalletAddress, PrivateKey: setting.WalletPrivateKey.Bytes(), Type: txclienttypes.SignatureSecp256k1},
+		{Address: setting.WalletAddress, Signer: setting.WalletSigner, Type: txclienttypes.SignatureSecp256k1},
 	}
 
 	chainId := setting.Config.Blockchain.ChainId
@@ -15,7 +15,6 @@ import (
 	"github.com/stratosnet/sds/framework/core"
 	"github.com/stratosnet/sds/framework/crypto"
 	"github.com/stratosnet/sds/framework/crypto/encryption"
-	"github.com/stratosnet/sds/framework/crypto/encryption/hdkey"
 	"github.com/stratosnet/sds/framework/msg/header"
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/pp"
@@ -24,6 +23,7 @@ import (
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
 	"github.com/stratosnet/sds/pp/task"
 	"github.com/stratosnet/sds/sds-msg/protos"
 )
@@ -273,10 +273,31 @@ func splitSendDownloadSliceData(ctx context.Context, target *protos.ReqDownloadS
 		response: rsp,
 	})
 
-	for _, packet := range data {
+	pieceRange := target.PieceRange
+	if rsp.IsEncrypted {
+		// encrypted slices can only be decrypted whole
+		pieceRange = nil
+	}
+	for i, packet := range data {
 		utils.DebugLog("_____________________________")
 		utils.DebugLog(dataStart, dataEnd, offsetStart, offsetEnd)
 
+		if pieceRange != nil && (dataStart >= pieceRange.SliceOffsetEnd || dataStart+uint64(len(packet)) <= pieceRange.SliceOffsetStart) {
+			// only the pieces overlapping the requested range are sent
+			utils.ReleaseBuffer(packet)
+			if dataStart >= pieceRange.SliceOffsetEnd {
+				for _, buffer := range data[i+1:] {
+					utils.ReleaseBuffer(buffer)
+				}
+				return
+			}
+			dataStart += setting.MaxData
+			dataEnd += setting.MaxData
+			offsetStart += setting.MaxData
+			offsetEnd += setting.MaxData
+			continue
+		}
+
 		_, newCtx := prepareSendDownloadSliceData(ctx, rsp, tkSliceUID)
 
 		if dataEnd < sliceLen {
@@ -366,7 +387,7 @@ func RspDownloadSlice(ctx context.Context, conn core.WriteCloser) {
 		utils.DebugLog("SliceOffset", target.SliceInfo.SliceOffset)
 		utils.DebugLog("length", len(target.Data))
 		utils.DebugLog("sliceSize", target.SliceSize)
-		if fInfo.EncryptionTag != "" {
+		if fInfo.EncryptionTag != "" || erasureCodingOf(fInfo) != nil {
 			receiveSliceAndProgressEncrypted(ctx, &target, fInfo, dTask, costTime)
 		} else {
 			receiveSliceAndProgress(ctx, &target, fInfo, dTask, costTime)
@@ -434,9 +455,13 @@ func receiveSliceAndProgressEncrypted(ctx context.Context, target *protos.RspDow
 		}
 	}
 
-	if dataToDecryptSize >= target.SliceSize {
+	if dataToDecryptSize >= target.SliceSize && isErasureShardData(dataToDecrypt) {
+		task.DownloadSliceProgress.Delete(target.TaskId + target.SliceInfo.SliceHash + fInfo.ReqId)
+		task.DownloadEncryptedSlices.Delete(target.SliceInfo.SliceHash + fInfo.ReqId)
+		receivedErasureShard(ctx, target, fInfo, dTask, dataToDecrypt)
+	} else if dataToDecryptSize >= target.SliceSize {
 		// Decrypt slice data and save it to file
-		decryptedData, err := decryptSliceData(dataToDecrypt)
+		decryptedData, err := decryptSliceData(target.FileHash, dataToDecrypt)
 		if err != nil {
 			pp.ErrorLog(ctx, "Couldn't decrypt slice", err)
 			return
@@ -468,11 +493,16 @@ func receivedSlice(ctx context.Context, target *protos.RspDownloadSlice, fInfo *
 	file.SaveDownloadProgress(ctx, target.SliceInfo.SliceHash, fInfo.FileName, target.FileHash, target.SavePath, fInfo.ReqId)
 	task.CleanDownloadTask(ctx, target.FileHash, target.SliceInfo.SliceHash, target.WalletAddress, fInfo.ReqId)
 	task.DownloadProgress(ctx, target.FileHash, fInfo.ReqId, target.SliceSize)
+	setDownloadSliceSuccess(ctx, target.SliceInfo.SliceHash, dTask)
+	metrics.FinishSliceOperation(metrics.SliceDownload, target.TaskId+target.SliceInfo.SliceHash, true)
+	reportReceivedSlice(ctx, target)
+}
 
+// reportReceivedSlice reports a fully received slice to the SP
+func reportReceivedSlice(ctx context.Context, target *protos.RspDownloadSlice) {
 	target.Result = &protos.Result{
 		State: protos.ResultState_RES_SUCCESS,
 	}
-	setDownloadSliceSuccess(ctx, target.SliceInfo.SliceHash, dTask)
 	// get total costTime
 	tkSlice := target.TaskId + target.SliceInfo.SliceHash
 	totalCostTime := DownRecvCostTimeMap.AddCostTime(tkSlice, int64(0))
@@ -508,6 +538,10 @@ func DownloadFileSlices(ctx context.Context, target *protos.RspFileStorageInfo,
 	utils.DebugLog("DownloadFileSlice(&target)", target)
 	fileSize := uint64(0)
 	dTask, _ := task.GetDownloadTask(target.FileHash + target.WalletAddress + reqId)
+	if erasureCoding := erasureCodingOf(target); erasureCoding != nil {
+		downloadErasureFileSlices(ctx, target, reqId, dTask, erasureCoding)
+		return
+	}
 	for _, sliceInfo := range target.SliceInfo {
 		fileSize += sliceInfo.SliceOffset.SliceOffsetEnd - sliceInfo.SliceOffset.SliceOffsetStart
 	}
@@ -557,6 +591,7 @@ func SendReqDownloadSlice(ctx context.Context, fileHash string, sliceInfo *proto
 	networkAddress := sliceInfo.StoragePpInfo.NetworkAddress
 	key := "download#" + fileHash + sliceInfo.StoragePpInfo.P2PAddress + fileReqId
 	metrics.UploadPerformanceLogNow(fileHash + ":SND_REQ_SLICE_DATA:" + strconv.FormatInt(int64(sliceInfo.SliceOffset.SliceOffsetStart+(req.SliceNumber-1)*setting.MaxSliceSize), 10) + ":" + networkAddress)
+	metrics.StartSliceOperation(metrics.SliceDownload, req.RspFileStorageInfo.TaskId+sliceInfo.SliceStorageInfo.SliceHash, sliceInfo.StoragePpInfo.P2PAddress)
 	err := p2pserver.GetP2pServer(ctx).SendMessageByCachedConn(ctx, key, networkAddress, req, header.ReqDownloadSlice, nil)
 	if err != nil {
 		pp.ErrorLogf(ctx, "Failed to create connection with %v: %v", networkAddress, utils.FormatError(err))
@@ -595,7 +630,11 @@ func DownloadSliceCancel(ctx context.Context, fileHash, reqID string) {
 	}
 }
 
-func decryptSliceData(dataToDecrypt []byte) ([]byte, error) {
+func decryptSliceData(fileHash string, dataToDecrypt []byte) ([]byte, error) {
+	if isEnvelopeSliceData(dataToDecrypt) {
+		return decryptEnvelopeSliceData(fileHash, dataToDecrypt)
+	}
+
 	encryptedSlice := protos.EncryptedSlice{}
 	err := proto.Unmarshal(dataToDecrypt, &encryptedSlice)
 	if err != nil {
@@ -603,13 +642,13 @@ func decryptSliceData(dataToDecrypt []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	key, err := hdkey.MasterKeyForSliceEncryption(setting.WalletPrivateKey.Bytes(), encryptedSlice.HdkeyNonce)
+	key, err := setting.WalletSigner.DeriveSecret(signer.SECRET_SLICE_ENCRYPTION, encryptedSlice.HdkeyNonce)
 	if err != nil {
 		utils.ErrorLog("Couldn't generate slice encryption master key", err)
 		return nil, err
 	}
 
-	return encryption.DecryptAES(key.PrivateKey(), encryptedSlice.Data, encryptedSlice.AesNonce, false)
+	return encryption.DecryptAES(key, encryptedSlice.Data, encryptedSlice.AesNonce, false)
 }
 
 func verifyDownloadSliceHash(fileHash string, sliceNumber uint64, slice *protos.DownloadSliceInfo, buffers [][]byte) bool {
@@ -617,13 +656,12 @@ func verifyDownloadSliceHash(fileHash string, sliceNumber uint64, slice *protos.
 	for _, buffer := range buffers {
 		data = append(data, buffer...)
 	}
-	sliceHash, err := crypto.CalcSliceHash(data, fileHash, sliceNumber)
+	valid, err := crypto.VerifySliceHash(data, fileHash, sliceNumber, slice.SliceStorageInfo.SliceHash)
 	if err != nil {
 		utils.ErrorLog(err)
 		return false
 	}
-
-	return slice.SliceStorageInfo.SliceHash == sliceHash
+	return valid
 }
 
 func setDownloadSliceSuccess(ctx context.Context, sliceHash string, dTask *task.DownloadTask) {
@@ -631,6 +669,10 @@ func setDownloadSliceSuccess(ctx context.Context, sliceHash string, dTask *task.
 }
 
 func setDownloadSliceFail(ctx context.Context, sliceHash, taskId, fileReqId string, dTask *task.DownloadTask) {
+	metrics.FinishSliceOperation(metrics.SliceDownload, taskId+sliceHash, false)
+	if requestSpareErasureShard(ctx, dTask, sliceHash, fileReqId) {
+		return
+	}
 	dTask.AddFailedSlice(sliceHash)
 	CheckAndSendRetryMessage(ctx, dTask)
 }
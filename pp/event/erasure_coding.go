@@ -0,0 +1,567 @@
+package event
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/core"
+	"github.com/stratosnet/sds/framework/crypto"
+	"github.com/stratosnet/sds/framework/msg/header"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/framework/utils/erasure"
+	"github.com/stratosnet/sds/pp"
+	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/pp/p2pserver"
+	"github.com/stratosnet/sds/pp/requests"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/task"
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+const (
+	erasureHashTagPrefix   = "ec"
+	erasureShardHeaderSize = 40 // magic (4) + flags (1) + data shards (1) + parity shards (1) + index (1) + slice number (8) + offset start (8) + offset end (8) + encoded size (8)
+	erasureFlagEncrypted   = 1
+	maxErasureShards       = 32
+)
+
+// erasureShardMagic prefixes the shards of erasure coded slices. It starts with a zero byte, which is never a valid protobuf tag
+var erasureShardMagic = []byte{0, 'S', 'R', 'S'}
+
+// erasureUploads keeps the layout of the erasure coded files being uploaded, indexed by file hash
+var erasureUploads = utils.NewAutoCleanMap(time.Hour)
+
+// ErasureCoding is the Reed-Solomon layout of a file. Each slice is encoded into DataShards data shards and ParityShards
+// parity shards, and each shard is uploaded as a slice of its own. Any DataShards shards of a slice are enough to rebuild it
+type ErasureCoding struct {
+	DataShards   int
+	ParityShards int
+}
+
+// ParseErasureCoding parses a layout written as "<data shards>+<parity shards>", eg: "4+2"
+func ParseErasureCoding(layout string) (*ErasureCoding, error) {
+	parts := strings.Split(layout, "+")
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid erasure coding layout [%v], expecting <data shards>+<parity shards>", layout)
+	}
+	dataShards, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid number of data shards")
+	}
+	parityShards, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid number of parity shards")
+	}
+	if dataShards < 1 || parityShards < 1 || dataShards+parityShards > maxErasureShards {
+		return nil, errors.Errorf("an erasure coding layout needs at least 1 data and 1 parity shard, and at most %v shards in total", maxErasureShards)
+	}
+	return &ErasureCoding{DataShards: dataShards, ParityShards: parityShards}, nil
+}
+
+func (e *ErasureCoding) String() string {
+	return fmt.Sprintf("%v+%v", e.DataShards, e.ParityShards)
+}
+
+func (e *ErasureCoding) totalShards() int {
+	return e.DataShards + e.ParityShards
+}
+
+// hashTag is hashed with the file content instead of the encryption tag, so that the same file gets another file hash
+// when it is erasure coded. The layout itself is sent to the SP in the FileInfo
+func (e *ErasureCoding) hashTag(encryptionTag string) string {
+	if e == nil {
+		return encryptionTag
+	}
+	return erasureHashTagPrefix + e.String() + ":" + encryptionTag
+}
+
+// erasureCodingOf returns the layout the SP stored for a file, or nil if the file is replicated
+func erasureCodingOf(fInfo *protos.RspFileStorageInfo) *ErasureCoding {
+	if fInfo.ErasureDataShards == 0 {
+		return nil
+	}
+	return &ErasureCoding{DataShards: int(fInfo.ErasureDataShards), ParityShards: int(fInfo.ErasureParityShards)}
+}
+
+// checkErasureCodingSupported rejects an erasure coded upload when the SP is older than setting.ErasureCodingMinSpVersion.
+// Such an SP ignores the layout in the FileInfo, and would replicate every shard like a slice
+func checkErasureCodingSupported(ctx context.Context, fileHash string) error {
+	value, ok := erasureUploads.Load(fileHash)
+	if !ok {
+		return nil
+	}
+	spVersion := core.MessageFromContext(ctx).MSGHead.Version
+	if spVersion < setting.ErasureCodingMinSpVersion {
+		return errors.Errorf("the SP (version %v) doesn't support %v erasure coded uploads, version %v is required",
+			spVersion, value.(*ErasureCoding), setting.ErasureCodingMinSpVersion)
+	}
+	return nil
+}
+
+// shardNumber returns the number of the slice holding a shard
+func (e *ErasureCoding) shardNumber(sliceNumber uint64, index int) uint64 {
+	return (sliceNumber-1)*uint64(e.totalShards()) + uint64(index) + 1
+}
+
+// shardPosition returns the number of the original slice, and the index of the shard in it
+func (e *ErasureCoding) shardPosition(shardNumber uint64) (uint64, int) {
+	total := uint64(e.totalShards())
+	return (shardNumber-1)/total + 1, int((shardNumber - 1) % total)
+}
+
+type erasureShard struct {
+	encrypted    bool
+	dataShards   int
+	parityShards int
+	index        int
+	sliceNumber  uint64
+	offset       *protos.SliceOffset // position of the original slice in the file
+	encodedSize  uint64              // size of the data that was encoded, before the padding
+	data         []byte
+}
+
+func (s *erasureShard) bytes() []byte {
+	data := make([]byte, 0, erasureShardHeaderSize+len(s.data))
+	data = append(data, erasureShardMagic...)
+	flags := byte(0)
+	if s.encrypted {
+		flags |= erasureFlagEncrypted
+	}
+	data = append(data, flags, byte(s.dataShards), byte(s.parityShards), byte(s.index))
+	data = binary.BigEndian.AppendUint64(data, s.sliceNumber)
+	data = binary.BigEndian.AppendUint64(data, s.offset.SliceOffsetStart)
+	data = binary.BigEndian.AppendUint64(data, s.offset.SliceOffsetEnd)
+	data = binary.BigEndian.AppendUint64(data, s.encodedSize)
+	return append(data, s.data...)
+}
+
+func isErasureShardData(data []byte) bool {
+	return len(data) >= erasureShardHeaderSize && string(data[:len(erasureShardMagic)]) == string(erasureShardMagic)
+}
+
+// parseErasureShard parses the header of a shard. The shard data is copied, so the buffer can be released
+func parseErasureShard(data []byte) (*erasureShard, error) {
+	if !isErasureShardData(data) {
+		return nil, errors.New("not an erasure coded shard")
+	}
+	pos := len(erasureShardMagic)
+	shard := &erasureShard{
+		encrypted:    data[pos]&erasureFlagEncrypted != 0,
+		dataShards:   int(data[pos+1]),
+		parityShards: int(data[pos+2]),
+		index:        int(data[pos+3]),
+	}
+	pos += 4
+	shard.sliceNumber = binary.BigEndian.Uint64(data[pos:])
+	shard.offset = &protos.SliceOffset{
+		SliceOffsetStart: binary.BigEndian.Uint64(data[pos+8:]),
+		SliceOffsetEnd:   binary.BigEndian.Uint64(data[pos+16:]),
+	}
+	shard.encodedSize = binary.BigEndian.Uint64(data[pos+24:])
+	shard.data = append([]byte{}, data[erasureShardHeaderSize:]...)
+
+	if shard.dataShards < 1 || shard.parityShards < 1 || shard.index >= shard.dataShards+shard.parityShards {
+		return nil, errors.New("invalid erasure coding layout in shard header")
+	}
+	return shard, nil
+}
+
+// sliceShards encodes the data of one slice, saves its shards as tmp slices, and returns them in upload order
+func (e *ErasureCoding) sliceShards(fileHash string, sliceNumber uint64, offset *protos.SliceOffset, data []byte, encrypted bool) ([]*protos.SliceHashAddr, error) {
+	encoder, err := erasure.New(e.DataShards, e.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	shards := encoder.Split(data)
+	if err = encoder.Encode(shards); err != nil {
+		return nil, errors.Wrap(err, "failed to compute parity shards")
+	}
+
+	var slices []*protos.SliceHashAddr
+	for index, shardData := range shards {
+		shard := &erasureShard{
+			encrypted:    encrypted,
+			dataShards:   e.DataShards,
+			parityShards: e.ParityShards,
+			index:        index,
+			sliceNumber:  sliceNumber,
+			offset:       offset,
+			encodedSize:  uint64(len(data)),
+			data:         shardData,
+		}
+		shardBytes := shard.bytes()
+		shardNumber := e.shardNumber(sliceNumber, index)
+		sliceHash, err := crypto.CalcSliceHash(shardBytes, fileHash, shardNumber)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to calc slice hash")
+		}
+		if err = file.SaveTmpSliceData(fileHash, sliceHash, shardBytes); err != nil {
+			return nil, errors.Wrap(err, "failed to save to temp file")
+		}
+
+		slices = append(slices, &protos.SliceHashAddr{
+			SliceHash:   sliceHash,
+			SliceSize:   uint64(len(shardBytes)),
+			SliceNumber: shardNumber,
+			SliceOffset: e.shardOffset(offset, index),
+		})
+	}
+	return slices, nil
+}
+
+// shardOffset returns the part of the original slice range assigned to a shard, so that the offsets of the shards
+// partition the file: each data shard covers its share of the range, and the parity shards an empty range at its end.
+// The position used to rebuild the slice is in the shard header
+func (e *ErasureCoding) shardOffset(offset *protos.SliceOffset, index int) *protos.SliceOffset {
+	sliceLength := offset.SliceOffsetEnd - offset.SliceOffsetStart
+	partLength := (sliceLength + uint64(e.DataShards) - 1) / uint64(e.DataShards)
+	position := func(part int) uint64 {
+		if uint64(part)*partLength > sliceLength {
+			return offset.SliceOffsetEnd
+		}
+		return offset.SliceOffsetStart + uint64(part)*partLength
+	}
+	return &protos.SliceOffset{SliceOffsetStart: position(index), SliceOffsetEnd: position(index + 1)}
+}
+
+// collocatedShards returns the shards to move so that each PP holds at most one shard of a slice, and whether a PP holds
+// more shards of a slice than there are parity shards, in which case the slice can't be rebuilt without that PP
+func (e *ErasureCoding) collocatedShards(slices []*protos.SliceHashAddr) ([]uint64, bool) {
+	sort.Slice(slices, func(i, j int) bool { return slices[i].SliceNumber < slices[j].SliceNumber })
+	shardsPerPp := make(map[string]int)
+	var collocated []uint64
+	unrecoverable := false
+	for _, slice := range slices {
+		if slice.PpInfo == nil {
+			continue
+		}
+		sliceNumber, _ := e.shardPosition(slice.SliceNumber)
+		key := strconv.FormatUint(sliceNumber, 10) + "#" + slice.PpInfo.P2PAddress
+		shardsPerPp[key]++
+		if shardsPerPp[key] > 1 {
+			collocated = append(collocated, slice.SliceNumber)
+		}
+		if shardsPerPp[key] > e.ParityShards {
+			unrecoverable = true
+		}
+	}
+	return collocated, unrecoverable
+}
+
+// requestDistinctErasureDestinations asks the SP for new destinations when shards of a slice were assigned to the same PP.
+// Once the retries are exhausted, the upload is rejected if a slice can't survive the loss of one PP
+func requestDistinctErasureDestinations(ctx context.Context, fileHash string, uploadTask *task.UploadFileTask) error {
+	value, ok := erasureUploads.Load(fileHash)
+	if !ok {
+		return nil
+	}
+	erasureCoding := value.(*ErasureCoding)
+
+	collocated, unrecoverable := erasureCoding.collocatedShards(uploadTask.SliceDestinations())
+	if len(collocated) == 0 {
+		return nil
+	}
+	if !uploadTask.CanRetry() {
+		if unrecoverable {
+			return errors.Errorf("the SP assigned more than %v shards of a slice to the same PP", erasureCoding.ParityShards)
+		}
+		pp.Logf(ctx, "Warning: %v shards of file %v share a PP with another shard of their slice", len(collocated), fileHash)
+		return nil
+	}
+
+	slicesToReUpload, failedSlices := uploadTask.ReassignSlices(collocated)
+	if len(slicesToReUpload) == 0 {
+		return nil
+	}
+	pp.DebugLogf(ctx, "%v shards of file %v share a PP with another shard of their slice, requesting new destinations", len(slicesToReUpload), fileHash)
+	p2pserver.GetP2pServer(ctx).SendMessageToSPServer(ctx, requests.ReqUploadSlicesWrong(ctx, uploadTask, slicesToReUpload, failedSlices), header.ReqUploadSlicesWrong)
+	return nil
+}
+
+// erasureGroup gathers the shards of one slice while they are downloaded
+type erasureGroup struct {
+	mtx       sync.Mutex
+	slices    []*protos.DownloadSliceInfo // indexed by shard index. nil if the SP didn't return the shard
+	shards    [][]byte
+	requested []bool
+	received  int
+	rebuilt   bool
+}
+
+func erasureGroupKey(fileHash, fileReqId string, sliceNumber uint64) string {
+	return fileHash + fileReqId + "#" + strconv.FormatUint(sliceNumber, 10)
+}
+
+func newErasureGroup(erasureCoding *ErasureCoding, fInfo *protos.RspFileStorageInfo, sliceNumber uint64) *erasureGroup {
+	group := &erasureGroup{
+		slices:    make([]*protos.DownloadSliceInfo, erasureCoding.totalShards()),
+		shards:    make([][]byte, erasureCoding.totalShards()),
+		requested: make([]bool, erasureCoding.totalShards()),
+	}
+	for _, slice := range fInfo.SliceInfo {
+		if number, index := erasureCoding.shardPosition(slice.SliceNumber); number == sliceNumber {
+			group.slices[index] = slice
+		}
+	}
+	return group
+}
+
+func loadErasureGroup(erasureCoding *ErasureCoding, fInfo *protos.RspFileStorageInfo, sliceNumber uint64) *erasureGroup {
+	value, _ := task.DownloadErasureGroups.LoadOrStore(erasureGroupKey(fInfo.FileHash, fInfo.ReqId, sliceNumber),
+		newErasureGroup(erasureCoding, fInfo, sliceNumber))
+	return value.(*erasureGroup)
+}
+
+// requestNextShard requests a shard of the group that wasn't requested yet. It returns false when all the shards were requested
+func (g *erasureGroup) requestNextShard(ctx context.Context, fInfo *protos.RspFileStorageInfo, fileReqId string) bool {
+	g.mtx.Lock()
+	var next *protos.DownloadSliceInfo
+	for index, slice := range g.slices {
+		if slice != nil && !g.requested[index] {
+			g.requested[index] = true
+			next = slice
+			break
+		}
+	}
+	g.mtx.Unlock()
+
+	if next == nil {
+		return false
+	}
+	req := requests.ReqDownloadSliceData(ctx, fInfo, next)
+	newCtx := createAndRegisterSliceReqId(ctx, fileReqId)
+	SendReqDownloadSlice(newCtx, fInfo.FileHash, next, req, fileReqId)
+	return true
+}
+
+// downloadErasureFileSlices requests DataShards shards of each slice. The other shards are only requested if one of them fails
+func downloadErasureFileSlices(ctx context.Context, target *protos.RspFileStorageInfo, reqId string, dTask *task.DownloadTask, erasureCoding *ErasureCoding) {
+	if file.CheckFileExisting(ctx, target.FileHash, target.FileName, target.SavePath, erasureCoding.hashTag(target.EncryptionTag), reqId) {
+		task.DownloadResult(ctx, target.FileHash, false, "file exists already.")
+		task.DeleteDownloadTask(target.FileHash, target.WalletAddress, target.ReqId)
+		for _, slice := range target.SliceInfo {
+			SendReportDownloadResultForLocallyFoundSlice(ctx, target, slice, false)
+		}
+		return
+	}
+
+	// The offsets of the shards of a slice partition the range of the original slice
+	sliceRanges := make(map[uint64]*protos.SliceOffset)
+	for _, slice := range target.SliceInfo {
+		sliceNumber, _ := erasureCoding.shardPosition(slice.SliceNumber)
+		sliceRange, ok := sliceRanges[sliceNumber]
+		if !ok {
+			sliceRanges[sliceNumber] = &protos.SliceOffset{SliceOffsetStart: slice.SliceOffset.SliceOffsetStart, SliceOffsetEnd: slice.SliceOffset.SliceOffsetEnd}
+			continue
+		}
+		if slice.SliceOffset.SliceOffsetStart < sliceRange.SliceOffsetStart {
+			sliceRange.SliceOffsetStart = slice.SliceOffset.SliceOffsetStart
+		}
+		if slice.SliceOffset.SliceOffsetEnd > sliceRange.SliceOffsetEnd {
+			sliceRange.SliceOffsetEnd = slice.SliceOffset.SliceOffsetEnd
+		}
+	}
+	sliceNumbers := make([]uint64, 0, len(sliceRanges))
+	for sliceNumber := range sliceRanges {
+		sliceNumbers = append(sliceNumbers, sliceNumber)
+	}
+	sort.Slice(sliceNumbers, func(i, j int) bool { return sliceNumbers[i] < sliceNumbers[j] })
+
+	pp.Log(ctx, "download starts: ")
+	task.DownloadSpeedOfProgress.Store(target.FileHash+reqId, &task.DownloadSP{
+		RawSize:   int64(target.FileSize),
+		TotalSize: int64(target.FileSize),
+	})
+	for _, sliceNumber := range sliceNumbers {
+		group := loadErasureGroup(erasureCoding, target, sliceNumber)
+		if !group.downloadedBefore(target, reqId) {
+			for shard := 0; shard < erasureCoding.DataShards; shard++ {
+				group.requestNextShard(ctx, target, reqId)
+			}
+			continue
+		}
+
+		// The slice was rebuilt by a previous download of this file
+		group.mtx.Lock()
+		group.rebuilt = true
+		group.mtx.Unlock()
+		for _, slice := range group.slices {
+			if slice == nil {
+				continue
+			}
+			task.CleanDownloadTask(ctx, target.FileHash, slice.SliceStorageInfo.SliceHash, target.WalletAddress, reqId)
+			setDownloadSliceSuccess(ctx, slice.SliceStorageInfo.SliceHash, dTask)
+			SendReportDownloadResultForLocallyFoundSlice(ctx, target, slice, false)
+		}
+		sliceRange := sliceRanges[sliceNumber]
+		task.DownloadProgress(ctx, target.FileHash, reqId, sliceRange.SliceOffsetEnd-sliceRange.SliceOffsetStart)
+	}
+}
+
+func (g *erasureGroup) downloadedBefore(fInfo *protos.RspFileStorageInfo, reqId string) bool {
+	for _, slice := range g.slices {
+		if slice != nil && !file.CheckSliceExisting(fInfo.FileHash, fInfo.FileName, slice.SliceStorageInfo.SliceHash, reqId) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestSpareErasureShard replaces a failed shard by another shard of the same slice.
+// It returns false if the file is not erasure coded, or if there is no shard left to try
+func requestSpareErasureShard(ctx context.Context, dTask *task.DownloadTask, sliceHash, fileReqId string) bool {
+	f, ok := task.DownloadFileMap.Load(dTask.FileHash + fileReqId)
+	if !ok {
+		return false
+	}
+	fInfo := f.(*protos.RspFileStorageInfo)
+	erasureCoding := erasureCodingOf(fInfo)
+	if erasureCoding == nil {
+		return false
+	}
+
+	for _, slice := range fInfo.SliceInfo {
+		if slice.SliceStorageInfo.SliceHash != sliceHash {
+			continue
+		}
+		sliceNumber, _ := erasureCoding.shardPosition(slice.SliceNumber)
+		group := loadErasureGroup(erasureCoding, fInfo, sliceNumber)
+		group.mtx.Lock()
+		rebuilt := group.rebuilt
+		group.mtx.Unlock()
+		if rebuilt {
+			return true
+		}
+		if group.requestNextShard(ctx, fInfo, fileReqId) {
+			pp.DebugLogf(ctx, "shard %v of slice %v failed, requesting another shard", sliceHash, sliceNumber)
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// receivedErasureShard stores a downloaded shard, and rebuilds the original slice once enough shards were received
+func receivedErasureShard(ctx context.Context, target *protos.RspDownloadSlice, fInfo *protos.RspFileStorageInfo, dTask *task.DownloadTask, data []byte) {
+	shard, err := parseErasureShard(data)
+	if err != nil {
+		pp.ErrorLog(ctx, "Couldn't parse erasure coded shard", err)
+		return
+	}
+	erasureCoding := erasureCodingOf(fInfo)
+	if err = checkErasureShard(erasureCoding, fInfo, target.SliceInfo.SliceHash, shard); err != nil {
+		pp.ErrorLog(ctx, "Rejected erasure coded shard", err)
+		return
+	}
+	group := loadErasureGroup(erasureCoding, fInfo, shard.sliceNumber)
+
+	group.mtx.Lock()
+	if group.rebuilt || len(group.shards[shard.index]) != 0 {
+		group.mtx.Unlock()
+		return
+	}
+	group.shards[shard.index] = shard.data
+	group.requested[shard.index] = true
+	group.received++
+	var sliceData []byte
+	if group.received >= shard.dataShards {
+		sliceData, err = rebuildErasureSlice(erasureCoding, group.shards, shard.encodedSize)
+		if err == nil {
+			group.rebuilt = true
+			group.shards = nil
+		}
+	}
+	group.mtx.Unlock()
+
+	reportReceivedSlice(ctx, target)
+	if err != nil {
+		pp.ErrorLog(ctx, "Couldn't rebuild slice from its shards", err)
+		return
+	}
+	if sliceData == nil {
+		return
+	}
+
+	if shard.encrypted {
+		sliceData, err = decryptSliceData(target.FileHash, sliceData)
+		if err != nil {
+			pp.ErrorLog(ctx, "Couldn't decrypt slice", err)
+			return
+		}
+	}
+	err = file.SaveDownloadedFileData(sliceData, int64(shard.offset.SliceOffsetStart), target.SliceInfo.SliceHash, fInfo.FileName, target.FileHash, fInfo.SavePath, fInfo.ReqId)
+	if err != nil {
+		pp.ErrorLog(ctx, "Failed saving download file", err.Error())
+		return
+	}
+	pp.DebugLogf(ctx, "slice %v rebuilt from %v shards", shard.sliceNumber, shard.dataShards)
+
+	// The shards that were not needed are marked as downloaded too, so that resuming the download skips this slice
+	for _, slice := range group.slices {
+		if slice == nil {
+			continue
+		}
+		file.SaveDownloadProgress(ctx, slice.SliceStorageInfo.SliceHash, fInfo.FileName, target.FileHash, target.SavePath, fInfo.ReqId)
+		task.CleanDownloadTask(ctx, target.FileHash, slice.SliceStorageInfo.SliceHash, target.WalletAddress, fInfo.ReqId)
+		setDownloadSliceSuccess(ctx, slice.SliceStorageInfo.SliceHash, dTask)
+	}
+	task.DownloadProgress(ctx, target.FileHash, fInfo.ReqId, shard.offset.SliceOffsetEnd-shard.offset.SliceOffsetStart)
+}
+
+// checkErasureShard checks that the header of a shard matches the layout of the file, and the position of the slice it
+// was requested as. The header is only trusted to rebuild the slice once it agrees with the file storage info
+func checkErasureShard(erasureCoding *ErasureCoding, fInfo *protos.RspFileStorageInfo, sliceHash string, shard *erasureShard) error {
+	if erasureCoding == nil {
+		return errors.New("the file is not erasure coded")
+	}
+	if shard.dataShards != erasureCoding.DataShards || shard.parityShards != erasureCoding.ParityShards {
+		return errors.Errorf("shard layout %v+%v doesn't match the %v layout of the file", shard.dataShards, shard.parityShards, erasureCoding)
+	}
+	var slice *protos.DownloadSliceInfo
+	for _, info := range fInfo.SliceInfo {
+		if info.SliceStorageInfo.SliceHash == sliceHash {
+			slice = info
+			break
+		}
+	}
+	if slice == nil {
+		return errors.Errorf("slice %v is not part of the file", sliceHash)
+	}
+	sliceNumber, index := erasureCoding.shardPosition(slice.SliceNumber)
+	if shard.sliceNumber != sliceNumber || shard.index != index {
+		return errors.Errorf("shard header describes shard %v of slice %v instead of shard %v of slice %v", shard.index, shard.sliceNumber, index, sliceNumber)
+	}
+	if shard.encrypted != (fInfo.EncryptionTag != "") {
+		return errors.New("shard encryption doesn't match the file")
+	}
+	if shard.offset.SliceOffsetStart > shard.offset.SliceOffsetEnd || shard.offset.SliceOffsetEnd > fInfo.FileSize {
+		return errors.Errorf("shard offset %v-%v is outside of the file", shard.offset.SliceOffsetStart, shard.offset.SliceOffsetEnd)
+	}
+	if shard.encodedSize > uint64(len(shard.data))*uint64(shard.dataShards) {
+		return errors.Errorf("encoded size %v doesn't fit in %v shards of %v bytes", shard.encodedSize, shard.dataShards, len(shard.data))
+	}
+	return nil
+}
+
+func rebuildErasureSlice(erasureCoding *ErasureCoding, shards [][]byte, encodedSize uint64) ([]byte, error) {
+	encoder, err := erasure.New(erasureCoding.DataShards, erasureCoding.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	if encodedSize > math.MaxInt32 {
+		return nil, errors.New("invalid encoded size in shard header")
+	}
+	if err = encoder.Reconstruct(shards); err != nil {
+		return nil, err
+	}
+	return encoder.Join(shards, int(encodedSize))
+}
@@ -0,0 +1,106 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+func TestCollocatedShards(t *testing.T) {
+	erasureCoding := &ErasureCoding{DataShards: 2, ParityShards: 2}
+	shard := func(sliceNumber uint64, index int, p2pAddress string) *protos.SliceHashAddr {
+		return &protos.SliceHashAddr{
+			SliceNumber: erasureCoding.shardNumber(sliceNumber, index),
+			PpInfo:      &protos.PPBaseInfo{P2PAddress: p2pAddress},
+		}
+	}
+
+	collocated, unrecoverable := erasureCoding.collocatedShards([]*protos.SliceHashAddr{
+		shard(1, 0, "pp1"), shard(1, 1, "pp2"), shard(1, 2, "pp3"), shard(1, 3, "pp4"),
+		shard(2, 0, "pp1"), shard(2, 1, "pp2"), shard(2, 2, "pp1"), shard(2, 3, "pp3"),
+	})
+	if len(collocated) != 1 || collocated[0] != erasureCoding.shardNumber(2, 2) {
+		t.Fatalf("only the second shard of slice 2 on pp1 should be moved, got %v", collocated)
+	}
+	if unrecoverable {
+		t.Fatal("two parity shards cover the loss of 2 shards on the same PP")
+	}
+
+	collocated, unrecoverable = erasureCoding.collocatedShards([]*protos.SliceHashAddr{
+		shard(1, 3, "pp2"), shard(1, 2, "pp1"), shard(1, 1, "pp1"), shard(1, 0, "pp1"),
+	})
+	if len(collocated) != 2 {
+		t.Fatalf("all the shards but one should be moved, got %v", collocated)
+	}
+	if !unrecoverable {
+		t.Fatal("a slice with 3 shards on one PP can't survive its loss")
+	}
+}
+
+func TestShardOffsetsPartitionFile(t *testing.T) {
+	erasureCoding := &ErasureCoding{DataShards: 4, ParityShards: 2}
+	sliceOffsets := []*protos.SliceOffset{
+		{SliceOffsetStart: 0, SliceOffsetEnd: 10},
+		{SliceOffsetStart: 10, SliceOffsetEnd: 13},
+		{SliceOffsetStart: 13, SliceOffsetEnd: 13},
+	}
+	next := uint64(0)
+	for _, sliceOffset := range sliceOffsets {
+		for index := 0; index < erasureCoding.totalShards(); index++ {
+			offset := erasureCoding.shardOffset(sliceOffset, index)
+			if offset.SliceOffsetStart != next || offset.SliceOffsetEnd < offset.SliceOffsetStart {
+				t.Fatalf("shard %v of slice %v covers %v-%v, expected to start at %v", index, sliceOffset, offset.SliceOffsetStart, offset.SliceOffsetEnd, next)
+			}
+			next = offset.SliceOffsetEnd
+		}
+	}
+	if next != 13 {
+		t.Fatalf("the shards should cover the whole file, they stop at %v", next)
+	}
+}
+
+func TestCheckErasureShard(t *testing.T) {
+	erasureCoding := &ErasureCoding{DataShards: 2, ParityShards: 1}
+	fInfo := &protos.RspFileStorageInfo{
+		FileSize:            100,
+		ErasureDataShards:   2,
+		ErasureParityShards: 1,
+		SliceInfo: []*protos.DownloadSliceInfo{{
+			SliceStorageInfo: &protos.SliceStorageInfo{SliceHash: "shard"},
+			SliceNumber:      erasureCoding.shardNumber(2, 1),
+		}},
+	}
+	validShard := func() *erasureShard {
+		return &erasureShard{
+			dataShards:   2,
+			parityShards: 1,
+			index:        1,
+			sliceNumber:  2,
+			offset:       &protos.SliceOffset{SliceOffsetStart: 50, SliceOffsetEnd: 100},
+			encodedSize:  50,
+			data:         make([]byte, 25),
+		}
+	}
+	if err := checkErasureShard(erasureCodingOf(fInfo), fInfo, "shard", validShard()); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string]func(shard *erasureShard){
+		"layout":       func(shard *erasureShard) { shard.parityShards = 30 },
+		"index":        func(shard *erasureShard) { shard.index = 0 },
+		"slice number": func(shard *erasureShard) { shard.sliceNumber = 1 },
+		"encryption":   func(shard *erasureShard) { shard.encrypted = true },
+		"offset":       func(shard *erasureShard) { shard.offset.SliceOffsetEnd = 200 },
+		"encoded size": func(shard *erasureShard) { shard.encodedSize = 51 },
+	}
+	for name, corrupt := range invalid {
+		shard := validShard()
+		corrupt(shard)
+		if err := checkErasureShard(erasureCodingOf(fInfo), fInfo, "shard", shard); err == nil {
+			t.Fatalf("a shard with a mismatched %v should be rejected", name)
+		}
+	}
+	if err := checkErasureShard(erasureCodingOf(fInfo), fInfo, "other", validShard()); err == nil {
+		t.Fatal("a shard that is not part of the file should be rejected")
+	}
+}
@@ -3,9 +3,12 @@ package event
 // client pp event handler
 import (
 	"context"
+	"runtime/debug"
 
 	"github.com/stratosnet/sds/framework/core"
 	"github.com/stratosnet/sds/framework/msg/header"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/metrics"
 )
 
 type VerifierFunc func(context.Context, header.MsgType, interface{}) error
@@ -15,9 +18,22 @@ var (
 )
 
 func registerEvent(msgType header.MsgType, hf core.HandlerFunc, vf VerifierFunc) {
-	core.Register(msgType, hf)
+	core.Register(msgType, recoverHandler(msgType, hf))
 	verifierMap[msgType.Id] = vf
 }
+
+// recoverHandler keeps a panicking handler from taking down the worker running it
+func recoverHandler(msgType header.MsgType, hf core.HandlerFunc) core.HandlerFunc {
+	return func(ctx context.Context, conn core.WriteCloser) {
+		defer func() {
+			if r := recover(); r != nil {
+				metrics.HandlerPanics.WithLabelValues(msgType.Name).Inc()
+				utils.ErrorLogf("panic in the handler of %v: %v\n%s", msgType.Name, r, debug.Stack())
+			}
+		}()
+		hf(ctx, conn)
+	}
+}
 func VerifyMessage(ctx context.Context, msgType header.MsgType, target interface{}) error {
 	verifier := verifierMap[msgType.Id]
 	if verifier == nil {
@@ -63,6 +79,8 @@ func RegisterAllEventHandlers() {
 	registerEvent(header.RspSpLatencyCheck, RspSpLatencyCheck, SpRspVerifier)
 	registerEvent(header.RspDeleteFile, RspDeleteFile, SpRspVerifier)
 	registerEvent(header.RspClearExpiredShareLinks, RspClearExpiredShareLinks, SpRspVerifier)
+	registerEvent(header.RspReportCorruptedSlice, RspReportCorruptedSlice, SpRspVerifier)
+	registerEvent(header.RspGetSliceOrigin, RspGetSliceOrigin, SpRspVerifier)
 
 	// not_pp---sp--(*rsp*)--pp
 	registerEvent(header.NoticeActivatedPP, NoticeActivatedPP, SpAddressVerifier)
@@ -0,0 +1,298 @@
+package event
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	fwed25519 "github.com/stratosnet/sds/framework/crypto/ed25519"
+	"github.com/stratosnet/sds/framework/crypto/encryption"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+// envelopeKeyIdSize is the size of the reference to the data key of the file, stored in each slice
+const envelopeKeyIdSize = 16
+
+// envelopeOwnerWrapSize is the size of the data key wrapped for the owner wallet, stored in each slice: nonce (8) + data key (32) + tag (16)
+const envelopeOwnerWrapSize = 8 + 32 + 16
+
+// envelopeSliceMagic prefixes the slices encrypted with an envelope. A marshalled EncryptedSlice never starts with it
+var envelopeSliceMagic = []byte("SENV")
+
+// FileEncryption describes how the slices of a file are encrypted before being uploaded
+type FileEncryption struct {
+	Tag       string
+	dataKey   []byte
+	ownerWrap []byte
+	envelope  *encryption.Envelope
+}
+
+// NewWalletEncryption encrypts the slices with keys derived from the wallet of this node. Only this wallet can decrypt the file
+func NewWalletEncryption() *FileEncryption {
+	return &FileEncryption{Tag: utils.GetRandomString(8)}
+}
+
+// NewEnvelopeEncryption encrypts the slices with a random data key, wrapped for the file encryption key of this node
+// and for each of the given ed25519 public keys
+func NewEnvelopeEncryption(recipientPubKeys [][]byte) (*FileEncryption, error) {
+	dataKey, err := encryption.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	ownPubKey, err := FileEncryptionPubKey()
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := encryption.SealEnvelope(dataKey, append([][]byte{ownPubKey}, recipientPubKeys...)...)
+	if err != nil {
+		return nil, err
+	}
+	ownerWrap, err := wrapOwnerDataKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &FileEncryption{
+		Tag:       utils.GetRandomString(8),
+		dataKey:   dataKey,
+		ownerWrap: ownerWrap,
+		envelope:  envelope,
+	}, nil
+}
+
+func (e *FileEncryption) tag() string {
+	if e == nil {
+		return ""
+	}
+	return e.Tag
+}
+
+func (e *FileEncryption) encryptSlice(rawData []byte) ([]byte, error) {
+	if e.envelope == nil {
+		return encryptSliceData(rawData)
+	}
+	return encryptEnvelopeSliceData(rawData, e.dataKey, e.ownerWrap)
+}
+
+// saveEnvelope keeps the envelope of an uploaded file. It is needed to download the file, and to re-wrap its key later
+func (e *FileEncryption) saveEnvelope(fileHash string) error {
+	if e == nil || e.envelope == nil {
+		return nil
+	}
+	return file.SaveFileEnvelope(fileHash, e.envelope.Bytes())
+}
+
+// fileEncryptionPrivKey derives the ed25519 key opening the file envelopes from the wallet key, so it is held by the wallet owner
+func fileEncryptionPrivKey() (*fwed25519.PrivKey, error) {
+	key, err := setting.WalletSigner.DeriveSecret(signer.SECRET_FILE_ENCRYPTION, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed deriving the file encryption key")
+	}
+	return &fwed25519.PrivKey{Key: key}, nil
+}
+
+// FileEncryptionPubKey returns the public key to share with file owners who want to give this wallet access to their encrypted files
+func FileEncryptionPubKey() ([]byte, error) {
+	privKey, err := fileEncryptionPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	return privKey.PubKey().Bytes(), nil
+}
+
+// ownerWrapKey derives the key wrapping the data keys of the files uploaded by this wallet
+func ownerWrapKey() ([]byte, error) {
+	privKey, err := fileEncryptionPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(append([]byte("sds envelope owner wrap"), privKey.Bytes()...))
+	return key[:], nil
+}
+
+// wrapOwnerDataKey encrypts the data key of a file for its owner wallet. It is stored in the slices, so any node
+// holding the wallet key can download the file without the envelope
+func wrapOwnerDataKey(dataKey []byte) ([]byte, error) {
+	key, err := ownerWrapKey()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 8)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed generating the owner wrap nonce")
+	}
+	wrappedKey, err := encryption.EncryptAES(key, dataKey, binary.BigEndian.Uint64(nonce))
+	if err != nil {
+		return nil, err
+	}
+	ownerWrap := append(nonce, wrappedKey...)
+	if len(ownerWrap) != envelopeOwnerWrapSize {
+		return nil, errors.Errorf("invalid owner wrap size [%v]", len(ownerWrap))
+	}
+	return ownerWrap, nil
+}
+
+func unwrapOwnerDataKey(ownerWrap []byte) ([]byte, error) {
+	key, err := ownerWrapKey()
+	if err != nil {
+		return nil, err
+	}
+	return encryption.DecryptAES(key, ownerWrap[8:], binary.BigEndian.Uint64(ownerWrap[:8]), false)
+}
+
+// RewrapFileEnvelope opens the envelope of a file with the key of this node, and wraps its data key for a new set of recipients.
+// The new envelope is stored if this node is still one of the recipients
+func RewrapFileEnvelope(fileHash string, recipientPubKeys [][]byte) ([]byte, error) {
+	envelopeBytes, err := file.GetFileEnvelope(fileHash)
+	if err != nil {
+		return nil, err
+	}
+	if envelopeBytes == nil {
+		return nil, errors.Errorf("no envelope found for file %v, import it first", fileHash)
+	}
+	envelope, err := encryption.EnvelopeFromBytes(envelopeBytes)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := fileEncryptionPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	newEnvelope, err := envelope.Rewrap(privKey.Bytes(), recipientPubKeys...)
+	if err != nil {
+		return nil, err
+	}
+	if newEnvelope.HasRecipient(privKey.PubKey().Bytes()) {
+		if err = file.SaveFileEnvelope(fileHash, newEnvelope.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return newEnvelope.Bytes(), nil
+}
+
+// ImportFileEnvelope stores an envelope wrapped for this node. The slices don't carry the envelope, so it must be imported
+// before downloading a file shared or re-wrapped by its owner
+func ImportFileEnvelope(fileHash string, envelopeBytes []byte) error {
+	envelope, err := encryption.EnvelopeFromBytes(envelopeBytes)
+	if err != nil {
+		return err
+	}
+	privKey, err := fileEncryptionPrivKey()
+	if err != nil {
+		return err
+	}
+	if _, err = envelope.Open(privKey.Bytes()); err != nil {
+		return errors.Wrap(err, "the envelope can't be opened by this node")
+	}
+	return file.SaveFileEnvelope(fileHash, envelopeBytes)
+}
+
+func encryptEnvelopeSliceData(rawData, dataKey, ownerWrap []byte) ([]byte, error) {
+	if len(ownerWrap) != envelopeOwnerWrapSize {
+		return nil, errors.Errorf("invalid owner wrap size [%v]", len(ownerWrap))
+	}
+	// All the slices of a file share the data key, so the nonces must never repeat
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed generating the slice nonce")
+	}
+	aesNonce := binary.BigEndian.Uint64(nonce)
+	encryptedData, err := encryption.EncryptAES(dataKey, rawData, aesNonce)
+	if err != nil {
+		return nil, err
+	}
+	encryptedSlice, err := proto.Marshal(&protos.EncryptedSlice{
+		AesNonce: aesNonce,
+		Data:     encryptedData,
+		RawSize:  uint64(len(rawData)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The slices only reference the data key, and carry it wrapped for the owner wallet. The envelope of the other
+	// recipients is kept out of band, so that re-wrapping it revokes the recipients left out
+	data := make([]byte, 0, len(envelopeSliceMagic)+envelopeKeyIdSize+envelopeOwnerWrapSize+len(encryptedSlice))
+	data = append(data, envelopeSliceMagic...)
+	data = append(data, dataKeyId(dataKey)...)
+	data = append(data, ownerWrap...)
+	return append(data, encryptedSlice...), nil
+}
+
+// dataKeyId identifies the data key of a file without revealing it
+func dataKeyId(dataKey []byte) []byte {
+	hash := sha256.Sum256(dataKey)
+	return hash[:envelopeKeyIdSize]
+}
+
+func isEnvelopeSliceData(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeSliceMagic)
+}
+
+func decryptEnvelopeSliceData(fileHash string, data []byte) ([]byte, error) {
+	keyId, ownerWrap, encryptedSlice, err := parseEnvelopeSliceData(data)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := openFileEnvelope(fileHash, keyId, ownerWrap)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.DecryptAES(dataKey, encryptedSlice.Data, encryptedSlice.AesNonce, false)
+}
+
+func parseEnvelopeSliceData(data []byte) ([]byte, []byte, *protos.EncryptedSlice, error) {
+	pos := len(envelopeSliceMagic)
+	if len(data) < pos+envelopeKeyIdSize+envelopeOwnerWrapSize {
+		return nil, nil, nil, errors.New("envelope slice is too short")
+	}
+	keyId := data[pos : pos+envelopeKeyIdSize]
+	pos += envelopeKeyIdSize
+	ownerWrap := data[pos : pos+envelopeOwnerWrapSize]
+	pos += envelopeOwnerWrapSize
+
+	encryptedSlice := &protos.EncryptedSlice{}
+	if err := proto.Unmarshal(data[pos:], encryptedSlice); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "couldn't unmarshal protobuf to encrypted slice")
+	}
+	return keyId, ownerWrap, encryptedSlice, nil
+}
+
+// openFileEnvelope unwraps the data key of a file with the envelope stored on this node, or with the owner wrap of the
+// slice when this wallet uploaded the file, and checks that it is the key referenced by the slices
+func openFileEnvelope(fileHash string, keyId, ownerWrap []byte) ([]byte, error) {
+	if dataKey, err := unwrapOwnerDataKey(ownerWrap); err == nil && bytes.Equal(dataKeyId(dataKey), keyId) {
+		return dataKey, nil
+	}
+
+	envelopeBytes, err := file.GetFileEnvelope(fileHash)
+	if err != nil {
+		return nil, err
+	}
+	if envelopeBytes == nil {
+		return nil, errors.Errorf("no envelope found for file %v, import it first", fileHash)
+	}
+	envelope, err := encryption.EnvelopeFromBytes(envelopeBytes)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := fileEncryptionPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := envelope.Open(privKey.Bytes())
+	if err != nil {
+		return nil, errors.Wrapf(err, "the envelope of file %v can't be opened by this node", fileHash)
+	}
+	if !bytes.Equal(dataKeyId(dataKey), keyId) {
+		return nil, errors.Errorf("the envelope of file %v doesn't hold the key of its slices", fileHash)
+	}
+	return dataKey, nil
+}
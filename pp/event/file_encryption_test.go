@@ -0,0 +1,89 @@
+package event
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stratosnet/sds/framework/crypto/encryption"
+	"github.com/stratosnet/sds/framework/crypto/secp256k1"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
+)
+
+func TestEnvelopeSliceData(t *testing.T) {
+	privKey, err := secp256k1.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setting.Config = setting.DefaultConfig()
+	setting.Config.Home.AccountsPath = t.TempDir()
+	setting.WalletSigner = signer.NewLocalSigner(privKey)
+	defer func() { setting.WalletSigner = nil }()
+
+	dataKey, err := encryption.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerWrap, err := wrapOwnerDataKey(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawData := []byte("envelope slice content")
+
+	first, err := encryptEnvelopeSliceData(rawData, dataKey, ownerWrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encryptEnvelopeSliceData(rawData, dataKey, ownerWrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEnvelopeSliceData(first) {
+		t.Fatal("the slice should be recognized as envelope encrypted")
+	}
+
+	keyId, _, firstSlice, err := parseEnvelopeSliceData(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keyId, dataKeyId(dataKey)) {
+		t.Fatal("the slice should reference the data key")
+	}
+	_, _, secondSlice, err := parseEnvelopeSliceData(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstSlice.AesNonce == secondSlice.AesNonce {
+		t.Fatal("the slices of a file shouldn't share a nonce")
+	}
+
+	decrypted, err := encryption.DecryptAES(dataKey, firstSlice.Data, firstSlice.AesNonce, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, rawData) {
+		t.Fatal("the decrypted slice should match the raw data")
+	}
+
+	if _, _, _, err = parseEnvelopeSliceData(first[:len(envelopeSliceMagic)+4]); err == nil {
+		t.Fatal("a truncated slice should be rejected")
+	}
+
+	// The owner wallet decrypts the slice without the envelope, which is only stored on the uploading node
+	decrypted, err = decryptEnvelopeSliceData("file hash without envelope", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, rawData) {
+		t.Fatal("the owner should decrypt the slice from its owner wrap")
+	}
+
+	otherKey, err := secp256k1.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setting.WalletSigner = signer.NewLocalSigner(otherKey)
+	if _, err = decryptEnvelopeSliceData("file hash without envelope", first); err == nil {
+		t.Fatal("another wallet without an envelope shouldn't decrypt the slice")
+	}
+}
@@ -55,7 +55,7 @@ func RspGetPPStatus(ctx context.Context, conn core.WriteCloser) {
 		utils.ErrorLog(target.Result.Msg)
 		rpcResult.Return = rpc.INTERNAL_COMM_FAILURE
 		if strings.Contains(target.Result.Msg, "Please register first") {
-			network.GetPeer(ctx).RunFsm(ctx, network.EVENT_SP_NO_PP_IN_STORE)
+			network.GetPeer(ctx).RunFsm(ctx, network.EVENT_SP_NO_PP_IN_STORE, target.Result.Msg)
 			setting.IsPPSyncedWithSP = true
 			return
 		}
@@ -81,13 +81,13 @@ func RspGetPPStatus(ctx context.Context, conn core.WriteCloser) {
 	rpcResult.Message = FormatPPStatusInfo(ctx, newPPStatus, false)
 
 	if target.IsActive == msgtypes.PP_ACTIVE {
-		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_RSP_ACTIVATED)
+		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_RSP_ACTIVATED, "SP reported the node as active")
 	} else {
-		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_STATUS_INACTIVE)
+		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_STATUS_INACTIVE, fmt.Sprintf("SP reported the node activation status as %v", target.IsActive))
 	}
 
 	if target.State == int32(protos.PPState_SUSPEND) {
-		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_STATUS_SUSPEND)
+		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_STATUS_SUSPEND, "SP reported the node as suspended in the node status")
 	}
 }
 
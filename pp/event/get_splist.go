@@ -52,7 +52,7 @@ func RspGetSPList(ctx context.Context, conn core.WriteCloser) {
 			utils.ErrorLogf("Couldn't save SP list to file: %v", err)
 		}
 	}
-	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_GET_SP_LIST)
+	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_GET_SP_LIST, "received the SP list")
 }
 
 func checkSpListChanged(list []*protos.SPBaseInfo) bool {
@@ -2,7 +2,9 @@ package event
 
 import (
 	"context"
+	"math/big"
 	"sync"
+	"sync/atomic"
 
 	"github.com/stratosnet/sds/framework/core"
 	"github.com/stratosnet/sds/framework/msg/header"
@@ -18,6 +20,8 @@ import (
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
+	"github.com/stratosnet/sds/pp/webhook"
 )
 
 var (
@@ -25,6 +29,9 @@ var (
 	downloadRequestMap     = &sync.Map{}
 	replicasRequestMap     = &sync.Map{}
 	getShareFileRequestMap = &sync.Map{}
+
+	// ozoneLow is true while the balance of the wallet is below the threshold, so that ozone.low is sent only once
+	ozoneLow atomic.Bool
 )
 
 // GetWalletOz queries current ozone balance
@@ -79,11 +86,14 @@ func RspGetWalletOz(ctx context.Context, conn core.WriteCloser) {
 		rpcResult.Return = rpc.INTERNAL_COMM_FAILURE
 		return
 	}
+	if target.WalletAddress == setting.WalletAddress {
+		checkLowOzone(target.WalletAddress, target.WalletOz)
+	}
 
 	if reqMsg, loaded := uploadRequestMap.LoadAndDelete(requests.GetReqIdFromMessage(ctx)); loaded {
 		rmsg := reqMsg.(*protos.ReqUploadFile)
 		walletString := msgutils.GetFileUploadWalletSignMessage(rmsg.FileInfo.FileHash, setting.WalletAddress, target.SequenceNumber, rmsg.ReqTime)
-		wsign, err := setting.WalletPrivateKey.Sign([]byte(walletString))
+		wsign, err := setting.WalletSigner.Sign(signer.MSG_UPLOAD, []byte(walletString))
 		if err != nil {
 			return
 		}
@@ -99,7 +109,7 @@ func RspGetWalletOz(ctx context.Context, conn core.WriteCloser) {
 			return
 		}
 		walletString := msgutils.GetFileDownloadWalletSignMessage(fileHash, setting.WalletAddress, target.SequenceNumber, rmsg.ReqTime)
-		wsign, err := setting.WalletPrivateKey.Sign([]byte(walletString))
+		wsign, err := setting.WalletSigner.Sign(signer.MSG_DOWNLOAD, []byte(walletString))
 		if err != nil {
 			return
 		}
@@ -111,7 +121,7 @@ func RspGetWalletOz(ctx context.Context, conn core.WriteCloser) {
 	if reqMsg, loaded := getShareFileRequestMap.LoadAndDelete(requests.GetReqIdFromMessage(ctx)); loaded {
 		rmsg := reqMsg.(*protos.ReqGetShareFile)
 		walletString := msgutils.GetDownloadShareFileWalletSignMessage(rmsg.Keyword, setting.WalletAddress, target.SequenceNumber, rmsg.ReqTime)
-		wsign, err := setting.WalletPrivateKey.Sign([]byte(walletString))
+		wsign, err := setting.WalletSigner.Sign(signer.MSG_DOWNLOAD, []byte(walletString))
 		if err != nil {
 			return
 		}
@@ -128,7 +138,7 @@ func RspGetWalletOz(ctx context.Context, conn core.WriteCloser) {
 		}
 		// sign the wallet signature by wallet private key
 		wsignMsg := msgutils.GetFileReplicaInfoWalletSignMessage(fileHash, setting.WalletAddress, target.SequenceNumber, rmsg.ReqTime)
-		wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+		wsign, err := setting.WalletSigner.Sign(signer.MSG_FILE_INFO, []byte(wsignMsg))
 		if err != nil {
 			return
 		}
@@ -141,3 +151,19 @@ func RspGetWalletOz(ctx context.Context, conn core.WriteCloser) {
 	rpcResult.Ozone = target.WalletOz
 	rpcResult.SequenceNumber = target.SequenceNumber
 }
+
+// checkLowOzone notifies the webhooks when the ozone balance of the wallet falls below the configured threshold
+func checkLowOzone(walletAddr, ozone string) {
+	threshold := setting.Config.Webhook.LowOzoneThreshold
+	if threshold == 0 {
+		return
+	}
+	balance, ok := new(big.Float).SetString(ozone)
+	if !ok {
+		return
+	}
+	low := balance.Cmp(new(big.Float).SetUint64(threshold)) < 0
+	if ozoneLow.Swap(low) != low && low {
+		webhook.Publish(webhook.EVENT_OZONE_LOW, webhook.OzoneEvent{WalletAddress: walletAddr, Ozone: ozone, Threshold: threshold})
+	}
+}
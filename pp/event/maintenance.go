@@ -61,7 +61,7 @@ func RspStartMaintenance(ctx context.Context, _ core.WriteCloser) {
 	pp.Logf(ctx, "Do not stop the pp service until all tasks are completed, otherwise score will be deducted.")
 	pp.Logf(ctx, "Checking ongoing tasks... ")
 	taskMonitorJob, _ = taskMonitorClock.AddJobRepeat(taskMonitorInterval, 0, taskMonitorFunc(ctx))
-	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_MAINTANENCE_START)
+	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_MAINTANENCE_START, "SP accepted the maintenance request")
 }
 
 func RspStopMaintenance(ctx context.Context, _ core.WriteCloser) {
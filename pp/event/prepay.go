@@ -52,12 +52,17 @@ func RspPrepay(ctx context.Context, conn core.WriteCloser) {
 		return
 	}
 
-	err := tx.BroadcastTx(target.Tx)
-	if err != nil {
+	// The tx is built by the SP, so it can't be resubmitted by this node
+	trackedTx, err := tx.BroadcastAndWait(ctx, target.Tx, nil, tx.TX_RESULT_WAIT)
+	if trackedTx.Hash == "" {
 		pp.ErrorLog(ctx, "The prepay transaction couldn't be broadcast", err.Error())
 		rpcResult.Return = err.Error()
+		return
+	}
+	rpcResult.Return, rpcResult.Tx = rpc.TxReturn(trackedTx), &trackedTx
+	if err != nil {
+		pp.ErrorLog(ctx, "The prepay transaction failed:", trackedTx)
 	} else {
-		pp.Log(ctx, "The prepay transaction was broadcast")
-		rpcResult.Return = rpc.SUCCESS
+		pp.Log(ctx, "The prepay transaction was broadcast:", trackedTx)
 	}
 }
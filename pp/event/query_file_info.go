@@ -22,6 +22,7 @@ import (
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
 	"github.com/stratosnet/sds/pp/task"
 	"github.com/stratosnet/sds/sds-msg/protos"
 	msgutils "github.com/stratosnet/sds/sds-msg/utils"
@@ -73,7 +74,7 @@ func GetFileStorageInfo(ctx context.Context, path, savePath, saveAs string, w ht
 	nowSec := time.Now().Unix()
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.GetFileDownloadWalletSignMessage(fileHash, setting.WalletAddress, "", nowSec) // need to retrieve sn first
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_DOWNLOAD, []byte(wsignMsg))
 	if err != nil {
 		return
 	}
@@ -167,7 +168,7 @@ func RspFileStorageInfo(ctx context.Context, conn core.WriteCloser) {
 		Slices:   slices,
 	})
 	file.SetDownloadSliceResult(target.FileHash+fileReqId, &rpc.Result{Return: rpc.DOWNLOAD_OK})
-	if crypto.IsVideoStream(target.FileHash) {
+	if crypto.IsVideoStream(target.FileHash) || strings.HasPrefix(fileReqId, task.RANGE_READ_REQID) {
 		_ = file.SetRemoteFileResult(target.FileHash+fileReqId, rpc.Result{Return: rpc.DOWNLOAD_OK, FileHash: target.FileHash})
 		return
 	}
@@ -53,7 +53,7 @@ func RspRegisterNewPP(ctx context.Context, conn core.WriteCloser) {
 		return
 	}
 
-	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_RSP_REGISTER_NEW_PP)
+	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_RSP_REGISTER_NEW_PP, "SP registered the node as a new PP")
 	pp.Log(ctx, "registered as PP successfully, you can deposit by `activate` ")
 	setting.IsPP = true
 	setting.IsPPSyncedWithSP = true
@@ -33,7 +33,7 @@ func RspRegister(ctx context.Context, conn core.WriteCloser) {
 	}
 
 	if target.IsSuspended {
-		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_SUSPENDED_STATE)
+		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_SUSPENDED_STATE, "SP reported the node as suspended when registering")
 	}
 
 	if target.Result.State != protos.ResultState_RES_SUCCESS {
@@ -49,6 +49,7 @@ func RspRegister(ctx context.Context, conn core.WriteCloser) {
 	if setting.IsPP {
 		network.GetPeer(ctx).StartMining(ctx)
 	}
+	resumeUploadsOnce.Do(func() { go ResumeUnfinishedUploads(ctx) })
 }
 
 // RspMining RspMining
@@ -68,7 +69,7 @@ func RspMining(ctx context.Context, conn core.WriteCloser) {
 		defer pp.SetRPCResult(p2pserver.GetP2pServer(ctx).GetP2PAddress().String()+reqId, rpcResult)
 	}
 	if target.Result.State != protos.ResultState_RES_SUCCESS {
-		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_MINING_NOT_STARTED)
+		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_MINING_NOT_STARTED, "SP couldn't start mining: "+target.Result.Msg)
 		pp.Log(ctx, target.Result.Msg)
 		rpcResult.Return = rpc.INTERNAL_COMM_FAILURE
 		return
@@ -28,7 +28,7 @@ func RspReportNodeStatus(ctx context.Context, conn core.WriteCloser) {
 	}
 
 	if target.Ppstate == int32(protos.PPState_SUSPEND) {
-		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_SUSPENDED_STATE)
+		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_SUSPENDED_STATE, "SP reported the node as suspended in the node status response")
 	}
 
 	if len(target.Result.Msg) > 0 {
@@ -37,7 +37,7 @@ func RspReportNodeStatus(ctx context.Context, conn core.WriteCloser) {
 
 	if state := network.GetPeer(ctx).GetStateFromFsm(); state.Id == network.STATE_REGISTERING {
 		utils.DebugLog("@#@#@#@#@#@#@#@#@#@#@#@#@#@#")
-		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_RSP_FIRST_NODE_STATUS)
+		network.GetPeer(ctx).RunFsm(ctx, network.EVENT_RCV_RSP_FIRST_NODE_STATUS, "SP accepted the first node status report")
 	}
 	network.GetPeer(ctx).NodeStatusResponded(ctx)
 }
@@ -0,0 +1,69 @@
+package event
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/pp"
+	"github.com/stratosnet/sds/pp/task"
+)
+
+var resumeUploadsOnce sync.Once
+
+// ResumeUnfinishedUploads re-drives the upload tasks that were persisted before ppd stopped. Uploads with pending slices
+// are sent to their destinations again, and uploads that were completed only need their backup status from the SP
+func ResumeUnfinishedUploads(ctx context.Context) {
+	for _, fileHash := range task.ListUploadTaskStates() {
+		if _, ok := task.UploadFileTaskMap.Load(fileHash); ok {
+			continue
+		}
+		uploadTask, stopped, err := task.LoadUploadFileTask(fileHash, uploadTaskHelper)
+		if err != nil {
+			pp.ErrorLogf(ctx, "couldn't resume the upload of file %v: %v", fileHash, err.Error())
+			continue
+		}
+		if uploadTask.IsFinished() {
+			ReqBackupStatus(ctx, fileHash)
+			continue
+		}
+		if stopped {
+			pp.Logf(ctx, "The upload of file %v was paused, use put --resume=true to resume it", fileHash)
+			continue
+		}
+		resumeUploadTask(ctx, fileHash, uploadTask)
+	}
+}
+
+// ResumeUpload picks up the persisted upload task of a file, instead of slicing the file again. Only the wallet the
+// file was being uploaded for can resume it
+func ResumeUpload(ctx context.Context, fileHash, walletAddr string) error {
+	if _, ok := task.UploadFileTaskMap.Load(fileHash); ok {
+		return errors.New("the file is already being uploaded")
+	}
+	uploadTask, _, err := task.LoadUploadFileTask(fileHash, uploadTaskHelper)
+	if err != nil {
+		return err
+	}
+	if uploadTask.GetOwnerWalletAddress() != walletAddr {
+		return errors.Errorf("the unfinished upload of file %v doesn't belong to wallet %v", fileHash, walletAddr)
+	}
+	if uploadTask.IsFinished() {
+		pp.Logf(ctx, "All the slices of file %v were already uploaded", fileHash)
+		ReqBackupStatus(ctx, fileHash)
+		return nil
+	}
+	resumeUploadTask(ctx, fileHash, uploadTask)
+	return nil
+}
+
+func resumeUploadTask(ctx context.Context, fileHash string, uploadTask *task.UploadFileTask) {
+	uploaded, total := uploadTask.GetUploadedSize()
+	pp.Logf(ctx, "Resuming the upload of file %v, %v of %v bytes were already uploaded", fileHash, uploaded, total)
+
+	task.UploadProgressMap.Store(fileHash, &task.UploadProgress{Total: total, HasUpload: uploaded})
+	task.UploadTaskIdMap.Store(fileHash, uploadTask.GetUploadTaskId())
+	task.UploadFileTaskMap.Store(fileHash, uploadTask)
+	go startUploadTask(ctx, fileHash, uploadTask)
+}
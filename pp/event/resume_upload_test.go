@@ -0,0 +1,35 @@
+package event
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/task"
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+func TestResumeUploadOwner(t *testing.T) {
+	setting.Config = setting.DefaultConfig()
+	setting.SetupRoot(t.TempDir())
+	t.Cleanup(func() {
+		setting.SetupRoot("")
+	})
+	fileHash := "v05ahm51atjqkpte7gnqa94bhgpfpe4c6lkq0jh8"
+	owner := "st1x5h5d5kt5k0y6sjpkgpsv2sdvw5ljcqnvz7xyn"
+	uploadTask := task.CreateUploadFileTask(&protos.RspUploadFile{
+		FileHash:           fileHash,
+		TaskId:             "task",
+		OwnerWalletAddress: owner,
+	}, uploadTaskHelper)
+	uploadTask.SaveState()
+
+	err := ResumeUpload(context.Background(), fileHash, "st1u5l3ye6v7hpfmy8f6p3qmqp6ldm0xuljgdpq5q")
+	if err == nil || !strings.Contains(err.Error(), "doesn't belong") {
+		t.Fatalf("another wallet shouldn't resume the upload, got %v", err)
+	}
+	if _, ok := task.UploadFileTaskMap.Load(fileHash); ok {
+		t.Fatal("the upload shouldn't be started for another wallet")
+	}
+}
@@ -0,0 +1,339 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alex023/clock"
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/core"
+	"github.com/stratosnet/sds/framework/msg/header"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/pp/file/sliceindex"
+	"github.com/stratosnet/sds/pp/file/slicestore"
+	"github.com/stratosnet/sds/pp/metrics"
+	"github.com/stratosnet/sds/pp/p2pserver"
+	"github.com/stratosnet/sds/pp/requests"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+const (
+	// slices modified more recently than this may still be receiving data, they are left for the next scrub
+	scrubGracePeriod = time.Hour
+	// maxScrubCorruptedSlices is the number of corrupted slice hashes kept in the scrub status
+	maxScrubCorruptedSlices = 100
+)
+
+// ScrubStatus is the progress of the current scrub, or the result of the last one
+type ScrubStatus struct {
+	Running         bool     `json:"running"`
+	StartTime       int64    `json:"start_time"`
+	EndTime         int64    `json:"end_time"`
+	Scanned         uint64   `json:"scanned"`
+	Verified        uint64   `json:"verified"`
+	Corrupted       uint64   `json:"corrupted"`
+	Skipped         uint64   `json:"skipped"`
+	OriginRequested uint64   `json:"origin_requested"`
+	BytesRead       uint64   `json:"bytes_read"`
+	CorruptedSlices []string `json:"corrupted_slices"`
+	Error           string   `json:"error"`
+}
+
+type sliceScrubber struct {
+	mtx    sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	status ScrubStatus
+}
+
+var (
+	scrubber   = &sliceScrubber{}
+	scrubClock = clock.NewClock()
+	scrubJob   clock.Job
+)
+
+// StartScrubJob starts re-verifying the stored slices at the interval from the config
+func StartScrubJob(ctx context.Context) {
+	scrubber.mtx.Lock()
+	scrubber.ctx = ctx
+	scrubber.mtx.Unlock()
+
+	interval := setting.Config.Scrub.Interval
+	if interval == 0 {
+		utils.Log("Periodic slice scrub is disabled")
+		return
+	}
+	utils.Log("Starting ScrubJob......")
+	scrubJob, _ = scrubClock.AddJobRepeat(time.Hour*time.Duration(interval), 0, func() {
+		if err := StartScrub(); err != nil {
+			utils.DebugLog("skipping periodic slice scrub:", err.Error())
+		}
+	})
+}
+
+func StopScrubJob() {
+	if scrubJob != nil {
+		utils.Log("Stopping ScrubJob......")
+		scrubJob.Cancel()
+	}
+	_ = StopScrub()
+}
+
+// StartScrub starts re-verifying all the stored slices in the background
+func StartScrub() error {
+	scrubber.mtx.Lock()
+	defer scrubber.mtx.Unlock()
+	if scrubber.ctx == nil {
+		return errors.New("the node is not started")
+	}
+	if scrubber.status.Running {
+		return errors.New("a scrub is already running")
+	}
+	ctx, cancel := context.WithCancel(scrubber.ctx)
+	scrubber.cancel = cancel
+	scrubber.status = ScrubStatus{Running: true, StartTime: time.Now().Unix()}
+	go scrubber.run(ctx)
+	return nil
+}
+
+// StopScrub interrupts the running scrub
+func StopScrub() error {
+	scrubber.mtx.Lock()
+	defer scrubber.mtx.Unlock()
+	if !scrubber.status.Running {
+		return errors.New("no scrub is running")
+	}
+	scrubber.cancel()
+	return nil
+}
+
+// GetScrubStatus returns the progress of the running scrub, or the result of the last one
+func GetScrubStatus() ScrubStatus {
+	scrubber.mtx.Lock()
+	defer scrubber.mtx.Unlock()
+	status := scrubber.status
+	status.CorruptedSlices = append([]string(nil), scrubber.status.CorruptedSlices...)
+	return status
+}
+
+func (s *sliceScrubber) run(ctx context.Context) {
+	utils.Log("slice scrub started")
+	start := time.Now()
+	var bytesRead uint64
+	err := file.WalkStoredSlices(ctx, func(info slicestore.SliceInfo) error {
+		sliceHash := info.Hash
+		if time.Since(info.ModTime) < scrubGracePeriod {
+			s.update(func(status *ScrubStatus) {
+				status.Scanned++
+				status.Skipped++
+			})
+			return nil
+		}
+
+		valid, err := file.VerifyStoredSlice(sliceHash)
+		bytesRead += uint64(info.Size)
+		switch {
+		case errors.Is(err, file.ErrSliceOriginUnknown):
+			// stored by an older version of the node, the slice is verified once the SP gives its origin
+			metrics.ScrubbedSlices.WithLabelValues("origin_requested").Inc()
+			reqSliceOrigin(ctx, sliceHash)
+			s.update(func(status *ScrubStatus) {
+				status.Scanned++
+				status.OriginRequested++
+				status.BytesRead = bytesRead
+			})
+		case err != nil:
+			utils.ErrorLogf("failed verifying slice %v: %v", sliceHash, err.Error())
+			s.update(func(status *ScrubStatus) {
+				status.Scanned++
+				status.Skipped++
+				status.BytesRead = bytesRead
+			})
+		case valid:
+			metrics.ScrubbedSlices.WithLabelValues("valid").Inc()
+			file.SetSliceVerification(sliceHash, sliceindex.VERIFIED)
+			s.update(func(status *ScrubStatus) {
+				status.Scanned++
+				status.Verified++
+				status.BytesRead = bytesRead
+			})
+		default:
+			metrics.ScrubbedSlices.WithLabelValues("corrupted").Inc()
+			utils.ErrorLogf("stored slice %v is corrupted, moving it to quarantine", sliceHash)
+			fileHashes, sliceNumber := storedSliceOrigin(sliceHash)
+			quarantineCorruptedSlice(ctx, sliceHash, info.Size, fileHashes, sliceNumber)
+			s.update(func(status *ScrubStatus) {
+				status.Scanned++
+				status.Corrupted++
+				status.BytesRead = bytesRead
+				if len(status.CorruptedSlices) < maxScrubCorruptedSlices {
+					status.CorruptedSlices = append(status.CorruptedSlices, sliceHash)
+				}
+			})
+		}
+		return waitScrubReadRate(ctx, start, bytesRead)
+	})
+
+	s.update(func(status *ScrubStatus) {
+		status.Running = false
+		status.EndTime = time.Now().Unix()
+		if err != nil {
+			status.Error = err.Error()
+		}
+	})
+	status := GetScrubStatus()
+	if err != nil {
+		utils.ErrorLogf("slice scrub interrupted after %v slices: %v", status.Scanned, err.Error())
+		return
+	}
+	utils.Logf("slice scrub finished: %v slices scanned, %v verified, %v corrupted, %v skipped, %v waiting for their origin",
+		status.Scanned, status.Verified, status.Corrupted, status.Skipped, status.OriginRequested)
+}
+
+func (s *sliceScrubber) update(fn func(status *ScrubStatus)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	fn(&s.status)
+}
+
+// waitScrubReadRate sleeps until the bytes read since start fit in the max read rate of the config
+func waitScrubReadRate(ctx context.Context, start time.Time, bytesRead uint64) error {
+	rate := setting.Config.Scrub.MaxReadRate
+	if rate == 0 {
+		return nil
+	}
+	expected := time.Duration(float64(bytesRead) / float64(rate*1024*1024) * float64(time.Second))
+	wait := expected - time.Since(start)
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// storedSliceOrigin returns the files a stored slice belongs to, with its slice number when it isn't deduplicated
+func storedSliceOrigin(sliceHash string) ([]string, uint64) {
+	if fileHash, sliceNumber, err := file.GetSliceOrigin(sliceHash); err == nil && fileHash != "" {
+		return []string{fileHash}, sliceNumber
+	}
+	if refs, err := file.GetSliceRefs(sliceHash); err == nil {
+		return refs, 0
+	}
+	return nil, 0
+}
+
+// quarantineCorruptedSlice moves a corrupted slice out of the storage, and reports it to the SP so that it schedules a
+// new replica
+func quarantineCorruptedSlice(ctx context.Context, sliceHash string, size int64, fileHashes []string, sliceNumber uint64) {
+	if err := file.QuarantineSlice(sliceHash); err != nil {
+		utils.ErrorLog("failed moving corrupted slice to quarantine", err)
+		file.SetSliceVerification(sliceHash, sliceindex.CORRUPTED)
+		return
+	}
+
+	p2pServer := p2pserver.GetP2pServer(ctx)
+	if !p2pServer.SpConnValid() {
+		utils.ErrorLogf("no SP connection, corrupted slice %v is not reported", sliceHash)
+		return
+	}
+	for _, fileHash := range fileHashes {
+		req := &protos.ReqReportCorruptedSlice{
+			FileHash:    fileHash,
+			SliceHash:   sliceHash,
+			SliceNumber: sliceNumber,
+			SliceSize:   uint64(size),
+			PpInfo:      p2pServer.GetPPInfo(),
+			P2PAddress:  p2pServer.GetP2PAddress().String(),
+		}
+		utils.DebugLogf("reporting corrupted slice %v of file %v to SP", sliceHash, fileHash)
+		p2pServer.SendMessageToSPServer(ctx, req, header.ReqReportCorruptedSlice)
+	}
+}
+
+func RspReportCorruptedSlice(ctx context.Context, _ core.WriteCloser) {
+	var target protos.RspReportCorruptedSlice
+	if err := VerifyMessage(ctx, header.RspReportCorruptedSlice, &target); err != nil {
+		utils.ErrorLog("failed verifying the message, ", err.Error())
+		return
+	}
+	if !requests.UnmarshalData(ctx, &target) {
+		return
+	}
+	if target.Result.State != protos.ResultState_RES_SUCCESS {
+		utils.ErrorLogf("SP failed handling the report of corrupted slice %v: %v", target.SliceHash, target.Result.Msg)
+		return
+	}
+	utils.DebugLogf("SP received the report of corrupted slice %v", target.SliceHash)
+}
+
+// reqSliceOrigin asks the SP for the file and slice number a slice stored without its origin was created for
+func reqSliceOrigin(ctx context.Context, sliceHash string) {
+	p2pServer := p2pserver.GetP2pServer(ctx)
+	if !p2pServer.SpConnValid() {
+		utils.DebugLogf("no SP connection, the origin of slice %v is not requested", sliceHash)
+		return
+	}
+	req := &protos.ReqGetSliceOrigin{
+		SliceHash:  sliceHash,
+		P2PAddress: p2pServer.GetP2PAddress().String(),
+	}
+	p2pServer.SendMessageToSPServer(ctx, req, header.ReqGetSliceOrigin)
+}
+
+// RspGetSliceOrigin verifies a slice stored without its origin, with the origin given by the SP
+func RspGetSliceOrigin(ctx context.Context, _ core.WriteCloser) {
+	var target protos.RspGetSliceOrigin
+	if err := VerifyMessage(ctx, header.RspGetSliceOrigin, &target); err != nil {
+		utils.ErrorLog("failed verifying the message, ", err.Error())
+		return
+	}
+	if !requests.UnmarshalData(ctx, &target) {
+		return
+	}
+	if target.Result.State != protos.ResultState_RES_SUCCESS || target.FileHash == "" {
+		utils.DebugLogf("SP doesn't know the origin of slice %v: %v", target.SliceHash, target.Result.Msg)
+		return
+	}
+
+	valid, err := file.VerifySliceOrigin(target.SliceHash, target.FileHash, target.SliceNumber)
+	switch {
+	case err != nil:
+		utils.ErrorLogf("failed verifying slice %v: %v", target.SliceHash, err.Error())
+	case valid:
+		metrics.ScrubbedSlices.WithLabelValues("valid").Inc()
+		file.SetSliceVerification(target.SliceHash, sliceindex.VERIFIED)
+	default:
+		size, err := file.GetSliceSize(target.SliceHash)
+		if err != nil {
+			utils.ErrorLogf("failed getting size of slice %v: %v", target.SliceHash, err.Error())
+			return
+		}
+		metrics.ScrubbedSlices.WithLabelValues("corrupted").Inc()
+		utils.ErrorLogf("stored slice %v is corrupted, moving it to quarantine", target.SliceHash)
+		quarantineCorruptedSlice(ctx, target.SliceHash, size, []string{target.FileHash}, target.SliceNumber)
+		scrubber.update(func(status *ScrubStatus) {
+			status.Corrupted++
+			if len(status.CorruptedSlices) < maxScrubCorruptedSlices {
+				status.CorruptedSlices = append(status.CorruptedSlices, target.SliceHash)
+			}
+		})
+	}
+}
+
+// backfillSliceOrigin records the origin of a slice the SP asks this node to send, if it was stored without one
+func backfillSliceOrigin(sliceHash, fileHash string, sliceNumber uint64) {
+	if fileHash == "" {
+		return
+	}
+	if err := file.BackfillSliceOrigin(sliceHash, fileHash, sliceNumber); err != nil {
+		utils.DebugLogf("couldn't backfill the origin of slice %v: %v", sliceHash, err.Error())
+	}
+}
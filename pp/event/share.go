@@ -2,6 +2,7 @@ package event
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
@@ -78,6 +79,9 @@ func RspShareLink(ctx context.Context, conn core.WriteCloser) {
 	if !requests.UnmarshalData(ctx, &target) {
 		return
 	}
+	if handleShareExpiryPage(ctx, &target) {
+		return
+	}
 
 	// serv the RPC user when the ReqId is not empty
 	reqId := core.GetRemoteReqId(ctx)
@@ -239,7 +243,10 @@ func RspGetShareFile(ctx context.Context, _ core.WriteCloser) {
 	task.CleanDownloadFileAndConnMap(ctx, target.FileHash, reqId)
 	task.DownloadFileMap.Store(target.FileHash+reqId, newTarget)
 	task.AddDownloadTask(newTarget)
-	file.StartLocalDownload(target.FileHash)
+	rangeRead := strings.HasPrefix(reqId, task.RANGE_READ_REQID)
+	if !rangeRead {
+		file.StartLocalDownload(target.FileHash)
+	}
 	var slice *protos.DownloadSliceInfo
 	var slices []file.DownloadSlice
 	for _, slice = range target.SliceInfo {
@@ -262,7 +269,7 @@ func RspGetShareFile(ctx context.Context, _ core.WriteCloser) {
 	rpcResult.Return = rpc.SHARED_DL_START
 	rpcResult.FileInfo = append(rpcResult.FileInfo, f)
 
-	if crypto.IsVideoStream(target.FileHash) {
+	if crypto.IsVideoStream(target.FileHash) || rangeRead {
 		return
 	}
 	DownloadFileSlices(ctx, newTarget, reqId)
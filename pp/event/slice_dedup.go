@@ -0,0 +1,108 @@
+package event
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/crypto"
+	"github.com/stratosnet/sds/framework/msg/header"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/framework/utils/chunker"
+	"github.com/stratosnet/sds/pp"
+	"github.com/stratosnet/sds/pp/metrics"
+	"github.com/stratosnet/sds/pp/p2pserver"
+	"github.com/stratosnet/sds/pp/requests"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/task"
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+const (
+	dedupMinSliceSize = setting.DefaultSliceBlockSize / 4
+	dedupAvgSliceSize = setting.DefaultSliceBlockSize / 2
+	dedupMaxSliceSize = setting.DefaultSliceBlockSize
+)
+
+// contentDefinedSliceOffsets cuts a file at content-defined boundaries. When a file is slightly modified,
+// only the slices around the modification change, so the other slices keep the same content hash
+func contentDefinedSliceOffsets(filePath string) ([]*protos.SliceOffset, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening file")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	c, err := chunker.New(f, dedupMinSliceSize, dedupAvgSliceSize, dedupMaxSliceSize)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := c.All()
+	if err != nil {
+		return nil, err
+	}
+	var offsets []*protos.SliceOffset
+	for _, chunk := range chunks {
+		offsets = append(offsets, &protos.SliceOffset{
+			SliceOffsetStart: chunk.Offset,
+			SliceOffsetEnd:   chunk.Offset + chunk.Length,
+		})
+	}
+	return offsets, nil
+}
+
+// dedupSliceHash returns the content hash of a slice, so that storage PPs can share it with other files.
+// A slice repeated within the same file gets a regular slice hash, as slice hashes must be unique in a file
+func dedupSliceHash(data []byte, fileHash string, sliceNumber uint64, usedHashes map[string]bool) (string, error) {
+	sliceHash := crypto.CalcContentSliceHash(data)
+	if usedHashes[sliceHash] {
+		return crypto.CalcSliceHash(data, fileHash, sliceNumber)
+	}
+	usedHashes[sliceHash] = true
+	return sliceHash, nil
+}
+
+// isSliceStoredInNetwork returns whether the SP assigned a deduplicated slice to a PP already storing it.
+// When the SP didn't look up the slices, the data is sent and the destination PP checks its own storage instead
+func isSliceStoredInNetwork(rspUploadFile *protos.RspUploadFile, sliceHash string) bool {
+	if !rspUploadFile.GetDedupChecked() {
+		return false
+	}
+	for _, storedHash := range rspUploadFile.StoredSliceHashes {
+		if storedHash == sliceHash {
+			return true
+		}
+	}
+	return false
+}
+
+// reportStoredSlice finishes the upload of a slice already stored in the network without sending its data
+func reportStoredSlice(ctx context.Context, rspUploadFile *protos.RspUploadFile, slice *protos.SliceHashAddr) {
+	pp.DebugLogf(ctx, "slice %v is already stored in the network, its data is not sent", slice.SliceHash)
+	tkSlice := rspUploadFile.TaskId + strconv.FormatUint(slice.SliceNumber, 10)
+	if value, ok := task.UploadFileTaskMap.Load(rspUploadFile.FileHash); ok {
+		fileTask := value.(*task.UploadFileTask)
+		if err := fileTask.SetUploadSliceStatus(slice.SliceHash, task.SLICE_STATUS_FINISHED); err != nil {
+			utils.DebugLog("failed setting upload slice status,", err.Error())
+			return
+		}
+		fileTask.Touch()
+		p := fileTask.GetUploadProgress()
+		pp.Logf(ctx, "fileHash: %v  uploaded：%.2f %% ", rspUploadFile.FileHash, p)
+		pp.ShowProgress(ctx, p)
+	}
+
+	reportReq := requests.ReqReportUploadSliceResultData(ctx,
+		rspUploadFile.TaskId,
+		rspUploadFile.FileHash,
+		rspUploadFile.SpP2PAddress,
+		slice.PpInfo.P2PAddress,
+		slice,
+		0)
+	p2pserver.GetP2pServer(ctx).SendMessageToSPServer(ctx, reportReq, header.ReqReportUploadSliceResult)
+	metrics.FinishSliceOperation(metrics.SliceUpload, tkSlice, true)
+}
@@ -0,0 +1,22 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+func TestIsSliceStoredInNetwork(t *testing.T) {
+	rsp := &protos.RspUploadFile{StoredSliceHashes: []string{"stored"}}
+	if isSliceStoredInNetwork(rsp, "stored") {
+		t.Fatal("the stored slices should be ignored when the SP didn't look them up")
+	}
+
+	rsp.DedupChecked = true
+	if !isSliceStoredInNetwork(rsp, "stored") {
+		t.Fatal("a slice stored in the network shouldn't be sent")
+	}
+	if isSliceStoredInNetwork(rsp, "new") {
+		t.Fatal("a slice missing from the network should be sent")
+	}
+}
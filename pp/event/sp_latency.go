@@ -8,6 +8,7 @@ import (
 	"github.com/stratosnet/sds/framework/msg/header"
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/pp"
+	"github.com/stratosnet/sds/pp/metrics"
 	"github.com/stratosnet/sds/pp/network"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
@@ -32,6 +33,7 @@ func RspSpLatencyCheck(ctx context.Context, _ core.WriteCloser) {
 
 	if start, ok := network.GetPeer(ctx).LoadPingTimeMap(response.NetworkAddressSp); ok {
 		timeCost := rspTime - start
+		metrics.SpRoundTrip.WithLabelValues(response.NetworkAddressSp).Observe(time.Duration(timeCost).Seconds())
 		updateOptimalSp(ctx, timeCost, &response)
 		network.GetPeer(ctx).DeletePingTimeMap(response.NetworkAddressSp)
 	}
@@ -13,6 +13,7 @@ import (
 	"github.com/stratosnet/sds/framework/msg/header"
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/pp/metrics"
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
@@ -66,6 +67,7 @@ func NoticeFileSliceBackup(ctx context.Context, conn core.WriteCloser) {
 	}
 
 	task.AddTransferTask(target.TaskId, target.SliceStorageInfo.SliceHash, tTask)
+	metrics.StartSliceOperation(metrics.SliceTransfer, target.TaskId+target.SliceStorageInfo.SliceHash, target.PpInfo.P2PAddress)
 
 	//if the connection returns error, send a ReqTransferDownloadWrong message to sp to report the failure
 	p2pserver.GetP2pServer(ctx).SendMessageToPPServ(ctx, target.PpInfo.NetworkAddress, requests.ReqTransferDownloadData(ctx, target),
@@ -117,8 +119,10 @@ func ReqTransferDownload(ctx context.Context, conn core.WriteCloser) {
 		LastTouchTime:      time.Now().Unix(),
 	}
 	task.AddTransferTask(noticeFileSliceBackup.TaskId, noticeFileSliceBackup.SliceStorageInfo.SliceHash, tTask)
+	metrics.StartSliceOperation(metrics.SliceTransfer, noticeFileSliceBackup.TaskId+noticeFileSliceBackup.SliceStorageInfo.SliceHash, target.NewPp.P2PAddress)
 
 	sliceHash := noticeFileSliceBackup.SliceStorageInfo.SliceHash
+	go backfillSliceOrigin(sliceHash, noticeFileSliceBackup.FileHash, noticeFileSliceBackup.SliceNumber)
 	sliceDataLen, buffer := task.GetTransferSliceData(noticeFileSliceBackup.TaskId, noticeFileSliceBackup.SliceStorageInfo.SliceHash)
 	utils.DebugLogf("sliceDataLen = %v  TaskId = %v", sliceDataLen, noticeFileSliceBackup.TaskId)
 
@@ -219,7 +223,7 @@ func RspTransferDownloadResult(ctx context.Context, conn core.WriteCloser) {
 
 	deleteOrigin := false
 	if tTask, ok := task.GetTransferTask(target.TaskId, target.SliceHash); ok && tTask.DeleteOrigin {
-		if err := file.DeleteSlice(tTask.SliceStorageInfo.SliceHash); err == nil {
+		if _, err := file.ReleaseSliceRef(tTask.SliceStorageInfo.SliceHash, tTask.FileHash); err == nil {
 			utils.Log("Deleted original slice successfully")
 			deleteOrigin = true
 		} else {
@@ -230,6 +234,7 @@ func RspTransferDownloadResult(ctx context.Context, conn core.WriteCloser) {
 }
 
 func SendReportBackupSliceResult(ctx context.Context, taskId, sliceHash, spP2pAddress string, result bool, originDeleted bool, costTime int64) {
+	metrics.FinishSliceOperation(metrics.SliceTransfer, taskId+sliceHash, result)
 	tTask, ok := task.GetTransferTask(taskId, sliceHash)
 	if !ok {
 		utils.ErrorLog("Transfer/backup task is already removed.")
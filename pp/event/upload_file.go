@@ -29,7 +29,9 @@ import (
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
 	"github.com/stratosnet/sds/pp/task"
+	"github.com/stratosnet/sds/pp/webhook"
 	"github.com/stratosnet/sds/sds-msg/protos"
 )
 
@@ -38,8 +40,8 @@ var (
 )
 
 // RequestUploadFile request to SP for upload file
-func RequestUploadFile(ctx context.Context, path string, isEncrypted, isVideoStream bool, desiredTier uint32, allowHigherTier bool,
-	walletAddr string, walletPubkey, wsign []byte) {
+func RequestUploadFile(ctx context.Context, path string, fileEncryption *FileEncryption, erasureCoding *ErasureCoding, deduplicate bool,
+	isVideoStream bool, desiredTier uint32, allowHigherTier bool, walletAddr string, walletPubkey, wsign []byte) {
 	pp.DebugLog(ctx, "______________path", path)
 	if !setting.CheckLogin() {
 		return
@@ -54,12 +56,8 @@ func RequestUploadFile(ctx context.Context, path string, isEncrypted, isVideoStr
 		pp.ErrorLog(ctx, "the provided path indicates a directory, not a file")
 		return
 	}
-	encryptionTag := ""
-	if isEncrypted {
-		encryptionTag = utils.GetRandomString(8)
-	}
 	uploadFileHandler := GetUploadFileHandler(isVideoStream)
-	fileInfo, slices, err := uploadFileHandler.PreUpload(ctx, path, encryptionTag)
+	fileInfo, slices, err := uploadFileHandler.PreUpload(ctx, path, fileEncryption, erasureCoding, deduplicate)
 	if err != nil {
 		pp.ErrorLog(ctx, "failed to slice file before upload ", err)
 		return
@@ -67,6 +65,7 @@ func RequestUploadFile(ctx context.Context, path string, isEncrypted, isVideoStr
 
 	reqTime := time.Now().Unix()
 	p := requests.RequestUploadFileData(ctx, fileInfo, slices, desiredTier, allowHigherTier, walletAddr, walletPubkey, wsign, reqTime)
+	p.Deduplicated = deduplicate
 	if err = ReqGetWalletOzForUpload(ctx, setting.WalletAddress, task.LOCAL_REQID, p); err != nil {
 		pp.ErrorLog(ctx, err)
 	}
@@ -119,6 +118,7 @@ func RspUploadFile(ctx context.Context, _ core.WriteCloser) {
 		} else {
 			pp.ErrorLog(ctx, "upload failed: ", target.Result.Msg)
 		}
+		webhook.Publish(webhook.EVENT_UPLOAD_FAILED, webhook.FileEvent{FileHash: target.FileHash, Reason: target.Result.Msg})
 
 		if file.IsFileRpcRemote(target.FileHash) {
 			_ = file.SetRemoteFileResult(target.FileHash, rpc.Result{Return: rpc.INTERNAL_DATA_FAILURE, Detail: target.Result.Msg})
@@ -128,6 +128,13 @@ func RspUploadFile(ctx context.Context, _ core.WriteCloser) {
 		return
 	}
 
+	if err := checkErasureCodingSupported(ctx, target.FileHash); err != nil {
+		pp.ErrorLog(ctx, "upload failed: ", err.Error())
+		webhook.Publish(webhook.EVENT_UPLOAD_FAILED, webhook.FileEvent{FileHash: target.FileHash, Reason: err.Error()})
+		file.ClearFileMap(target.FileHash)
+		return
+	}
+
 	task.UploadTaskIdMap.Store(target.FileHash, target.TaskId)
 
 	if len(target.Slices) != 0 {
@@ -135,6 +142,10 @@ func RspUploadFile(ctx context.Context, _ core.WriteCloser) {
 		uploadTask := task.CreateUploadFileTask(target, uploadTaskHelper)
 		p2pserver.GetP2pServer(ctx).CleanUpConnMap(target.FileHash)
 		task.UploadFileTaskMap.Store(target.FileHash, uploadTask)
+		if err := requestDistinctErasureDestinations(ctx, target.FileHash, uploadTask); err != nil {
+			pp.ErrorLog(ctx, "upload rejected: ", err.Error())
+			uploadTask.SetFatalError(err)
+		}
 
 		go startUploadTask(ctx, target.FileHash, uploadTask)
 	} else {
@@ -241,6 +252,13 @@ func uploadTaskHelper(ctx context.Context, fileHash string) {
 	if err != nil {
 		uploadResult(ctx, fileHash, err)
 	}
+	if errors.Is(err, task.UploadFinished) {
+		webhook.Publish(webhook.EVENT_UPLOAD_COMPLETE, webhook.FileEvent{FileHash: fileHash})
+	}
+	if errors.Is(err, task.UploadErrMaxRetries) || errors.Is(err, task.UploadErrFatalError) {
+		webhook.Publish(webhook.EVENT_UPLOAD_FAILED, webhook.FileEvent{FileHash: fileHash, Reason: err.Error()})
+		task.DeleteUploadTaskState(fileHash)
+	}
 	if errors.Is(err, task.UploadErrMaxRetries) || errors.Is(err, task.UploadFinished) || errors.Is(err, task.UploadErrFatalError) {
 		task.StopRepeatedUploadTaskJob(fileHash)
 		task.UploadFileTaskMap.Delete(fileHash)
@@ -259,6 +277,7 @@ func uploadTaskHandler(ctx context.Context, fileHash string) error {
 		return task.UploadErrNoUploadTask
 	}
 	uploadTask := value.(*task.UploadFileTask)
+	defer uploadTask.SaveState()
 	// trigger retry
 	if time.Since(uploadTask.GetLastTouch()) > task.UPLOAD_WAIT_TIMEOUT*time.Second {
 		utils.DebugLog("upload wait timeout")
@@ -309,6 +328,10 @@ func UploadPause(ctx context.Context, fileHash, reqID string, w http.ResponseWri
 		return true
 	})
 	p2pserver.GetP2pServer(ctx).CleanUpConnMap(fileHash)
+	if value, ok := task.UploadFileTaskMap.Load(fileHash); ok {
+		value.(*task.UploadFileTask).SaveState()
+		task.StopUploadTaskState(fileHash)
+	}
 	task.UploadFileTaskMap.Delete(fileHash)
 	task.UploadProgressMap.Delete(fileHash)
 }
@@ -320,12 +343,12 @@ func encryptSliceData(rawData []byte) ([]byte, error) {
 	}
 	aesNonce := rand.Uint64()
 
-	key, err := hdkey.MasterKeyForSliceEncryption(setting.WalletPrivateKey.Bytes(), hdKeyNonce)
+	key, err := setting.WalletSigner.DeriveSecret(signer.SECRET_SLICE_ENCRYPTION, hdKeyNonce)
 	if err != nil {
 		return nil, err
 	}
 
-	encryptedData, err := encryption.EncryptAES(key.PrivateKey(), rawData, aesNonce)
+	encryptedData, err := encryption.EncryptAES(key, rawData, aesNonce)
 	if err != nil {
 		return nil, err
 	}
@@ -347,7 +370,7 @@ func GetUploadFileHandler(isVideoStream bool) UploadFileHandler {
 }
 
 type UploadFileHandler interface {
-	PreUpload(ctx context.Context, filePath, encryptionTag string) (*protos.FileInfo, []*protos.SliceHashAddr, error)
+	PreUpload(ctx context.Context, filePath string, fileEncryption *FileEncryption, erasureCoding *ErasureCoding, deduplicate bool) (*protos.FileInfo, []*protos.SliceHashAddr, error)
 }
 
 type UploadStreamFileHandler struct {
@@ -356,7 +379,11 @@ type UploadStreamFileHandler struct {
 type UploadRawFileHandler struct {
 }
 
-func (UploadStreamFileHandler) PreUpload(ctx context.Context, filePath, encryptionTag string) (*protos.FileInfo, []*protos.SliceHashAddr, error) {
+func (UploadStreamFileHandler) PreUpload(ctx context.Context, filePath string, fileEncryption *FileEncryption, erasureCoding *ErasureCoding, deduplicate bool) (*protos.FileInfo, []*protos.SliceHashAddr, error) {
+	if erasureCoding != nil || deduplicate {
+		return nil, nil, errors.New("erasure coding and deduplication are not supported for video streams")
+	}
+	encryptionTag := fileEncryption.tag()
 	info, err := file.GetFileInfo(filePath)
 	if err != nil {
 		pp.ErrorLog(ctx, "wrong filePath", err.Error())
@@ -372,12 +399,25 @@ func (UploadStreamFileHandler) PreUpload(ctx context.Context, filePath, encrypti
 	fileName := info.Name()
 	fileSize := uint64(info.Size())
 	fileHash := file.GetFileHashForVideoStream(filePath, encryptionTag)
+	if err = fileEncryption.saveEnvelope(fileHash); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to save the file envelope")
+	}
 
 	videoSegmentNum := math.Sqrt(10*math.Max(1, float64(fileSize)/float64(setting.DefaultSliceBlockSize)) - 9)
 	sliceDuration := math.Ceil(float64(duration) / videoSegmentNum)
 	sliceCount := uint64(math.Ceil(float64(duration)/sliceDuration)) + setting.DefaultHlsSegmentBuffer + 1
 
-	file.VideoToHls(ctx, fileHash, file.GetFilePath(fileHash), int(sliceDuration))
+	if !file.VideoToHls(ctx, fileHash, file.GetFilePath(fileHash), int(sliceDuration)) {
+		return nil, nil, errors.New("failed to transform the video to HLS")
+	}
+	// Each rendition adds a playlist and its own segments, the first slice is kept for the HLS info
+	hlsFileCount, err := file.GetHlsFileCount(fileHash)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read the HLS segments")
+	}
+	if hlsFileCount+1 > sliceCount {
+		sliceCount = hlsFileCount + 1
+	}
 
 	hlsInfo, err := file.GetHlsInfo(fileHash, sliceCount)
 	if err != nil {
@@ -413,8 +453,8 @@ func (UploadStreamFileHandler) PreUpload(ctx context.Context, filePath, encrypti
 		}
 
 		data := rawData
-		if encryptionTag != "" {
-			data, err = encryptSliceData(rawData)
+		if fileEncryption != nil {
+			data, err = fileEncryption.encryptSlice(rawData)
 			if err != nil {
 				return nil, nil, errors.Wrap(err, "Couldn't encrypt slice data")
 			}
@@ -459,7 +499,11 @@ func (UploadStreamFileHandler) PreUpload(ctx context.Context, filePath, encrypti
 	return fileInfo, slices, nil
 }
 
-func (UploadRawFileHandler) PreUpload(ctx context.Context, filePath, encryptionTag string) (*protos.FileInfo, []*protos.SliceHashAddr, error) {
+func (UploadRawFileHandler) PreUpload(ctx context.Context, filePath string, fileEncryption *FileEncryption, erasureCoding *ErasureCoding, deduplicate bool) (*protos.FileInfo, []*protos.SliceHashAddr, error) {
+	if deduplicate && (fileEncryption != nil || erasureCoding != nil) {
+		return nil, nil, errors.New("deduplication can't be combined with encryption or erasure coding")
+	}
+	encryptionTag := fileEncryption.tag()
 	info, err := file.GetFileInfo(filePath)
 	if err != nil {
 		pp.ErrorLog(ctx, "wrong filePath", err.Error())
@@ -467,16 +511,30 @@ func (UploadRawFileHandler) PreUpload(ctx context.Context, filePath, encryptionT
 	}
 	fileName := info.Name()
 	fileSize := uint64(info.Size())
-	fileHash := file.GetFileHash(filePath, encryptionTag)
-	sliceSize := uint64(setting.DefaultSliceBlockSize)
-	sliceCount := uint64(math.Ceil(float64(info.Size()) / float64(sliceSize)))
+	fileHash := file.GetFileHash(filePath, erasureCoding.hashTag(encryptionTag))
+	if err = fileEncryption.saveEnvelope(fileHash); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to save the file envelope")
+	}
+	var sliceOffsets []*protos.SliceOffset
+	if deduplicate {
+		sliceOffsets, err = contentDefinedSliceOffsets(filePath)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		sliceSize := uint64(setting.DefaultSliceBlockSize)
+		sliceCount := uint64(math.Ceil(float64(info.Size()) / float64(sliceSize)))
+		for sliceNumber := uint64(1); sliceNumber <= sliceCount; sliceNumber++ {
+			sliceOffsets = append(sliceOffsets, requests.GetSliceOffset(sliceNumber, sliceCount, sliceSize, fileSize))
+		}
+	}
 
 	metrics.UploadPerformanceLogNow(fileHash + ":RCV_CMD_START:")
 
 	var slices []*protos.SliceHashAddr
-	for sliceNumber := uint64(1); sliceNumber <= sliceCount; sliceNumber++ {
-		sliceOffset := requests.GetSliceOffset(sliceNumber, sliceCount, sliceSize, fileSize)
-
+	dedupHashes := make(map[string]bool)
+	for i, sliceOffset := range sliceOffsets {
+		sliceNumber := uint64(i + 1)
 		rawData, err := file.GetFileData(filePath, sliceOffset)
 		if err != nil {
 			return nil, nil, errors.New("Failed reading data from file")
@@ -485,13 +543,26 @@ func (UploadRawFileHandler) PreUpload(ctx context.Context, filePath, encryptionT
 
 		// Encrypt slice data if required
 		data := rawData
-		if encryptionTag != "" {
-			data, err = encryptSliceData(rawData)
+		if fileEncryption != nil {
+			data, err = fileEncryption.encryptSlice(rawData)
 			if err != nil {
 				return nil, nil, errors.Wrap(err, "Couldn't encrypt slice data")
 			}
 		}
-		sliceHash, err := crypto.CalcSliceHash(data, fileHash, sliceNumber)
+		if erasureCoding != nil {
+			shards, err := erasureCoding.sliceShards(fileHash, sliceNumber, sliceOffset, data, fileEncryption != nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			slices = append(slices, shards...)
+			continue
+		}
+		var sliceHash string
+		if deduplicate {
+			sliceHash, err = dedupSliceHash(data, fileHash, sliceNumber, dedupHashes)
+		} else {
+			sliceHash, err = crypto.CalcSliceHash(data, fileHash, sliceNumber)
+		}
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "failed to calc slice hash")
 		}
@@ -518,6 +589,11 @@ func (UploadRawFileHandler) PreUpload(ctx context.Context, filePath, encryptionT
 		EncryptionTag:      encryptionTag,
 		OwnerWalletAddress: setting.WalletAddress,
 	}
+	if erasureCoding != nil {
+		fileInfo.ErasureDataShards = uint32(erasureCoding.DataShards)
+		fileInfo.ErasureParityShards = uint32(erasureCoding.ParityShards)
+		erasureUploads.Store(fileHash, erasureCoding)
+	}
 
 	return fileInfo, slices, nil
 }
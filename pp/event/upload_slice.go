@@ -40,8 +40,16 @@ var (
 
 	uploadSliceSpamCheckMap = utils.NewAutoCleanMap(setting.SpamThresholdSliceOperations)
 	backupSliceSpamCheckMap = utils.NewAutoCleanMap(setting.SpamThresholdSliceOperations)
+
+	// Deduplicated slices the storage PP already had. K: tkId+sliceNum, the remaining pieces of these slices are ignored
+	dedupReceivedSlices = utils.NewAutoCleanMap(30 * time.Minute)
+	// Deduplicated slices the destination already had. K: tkId+sliceNum, the remaining pieces of these slices are not sent
+	dedupSkippedSlices = utils.NewAutoCleanMap(30 * time.Minute)
 )
 
+// sliceAlreadyStoredMsg is the result msg of RspUploadFileSlice when the destination already stored the deduplicated slice
+const sliceAlreadyStoredMsg = "slice already stored"
+
 const (
 	SliceInvalid  = 0
 	SliceUpload   = 1
@@ -159,6 +167,23 @@ func ReqUploadFileSlice(ctx context.Context, conn core.WriteCloser) {
 	pieceSize := target.PieceOffset.SliceOffsetEnd - target.PieceOffset.SliceOffsetStart
 	_ = p2pserver.GetP2pServer(ctx).SendMessage(ctx, conn, requests.UploadSpeedOfProgressData(fileHash, pieceSize, (target.SliceNumber-1)*33554432+target.PieceOffset.SliceOffsetStart, timeEntry), header.UploadSpeedOfProgress)
 
+	if _, ok := dedupReceivedSlices.Load(tkSlice); ok {
+		return
+	}
+	if target.PieceOffset.SliceOffsetStart == 0 && file.IsDeduplicatedSliceStored(target.SliceHash, sliceSizeFromMsg) {
+		// The same data was already uploaded for another file, no need to receive it again
+		utils.DebugLog("deduplicated slice is already stored", target.SliceHash)
+		dedupReceivedSlices.Store(tkSlice, true)
+		if err := file.AddSliceRef(target.SliceHash, fileHash); err != nil {
+			utils.ErrorLog("Failed adding slice reference", err.Error())
+			return
+		}
+		rsp := requests.RspUploadFileSliceData(ctx, &target)
+		rsp.Result.Msg = sliceAlreadyStoredMsg
+		finishReqUploadFileSlice(ctx, conn, &target, rsp, newSlice, sliceSizeFromMsg, totalCostTime, tkSlice)
+		return
+	}
+
 	needToSave := true
 	sliceSize, _ := file.GetSliceSize(target.SliceHash)
 	if target.PieceOffset.SliceOffsetStart < uint64(sliceSize) {
@@ -193,32 +218,23 @@ func ReqUploadFileSlice(ctx context.Context, conn core.WriteCloser) {
 			utils.ErrorLog("Failed getting slice data", err.Error())
 			return
 		}
-		sliceHash, err := crypto.CalcSliceHash(sliceData, fileHash, target.SliceNumber)
+		valid, err := crypto.VerifySliceHash(sliceData, fileHash, target.SliceNumber, target.SliceHash)
 		if err != nil {
 			utils.ErrorLog("Failed to calc slice hash", err.Error())
 			return
 		}
-		if sliceHash == target.SliceHash {
-			_ = p2pserver.GetP2pServer(ctx).SendMessage(ctx, conn, requests.RspUploadFileSliceData(ctx, &target), header.RspUploadFileSlice)
-			// report upload result to SP
-			newSlice.SliceHash = target.SliceHash
-			_, newCtx := p2pserver.CreateNewContextPacketId(ctx)
-			utils.DebugLog("ReqReportUploadSliceResultDataPP reqID =========", core.GetReqIdFromContext(newCtx))
-			reportResultReq := requests.ReqReportUploadSliceResultData(ctx, target.RspUploadFile.TaskId,
-				target.RspUploadFile.FileHash,
-				target.RspUploadFile.SpP2PAddress,
-				target.P2PAddress,
-				newSlice,
-				totalCostTime)
-
-			p2pserver.GetP2pServer(ctx).SendMessageToSPServer(newCtx, reportResultReq, header.ReqReportUploadSliceResult)
-			metrics.StoredSliceCount.WithLabelValues("upload").Inc()
-			instantInboundSpeed := float64(sliceSizeFromMsg) / math.Max(float64(totalCostTime), 1)
-			metrics.InboundSpeed.WithLabelValues(reportResultReq.OpponentP2PAddress).Set(instantInboundSpeed)
-			UpRecvCostTimeMap.mux.Lock()
-			UpRecvCostTimeMap.dataMap.Delete(tkSlice)
-			UpRecvCostTimeMap.mux.Unlock()
-			utils.DebugLog("storage PP report to SP upload task finished: ", target.SliceHash)
+		if valid {
+			if file.IsDeduplicatedSlice(target.SliceHash, sliceData) {
+				if err = file.AddSliceRef(target.SliceHash, fileHash); err != nil {
+					utils.ErrorLog("Failed adding slice reference", err.Error())
+				}
+			} else if err = file.SaveSliceOrigin(target.SliceHash, fileHash, target.SliceNumber); err != nil {
+				utils.ErrorLog("Failed saving slice origin", err.Error())
+			}
+			if err = file.CommitSlice(target.SliceHash); err != nil {
+				utils.ErrorLog("Failed committing slice", err.Error())
+			}
+			finishReqUploadFileSlice(ctx, conn, &target, requests.RspUploadFileSliceData(ctx, &target), newSlice, sliceSizeFromMsg, totalCostTime, tkSlice)
 		} else {
 			utils.ErrorLog("newly stored sliceHash is not equal to target sliceHash!")
 			if err = file.DeleteSlice(target.SliceHash); err != nil {
@@ -228,6 +244,31 @@ func ReqUploadFileSlice(ctx context.Context, conn core.WriteCloser) {
 	}
 }
 
+// finishReqUploadFileSlice answers the uploader and reports to SP once a slice is fully stored
+func finishReqUploadFileSlice(ctx context.Context, conn core.WriteCloser, target *protos.ReqUploadFileSlice, rsp *protos.RspUploadFileSlice,
+	slice *protos.SliceHashAddr, sliceSize uint64, totalCostTime int64, tkSlice string) {
+	_ = p2pserver.GetP2pServer(ctx).SendMessage(ctx, conn, rsp, header.RspUploadFileSlice)
+	// report upload result to SP
+	slice.SliceHash = target.SliceHash
+	_, newCtx := p2pserver.CreateNewContextPacketId(ctx)
+	utils.DebugLog("ReqReportUploadSliceResultDataPP reqID =========", core.GetReqIdFromContext(newCtx))
+	reportResultReq := requests.ReqReportUploadSliceResultData(ctx, target.RspUploadFile.TaskId,
+		target.RspUploadFile.FileHash,
+		target.RspUploadFile.SpP2PAddress,
+		target.P2PAddress,
+		slice,
+		totalCostTime)
+
+	p2pserver.GetP2pServer(ctx).SendMessageToSPServer(newCtx, reportResultReq, header.ReqReportUploadSliceResult)
+	metrics.StoredSliceCount.WithLabelValues("upload").Inc()
+	instantInboundSpeed := float64(sliceSize) / math.Max(float64(totalCostTime), 1)
+	metrics.InboundSpeed.WithLabelValues(reportResultReq.OpponentP2PAddress).Set(instantInboundSpeed)
+	UpRecvCostTimeMap.mux.Lock()
+	UpRecvCostTimeMap.dataMap.Delete(tkSlice)
+	UpRecvCostTimeMap.mux.Unlock()
+	utils.DebugLog("storage PP report to SP upload task finished: ", target.SliceHash)
+}
+
 func RspUploadFileSlice(ctx context.Context, conn core.WriteCloser) {
 	var target protos.RspUploadFileSlice
 	if err := VerifyMessage(ctx, header.RspUploadFileSlice, &target); err != nil {
@@ -241,6 +282,9 @@ func RspUploadFileSlice(ctx context.Context, conn core.WriteCloser) {
 
 	if target.Result.State != protos.ResultState_RES_SUCCESS {
 		pp.ErrorLog(ctx, "RspUploadFileSlice failure:", target.Result.Msg)
+		if target.Slice != nil {
+			metrics.FinishSliceOperation(metrics.SliceUpload, target.TaskId+strconv.FormatUint(target.Slice.SliceNumber, 10), false)
+		}
 		return
 	}
 	if target.Slice == nil {
@@ -252,12 +296,17 @@ func RspUploadFileSlice(ctx context.Context, conn core.WriteCloser) {
 		target.FileHash, target.Slice.SliceNumber, target.Slice.SliceSize)
 
 	tkSlice := target.TaskId + strconv.FormatUint(target.Slice.SliceNumber, 10)
+	alreadyStored := target.Result.Msg == sliceAlreadyStoredMsg
+	if alreadyStored {
+		pp.DebugLogf(ctx, "slice %v is already stored by the destination, the remaining data is not sent", target.SliceHash)
+		dedupSkippedSlices.Store(tkSlice, true)
+	}
 	UpSendCostTimeMap.mux.Lock()
 	defer UpSendCostTimeMap.mux.Unlock()
 	if val, ok := UpSendCostTimeMap.dataMap.Load(tkSlice); ok {
 		ctStat := val.(CostTimeStat)
 		utils.DebugLogf("ctStat is %v", ctStat)
-		if ctStat.PacketCount == 0 && ctStat.TotalCostTime > 0 {
+		if (ctStat.PacketCount == 0 && ctStat.TotalCostTime > 0) || alreadyStored {
 			value, ok := task.UploadFileTaskMap.Load(target.FileHash)
 			if !ok {
 				utils.DebugLog("failed finding upload task for file", target.FileHash)
@@ -271,7 +320,7 @@ func RspUploadFileSlice(ctx context.Context, conn core.WriteCloser) {
 			fileTask.Touch()
 			p := fileTask.GetUploadProgress()
 			pp.Logf(ctx, "fileHash: %v  uploaded：%.2f %% ", target.FileHash, p)
-			setting.ShowProgress(ctx, p)
+			pp.ShowProgress(ctx, p)
 
 			target.Slice.SliceHash = target.SliceHash
 			reportReq := requests.ReqReportUploadSliceResultData(ctx,
@@ -282,6 +331,7 @@ func RspUploadFileSlice(ctx context.Context, conn core.WriteCloser) {
 				target.Slice,
 				ctStat.TotalCostTime)
 			p2pserver.GetP2pServer(ctx).SendMessageToSPServer(ctx, reportReq, header.ReqReportUploadSliceResult)
+			metrics.FinishSliceOperation(metrics.SliceUpload, tkSlice, true)
 			instantOutboundSpeed := float64(target.Slice.SliceSize) / math.Max(float64(ctStat.TotalCostTime), 1)
 			metrics.OutboundSpeed.WithLabelValues(target.P2PAddress).Set(instantOutboundSpeed)
 
@@ -378,12 +428,22 @@ func ReqBackupFileSlice(ctx context.Context, conn core.WriteCloser) {
 			utils.ErrorLog("Failed getting slice data", err.Error())
 			return
 		}
-		sliceHash, err := crypto.CalcSliceHash(sliceData, fileHash, target.SliceNumber)
+		valid, err := crypto.VerifySliceHash(sliceData, fileHash, target.SliceNumber, target.SliceHash)
 		if err != nil {
 			utils.ErrorLog("Failed to calc slice hash", err)
 			return
 		}
-		if sliceHash == target.SliceHash {
+		if valid {
+			if file.IsDeduplicatedSlice(target.SliceHash, sliceData) {
+				if err = file.AddSliceRef(target.SliceHash, fileHash); err != nil {
+					utils.ErrorLog("Failed adding slice reference", err.Error())
+				}
+			} else if err = file.SaveSliceOrigin(target.SliceHash, fileHash, target.SliceNumber); err != nil {
+				utils.ErrorLog("Failed saving slice origin", err.Error())
+			}
+			if err = file.CommitSlice(target.SliceHash); err != nil {
+				utils.ErrorLog("Failed committing slice", err.Error())
+			}
 			_ = p2pserver.GetP2pServer(ctx).SendMessage(ctx, conn, requests.RspBackupFileSliceData(&target), header.RspBackupFileSlice)
 			// report upload result to SP
 
@@ -424,15 +484,23 @@ func RspBackupFileSlice(ctx context.Context, conn core.WriteCloser) {
 	pp.DebugLogf(ctx, "get RspUploadFileSlice for file %v  sliceNumber %v  size %v", target.FileHash, target.Slice.SliceNumber, target.SliceSize)
 	if target.Result.State != protos.ResultState_RES_SUCCESS {
 		pp.ErrorLog(ctx, "RspUploadFileSlice failure:", target.Result.Msg)
+		if target.Slice != nil {
+			metrics.FinishSliceOperation(metrics.SliceUpload, target.TaskId+strconv.FormatUint(target.Slice.SliceNumber, 10), false)
+		}
 		return
 	}
 	tkSlice := target.TaskId + strconv.FormatUint(target.Slice.SliceNumber, 10)
+	alreadyStored := target.Result.Msg == sliceAlreadyStoredMsg
+	if alreadyStored {
+		pp.DebugLogf(ctx, "slice %v is already stored by the destination, the remaining data is not sent", target.SliceHash)
+		dedupSkippedSlices.Store(tkSlice, true)
+	}
 	UpSendCostTimeMap.mux.Lock()
 	defer UpSendCostTimeMap.mux.Unlock()
 	if val, ok := UpSendCostTimeMap.dataMap.Load(tkSlice); ok {
 		ctStat := val.(CostTimeStat)
 		utils.DebugLogf("ctStat is %v", ctStat)
-		if ctStat.PacketCount == 0 && ctStat.TotalCostTime > 0 {
+		if (ctStat.PacketCount == 0 && ctStat.TotalCostTime > 0) || alreadyStored {
 			reportReq := requests.ReqReportUploadSliceResultData(
 				ctx,
 				target.TaskId,
@@ -443,6 +511,7 @@ func RspBackupFileSlice(ctx context.Context, conn core.WriteCloser) {
 				ctStat.TotalCostTime)
 
 			p2pserver.GetP2pServer(ctx).SendMessageToSPServer(ctx, reportReq, header.ReqReportUploadSliceResult)
+			metrics.FinishSliceOperation(metrics.SliceUpload, tkSlice, true)
 			instantOutboundSpeed := float64(target.SliceSize) / math.Max(float64(ctStat.TotalCostTime), 1)
 			metrics.OutboundSpeed.WithLabelValues(target.P2PAddress).Set(instantOutboundSpeed)
 
@@ -486,6 +555,11 @@ func RspUploadSlicesWrong(ctx context.Context, _ core.WriteCloser) {
 	uploadTask.UpdateSliceDestinationsForRetry(rspUploadFile.Slices)
 
 	uploadTask.SetRspUploadFile(target.RspUploadFile)
+	if err := requestDistinctErasureDestinations(ctx, rspUploadFile.FileHash, uploadTask); err != nil {
+		pp.ErrorLog(ctx, "upload rejected: ", err.Error())
+		uploadTask.SetFatalError(err)
+		return
+	}
 	// Start upload for all new destinations
 	uploadTask.SignalNewDestinations(ctx)
 }
@@ -510,7 +584,7 @@ func RspReportUploadSliceResult(ctx context.Context, conn core.WriteCloser) {
 	}
 }
 
-func uploadSlice(ctx context.Context, slice *protos.SliceHashAddr, tk *task.UploadSliceTask, fileHash, taskId string) error {
+func uploadSlice(ctx context.Context, slice *protos.SliceHashAddr, tk *task.UploadSliceTask, fileHash, taskId string) (err error) {
 	tkDataLen := int(slice.SliceOffset.SliceOffsetEnd - slice.SliceOffset.SliceOffsetStart)
 	storageP2pAddress := slice.PpInfo.P2PAddress
 	storageNetworkAddress := slice.PpInfo.NetworkAddress
@@ -518,6 +592,12 @@ func uploadSlice(ctx context.Context, slice *protos.SliceHashAddr, tk *task.Uplo
 
 	utils.DebugLog("reqID-"+taskId+" =========", strconv.FormatInt(core.GetReqIdFromContext(ctx), 10))
 	tkSliceUID := taskId + strconv.FormatUint(tk.SliceNumber, 10)
+	metrics.StartSliceOperation(metrics.SliceUpload, tkSliceUID, storageP2pAddress)
+	defer func() {
+		if err != nil {
+			metrics.FinishSliceOperation(metrics.SliceUpload, tkSliceUID, false)
+		}
+	}()
 	tkSlice := TaskSlice{
 		TkSliceUID: tkSliceUID,
 		SliceType:  SliceUpload,
@@ -525,6 +605,11 @@ func uploadSlice(ctx context.Context, slice *protos.SliceHashAddr, tk *task.Uplo
 	}
 	var ctStat = CostTimeStat{}
 
+	if tk.Type != protos.UploadType_BACKUP && isSliceStoredInNetwork(tk.RspUploadFile, tk.SliceHash) {
+		reportStoredSlice(ctx, tk.RspUploadFile, slice)
+		return nil
+	}
+
 	_, data, err := file.ReadSliceDataFromTmp(fileHash, tk.SliceHash)
 	if err != nil {
 		return errors.Wrap(err, "failed to get slice data from tmp")
@@ -563,6 +648,9 @@ func uploadSlice(ctx context.Context, slice *protos.SliceHashAddr, tk *task.Uplo
 	dataStart := 0
 	dataEnd := setting.MaxData
 	for _, packet := range data {
+		if _, ok := dedupSkippedSlices.Load(tkSliceUID); ok {
+			return nil
+		}
 		pieceOffset := &protos.SliceOffset{
 			SliceOffsetStart: uint64(dataStart),
 			SliceOffsetEnd:   uint64(dataEnd),
@@ -668,7 +756,7 @@ func UploadSpeedOfProgress(ctx context.Context, _ core.WriteCloser) {
 	progress.HasUpload += int64(target.SliceSize)
 	//p := float32(progress.HasUpload) / float32(progress.Total) * 100
 	//pp.Logf(ctx, "fileHash: %v  uploaded：%.2f %% ", target.FileHash, p)
-	//setting.ShowProgress(ctx, p)
+	//pp.ShowProgress(ctx, p)
 	//ProgressMap.Store(target.FileHash, p)
 	if progress.HasUpload >= progress.Total {
 		task.UploadProgressMap.Delete(target.FileHash)
@@ -7,6 +7,7 @@ import (
 	"github.com/stratosnet/sds/framework/core"
 	"github.com/stratosnet/sds/framework/msg/header"
 	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/metrics"
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
@@ -43,6 +44,7 @@ func NoticeFileSliceVerify(ctx context.Context, conn core.WriteCloser) {
 		LastTouchTime:      time.Now().Unix(),
 	}
 	task.AddVerifyTask(target.TaskId, target.SliceStorageInfo.SliceHash, tTask)
+	metrics.StartSliceOperation(metrics.SliceVerify, target.TaskId+target.SliceStorageInfo.SliceHash, target.PpInfo.P2PAddress)
 	p2pserver.GetP2pServer(ctx).SendMessageToPPServ(ctx, target.PpInfo.NetworkAddress, requests.ReqVerifyDownloadData(ctx, target), nil, nil, header.MsgType{Id: 0, Name: ""})
 }
 
@@ -71,6 +73,7 @@ func ReqVerifyDownload(ctx context.Context, conn core.WriteCloser) {
 	}
 	task.AddVerifyTask(noticeVerify.TaskId, noticeVerify.SliceStorageInfo.SliceHash, tTask)
 	sliceHash := noticeVerify.SliceStorageInfo.SliceHash
+	go backfillSliceOrigin(sliceHash, noticeVerify.FileHash, noticeVerify.SliceNumber)
 	sliceDataLen, buffer := task.GetVerifySliceData(noticeVerify.TaskId, noticeVerify.SliceStorageInfo.SliceHash)
 	tkSliceUID := noticeVerify.TaskId + sliceHash
 	dataStart := 0
@@ -145,6 +148,7 @@ func RspVerifyDownload(ctx context.Context, conn core.WriteCloser) {
 }
 
 func SendReportVerifyResult(ctx context.Context, taskId, sliceHash, spP2pAddress string, result bool, sliceSize uint64) {
+	metrics.FinishSliceOperation(metrics.SliceVerify, taskId+sliceHash, result)
 	tTask, ok := task.GetVerifyTask(taskId, sliceHash)
 	if !ok {
 		utils.ErrorLog("Transfer/backup task is already removed.")
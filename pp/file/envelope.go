@@ -0,0 +1,41 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+const (
+	ENVELOPE_FOLDER = "envelopes"
+)
+
+func getEnvelopePath(fileHash string) string {
+	return filepath.Join(setting.Config.Home.AccountsPath, ENVELOPE_FOLDER, fileHash)
+}
+
+// SaveFileEnvelope stores the key envelope of an encrypted file. The slices only carry its data key wrapped for the owner
+// wallet, so the other recipients can only download the file after importing an envelope they can open
+func SaveFileEnvelope(fileHash string, envelope []byte) error {
+	path := getEnvelopePath(fileHash)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, "failed creating envelope folder")
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, envelope, 0600); err != nil {
+		return errors.Wrap(err, "failed writing envelope")
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// GetFileEnvelope returns the key envelope stored for an encrypted file, or nil if there is none
+func GetFileEnvelope(fileHash string) ([]byte, error) {
+	envelope, err := os.ReadFile(getEnvelopePath(fileHash))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return envelope, err
+}
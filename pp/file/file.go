@@ -21,6 +21,7 @@ import (
 	"github.com/stratosnet/sds/framework/crypto"
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/pp"
+	"github.com/stratosnet/sds/pp/file/slicestore"
 	"github.com/stratosnet/sds/pp/setting"
 	"github.com/stratosnet/sds/sds-msg/protos"
 )
@@ -124,6 +125,11 @@ func GetFilePath(hash string) string {
 	return fileMap[hash]
 }
 
+// SaveFilePath remembers the path of a file whose hash is already known, eg: when an upload is resumed
+func SaveFilePath(hash, filePath string) {
+	fileMap[hash] = filePath
+}
+
 func ClearFileMap(hash string) {
 	delete(fileMap, hash)
 }
@@ -183,29 +189,35 @@ func GetSliceDataFromTmp(fileHash, sliceHash string) ([]byte, error) {
 }
 
 func ReadSliceData(fileHash, sliceHash string) (int64, [][]byte, error) {
-
-	slicePath, err := getSlicePath(sliceHash)
+	r, err := getSliceStore().Open(sliceHash)
 	if err != nil {
-		return 0, nil, err
+		return ReadSliceDataFromTmp(fileHash, sliceHash)
 	}
-	r, err := mmap.Open(slicePath)
-	if err != nil {
-		slicePath = GetTmpSlicePath(fileHash, sliceHash)
-		r, err = mmap.Open(slicePath)
-		if err != nil {
-			return 0, nil, err
+	defer func() {
+		_ = r.Close()
+	}()
+	touchSlice(sliceHash)
+
+	size := int64(r.Len())
+	buffer := RequestBuffersForSlice(size)
+	var i int64
+	for i = 0; i*setting.MaxData < size; i++ {
+		if _, err = r.ReadAt(buffer[i], i*setting.MaxData); err != nil && err != io.EOF {
+			return size, buffer, err
 		}
 	}
-
-	return ReadFileDataToPackets(r, slicePath)
+	return size, buffer, nil
 }
 
 func GetSliceData(sliceHash string) ([]byte, error) {
-	slicePath, err := getSlicePath(sliceHash)
-	if err != nil {
-		return nil, err
-	}
-	return GetWholeFileData(slicePath)
+	touchSlice(sliceHash)
+	return readSliceData(sliceHash)
+}
+
+func readSliceData(sliceHash string) ([]byte, error) {
+	rmutex.Lock()
+	defer rmutex.Unlock()
+	return slicestore.ReadAll(getSliceStore(), sliceHash)
 }
 
 func GetVerifySliceData(sliceHash string) ([]byte, error) {
@@ -227,16 +239,13 @@ func GetWholeFileData(filePath string) ([]byte, error) {
 }
 
 func GetSliceSize(sliceHash string) (int64, error) {
-	slicePath, err := getSlicePath(sliceHash)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed getting slice path")
-	}
-	info, err := GetFileInfo(slicePath)
+	size, err := getSliceStore().Size(sliceHash)
 	if err != nil {
-		return 0, errors.Wrap(err, "failed getting file info")
+		return 0, errors.Wrap(err, "failed getting slice size")
 	}
-	return info.Size(), nil
+	return size, nil
 }
+
 func OpenTmpFile(fileHash, fileName string) (*os.File, error) {
 	tmpFileFolderPath := GetTmpFileFolderPath(fileHash)
 	folderPath := filepath.Join(tmpFileFolderPath)
@@ -307,22 +316,11 @@ func SaveVerifySliceData(data []byte, sliceHash string, offset uint64) error {
 func SaveSliceData(data []byte, sliceHash string, offset uint64) error {
 	wmutex.Lock()
 	defer wmutex.Unlock()
-	slicePath, err := getSlicePath(sliceHash)
-	if err != nil {
-		return errors.Wrap(err, "failed getting slice path")
-	}
-	fileMg, err := os.OpenFile(slicePath, os.O_CREATE|os.O_RDWR, 0600)
-	defer func() {
-		_ = fileMg.Close()
-	}()
-	if err != nil {
-		return errors.Wrap(err, "failed opening a file")
-	}
-	_, err = fileMg.WriteAt(data, int64(offset))
-	if err != nil {
+	if err := getSliceStore().WriteAt(sliceHash, data, offset); err != nil {
 		utils.ErrorLog("error save file")
 		return errors.Wrap(err, "failed writing data")
 	}
+	indexSliceWrite(sliceHash, int64(offset)+int64(len(data)))
 	return nil
 }
 
@@ -532,9 +530,12 @@ func DeleteSlice(sliceHash string) error {
 	if err != nil {
 		return errors.Wrap(err, "failed getting slice path")
 	}
-	if err := os.Remove(slicePath); err != nil {
+	if err = getSliceStore().Delete(sliceHash); err != nil {
 		return errors.Wrap(err, "failed removing slice")
 	}
+	_ = os.Remove(slicePath + SLICE_REFS_EXT)
+	_ = os.Remove(slicePath + SLICE_ORIGIN_EXT)
+	unindexSlice(sliceHash)
 	return nil
 }
 
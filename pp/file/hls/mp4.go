@@ -0,0 +1,719 @@
+package hls
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned when the input is not an MP4 file with H.264 video and AAC audio
+var ErrUnsupported = errors.New("unsupported video format")
+
+const maxTableSize = 512 * 1024 * 1024
+
+// box is an ISO BMFF box, located by its payload
+type box struct {
+	typ    string
+	offset int64
+	size   int64
+}
+
+type sample struct {
+	offset int64
+	size   uint32
+	dts    int64 // in the timescale of the track
+	cts    int64 // composition offset, in the timescale of the track
+	sync   bool
+}
+
+type track struct {
+	handler   string // "vide" or "soun"
+	timescale uint32
+	samples   []sample
+	mediaTime int64   // media time where the edit list starts, in the timescale of the track
+	delay     float64 // empty edit before the start of the track, in seconds
+	codec     string  // RFC 6381 codec string
+
+	// H.264 video
+	width, height uint16
+	lengthSize    int
+	sps, pps      [][]byte
+
+	// AAC audio
+	objectType     uint8
+	frequencyIndex uint8
+	channels       uint8
+}
+
+// movie is the content of an MP4 file that the segmenter can package
+type movie struct {
+	duration float64
+	videos   []*track
+	audio    *track
+}
+
+// seconds converts a time in the timescale of the track to seconds on the movie timeline
+func (t *track) seconds(value int64) float64 {
+	return float64(value-t.mediaTime)/float64(t.timescale) + t.delay
+}
+
+// to90k converts a time in the timescale of the track to the 90kHz clock of MPEG-TS, on the movie timeline
+func (t *track) to90k(value int64) int64 {
+	return (value-t.mediaTime)*90000/int64(t.timescale) + int64(t.delay*90000)
+}
+
+func (t *track) presentationTime(i int) float64 {
+	return t.seconds(t.samples[i].dts + t.samples[i].cts)
+}
+
+// end returns the time at which the last sample of the track stops
+func (t *track) end() float64 {
+	if len(t.samples) == 0 {
+		return 0
+	}
+	last := t.samples[len(t.samples)-1]
+	duration := int64(0)
+	if len(t.samples) > 1 {
+		duration = last.dts - t.samples[len(t.samples)-2].dts
+	}
+	return t.seconds(last.dts + last.cts + duration)
+}
+
+func readBoxes(r io.ReaderAt, offset, end int64) ([]box, error) {
+	var boxes []box
+	header := make([]byte, 16)
+	for offset+8 <= end {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, errors.Wrap(err, "couldn't read box header")
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, errors.Wrap(err, "couldn't read box header")
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || size > end-offset {
+			return nil, errors.Errorf("invalid size of box [%q]", typ)
+		}
+		boxes = append(boxes, box{typ: typ, offset: offset + headerSize, size: size - headerSize})
+		offset += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// childBox follows a path of box types below parent
+func childBox(r io.ReaderAt, parent box, path ...string) (box, error) {
+	current := parent
+	for _, typ := range path {
+		children, err := readBoxes(r, current.offset, current.offset+current.size)
+		if err != nil {
+			return box{}, err
+		}
+		next, ok := findBox(children, typ)
+		if !ok {
+			return box{}, errors.Errorf("missing box [%v]", typ)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func readPayload(r io.ReaderAt, b box) ([]byte, error) {
+	if b.size > maxTableSize {
+		return nil, errors.Errorf("box [%v] is too big", b.typ)
+	}
+	data := make([]byte, b.size)
+	if _, err := r.ReadAt(data, b.offset); err != nil {
+		return nil, errors.Wrapf(err, "couldn't read box [%v]", b.typ)
+	}
+	return data, nil
+}
+
+// parseMovie reads the tracks of an MP4 file. Errors about the structure of the file are wrapped in ErrUnsupported
+func parseMovie(r io.ReaderAt, size int64) (*movie, error) {
+	boxes, err := readBoxes(r, 0, size)
+	if err != nil {
+		return nil, errors.Wrap(ErrUnsupported, err.Error())
+	}
+	moov, ok := findBox(boxes, "moov")
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupported, "not an MP4 file")
+	}
+	children, err := readBoxes(r, moov.offset, moov.offset+moov.size)
+	if err != nil {
+		return nil, errors.Wrap(ErrUnsupported, err.Error())
+	}
+	if _, ok = findBox(children, "mvex"); ok {
+		return nil, errors.Wrap(ErrUnsupported, "fragmented MP4 files are not supported")
+	}
+
+	m := &movie{}
+	movieTimescale := uint32(0)
+	if mvhd, ok := findBox(children, "mvhd"); ok {
+		data, err := readPayload(r, mvhd)
+		if err != nil {
+			return nil, err
+		}
+		p := &parser{data: data}
+		if p.u8() == 1 {
+			p.skip(3 + 16)
+			movieTimescale = p.u32()
+			if duration := p.u64(); movieTimescale != 0 {
+				m.duration = float64(duration) / float64(movieTimescale)
+			}
+		} else {
+			p.skip(3 + 8)
+			movieTimescale = p.u32()
+			if duration := p.u32(); movieTimescale != 0 {
+				m.duration = float64(duration) / float64(movieTimescale)
+			}
+		}
+		if p.err {
+			return nil, errors.Wrap(ErrUnsupported, "invalid mvhd box")
+		}
+	}
+
+	for _, trak := range children {
+		if trak.typ != "trak" {
+			continue
+		}
+		t, err := parseTrack(r, trak, movieTimescale)
+		if err != nil {
+			return nil, errors.Wrap(ErrUnsupported, err.Error())
+		}
+		switch {
+		case t == nil || len(t.samples) == 0:
+		case t.handler == "vide":
+			m.videos = append(m.videos, t)
+		case t.handler == "soun" && m.audio == nil:
+			m.audio = t
+		}
+	}
+	if len(m.videos) == 0 {
+		return nil, errors.Wrap(ErrUnsupported, "no H.264 video track")
+	}
+	for _, t := range m.videos {
+		if t.end() > m.duration {
+			m.duration = t.end()
+		}
+	}
+	if m.audio != nil && m.audio.end() > m.duration {
+		m.duration = m.audio.end()
+	}
+	return m, nil
+}
+
+// parseTrack returns nil for the tracks that are neither H.264 video nor AAC audio
+func parseTrack(r io.ReaderAt, trak box, movieTimescale uint32) (*track, error) {
+	mdia, err := childBox(r, trak, "mdia")
+	if err != nil {
+		return nil, err
+	}
+	t := &track{}
+
+	hdlr, err := childBox(r, mdia, "hdlr")
+	if err != nil {
+		return nil, err
+	}
+	data, err := readPayload(r, hdlr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{data: data}
+	p.skip(8)
+	t.handler = string(p.bytes(4))
+	if p.err {
+		return nil, errors.New("invalid hdlr box")
+	}
+	if t.handler != "vide" && t.handler != "soun" {
+		return nil, nil
+	}
+
+	mdhd, err := childBox(r, mdia, "mdhd")
+	if err != nil {
+		return nil, err
+	}
+	if data, err = readPayload(r, mdhd); err != nil {
+		return nil, err
+	}
+	p = &parser{data: data}
+	if p.u8() == 1 {
+		p.skip(3 + 16)
+	} else {
+		p.skip(3 + 8)
+	}
+	t.timescale = p.u32()
+	if p.err || t.timescale == 0 {
+		return nil, errors.New("invalid mdhd box")
+	}
+
+	if elst, err := childBox(r, trak, "edts", "elst"); err == nil && movieTimescale != 0 {
+		if data, err = readPayload(r, elst); err != nil {
+			return nil, err
+		}
+		t.parseEditList(data, movieTimescale)
+	}
+
+	stbl, err := childBox(r, mdia, "minf", "stbl")
+	if err != nil {
+		return nil, err
+	}
+	tables, err := readBoxes(r, stbl.offset, stbl.offset+stbl.size)
+	if err != nil {
+		return nil, err
+	}
+	stsd, ok := findBox(tables, "stsd")
+	if !ok {
+		return nil, errors.New("missing box [stsd]")
+	}
+	supported, err := t.parseSampleDescription(r, stsd)
+	if err != nil || !supported {
+		return nil, err
+	}
+	if t.samples, err = readSampleTables(r, tables); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseEditList keeps the simple edit lists written by encoders: optional empty edits followed by one media edit
+func (t *track) parseEditList(data []byte, movieTimescale uint32) {
+	p := &parser{data: data}
+	version := p.u8()
+	p.skip(3)
+	count := p.u32()
+	for i := uint32(0); i < count && !p.err; i++ {
+		var duration uint64
+		var mediaTime int64
+		if version == 1 {
+			duration, mediaTime = p.u64(), int64(p.u64())
+		} else {
+			duration, mediaTime = uint64(p.u32()), int64(int32(p.u32()))
+		}
+		p.skip(4)
+		if p.err {
+			return
+		}
+		if mediaTime == -1 {
+			t.delay += float64(duration) / float64(movieTimescale)
+			continue
+		}
+		t.mediaTime = mediaTime
+		return
+	}
+}
+
+func (t *track) parseSampleDescription(r io.ReaderAt, stsd box) (bool, error) {
+	entries, err := readBoxes(r, stsd.offset+8, stsd.offset+stsd.size)
+	if err != nil {
+		return false, err
+	}
+	if len(entries) == 0 {
+		return false, errors.New("empty stsd box")
+	}
+	entry := entries[0]
+	data, err := readPayload(r, entry)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case t.handler == "vide" && (entry.typ == "avc1" || entry.typ == "avc3"):
+		const visualSampleEntrySize = 78
+		p := &parser{data: data}
+		p.skip(24)
+		t.width, t.height = p.u16(), p.u16()
+		if p.err || len(data) < visualSampleEntrySize {
+			return false, errors.New("invalid avc1 box")
+		}
+		avcC, err := childBox(r, box{offset: entry.offset + visualSampleEntrySize, size: entry.size - visualSampleEntrySize}, "avcC")
+		if err != nil {
+			return false, err
+		}
+		if data, err = readPayload(r, avcC); err != nil {
+			return false, err
+		}
+		return true, t.parseAvcConfig(data)
+
+	case t.handler == "soun" && entry.typ == "mp4a":
+		p := &parser{data: data}
+		p.skip(8)
+		extra := int64(0)
+		switch p.u16() {
+		case 1:
+			extra = 16
+		case 2:
+			extra = 36
+		}
+		const audioSampleEntrySize = 28
+		if p.err || int64(len(data)) < audioSampleEntrySize+extra {
+			return false, errors.New("invalid mp4a box")
+		}
+		start := entry.offset + audioSampleEntrySize + extra
+		esds, err := childBox(r, box{offset: start, size: entry.offset + entry.size - start}, "esds")
+		if err != nil {
+			return false, err
+		}
+		if data, err = readPayload(r, esds); err != nil {
+			return false, err
+		}
+		return true, t.parseEsds(data)
+
+	case t.handler == "soun":
+		return false, errors.Errorf("audio codec [%v] is not AAC", entry.typ)
+	}
+	return false, nil
+}
+
+func (t *track) parseAvcConfig(data []byte) error {
+	p := &parser{data: data}
+	p.skip(1)
+	profile, compatibility, level := p.u8(), p.u8(), p.u8()
+	t.lengthSize = int(p.u8()&3) + 1
+	count := int(p.u8() & 0x1f)
+	for i := 0; i < count; i++ {
+		t.sps = append(t.sps, p.bytes(int(p.u16())))
+	}
+	count = int(p.u8())
+	for i := 0; i < count; i++ {
+		t.pps = append(t.pps, p.bytes(int(p.u16())))
+	}
+	if p.err || len(t.sps) == 0 || len(t.pps) == 0 {
+		return errors.New("invalid avcC box")
+	}
+	t.codec = fmt.Sprintf("avc1.%02x%02x%02x", profile, compatibility, level)
+	return nil
+}
+
+// parseEsds reads the AudioSpecificConfig of the track, needed to write the ADTS headers
+func (t *track) parseEsds(data []byte) error {
+	p := &parser{data: data}
+	p.skip(4)
+	if tag, _ := p.descriptor(); tag != 0x03 {
+		return errors.New("invalid esds box")
+	}
+	p.skip(2)
+	flags := p.u8()
+	if flags&0x80 != 0 {
+		p.skip(2)
+	}
+	if flags&0x40 != 0 {
+		p.skip(int(p.u8()))
+	}
+	if flags&0x20 != 0 {
+		p.skip(2)
+	}
+	if tag, _ := p.descriptor(); tag != 0x04 {
+		return errors.New("invalid esds box")
+	}
+	objectTypeIndication := p.u8()
+	p.skip(12)
+	if objectTypeIndication != 0x40 && (objectTypeIndication < 0x66 || objectTypeIndication > 0x68) {
+		return errors.Errorf("audio object type [%#x] is not AAC", objectTypeIndication)
+	}
+	tag, size := p.descriptor()
+	config := p.bytes(size)
+	if p.err || tag != 0x05 {
+		return errors.New("invalid esds box")
+	}
+
+	bits := &bitReader{data: config}
+	objectType := bits.read(5)
+	if objectType == 31 {
+		objectType = 32 + bits.read(6)
+	}
+	t.codec = fmt.Sprintf("mp4a.40.%d", objectType)
+	t.frequencyIndex = uint8(bits.read(4))
+	t.channels = uint8(bits.read(4))
+	if objectType == 5 || objectType == 29 {
+		// Explicit SBR signaling, the ADTS headers describe the core AAC stream
+		if bits.read(4) == 15 {
+			bits.read(24)
+		}
+		objectType = bits.read(5)
+	}
+	if bits.err || t.frequencyIndex == 15 || objectType < 1 || objectType > 4 {
+		return errors.New("unsupported AAC configuration")
+	}
+	t.objectType = uint8(objectType)
+	return nil
+}
+
+// readSampleTables resolves the position, time and size of each sample of the track
+func readSampleTables(r io.ReaderAt, tables []box) ([]sample, error) {
+	table := func(typ string) (*parser, error) {
+		b, ok := findBox(tables, typ)
+		if !ok {
+			return nil, nil
+		}
+		data, err := readPayload(r, b)
+		if err != nil {
+			return nil, err
+		}
+		p := &parser{data: data}
+		p.skip(4)
+		return p, nil
+	}
+
+	// Sizes
+	var samples []sample
+	if stsz, err := table("stsz"); err != nil {
+		return nil, err
+	} else if stsz != nil {
+		uniformSize, count := stsz.u32(), stsz.u32()
+		if uniformSize == 0 && int64(count)*4 > int64(len(stsz.data)) {
+			return nil, errors.New("invalid stsz box")
+		}
+		samples = make([]sample, count)
+		for i := range samples {
+			if samples[i].size = uniformSize; uniformSize == 0 {
+				samples[i].size = stsz.u32()
+			}
+		}
+		if stsz.err {
+			return nil, errors.New("invalid stsz box")
+		}
+	} else if stz2, err := table("stz2"); err != nil {
+		return nil, err
+	} else if stz2 != nil {
+		stz2.skip(3)
+		fieldSize, count := stz2.u8(), stz2.u32()
+		if fieldSize != 4 && fieldSize != 8 && fieldSize != 16 || (int64(count)*int64(fieldSize)+7)/8 > int64(len(stz2.data)-stz2.pos) {
+			return nil, errors.New("invalid stz2 box")
+		}
+		samples = make([]sample, count)
+		for i := range samples {
+			switch fieldSize {
+			case 4:
+				if i%2 == 0 {
+					samples[i].size = uint32(stz2.data[stz2.pos] >> 4)
+				} else {
+					samples[i].size = uint32(stz2.u8() & 0x0f)
+				}
+			case 8:
+				samples[i].size = uint32(stz2.u8())
+			case 16:
+				samples[i].size = uint32(stz2.u16())
+			}
+		}
+		if stz2.err {
+			return nil, errors.New("invalid stz2 box")
+		}
+	} else {
+		return nil, errors.New("missing sample size table")
+	}
+
+	// Decoding times
+	stts, err := table("stts")
+	if err != nil || stts == nil {
+		return nil, errors.New("missing box [stts]")
+	}
+	dts, index := int64(0), 0
+	for entries := stts.u32(); entries > 0 && !stts.err; entries-- {
+		count, delta := stts.u32(), int64(stts.u32())
+		for ; count > 0 && index < len(samples); count-- {
+			samples[index].dts = dts
+			dts += delta
+			index++
+		}
+	}
+	if stts.err || index != len(samples) {
+		return nil, errors.New("invalid stts box")
+	}
+
+	// Composition offsets
+	if ctts, err := table("ctts"); err != nil {
+		return nil, err
+	} else if ctts != nil {
+		index = 0
+		for entries := ctts.u32(); entries > 0 && !ctts.err; entries-- {
+			count, offset := ctts.u32(), int64(int32(ctts.u32()))
+			for ; count > 0 && index < len(samples); count-- {
+				samples[index].cts = offset
+				index++
+			}
+		}
+		if ctts.err {
+			return nil, errors.New("invalid ctts box")
+		}
+	}
+
+	// Sync samples, every sample is a sync sample when the table is missing
+	if stss, err := table("stss"); err != nil {
+		return nil, err
+	} else if stss != nil {
+		for entries := stss.u32(); entries > 0 && !stss.err; entries-- {
+			if number := stss.u32(); number >= 1 && int(number) <= len(samples) {
+				samples[number-1].sync = true
+			}
+		}
+		if stss.err {
+			return nil, errors.New("invalid stss box")
+		}
+	} else {
+		for i := range samples {
+			samples[i].sync = true
+		}
+	}
+
+	// Chunk offsets
+	var chunkOffsets []int64
+	if stco, err := table("stco"); err != nil {
+		return nil, err
+	} else if stco != nil {
+		count := stco.u32()
+		if int64(count)*4 > int64(len(stco.data)) {
+			return nil, errors.New("invalid stco box")
+		}
+		for i := uint32(0); i < count; i++ {
+			chunkOffsets = append(chunkOffsets, int64(stco.u32()))
+		}
+	} else if co64, err := table("co64"); err != nil {
+		return nil, err
+	} else if co64 != nil {
+		count := co64.u32()
+		if int64(count)*8 > int64(len(co64.data)) {
+			return nil, errors.New("invalid co64 box")
+		}
+		for i := uint32(0); i < count; i++ {
+			chunkOffsets = append(chunkOffsets, int64(co64.u64()))
+		}
+	} else {
+		return nil, errors.New("missing chunk offset table")
+	}
+
+	// Samples of each chunk
+	stsc, err := table("stsc")
+	if err != nil || stsc == nil {
+		return nil, errors.New("missing box [stsc]")
+	}
+	type chunkRun struct{ firstChunk, samplesPerChunk uint32 }
+	var runs []chunkRun
+	for entries := stsc.u32(); entries > 0 && !stsc.err; entries-- {
+		runs = append(runs, chunkRun{firstChunk: stsc.u32(), samplesPerChunk: stsc.u32()})
+		stsc.skip(4)
+	}
+	if stsc.err {
+		return nil, errors.New("invalid stsc box")
+	}
+	index = 0
+	for i, run := range runs {
+		lastChunk := uint32(len(chunkOffsets))
+		if i+1 < len(runs) {
+			lastChunk = runs[i+1].firstChunk - 1
+		}
+		for chunk := run.firstChunk; chunk >= 1 && chunk <= lastChunk && int(chunk) <= len(chunkOffsets); chunk++ {
+			offset := chunkOffsets[chunk-1]
+			for n := uint32(0); n < run.samplesPerChunk && index < len(samples); n++ {
+				samples[index].offset = offset
+				offset += int64(samples[index].size)
+				index++
+			}
+		}
+	}
+	if index != len(samples) {
+		return nil, errors.New("the chunks don't contain every sample")
+	}
+	return samples, nil
+}
+
+// parser reads big-endian values from a box payload, and remembers when the payload is too short
+type parser struct {
+	data []byte
+	pos  int
+	err  bool
+}
+
+func (p *parser) bytes(n int) []byte {
+	if n < 0 || p.pos+n > len(p.data) {
+		p.err = true
+		p.pos = len(p.data)
+		return nil
+	}
+	b := p.data[p.pos : p.pos+n]
+	p.pos += n
+	return b
+}
+
+func (p *parser) skip(n int) {
+	p.bytes(n)
+}
+
+func (p *parser) u8() uint8 {
+	if b := p.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (p *parser) u16() uint16 {
+	if b := p.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (p *parser) u32() uint32 {
+	if b := p.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (p *parser) u64() uint64 {
+	if b := p.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// descriptor reads the tag and size of an MPEG-4 descriptor
+func (p *parser) descriptor() (uint8, int) {
+	tag := p.u8()
+	size := 0
+	for i := 0; i < 4; i++ {
+		b := p.u8()
+		size = size<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return tag, size
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+	err  bool
+}
+
+func (b *bitReader) read(n int) uint32 {
+	value := uint32(0)
+	for i := 0; i < n; i++ {
+		if b.pos/8 >= len(b.data) {
+			b.err = true
+			return 0
+		}
+		value = value<<1 | uint32(b.data[b.pos/8]>>(7-b.pos%8)&1)
+		b.pos++
+	}
+	return value
+}
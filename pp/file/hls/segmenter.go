@@ -0,0 +1,409 @@
+package hls
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ptsBase shifts the timestamps so that the decoding times of the first B-frames stay positive
+	ptsBase = 126000
+	// pcrDelay is how far the program clock runs behind the decoding times of the video
+	pcrDelay = 63000
+	// audioPesDuration is the duration of the AAC frames grouped in one PES packet, in 90kHz units
+	audioPesDuration = 9000
+	// keyframeTolerance allows small differences between the keyframe times of the renditions, in seconds
+	keyframeTolerance = 0.001
+)
+
+// segment is a range of video samples, with the audio samples presented at the same time
+type segment struct {
+	name                     string
+	videoStart, videoEnd     int
+	audioStart, audioEnd     int
+	startTime, endTime, size float64
+}
+
+// rendition is a video track of the movie, packaged with the audio track in its own media playlist
+type rendition struct {
+	video    *track
+	playlist string
+	segments []segment
+}
+
+// Duration returns the duration in seconds of an MP4 file
+func Duration(path string) (float64, error) {
+	f, m, err := open(path)
+	if err != nil {
+		return 0, err
+	}
+	_ = f.Close()
+	return m.duration, nil
+}
+
+// Package splits an MP4 file with H.264 video and AAC audio in MPEG-TS segments of about targetDuration seconds, cut
+// at the keyframes, and writes the playlist in outDir. When the file has several H.264 tracks, for example the same
+// video encoded at different bitrates, each of them becomes a rendition and the playlist is a master playlist
+// referencing one media playlist per rendition. Nothing is transcoded
+func Package(path, outDir, playlistName string, targetDuration float64) error {
+	f, m, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if targetDuration < 1 {
+		targetDuration = 1
+	}
+
+	renditions := make([]*rendition, len(m.videos))
+	cutTimes := keyframeCuts(m.videos[0], targetDuration)
+	for i, video := range m.videos {
+		renditions[i] = &rendition{video: video, playlist: playlistName}
+		if len(m.videos) > 1 {
+			renditions[i].playlist = fmt.Sprintf("r%d.m3u8", i)
+		}
+		renditions[i].split(cutTimes, m, i, len(m.videos) > 1)
+	}
+
+	for _, r := range renditions {
+		if err = r.write(f, m.audio, outDir); err != nil {
+			return err
+		}
+	}
+	if len(renditions) > 1 {
+		return writeMasterPlaylist(filepath.Join(outDir, playlistName), renditions, m.audio)
+	}
+	return nil
+}
+
+func open(path string) (*os.File, *movie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "couldn't open the video")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, errors.Wrap(err, "couldn't open the video")
+	}
+	m, err := parseMovie(f, info.Size())
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return f, m, nil
+}
+
+// keyframeCuts returns the presentation times of the keyframes starting a new segment
+func keyframeCuts(video *track, targetDuration float64) []float64 {
+	var cuts []float64
+	start := 0.0
+	for i := 1; i < len(video.samples); i++ {
+		if !video.samples[i].sync {
+			continue
+		}
+		if t := video.presentationTime(i); t-start >= targetDuration {
+			cuts = append(cuts, t)
+			start = t
+		}
+	}
+	return cuts
+}
+
+// split cuts the rendition at its first keyframe after each cut time, so that the segments of all the renditions
+// cover the same time ranges when their keyframes are aligned
+func (r *rendition) split(cutTimes []float64, m *movie, index int, multiple bool) {
+	starts := []int{0}
+	next := 1
+	for _, cut := range cutTimes {
+		for next < len(r.video.samples) && !(r.video.samples[next].sync && r.video.presentationTime(next) >= cut-keyframeTolerance) {
+			next++
+		}
+		if next >= len(r.video.samples) {
+			break
+		}
+		starts = append(starts, next)
+		next++
+	}
+
+	audioIndex := func(t float64) int {
+		if m.audio == nil {
+			return 0
+		}
+		return sort.Search(len(m.audio.samples), func(i int) bool { return m.audio.presentationTime(i) >= t })
+	}
+	for i, start := range starts {
+		s := segment{
+			name:       fmt.Sprintf("%d.ts", i),
+			videoStart: start,
+			videoEnd:   len(r.video.samples),
+			startTime:  0,
+			endTime:    m.duration,
+		}
+		if multiple {
+			s.name = fmt.Sprintf("r%d_%d.ts", index, i)
+		}
+		if i > 0 {
+			s.startTime = r.video.presentationTime(start)
+		}
+		if i+1 < len(starts) {
+			s.videoEnd = starts[i+1]
+			s.endTime = r.video.presentationTime(starts[i+1])
+		}
+		if m.audio != nil {
+			s.audioStart, s.audioEnd = 0, len(m.audio.samples)
+			if i > 0 {
+				s.audioStart = audioIndex(s.startTime)
+			}
+			if i+1 < len(starts) {
+				s.audioEnd = audioIndex(s.endTime)
+			}
+		}
+		r.segments = append(r.segments, s)
+	}
+}
+
+// write creates the segments and the media playlist of the rendition
+func (r *rendition) write(f *os.File, audio *track, outDir string) error {
+	muxer := newTsMuxer(audio != nil)
+	var buffer []byte
+	read := func(s sample) ([]byte, error) {
+		if cap(buffer) < int(s.size) {
+			buffer = make([]byte, s.size)
+		}
+		buffer = buffer[:s.size]
+		if _, err := f.ReadAt(buffer, s.offset); err != nil {
+			return nil, errors.Wrap(err, "couldn't read video sample")
+		}
+		return buffer, nil
+	}
+
+	for i := range r.segments {
+		s := &r.segments[i]
+		out, err := os.Create(filepath.Join(outDir, s.name))
+		if err != nil {
+			return errors.Wrap(err, "couldn't create segment")
+		}
+		w := bufio.NewWriterSize(out, 256*1024)
+		err = r.writeSegment(muxer, w, s, audio, read)
+		if err == nil {
+			err = w.Flush()
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errors.Wrapf(err, "couldn't write segment %v", s.name)
+		}
+		if info, err := os.Stat(filepath.Join(outDir, s.name)); err == nil {
+			s.size = float64(info.Size())
+		}
+	}
+	return r.writeMediaPlaylist(filepath.Join(outDir, r.playlist))
+}
+
+func (r *rendition) writeSegment(muxer *tsMuxer, w *bufio.Writer, s *segment, audio *track, read func(sample) ([]byte, error)) error {
+	if err := muxer.reset(w); err != nil {
+		return err
+	}
+	video := r.video
+
+	var adts []byte
+	adtsPts := int64(-1)
+	flushAudio := func() error {
+		if len(adts) == 0 {
+			return nil
+		}
+		err := muxer.writeAudio(adts, adtsPts)
+		adts, adtsPts = adts[:0], -1
+		return err
+	}
+
+	audioIndex := s.audioStart
+	for i := s.videoStart; i < s.videoEnd; i++ {
+		vs := video.samples[i]
+		dts := video.to90k(vs.dts) + ptsBase
+
+		// Interleave the audio frames decoded before this video frame
+		for ; audio != nil && audioIndex < s.audioEnd; audioIndex++ {
+			as := audio.samples[audioIndex]
+			pts := audio.to90k(as.dts+as.cts) + ptsBase
+			if pts > dts {
+				break
+			}
+			if err := appendAdts(&adts, &adtsPts, audio, as, pts, read); err != nil {
+				return err
+			}
+			if pts-adtsPts >= audioPesDuration {
+				if err := flushAudio(); err != nil {
+					return err
+				}
+			}
+		}
+
+		data, err := read(vs)
+		if err != nil {
+			return err
+		}
+		accessUnit, err := annexB(data, video, vs.sync)
+		if err != nil {
+			return err
+		}
+		pts := video.to90k(vs.dts+vs.cts) + ptsBase
+		if err = muxer.writeVideo(accessUnit, pts, dts, dts-pcrDelay, vs.sync); err != nil {
+			return err
+		}
+	}
+
+	for ; audio != nil && audioIndex < s.audioEnd; audioIndex++ {
+		as := audio.samples[audioIndex]
+		pts := audio.to90k(as.dts+as.cts) + ptsBase
+		if err := appendAdts(&adts, &adtsPts, audio, as, pts, read); err != nil {
+			return err
+		}
+		if pts-adtsPts >= audioPesDuration {
+			if err := flushAudio(); err != nil {
+				return err
+			}
+		}
+	}
+	return flushAudio()
+}
+
+func appendAdts(adts *[]byte, adtsPts *int64, audio *track, s sample, pts int64, read func(sample) ([]byte, error)) error {
+	data, err := read(s)
+	if err != nil {
+		return err
+	}
+	if *adtsPts < 0 {
+		*adtsPts = pts
+	}
+	frameLength := len(data) + 7
+	if frameLength > 0x1fff {
+		return errors.New("AAC frame too big for ADTS")
+	}
+	*adts = append(*adts,
+		0xff, 0xf1,
+		(audio.objectType-1)<<6|audio.frequencyIndex<<2|audio.channels>>2,
+		(audio.channels&0x03)<<6|byte(frameLength>>11),
+		byte(frameLength>>3),
+		byte(frameLength&0x07)<<5|0x1f,
+		0xfc)
+	*adts = append(*adts, data...)
+	return nil
+}
+
+// annexB converts a sample made of length-prefixed NAL units to an access unit with start codes. The parameter sets
+// are repeated before every keyframe, so that each segment can be decoded on its own
+func annexB(data []byte, video *track, keyframe bool) ([]byte, error) {
+	startCode := []byte{0x00, 0x00, 0x00, 0x01}
+	out := make([]byte, 0, len(data)+64)
+	out = append(out, 0x00, 0x00, 0x00, 0x01, 0x09, 0xf0) // access unit delimiter
+
+	var nalUnits [][]byte
+	hasParameterSets := false
+	for len(data) > 0 {
+		if len(data) < video.lengthSize {
+			return nil, errors.New("truncated NAL unit")
+		}
+		size := 0
+		for _, b := range data[:video.lengthSize] {
+			size = size<<8 | int(b)
+		}
+		data = data[video.lengthSize:]
+		if size > len(data) {
+			return nil, errors.New("truncated NAL unit")
+		}
+		nal := data[:size]
+		data = data[size:]
+		if len(nal) == 0 {
+			continue
+		}
+		switch nal[0] & 0x1f {
+		case 9: // access unit delimiter, already written
+			continue
+		case 7:
+			hasParameterSets = true
+		}
+		nalUnits = append(nalUnits, nal)
+	}
+
+	if keyframe && !hasParameterSets {
+		for _, sps := range video.sps {
+			out = append(append(out, startCode...), sps...)
+		}
+		for _, pps := range video.pps {
+			out = append(append(out, startCode...), pps...)
+		}
+	}
+	for _, nal := range nalUnits {
+		out = append(append(out, startCode...), nal...)
+	}
+	return out, nil
+}
+
+func (r *rendition) writeMediaPlaylist(path string) error {
+	targetDuration := 1
+	for _, s := range r.segments {
+		if d := int(math.Ceil(s.endTime - s.startTime)); d > targetDuration {
+			targetDuration = d
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	sb.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", targetDuration))
+	sb.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for _, s := range r.segments {
+		sb.WriteString(fmt.Sprintf("#EXTINF:%.6f,\n%s\n", s.endTime-s.startTime, s.name))
+	}
+	sb.WriteString("#EXT-X-ENDLIST\n")
+	return errors.Wrap(os.WriteFile(path, []byte(sb.String()), 0644), "couldn't write media playlist")
+}
+
+// bandwidth returns the peak and average bitrates of the rendition, in bits per second
+func (r *rendition) bandwidth() (peak, average uint64) {
+	totalSize, totalDuration := 0.0, 0.0
+	for _, s := range r.segments {
+		duration := s.endTime - s.startTime
+		if duration <= 0 {
+			continue
+		}
+		if rate := uint64(s.size * 8 / duration); rate > peak {
+			peak = rate
+		}
+		totalSize += s.size
+		totalDuration += duration
+	}
+	if totalDuration > 0 {
+		average = uint64(totalSize * 8 / totalDuration)
+	}
+	if peak == 0 {
+		peak = average
+	}
+	return peak, average
+}
+
+func writeMasterPlaylist(path string, renditions []*rendition, audio *track) error {
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, r := range renditions {
+		peak, average := r.bandwidth()
+		codecs := r.video.codec
+		if audio != nil {
+			codecs += "," + audio.codec
+		}
+		sb.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\"\n%s\n",
+			peak, average, r.video.width, r.video.height, codecs, r.playlist))
+	}
+	return errors.Wrap(os.WriteFile(path, []byte(sb.String()), 0644), "couldn't write master playlist")
+}
@@ -0,0 +1,244 @@
+package hls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testFps         = 25
+	testGop         = 25
+	testFrames      = 250
+	testAudioRate   = 44100
+	testAudioFrames = testFrames * testAudioRate / 1024 / testFps
+)
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	content := bytes.Join(payload, nil)
+	out := make([]byte, 8, 8+len(content))
+	binary.BigEndian.PutUint32(out, uint32(8+len(content)))
+	copy(out[4:], typ)
+	return append(out, content...)
+}
+
+func u32s(values ...uint32) []byte {
+	out := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(out[4*i:], v)
+	}
+	return out
+}
+
+// testTrack builds a trak box whose samples are stored in one chunk at dataOffset
+func testTrack(handler string, timescale, delta uint32, sizes []uint32, syncs []uint32, sampleEntry []byte, dataOffset uint32) []byte {
+	stsz := u32s(0, 0, uint32(len(sizes)))
+	stsz = append(stsz, u32s(sizes...)...)
+	var stss []byte
+	if syncs != nil {
+		stss = mp4Box("stss", u32s(0, uint32(len(syncs))), u32s(syncs...))
+	}
+	stbl := mp4Box("stbl",
+		mp4Box("stsd", u32s(0, 1), sampleEntry),
+		mp4Box("stts", u32s(0, 1, uint32(len(sizes)), delta)),
+		stss,
+		mp4Box("stsc", u32s(0, 1, 1, uint32(len(sizes)), 1)),
+		mp4Box("stsz", stsz),
+		mp4Box("stco", u32s(0, 1, dataOffset)),
+	)
+	return mp4Box("trak",
+		mp4Box("mdia",
+			mp4Box("mdhd", u32s(0, 0, 0, timescale, delta*uint32(len(sizes)), 0)),
+			mp4Box("hdlr", u32s(0, 0), []byte(handler), make([]byte, 13)),
+			mp4Box("minf", stbl),
+		),
+	)
+}
+
+func avcSampleEntry(width, height uint16) []byte {
+	entry := make([]byte, 78)
+	binary.BigEndian.PutUint16(entry[24:], width)
+	binary.BigEndian.PutUint16(entry[26:], height)
+	sps := []byte{0x67, 0x64, 0x00, 0x1f, 0xac}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb}
+	avcC := []byte{1, 0x64, 0x00, 0x1f, 0xff, 0xe1, 0, byte(len(sps))}
+	avcC = append(avcC, sps...)
+	avcC = append(avcC, 1, 0, byte(len(pps)))
+	avcC = append(avcC, pps...)
+	return mp4Box("avc1", entry, mp4Box("avcC", avcC))
+}
+
+func aacSampleEntry() []byte {
+	entry := make([]byte, 28)
+	binary.BigEndian.PutUint16(entry[16:], 2)
+	asc := []byte{0x12, 0x10} // AAC-LC, 44.1kHz, stereo
+	decoderConfig := append([]byte{0x04, byte(13 + 2 + len(asc)), 0x40, 0x15}, make([]byte, 11)...)
+	decoderConfig = append(decoderConfig, 0x05, byte(len(asc)))
+	decoderConfig = append(decoderConfig, asc...)
+	esDescriptor := append([]byte{0x03, byte(3 + len(decoderConfig)), 0, 1, 0}, decoderConfig...)
+	return mp4Box("mp4a", entry, mp4Box("esds", u32s(0), esDescriptor))
+}
+
+// writeTestMovie creates an MP4 file with two video tracks of different bitrates and one AAC track
+func writeTestMovie(t *testing.T, path string) {
+	var mdat []byte
+	var videoSizes [2][]uint32
+	var videoOffsets [2]uint32
+	var syncs []uint32
+	for track := 0; track < 2; track++ {
+		videoOffsets[track] = uint32(len(mdat))
+		for i := 0; i < testFrames; i++ {
+			nalType := byte(0x41)
+			if i%testGop == 0 {
+				nalType = 0x65
+				if track == 0 {
+					syncs = append(syncs, uint32(i+1))
+				}
+			}
+			nal := append([]byte{nalType}, bytes.Repeat([]byte{byte(i)}, 400*(track+1))...)
+			sample := append(u32s(uint32(len(nal))), nal...)
+			videoSizes[track] = append(videoSizes[track], uint32(len(sample)))
+			mdat = append(mdat, sample...)
+		}
+	}
+	audioOffset := uint32(len(mdat))
+	var audioSizes []uint32
+	for i := 0; i < testAudioFrames; i++ {
+		audioSizes = append(audioSizes, 300)
+		mdat = append(mdat, bytes.Repeat([]byte{0xaa}, 300)...)
+	}
+
+	ftyp := mp4Box("ftyp", []byte("isom"), u32s(0x200), []byte("isomavc1"))
+	build := func(base uint32) []byte {
+		return mp4Box("moov",
+			mp4Box("mvhd", u32s(0, 0, 0, 1000, testFrames*1000/testFps), make([]byte, 80)),
+			testTrack("vide", 90000, 90000/testFps, videoSizes[0], syncs, avcSampleEntry(1280, 720), base+videoOffsets[0]),
+			testTrack("vide", 90000, 90000/testFps, videoSizes[1], syncs, avcSampleEntry(1920, 1080), base+videoOffsets[1]),
+			testTrack("soun", testAudioRate, 1024, audioSizes, nil, aacSampleEntry(), base+audioOffset),
+		)
+	}
+	moovSize := uint32(len(build(0)))
+	data := append(ftyp, build(uint32(len(ftyp))+moovSize+8)...)
+	data = append(data, mp4Box("mdat", mdat)...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackage(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "movie.mp4")
+	writeTestMovie(t, input)
+	outDir := filepath.Join(dir, "hls")
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	duration, err := Duration(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duration != 10 {
+		t.Fatalf("expected a duration of 10s, got %v", duration)
+	}
+
+	if err = Package(input, outDir, "index.m3u8", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	master, err := os.ReadFile(filepath.Join(outDir, "index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"RESOLUTION=1280x720", "RESOLUTION=1920x1080", `CODECS="avc1.64001f,mp4a.40.2"`, "r0.m3u8", "r1.m3u8"} {
+		if !strings.Contains(string(master), expected) {
+			t.Fatalf("master playlist is missing %v:\n%s", expected, master)
+		}
+	}
+
+	for rendition := 0; rendition < 2; rendition++ {
+		prefix := "r" + string(rune('0'+rendition))
+		playlist, err := os.ReadFile(filepath.Join(outDir, prefix+".m3u8"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keyframes every second and a 3s target give segments starting at 0, 3, 6 and 9s
+		if count := strings.Count(string(playlist), "#EXTINF:"); count != 4 {
+			t.Fatalf("expected 4 segments, got %v:\n%s", count, playlist)
+		}
+		if !strings.Contains(string(playlist), "#EXT-X-TARGETDURATION:3\n") || !strings.Contains(string(playlist), "#EXTINF:1.000000,\n"+prefix+"_3.ts") {
+			t.Fatalf("unexpected playlist:\n%s", playlist)
+		}
+
+		videoFrames, audioFrames := 0, 0
+		for i := 0; i < 4; i++ {
+			data, err := os.ReadFile(filepath.Join(outDir, prefix+"_"+string(rune('0'+i))+".ts"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, a := checkTransportStream(t, data)
+			videoFrames += v
+			audioFrames += a
+		}
+		if videoFrames != testFrames || audioFrames != testAudioFrames {
+			t.Fatalf("expected %v video and %v audio frames, got %v and %v", testFrames, testAudioFrames, videoFrames, audioFrames)
+		}
+	}
+
+	if err = Package(filepath.Join(dir, "index.m3u8"), outDir, "index.m3u8", 3); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+	if err = os.WriteFile(filepath.Join(dir, "movie.mkv"), []byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f, 0x42, 0x86, 0x81}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = Package(filepath.Join(dir, "movie.mkv"), outDir, "index.m3u8", 3); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+// checkTransportStream checks the packets of a segment and counts the access units and ADTS frames it contains
+func checkTransportStream(t *testing.T, data []byte) (int, int) {
+	if len(data)%tsPacketSize != 0 {
+		t.Fatalf("segment size %v is not a multiple of %v", len(data), tsPacketSize)
+	}
+	var video, audio []byte
+	for offset := 0; offset < len(data); offset += tsPacketSize {
+		packet := data[offset : offset+tsPacketSize]
+		if packet[0] != 0x47 {
+			t.Fatalf("missing sync byte at %v", offset)
+		}
+		pid := uint16(packet[1]&0x1f)<<8 | uint16(packet[2])
+		payload := packet[4:]
+		if packet[3]&0x20 != 0 {
+			payload = packet[5+int(packet[4]):]
+		}
+		if packet[1]&0x40 != 0 && (pid == videoPid || pid == audioPid) {
+			if !bytes.HasPrefix(payload, []byte{0, 0, 1}) {
+				t.Fatalf("PES packet without start code at %v", offset)
+			}
+			payload = payload[9+int(payload[8]):]
+		}
+		switch pid {
+		case videoPid:
+			video = append(video, payload...)
+		case audioPid:
+			audio = append(audio, payload...)
+		}
+	}
+	if offset := bytes.Index(video, []byte{0, 0, 0, 1, 0x67}); offset != 6 {
+		t.Fatalf("segment doesn't start with an access unit delimiter and the SPS, found it at %v", offset)
+	}
+	audioFrames := 0
+	for len(audio) > 0 {
+		if audio[0] != 0xff || audio[1]&0xf0 != 0xf0 {
+			t.Fatal("invalid ADTS header")
+		}
+		audio = audio[int(audio[3]&0x03)<<11|int(audio[4])<<3|int(audio[5])>>5:]
+		audioFrames++
+	}
+	return bytes.Count(video, []byte{0, 0, 0, 1, 0x09, 0xf0}), audioFrames
+}
@@ -0,0 +1,227 @@
+package hls
+
+import (
+	"io"
+)
+
+const (
+	tsPacketSize  = 188
+	tsPayloadSize = tsPacketSize - 4
+
+	patPid   = 0x0000
+	pmtPid   = 0x1000
+	videoPid = 0x0100
+	audioPid = 0x0101
+
+	streamTypeH264 = 0x1b
+	streamTypeAac  = 0x0f
+
+	videoStreamId = 0xe0
+	audioStreamId = 0xc0
+)
+
+// tsMuxer writes H.264 and AAC elementary streams as MPEG-TS packets. The continuity counters are kept from one
+// segment to the next, so the segments of a playlist form a continuous transport stream
+type tsMuxer struct {
+	w          io.Writer
+	hasAudio   bool
+	continuity map[uint16]uint8
+	packet     [tsPacketSize]byte
+}
+
+func newTsMuxer(hasAudio bool) *tsMuxer {
+	return &tsMuxer{hasAudio: hasAudio, continuity: make(map[uint16]uint8)}
+}
+
+// reset starts a new segment written to w. Every segment starts with the program tables
+func (m *tsMuxer) reset(w io.Writer) error {
+	m.w = w
+	if err := m.writeSection(patPid, m.pat()); err != nil {
+		return err
+	}
+	return m.writeSection(pmtPid, m.pmt())
+}
+
+func (m *tsMuxer) pat() []byte {
+	return []byte{
+		0x00,       // table_id
+		0xb0, 0x0d, // section_length
+		0x00, 0x01, // transport_stream_id
+		0xc1, 0x00, 0x00,
+		0x00, 0x01, // program_number
+		0xe0 | pmtPid>>8, pmtPid & 0xff,
+	}
+}
+
+func (m *tsMuxer) pmt() []byte {
+	streams := []byte{streamTypeH264, 0xe0 | videoPid>>8, videoPid & 0xff, 0xf0, 0x00}
+	if m.hasAudio {
+		streams = append(streams, streamTypeAac, 0xe0|audioPid>>8, audioPid&0xff, 0xf0, 0x00)
+	}
+	sectionLength := 9 + len(streams) + 4
+	section := []byte{
+		0x02, // table_id
+		0xb0 | byte(sectionLength>>8), byte(sectionLength),
+		0x00, 0x01, // program_number
+		0xc1, 0x00, 0x00,
+		0xe0 | videoPid>>8, videoPid & 0xff, // PCR_PID
+		0xf0, 0x00, // program_info_length
+	}
+	return append(section, streams...)
+}
+
+// writeSection writes a PSI table, with its CRC, in a single packet
+func (m *tsMuxer) writeSection(pid uint16, section []byte) error {
+	p := m.packet[:]
+	m.header(pid, true, false)
+	p[4] = 0x00 // pointer_field
+	n := 5 + copy(p[5:], section)
+	crc := crc32Mpeg(section)
+	p[n], p[n+1], p[n+2], p[n+3] = byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc)
+	for i := n + 4; i < tsPacketSize; i++ {
+		p[i] = 0xff
+	}
+	_, err := m.w.Write(p)
+	return err
+}
+
+func (m *tsMuxer) header(pid uint16, unitStart, adaptationField bool) {
+	p := m.packet[:]
+	p[0] = 0x47
+	p[1] = byte(pid>>8) & 0x1f
+	if unitStart {
+		p[1] |= 0x40
+	}
+	p[2] = byte(pid)
+	p[3] = 0x10 | m.continuity[pid]&0x0f
+	if adaptationField {
+		p[3] |= 0x20
+	}
+	m.continuity[pid] = (m.continuity[pid] + 1) & 0x0f
+}
+
+// writeVideo writes an H.264 access unit in Annex B format. pcr is written in the first packet
+func (m *tsMuxer) writeVideo(data []byte, pts, dts, pcr int64, keyframe bool) error {
+	header := pesHeader(videoStreamId, len(data), pts, dts)
+	return m.writePes(videoPid, append(header, data...), pcr, keyframe)
+}
+
+// writeAudio writes ADTS frames
+func (m *tsMuxer) writeAudio(data []byte, pts int64) error {
+	header := pesHeader(audioStreamId, len(data), pts, pts)
+	return m.writePes(audioPid, append(header, data...), -1, false)
+}
+
+func pesHeader(streamId byte, payloadSize int, pts, dts int64) []byte {
+	headerDataLength := 5
+	if dts != pts {
+		headerDataLength = 10
+	}
+	header := make([]byte, 9+headerDataLength)
+	header[2] = 0x01
+	header[3] = streamId
+	// Video PES packets are unbounded, the length is only set when it fits
+	if length := 3 + headerDataLength + payloadSize; streamId != videoStreamId && length <= 0xffff {
+		header[4], header[5] = byte(length>>8), byte(length)
+	}
+	header[6] = 0x80
+	header[8] = byte(headerDataLength)
+	if dts != pts {
+		header[7] = 0xc0
+		putTimestamp(header[9:], 0x3, pts)
+		putTimestamp(header[14:], 0x1, dts)
+	} else {
+		header[7] = 0x80
+		putTimestamp(header[9:], 0x2, pts)
+	}
+	return header
+}
+
+func putTimestamp(b []byte, marker byte, ts int64) {
+	b[0] = marker<<4 | byte(ts>>29)&0x0e | 0x01
+	b[1] = byte(ts >> 22)
+	b[2] = byte(ts>>14) | 0x01
+	b[3] = byte(ts >> 7)
+	b[4] = byte(ts<<1) | 0x01
+}
+
+// writePes splits a PES packet in TS packets. The last packet is padded with stuffing bytes in its adaptation field
+func (m *tsMuxer) writePes(pid uint16, pes []byte, pcr int64, randomAccess bool) error {
+	p := m.packet[:]
+	first := true
+	for len(pes) > 0 {
+		var adaptation []byte // adaptation field, after its length byte
+		if first && (pcr >= 0 || randomAccess) {
+			flags := byte(0)
+			if randomAccess {
+				flags |= 0x40
+			}
+			adaptation = append(adaptation, flags)
+			if pcr >= 0 {
+				adaptation[0] |= 0x10
+				adaptation = append(adaptation, byte(pcr>>25), byte(pcr>>17), byte(pcr>>9), byte(pcr>>1), byte(pcr<<7)|0x7e, 0x00)
+			}
+		}
+		hasAdaptation := len(adaptation) > 0
+		available := tsPayloadSize
+		if hasAdaptation {
+			available -= 1 + len(adaptation)
+		}
+		n := len(pes)
+		if n > available {
+			n = available
+		}
+		if stuffing := available - n; stuffing > 0 {
+			if !hasAdaptation {
+				hasAdaptation = true
+				stuffing-- // length byte
+				if stuffing > 0 {
+					adaptation = append(adaptation, 0x00)
+					stuffing--
+				}
+			}
+			for ; stuffing > 0; stuffing-- {
+				adaptation = append(adaptation, 0xff)
+			}
+		}
+
+		m.header(pid, first, hasAdaptation)
+		offset := 4
+		if hasAdaptation {
+			p[4] = byte(len(adaptation))
+			offset = 5 + copy(p[5:], adaptation)
+		}
+		copy(p[offset:], pes[:n])
+		if _, err := m.w.Write(p); err != nil {
+			return err
+		}
+		pes = pes[n:]
+		first = false
+	}
+	return nil
+}
+
+var crcTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// crc32Mpeg is the CRC of the PSI tables (MPEG-2 polynomial, no reflection)
+func crc32Mpeg(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
@@ -0,0 +1,130 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/crypto"
+	"github.com/stratosnet/sds/pp/file/slicestore"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+// QUARANTINE_FOLDER is the folder of the storage path where corrupted slices are moved
+const QUARANTINE_FOLDER = "quarantine"
+
+var ErrSliceOriginUnknown = errors.New("the file the slice belongs to is unknown")
+
+func getQuarantinePath() string {
+	return filepath.Join(setting.Config.Home.StoragePath, QUARANTINE_FOLDER)
+}
+
+// WalkStoredSlices calls fn for each slice of the storage backend, until fn returns an error or ctx is done
+func WalkStoredSlices(ctx context.Context, fn func(info slicestore.SliceInfo) error) error {
+	return getSliceStore().Walk(ctx, fn)
+}
+
+// VerifyStoredSlice recalculates the hash of a stored slice. ErrSliceOriginUnknown is returned when the slice isn't
+// deduplicated and its origin wasn't recorded. This is the case of the slices stored by older versions of the node, until
+// their origin is given by the SP
+func VerifyStoredSlice(sliceHash string) (bool, error) {
+	data, err := readSliceData(sliceHash)
+	if err != nil {
+		return false, errors.Wrap(err, "failed reading slice")
+	}
+	if IsDeduplicatedSlice(sliceHash, data) {
+		return true, nil
+	}
+	fileHash, sliceNumber, err := GetSliceOrigin(sliceHash)
+	if err != nil {
+		return false, err
+	}
+	if fileHash == "" {
+		// deduplicated slices have references, and their hash no longer matches their content
+		if refs, err := GetSliceRefs(sliceHash); err == nil && len(refs) > 0 {
+			return false, nil
+		}
+		return false, ErrSliceOriginUnknown
+	}
+	calculated, err := crypto.CalcSliceHash(data, fileHash, sliceNumber)
+	if err != nil {
+		return false, err
+	}
+	return calculated == sliceHash, nil
+}
+
+// BackfillSliceOrigin records the origin of a slice stored without one, as given by the SP when it requests the slice.
+// The origin is only recorded when it matches the hash of the slice, so that a wrong origin can't get a valid slice
+// quarantined by the next scrub
+func BackfillSliceOrigin(sliceHash, fileHash string, sliceNumber uint64) error {
+	if recorded, _, err := GetSliceOrigin(sliceHash); err != nil || recorded != "" {
+		return err
+	}
+	if refs, err := GetSliceRefs(sliceHash); err == nil && len(refs) > 0 {
+		return nil
+	}
+	valid, err := VerifySliceOrigin(sliceHash, fileHash, sliceNumber)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.Errorf("slice %v doesn't belong to slice %v of file %v", sliceHash, sliceNumber, fileHash)
+	}
+	return nil
+}
+
+// VerifySliceOrigin recalculates the hash of a stored slice from the file hash and slice number it was created for,
+// and records them when the hash matches
+func VerifySliceOrigin(sliceHash, fileHash string, sliceNumber uint64) (bool, error) {
+	data, err := readSliceData(sliceHash)
+	if err != nil {
+		return false, errors.Wrap(err, "failed reading slice")
+	}
+	if IsDeduplicatedSlice(sliceHash, data) {
+		return true, nil
+	}
+	calculated, err := crypto.CalcSliceHash(data, fileHash, sliceNumber)
+	if err != nil {
+		return false, err
+	}
+	if calculated != sliceHash {
+		return false, nil
+	}
+	return true, SaveSliceOrigin(sliceHash, fileHash, sliceNumber)
+}
+
+// QuarantineSlice moves a corrupted slice, with its references and origin, out of the storage backend into the
+// quarantine folder
+func QuarantineSlice(sliceHash string) error {
+	wmutex.Lock()
+	defer wmutex.Unlock()
+
+	slicePath, err := getSlicePath(sliceHash)
+	if err != nil {
+		return errors.Wrap(err, "failed getting slice path")
+	}
+	quarantinePath := getQuarantinePath()
+	if err = os.MkdirAll(quarantinePath, os.ModePerm); err != nil {
+		return errors.Wrap(err, "failed creating quarantine folder")
+	}
+	store := getSliceStore()
+	data, err := slicestore.ReadAll(store, sliceHash)
+	if err != nil {
+		return errors.Wrap(err, "failed reading slice")
+	}
+	if err = os.WriteFile(filepath.Join(quarantinePath, sliceHash), data, 0600); err != nil {
+		return errors.Wrap(err, "failed moving slice to quarantine")
+	}
+	if err = store.Delete(sliceHash); err != nil {
+		return errors.Wrap(err, "failed removing slice")
+	}
+	for _, ext := range []string{SLICE_REFS_EXT, SLICE_ORIGIN_EXT} {
+		if err = os.Rename(slicePath+ext, filepath.Join(quarantinePath, sliceHash+ext)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed moving slice metadata to quarantine")
+		}
+	}
+	unindexSlice(sliceHash)
+	return nil
+}
@@ -0,0 +1,67 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stratosnet/sds/framework/crypto"
+)
+
+func TestBackfillSliceOrigin(t *testing.T) {
+	setupSliceStorage(t)
+	data := []byte("slice stored before the origins were recorded")
+	fileHash := "v05ahm51atjqkpte7gnqa94bhgpfpe4c6lkq0jh8"
+	sliceHash, err := crypto.CalcSliceHash(data, fileHash, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SaveSliceData(data, sliceHash, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifyStoredSlice(sliceHash); err != ErrSliceOriginUnknown {
+		t.Fatalf("a slice without origin can't be verified, got %v", err)
+	}
+
+	if err = BackfillSliceOrigin(sliceHash, fileHash, 2); err == nil {
+		t.Fatal("an origin not matching the slice hash shouldn't be recorded")
+	}
+	if recorded, _, _ := GetSliceOrigin(sliceHash); recorded != "" {
+		t.Fatalf("the wrong origin was recorded: %v", recorded)
+	}
+
+	if err = BackfillSliceOrigin(sliceHash, fileHash, 3); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := VerifyStoredSlice(sliceHash)
+	if err != nil || !valid {
+		t.Fatalf("the slice should be verified once its origin is backfilled, valid %v err %v", valid, err)
+	}
+}
+
+func TestVerifySliceOrigin(t *testing.T) {
+	setupSliceStorage(t)
+	data := []byte("slice whose origin is given by the SP")
+	fileHash := "v05ahm51atjqkpte7gnqa94bhgpfpe4c6lkq0jh8"
+	sliceHash, err := crypto.CalcSliceHash(data, fileHash, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SaveSliceData(data, sliceHash, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := VerifySliceOrigin(sliceHash, fileHash, 2)
+	if err != nil || valid {
+		t.Fatalf("a slice not matching its origin should be corrupted, valid %v err %v", valid, err)
+	}
+	if recorded, _, _ := GetSliceOrigin(sliceHash); recorded != "" {
+		t.Fatalf("a mismatching origin shouldn't be recorded: %v", recorded)
+	}
+
+	valid, err = VerifySliceOrigin(sliceHash, fileHash, 1)
+	if err != nil || !valid {
+		t.Fatalf("the slice should match its origin, valid %v err %v", valid, err)
+	}
+	if recorded, sliceNumber, _ := GetSliceOrigin(sliceHash); recorded != fileHash || sliceNumber != 1 {
+		t.Fatalf("the origin should be recorded, got %v %v", recorded, sliceNumber)
+	}
+}
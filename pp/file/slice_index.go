@@ -0,0 +1,230 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/file/sliceindex"
+	"github.com/stratosnet/sds/pp/file/slicestore"
+	"github.com/stratosnet/sds/pp/metrics"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+// SLICE_INDEX_FILE is the file of the storage path indexing the stored slices
+const SLICE_INDEX_FILE = "slices.index"
+
+var (
+	sliceIndex    *sliceindex.Index
+	sliceIndexMtx sync.Mutex
+
+	rebuildingSliceIndex int32
+)
+
+// InitSliceIndex opens the index of the stored slices. It returns true when the index was just created, and needs to
+// be rebuilt from the slices already stored
+func InitSliceIndex() (bool, error) {
+	path := filepath.Join(setting.Config.Home.StoragePath, SLICE_INDEX_FILE)
+	_, err := os.Stat(path)
+	created := os.IsNotExist(err)
+	if err = os.MkdirAll(setting.Config.Home.StoragePath, os.ModePerm); err != nil {
+		return false, errors.Wrap(err, "failed creating dir")
+	}
+	idx, err := sliceindex.Open(path)
+	if errors.Is(err, sliceindex.ErrCorrupted) {
+		return false, errors.Wrap(err, "stop the node and run `ppd index rebuild` to rebuild the slice index")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sliceIndexMtx.Lock()
+	defer sliceIndexMtx.Unlock()
+	if sliceIndex != nil {
+		_ = sliceIndex.Close()
+	}
+	sliceIndex = idx
+	updateStoredSliceMetrics(idx)
+	return created, nil
+}
+
+// ResetSliceIndex replaces the index of the stored slices with an empty one, to be rebuilt. The previous index is kept
+// next to it with a .bak extension
+func ResetSliceIndex() error {
+	CloseSliceIndex()
+	path := filepath.Join(setting.Config.Home.StoragePath, SLICE_INDEX_FILE)
+	if err := os.Rename(path, path+".bak"); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed moving the slice index")
+	}
+	_, err := InitSliceIndex()
+	return err
+}
+
+func CloseSliceIndex() {
+	sliceIndexMtx.Lock()
+	defer sliceIndexMtx.Unlock()
+	if sliceIndex != nil {
+		_ = sliceIndex.Close()
+		sliceIndex = nil
+	}
+}
+
+// getSliceIndex returns the index of the stored slices, nil when it wasn't initialized
+func getSliceIndex() *sliceindex.Index {
+	sliceIndexMtx.Lock()
+	defer sliceIndexMtx.Unlock()
+	return sliceIndex
+}
+
+func updateStoredSliceMetrics(idx *sliceindex.Index) {
+	count, _ := idx.Stats()
+	metrics.StoredSliceCount.WithLabelValues("total").Set(float64(count))
+}
+
+// updateSliceIndex changes the indexed metadata of a slice, indexing it first when create is true. Failures are only
+// logged, the index can be rebuilt
+func updateSliceIndex(sliceHash string, create bool, fn func(meta *sliceindex.SliceMeta) bool) {
+	idx := getSliceIndex()
+	if idx == nil {
+		return
+	}
+	update := idx.Update
+	if create {
+		update = idx.Upsert
+	}
+	if err := update(sliceHash, fn); err != nil {
+		utils.ErrorLogf("failed updating the index of slice %v: %v", sliceHash, err.Error())
+	}
+	updateStoredSliceMetrics(idx)
+}
+
+// indexSliceWrite records the data written to a slice
+func indexSliceWrite(sliceHash string, end int64) {
+	updateSliceIndex(sliceHash, true, func(meta *sliceindex.SliceMeta) bool {
+		if meta.StoredTime != 0 && meta.Size >= end {
+			return false
+		}
+		if meta.StoredTime == 0 {
+			meta.StoredTime = time.Now().Unix()
+			meta.LastAccess = meta.StoredTime
+		}
+		if end > meta.Size {
+			meta.Size = end
+		}
+		return true
+	})
+}
+
+// indexSliceFile records the file a slice was stored for, the first one for deduplicated slices
+func indexSliceFile(sliceHash, fileHash string) {
+	updateSliceIndex(sliceHash, false, func(meta *sliceindex.SliceMeta) bool {
+		if meta.FileHash != "" {
+			return false
+		}
+		meta.FileHash = fileHash
+		return true
+	})
+}
+
+// SetSliceVerification records the result of the last verification of a stored slice
+func SetSliceVerification(sliceHash, state string) {
+	updateSliceIndex(sliceHash, false, func(meta *sliceindex.SliceMeta) bool {
+		meta.Verification = state
+		meta.VerifiedTime = time.Now().Unix()
+		return true
+	})
+}
+
+func unindexSlice(sliceHash string) {
+	idx := getSliceIndex()
+	if idx == nil {
+		return
+	}
+	if err := idx.Delete(sliceHash); err != nil {
+		utils.ErrorLogf("failed removing slice %v from the index: %v", sliceHash, err.Error())
+	}
+	updateStoredSliceMetrics(idx)
+}
+
+func touchSlice(sliceHash string) {
+	if idx := getSliceIndex(); idx != nil {
+		if err := idx.Touch(sliceHash, time.Now()); err != nil {
+			utils.ErrorLogf("failed updating the index of slice %v: %v", sliceHash, err.Error())
+		}
+	}
+}
+
+// GetSliceMeta returns the indexed metadata of a stored slice
+func GetSliceMeta(sliceHash string) (sliceindex.SliceMeta, bool) {
+	idx := getSliceIndex()
+	if idx == nil {
+		return sliceindex.SliceMeta{}, false
+	}
+	return idx.Get(sliceHash)
+}
+
+// GetStoredSliceStats returns the number of stored slices, and their total size
+func GetStoredSliceStats() (int, int64) {
+	idx := getSliceIndex()
+	if idx == nil {
+		return 0, 0
+	}
+	return idx.Stats()
+}
+
+// RangeIndexedSlices calls fn for each stored slice, until fn returns false. Slices can't be stored or deleted from fn
+func RangeIndexedSlices(fn func(meta sliceindex.SliceMeta) bool) {
+	if idx := getSliceIndex(); idx != nil {
+		idx.Range(fn)
+	}
+}
+
+// RebuildSliceIndex indexes again the slices of the storage backend. The metadata already indexed for a slice is kept,
+// new slices get their file from the origin or references recorded next to them
+func RebuildSliceIndex(ctx context.Context) (int, error) {
+	idx := getSliceIndex()
+	if idx == nil {
+		return 0, errors.New("the slice index isn't initialized")
+	}
+	if !atomic.CompareAndSwapInt32(&rebuildingSliceIndex, 0, 1) {
+		return 0, errors.New("the slice index is already being rebuilt")
+	}
+	defer atomic.StoreInt32(&rebuildingSliceIndex, 0)
+
+	start := time.Now()
+	var slices []sliceindex.SliceMeta
+	err := WalkStoredSlices(ctx, func(info slicestore.SliceInfo) error {
+		meta, ok := idx.Get(info.Hash)
+		if !ok {
+			meta = sliceindex.SliceMeta{
+				Hash:         info.Hash,
+				StoredTime:   info.ModTime.Unix(),
+				LastAccess:   info.ModTime.Unix(),
+				Verification: sliceindex.UNVERIFIED,
+			}
+			if fileHash, _, err := GetSliceOrigin(info.Hash); err == nil && fileHash != "" {
+				meta.FileHash = fileHash
+			} else if refs, err := GetSliceRefs(info.Hash); err == nil && len(refs) > 0 {
+				meta.FileHash = refs[0]
+			}
+		}
+		meta.Size = info.Size
+		slices = append(slices, meta)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed walking the stored slices")
+	}
+	if err = idx.Replace(slices, start); err != nil {
+		return 0, err
+	}
+	updateStoredSliceMetrics(idx)
+	utils.Logf("slice index rebuilt with %v slices in %v", len(slices), time.Since(start))
+	return len(slices), nil
+}
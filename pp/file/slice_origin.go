@@ -0,0 +1,63 @@
+package file
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SLICE_ORIGIN_EXT is the extension of the files recording which file and slice number a stored slice was created for.
+// The slice hash can't be recalculated without them, unless the slice is deduplicated
+const SLICE_ORIGIN_EXT = ".origin"
+
+func getSliceOriginPath(sliceHash string) (string, error) {
+	slicePath, err := getSlicePath(sliceHash)
+	if err != nil {
+		return "", err
+	}
+	return slicePath + SLICE_ORIGIN_EXT, nil
+}
+
+// SaveSliceOrigin records the file hash and slice number a stored slice belongs to
+func SaveSliceOrigin(sliceHash, fileHash string, sliceNumber uint64) error {
+	originPath, err := getSliceOriginPath(sliceHash)
+	if err != nil {
+		return err
+	}
+	tmpPath := originPath + ".tmp"
+	if err = os.WriteFile(tmpPath, []byte(fileHash+" "+strconv.FormatUint(sliceNumber, 10)+"\n"), 0600); err != nil {
+		return errors.Wrap(err, "failed writing slice origin")
+	}
+	if err = os.Rename(tmpPath, originPath); err != nil {
+		return errors.Wrap(err, "failed saving slice origin")
+	}
+	indexSliceFile(sliceHash, fileHash)
+	return nil
+}
+
+// GetSliceOrigin returns the file hash and slice number a stored slice belongs to. The file hash is empty when the
+// origin wasn't recorded
+func GetSliceOrigin(sliceHash string) (string, uint64, error) {
+	originPath, err := getSliceOriginPath(sliceHash)
+	if err != nil {
+		return "", 0, err
+	}
+	data, err := os.ReadFile(originPath)
+	if os.IsNotExist(err) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, errors.Wrap(err, "failed reading slice origin")
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return "", 0, errors.New("invalid slice origin " + originPath)
+	}
+	sliceNumber, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "invalid slice number in slice origin")
+	}
+	return fields[0], sliceNumber, nil
+}
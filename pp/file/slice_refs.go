@@ -0,0 +1,116 @@
+package file
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/crypto"
+)
+
+// SLICE_REFS_EXT is the extension of the files listing the files referencing a deduplicated slice
+const SLICE_REFS_EXT = ".refs"
+
+func getSliceRefsPath(sliceHash string) (string, error) {
+	slicePath, err := getSlicePath(sliceHash)
+	if err != nil {
+		return "", err
+	}
+	return slicePath + SLICE_REFS_EXT, nil
+}
+
+// GetSliceRefs returns the hashes of the files referencing a stored slice
+func GetSliceRefs(sliceHash string) ([]string, error) {
+	refsPath, err := getSliceRefsPath(sliceHash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(refsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading slice references")
+	}
+	return strings.Fields(string(data)), nil
+}
+
+func saveSliceRefs(sliceHash string, fileHashes []string) error {
+	refsPath, err := getSliceRefsPath(sliceHash)
+	if err != nil {
+		return err
+	}
+	if len(fileHashes) == 0 {
+		if err = os.Remove(refsPath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed removing slice references")
+		}
+		return nil
+	}
+	sort.Strings(fileHashes)
+	tmpPath := refsPath + ".tmp"
+	if err = os.WriteFile(tmpPath, []byte(strings.Join(fileHashes, "\n")+"\n"), 0600); err != nil {
+		return errors.Wrap(err, "failed writing slice references")
+	}
+	return os.Rename(tmpPath, refsPath)
+}
+
+// AddSliceRef records that a file references a stored slice. Deduplicated slices are stored once, whatever the number of files using them
+func AddSliceRef(sliceHash, fileHash string) error {
+	wmutex.Lock()
+	defer wmutex.Unlock()
+
+	refs, err := GetSliceRefs(sliceHash)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if ref == fileHash {
+			return nil
+		}
+	}
+	if err = saveSliceRefs(sliceHash, append(refs, fileHash)); err != nil {
+		return err
+	}
+	indexSliceFile(sliceHash, fileHash)
+	return nil
+}
+
+// ReleaseSliceRef drops the reference of a file to a slice. The slice data is deleted once no file references it anymore.
+// Slices that were stored without references only belong to one file, and are deleted right away
+func ReleaseSliceRef(sliceHash, fileHash string) (bool, error) {
+	wmutex.Lock()
+	defer wmutex.Unlock()
+
+	refs, err := GetSliceRefs(sliceHash)
+	if err != nil {
+		return false, err
+	}
+	remaining := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if ref != fileHash {
+			remaining = append(remaining, ref)
+		}
+	}
+	if len(remaining) > 0 {
+		return false, saveSliceRefs(sliceHash, remaining)
+	}
+	// The slice is deleted under the lock, so that a file adding a reference meanwhile doesn't lose its data
+	return true, DeleteSlice(sliceHash)
+}
+
+// IsDeduplicatedSlice returns whether the slice is identified by the hash of its content, in which case it can be shared by several files
+func IsDeduplicatedSlice(sliceHash string, data []byte) bool {
+	return crypto.CalcContentSliceHash(data) == sliceHash
+}
+
+// IsDeduplicatedSliceStored returns whether a deduplicated slice was already fully stored and verified for another file
+func IsDeduplicatedSliceStored(sliceHash string, size uint64) bool {
+	storedSize, err := GetSliceSize(sliceHash)
+	if err != nil || uint64(storedSize) != size {
+		return false
+	}
+	refs, err := GetSliceRefs(sliceHash)
+	return err == nil && len(refs) > 0
+}
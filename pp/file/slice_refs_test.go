@@ -0,0 +1,97 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stratosnet/sds/framework/crypto"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+func setupSliceStorage(t *testing.T) {
+	setting.Config = setting.DefaultConfig()
+	setting.Config.Home.StoragePath = t.TempDir()
+	sliceStoreMtx.Lock()
+	sliceStore = nil
+	sliceStoreMtx.Unlock()
+	t.Cleanup(func() {
+		sliceStoreMtx.Lock()
+		sliceStore = nil
+		sliceStoreMtx.Unlock()
+	})
+}
+
+func TestSliceRefs(t *testing.T) {
+	setupSliceStorage(t)
+	data := []byte("deduplicated slice content")
+	sliceHash := crypto.CalcContentSliceHash(data)
+	fileA := "v05ahm51atjqkpte7gnqa94bhgpfpe4c6lkq0jh8"
+	fileB := "v05ahm53r8mpl9jn3a3gm9uc7lr6ib7ejtolokbg"
+
+	if !IsDeduplicatedSlice(sliceHash, data) {
+		t.Fatal("a slice named after its content should be deduplicated")
+	}
+	if IsDeduplicatedSlice(sliceHash, []byte("other content")) {
+		t.Fatal("a slice with another content shouldn't match the hash")
+	}
+
+	if err := SaveSliceData(data, sliceHash, 0); err != nil {
+		t.Fatal(err)
+	}
+	if IsDeduplicatedSliceStored(sliceHash, uint64(len(data))) {
+		t.Fatal("a slice without references shouldn't be reused")
+	}
+	if err := AddSliceRef(sliceHash, fileA); err != nil {
+		t.Fatal(err)
+	}
+	if !IsDeduplicatedSliceStored(sliceHash, uint64(len(data))) {
+		t.Fatal("the slice should already be stored")
+	}
+	if IsDeduplicatedSliceStored(sliceHash, uint64(len(data))+1) {
+		t.Fatal("a partially stored slice shouldn't be reused")
+	}
+
+	// A second upload of the slice only adds a reference
+	if err := AddSliceRef(sliceHash, fileB); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddSliceRef(sliceHash, fileB); err != nil {
+		t.Fatal(err)
+	}
+	refs, err := GetSliceRefs(sliceHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 {
+		t.Fatalf("expected 2 references, got %v", refs)
+	}
+
+	deleted, err := ReleaseSliceRef(sliceHash, fileA)
+	if err != nil || deleted {
+		t.Fatalf("the slice is still referenced by another file, deleted %v err %v", deleted, err)
+	}
+	if !IsDeduplicatedSliceStored(sliceHash, uint64(len(data))) {
+		t.Fatal("the slice should be kept for the other file")
+	}
+	deleted, err = ReleaseSliceRef(sliceHash, fileB)
+	if err != nil || !deleted {
+		t.Fatalf("the slice should be deleted with its last reference, deleted %v err %v", deleted, err)
+	}
+	if _, err = GetSliceSize(sliceHash); err == nil {
+		t.Fatal("the slice data should be deleted")
+	}
+	if refs, _ = GetSliceRefs(sliceHash); len(refs) != 0 {
+		t.Fatalf("the references should be deleted, got %v", refs)
+	}
+}
+
+func TestReleaseUnreferencedSlice(t *testing.T) {
+	setupSliceStorage(t)
+	sliceHash := "v05j1m51tubvspkkqsqd6hbm0p0dd4bfinkgvv48"
+	if err := SaveSliceData([]byte("slice of a single file"), sliceHash, 0); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := ReleaseSliceRef(sliceHash, "v05ahm51atjqkpte7gnqa94bhgpfpe4c6lkq0jh8")
+	if err != nil || !deleted {
+		t.Fatalf("a slice stored without references should be deleted, deleted %v err %v", deleted, err)
+	}
+}
@@ -0,0 +1,87 @@
+package file
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/file/sliceindex"
+	"github.com/stratosnet/sds/pp/file/slicestore"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+// STAGING_FOLDER is the folder of the storage path where slices are received before being uploaded to a remote backend
+const STAGING_FOLDER = "staging"
+
+var (
+	sliceStore    slicestore.Store
+	sliceStoreMtx sync.Mutex
+)
+
+// InitSliceStore creates the backend storing the slices, as configured
+func InitSliceStore() error {
+	store, err := newSliceStore(setting.Config.Storage)
+	if err != nil {
+		return err
+	}
+	sliceStoreMtx.Lock()
+	defer sliceStoreMtx.Unlock()
+	sliceStore = store
+	utils.Logf("Slices are stored in %v", store.Name())
+	return nil
+}
+
+func newSliceStore(config setting.StorageConfig) (slicestore.Store, error) {
+	switch config.Backend {
+	case "", slicestore.LOCAL:
+		return slicestore.NewLocalStore(setting.Config.Home.StoragePath), nil
+	case slicestore.MULTIDISK:
+		var disks []slicestore.Disk
+		for _, disk := range config.Disks {
+			disks = append(disks, slicestore.Disk{Path: disk.Path, Capacity: disk.Capacity * 1024 * 1024}) // MB to B
+		}
+		return slicestore.NewMultiDiskStore(disks)
+	case slicestore.S3:
+		return slicestore.NewS3Store(slicestore.S3Config{
+			Endpoint:  config.S3.Endpoint,
+			Region:    config.S3.Region,
+			Bucket:    config.S3.Bucket,
+			Prefix:    config.S3.Prefix,
+			AccessKey: config.S3.AccessKey,
+			SecretKey: config.S3.SecretKey,
+			PathStyle: config.S3.PathStyle,
+			Capacity:  config.S3.Capacity * 1024 * 1024, // MB to B
+		}, filepath.Join(setting.Config.Home.StoragePath, STAGING_FOLDER))
+	default:
+		return nil, errors.Errorf("unknown storage backend [%v]", config.Backend)
+	}
+}
+
+// getSliceStore returns the backend storing the slices, the storage path when it wasn't initialized
+func getSliceStore() slicestore.Store {
+	sliceStoreMtx.Lock()
+	defer sliceStoreMtx.Unlock()
+	if sliceStore == nil {
+		sliceStore = slicestore.NewLocalStore(setting.Config.Home.StoragePath)
+	}
+	return sliceStore
+}
+
+// GetStorageUsage returns the capacity of the backend storing the slices
+func GetStorageUsage() (slicestore.Usage, error) {
+	return getSliceStore().Usage()
+}
+
+// CommitSlice is called once a received slice was verified, so the backend can persist it. The backend may upload the
+// slice to a remote service, so only the index update holds the lock of the slice files
+func CommitSlice(sliceHash string) error {
+	if err := getSliceStore().Commit(sliceHash); err != nil {
+		return err
+	}
+	wmutex.Lock()
+	defer wmutex.Unlock()
+	SetSliceVerification(sliceHash, sliceindex.VERIFIED)
+	return nil
+}
@@ -0,0 +1,299 @@
+package sliceindex
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	UNVERIFIED = "unverified"
+	VERIFIED   = "verified"
+	CORRUPTED  = "corrupted"
+
+	// accessGranularity is how stale the last access of a slice can get before it is written to the index again
+	accessGranularity = time.Hour
+	// minCompactRecords is the number of superseded records in the log before it can be compacted
+	minCompactRecords = 10000
+)
+
+var (
+	// ErrCorrupted is returned by Open when a record before the end of the log can't be read
+	ErrCorrupted = errors.New("the slice index is corrupted, it must be rebuilt")
+	// ErrNotIndexed is returned by Update for slices that aren't indexed
+	ErrNotIndexed = errors.New("the slice isn't indexed")
+)
+
+// SliceMeta is what the index knows about a stored slice. Times are unix timestamps
+type SliceMeta struct {
+	Hash         string `json:"hash"`
+	Size         int64  `json:"size"`
+	FileHash     string `json:"file_hash,omitempty"`
+	StoredTime   int64  `json:"stored_time"`
+	LastAccess   int64  `json:"last_access"`
+	Verification string `json:"verification"`
+	VerifiedTime int64  `json:"verified_time,omitempty"`
+}
+
+// record is a line of the index log
+type record struct {
+	Put    *SliceMeta `json:"put,omitempty"`
+	Delete string     `json:"delete,omitempty"`
+}
+
+// Index keeps the metadata of the stored slices in memory, persisted in an append-only log file. The log is rewritten
+// once most of its records are superseded
+type Index struct {
+	mtx       sync.RWMutex
+	path      string
+	file      *os.File
+	entries   map[string]*SliceMeta
+	totalSize int64
+	stale     int
+}
+
+// Open loads the index stored at path, creating it when it doesn't exist. A record torn by a crash at the end of the
+// log is dropped, any other unreadable record fails with ErrCorrupted
+func Open(path string) (*Index, error) {
+	idx := &Index{path: path, entries: make(map[string]*SliceMeta)}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening slice index")
+	}
+
+	var offset int64
+	r := bufio.NewReader(f)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = f.Close()
+			return nil, errors.Wrap(err, "failed reading slice index")
+		}
+		var rec record
+		if err = json.Unmarshal(line, &rec); err != nil {
+			if _, err = r.Peek(1); err == io.EOF {
+				break
+			}
+			_ = f.Close()
+			return nil, errors.Wrapf(ErrCorrupted, "line %v of %v", lineNumber, path)
+		}
+		idx.apply(rec)
+		offset += int64(len(line))
+	}
+	if err = f.Truncate(offset); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "failed truncating slice index")
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "failed seeking slice index")
+	}
+	idx.file = f
+	return idx, nil
+}
+
+func (idx *Index) Close() error {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	if idx.file == nil {
+		return nil
+	}
+	err := idx.file.Close()
+	idx.file = nil
+	return err
+}
+
+func (idx *Index) apply(rec record) {
+	hash := rec.Delete
+	if rec.Put != nil {
+		hash = rec.Put.Hash
+	}
+	if old, ok := idx.entries[hash]; ok {
+		idx.totalSize -= old.Size
+		delete(idx.entries, hash)
+		idx.stale++
+	}
+	if rec.Put != nil {
+		meta := *rec.Put
+		idx.entries[hash] = &meta
+		idx.totalSize += meta.Size
+	} else {
+		idx.stale++
+	}
+}
+
+// write applies a record and appends it to the log. The lock must be held
+func (idx *Index) write(rec record) error {
+	if idx.file == nil {
+		return errors.New("slice index is closed")
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err = idx.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "failed writing slice index")
+	}
+	idx.apply(rec)
+	if idx.stale > minCompactRecords && idx.stale > len(idx.entries) {
+		return idx.compact()
+	}
+	return nil
+}
+
+// compact rewrites the log with one record per slice. The lock must be held
+func (idx *Index) compact() error {
+	tmpPath := idx.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed creating slice index")
+	}
+	w := bufio.NewWriter(f)
+	for _, meta := range idx.entries {
+		line, err := json.Marshal(record{Put: meta})
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		if err != nil {
+			_ = f.Close()
+			return errors.Wrap(err, "failed writing slice index")
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	_ = f.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed writing slice index")
+	}
+	if err = os.Rename(tmpPath, idx.path); err != nil {
+		return errors.Wrap(err, "failed replacing slice index")
+	}
+
+	newFile, err := os.OpenFile(idx.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed opening slice index")
+	}
+	_ = idx.file.Close()
+	idx.file = newFile
+	idx.stale = 0
+	return nil
+}
+
+func (idx *Index) Get(sliceHash string) (SliceMeta, bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	meta, ok := idx.entries[sliceHash]
+	if !ok {
+		return SliceMeta{}, false
+	}
+	return *meta, true
+}
+
+func (idx *Index) Put(meta SliceMeta) error {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	return idx.write(record{Put: &meta})
+}
+
+// Update changes the metadata of an indexed slice with fn. fn returns false when there is nothing to change
+func (idx *Index) Update(sliceHash string, fn func(meta *SliceMeta) bool) error {
+	return idx.update(sliceHash, false, fn)
+}
+
+// Upsert is like Update, but slices that aren't indexed are created with their hash only
+func (idx *Index) Upsert(sliceHash string, fn func(meta *SliceMeta) bool) error {
+	return idx.update(sliceHash, true, fn)
+}
+
+func (idx *Index) update(sliceHash string, create bool, fn func(meta *SliceMeta) bool) error {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	meta := SliceMeta{Hash: sliceHash, Verification: UNVERIFIED}
+	if old, ok := idx.entries[sliceHash]; ok {
+		meta = *old
+	} else if !create {
+		return errors.Wrap(ErrNotIndexed, sliceHash)
+	}
+	if !fn(&meta) {
+		return nil
+	}
+	return idx.write(record{Put: &meta})
+}
+
+func (idx *Index) Delete(sliceHash string) error {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	if _, ok := idx.entries[sliceHash]; !ok {
+		return nil
+	}
+	return idx.write(record{Delete: sliceHash})
+}
+
+// Touch records an access to a slice, at most once per accessGranularity
+func (idx *Index) Touch(sliceHash string, now time.Time) error {
+	idx.mtx.RLock()
+	meta, ok := idx.entries[sliceHash]
+	fresh := ok && now.Unix()-meta.LastAccess < int64(accessGranularity.Seconds())
+	idx.mtx.RUnlock()
+	if !ok || fresh {
+		return nil
+	}
+	err := idx.Update(sliceHash, func(meta *SliceMeta) bool {
+		meta.LastAccess = now.Unix()
+		return true
+	})
+	if errors.Is(err, ErrNotIndexed) {
+		// deleted since it was looked up
+		return nil
+	}
+	return err
+}
+
+// Stats returns the number of indexed slices, and their total size
+func (idx *Index) Stats() (int, int64) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	return len(idx.entries), idx.totalSize
+}
+
+// Range calls fn for each indexed slice, until fn returns false. The index can't be modified from fn
+func (idx *Index) Range(fn func(meta SliceMeta) bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	for _, meta := range idx.entries {
+		if !fn(*meta) {
+			return
+		}
+	}
+}
+
+// Replace rebuilds the index from the given slices. Slices stored since the given time are kept, as they may be
+// missing from the list
+func (idx *Index) Replace(slices []SliceMeta, since time.Time) error {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	entries := make(map[string]*SliceMeta, len(slices))
+	var totalSize int64
+	for i := range slices {
+		entries[slices[i].Hash] = &slices[i]
+		totalSize += slices[i].Size
+	}
+	for hash, meta := range idx.entries {
+		if _, ok := entries[hash]; !ok && meta.StoredTime >= since.Unix() {
+			entries[hash] = meta
+			totalSize += meta.Size
+		}
+	}
+	idx.entries = entries
+	idx.totalSize = totalSize
+	return idx.compact()
+}
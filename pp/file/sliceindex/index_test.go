@@ -0,0 +1,190 @@
+package sliceindex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slices.index")
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = idx.Put(SliceMeta{Hash: "a", Size: 10, StoredTime: 1, Verification: UNVERIFIED}); err != nil {
+		t.Fatal(err)
+	}
+	if err = idx.Put(SliceMeta{Hash: "b", Size: 20, StoredTime: 2, Verification: UNVERIFIED}); err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Update("a", func(meta *SliceMeta) bool {
+		meta.FileHash = "file"
+		meta.Verification = VERIFIED
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = idx.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err = idx.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A record torn by a crash is dropped when the index is opened again
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"put":{"hash":"c","si`)
+	_ = f.Close()
+
+	idx, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = idx.Close()
+	}()
+	if count, size := idx.Stats(); count != 1 || size != 10 {
+		t.Fatalf("unexpected stats %v slices, %v bytes", count, size)
+	}
+	meta, ok := idx.Get("a")
+	if !ok || meta.FileHash != "file" || meta.Verification != VERIFIED {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+	if err = idx.Put(SliceMeta{Hash: "c", Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := idx.Stats(); count != 2 {
+		t.Fatalf("the index should accept records after a torn one, got %v slices", count)
+	}
+}
+
+func TestIndexCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slices.index")
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = idx.Put(SliceMeta{Hash: "a", Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err = idx.Update("b", func(meta *SliceMeta) bool { return true }); !errors.Is(err, ErrNotIndexed) {
+		t.Fatalf("updating a slice that isn't indexed should fail, got %v", err)
+	}
+	if err = idx.Upsert("b", func(meta *SliceMeta) bool {
+		meta.Size = 20
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_ = idx.Close()
+
+	// A torn record ending with a newline is still the last one
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("{\"put\":{\"ha\n")
+	_ = f.Close()
+	idx, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, size := idx.Stats(); count != 2 || size != 30 {
+		t.Fatalf("unexpected stats %v slices, %v bytes", count, size)
+	}
+	_ = idx.Close()
+
+	// Records after an unreadable one can't be dropped silently
+	f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("garbage\n{\"delete\":\"a\"}\n")
+	_ = f.Close()
+	if _, err = Open(path); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("opening a corrupted index should fail, got %v", err)
+	}
+}
+
+func TestIndexCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slices.index")
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= minCompactRecords+1; i++ {
+		if err = idx.Put(SliceMeta{Hash: "a", Size: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if idx.stale != 0 {
+		t.Fatalf("the index should have been compacted, %v stale records", idx.stale)
+	}
+	if err = idx.Put(SliceMeta{Hash: "b", Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_ = idx.Close()
+
+	idx, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = idx.Close()
+	}()
+	if count, size := idx.Stats(); count != 2 || size != minCompactRecords+2 {
+		t.Fatalf("unexpected stats %v slices, %v bytes", count, size)
+	}
+}
+
+func TestIndexReplace(t *testing.T) {
+	idx, err := Open(filepath.Join(t.TempDir(), "slices.index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = idx.Close()
+	}()
+	since := time.Unix(100, 0)
+	for i, storedTime := range []int64{50, 150} {
+		if err = idx.Put(SliceMeta{Hash: fmt.Sprint(i), Size: 1, StoredTime: storedTime}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// slice 0 is gone from the storage, slice 1 was stored during the rebuild
+	if err = idx.Replace([]SliceMeta{{Hash: "2", Size: 3}}, since); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.Get("0"); ok {
+		t.Fatal("slice 0 should have been removed")
+	}
+	if _, ok := idx.Get("1"); !ok {
+		t.Fatal("slice 1 should have been kept")
+	}
+	if count, size := idx.Stats(); count != 2 || size != 4 {
+		t.Fatalf("unexpected stats %v slices, %v bytes", count, size)
+	}
+
+	now := time.Unix(100000, 0)
+	if err = idx.Touch("2", now); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := idx.Get("2"); meta.LastAccess != now.Unix() {
+		t.Fatalf("unexpected last access %v", meta.LastAccess)
+	}
+	if err = idx.Touch("2", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := idx.Get("2"); meta.LastAccess != now.Unix() {
+		t.Fatal("recent accesses shouldn't be recorded again")
+	}
+}
@@ -0,0 +1,109 @@
+package slicestore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/disk"
+	"golang.org/x/exp/mmap"
+)
+
+// LocalStore keeps the slices in a folder of the local filesystem
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root: root}
+}
+
+func (s *LocalStore) Name() string {
+	return LOCAL + ":" + s.root
+}
+
+func (s *LocalStore) Open(sliceHash string) (Reader, error) {
+	path, err := slicePath(s.root, sliceHash)
+	if err != nil {
+		return nil, err
+	}
+	r, err := mmap.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrSliceNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening slice")
+	}
+	return r, nil
+}
+
+func (s *LocalStore) WriteAt(sliceHash string, data []byte, offset uint64) error {
+	path, err := slicePath(s.root, sliceHash)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return errors.Wrap(err, "failed creating dir")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed opening a file")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, err = f.WriteAt(data, int64(offset)); err != nil {
+		return errors.Wrap(err, "failed writing data")
+	}
+	return nil
+}
+
+func (s *LocalStore) Commit(_ string) error {
+	return nil
+}
+
+func (s *LocalStore) Size(sliceHash string) (int64, error) {
+	path, err := slicePath(s.root, sliceHash)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, ErrSliceNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed getting file info")
+	}
+	return info.Size(), nil
+}
+
+func (s *LocalStore) Delete(sliceHash string) error {
+	path, err := slicePath(s.root, sliceHash)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrSliceNotFound
+		}
+		return errors.Wrap(err, "failed removing slice")
+	}
+	return nil
+}
+
+func (s *LocalStore) Walk(ctx context.Context, fn func(info SliceInfo) error) error {
+	return walkLayout(ctx, s.root, fn)
+}
+
+// Usage returns the usage of the whole filesystem of the folder, like the disk reports always did
+func (s *LocalStore) Usage() (Usage, error) {
+	if err := os.MkdirAll(s.root, os.ModePerm); err != nil {
+		return Usage{}, errors.Wrap(err, "failed creating dir")
+	}
+	stat, err := disk.Usage(s.root)
+	if err != nil {
+		return Usage{}, errors.Wrap(err, "failed getting disk usage")
+	}
+	return newUsage(s.root, stat.Total, stat.Free, stat.Used), nil
+}
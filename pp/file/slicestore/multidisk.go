@@ -0,0 +1,196 @@
+package slicestore
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+// Disk is a folder used by the multi-disk backend. Capacity limits the bytes stored in it, 0 means the whole disk
+type Disk struct {
+	Path     string
+	Capacity uint64
+}
+
+type diskStore struct {
+	*LocalStore
+	capacity uint64
+	used     int64 // bytes of the slices stored on this disk
+}
+
+// free returns the space left for slices on the disk
+func (d *diskStore) free() uint64 {
+	usage, err := d.LocalStore.Usage()
+	if err != nil {
+		return 0
+	}
+	free := usage.Free
+	if d.capacity > 0 {
+		used := uint64(atomic.LoadInt64(&d.used))
+		if used >= d.capacity {
+			return 0
+		}
+		if d.capacity-used < free {
+			free = d.capacity - used
+		}
+	}
+	return free
+}
+
+// MultiDiskStore spreads the slices over several disks. New slices go to the disk with the most free space
+type MultiDiskStore struct {
+	disks []*diskStore
+	// key: slice hash, value: *diskStore
+	locations *sync.Map
+}
+
+func NewMultiDiskStore(disks []Disk) (*MultiDiskStore, error) {
+	if len(disks) == 0 {
+		return nil, errors.New("no disk configured for the multidisk storage")
+	}
+	s := &MultiDiskStore{locations: &sync.Map{}}
+	for _, disk := range disks {
+		d := &diskStore{LocalStore: NewLocalStore(disk.Path), capacity: disk.Capacity}
+		s.disks = append(s.disks, d)
+		if disk.Capacity > 0 {
+			go d.countUsed()
+		}
+	}
+	return s, nil
+}
+
+// countUsed adds up the size of the slices already stored on a disk with a capacity
+func (d *diskStore) countUsed() {
+	var used int64
+	err := d.Walk(context.Background(), func(info SliceInfo) error {
+		used += info.Size
+		return nil
+	})
+	if err != nil {
+		utils.ErrorLogf("failed counting the slices stored in %v: %v", d.root, err.Error())
+	}
+	atomic.AddInt64(&d.used, used)
+}
+
+func (s *MultiDiskStore) Name() string {
+	var roots []string
+	for _, d := range s.disks {
+		roots = append(roots, d.root)
+	}
+	return MULTIDISK + ":" + strings.Join(roots, ",")
+}
+
+// locate returns the disk storing a slice
+func (s *MultiDiskStore) locate(sliceHash string) (*diskStore, bool) {
+	if value, ok := s.locations.Load(sliceHash); ok {
+		return value.(*diskStore), true
+	}
+	for _, d := range s.disks {
+		if _, err := d.LocalStore.Size(sliceHash); err == nil {
+			s.locations.Store(sliceHash, d)
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// place picks the disk a new slice is written to
+func (s *MultiDiskStore) place(sliceHash string, size uint64) (*diskStore, error) {
+	var best *diskStore
+	var bestFree uint64
+	for _, d := range s.disks {
+		if free := d.free(); best == nil || free > bestFree {
+			best, bestFree = d, free
+		}
+	}
+	if bestFree < size {
+		return nil, errors.New("no disk has enough free space for the slice")
+	}
+	s.locations.Store(sliceHash, best)
+	return best, nil
+}
+
+func (s *MultiDiskStore) Open(sliceHash string) (Reader, error) {
+	d, ok := s.locate(sliceHash)
+	if !ok {
+		return nil, ErrSliceNotFound
+	}
+	return d.Open(sliceHash)
+}
+
+func (s *MultiDiskStore) WriteAt(sliceHash string, data []byte, offset uint64) error {
+	d, ok := s.locate(sliceHash)
+	var err error
+	if !ok {
+		if d, err = s.place(sliceHash, uint64(len(data))); err != nil {
+			return err
+		}
+	}
+	oldSize, _ := d.LocalStore.Size(sliceHash)
+	if err = d.LocalStore.WriteAt(sliceHash, data, offset); err != nil {
+		return err
+	}
+	if newSize := int64(offset) + int64(len(data)); newSize > oldSize {
+		atomic.AddInt64(&d.used, newSize-oldSize)
+	}
+	return nil
+}
+
+func (s *MultiDiskStore) Commit(_ string) error {
+	return nil
+}
+
+func (s *MultiDiskStore) Size(sliceHash string) (int64, error) {
+	d, ok := s.locate(sliceHash)
+	if !ok {
+		return 0, ErrSliceNotFound
+	}
+	return d.LocalStore.Size(sliceHash)
+}
+
+func (s *MultiDiskStore) Delete(sliceHash string) error {
+	d, ok := s.locate(sliceHash)
+	if !ok {
+		return ErrSliceNotFound
+	}
+	size, _ := d.LocalStore.Size(sliceHash)
+	if err := d.LocalStore.Delete(sliceHash); err != nil {
+		return err
+	}
+	atomic.AddInt64(&d.used, -size)
+	s.locations.Delete(sliceHash)
+	return nil
+}
+
+func (s *MultiDiskStore) Walk(ctx context.Context, fn func(info SliceInfo) error) error {
+	for _, d := range s.disks {
+		if err := d.Walk(ctx, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Usage adds up the usage of the disks, limited by their capacity
+func (s *MultiDiskStore) Usage() (Usage, error) {
+	var total, free, used uint64
+	for _, d := range s.disks {
+		usage, err := d.LocalStore.Usage()
+		if err != nil {
+			return Usage{}, err
+		}
+		if d.capacity > 0 && d.capacity < usage.Total {
+			usage.Total = d.capacity
+			usage.Used = uint64(atomic.LoadInt64(&d.used))
+		}
+		total += usage.Total
+		used += usage.Used
+		free += d.free()
+	}
+	return newUsage(s.Name(), total, free, used), nil
+}
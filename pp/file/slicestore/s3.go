@@ -0,0 +1,278 @@
+package slicestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/utils/sigv4"
+)
+
+const (
+	s3RequestTimeout = 2 * time.Minute
+	// s3UsageCacheTime is how long the bytes stored in the bucket are cached, listing the bucket being expensive
+	s3UsageCacheTime = 10 * time.Minute
+)
+
+// S3Config is the object store used by the S3 backend
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	Capacity  uint64
+}
+
+// S3Store keeps the slices in an S3-compatible object store. Objects can't be written in pieces, so slices are
+// received in a local staging folder and uploaded when committed
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	staging  *LocalStore
+
+	usageMtx  sync.Mutex
+	usedBytes uint64
+	usageTime time.Time
+}
+
+func NewS3Store(config S3Config, stagingPath string) (*S3Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("the endpoint and bucket of the s3 storage are required")
+	}
+	if config.Capacity == 0 {
+		return nil, errors.New("the capacity of the s3 storage is required")
+	}
+	if !strings.Contains(config.Endpoint, "://") {
+		config.Endpoint = "https://" + config.Endpoint
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid s3 endpoint")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: s3RequestTimeout},
+		staging:  NewLocalStore(stagingPath),
+	}, nil
+}
+
+func (s *S3Store) Name() string {
+	return S3 + ":" + s.config.Bucket + "/" + s.config.Prefix
+}
+
+// objectURL returns the url of an object, or of the bucket when key is empty
+func (s *S3Store) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	if s.config.PathStyle {
+		u.Path = "/" + s.config.Bucket + "/" + key
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (s *S3Store) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	sigv4.Sign(req, body, s.config.AccessKey, s.config.SecretKey, s.config.Region, time.Now())
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "s3 %v request failed", method)
+	}
+	rsp.Body = cancelOnClose{ReadCloser: rsp.Body, cancel: cancel}
+	if rsp.StatusCode == http.StatusNotFound {
+		_ = rsp.Body.Close()
+		return nil, ErrSliceNotFound
+	}
+	if rsp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+		_ = rsp.Body.Close()
+		return nil, errors.Errorf("s3 %v request failed with status %v: %s", method, rsp.Status, msg)
+	}
+	return rsp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+func (s *S3Store) Open(sliceHash string) (Reader, error) {
+	if r, err := s.staging.Open(sliceHash); err == nil {
+		return r, nil
+	}
+	rsp, err := s.do(http.MethodGet, s.config.Prefix+sliceHash, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rsp.Body.Close()
+	}()
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading s3 object")
+	}
+	return newBytesReader(data), nil
+}
+
+func (s *S3Store) WriteAt(sliceHash string, data []byte, offset uint64) error {
+	return s.staging.WriteAt(sliceHash, data, offset)
+}
+
+// Commit uploads a slice from the staging folder
+func (s *S3Store) Commit(sliceHash string) error {
+	data, err := ReadAll(s.staging, sliceHash)
+	if err != nil {
+		return err
+	}
+	rsp, err := s.do(http.MethodPut, s.config.Prefix+sliceHash, nil, data)
+	if err != nil {
+		return err
+	}
+	_ = rsp.Body.Close()
+	s.addUsed(int64(len(data)))
+	return s.staging.Delete(sliceHash)
+}
+
+func (s *S3Store) Size(sliceHash string) (int64, error) {
+	if size, err := s.staging.Size(sliceHash); err == nil {
+		return size, nil
+	}
+	rsp, err := s.do(http.MethodHead, s.config.Prefix+sliceHash, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	_ = rsp.Body.Close()
+	return rsp.ContentLength, nil
+}
+
+func (s *S3Store) Delete(sliceHash string) error {
+	stagingErr := s.staging.Delete(sliceHash)
+	size, err := s.Size(sliceHash)
+	if err == ErrSliceNotFound {
+		return stagingErr
+	}
+	rsp, err := s.do(http.MethodDelete, s.config.Prefix+sliceHash, nil, nil)
+	if err != nil {
+		return err
+	}
+	_ = rsp.Body.Close()
+	s.addUsed(-size)
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Walk lists the committed slices of the bucket
+func (s *S3Store) Walk(ctx context.Context, fn func(info SliceInfo) error) error {
+	token := ""
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		rsp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(rsp.Body).Decode(&result)
+		_ = rsp.Body.Close()
+		if err != nil {
+			return errors.Wrap(err, "failed parsing s3 object list")
+		}
+		for _, object := range result.Contents {
+			hash := strings.TrimPrefix(object.Key, s.config.Prefix)
+			if strings.Contains(hash, "/") {
+				continue
+			}
+			if err = fn(SliceInfo{Hash: hash, Size: object.Size, ModTime: object.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Store) addUsed(delta int64) {
+	s.usageMtx.Lock()
+	defer s.usageMtx.Unlock()
+	if delta < 0 && uint64(-delta) > s.usedBytes {
+		s.usedBytes = 0
+		return
+	}
+	s.usedBytes = uint64(int64(s.usedBytes) + delta)
+}
+
+// Usage reports the configured capacity, and the bytes stored in the bucket
+func (s *S3Store) Usage() (Usage, error) {
+	s.usageMtx.Lock()
+	defer s.usageMtx.Unlock()
+	if time.Since(s.usageTime) > s3UsageCacheTime {
+		var used uint64
+		err := s.Walk(context.Background(), func(info SliceInfo) error {
+			used += uint64(info.Size)
+			return nil
+		})
+		if err != nil {
+			return Usage{}, err
+		}
+		s.usedBytes = used
+		s.usageTime = time.Now()
+	}
+
+	total := s.config.Capacity
+	free := uint64(0)
+	if s.usedBytes < total {
+		free = total - s.usedBytes
+	}
+	return newUsage(s.Name(), total, free, s.usedBytes), nil
+}
+
+// String hides the credentials of the store when it is logged
+func (c S3Config) String() string {
+	return c.Endpoint + "/" + c.Bucket + "/" + c.Prefix + " (capacity " + strconv.FormatUint(c.Capacity, 10) + " bytes)"
+}
@@ -0,0 +1,191 @@
+package slicestore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stratosnet/sds/utils/sigv4"
+)
+
+const testSliceHash = "v05ahm50ugfjrgd3ga8mqi6bqka32ks3dooe1p9g"
+
+func TestLocalStore(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	if _, err := store.Open(testSliceHash); err != ErrSliceNotFound {
+		t.Fatalf("expected ErrSliceNotFound, got %v", err)
+	}
+
+	if err := store.WriteAt(testSliceHash, []byte("hello "), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteAt(testSliceHash, []byte("world"), 6); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadAll(store, testSliceHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("unexpected slice data %q", data)
+	}
+
+	var walked []string
+	err = store.Walk(context.Background(), func(info SliceInfo) error {
+		walked = append(walked, info.Hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != 1 || walked[0] != testSliceHash {
+		t.Fatalf("unexpected walked slices %v", walked)
+	}
+
+	if err = store.Delete(testSliceHash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Size(testSliceHash); err != ErrSliceNotFound {
+		t.Fatalf("expected ErrSliceNotFound after delete, got %v", err)
+	}
+}
+
+func TestMultiDiskPlacement(t *testing.T) {
+	small, large := t.TempDir(), t.TempDir()
+	store, err := NewMultiDiskStore([]Disk{{Path: small, Capacity: 100}, {Path: large, Capacity: 1500}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := make([]string, 3)
+	for i := range hashes {
+		hashes[i] = fmt.Sprintf("%v%v", testSliceHash[:len(testSliceHash)-1], i)
+		if err = store.WriteAt(hashes[i], bytes.Repeat([]byte{byte(i)}, 400), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the large disk has room for the slices
+	for _, hash := range hashes {
+		if _, err = NewLocalStore(large).Size(hash); err != nil {
+			t.Fatalf("slice %v should be stored on the large disk: %v", hash, err)
+		}
+	}
+	if err = store.WriteAt(testSliceHash, make([]byte, 400), 0); err == nil {
+		t.Fatal("no disk should have room for another slice")
+	}
+
+	usage, err := store.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total != 1600 || usage.Used != 1200 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	if err = store.Delete(hashes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if usage, _ = store.Usage(); usage.Used != 800 {
+		t.Fatalf("unexpected used bytes after delete %v", usage.Used)
+	}
+}
+
+// testS3Server is an in-memory object store answering the requests made by S3Store
+type testS3Server struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), sigv4.Algorithm) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		_, _ = fmt.Fprint(w, "<ListBucketResult>")
+		for k, v := range s.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				_, _ = fmt.Fprintf(w, "<Contents><Key>%v</Key><Size>%v</Size></Contents>", k, len(v))
+			}
+		}
+		_, _ = fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+	case r.Method == http.MethodPut:
+		s.objects[key], _ = io.ReadAll(r.Body)
+	case s.objects[key] == nil:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodGet:
+		_, _ = w.Write(s.objects[key])
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", fmt.Sprint(len(s.objects[key])))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	backend := &testS3Server{objects: make(map[string][]byte)}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "bucket",
+		Prefix:    "slices/",
+		AccessKey: "key",
+		SecretKey: "secret",
+		PathStyle: true,
+		Capacity:  1 << 20,
+	}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.WriteAt(testSliceHash, []byte("slice data"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.objects) != 0 {
+		t.Fatal("slices should only be uploaded once committed")
+	}
+	if err = store.Commit(testSliceHash); err != nil {
+		t.Fatal(err)
+	}
+	if string(backend.objects["slices/"+testSliceHash]) != "slice data" {
+		t.Fatalf("unexpected objects %v", backend.objects)
+	}
+
+	data, err := ReadAll(store, testSliceHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "slice data" {
+		t.Fatalf("unexpected slice data %q", data)
+	}
+	if size, err := store.Size(testSliceHash); err != nil || size != 10 {
+		t.Fatalf("unexpected size %v (%v)", size, err)
+	}
+	usage, err := store.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total != 1<<20 || usage.Used != 10 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	if err = store.Delete(testSliceHash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Open(testSliceHash); err != ErrSliceNotFound {
+		t.Fatalf("expected ErrSliceNotFound after delete, got %v", err)
+	}
+}
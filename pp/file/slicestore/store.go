@@ -0,0 +1,142 @@
+package slicestore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	LOCAL     = "local"
+	MULTIDISK = "multidisk"
+	S3        = "s3"
+)
+
+var ErrSliceNotFound = errors.New("slice not found")
+
+// Store keeps the slices of the node. Slices are received in pieces, written with WriteAt, and committed once the
+// whole slice was verified
+type Store interface {
+	// Name describes the backend in logs and disk reports
+	Name() string
+	// Open returns a reader on a stored slice. ErrSliceNotFound is returned when the slice isn't stored
+	Open(sliceHash string) (Reader, error)
+	// WriteAt writes a piece of a slice at the given offset
+	WriteAt(sliceHash string, data []byte, offset uint64) error
+	// Commit is called once all the pieces of a slice are written and the slice hash is verified
+	Commit(sliceHash string) error
+	// Size returns the number of bytes of a slice written so far. ErrSliceNotFound is returned when the slice isn't stored
+	Size(sliceHash string) (int64, error)
+	Delete(sliceHash string) error
+	// Walk calls fn for each stored slice, until fn returns an error or ctx is done
+	Walk(ctx context.Context, fn func(info SliceInfo) error) error
+	// Usage returns the capacity of the backend
+	Usage() (Usage, error)
+}
+
+// Reader reads a stored slice
+type Reader interface {
+	io.ReaderAt
+	io.Closer
+	Len() int
+}
+
+type SliceInfo struct {
+	Hash    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Usage is the capacity of a backend, in bytes
+type Usage struct {
+	Path        string
+	Total       uint64
+	Free        uint64
+	Used        uint64
+	UsedPercent float64
+}
+
+func newUsage(path string, total, free, used uint64) Usage {
+	usage := Usage{Path: path, Total: total, Free: free, Used: used}
+	if total > 0 {
+		usage.UsedPercent = float64(used) / float64(total) * 100
+	}
+	return usage
+}
+
+// ReadAll returns the whole data of a stored slice
+func ReadAll(store Store, sliceHash string) ([]byte, error) {
+	r, err := store.Open(sliceHash)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	data := make([]byte, r.Len())
+	if _, err = r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed reading slice")
+	}
+	return data, nil
+}
+
+// bytesReader is a Reader on slice data held in memory
+type bytesReader struct {
+	*bytes.Reader
+}
+
+func newBytesReader(data []byte) Reader {
+	return bytesReader{bytes.NewReader(data)}
+}
+
+func (r bytesReader) Close() error {
+	return nil
+}
+
+// slicePath returns the path of a slice in the two-level hash directory layout of the storage folders
+func slicePath(root, sliceHash string) (string, error) {
+	if len(sliceHash) < 10 {
+		return "", errors.New("wrong size of slice hash")
+	}
+	return filepath.Join(root, sliceHash[:8], sliceHash[8:10], sliceHash), nil
+}
+
+// walkLayout calls fn for each slice of a folder using the two-level hash directory layout. Other folders and files,
+// like the reference lists, are skipped
+func walkLayout(ctx context.Context, root string, fn func(info SliceInfo) error) error {
+	root = filepath.Clean(root)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		if info.IsDir() {
+			if (len(parts) == 1 && len(parts[0]) == 8) || (len(parts) == 2 && len(parts[1]) == 2) {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+		name := parts[len(parts)-1]
+		if len(parts) != 3 || filepath.Ext(name) != "" || len(name) < 10 || name[:8] != parts[0] || name[8:10] != parts[1] {
+			return nil
+		}
+		return fn(SliceInfo{Hash: name, Size: info.Size(), ModTime: info.ModTime()})
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// UPLOAD_TASK_STATE_FILE stores the state of an unfinished upload, next to the tmp slices of the file
+const UPLOAD_TASK_STATE_FILE = "upload_task.json"
+
+func getUploadTaskStatePath(fileHash string) string {
+	return filepath.Join(GetTmpFileFolderPath(fileHash), UPLOAD_TASK_STATE_FILE)
+}
+
+// SaveUploadTaskState persists the state of an upload task. The file is replaced atomically
+func SaveUploadTaskState(fileHash string, data []byte) error {
+	if err := os.MkdirAll(GetTmpFileFolderPath(fileHash), os.ModePerm); err != nil {
+		return errors.Wrap(err, "failed creating tmp folder")
+	}
+	path := getUploadTaskStatePath(fileHash)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.Wrap(err, "failed writing upload task state")
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// ReadUploadTaskState returns the persisted state of an upload task
+func ReadUploadTaskState(fileHash string) ([]byte, error) {
+	return os.ReadFile(getUploadTaskStatePath(fileHash))
+}
+
+func DeleteUploadTaskState(fileHash string) {
+	_ = os.Remove(getUploadTaskStatePath(fileHash))
+}
+
+// ListUploadTaskStates returns the hashes of the files with a persisted upload task
+func ListUploadTaskStates() []string {
+	dirs, err := os.ReadDir(getTmpFolderPath())
+	if err != nil {
+		return nil
+	}
+	var fileHashes []string
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		if _, err = os.Stat(getUploadTaskStatePath(dir.Name())); err == nil {
+			fileHashes = append(fileHashes, dir.Name())
+		}
+	}
+	return fileHashes
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/pp"
+	"github.com/stratosnet/sds/pp/file/hls"
 	"github.com/stratosnet/sds/pp/setting"
 )
 
@@ -34,7 +35,13 @@ type HlsInfo struct {
 	SliceToSegment   map[uint64]string
 }
 
+// GetVideoDuration returns the duration of the video in seconds. Formats other than MP4 need ffprobe
 func GetVideoDuration(path string) (uint64, error) {
+	if duration, err := hls.Duration(path); err == nil {
+		return uint64(math.Ceil(duration)), nil
+	} else if !errors.Is(err, hls.ErrUnsupported) {
+		return 0, err
+	}
 	lengthCmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of",
 		"default=noprint_wrappers=1:nokey=1", path)
 	lengthOut, err := lengthCmd.Output()
@@ -45,17 +52,37 @@ func GetVideoDuration(path string) (uint64, error) {
 	return uint64(math.Ceil(length)), nil
 }
 
+// VideoToHls splits the video in HLS segments in the tmp folder of the file. MP4 files with H.264 and AAC are packaged
+// without external tools, the other formats need ffmpeg
 func VideoToHls(ctx context.Context, fileHash, filePath string, sliceDuration int) bool {
 	videoTmpFolder := GetVideoTmpFolder(fileHash)
 	if _, err := os.Stat(videoTmpFolder); os.IsNotExist(err) {
-		_ = os.Mkdir(videoTmpFolder, fs.ModePerm)
+		_ = os.MkdirAll(videoTmpFolder, fs.ModePerm)
+	}
+
+	err := hls.Package(filePath, videoTmpFolder, HLS_HEADER_FILENAME, float64(sliceDuration))
+	if err == nil {
+		return true
 	}
+	if !errors.Is(err, hls.ErrUnsupported) {
+		pp.ErrorLog(ctx, "failed to package the video in HLS segments: ", err)
+		return false
+	}
+	if _, lookErr := exec.LookPath("ffmpeg"); lookErr != nil {
+		pp.ErrorLog(ctx, "ffmpeg is needed to stream this video: ", err)
+		return false
+	}
+	pp.Log(ctx, "using ffmpeg to package the video: ", err)
+
 	hlsSegmentFileName := videoTmpFolder + "/" + HLS_SEGMENT_FILENAME
 	hlsHeaderFileName := videoTmpFolder + "/" + HLS_HEADER_FILENAME
 	transformCmd := exec.Command("ffmpeg", "-i", filePath, "-codec:", "copy", "-start_number", "0", "-hls_time", strconv.Itoa(sliceDuration),
 		"-hls_list_size", "0", "-f", "hls", "-hls_segment_filename", hlsSegmentFileName, hlsHeaderFileName)
 	stderr, _ := transformCmd.StderrPipe()
-	_ = transformCmd.Start()
+	if err = transformCmd.Start(); err != nil {
+		pp.ErrorLog(ctx, "failed to start ffmpeg: ", err)
+		return false
+	}
 
 	scanner := bufio.NewScanner(stderr)
 	scanner.Split(bufio.ScanLines)
@@ -63,10 +90,22 @@ func VideoToHls(ctx context.Context, fileHash, filePath string, sliceDuration in
 		m := scanner.Text()
 		pp.Log(ctx, m)
 	}
-	_ = transformCmd.Wait()
+	if err = transformCmd.Wait(); err != nil {
+		pp.ErrorLog(ctx, "ffmpeg failed: ", err)
+		return false
+	}
 	return true
 }
 
+// GetHlsFileCount returns the number of playlists and segments created by VideoToHls
+func GetHlsFileCount(fileHash string) (uint64, error) {
+	files, err := os.ReadDir(GetVideoTmpFolder(fileHash))
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(files)), nil
+}
+
 func GetHlsInfo(fileHash string, maxSliceCount uint64) (*HlsInfo, error) {
 	videoTmpFolder := GetVideoTmpFolder(fileHash)
 	totalSize := int64(0)
@@ -95,8 +134,8 @@ func GetHlsInfo(fileHash string, maxSliceCount uint64) (*HlsInfo, error) {
 	}
 
 	for _, f := range files {
-		ext := filepath.Ext(f.Name())
-		if ext == ".m3u8" {
+		// With several renditions, the header file is the master playlist and the other playlists are segments
+		if f.Name() == HLS_HEADER_FILENAME || (filepath.Ext(f.Name()) == ".m3u8" && hlsInfo.HeaderFile == "") {
 			hlsInfo.HeaderFile = f.Name()
 		}
 
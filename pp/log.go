@@ -71,3 +71,17 @@ func DebugLog(ctx context.Context, v ...interface{}) {
 func DebugLogf(ctx context.Context, template string, v ...interface{}) {
 	logDepthWithContext(ctx, utils.Debug, 4, fmt.Sprintf(template, v...))
 }
+
+// ShowProgress
+func ShowProgress(ctx context.Context, p float32) {
+	f := int(p)
+	m := int(100 - p)
+	str := ""
+	for i := 0; i < f; i++ {
+		str += "#"
+	}
+	for i := 0; i < m; i++ {
+		str += "-"
+	}
+	Log(ctx, str)
+}
@@ -47,6 +47,64 @@ var (
 		},
 		[]string{"rpc_req_cnt"})
 
+	NodeState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pp_node_state",
+			Help: ": 1 for the current state of the node state machine, 0 for the others",
+		},
+		[]string{"state"})
+
+	StateTransitions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pp_state_transitions_total",
+			Help: ": count of transitions of the node state machine",
+		},
+		[]string{"from", "to", "event"})
+
+	SliceOperationDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pp_slice_operation_duration_seconds",
+			Help:    ": duration of slice uploads, downloads, transfers and verifications",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 14),
+		},
+		[]string{"operation", "outcome", "peer"})
+
+	SpRoundTrip = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pp_sp_round_trip_seconds",
+			Help:    ": round trip time of the latency checks to the SPs",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		},
+		[]string{"sp"})
+
+	MessagesSent = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pp_messages_sent_total",
+			Help: ": count of messages sent, by message type",
+		},
+		[]string{"msg_type"})
+
+	MessagesReceived = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pp_messages_received_total",
+			Help: ": count of messages received, by message type",
+		},
+		[]string{"msg_type"})
+
+	HandlerPanics = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pp_handler_panics_total",
+			Help: ": count of panics recovered in the message handlers",
+		},
+		[]string{"msg_type"})
+
+	ScrubbedSlices = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pp_scrubbed_slices_total",
+			Help: ": count of stored slices re-verified by the scrub, by result",
+		},
+		[]string{"result"})
+
 	UploadProfiler = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "file_upload_profiler",
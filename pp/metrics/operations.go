@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/stratosnet/sds/framework/msg"
+	"github.com/stratosnet/sds/framework/msg/header"
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+const (
+	SliceUpload   = "upload"
+	SliceDownload = "download"
+	SliceTransfer = "transfer"
+	SliceVerify   = "verify"
+
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+
+	// operations never finished are dropped after this delay
+	sliceOperationTimeout = 30 * time.Minute
+)
+
+type sliceOperation struct {
+	start time.Time
+	peer  string
+}
+
+// key: operation + key, value: *sliceOperation
+var sliceOperations = utils.NewAutoCleanMap(sliceOperationTimeout)
+
+// StartSliceOperation starts timing an operation on a slice. The key identifies the slice within the operation
+func StartSliceOperation(operation, key, peer string) {
+	sliceOperations.Store(operation+key, &sliceOperation{start: time.Now(), peer: peer})
+}
+
+// FinishSliceOperation observes the duration of an operation started by StartSliceOperation. It does nothing
+// when the operation wasn't started or was already finished
+func FinishSliceOperation(operation, key string, success bool) {
+	value, ok := sliceOperations.Load(operation + key)
+	if !ok {
+		return
+	}
+	sliceOperations.Delete(operation + key)
+
+	op := value.(*sliceOperation)
+	outcome := OutcomeSuccess
+	if !success {
+		outcome = OutcomeFailure
+	}
+	SliceOperationDuration.WithLabelValues(operation, outcome, op.peer).Observe(time.Since(op.start).Seconds())
+}
+
+// CountMessageSent is meant to be used as the write option of the connections
+func CountMessageSent(_ context.Context, message *msg.RelayMsgBuf) {
+	MessagesSent.WithLabelValues(msgTypeName(message)).Inc()
+}
+
+// CountMessageReceived is meant to be used as the handle option of the connections
+func CountMessageReceived(_ context.Context, message *msg.RelayMsgBuf) {
+	MessagesReceived.WithLabelValues(msgTypeName(message)).Inc()
+}
+
+func msgTypeName(message *msg.RelayMsgBuf) string {
+	if message == nil {
+		return "unknown"
+	}
+	msgType := header.GetMsgTypeFromId(message.MSGHead.Cmd)
+	if msgType == nil || msgType.Name == "" {
+		return "unknown"
+	}
+	return msgType.Name
+}
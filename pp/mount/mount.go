@@ -0,0 +1,173 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package mount
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+
+	rpc_api "github.com/stratosnet/sds/pp/api/rpc"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+// mounts holds the FUSE servers of the active mounts
+var mounts = &sync.Map{} // map[dir]*fuse.Server
+
+// Mount exposes the files of the node wallet in dir as a read-only filesystem, until Unmount is called
+func Mount(ctx context.Context, dir string, cacheSize int64) error {
+	if setting.WalletAddress == "" || setting.WalletSigner == nil {
+		return errors.New("the node wallet is not loaded")
+	}
+	if _, ok := mounts.Load(dir); ok {
+		return errors.New(dir + " is already mounted")
+	}
+	files, err := newWalletFiles(ctx, cacheSize)
+	if err != nil {
+		return err
+	}
+
+	timeout := listRefreshInterval
+	server, err := fs.Mount(dir, &rootNode{files: files}, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:  "sds",
+			Name:    "sds",
+			Options: []string{"ro"},
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+	})
+	if err != nil {
+		return errors.Wrap(err, "couldn't mount "+dir)
+	}
+	mounts.Store(dir, server)
+	utils.Logf("Mounted the files of wallet %v in %v", setting.WalletAddress, dir)
+
+	go func() {
+		server.Wait()
+		mounts.Delete(dir)
+		files.closeAllSessions()
+		utils.Logf("Unmounted %v", dir)
+	}()
+	return nil
+}
+
+// Unmount removes a mount created by Mount
+func Unmount(dir string) error {
+	server, ok := mounts.Load(dir)
+	if !ok {
+		return errors.New(dir + " is not mounted")
+	}
+	return server.(*fuse.Server).Unmount()
+}
+
+// UnmountAll removes all the mounts, before the node stops
+func UnmountAll() {
+	mounts.Range(func(dir, server any) bool {
+		if err := server.(*fuse.Server).Unmount(); err != nil {
+			utils.ErrorLogf("couldn't unmount %v: %v", dir, err)
+		}
+		return true
+	})
+}
+
+// inode derives a stable inode number from a file hash
+func inode(fileHash string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(fileHash))
+	return h.Sum64()
+}
+
+// rootNode is the directory listing the files of the wallet
+type rootNode struct {
+	fs.Inode
+	files *walletFiles
+}
+
+var _ = (fs.NodeReaddirer)((*rootNode)(nil))
+var _ = (fs.NodeLookuper)((*rootNode)(nil))
+
+func (r *rootNode) Readdir(_ context.Context) (fs.DirStream, syscall.Errno) {
+	files, err := r.files.list()
+	if err != nil {
+		utils.ErrorLog("couldn't list the files of the mount", err)
+		return nil, syscall.EIO
+	}
+	entries := make([]fuse.DirEntry, 0, len(files))
+	for name, info := range files {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFREG, Ino: inode(info.FileHash)})
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+func (r *rootNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	files, err := r.files.list()
+	if err != nil {
+		utils.ErrorLog("couldn't list the files of the mount", err)
+		return nil, syscall.EIO
+	}
+	info, ok := files[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	node := &fileNode{files: r.files, info: info}
+	node.fillAttr(&out.Attr)
+	return r.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFREG, Ino: inode(info.FileHash)}), 0
+}
+
+// fileNode is a file of the wallet. Its content is read slice by slice from the storage PPs
+type fileNode struct {
+	fs.Inode
+	files *walletFiles
+	info  rpc_api.FileInfo
+}
+
+var _ = (fs.NodeGetattrer)((*fileNode)(nil))
+var _ = (fs.NodeOpener)((*fileNode)(nil))
+var _ = (fs.NodeReader)((*fileNode)(nil))
+
+func (n *fileNode) fillAttr(attr *fuse.Attr) {
+	attr.Mode = fuse.S_IFREG | 0444
+	attr.Size = n.info.FileSize
+	attr.Blocks = (n.info.FileSize + 511) / 512
+	attr.Mtime = n.info.CreateTime
+	attr.Ctime = n.info.CreateTime
+	attr.Atime = n.info.CreateTime
+}
+
+func (n *fileNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	n.fillAttr(&out.Attr)
+	return 0
+}
+
+func (n *fileNode) Open(_ context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	// Fetch the storage info when the file is opened, so that unreadable files fail early
+	if _, err := n.files.layout(n.info.FileHash); err != nil {
+		utils.ErrorLogf("couldn't open %v from the mount: %v", n.info.FileName, err)
+		if err == errUnsupportedFile {
+			return nil, 0, syscall.ENOTSUP
+		}
+		return nil, 0, syscall.EIO
+	}
+	return nil, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (n *fileNode) Read(_ context.Context, _ fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	read, err := n.files.read(n.info, dest, off)
+	if err != nil {
+		utils.ErrorLogf("couldn't read %v from the mount: %v", n.info.FileName, err)
+		return nil, syscall.EIO
+	}
+	return fuse.ReadResultData(dest[:read]), 0
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package mount
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+var errMountUnsupported = errors.New("FUSE mounts are not supported on this platform")
+
+func Mount(_ context.Context, _ string, _ int64) error {
+	return errMountUnsupported
+}
+
+func Unmount(_ string) error {
+	return errMountUnsupported
+}
+
+func UnmountAll() {}
@@ -0,0 +1,155 @@
+package mount
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+// sliceCache keeps the most recently read slices on disk, up to a maximum total size. Slices are stored by slice hash,
+// so they are shared between the files of the wallet and kept from one mount to the next
+type sliceCache struct {
+	dir     string
+	maxSize int64
+	size    int64
+	mtx     sync.Mutex
+	lru     *list.List               // least recently used at the front
+	entries map[string]*list.Element // sliceHash -> *cachedSlice
+}
+
+type cachedSlice struct {
+	sliceHash string
+	size      int64
+}
+
+func newSliceCache(dir string, maxSize int64) (*sliceCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "couldn't create slice cache folder")
+	}
+	c := &sliceCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	// Reload the slices cached by a previous mount, oldest first
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read slice cache folder")
+	}
+	infos := make([]os.FileInfo, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, info := range infos {
+		c.entries[info.Name()] = c.lru.PushBack(&cachedSlice{sliceHash: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+	c.evict()
+	return c, nil
+}
+
+func (c *sliceCache) path(sliceHash string) string {
+	return filepath.Join(c.dir, sliceHash)
+}
+
+// read fills dest with the data of a cached slice starting at offset. It returns false when the slice is not cached
+func (c *sliceCache) read(sliceHash string, dest []byte, offset int64) bool {
+	c.mtx.Lock()
+	element, ok := c.entries[sliceHash]
+	if ok {
+		c.lru.MoveToBack(element)
+	}
+	c.mtx.Unlock()
+	if !ok {
+		return false
+	}
+
+	f, err := os.Open(c.path(sliceHash))
+	if err != nil {
+		c.remove(sliceHash)
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, err = f.ReadAt(dest, offset); err != nil {
+		utils.ErrorLogf("couldn't read cached slice %v: %v", sliceHash, err)
+		c.remove(sliceHash)
+		return false
+	}
+	return true
+}
+
+// store adds a slice to the cache, evicting the least recently used slices if the cache grows too big
+func (c *sliceCache) store(sliceHash string, data []byte) error {
+	if int64(len(data)) > c.maxSize {
+		return nil
+	}
+	tmpFile, err := os.CreateTemp(c.dir, sliceHash+"-*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "couldn't create cached slice")
+	}
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), c.path(sliceHash))
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return errors.Wrap(err, "couldn't write cached slice")
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if element, ok := c.entries[sliceHash]; ok {
+		c.size -= element.Value.(*cachedSlice).size
+		c.lru.Remove(element)
+	}
+	c.entries[sliceHash] = c.lru.PushBack(&cachedSlice{sliceHash: sliceHash, size: int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+	return nil
+}
+
+func (c *sliceCache) remove(sliceHash string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if element, ok := c.entries[sliceHash]; ok {
+		c.size -= element.Value.(*cachedSlice).size
+		c.lru.Remove(element)
+		delete(c.entries, sliceHash)
+	}
+	_ = os.Remove(c.path(sliceHash))
+}
+
+// evict removes the least recently used slices until the cache fits in its maximum size. The caller holds the lock
+func (c *sliceCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		slice := c.lru.Remove(c.lru.Front()).(*cachedSlice)
+		delete(c.entries, slice.sliceHash)
+		c.size -= slice.size
+		if err := os.Remove(c.path(slice.sliceHash)); err != nil && !os.IsNotExist(err) {
+			utils.ErrorLogf("couldn't evict cached slice %v: %v", slice.sliceHash, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package mount
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSliceCacheEviction(t *testing.T) {
+	c, err := newSliceCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sliceHash := range []string{"a", "b"} {
+		if err = c.store(sliceHash, []byte(sliceHash+sliceHash+sliceHash+sliceHash)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reading a slice makes it the most recently used
+	dest := make([]byte, 2)
+	if !c.read("a", dest, 2) || string(dest) != "aa" {
+		t.Fatalf("slice a should be cached, read %q", dest)
+	}
+	if err = c.store("c", []byte("cccc")); err != nil {
+		t.Fatal(err)
+	}
+	if c.read("b", dest, 0) {
+		t.Fatal("the least recently used slice should be evicted")
+	}
+	if _, err = os.Stat(c.path("b")); !os.IsNotExist(err) {
+		t.Fatal("the evicted slice should be removed from disk")
+	}
+	if !c.read("a", dest, 0) || !c.read("c", dest, 0) {
+		t.Fatal("the recently used slices should be kept")
+	}
+	if c.size != 8 {
+		t.Fatalf("expected 8 cached bytes, got %v", c.size)
+	}
+
+	if err = c.store("big", make([]byte, 11)); err != nil {
+		t.Fatal(err)
+	}
+	if c.read("big", dest, 0) || !c.read("a", dest, 0) {
+		t.Fatal("a slice bigger than the cache shouldn't be cached, nor evict the others")
+	}
+}
+
+func TestSliceCacheReload(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, sliceHash := range []string{"old", "recent", "newest"} {
+		path := filepath.Join(dir, sliceHash)
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i-3) * time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "partial-1.tmp"), []byte("da"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newSliceCache(dir, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]byte, 4)
+	if c.read("old", dest, 0) {
+		t.Fatal("the oldest slice should be evicted when the reloaded cache is too big")
+	}
+	if !c.read("recent", dest, 0) || !c.read("newest", dest, 0) || string(dest) != "data" {
+		t.Fatal("the slices cached by a previous mount should be reloaded")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "partial-1.tmp")); !os.IsNotExist(err) {
+		t.Fatal("the partially written slices should be removed")
+	}
+}
@@ -0,0 +1,336 @@
+package mount
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/crypto"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/sds-msg/protos"
+	msgutils "github.com/stratosnet/sds/sds-msg/utils"
+
+	rpc_api "github.com/stratosnet/sds/pp/api/rpc"
+	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/pp/namespace"
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
+	"github.com/stratosnet/sds/pp/task"
+)
+
+const (
+	cacheFolder = "mount"
+
+	// listRefreshInterval is how long the file list of the wallet is kept before being requested again
+	listRefreshInterval = 30 * time.Second
+	// sessionLifetime is how long the storage info of a file is used to fetch slices before being requested again
+	sessionLifetime = 30 * time.Minute
+)
+
+var errUnsupportedFile = errors.New("encrypted, erasure coded and video stream files can't be read from a mount, use get instead")
+
+// walletFiles serves the files of the node wallet to a mount, fetching their slices on demand
+type walletFiles struct {
+	ctx   context.Context
+	cache *sliceCache
+
+	listMtx  sync.Mutex
+	listedAt time.Time
+	files    map[string]rpc_api.FileInfo // name in the mount -> file
+
+	fileLocks   sync.Map // map[fileHash]*sync.Mutex
+	layouts     sync.Map // map[fileHash][]*protos.DownloadSliceInfo
+	sessions    sync.Map // map[fileHash]*readSession
+	unsupported sync.Map // map[fileHash]bool
+}
+
+// readSession is a storage info obtained from the SP, used to fetch the slices of a file one by one.
+// A storage PP only serves each slice once for a given storage info
+type readSession struct {
+	fInfo     *protos.RspFileStorageInfo
+	createdAt time.Time
+	fetched   map[uint64]bool
+}
+
+// detachedContext keeps the values of the context of the mount request, such as the p2p server, but not its
+// cancellation. The mount outlives the request
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func newWalletFiles(ctx context.Context, cacheSize int64) (*walletFiles, error) {
+	cache, err := newSliceCache(filepath.Join(file.GetTmpDownloadPath(), cacheFolder), cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &walletFiles{ctx: detachedContext{ctx}, cache: cache}, nil
+}
+
+func walletSignature(msgType, msg string) (rpc_api.Signature, error) {
+	sign, err := setting.WalletSigner.Sign(msgType, []byte(msg))
+	if err != nil {
+		return rpc_api.Signature{}, errors.Wrap(err, "wallet failed to sign message")
+	}
+	pubkey, err := fwtypes.WalletPubKeyToBech32(setting.WalletPublicKey)
+	if err != nil {
+		return rpc_api.Signature{}, err
+	}
+	return rpc_api.Signature{Address: setting.WalletAddress, Pubkey: pubkey, Signature: hex.EncodeToString(sign)}, nil
+}
+
+// list returns the files of the wallet by their name in the mount
+func (w *walletFiles) list() (map[string]rpc_api.FileInfo, error) {
+	w.listMtx.Lock()
+	defer w.listMtx.Unlock()
+	if w.files != nil && time.Since(w.listedAt) < listRefreshInterval {
+		return w.files, nil
+	}
+
+	var infos []rpc_api.FileInfo
+	for page := uint64(0); ; page++ {
+		reqTime := time.Now().Unix()
+		sig, err := walletSignature(signer.MSG_LIST, msgutils.FindMyFileListWalletSignMessage(setting.WalletAddress, reqTime))
+		if err != nil {
+			return nil, err
+		}
+		res := namespace.RpcPubApi().RequestList(w.ctx, rpc_api.ParamReqFileList{Signature: sig, PageId: page, ReqTime: reqTime})
+		if res.Return != rpc_api.SUCCESS {
+			return nil, errors.New("failed listing files of the wallet, return " + res.Return)
+		}
+		infos = append(infos, res.FileInfo...)
+		if len(res.FileInfo) == 0 || uint64(len(infos)) >= res.TotalNumber {
+			break
+		}
+	}
+
+	w.files = mountFileNames(infos)
+	w.listedAt = time.Now()
+	return w.files, nil
+}
+
+// mountFileNames names the files in the mount. The oldest file keeps its name when several files share it,
+// the others are prefixed with their file hash
+func mountFileNames(infos []rpc_api.FileInfo) map[string]rpc_api.FileInfo {
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].CreateTime < infos[j].CreateTime })
+	files := make(map[string]rpc_api.FileInfo, len(infos))
+	for _, info := range infos {
+		name := strings.ReplaceAll(info.FileName, "/", "_")
+		if name == "" || name == "." || name == ".." {
+			name = info.FileHash
+		}
+		if existing, ok := files[name]; ok {
+			if existing.FileHash == info.FileHash {
+				continue
+			}
+			name = info.FileHash + "_" + name
+		}
+		files[name] = info
+	}
+	return files
+}
+
+// lockFile serializes the requests made to the SP and storage PPs for a file
+func (w *walletFiles) lockFile(fileHash string) func() {
+	value, _ := w.fileLocks.LoadOrStore(fileHash, &sync.Mutex{})
+	mtx := value.(*sync.Mutex)
+	mtx.Lock()
+	return mtx.Unlock
+}
+
+// requestSession requests a new storage info for a file, replacing the current session. The caller holds the file lock
+func (w *walletFiles) requestSession(fileHash string) (*readSession, error) {
+	sn, err := w.sequenceNumber()
+	if err != nil {
+		return nil, err
+	}
+	reqTime := time.Now().Unix()
+	sig, err := walletSignature(signer.MSG_DOWNLOAD, msgutils.GetFileDownloadWalletSignMessage(fileHash, setting.WalletAddress, sn, reqTime))
+	if err != nil {
+		return nil, err
+	}
+	fileHandle := fwtypes.DataMeshId{Owner: setting.WalletAddress, Hash: fileHash}.String()
+	res := namespace.RequestRangeDownload(w.ctx, rpc_api.ParamReqDownloadFile{FileHandle: fileHandle, Signature: sig, ReqTime: reqTime})
+	if res.Return != rpc_api.DOWNLOAD_OK {
+		return nil, errors.New("failed requesting storage info of file " + fileHash + ", return " + res.Return)
+	}
+	f, ok := task.DownloadFileMap.Load(fileHash + res.ReqId)
+	if !ok {
+		return nil, errors.New("missing storage info of file " + fileHash)
+	}
+	fInfo := f.(*protos.RspFileStorageInfo)
+	if fInfo.EncryptionTag != "" || fInfo.ErasureDataShards != 0 || crypto.IsVideoStream(fileHash) {
+		w.closeSession(fInfo)
+		w.unsupported.Store(fileHash, true)
+		return nil, errUnsupportedFile
+	}
+
+	session := &readSession{fInfo: fInfo, createdAt: time.Now(), fetched: make(map[uint64]bool)}
+	if previous, loaded := w.sessions.Load(fileHash); loaded {
+		w.closeSession(previous.(*readSession).fInfo)
+	}
+	w.sessions.Store(fileHash, session)
+	w.layouts.Store(fileHash, sortedSlices(fInfo.SliceInfo))
+	return session, nil
+}
+
+func (w *walletFiles) closeSession(fInfo *protos.RspFileStorageInfo) {
+	task.CleanDownloadFileAndConnMap(w.ctx, fInfo.FileHash, fInfo.ReqId)
+	task.DeleteDownloadTask(fInfo.FileHash, fInfo.WalletAddress, fInfo.ReqId)
+	file.CleanFileHash(fInfo.FileHash + fInfo.ReqId)
+}
+
+// closeAllSessions releases the download tasks of all the files read from the mount
+func (w *walletFiles) closeAllSessions() {
+	w.sessions.Range(func(key, value any) bool {
+		w.sessions.Delete(key)
+		w.closeSession(value.(*readSession).fInfo)
+		return true
+	})
+}
+
+func (w *walletFiles) sequenceNumber() (string, error) {
+	res := namespace.RpcPubApi().RequestGetOzone(w.ctx, rpc_api.ParamReqGetOzone{WalletAddr: setting.WalletAddress})
+	if res.Return != rpc_api.SUCCESS {
+		return "", errors.New("failed getting a sequence number, return " + res.Return)
+	}
+	return res.SequenceNumber, nil
+}
+
+func sortedSlices(slices []*protos.DownloadSliceInfo) []*protos.DownloadSliceInfo {
+	sorted := make([]*protos.DownloadSliceInfo, len(slices))
+	copy(sorted, slices)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].SliceOffset.SliceOffsetStart < sorted[j].SliceOffset.SliceOffsetStart
+	})
+	return sorted
+}
+
+// layout returns the slices of a file sorted by offset, requesting its storage info the first time
+func (w *walletFiles) layout(fileHash string) ([]*protos.DownloadSliceInfo, error) {
+	if slices, ok := w.layouts.Load(fileHash); ok {
+		return slices.([]*protos.DownloadSliceInfo), nil
+	}
+	if _, ok := w.unsupported.Load(fileHash); ok {
+		return nil, errUnsupportedFile
+	}
+	unlock := w.lockFile(fileHash)
+	defer unlock()
+	if slices, ok := w.layouts.Load(fileHash); ok {
+		return slices.([]*protos.DownloadSliceInfo), nil
+	}
+	if _, err := w.requestSession(fileHash); err != nil {
+		return nil, err
+	}
+	slices, _ := w.layouts.Load(fileHash)
+	return slices.([]*protos.DownloadSliceInfo), nil
+}
+
+// read fills dest with the content of a file starting at offset, and returns the number of bytes read
+func (w *walletFiles) read(info rpc_api.FileInfo, dest []byte, offset int64) (int, error) {
+	if offset >= int64(info.FileSize) {
+		return 0, nil
+	}
+	end := offset + int64(len(dest))
+	if end > int64(info.FileSize) {
+		end = int64(info.FileSize)
+	}
+	slices, err := w.layout(info.FileHash)
+	if err != nil {
+		return 0, err
+	}
+
+	pos := offset
+	for pos < end {
+		i := sort.Search(len(slices), func(i int) bool { return int64(slices[i].SliceOffset.SliceOffsetEnd) > pos })
+		if i == len(slices) || int64(slices[i].SliceOffset.SliceOffsetStart) > pos {
+			return int(pos - offset), errors.Errorf("no slice of file %v contains offset %v", info.FileHash, pos)
+		}
+		slice := slices[i]
+		sliceStart := int64(slice.SliceOffset.SliceOffsetStart)
+		chunkEnd := end
+		if sliceEnd := int64(slice.SliceOffset.SliceOffsetEnd); sliceEnd < chunkEnd {
+			chunkEnd = sliceEnd
+		}
+		chunk := dest[pos-offset : chunkEnd-offset]
+
+		if !w.cache.read(slice.SliceStorageInfo.SliceHash, chunk, pos-sliceStart) {
+			data, err := w.fetchSlice(info.FileHash, slice.SliceNumber)
+			if err != nil {
+				return int(pos - offset), err
+			}
+			copy(chunk, data[pos-sliceStart:])
+		}
+		pos = chunkEnd
+	}
+	return int(pos - offset), nil
+}
+
+// fetchSlice downloads a slice from the storage PP holding it, and adds it to the cache
+func (w *walletFiles) fetchSlice(fileHash string, sliceNumber uint64) ([]byte, error) {
+	unlock := w.lockFile(fileHash)
+	defer unlock()
+
+	value, ok := w.sessions.Load(fileHash)
+	session, _ := value.(*readSession)
+	if !ok || session.fetched[sliceNumber] || time.Since(session.createdAt) > sessionLifetime {
+		var err error
+		if session, err = w.requestSession(fileHash); err != nil {
+			return nil, err
+		}
+	}
+
+	var slice *protos.DownloadSliceInfo
+	for _, sliceInfo := range session.fInfo.SliceInfo {
+		if sliceInfo.SliceNumber == sliceNumber {
+			slice = sliceInfo
+			break
+		}
+	}
+	if slice == nil {
+		return nil, errors.Errorf("slice %v of file %v is missing from its storage info", sliceNumber, fileHash)
+	}
+	sliceSize := slice.SliceOffset.SliceOffsetEnd - slice.SliceOffset.SliceOffsetStart
+
+	// Another read might have fetched the slice while waiting for the lock
+	data := make([]byte, sliceSize)
+	if w.cache.read(slice.SliceStorageInfo.SliceHash, data, 0) {
+		return data, nil
+	}
+
+	session.fetched[sliceNumber] = true
+	res := namespace.RpcPubApi().RequestDownloadSliceData(w.ctx, rpc_api.ParamReqDownloadData{
+		FileHash:       fileHash,
+		ReqId:          session.fInfo.ReqId,
+		SliceHash:      slice.SliceStorageInfo.SliceHash,
+		SliceNumber:    slice.SliceNumber,
+		SliceSize:      slice.SliceStorageInfo.SliceSize,
+		NetworkAddress: slice.StoragePpInfo.NetworkAddress,
+		P2PAddress:     slice.StoragePpInfo.P2PAddress,
+	})
+	if res.Return != rpc_api.DOWNLOAD_OK {
+		return nil, errors.Errorf("failed downloading slice %v of file %v, return %v", sliceNumber, fileHash, res.Return)
+	}
+	data, err := b64.StdEncoding.DecodeString(res.FileData)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid slice data")
+	}
+	if uint64(len(data)) != sliceSize {
+		return nil, errors.Errorf("wrong size for slice %v of file %v: expected %v, got %v", sliceNumber, fileHash, sliceSize, len(data))
+	}
+	if err = w.cache.store(slice.SliceStorageInfo.SliceHash, data); err != nil {
+		utils.ErrorLog("couldn't cache slice", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,94 @@
+package mount
+
+import (
+	"testing"
+
+	rpc_api "github.com/stratosnet/sds/pp/api/rpc"
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+func TestMountFileNames(t *testing.T) {
+	files := mountFileNames([]rpc_api.FileInfo{
+		{FileHash: "hash3", FileName: "report.pdf", CreateTime: 3},
+		{FileHash: "hash1", FileName: "report.pdf", CreateTime: 1},
+		{FileHash: "hash1", FileName: "report.pdf", CreateTime: 1},
+		{FileHash: "hash2", FileName: "photos/cat.jpg", CreateTime: 2},
+		{FileHash: "hash4", FileName: "..", CreateTime: 4},
+		{FileHash: "hash5", FileName: "", CreateTime: 5},
+	})
+
+	expected := map[string]string{
+		"report.pdf":       "hash1",
+		"hash3_report.pdf": "hash3",
+		"photos_cat.jpg":   "hash2",
+		"hash4":            "hash4",
+		"hash5":            "hash5",
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("expected %v files, got %v", len(expected), files)
+	}
+	for name, fileHash := range expected {
+		if files[name].FileHash != fileHash {
+			t.Errorf("expected %v to be file %v, got %v", name, fileHash, files[name].FileHash)
+		}
+	}
+}
+
+func testSliceInfo(sliceNumber, start, end uint64) *protos.DownloadSliceInfo {
+	return &protos.DownloadSliceInfo{
+		SliceNumber:      sliceNumber,
+		SliceStorageInfo: &protos.SliceStorageInfo{SliceHash: string(rune('a' + sliceNumber - 1)), SliceSize: end - start},
+		SliceOffset:      &protos.SliceOffset{SliceOffsetStart: start, SliceOffsetEnd: end},
+	}
+}
+
+func TestWalletFilesRead(t *testing.T) {
+	cache, err := newSliceCache(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &walletFiles{cache: cache}
+	info := rpc_api.FileInfo{FileHash: "hash", FileSize: 10}
+	// slices given out of order, as the SP does
+	w.layouts.Store(info.FileHash, sortedSlices([]*protos.DownloadSliceInfo{
+		testSliceInfo(3, 8, 10),
+		testSliceInfo(1, 0, 4),
+		testSliceInfo(2, 4, 8),
+	}))
+	for sliceHash, data := range map[string]string{"a": "0123", "b": "4567", "c": "89"} {
+		if err = cache.store(sliceHash, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		offset   int64
+		size     int
+		expected string
+	}{
+		{0, 4, "0123"},
+		{2, 4, "2345"},
+		{3, 6, "345678"},
+		{0, 10, "0123456789"},
+		{7, 10, "789"},
+		{10, 4, ""},
+	}
+	for _, test := range tests {
+		dest := make([]byte, test.size)
+		n, err := w.read(info, dest, test.offset)
+		if err != nil {
+			t.Fatalf("reading %v bytes at %v: %v", test.size, test.offset, err)
+		}
+		if string(dest[:n]) != test.expected {
+			t.Errorf("reading %v bytes at %v: expected %q, got %q", test.size, test.offset, test.expected, dest[:n])
+		}
+	}
+
+	// A gap in the layout is reported instead of returning the wrong data
+	gapInfo := rpc_api.FileInfo{FileHash: "gap", FileSize: 10}
+	w.layouts.Store(gapInfo.FileHash, []*protos.DownloadSliceInfo{testSliceInfo(1, 0, 4), testSliceInfo(3, 8, 10)})
+	dest := make([]byte, 10)
+	if n, err := w.read(gapInfo, dest, 0); err == nil || n != 4 {
+		t.Fatalf("a missing slice should fail the read after the first slice, read %v bytes, err %v", n, err)
+	}
+}
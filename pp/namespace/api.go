@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/stratosnet/sds/framework/core"
 	"github.com/stratosnet/sds/framework/crypto"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/stratosnet/sds/pp"
 	rpc_api "github.com/stratosnet/sds/pp/api/rpc"
+	"github.com/stratosnet/sds/pp/bandwidth"
 	"github.com/stratosnet/sds/pp/event"
 	"github.com/stratosnet/sds/pp/file"
 	"github.com/stratosnet/sds/pp/metrics"
@@ -34,7 +36,10 @@ import (
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
 	"github.com/stratosnet/sds/pp/task"
+	"github.com/stratosnet/sds/pp/tx"
+	"github.com/stratosnet/sds/pp/webhook"
 	"github.com/stratosnet/sds/rpc"
 )
 
@@ -142,6 +147,12 @@ func (api *rpcPubApi) RequestUpload(ctx context.Context, param rpc_api.ParamReqU
 	if _, ok := uploadOffset.Load(fileHash); ok {
 		return rpc_api.Result{Return: rpc_api.CONFLICT_WITH_ANOTHER_SESSION}
 	}
+	if param.Resume {
+		if err := event.ResumeUpload(ctx, fileHash, walletAddr); err != nil {
+			return rpc_api.Result{Return: rpc_api.FILE_REQ_FAILURE, Detail: err.Error()}
+		}
+		return rpc_api.Result{Return: rpc_api.SUCCESS}
+	}
 
 	nfup.Add(1)
 	waitNumber := nfup.Load()
@@ -405,7 +416,7 @@ func (api *rpcPubApi) RequestUploadStream(ctx context.Context, param rpc_api.Par
 		}
 
 		fileHandler := event.GetUploadFileHandler(true)
-		fInfo, slices, err := fileHandler.PreUpload(ctx, tmpFilePath, "")
+		fInfo, slices, err := fileHandler.PreUpload(ctx, tmpFilePath, nil, nil, false)
 		if err != nil {
 			_ = file.SetRemoteFileResult(fileHash, rpc_api.Result{Return: rpc_api.INTERNAL_DATA_FAILURE, Detail: "failed handling pre_upload" + err.Error()})
 			return
@@ -563,6 +574,16 @@ func (api *rpcPubApi) RequestDownload(ctx context.Context, param rpc_api.ParamRe
 
 func (api *rpcPubApi) RequestVideoDownload(ctx context.Context, param rpc_api.ParamReqDownloadFile) rpc_api.Result {
 	metrics.RpcReqCount.WithLabelValues("RequestDownload").Inc()
+	return requestFileStorageInfo(ctx, param, uuid.New().String())
+}
+
+// RequestRangeDownload requests the storage info of a file without downloading it. Its slices can then be fetched
+// individually with RequestDownloadSliceData or DownloadSliceRange, using the reqId of the result
+func RequestRangeDownload(ctx context.Context, param rpc_api.ParamReqDownloadFile) rpc_api.Result {
+	return requestFileStorageInfo(ctx, param, task.RANGE_READ_REQID+uuid.New().String())
+}
+
+func requestFileStorageInfo(ctx context.Context, param rpc_api.ParamReqDownloadFile, reqId string) rpc_api.Result {
 	_, _, fileHash, _, err := fwtypes.ParseFileHandle(param.FileHandle)
 	if err != nil {
 		return rpc_api.Result{Return: rpc_api.WRONG_INPUT}
@@ -590,7 +611,6 @@ func (api *rpcPubApi) RequestVideoDownload(ctx context.Context, param rpc_api.Pa
 		return rpc_api.Result{Return: rpc_api.SIGNATURE_FAILURE}
 	}
 
-	reqId := uuid.New().String()
 	ctx = core.RegisterRemoteReqId(ctx, reqId)
 	// request for downloading file
 	req := requests.RequestDownloadFile(ctx, fileHash, param.FileHandle, wallet, reqId, wsig, wpk.Bytes(), nil, param.ReqTime)
@@ -672,6 +692,64 @@ func (api *rpcPubApi) RequestDownloadSliceData(ctx context.Context, param rpc_ap
 	}
 }
 
+// DownloadSliceRange downloads the bytes [start, end) of a file from the storage PP of the slice containing them,
+// in a session opened by RequestRangeDownload. The storage PP only sends the pieces of the slice overlapping the range
+func DownloadSliceRange(ctx context.Context, fileHash, reqId string, slice *protos.DownloadSliceInfo, start, end uint64) ([]byte, error) {
+	ctx = core.RegisterRemoteReqId(ctx, reqId)
+	f, ok := task.DownloadFileMap.Load(fileHash + reqId)
+	if !ok {
+		return nil, errors.New("missing storage info of file " + fileHash)
+	}
+	sliceStart := slice.SliceOffset.SliceOffsetStart
+	if start < sliceStart || end > slice.SliceOffset.SliceOffsetEnd || start >= end {
+		return nil, errors.Errorf("range %v-%v is outside slice %v", start, end, slice.SliceNumber)
+	}
+
+	req := &protos.ReqDownloadSlice{
+		RspFileStorageInfo: f.(*protos.RspFileStorageInfo),
+		SliceNumber:        slice.SliceNumber,
+		P2PAddress:         p2pserver.GetP2pServer(ctx).GetP2PAddress().String(),
+		PieceRange:         &protos.SliceOffset{SliceOffsetStart: start - sliceStart, SliceOffsetEnd: end - sliceStart},
+	}
+	key := slice.SliceStorageInfo.SliceHash + reqId
+	msgKey := "download#" + fileHash + strconv.FormatUint(slice.SliceNumber, 10) + slice.StoragePpInfo.P2PAddress + reqId
+	err := p2pserver.GetP2pServer(ctx).SendMessageByCachedConn(ctx, msgKey, slice.StoragePpInfo.NetworkAddress, req, header.ReqDownloadSlice, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed requesting slice")
+	}
+
+	data := make([]byte, end-start)
+	received := uint64(0)
+	for received < end-start {
+		select {
+		case <-time.After(WAIT_TIMEOUT):
+			return nil, errors.Errorf("timeout downloading slice %v of file %v", slice.SliceNumber, fileHash)
+		case result := <-file.SubscribeRemoteSliceEvent(key):
+			file.UnsubscribeRemoteSliceEvent(key)
+			decoded, err := b64.StdEncoding.DecodeString(result.FileData)
+			file.SetDownloadSliceDone(key)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid slice data")
+			}
+			// the pieces are aligned on the piece size, only their overlap with the range is kept
+			pieceStart, pieceEnd := *result.OffsetStart, *result.OffsetEnd
+			if pieceStart < start {
+				decoded = decoded[start-pieceStart:]
+				pieceStart = start
+			}
+			if pieceEnd > end {
+				decoded = decoded[:uint64(len(decoded))-(pieceEnd-end)]
+				pieceEnd = end
+			}
+			if pieceStart >= pieceEnd {
+				continue
+			}
+			received += uint64(copy(data[pieceStart-start:], decoded))
+		}
+	}
+	return data, nil
+}
+
 func (api *rpcPubApi) DownloadData(ctx context.Context, param rpc_api.ParamDownloadData) rpc_api.Result {
 
 	// download from the cached file
@@ -1016,6 +1094,16 @@ func (api *rpcPubApi) RequestGetShared(ctx context.Context, param rpc_api.ParamR
 
 func (api *rpcPubApi) RequestGetVideoShared(ctx context.Context, param rpc_api.ParamReqGetShared) rpc_api.Result {
 	metrics.RpcReqCount.WithLabelValues("RequestGetShared").Inc()
+	return requestSharedStorageInfo(ctx, param, uuid.New().String())
+}
+
+// RequestRangeShared requests the storage info of a shared file without downloading it. Its slices can then be
+// fetched individually with RequestDownloadSliceData, using the reqId of the result
+func RequestRangeShared(ctx context.Context, param rpc_api.ParamReqGetShared) rpc_api.Result {
+	return requestSharedStorageInfo(ctx, param, task.RANGE_READ_REQID+uuid.New().String())
+}
+
+func requestSharedStorageInfo(ctx context.Context, param rpc_api.ParamReqGetShared, reqId string) rpc_api.Result {
 	wallet := param.Signature.Address
 	pubkey := param.Signature.Pubkey
 
@@ -1043,7 +1131,6 @@ func (api *rpcPubApi) RequestGetVideoShared(ctx context.Context, param rpc_api.P
 		return rpc_api.Result{Return: rpc_api.WRONG_INPUT}
 	}
 
-	reqId := uuid.New().String()
 	ctx, cancel := context.WithTimeout(ctx, WAIT_TIMEOUT)
 	defer cancel()
 	key := shareLink.Link + reqId
@@ -1111,7 +1198,7 @@ func (api *rpcPrivApi) RequestRegisterNewPP(ctx context.Context, param rpc_api.P
 	nowSec := time.Now().Unix()
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.RegisterNewPPWalletSignMessage(setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_REGISTER, []byte(wsignMsg))
 	if err != nil {
 		result := &rpc_api.RPResult{Return: rpc_api.SIGNATURE_FAILURE + ", wrong wallet signature"}
 		return *result
@@ -1292,26 +1379,12 @@ func (api *rpcPrivApi) RequestWithdraw(ctx context.Context, param rpc_api.ParamR
 
 	reqId := uuid.New().String()
 	ctx = core.RegisterRemoteReqId(ctx, reqId)
-	ctx, cancel := context.WithTimeout(ctx, INIT_WAIT_TIMEOUT)
-	defer cancel()
-
-	err = stratoschain.Withdraw(ctx, amount, targetAddr, txFee)
-	if err != nil {
-		return rpc_api.WithdrawResult{Return: rpc_api.WRONG_INPUT}
-	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			result := &rpc_api.WithdrawResult{Return: rpc_api.TIME_OUT}
-			return *result
-		default:
-			result, found := pp.GetWithdrawResult(setting.WalletAddress + reqId)
-			if result != nil && found {
-				return *result
-			}
-		}
+	_ = stratoschain.Withdraw(ctx, amount, targetAddr, txFee)
+	if result, found := pp.GetWithdrawResult(setting.WalletAddress + reqId); result != nil && found {
+		return *result
 	}
+	return rpc_api.WithdrawResult{Return: rpc_api.WRONG_INPUT}
 }
 
 func (api *rpcPrivApi) RequestSend(ctx context.Context, param rpc_api.ParamReqSend) rpc_api.SendResult {
@@ -1343,26 +1416,24 @@ func (api *rpcPrivApi) RequestSend(ctx context.Context, param rpc_api.ParamReqSe
 
 	reqId := uuid.New().String()
 	ctx = core.RegisterRemoteReqId(ctx, reqId)
-	ctx, cancel := context.WithTimeout(ctx, INIT_WAIT_TIMEOUT)
-	defer cancel()
 
-	err = stratoschain.Send(ctx, amount, toAddr, txFee)
-	if err != nil {
-		return rpc_api.SendResult{Return: rpc_api.WRONG_INPUT}
+	_ = stratoschain.Send(ctx, amount, toAddr, txFee)
+	if result, found := pp.GetSendResult(setting.WalletAddress + reqId); result != nil && found {
+		return *result
 	}
+	return rpc_api.SendResult{Return: rpc_api.WRONG_INPUT}
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			result := &rpc_api.SendResult{Return: rpc_api.TIME_OUT}
-			return *result
-		default:
-			result, found := pp.GetSendResult(setting.WalletAddress + reqId)
-			if result != nil && found {
-				return *result
-			}
-		}
+func (api *rpcPrivApi) RequestTxStatus(ctx context.Context, param rpc_api.ParamReqTxStatus) rpc_api.TxStatusResult {
+	metrics.RpcReqCount.WithLabelValues("RequestTxStatus").Inc()
+	if param.TxHash == "" {
+		return rpc_api.TxStatusResult{Return: rpc_api.SUCCESS, Txs: tx.GetTrackedTxs()}
+	}
+	trackedTx, found := tx.GetTrackedTx(param.TxHash)
+	if !found {
+		return rpc_api.TxStatusResult{Return: rpc_api.WRONG_INPUT}
 	}
+	return rpc_api.TxStatusResult{Return: rpc_api.SUCCESS, Txs: []tx.TrackedTx{trackedTx}}
 }
 
 func (api *rpcPrivApi) RequestStatus(ctx context.Context, param rpc_api.ParamReqStatus) rpc_api.StatusResult {
@@ -1415,6 +1486,92 @@ func (api *rpcPubApi) RequestServiceStatus(ctx context.Context, param rpc_api.Pa
 	return *rpcResult
 }
 
+// RequestStateHistory returns the current state of the node and its last state transitions, the most recent first
+func (api *rpcPubApi) RequestStateHistory(ctx context.Context, param rpc_api.ParamReqStateHistory) rpc_api.StateHistoryResult {
+	metrics.RpcReqCount.WithLabelValues("RequestStateHistory").Inc()
+	peer := network.GetPeer(ctx)
+	result := rpc_api.StateHistoryResult{
+		Return:      rpc_api.SUCCESS,
+		State:       peer.GetStateFromFsm().Name,
+		Transitions: []rpc_api.StateTransition{},
+	}
+	for _, t := range peer.GetStateHistory(int(param.Limit)) {
+		result.Transitions = append(result.Transitions, rpc_api.StateTransition(t))
+	}
+	return result
+}
+
+func (api *rpcPrivApi) RequestScrub(ctx context.Context, param rpc_api.ParamReqScrub) rpc_api.ScrubResult {
+	metrics.RpcReqCount.WithLabelValues("RequestScrub").Inc()
+	var err error
+	switch param.Action {
+	case "start":
+		err = event.StartScrub()
+	case "stop":
+		err = event.StopScrub()
+	case "", "status":
+	default:
+		return rpc_api.ScrubResult{Return: rpc_api.WRONG_INPUT}
+	}
+	result := rpc_api.ScrubResult{Return: rpc_api.SUCCESS, Status: rpc_api.ScrubStatus(event.GetScrubStatus())}
+	if err != nil {
+		result.Return = rpc_api.GENERIC_ERR
+		result.Message = err.Error()
+	}
+	return result
+}
+
+func (api *rpcPrivApi) RequestBandwidth(ctx context.Context, param rpc_api.ParamReqBandwidth) rpc_api.BandwidthResult {
+	metrics.RpcReqCount.WithLabelValues("RequestBandwidth").Inc()
+	if param.Config != nil {
+		if err := bandwidth.SetConfig(*param.Config, param.Persist); err != nil {
+			return rpc_api.BandwidthResult{Return: rpc_api.WRONG_INPUT, Message: err.Error()}
+		}
+	}
+	config, active := bandwidth.GetConfig()
+	return rpc_api.BandwidthResult{Return: rpc_api.SUCCESS, Config: config, ActiveSchedule: active}
+}
+
+func (api *rpcPrivApi) RequestWebhook(ctx context.Context, param rpc_api.ParamReqWebhook) rpc_api.WebhookResult {
+	metrics.RpcReqCount.WithLabelValues("RequestWebhook").Inc()
+	result := rpc_api.WebhookResult{Return: rpc_api.SUCCESS}
+	var err error
+	switch param.Action {
+	case "add":
+		var added webhook.Webhook
+		if added, err = webhook.Add(param.Url, param.Events, param.Secret); err == nil {
+			result.Webhook = &added
+		}
+	case "remove":
+		err = webhook.Remove(param.Id)
+	case "test":
+		err = webhook.Test(param.Id)
+	case "", "list":
+	default:
+		return rpc_api.WebhookResult{Return: rpc_api.WRONG_INPUT, Message: "unknown action " + param.Action}
+	}
+	if err != nil {
+		return rpc_api.WebhookResult{Return: rpc_api.WRONG_INPUT, Message: err.Error()}
+	}
+
+	if result.Webhooks, err = webhook.List(); err != nil {
+		return rpc_api.WebhookResult{Return: rpc_api.GENERIC_ERR, Message: err.Error()}
+	}
+	if result.Webhooks == nil {
+		result.Webhooks = []webhook.Webhook{}
+	}
+	return result
+}
+
+// RequestWebhookDeliveries returns the last attempts to notify the webhooks, the most recent first
+func (api *rpcPrivApi) RequestWebhookDeliveries(ctx context.Context, param rpc_api.ParamReqWebhookDeliveries) rpc_api.WebhookDeliveriesResult {
+	metrics.RpcReqCount.WithLabelValues("RequestWebhookDeliveries").Inc()
+	return rpc_api.WebhookDeliveriesResult{
+		Return:     rpc_api.SUCCESS,
+		Deliveries: webhook.Deliveries(param.WebhookId, int(param.Limit)),
+	}
+}
+
 func (api *rpcPrivApi) RequestUpdatePPInfo(ctx context.Context, param rpc_api.ParamReqUpdatePPInfo) rpc_api.UpdatePPInfoResult {
 	metrics.RpcReqCount.WithLabelValues("RequestUpdatePPInfo").Inc()
 	var err error
@@ -1437,24 +1594,10 @@ func (api *rpcPrivApi) RequestUpdatePPInfo(ctx context.Context, param rpc_api.Pa
 
 	reqId := uuid.New().String()
 	ctx = core.RegisterRemoteReqId(ctx, reqId)
-	ctx, cancel := context.WithTimeout(ctx, INIT_WAIT_TIMEOUT)
-	defer cancel()
 
-	err = stratoschain.UpdateResourceNode(ctx, param.Moniker, param.Identity, param.Website, param.SecurityContact, param.Details, txFee)
-	if err != nil {
-		return rpc_api.UpdatePPInfoResult{Return: rpc_api.WRONG_INPUT}
-	}
-
-	for {
-		select {
-		case <-ctx.Done():
-			result := &rpc_api.UpdatePPInfoResult{Return: rpc_api.TIME_OUT}
-			return *result
-		default:
-			result, found := pp.GetUpdatePPInfoResult(setting.WalletAddress + reqId)
-			if result != nil && found {
-				return *result
-			}
-		}
+	_ = stratoschain.UpdateResourceNode(ctx, param.Moniker, param.Identity, param.Website, param.SecurityContact, param.Details, txFee)
+	if result, found := pp.GetUpdatePPInfoResult(setting.WalletAddress + reqId); result != nil && found {
+		return *result
 	}
+	return rpc_api.UpdatePPInfoResult{Return: rpc_api.WRONG_INPUT}
 }
@@ -0,0 +1,337 @@
+package namespace
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+
+	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/rpc"
+)
+
+const (
+	rpcTokenPrefix = "sds_"
+	rpcTokenFile   = "rpc_tokens.json"
+	rpcTokenBytes  = 32
+	allScopes      = "*"
+)
+
+// authContextKey holds the hash of the bearer token presented with a request
+var authContextKey = rpc.ContextKey{Key: "auth"}
+
+// RpcToken is a bearer token accepted by the JSON-RPC server. Only the hash of the secret is stored
+type RpcToken struct {
+	Id        string   `json:"id"`
+	Name      string   `json:"name"`
+	Hash      string   `json:"hash"`
+	Scopes    []string `json:"scopes"` // namespaces (eg: "owner"), methods (eg: "owner_requestSend") or "*"
+	CreatedAt int64    `json:"created_at"`
+	ExpiresAt int64    `json:"expires_at"` // 0 when the token never expires
+}
+
+// Expired returns true once the expiry time of the token has passed
+func (t *RpcToken) Expired() bool {
+	return t.ExpiresAt != 0 && time.Now().Unix() >= t.ExpiresAt
+}
+
+// Allows returns true if one of the scopes of the token covers the method
+func (t *RpcToken) Allows(method string) bool {
+	namespace := strings.SplitN(method, "_", 2)[0]
+	if namespace == rpc.MetadataApi {
+		return true
+	}
+	for _, scope := range t.Scopes {
+		if scope == allScopes || scope == namespace || scope == method {
+			return true
+		}
+	}
+	return false
+}
+
+// RpcTokenStore keeps the tokens in a JSON file. The file is reloaded whenever it changes, so that the tokens minted or
+// revoked with "ppd token" take effect without restarting the node
+type RpcTokenStore struct {
+	path    string
+	mtx     sync.Mutex
+	modTime time.Time
+	tokens  []RpcToken
+}
+
+func NewRpcTokenStore(path string) *RpcTokenStore {
+	return &RpcTokenStore{path: path}
+}
+
+// DefaultRpcTokenPath is the token file of the node, next to its keys
+func DefaultRpcTokenPath() string {
+	return filepath.Join(setting.Config.Home.AccountsPath, rpcTokenFile)
+}
+
+// load returns the tokens of the file, reading it again only if it was modified. The caller holds the lock
+func (s *RpcTokenStore) load() ([]RpcToken, error) {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.tokens, s.modTime = nil, time.Time{}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't stat the rpc token file")
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return s.tokens, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read the rpc token file")
+	}
+	var tokens []RpcToken
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &tokens); err != nil {
+			return nil, errors.Wrap(err, "couldn't parse the rpc token file")
+		}
+	}
+	s.tokens, s.modTime = tokens, info.ModTime()
+	return tokens, nil
+}
+
+// save replaces the content of the token file. The caller holds the lock
+func (s *RpcTokenStore) save(tokens []RpcToken) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return errors.Wrap(err, "couldn't create the rpc token folder")
+	}
+	tmpPath := s.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.Wrap(err, "couldn't write the rpc token file")
+	}
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "couldn't write the rpc token file")
+	}
+	s.modTime = time.Time{}
+	return nil
+}
+
+// List returns the tokens sorted by creation time
+func (s *RpcTokenStore) List() ([]RpcToken, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	list := append([]RpcToken{}, tokens...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt < list[j].CreatedAt })
+	return list, nil
+}
+
+// Mint creates a token with the given scopes. The secret is returned once and cannot be recovered later
+func (s *RpcTokenStore) Mint(name string, scopes []string, ttl time.Duration) (string, RpcToken, error) {
+	if len(scopes) == 0 {
+		return "", RpcToken{}, errors.New("a token needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t,") {
+			return "", RpcToken{}, errors.Errorf("invalid scope [%v]", scope)
+		}
+	}
+
+	secret := make([]byte, rpcTokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", RpcToken{}, errors.Wrap(err, "couldn't generate the token")
+	}
+	value := rpcTokenPrefix + hex.EncodeToString(secret)
+	token := RpcToken{
+		Id:        uuid.New().String(),
+		Name:      name,
+		Hash:      hashRpcToken(value),
+		Scopes:    scopes,
+		CreatedAt: time.Now().Unix(),
+	}
+	if ttl > 0 {
+		token.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return "", RpcToken{}, err
+	}
+	if err = s.save(append(append([]RpcToken{}, tokens...), token)); err != nil {
+		return "", RpcToken{}, err
+	}
+	return value, token, nil
+}
+
+// Revoke deletes the token with the given id
+func (s *RpcTokenStore) Revoke(id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	remaining := make([]RpcToken, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Id != id {
+			remaining = append(remaining, token)
+		}
+	}
+	if len(remaining) == len(tokens) {
+		return errors.Errorf("no rpc token with id [%v]", id)
+	}
+	return s.save(remaining)
+}
+
+// Authorize checks that a request made to an http server outside the rpc servers, like the gateway, carries a valid
+// token including the scope. The token is sent in the "Authorization: Bearer" header or the "token" query parameter
+func (s *RpcTokenStore) Authorize(r *http.Request, scope string) error {
+	hash, err := (&rpcAuth{tokens: s}).authenticate(r, true)
+	if err != nil {
+		return err
+	}
+	if hash == "" {
+		return errors.New("a valid token is required")
+	}
+	token, err := s.lookup(hash)
+	if err != nil || token == nil {
+		return errors.New("invalid or expired token")
+	}
+	if !token.Allows(scope) {
+		return errors.Errorf("the scopes of token %v don't include %v", token.Id, scope)
+	}
+	return nil
+}
+
+// lookup returns the valid token with the given hash, or nil if it doesn't exist or expired
+func (s *RpcTokenStore) lookup(hash string) (*RpcToken, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tokens {
+		if subtle.ConstantTimeCompare([]byte(tokens[i].Hash), []byte(hash)) == 1 {
+			if tokens[i].Expired() {
+				return nil, nil
+			}
+			token := tokens[i]
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+func hashRpcToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// rpcAuth checks the bearer tokens of the requests made to an HttpServer, and the scopes of every call
+type rpcAuth struct {
+	tokens       *RpcTokenStore
+	requireToken bool // also require a token for the public namespaces
+	audit        *utils.CombinedLogger
+}
+
+// authenticate returns the hash of the valid token presented with the request, or an empty string when there is none.
+// Browsers cannot set headers on websocket connections, so the token can also be passed in the "token" query parameter
+func (a *rpcAuth) authenticate(r *http.Request, allowQuery bool) (string, error) {
+	value := ""
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, credentials, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return "", errors.New("unsupported authorization scheme")
+		}
+		value = strings.TrimSpace(credentials)
+	} else if allowQuery {
+		value = r.URL.Query().Get("token")
+	}
+	if value == "" {
+		return "", nil
+	}
+
+	hash := hashRpcToken(value)
+	token, err := a.tokens.lookup(hash)
+	if err != nil {
+		utils.ErrorLog("couldn't check rpc token", err)
+		return "", errors.New("couldn't check the token")
+	}
+	if token == nil {
+		return "", errors.New("invalid or expired token")
+	}
+	return hash, nil
+}
+
+// authorizer returns the check run before each call. The token is looked up again for every call, so that revoking it
+// also stops the websocket connections opened with it
+func (a *rpcAuth) authorizer(apis []rpc.API) rpc.Authorizer {
+	public := make(map[string]bool)
+	for _, api := range apis {
+		public[api.Namespace] = api.Public
+	}
+	public[rpc.MetadataApi] = true
+
+	return func(ctx context.Context, method string) error {
+		namespace := strings.SplitN(method, "_", 2)[0]
+		privileged := !public[namespace]
+
+		var token *RpcToken
+		if hash, ok := ctx.Value(authContextKey).(string); ok {
+			var err error
+			if token, err = a.tokens.lookup(hash); err != nil {
+				utils.ErrorLog("couldn't check rpc token", err)
+			}
+		}
+
+		var err error
+		switch {
+		case !privileged && !a.requireToken:
+		case token == nil:
+			err = errors.New("a valid bearer token is required")
+		case !token.Allows(method):
+			err = errors.Errorf("the scopes of token %v don't include %v", token.Id, method)
+		}
+		if privileged {
+			a.logAudit(ctx, token, method, err)
+		}
+		return err
+	}
+}
+
+// logAudit records a call to a privileged namespace, whether it was allowed or not
+func (a *rpcAuth) logAudit(ctx context.Context, token *RpcToken, method string, err error) {
+	if a.audit == nil {
+		return
+	}
+	remote, _ := ctx.Value(rpc.ContextKey{Key: "remote"}).(string)
+	tokenId, tokenName := "-", "-"
+	if token != nil {
+		tokenId, tokenName = token.Id, token.Name
+	}
+	result := "allowed"
+	if err != nil {
+		result = "denied: " + err.Error()
+	}
+	a.audit.Log(utils.Info, "method", method, "remote", remote, "token", tokenId, "name", tokenName, "result", result)
+}
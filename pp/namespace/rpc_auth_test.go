@@ -0,0 +1,193 @@
+package namespace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stratosnet/sds/rpc"
+)
+
+type testAuthService struct{}
+
+func (testAuthService) Echo(value string) string {
+	return value
+}
+
+var testAuthApis = []rpc.API{
+	{Namespace: "user", Service: testAuthService{}, Public: true},
+	{Namespace: "owner", Service: testAuthService{}, Public: false},
+}
+
+func newTestTokenStore(t *testing.T) *RpcTokenStore {
+	return NewRpcTokenStore(filepath.Join(t.TempDir(), rpcTokenFile))
+}
+
+func mintTestToken(t *testing.T, store *RpcTokenStore, ttl time.Duration, scopes ...string) (string, RpcToken) {
+	value, token, err := store.Mint("test", scopes, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value, token
+}
+
+func TestRpcTokenAllows(t *testing.T) {
+	cases := []struct {
+		scopes  []string
+		method  string
+		allowed bool
+	}{
+		{[]string{"*"}, "owner_requestSend", true},
+		{[]string{"owner"}, "owner_requestSend", true},
+		{[]string{"owner"}, "user_requestGetOzone", false},
+		{[]string{"owner_requestSend"}, "owner_requestSend", true},
+		{[]string{"owner_requestSend"}, "owner_requestWithdraw", false},
+		{[]string{"user", "owner_requestSend"}, "owner_requestSend", true},
+		{[]string{"user"}, rpc.MetadataApi + "_modules", true},
+	}
+	for _, c := range cases {
+		token := RpcToken{Scopes: c.scopes}
+		if token.Allows(c.method) != c.allowed {
+			t.Errorf("scopes %v allowing %v: expected %v", c.scopes, c.method, c.allowed)
+		}
+	}
+}
+
+func TestRpcTokenLookup(t *testing.T) {
+	store := newTestTokenStore(t)
+	if _, _, err := store.Mint("empty", nil, 0); err == nil {
+		t.Fatal("a token without scope should be refused")
+	}
+	if _, _, err := store.Mint("invalid", []string{"owner user"}, 0); err == nil {
+		t.Fatal("a scope with spaces should be refused")
+	}
+
+	value, token := mintTestToken(t, store, 0, "owner")
+	found, err := store.lookup(hashRpcToken(value))
+	if err != nil || found == nil || found.Id != token.Id {
+		t.Fatalf("the minted token should be found, got %+v, err %v", found, err)
+	}
+	if found, _ = store.lookup(hashRpcToken(value + "0")); found != nil {
+		t.Fatal("another token shouldn't be found")
+	}
+
+	expiredValue, expired := mintTestToken(t, store, time.Hour, "owner")
+	tokens, err := store.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range tokens {
+		if tokens[i].Id == expired.Id {
+			tokens[i].ExpiresAt = time.Now().Add(-time.Second).Unix()
+		}
+	}
+	if err = store.save(tokens); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ = store.lookup(hashRpcToken(expiredValue)); found != nil {
+		t.Fatal("an expired token shouldn't be found")
+	}
+
+	if err = store.Revoke(token.Id); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ = store.lookup(hashRpcToken(value)); found != nil {
+		t.Fatal("a revoked token shouldn't be found")
+	}
+	if err = store.Revoke(token.Id); err == nil {
+		t.Fatal("revoking an unknown token should fail")
+	}
+}
+
+func TestRpcAuthorizer(t *testing.T) {
+	store := newTestTokenStore(t)
+	ownerValue, _ := mintTestToken(t, store, 0, "owner")
+	userValue, _ := mintTestToken(t, store, 0, "user")
+	withToken := func(value string) context.Context {
+		return context.WithValue(context.Background(), authContextKey, hashRpcToken(value))
+	}
+
+	authorize := (&rpcAuth{tokens: store}).authorizer(testAuthApis)
+	if err := authorize(context.Background(), "user_echo"); err != nil {
+		t.Fatalf("the public namespaces shouldn't need a token: %v", err)
+	}
+	if err := authorize(context.Background(), "owner_echo"); err == nil {
+		t.Fatal("the non-public namespaces should need a token")
+	}
+	if err := authorize(withToken(userValue), "owner_echo"); err == nil {
+		t.Fatal("a token without the owner scope should be denied")
+	}
+	if err := authorize(withToken(ownerValue), "owner_echo"); err != nil {
+		t.Fatalf("a token with the owner scope should be allowed: %v", err)
+	}
+
+	requireToken := (&rpcAuth{tokens: store, requireToken: true}).authorizer(testAuthApis)
+	if err := requireToken(context.Background(), "user_echo"); err == nil {
+		t.Fatal("the public namespaces should need a token when tokens are required")
+	}
+	if err := requireToken(withToken(userValue), "user_echo"); err != nil {
+		t.Fatalf("a token with the user scope should be allowed: %v", err)
+	}
+}
+
+func TestHttpServerTokenAuth(t *testing.T) {
+	store := newTestTokenStore(t)
+	ownerValue, ownerToken := mintTestToken(t, store, 0, "owner")
+
+	server := NewHTTPServer(rpc.HTTPTimeouts{})
+	server.EnableTokenAuth(store, false, nil)
+	if err := server.EnableRPC(testAuthApis, HttpConfig{Modules: []string{"user", "owner"}, Vhosts: []string{"*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.EnableWS(testAuthApis, WsConfig{Modules: []string{"user", "owner"}, Origins: []string{"*"}}, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(authorization, method string) *httptest.ResponseRecorder {
+		body := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":["hello"]}`
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := call("Bearer sds_invalid", "user_echo"); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("a bad bearer token should get a 401 over http, got %v", w.Code)
+	}
+	if w := call("Basic dXNlcjpwYXNz", "user_echo"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("another authorization scheme should get a 401, got %v", w.Code)
+	}
+	if w := call("", "owner_echo"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "bearer token is required") {
+		t.Fatalf("a call to the owner namespace without token should be denied, got %v %v", w.Code, w.Body.String())
+	}
+	if w := call("Bearer "+ownerValue, "owner_echo"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"result":"hello"`) {
+		t.Fatalf("a call with a valid token should be served, got %v %v", w.Code, w.Body.String())
+	}
+
+	if err := store.Revoke(ownerToken.Id); err != nil {
+		t.Fatal(err)
+	}
+	if w := call("Bearer "+ownerValue, "owner_echo"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("a revoked token should get a 401, got %v", w.Code)
+	}
+
+	// The websocket handshake is refused before the connection is upgraded
+	for _, target := range []string{"/?token=sds_invalid", "/?token=" + ownerValue} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Connection", "Upgrade")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("a bad token should get a 401 over websocket, got %v", w.Code)
+		}
+	}
+}
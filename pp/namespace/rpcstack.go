@@ -53,6 +53,9 @@ type HttpServer struct {
 	cert string
 	key  string
 
+	// bearer token support
+	auth *rpcAuth
+
 	// HTTP RPC handler things.
 
 	httpConfig  HttpConfig
@@ -84,6 +87,13 @@ func (h *HttpServer) EnableTLS(cert, key string) {
 	h.key = key
 }
 
+// EnableTokenAuth checks the bearer tokens of the requests against the token store. Calls to the namespaces that are
+// not public always need a token with a matching scope, and are recorded in the audit log. It must be called before
+// EnableRPC and EnableWS
+func (h *HttpServer) EnableTokenAuth(tokens *RpcTokenStore, requireToken bool, audit *utils.CombinedLogger) {
+	h.auth = &rpcAuth{tokens: tokens, requireToken: requireToken, audit: audit}
+}
+
 // SetListenAddr configures the listening address of the server.
 // The address can only be set while the server isn't running.
 func (h *HttpServer) SetListenAddr(host string, port int) error {
@@ -204,6 +214,19 @@ func (h *HttpServer) Start(ctx context.Context) error {
 }
 
 func (h *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check the bearer token, the scopes are checked for each call by the rpc server
+	if h.auth != nil {
+		hash, err := h.auth.authenticate(r, isWebsocket(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sds"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if hash != "" {
+			r = r.WithContext(context.WithValue(r.Context(), authContextKey, hash))
+		}
+	}
+
 	// check if ws request and serve if ws enabled
 	ws := h.wsHandler.Load().(*rpcHandler)
 	if ws != nil && isWebsocket(r) {
@@ -308,6 +331,9 @@ func (h *HttpServer) EnableRPC(apis []rpc.API, config HttpConfig) error {
 	if err := RegisterApis(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
+	if h.auth != nil {
+		srv.SetAuthorizer(h.auth.authorizer(apis))
+	}
 	h.httpConfig = config
 	h.httpHandler.Store(&rpcHandler{
 		Handler: NewHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts),
@@ -340,6 +366,9 @@ func (h *HttpServer) EnableWS(apis []rpc.API, config WsConfig, ctx context.Conte
 	if err := RegisterApis(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
+	if h.auth != nil {
+		srv.SetAuthorizer(h.auth.authorizer(apis))
+	}
 	h.wsConfig = config
 	h.wsHandler.Store(&rpcHandler{
 		Handler: srv.WebsocketHandler(config.Origins, ctx),
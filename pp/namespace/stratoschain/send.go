@@ -15,7 +15,7 @@ import (
 	txclienttypes "github.com/stratosnet/sds/tx-client/types"
 )
 
-// Broadcast send tx to stratos-chain directly
+// Broadcast send tx to stratos-chain directly, without waiting for it to be included
 func Send(ctx context.Context, amount txclienttypes.Coin, toAddr fwtypes.WalletAddress, txFee txclienttypes.TxFee) error {
 	sendTxBytes, err := reqSendData(ctx, amount, toAddr, txFee)
 	if err != nil {
@@ -23,21 +23,24 @@ func Send(ctx context.Context, amount txclienttypes.Coin, toAddr fwtypes.WalletA
 		return err
 	}
 
-	err = tx.BroadcastTx(sendTxBytes)
-	if err != nil {
+	trackedTx, err := tx.Broadcast(sendTxBytes, func(txFee txclienttypes.TxFee) ([]byte, error) {
+		return reqSendData(ctx, amount, toAddr, txFee)
+	})
+	if trackedTx.Hash == "" {
 		pp.ErrorLog(ctx, "The send transaction couldn't be broadcast", err)
 		return err
 	}
 
 	reqId := core.GetRemoteReqId(ctx)
 	if reqId != "" {
-		rpcResult := &rpc.SendResult{
-			Return: rpc.SUCCESS,
-		}
-		defer pp.SetRPCResult(setting.WalletAddress+reqId, rpcResult)
+		pp.SetRPCResult(setting.WalletAddress+reqId, &rpc.SendResult{Return: rpc.TxReturn(trackedTx), Tx: &trackedTx})
 	}
-
-	pp.Log(ctx, "Send transaction delivered.")
+	if err != nil {
+		pp.ErrorLog(ctx, "The send transaction failed:", trackedTx)
+		return err
+	}
+	pp.Log(ctx, "Send transaction broadcast:", trackedTx)
+	go logTxResult(ctx, "send", trackedTx.Hash)
 	return nil
 }
 
@@ -49,7 +52,7 @@ func reqSendData(_ context.Context, amount txclienttypes.Coin, toAddr fwtypes.Wa
 
 	txMsg := txclienttx.BuildSendMsg(senderAddress, toAddr, amount)
 	signatureKeys := []*txclienttypes.SignatureKey{
-		{Address: setting.WalletAddress, PrivateKey: setting.WalletPrivateKey.Bytes(), Type: txclienttypes.SignatureSecp256k1},
+		{Address: setting.WalletAddress, Signer: setting.WalletSigner, Type: txclienttypes.SignatureSecp256k1},
 	}
 
 	chainId := setting.Config.Blockchain.ChainId
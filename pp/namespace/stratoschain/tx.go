@@ -0,0 +1,23 @@
+package stratoschain
+
+import (
+	"context"
+
+	"github.com/stratosnet/sds/pp"
+	"github.com/stratosnet/sds/pp/tx"
+)
+
+// logTxResult waits until a tx, or the tx replacing it, is final and logs its result. The rpc result of the request
+// broadcasting the tx was set as soon as the tx was broadcast, or rejected, the final state is queried with the tx hash
+func logTxResult(ctx context.Context, name, hash string) {
+	trackedTx, err := tx.Wait(context.Background(), hash)
+	if err != nil {
+		pp.ErrorLog(ctx, "Failed waiting for the "+name+" transaction", err)
+		return
+	}
+	if trackedTx.Status != tx.TX_INCLUDED {
+		pp.ErrorLog(ctx, "The "+name+" transaction failed:", trackedTx)
+		return
+	}
+	pp.Log(ctx, "The "+name+" transaction was included:", trackedTx)
+}
@@ -17,7 +17,7 @@ import (
 	txclienttypes "github.com/stratosnet/sds/tx-client/types"
 )
 
-// Broadcast updateResourceNode tx to stratos-chain directly
+// Broadcast updateResourceNode tx to stratos-chain directly, without waiting for it to be included
 func UpdateResourceNode(ctx context.Context, moniker, identity, website, securityContact, details string, txFee txclienttypes.TxFee) error {
 	ppInfo, err := grpc.QueryResourceNode(setting.Config.Keys.P2PAddress)
 	if err != nil {
@@ -49,21 +49,24 @@ func UpdateResourceNode(ctx context.Context, moniker, identity, website, securit
 		return err
 	}
 
-	err = tx.BroadcastTx(updateResourceNodeTxBytes)
-	if err != nil {
+	trackedTx, err := tx.Broadcast(updateResourceNodeTxBytes, func(txFee txclienttypes.TxFee) ([]byte, error) {
+		return reqUpdateResourceNodeData(ctx, newDescription, ppInfo.GetNodeType(), txFee)
+	})
+	if trackedTx.Hash == "" {
 		pp.ErrorLog(ctx, "The updateResourceNode transaction couldn't be broadcast", err)
 		return err
 	}
 
 	reqId := core.GetRemoteReqId(ctx)
 	if reqId != "" {
-		rpcResult := &rpc.SendResult{
-			Return: rpc.SUCCESS,
-		}
-		defer pp.SetRPCResult(setting.WalletAddress+reqId, rpcResult)
+		pp.SetRPCResult(setting.WalletAddress+reqId, &rpc.UpdatePPInfoResult{Return: rpc.TxReturn(trackedTx), Tx: &trackedTx})
 	}
-
-	pp.Log(ctx, "Send transaction delivered.")
+	if err != nil {
+		pp.ErrorLog(ctx, "The updateResourceNode transaction failed:", trackedTx)
+		return err
+	}
+	pp.Log(ctx, "UpdateResourceNode transaction broadcast:", trackedTx)
+	go logTxResult(ctx, "updateResourceNode", trackedTx.Hash)
 	return nil
 }
 
@@ -83,7 +86,7 @@ func reqUpdateResourceNodeData(_ context.Context, description *registerv1.Descri
 
 	txMsg := txclienttx.BuildUpdateResourceNodeMsg(networkAddress, ownerAddress, beneficiaryAddress, description, nodeType)
 	signatureKeys := []*txclienttypes.SignatureKey{
-		{Address: setting.WalletAddress, PrivateKey: setting.WalletPrivateKey.Bytes(), Type: txclienttypes.SignatureSecp256k1},
+		{Address: setting.WalletAddress, Signer: setting.WalletSigner, Type: txclienttypes.SignatureSecp256k1},
 	}
 
 	chainId := setting.Config.Blockchain.ChainId
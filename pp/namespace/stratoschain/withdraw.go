@@ -16,7 +16,7 @@ import (
 	"github.com/stratosnet/sds/pp/tx"
 )
 
-// Broadcast withdraw tx to stratos-chain directly
+// Broadcast withdraw tx to stratos-chain directly, without waiting for it to be included
 func Withdraw(ctx context.Context, amount txclienttypes.Coin, targetAddr fwtypes.WalletAddress, txFee txclienttypes.TxFee) error {
 	withdrawTxBytes, err := reqWithdrawData(ctx, amount, targetAddr, txFee)
 	if err != nil {
@@ -24,21 +24,24 @@ func Withdraw(ctx context.Context, amount txclienttypes.Coin, targetAddr fwtypes
 		return err
 	}
 
-	err = tx.BroadcastTx(withdrawTxBytes)
-	if err != nil {
+	trackedTx, err := tx.Broadcast(withdrawTxBytes, func(txFee txclienttypes.TxFee) ([]byte, error) {
+		return reqWithdrawData(ctx, amount, targetAddr, txFee)
+	})
+	if trackedTx.Hash == "" {
 		pp.ErrorLog(ctx, "The withdraw transaction couldn't be broadcast", err)
 		return err
 	}
 
 	reqId := core.GetRemoteReqId(ctx)
 	if reqId != "" {
-		rpcResult := &rpc.WithdrawResult{
-			Return: rpc.SUCCESS,
-		}
-		defer pp.SetRPCResult(setting.WalletAddress+reqId, rpcResult)
+		pp.SetRPCResult(setting.WalletAddress+reqId, &rpc.WithdrawResult{Return: rpc.TxReturn(trackedTx), Tx: &trackedTx})
 	}
-
-	pp.Log(ctx, "Withdraw transaction delivered.")
+	if err != nil {
+		pp.ErrorLog(ctx, "The withdraw transaction failed:", trackedTx)
+		return err
+	}
+	pp.Log(ctx, "Withdraw transaction broadcast:", trackedTx)
+	go logTxResult(ctx, "withdraw", trackedTx.Hash)
 	return nil
 }
 
@@ -50,7 +53,7 @@ func reqWithdrawData(_ context.Context, amount txclienttypes.Coin, targetAddr fw
 
 	txMsg := txclienttx.BuildWithdrawMsg(amount, senderAddress, targetAddr)
 	signatureKeys := []*txclienttypes.SignatureKey{
-		{Address: setting.WalletAddress, PrivateKey: setting.WalletPrivateKey.Bytes(), Type: txclienttypes.SignatureSecp256k1},
+		{Address: setting.WalletAddress, Signer: setting.WalletSigner, Type: txclienttypes.SignatureSecp256k1},
 	}
 
 	chainId := setting.Config.Blockchain.ChainId
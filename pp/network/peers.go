@@ -19,6 +19,7 @@ type Network struct {
 	reloadRegisterRetry  int
 	reloadConnecting     bool
 	fsm                  utils.Fsm
+	history              *stateHistory
 }
 
 func GetPeer(ctx context.Context) *Network {
@@ -33,6 +34,7 @@ func GetPeer(ctx context.Context) *Network {
 func (p *Network) StartPP(ctx context.Context) {
 	p.ppPeerClock = clock.NewClock()
 	p.pingTimeSPMap = &sync.Map{}
+	p.history = newStateHistory(stateHistoryPath())
 	p.InitFsm()
 	p.StartGetSPList(ctx)()
 	p.ScheduleSpLatencyCheck(ctx)
@@ -11,6 +11,7 @@ import (
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
 )
 
 // RegisterToSP send ReqRegister to SP
@@ -18,7 +19,7 @@ func (p *Network) RegisterToSP(ctx context.Context) {
 	nowSec := time.Now().Unix()
 	//// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.RegisterWalletSignMessage(setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_REGISTER, []byte(wsignMsg))
 	if err != nil {
 		return
 	}
@@ -48,7 +49,7 @@ func (p *Network) GetSPList(ctx context.Context) func() {
 		pp.DebugLogf(ctx, "SendMessage(client.spConn, req, header.ReqGetSPList)")
 		nowSec := time.Now().Unix()
 		wsignMsg := msgutils.GetSPListWalletSignMessage(setting.WalletAddress, nowSec)
-		wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+		wsign, err := setting.WalletSigner.Sign(signer.MSG_LIST, []byte(wsignMsg))
 		if err != nil {
 			return
 		}
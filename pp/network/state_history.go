@@ -0,0 +1,153 @@
+package network
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stratosnet/sds/framework/utils"
+
+	"github.com/stratosnet/sds/pp/metrics"
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+const (
+	stateHistoryFile = "state_history.json"
+	// maxStateHistory is the number of transitions kept in the history
+	maxStateHistory = 500
+)
+
+// StateTransition is a change of state of the node state machine
+type StateTransition struct {
+	Time  int64  `json:"time"`
+	Event string `json:"event"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Cause string `json:"cause"`
+}
+
+// stateHistory keeps the last transitions of the state machine, persisted in the node home
+type stateHistory struct {
+	mtx         sync.Mutex
+	path        string
+	transitions []StateTransition
+}
+
+// key: subscriber id, value: chan StateTransition
+var transitionSubscribers = &sync.Map{}
+
+// SubscribeStateTransitions returns a channel receiving the transitions of the state machine. A subscriber that
+// doesn't keep up misses transitions, the state machine never waits for it
+func SubscribeStateTransitions(id string) <-chan StateTransition {
+	c := make(chan StateTransition, 16)
+	transitionSubscribers.Store(id, c)
+	return c
+}
+
+func UnsubscribeStateTransitions(id string) {
+	transitionSubscribers.Delete(id)
+}
+
+func newStateHistory(path string) *stateHistory {
+	h := &stateHistory{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			utils.ErrorLog("couldn't read the state history", err)
+		}
+		return h
+	}
+	if err = json.Unmarshal(data, &h.transitions); err != nil {
+		utils.ErrorLog("couldn't parse the state history", err)
+		h.transitions = nil
+	}
+	return h
+}
+
+func (h *stateHistory) add(transition StateTransition) {
+	h.mtx.Lock()
+	h.transitions = append(h.transitions, transition)
+	if len(h.transitions) > maxStateHistory {
+		h.transitions = append([]StateTransition(nil), h.transitions[len(h.transitions)-maxStateHistory:]...)
+	}
+	if err := h.save(); err != nil {
+		utils.ErrorLog("couldn't save the state history", err)
+	}
+	h.mtx.Unlock()
+
+	transitionSubscribers.Range(func(k, v interface{}) bool {
+		select {
+		case v.(chan StateTransition) <- transition:
+		default:
+		}
+		return true
+	})
+}
+
+// save replaces the history file atomically. The caller must hold the mutex, so that concurrent saves can't write an
+// older history over a newer one
+func (h *stateHistory) save() error {
+	data, err := json.Marshal(h.transitions)
+	if err != nil {
+		return err
+	}
+	tmpPath := h.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, h.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// last returns up to limit transitions, the most recent first. A limit of 0 returns the whole history
+func (h *stateHistory) last(limit int) []StateTransition {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if limit <= 0 || limit > len(h.transitions) {
+		limit = len(h.transitions)
+	}
+	result := make([]StateTransition, 0, limit)
+	for i := len(h.transitions) - 1; i >= len(h.transitions)-limit; i-- {
+		result = append(result, h.transitions[i])
+	}
+	return result
+}
+
+// recordTransition adds a change of state to the history and the metrics. Events leaving the state unchanged are ignored
+func (n *Network) recordTransition(from, to utils.State, eventId uint64, cause string) {
+	if from.Id == to.Id {
+		return
+	}
+	event := n.fsm.GetEvent(eventId)
+	metrics.NodeState.WithLabelValues(from.Name).Set(0)
+	metrics.NodeState.WithLabelValues(to.Name).Set(1)
+	metrics.StateTransitions.WithLabelValues(from.Name, to.Name, event.Name).Inc()
+
+	if to.Id == STATE_SUSPENDED || to.Id == STATE_OFFLINE {
+		utils.Logf("node state changed from %v to %v (%v): %v", from.Name, to.Name, event.Name, cause)
+	}
+	n.history.add(StateTransition{
+		Time:  time.Now().Unix(),
+		Event: event.Name,
+		From:  from.Name,
+		To:    to.Name,
+		Cause: cause,
+	})
+}
+
+// GetStateHistory returns up to limit transitions of the state machine, the most recent first
+func (n *Network) GetStateHistory(limit int) []StateTransition {
+	if n.history == nil {
+		return nil
+	}
+	return n.history.last(limit)
+}
+
+func stateHistoryPath() string {
+	return filepath.Join(setting.GetRootPath(), stateHistoryFile)
+}
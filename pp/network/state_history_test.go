@@ -0,0 +1,32 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestStateHistorySave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), stateHistoryFile)
+	h := newStateHistory(path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h.add(StateTransition{Time: int64(i), Event: strconv.Itoa(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	reloaded := newStateHistory(path)
+	if got, expected := reloaded.last(0), h.last(0); len(got) != 50 || got[0] != expected[0] {
+		t.Fatalf("the saved history should hold all the transitions, got %v transitions", len(got))
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("the temporary file should be renamed")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/stratosnet/sds/framework/utils"
+
+	"github.com/stratosnet/sds/pp/metrics"
 )
 
 const (
@@ -133,10 +135,14 @@ func (n *Network) InitFsm() {
 			fsm.StateTransTable[s][e] = fsmTable[row].transitionItem
 		}
 	}, STATE_INIT)
+	metrics.NodeState.Reset()
+	metrics.NodeState.WithLabelValues(s_list[STATE_INIT].Name).Set(1)
 }
 
-func (n *Network) RunFsm(ctx context.Context, eventId uint64) {
-	n.fsm.RunFsm(ctx, eventId)
+// RunFsm applies an event to the state machine. cause explains the event in the state history
+func (n *Network) RunFsm(ctx context.Context, eventId uint64, cause string) {
+	from, to := n.fsm.RunFsm(ctx, eventId)
+	n.recordTransition(from, to, eventId, cause)
 }
 
 func (n *Network) GetStateFromFsm() utils.State {
@@ -121,6 +121,7 @@ func (p *P2pServer) newClient(ctx context.Context, server string, heartbeat, rec
 		cf.LogOpenOption(true),
 		cf.MinAppVersionOption(setting.Config.Version.MinAppVer),
 		cf.P2pAddressOption(p.GetP2PAddress().String()),
+		cf.P2pKeyOption(p.GetP2PPublicKey().Bytes(), p.SignP2pMessage),
 		cf.ServerIpOption(setting.NetworkIP),
 		serverPortOpt,
 		cf.ContextKVOption(ckv),
@@ -140,6 +140,7 @@ func (p *P2pServer) newServer(ctx context.Context) *core.Server {
 		core.LogOpenOption(true),
 		core.MinAppVersionOption(setting.Config.Version.MinAppVer),
 		core.P2pAddressOption(p.GetP2PAddress().String()),
+		core.P2pKeyOption(p.GetP2PPublicKey().Bytes(), p.SignP2pMessage),
 		core.MaxConnectionsOption(maxConnections),
 		core.ContextKVOption(ckv),
 	)
@@ -212,7 +212,7 @@ func RspDownloadSliceData(ctx context.Context, target *protos.ReqDownloadSlice,
 		SliceSize:         sliceData.RawSize,
 		SavePath:          target.RspFileStorageInfo.SavePath,
 		Result:            &protos.Result{State: protos.ResultState_RES_SUCCESS, Msg: ""},
-		IsEncrypted:       target.RspFileStorageInfo.EncryptionTag != "",
+		IsEncrypted:       target.RspFileStorageInfo.EncryptionTag != "" || target.RspFileStorageInfo.ErasureDataShards != 0, // shards are sent whole, like encrypted slices
 		SpP2PAddress:      target.RspFileStorageInfo.SpP2PAddress,
 		StorageP2PAddress: p2pserver.GetP2pServer(ctx).GetP2PAddress().String(),
 		SliceNumber:       target.SliceNumber,
@@ -517,6 +517,12 @@ func ReqDownloadSliceData(ctx context.Context, target *protos.RspFileStorageInfo
 
 func ReqRegisterNewPPData(ctx context.Context, walletAddr string, walletPubkey, wsig []byte, reqTime int64) *protos.ReqRegisterNewPP {
 	sysInfo := utils.GetSysInfo(setting.Config.Home.StoragePath)
+	if usage, err := file.GetStorageUsage(); err == nil {
+		sysInfo.DiskSize = usage.Total
+		sysInfo.FreeDisk = usage.Free
+	} else {
+		utils.ErrorLog("Can't fetch storage usage statistics", err)
+	}
 	sysInfo.DiskSize = setting.GetDiskSizeSoftCap(sysInfo.DiskSize)
 	walletSign := &protos.Signature{
 		Address:   walletAddr,
@@ -730,7 +736,7 @@ func RspGetHDInfoData(p2pAddress string) *protos.RspGetHDInfo {
 		WalletAddress: setting.WalletAddress,
 	}
 
-	diskStats, err := utils.GetDiskUsage(setting.Config.Home.StoragePath)
+	diskStats, err := file.GetStorageUsage()
 	if err == nil {
 		diskStats.Total = setting.GetDiskSizeSoftCap(diskStats.Total)
 		rsp.DiskSize = int64(diskStats.Total)
@@ -857,7 +863,7 @@ func ReqNodeStatusData(p2pAddress string) *protos.ReqReportNodeStatus {
 
 	// Disk usage statistics
 	diskStat := &protos.DiskStat{}
-	info, err := utils.GetDiskUsage(setting.Config.Home.StoragePath)
+	info, err := file.GetStorageUsage()
 	if err == nil {
 		diskStat.RootUsed = int64(info.Used)
 		info.Total = setting.GetDiskSizeSoftCap(info.Total)
@@ -4,8 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,6 +11,8 @@ import (
 
 	"github.com/stratosnet/sds/framework/crypto"
 	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/pp/network"
 	"github.com/stratosnet/sds/pp/setting"
 	"github.com/stratosnet/sds/rpc"
 )
@@ -22,6 +22,7 @@ const (
 	MSG_GET_DIST_USAGE_RESPONSE   = "monitor_getDiskUsage"
 	MSG_GET_ONLINE_STATE          = "monitor_getOnlineState"
 	MSG_GET_NODE_DETAILS          = "monitor_getNodeDetails"
+	MSG_GET_STATE_HISTORY         = "monitor_getStateHistory"
 )
 
 type DiskUsage struct {
@@ -44,18 +45,25 @@ type NodeDetails struct {
 }
 
 type MonitorResult struct {
-	Return      string         `json:"return"`
-	MessageType string         `json:"message_type"`
-	TrafficInfo *[]TrafficInfo `json:"traffic_info,omitempty"`
-	OnlineState *OnlineState   `json:"online_state,omitempty"`
-	DiskUsage   *DiskUsage     `json:"disk_usage,omitempty"`
-	NodeDetails *NodeDetails   `json:"node_details,omitempty"`
+	Return       string         `json:"return"`
+	MessageType  string         `json:"message_type"`
+	TrafficInfo  *[]TrafficInfo `json:"traffic_info,omitempty"`
+	OnlineState  *OnlineState   `json:"online_state,omitempty"`
+	DiskUsage    *DiskUsage     `json:"disk_usage,omitempty"`
+	NodeDetails  *NodeDetails   `json:"node_details,omitempty"`
+	StateHistory *StateHistory  `json:"state_history,omitempty"`
+}
+
+type StateHistory struct {
+	State       string                    `json:"state"`
+	Transitions []network.StateTransition `json:"transitions"`
 }
 
 type MonitorNotificationResult struct {
-	TrafficInfo *TrafficInfo `json:"traffic_info"`
-	OnlineState *OnlineState `json:"online_state,omitempty"`
-	DiskUsage   *DiskUsage   `json:"disk_usage,omitempty"`
+	TrafficInfo     *TrafficInfo             `json:"traffic_info"`
+	OnlineState     *OnlineState             `json:"online_state,omitempty"`
+	DiskUsage       *DiskUsage               `json:"disk_usage,omitempty"`
+	StateTransition *network.StateTransition `json:"state_transition,omitempty"`
 }
 
 type ParamTrafficInfo struct {
@@ -65,6 +73,10 @@ type ParamTrafficInfo struct {
 type ParamMonitor struct {
 	SubId string `json:"subid"`
 }
+type ParamStateHistory struct {
+	SubId string `json:"subid"`
+	Limit uint64 `json:"limit"`
+}
 
 type monitorApi struct {
 }
@@ -178,20 +190,11 @@ func (api *monitorApi) GetTrafficData(ctx context.Context, param ParamTrafficInf
 }
 
 func getDiskUsage() int64 {
-	var size int64
-	_ = filepath.Walk(setting.Config.Home.StoragePath, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			size += info.Size()
-		}
-		return err
-	})
+	_, size := file.GetStoredSliceStats()
 	return size
 }
 
-// GetDiskUsage the size of files in setting.Config.StorehousePath, not the disk usage of the computer
+// GetDiskUsage the size of the slices in the storage backend, not the disk usage of the computer
 func (api *monitorApi) GetDiskUsage(ctx context.Context, param ParamMonitor) (*MonitorResult, error) {
 	if _, found := subscribedIds.Load(param.SubId); !found {
 		return nil, errors.New("client hasn't subscribed to the service")
@@ -224,6 +227,22 @@ func (api *monitorApi) GetNodeDetails(ctx context.Context, param ParamMonitor) (
 	}, nil
 }
 
+// GetStateHistory the current state of the node and its last state transitions, the most recent first
+func (api *monitorApi) GetStateHistory(ctx context.Context, param ParamStateHistory) (*MonitorResult, error) {
+	if _, found := subscribedIds.Load(param.SubId); !found {
+		return nil, errors.New("client hasn't subscribed to the service")
+	}
+	peer := network.GetPeer(ctx)
+	return &MonitorResult{
+		Return:      "0",
+		MessageType: MSG_GET_STATE_HISTORY,
+		StateHistory: &StateHistory{
+			State:       peer.GetStateFromFsm().Name,
+			Transitions: peer.GetStateHistory(int(param.Limit)),
+		},
+	}, nil
+}
+
 // Subscription client calls the method monitor_subscribe with this function as the parameter
 func (api *monitorApi) Subscription(ctx context.Context, token string) (*rpc.Subscription, error) {
 	if !verifyToken(token) {
@@ -245,6 +264,7 @@ func (api *monitorApi) Subscription(ctx context.Context, token string) (*rpc.Sub
 	}
 
 	subscribeTrafficInfo(*rpcSub, trafficInfo)
+	transitions := network.SubscribeStateTransitions(string(rpcSub.ID))
 
 	go func() {
 		for {
@@ -256,11 +276,19 @@ func (api *monitorApi) Subscription(ctx context.Context, token string) (*rpc.Sub
 					DiskUsage:   &DiskUsage{DataHost: getDiskUsage()},
 				}
 				_ = notifier.Notify(rpcSub.ID, result)
+			case transition := <-transitions:
+				result := &MonitorNotificationResult{
+					OnlineState:     &OnlineState{Online: setting.OnlineTime != 0, Since: setting.OnlineTime},
+					StateTransition: &transition,
+				}
+				_ = notifier.Notify(rpcSub.ID, result)
 			case <-rpcSub.Err(): // client send an unsubscribe request
 				unsubscribeTrafficInfo(*rpcSub)
+				network.UnsubscribeStateTransitions(string(rpcSub.ID))
 				return
 			case <-notifier.Closed(): // connection dropped
 				unsubscribeTrafficInfo(*rpcSub)
+				network.UnsubscribeStateTransitions(string(rpcSub.ID))
 				return
 			}
 		}
@@ -2,27 +2,36 @@ package serv
 
 import (
 	"context"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 
+	"github.com/stratosnet/sds/framework/msg"
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/pp/account"
 	"github.com/stratosnet/sds/pp/api"
 	"github.com/stratosnet/sds/pp/api/rest"
+	"github.com/stratosnet/sds/pp/api/s3"
+	"github.com/stratosnet/sds/pp/bandwidth"
 	"github.com/stratosnet/sds/pp/event"
 	"github.com/stratosnet/sds/pp/file"
 	"github.com/stratosnet/sds/pp/metrics"
+	"github.com/stratosnet/sds/pp/mount"
 	"github.com/stratosnet/sds/pp/namespace"
 	"github.com/stratosnet/sds/pp/network"
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/setting"
 	"github.com/stratosnet/sds/pp/types"
+	"github.com/stratosnet/sds/pp/webhook"
 	"github.com/stratosnet/sds/rpc"
 	"github.com/stratosnet/sds/utils/environment"
 )
 
+// webhookSubscriberId subscribes the webhooks to the transitions of the node state machine
+const webhookSubscriberId = "webhook"
+
 // BaseServer base pp server
 type BaseServer struct {
 	p2pServ     *p2pserver.P2pServer
@@ -41,6 +50,26 @@ func (bs *BaseServer) Start() error {
 
 	utils.Logf("initializing resource node with environment=%v...", environment.GetEnvironment())
 
+	err = file.InitSliceStore()
+	if err != nil {
+		return err
+	}
+
+	err = bs.startSliceIndex()
+	if err != nil {
+		return err
+	}
+
+	err = bandwidth.Init()
+	if err != nil {
+		return err
+	}
+
+	err = bs.startWebhooks()
+	if err != nil {
+		return err
+	}
+
 	err = bs.startRamMonitor()
 	if err != nil {
 		return err
@@ -61,6 +90,11 @@ func (bs *BaseServer) Start() error {
 		return err
 	}
 
+	err = bs.startS3Gateway()
+	if err != nil {
+		return err
+	}
+
 	err = bs.startTrafficLog()
 	if err != nil {
 		return err
@@ -76,6 +110,16 @@ func (bs *BaseServer) Start() error {
 		return err
 	}
 
+	err = bs.startScrubJob()
+	if err != nil {
+		return err
+	}
+
+	err = bs.startShareExpiryJob()
+	if err != nil {
+		return err
+	}
+
 	err = bs.startIPC()
 	if err != nil {
 		return err
@@ -141,6 +185,18 @@ func (bs *BaseServer) startHttpRPC() error {
 		Modules:            allowModuleList,
 	}
 
+	tokens := namespace.NewRpcTokenStore(namespace.DefaultRpcTokenPath())
+	audit := utils.NewLogger(filepath.Join(setting.GetRootPath(), "./tmp/logs/rpc_audit.log"), false, true)
+	rpcServer.EnableTokenAuth(tokens, setting.Config.Node.Connectivity.RpcRequireToken, audit)
+	for _, module := range allowModuleList {
+		if module != "owner" {
+			continue
+		}
+		if list, err := tokens.List(); err == nil && len(list) == 0 {
+			utils.Log("The owner namespace of the RPC API is enabled, but no token was created yet. Create one with \"ppd token mint\"")
+		}
+	}
+
 	if err := rpcServer.EnableRPC(namespace.Apis(), config); err != nil {
 		return err
 	}
@@ -195,6 +251,22 @@ func (bs *BaseServer) startMonitor() error {
 	return nil
 }
 
+func (bs *BaseServer) startSliceIndex() error {
+	created, err := file.InitSliceIndex()
+	if err != nil {
+		return err
+	}
+	if created {
+		go func() {
+			utils.Log("indexing the stored slices...")
+			if _, err := file.RebuildSliceIndex(context.Background()); err != nil {
+				utils.ErrorLog("failed indexing the stored slices", err)
+			}
+		}()
+	}
+	return nil
+}
+
 func (bs *BaseServer) startRamMonitor() error {
 	SetSoftMemoryCap()
 	CheckGCStats()()
@@ -221,7 +293,15 @@ func (bs *BaseServer) startP2pServer() error {
 	ctx = context.WithValue(ctx, types.PP_NETWORK_KEY, bs.ppNetwork)
 	bs.p2pServ.AddConnConntextKey(types.PP_NETWORK_KEY)
 
-	bs.p2pServ.SetOptionFunctions(event.TimoutMap.OnWrite, nil, event.TimoutMap.OnHandle)
+	onWrite := func(ctx context.Context, message *msg.RelayMsgBuf) {
+		metrics.CountMessageSent(ctx, message)
+		event.TimoutMap.OnWrite(ctx, message)
+	}
+	onHandle := func(ctx context.Context, message *msg.RelayMsgBuf) {
+		metrics.CountMessageReceived(ctx, message)
+		event.TimoutMap.OnHandle(ctx, message)
+	}
+	bs.p2pServ.SetOptionFunctions(onWrite, nil, onHandle)
 	bs.p2pServ.Start(ctx)
 	_, _ = bs.p2pServ.ConnectToSP(ctx) // Ignore error if we can't connect to any SPs
 	bs.ppNetwork.StartPP(ctx)
@@ -250,6 +330,35 @@ func (bs *BaseServer) startReportTransferFailureJob() error {
 	return nil
 }
 
+func (bs *BaseServer) startScrubJob() error {
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, types.P2P_SERVER_KEY, bs.p2pServ)
+	ctx = context.WithValue(ctx, types.PP_NETWORK_KEY, bs.ppNetwork)
+	event.StartScrubJob(ctx)
+	return nil
+}
+
+func (bs *BaseServer) startShareExpiryJob() error {
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, types.P2P_SERVER_KEY, bs.p2pServ)
+	ctx = context.WithValue(ctx, types.PP_NETWORK_KEY, bs.ppNetwork)
+	event.StartShareExpiryJob(ctx)
+	return nil
+}
+
+func (bs *BaseServer) startWebhooks() error {
+	if err := webhook.Init(); err != nil {
+		return err
+	}
+	transitions := network.SubscribeStateTransitions(webhookSubscriberId)
+	go func() {
+		for t := range transitions {
+			webhook.PublishStateChange(webhook.StateChange(t))
+		}
+	}()
+	return nil
+}
+
 func (bs *BaseServer) startInternalApiServer() error {
 	if setting.Config.Keys.WalletAddress != "" && setting.Config.Streaming.InternalPort != "" {
 		ctx := context.Background()
@@ -274,8 +383,19 @@ func (bs *BaseServer) startRestServer() error {
 	return nil
 }
 
+func (bs *BaseServer) startS3Gateway() error {
+	if setting.Config.S3Gateway.Port != "" {
+		ctx := context.Background()
+		ctx = context.WithValue(ctx, types.P2P_SERVER_KEY, bs.p2pServ)
+		ctx = context.WithValue(ctx, types.PP_NETWORK_KEY, bs.ppNetwork)
+		go s3.StartS3Gateway(ctx)
+	}
+	return nil
+}
+
 func (bs *BaseServer) Stop() {
 	utils.DebugLogf("BaseServer.Stop ... ")
+	mount.UnmountAll()
 	if bs.ipcServ != nil {
 		_ = bs.ipcServ.Stop()
 	}
@@ -291,5 +411,10 @@ func (bs *BaseServer) Stop() {
 	StopDumpTrafficLog()
 	file.StopClearTmpFileJob()
 	event.StopReportTransferFailureJob()
+	event.StopScrubJob()
+	event.StopShareExpiryJob()
+	network.UnsubscribeStateTransitions(webhookSubscriberId)
+	webhook.Stop()
+	file.CloseSliceIndex()
 	// TODO: stop IPC, TrafficLog, InternalApiServer, RestServer
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/stratosnet/sds/framework/client/cf"
 	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/file"
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/setting"
 )
@@ -72,7 +73,7 @@ func dumpTrafficLog(ctx context.Context) func() {
 		v, _ := mem.VirtualMemory()
 		c, _ := cpu.Info()
 		cc, _ := cpu.Percent(time.Second, false)
-		d, _ := utils.GetDiskUsage(setting.Config.Home.StoragePath)
+		d, _ := file.GetStorageUsage()
 
 		//Memory
 		memTotal := v.Total
@@ -173,7 +174,7 @@ func monitor(ctx context.Context) func() {
 		v, _ := mem.VirtualMemory()
 		c, _ := cpu.Info()
 		cc, _ := cpu.Percent(time.Second, false)
-		d, _ := utils.GetDiskUsage(setting.Config.Home.StoragePath)
+		d, _ := file.GetStorageUsage()
 
 		d.Total = setting.GetDiskSizeSoftCap(d.Total)
 		// n, _ := host.Info()
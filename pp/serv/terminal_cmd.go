@@ -2,6 +2,7 @@ package serv
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -14,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stratosnet/sds/framework/core"
 	"github.com/stratosnet/sds/framework/crypto"
+	fwed25519 "github.com/stratosnet/sds/framework/crypto/ed25519"
 	fwtypes "github.com/stratosnet/sds/framework/types"
 	"github.com/stratosnet/sds/framework/utils"
 	msgtypes "github.com/stratosnet/sds/sds-msg/types"
@@ -22,19 +24,26 @@ import (
 
 	"github.com/stratosnet/sds/pp"
 	"github.com/stratosnet/sds/pp/account"
+	"github.com/stratosnet/sds/pp/api/sdsclient"
 	"github.com/stratosnet/sds/pp/event"
 	"github.com/stratosnet/sds/pp/file"
 	"github.com/stratosnet/sds/pp/metrics"
+	"github.com/stratosnet/sds/pp/mount"
+	"github.com/stratosnet/sds/pp/namespace"
 	"github.com/stratosnet/sds/pp/namespace/stratoschain"
 	"github.com/stratosnet/sds/pp/network"
 	"github.com/stratosnet/sds/pp/requests"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/signer"
 	"github.com/stratosnet/sds/pp/task"
+	"github.com/stratosnet/sds/pp/tx"
+	"github.com/stratosnet/sds/pp/webhook"
 )
 
 const (
 	DefaultMsg               = "Request Accepted"
 	DefaultDesiredUploadTier = 2
+	DefaultMountCacheSize    = 2048 // MiB
 )
 
 type CmdResult struct {
@@ -114,7 +123,7 @@ func (api *terminalCmd) StartMining(ctx context.Context, param []string) (CmdRes
 		return CmdResult{Msg: ""}, errors.New("mining already started")
 	}
 
-	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_START_MINING)
+	network.GetPeer(ctx).RunFsm(ctx, network.EVENT_START_MINING, "startmining command")
 	return CmdResult{Msg: DefaultMsg}, nil
 }
 
@@ -128,7 +137,7 @@ func (api *terminalCmd) RegisterPP(ctx context.Context, param []string) (CmdResu
 	nowSec := time.Now().Unix()
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.RegisterNewPPWalletSignMessage(setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_REGISTER, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -296,7 +305,7 @@ func (api *terminalCmd) FileStatus(ctx context.Context, param []string) (CmdResu
 	fileHash := param[0]
 	timestamp := time.Now().Unix()
 
-	signature, err := setting.WalletPrivateKey.Sign([]byte(msgutils.GetFileStatusWalletSignMessage(fileHash, setting.WalletAddress, timestamp)))
+	signature, err := setting.WalletSigner.Sign(signer.MSG_FILE_INFO, []byte(msgutils.GetFileStatusWalletSignMessage(fileHash, setting.WalletAddress, timestamp)))
 	if err != nil {
 		return CmdResult{Msg: ""}, err
 	}
@@ -420,7 +429,7 @@ func (api *terminalCmd) Prepay(ctx context.Context, param []string) (CmdResult,
 	nowSec := time.Now().Unix()
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.PrepayWalletSignMessage(setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_PREPAY, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -463,6 +472,11 @@ func (api *terminalCmd) Upload(ctx context.Context, param []string) (CmdResult,
 	}
 
 	isEncrypted := false
+	useEnvelope := false
+	var recipients [][]byte
+	var erasureCoding *event.ErasureCoding
+	resume := false
+	deduplicate := false
 	desiredTier := uint32(DefaultDesiredUploadTier)
 	allowHigherTier := true
 
@@ -479,6 +493,32 @@ func (api *terminalCmd) Upload(ctx context.Context, param []string) (CmdResult,
 				if err != nil {
 					return CmdResult{Msg: ""}, errors.Errorf("invalid param --isEncrypted. Should be true or false: %v ", err.Error())
 				}
+			case "--envelope":
+				useEnvelope, err = strconv.ParseBool(kv[1])
+				if err != nil {
+					return CmdResult{Msg: ""}, errors.Errorf("invalid param --envelope. Should be true or false: %v ", err.Error())
+				}
+			case "--recipients":
+				recipients, err = parseEncryptionPubKeys(kv[1])
+				if err != nil {
+					return CmdResult{Msg: ""}, errors.Errorf("invalid param --recipients: %v ", err.Error())
+				}
+				useEnvelope = true
+			case "--erasure":
+				erasureCoding, err = event.ParseErasureCoding(kv[1])
+				if err != nil {
+					return CmdResult{Msg: ""}, errors.Errorf("invalid param --erasure: %v ", err.Error())
+				}
+			case "--dedup":
+				deduplicate, err = strconv.ParseBool(kv[1])
+				if err != nil {
+					return CmdResult{Msg: ""}, errors.Errorf("invalid param --dedup. Should be true or false: %v ", err.Error())
+				}
+			case "--resume":
+				resume, err = strconv.ParseBool(kv[1])
+				if err != nil {
+					return CmdResult{Msg: ""}, errors.Errorf("invalid param --resume. Should be true or false: %v ", err.Error())
+				}
 			case "--nodeTier":
 				tier, err := strconv.ParseUint(kv[1], 10, 32)
 				if err != nil {
@@ -500,7 +540,28 @@ func (api *terminalCmd) Upload(ctx context.Context, param []string) (CmdResult,
 	}
 
 	ctx = pp.CreateReqIdAndRegisterRpcLogger(ctx, terminalId)
-	event.RequestUploadFile(ctx, pathStr, isEncrypted, false, desiredTier, allowHigherTier,
+	if resume {
+		fileHash, found := task.FindUploadTaskState(pathStr)
+		if !found {
+			return CmdResult{Msg: ""}, errors.Errorf("no unfinished upload found for %v", pathStr)
+		}
+		if err = event.ResumeUpload(ctx, fileHash, setting.WalletAddress); err != nil {
+			return CmdResult{Msg: ""}, err
+		}
+		return CmdResult{Msg: DefaultMsg}, nil
+	}
+
+	var fileEncryption *event.FileEncryption
+	if useEnvelope {
+		fileEncryption, err = event.NewEnvelopeEncryption(recipients)
+		if err != nil {
+			return CmdResult{Msg: ""}, err
+		}
+	} else if isEncrypted {
+		fileEncryption = event.NewWalletEncryption()
+	}
+
+	event.RequestUploadFile(ctx, pathStr, fileEncryption, erasureCoding, deduplicate, false, desiredTier, allowHigherTier,
 		setting.WalletAddress, setting.WalletPublicKey.Bytes(), nil)
 	return CmdResult{Msg: DefaultMsg}, nil
 }
@@ -552,11 +613,169 @@ func (api *terminalCmd) UploadStream(ctx context.Context, param []string) (CmdRe
 
 	ctx = pp.CreateReqIdAndRegisterRpcLogger(ctx, terminalId)
 	ctx = core.RegisterRemoteReqId(ctx, uuid.New().String())
-	event.RequestUploadFile(ctx, pathStr, false, true, desiredTier, allowHigherTier,
+	event.RequestUploadFile(ctx, pathStr, nil, nil, false, true, desiredTier, allowHigherTier,
 		setting.WalletAddress, setting.WalletPublicKey.Bytes(), nil)
 	return CmdResult{Msg: DefaultMsg}, nil
 }
 
+func (api *terminalCmd) UploadDir(_ context.Context, param []string) (CmdResult, error) {
+	terminalId, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+
+	if len(param) == 0 {
+		return CmdResult{}, errors.New("input upload directory path")
+	}
+	pathStr := file.EscapePath(param[0:1])
+	if err = api.validateUploadPath(pathStr); err != nil {
+		return CmdResult{}, err
+	}
+	workers, err := parseDirWorkers(param[1:])
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	walletSigner, err := sdsclient.NodeWalletSigner(setting.WalletAddress)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+
+	// The upload outlives the terminal request
+	ctx := pp.CreateReqIdAndRegisterRpcLogger(context.Background(), terminalId)
+	go func() {
+		manifestHash, err := sdsclient.NewClient(namespace.RpcPubApi()).UploadDir(ctx, walletSigner, pathStr, workers)
+		if err != nil {
+			pp.ErrorLog(ctx, "failed uploading directory", pathStr, err)
+			return
+		}
+		pp.Logf(ctx, "uploaded directory %v, manifest file hash: %v", pathStr, manifestHash)
+	}()
+	return CmdResult{Msg: DefaultMsg}, nil
+}
+
+func (api *terminalCmd) DownloadDir(_ context.Context, param []string) (CmdResult, error) {
+	terminalId, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+
+	if len(param) == 0 {
+		return CmdResult{}, errors.New("input the file hash of the directory manifest")
+	}
+	manifestHash := param[0]
+	saveDir := setting.Config.Home.DownloadPath
+	if len(param) > 1 && !strings.HasPrefix(param[1], "--") {
+		saveDir = param[1]
+		param = param[1:]
+	}
+	workers, err := parseDirWorkers(param[1:])
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	walletSigner, err := sdsclient.NodeWalletSigner(setting.WalletAddress)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+
+	// The download outlives the terminal request
+	ctx := pp.CreateReqIdAndRegisterRpcLogger(context.Background(), terminalId)
+	go func() {
+		manifest, err := sdsclient.NewClient(namespace.RpcPubApi()).DownloadDir(ctx, walletSigner, manifestHash, saveDir, workers)
+		if err != nil {
+			pp.ErrorLog(ctx, "failed downloading directory", manifestHash, err)
+			return
+		}
+		pp.Logf(ctx, "downloaded directory %v with %v entries into %v", manifest.Name, len(manifest.Entries), saveDir)
+	}()
+	return CmdResult{Msg: DefaultMsg}, nil
+}
+
+func parseDirWorkers(param []string) (int, error) {
+	workers := sdsclient.DEFAULT_DIR_WORKERS
+	for _, p := range param {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] != "--workers" {
+			return 0, errors.Errorf("invalid param %v.", p)
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n <= 0 {
+			return 0, errors.New("invalid param --workers. Should be a positive integer")
+		}
+		workers = n
+	}
+	return workers, nil
+}
+
+// parseEncryptionPubKeys parses a comma separated list of hex encoded file encryption public keys
+func parseEncryptionPubKeys(param string) ([][]byte, error) {
+	var pubKeys [][]byte
+	for _, pubKeyHex := range strings.Split(param, ",") {
+		pubKey, err := hex.DecodeString(strings.TrimSpace(pubKeyHex))
+		if err != nil {
+			return nil, err
+		}
+		if len(pubKey) != fwed25519.PubKeySize {
+			return nil, errors.Errorf("public key %v should be %v bytes long", pubKeyHex, fwed25519.PubKeySize)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	return pubKeys, nil
+}
+
+func (api *terminalCmd) EncryptionKey(_ context.Context, _ []string) (CmdResult, error) {
+	if !setting.CheckLogin() {
+		return CmdResult{Msg: ""}, errors.New("please login first")
+	}
+	pubKey, err := event.FileEncryptionPubKey()
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	return CmdResult{Msg: hex.EncodeToString(pubKey)}, nil
+}
+
+func (api *terminalCmd) RewrapEnvelope(_ context.Context, param []string) (CmdResult, error) {
+	_, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	if len(param) != 2 {
+		return CmdResult{Msg: ""}, errors.New("expecting a file hash and a comma separated list of public keys")
+	}
+	if !setting.CheckLogin() {
+		return CmdResult{Msg: ""}, errors.New("please login first")
+	}
+	recipients, err := parseEncryptionPubKeys(param[1])
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	envelope, err := event.RewrapFileEnvelope(param[0], recipients)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	return CmdResult{Msg: hex.EncodeToString(envelope)}, nil
+}
+
+func (api *terminalCmd) ImportEnvelope(_ context.Context, param []string) (CmdResult, error) {
+	_, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	if len(param) != 2 {
+		return CmdResult{Msg: ""}, errors.New("expecting a file hash and a hex encoded envelope")
+	}
+	if !setting.CheckLogin() {
+		return CmdResult{Msg: ""}, errors.New("please login first")
+	}
+	envelope, err := hex.DecodeString(param[1])
+	if err != nil {
+		return CmdResult{Msg: ""}, errors.Wrap(err, "invalid envelope")
+	}
+	if err = event.ImportFileEnvelope(param[0], envelope); err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	return CmdResult{Msg: DefaultMsg}, nil
+}
+
 func (api *terminalCmd) BackupStatus(ctx context.Context, param []string) (CmdResult, error) {
 	terminalId, param, err := getTerminalIdFromParam(param)
 	if err != nil {
@@ -580,7 +799,7 @@ func (api *terminalCmd) List(ctx context.Context, param []string) (CmdResult, er
 	nowSec := time.Now().Unix()
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.FindMyFileListWalletSignMessage(setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_LIST, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -614,7 +833,7 @@ func (api *terminalCmd) ClearExpShare(ctx context.Context, param []string) (CmdR
 	nowSec := time.Now().Unix()
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.ClearExpiredShareLinksWalletSignMessage(setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_SHARE, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -683,7 +902,7 @@ func (api *terminalCmd) DeleteFn(ctx context.Context, param []string) (CmdResult
 	fileHash := param[0]
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.DeleteFileWalletSignMessage(fileHash, setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_DELETE, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -778,7 +997,7 @@ func (api *terminalCmd) SharePath(ctx context.Context, param []string) (CmdResul
 	fileHash := param[0]
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.ShareFileWalletSignMessage(fileHash, setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_SHARE, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -843,7 +1062,7 @@ func (api *terminalCmd) ShareFile(ctx context.Context, param []string) (CmdResul
 	nowSec := time.Now().Unix()
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.ShareFileWalletSignMessage(fileHash, setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_SHARE, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -865,7 +1084,7 @@ func (api *terminalCmd) AllShare(ctx context.Context, param []string) (CmdResult
 	// sign the wallet signature by wallet private key
 	nowSec := time.Now().Unix()
 	wsignMsg := msgutils.ShareLinkWalletSignMessage(setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_SHARE, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -897,7 +1116,7 @@ func (api *terminalCmd) CancelShare(ctx context.Context, param []string) (CmdRes
 	shareId := param[0]
 	// sign the wallet signature by wallet private key
 	wsignMsg := msgutils.DeleteShareWalletSignMessage(shareId, setting.WalletAddress, nowSec)
-	wsign, err := setting.WalletPrivateKey.Sign([]byte(wsignMsg))
+	wsign, err := setting.WalletSigner.Sign(signer.MSG_SHARE, []byte(wsignMsg))
 	if err != nil {
 		return CmdResult{Msg: ""}, errors.New("wallet failed to sign message")
 	}
@@ -970,6 +1189,42 @@ func (api *terminalCmd) CancelGet(ctx context.Context, param []string) (CmdResul
 	return CmdResult{Msg: DefaultMsg}, nil
 }
 
+func (api *terminalCmd) Mount(ctx context.Context, param []string) (CmdResult, error) {
+	_, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	if len(param) == 0 {
+		return CmdResult{}, errors.New("input the directory to mount")
+	}
+
+	cacheSize := int64(DefaultMountCacheSize)
+	if len(param) > 1 {
+		cacheSize, err = strconv.ParseInt(param[1], 10, 64)
+		if err != nil || cacheSize <= 0 {
+			return CmdResult{}, errors.New("invalid cache size. Should be a positive number of MiB")
+		}
+	}
+	if err = mount.Mount(ctx, param[0], cacheSize<<20); err != nil {
+		return CmdResult{}, err
+	}
+	return CmdResult{Msg: "mounted the files of wallet " + setting.WalletAddress + " in " + param[0]}, nil
+}
+
+func (api *terminalCmd) Unmount(_ context.Context, param []string) (CmdResult, error) {
+	_, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	if len(param) == 0 {
+		return CmdResult{}, errors.New("input the directory to unmount")
+	}
+	if err = mount.Unmount(param[0]); err != nil {
+		return CmdResult{}, err
+	}
+	return CmdResult{Msg: "unmounted " + param[0]}, nil
+}
+
 func (api *terminalCmd) MonitorToken(_ context.Context, _ []string) (CmdResult, error) {
 	utils.Log("Monitor token is:", GetCurrentToken())
 	return CmdResult{Msg: DefaultMsg}, nil
@@ -1065,6 +1320,68 @@ func (api *terminalCmd) PerformanceMeasure(_ context.Context, _ []string) (CmdRe
 	return CmdResult{Msg: DefaultMsg}, nil
 }
 
+func (api *terminalCmd) Scrub(_ context.Context, param []string) (CmdResult, error) {
+	_, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+
+	if len(param) > 0 {
+		switch param[0] {
+		case "start":
+			err = event.StartScrub()
+		case "stop":
+			err = event.StopScrub()
+		case "status":
+		default:
+			return CmdResult{Msg: ""}, errors.New("parameter should be either 'start', 'stop' or 'status'")
+		}
+		if err != nil {
+			return CmdResult{Msg: ""}, err
+		}
+	}
+
+	status := event.GetScrubStatus()
+	if status.StartTime == 0 {
+		return CmdResult{Msg: "no scrub was run since the node started"}, nil
+	}
+	state := "finished"
+	if status.Running {
+		state = "running"
+	} else if status.Error != "" {
+		state = "interrupted (" + status.Error + ")"
+	}
+	msg := fmt.Sprintf("scrub started at %v: %v\n", time.Unix(status.StartTime, 0).Format(time.RFC3339), state) +
+		fmt.Sprintf("%v slices scanned, %v verified, %v corrupted, %v skipped, %v waiting for their origin, %v MB read",
+			status.Scanned, status.Verified, status.Corrupted, status.Skipped, status.OriginRequested, status.BytesRead/1024/1024)
+	for _, sliceHash := range status.CorruptedSlices {
+		msg += "\n  quarantined " + sliceHash
+	}
+	return CmdResult{Msg: msg}, nil
+}
+
+func (api *terminalCmd) Index(_ context.Context, param []string) (CmdResult, error) {
+	_, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+
+	if len(param) > 0 {
+		if param[0] != "rebuild" {
+			return CmdResult{Msg: ""}, errors.New("the only parameter accepted is 'rebuild'")
+		}
+		go func() {
+			if _, err := file.RebuildSliceIndex(context.Background()); err != nil {
+				utils.ErrorLog("failed rebuilding the slice index", err)
+			}
+		}()
+		return CmdResult{Msg: "rebuilding the slice index, the result will be logged"}, nil
+	}
+
+	count, size := file.GetStoredSliceStats()
+	return CmdResult{Msg: fmt.Sprintf("%v slices indexed, %v MB", count, size/1024/1024)}, nil
+}
+
 func (api *terminalCmd) Withdraw(ctx context.Context, param []string) (CmdResult, error) {
 	terminalId, param, err := getTerminalIdFromParam(param)
 	if err != nil {
@@ -1254,3 +1571,111 @@ func (api *terminalCmd) UpdateInfo(ctx context.Context, param []string) (CmdResu
 
 	return CmdResult{Msg: DefaultMsg}, nil
 }
+
+func (api *terminalCmd) TxStatus(_ context.Context, param []string) (CmdResult, error) {
+	_, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+
+	var txs []tx.TrackedTx
+	if len(param) > 0 {
+		trackedTx, found := tx.GetTrackedTx(param[0])
+		if !found {
+			return CmdResult{Msg: ""}, errors.Errorf("tx %v was not broadcast by this node", param[0])
+		}
+		txs = append(txs, trackedTx)
+	} else {
+		txs = tx.GetTrackedTxs()
+	}
+	if len(txs) == 0 {
+		return CmdResult{Msg: "no tx broadcast recently"}, nil
+	}
+
+	lines := make([]string, 0, len(txs))
+	for _, trackedTx := range txs {
+		line := fmt.Sprintf("%v  %v  attempt %v: %v", time.Unix(trackedTx.BroadcastTime, 0).Format(time.RFC3339), trackedTx.Type, trackedTx.Attempt, trackedTx)
+		if trackedTx.ReplacedBy != "" {
+			line += ", replaced by " + trackedTx.ReplacedBy
+		}
+		lines = append(lines, line)
+	}
+	return CmdResult{Msg: strings.Join(lines, "\n")}, nil
+}
+
+func (api *terminalCmd) Webhook(_ context.Context, param []string) (CmdResult, error) {
+	_, param, err := getTerminalIdFromParam(param)
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+
+	action := "list"
+	if len(param) > 0 {
+		action = param[0]
+	}
+	switch action {
+	case "add":
+		if len(param) < 2 {
+			return CmdResult{Msg: ""}, errors.New("expecting the url of the webhook")
+		}
+		var events []string
+		if len(param) > 2 {
+			events = strings.Split(param[2], ",")
+		}
+		added, err := webhook.Add(param[1], events, "")
+		if err != nil {
+			return CmdResult{Msg: ""}, err
+		}
+		return CmdResult{Msg: fmt.Sprintf("webhook %v added, the notifications are signed with the secret %v", added.Id, added.Secret)}, nil
+	case "remove", "test":
+		if len(param) < 2 {
+			return CmdResult{Msg: ""}, errors.New("expecting the id of the webhook")
+		}
+		if action == "remove" {
+			err = webhook.Remove(param[1])
+		} else {
+			err = webhook.Test(param[1])
+		}
+		if err != nil {
+			return CmdResult{Msg: ""}, err
+		}
+		return CmdResult{Msg: "done"}, nil
+	case "log":
+		webhookId := ""
+		if len(param) > 1 {
+			webhookId = param[1]
+		}
+		deliveries := webhook.Deliveries(webhookId, 20)
+		if len(deliveries) == 0 {
+			return CmdResult{Msg: "no notification sent since the node started"}, nil
+		}
+		lines := make([]string, 0, len(deliveries))
+		for _, d := range deliveries {
+			line := fmt.Sprintf("%v  %v  %v  attempt %v: %v", time.Unix(d.Time, 0).Format(time.RFC3339), d.WebhookId, d.EventType, d.Attempt, d.Status)
+			if d.Error != "" {
+				line += " (" + d.Error + ")"
+			}
+			lines = append(lines, line)
+		}
+		return CmdResult{Msg: strings.Join(lines, "\n")}, nil
+	case "list":
+		webhooks, err := webhook.List()
+		if err != nil {
+			return CmdResult{Msg: ""}, err
+		}
+		if len(webhooks) == 0 {
+			return CmdResult{Msg: "no webhook registered"}, nil
+		}
+		lines := make([]string, 0, len(webhooks))
+		for _, w := range webhooks {
+			events := "all events"
+			if len(w.Events) > 0 {
+				events = strings.Join(w.Events, ",")
+			}
+			lines = append(lines, fmt.Sprintf("%v  %v  %v", w.Id, w.Url, events))
+		}
+		return CmdResult{Msg: strings.Join(lines, "\n")}, nil
+	default:
+		return CmdResult{Msg: ""}, errors.New("parameter should be either 'list', 'add', 'remove', 'test' or 'log'")
+	}
+}
@@ -8,9 +8,12 @@ import (
 )
 
 const (
-	Version       = "v0.12.10"
-	AppVersion    = 12
-	MinAppVersion = 12
+	Version       = "v0.13.0"
+	AppVersion    = 13
+	MinAppVersion = 13
+
+	// SPs from this version store each shard of an erasure coded file once, instead of replicating it like a slice
+	ErasureCodingMinSpVersion = 13
 
 	HDPath          = "m/44'/606'/0'/0/0"
 	HDPathP2p       = "m/44'/606'/0/0"
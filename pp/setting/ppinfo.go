@@ -8,6 +8,7 @@ import (
 
 	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
 	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/signer"
 	msgtypes "github.com/stratosnet/sds/sds-msg/types"
 )
 
@@ -25,7 +26,8 @@ var WalletAddress string
 
 var WalletPublicKey fwcryptotypes.PubKey
 
-var WalletPrivateKey fwcryptotypes.PrivKey
+// WalletSigner signs for the wallet of the node, which doesn't hold the private key when the signer is remote
+var WalletSigner signer.Signer
 
 var NetworkAddress string
 
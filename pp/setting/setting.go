@@ -11,7 +11,6 @@ import (
 	"github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
 
-	"github.com/stratosnet/sds/framework/client/cf"
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/tx-client/grpc"
 )
@@ -69,10 +68,11 @@ type VersionConfig struct {
 }
 
 type BlockchainConfig struct {
-	ChainId       string  `toml:"chain_id" comment:"ID of the chain Eg: \"stratos-1\""`
-	GasAdjustment float64 `toml:"gas_adjustment" comment:"Multiplier for the simulated tx gas cost Eg: 1.5"`
-	Insecure      bool    `toml:"insecure" comment:"Connect to the chain using an insecure connection (no TLS) Eg: true"`
-	GrpcServer    string  `toml:"grpc_server" comment:"Network address of the chain grpc Eg: \"127.0.0.1:9090\""`
+	ChainId       string   `toml:"chain_id" comment:"ID of the chain Eg: \"stratos-1\""`
+	GasAdjustment float64  `toml:"gas_adjustment" comment:"Multiplier for the simulated tx gas cost Eg: 1.5"`
+	Insecure      bool     `toml:"insecure" comment:"Connect to the chain using an insecure connection (no TLS) Eg: true"`
+	GrpcServer    string   `toml:"grpc_server" comment:"Network address of the chain grpc Eg: \"127.0.0.1:9090\""`
+	GrpcServers   []string `toml:"grpc_servers" comment:"Other chain grpc addresses, used when grpc_server is unavailable or slower Eg: [\"127.0.0.1:9091\"]"`
 }
 
 type HomeConfig struct {
@@ -82,23 +82,47 @@ type HomeConfig struct {
 	StoragePath  string `toml:"storage_path" comment:"Where files are stored. Eg: \"./storage\""`
 }
 
+type StorageConfig struct {
+	Backend string          `toml:"backend" comment:"Where the slices are stored: \"local\" (the storage_path folder), \"multidisk\" or \"s3\". Eg: \"local\""`
+	Disks   []DiskConfig    `toml:"disks" comment:"Folders used by the multidisk backend. New slices go to the folder with the most free space"`
+	S3      S3StorageConfig `toml:"s3" comment:"S3-compatible object store used by the s3 backend. Slices are staged in the storage_path folder until they are verified"`
+}
+
+type DiskConfig struct {
+	Path     string `toml:"path" comment:"Folder storing slices. Eg: \"/mnt/disk1/storage\""`
+	Capacity uint64 `toml:"capacity" comment:"When not 0, limit the slices stored in the folder to this amount (in megabytes). Eg: 0"`
+}
+
+type S3StorageConfig struct {
+	Endpoint  string `toml:"endpoint" comment:"Endpoint of the object store. Eg: \"https://s3.us-east-1.amazonaws.com\""`
+	Region    string `toml:"region" comment:"Eg: \"us-east-1\""`
+	Bucket    string `toml:"bucket"`
+	Prefix    string `toml:"prefix" comment:"Prefix of the object keys of the slices. Eg: \"slices/\""`
+	AccessKey string `toml:"access_key"`
+	SecretKey string `toml:"secret_key"`
+	PathStyle bool   `toml:"path_style" comment:"Address the bucket in the path of the requests instead of the host name, as most self-hosted object stores require. Eg: false"`
+	Capacity  uint64 `toml:"capacity" comment:"Storage space offered by the bucket (in megabytes). Eg: 7629394"`
+}
+
 type KeysConfig struct {
 	P2PAddress         string `toml:"p2p_address" comment:"Address of the P2P key. Eg: \"stsdsxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx\""`
 	P2PPassword        string `toml:"p2p_password"`
 	WalletAddress      string `toml:"wallet_address" comment:"Address of the stratos wallet. Eg: \"stxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx\""`
 	WalletPassword     string `toml:"wallet_password"`
+	WalletSigner       string `toml:"wallet_signer" comment:"Signer process keeping the wallet key, instead of the local keystore. Eg: \"unix:///home/user/signer.sock\""`
 	BeneficiaryAddress string `toml:"beneficiary_address" comment:"Address for receiving reward. Eg: \"stxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx\""`
 }
 
 type ConnectivityConfig struct {
-	SeedMetaNode   SPBaseInfo `toml:"seed_meta_node" comment:"The first meta node to connect to when starting the node"`
-	Internal       bool       `toml:"internal" comment:"Is the node running on an internal network? Eg: false"`
-	NetworkAddress string     `toml:"network_address" comment:"Domain name or IP address of the node. Eg: \"127.0.0.1\""`
-	NetworkPort    string     `toml:"network_port" comment:"Main port for communication on the network. Must be open to the internet. Eg: \"18081\""`
-	LocalPort      string     `toml:"local_port" comment:"(Optional)If not empty, the node will listen to this port locally, but other nodes will still use the network_port to connect to this node"`
-	MetricsPort    string     `toml:"metrics_port" comment:"Port for prometheus metrics"`
-	RpcPort        string     `toml:"rpc_port" comment:"Port for the JSON-RPC api. See https://docs.thestratos.org/docs-resource-node/sds-rpc-for-file-operation/"`
-	RpcNamespaces  string     `toml:"rpc_namespaces" comment:"Namespaces enabled in the RPC API. Eg: \"user,owner\""`
+	SeedMetaNode    SPBaseInfo `toml:"seed_meta_node" comment:"The first meta node to connect to when starting the node"`
+	Internal        bool       `toml:"internal" comment:"Is the node running on an internal network? Eg: false"`
+	NetworkAddress  string     `toml:"network_address" comment:"Domain name or IP address of the node. Eg: \"127.0.0.1\""`
+	NetworkPort     string     `toml:"network_port" comment:"Main port for communication on the network. Must be open to the internet. Eg: \"18081\""`
+	LocalPort       string     `toml:"local_port" comment:"(Optional)If not empty, the node will listen to this port locally, but other nodes will still use the network_port to connect to this node"`
+	MetricsPort     string     `toml:"metrics_port" comment:"Port for prometheus metrics"`
+	RpcPort         string     `toml:"rpc_port" comment:"Port for the JSON-RPC api. See https://docs.thestratos.org/docs-resource-node/sds-rpc-for-file-operation/"`
+	RpcNamespaces   string     `toml:"rpc_namespaces" comment:"Namespaces enabled in the RPC API. Eg: \"user,owner\""`
+	RpcRequireToken bool       `toml:"rpc_require_token" comment:"Should the public namespaces of the RPC API also require a bearer token? The other namespaces (eg: \"owner\") always require a token created with \"ppd token mint\". Eg: false"`
 }
 
 type NodeConfig struct {
@@ -118,8 +142,48 @@ type MonitorConfig struct {
 type TrafficConfig struct {
 	LogInterval     uint64 `toml:"log_interval" comment:"Interval at which traffic is logged (in seconds) Eg: 10"`
 	MaxConnections  int    `toml:"max_connections" comment:"Max number of concurrent network connections. Eg: 1000"`
-	MaxDownloadRate uint64 `toml:"max_download_rate" comment:"Max number of download messages received per second (per connection). 0 Means unlimited. 1000 ≈ 1MB/sec. Eg: 1000"`
-	MaxUploadRate   uint64 `toml:"max_upload_rate" comment:"Max number of upload messages sent per second (per connection). 0 Means unlimited. 1000 ≈ 1MB/sec. Eg: 1000"`
+	MaxDownloadRate uint64 `toml:"max_download_rate" comment:"Deprecated, use bandwidth.default.download.inbound. Used as the node-wide download inbound limit (in KB/sec) when it isn't set. It used to be a number of messages per second per connection. 0 Means unlimited. Eg: 1000"`
+	MaxUploadRate   uint64 `toml:"max_upload_rate" comment:"Deprecated, use bandwidth.default.upload.outbound. Used as the node-wide upload outbound limit (in KB/sec) when it isn't set. It used to be a number of messages per second per connection. 0 Means unlimited. Eg: 1000"`
+}
+
+type BandwidthConfig struct {
+	Default   BandwidthProfile    `toml:"default" json:"default" comment:"Limits applied when no schedule matches"`
+	Schedules []BandwidthSchedule `toml:"schedules" json:"schedules" comment:"Limits applied during some hours of the week, in local time. The first matching schedule is used"`
+}
+
+type BandwidthSchedule struct {
+	Name   string           `toml:"name" json:"name" comment:"Eg: \"office hours\""`
+	Days   []string         `toml:"days" json:"days" comment:"Days the schedule applies to, every day when empty. Eg: [\"mon\", \"tue\", \"wed\", \"thu\", \"fri\"]"`
+	Start  string           `toml:"start" json:"start" comment:"Local time, midnight when empty. Eg: \"09:00\""`
+	End    string           `toml:"end" json:"end" comment:"The schedule ends the next day when end is before start. Eg: \"18:00\""`
+	Limits BandwidthProfile `toml:"limits" json:"limits"`
+}
+
+// BandwidthProfile is a set of bandwidth limits. The node and peer limits apply to all the traffic, the other ones to a
+// traffic class
+type BandwidthProfile struct {
+	Node         BandwidthLimits `toml:"node" json:"node" comment:"Traffic of the whole node"`
+	Peer         BandwidthLimits `toml:"peer" json:"peer" comment:"Traffic with each peer"`
+	Upload       BandwidthLimits `toml:"upload" json:"upload" comment:"Slices of the files uploaded by users"`
+	Backup       BandwidthLimits `toml:"backup" json:"backup" comment:"Slices copied between nodes for backups and transfers"`
+	Verification BandwidthLimits `toml:"verification" json:"verification" comment:"Slices downloaded to verify them"`
+	Download     BandwidthLimits `toml:"download" json:"download" comment:"Slices of the files downloaded by users"`
+	Streaming    BandwidthLimits `toml:"streaming" json:"streaming" comment:"Video slices served by the streaming servers"`
+}
+
+type BandwidthLimits struct {
+	Inbound  uint64 `toml:"inbound" json:"inbound" comment:"In KB/sec. 0 Means unlimited. Eg: 0"`
+	Outbound uint64 `toml:"outbound" json:"outbound" comment:"In KB/sec. 0 Means unlimited. Eg: 0"`
+}
+
+type ScrubConfig struct {
+	Interval    uint64 `toml:"interval" comment:"Interval between two scrubs re-verifying the stored slices (in hours). 0 disables the periodic scrub, it can still be started with the \"scrub start\" command. Eg: 168"`
+	MaxReadRate uint64 `toml:"max_read_rate" comment:"Max rate at which the scrub reads slices from disk (in MB/sec). 0 Means unlimited. Eg: 20"`
+}
+
+type WebhookConfig struct {
+	MaxAttempts       int    `toml:"max_attempts" comment:"Number of times a notification is sent to a webhook before giving up. Eg: 5"`
+	LowOzoneThreshold uint64 `toml:"low_ozone_threshold" comment:"An ozone.low notification is sent when the ozone balance of the wallet falls below this value (in noz). 0 disables the notification. Eg: 0"`
 }
 
 type StreamingConfig struct {
@@ -127,6 +191,18 @@ type StreamingConfig struct {
 	RestPort     string `toml:"rest_port" comment:"Port for the REST server"`
 }
 
+type S3GatewayConfig struct {
+	Port       string        `toml:"port" comment:"Port for the S3-compatible gateway. The gateway is disabled when empty. Eg: \"18781\""`
+	Region     string        `toml:"region" comment:"Region expected in the SigV4 credential scope of the requests. Eg: \"us-east-1\""`
+	AccessKeys []S3AccessKey `toml:"access_keys" comment:"SigV4 access keys accepted by the gateway, and the wallet signing the requests made with each of them"`
+}
+
+type S3AccessKey struct {
+	AccessKey     string `toml:"access_key"`
+	SecretKey     string `toml:"secret_key"`
+	WalletAddress string `toml:"wallet_address" comment:"Wallet owning the buckets of this access key. Only the wallet of this node can sign requests. Eg: \"stxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx\""`
+}
+
 type WebServerConfig struct {
 	Path           string `toml:"path" comment:"Location of the web server files Eg: \"./web\""`
 	Port           string `toml:"port" comment:"Port where the web server is hosted with sdsweb. If the port is opened and token_on_startup is true, anybody who loads the monitor UI will have full access to the monitor"`
@@ -137,12 +213,17 @@ type config struct {
 	Version    VersionConfig    `toml:"version"`
 	Blockchain BlockchainConfig `toml:"blockchain" comment:"Configuration of the connection to the Stratos blockchain"`
 	Home       HomeConfig       `toml:"home" comment:"Structure of the home folder. Default paths (eg: \"./storage\" become relative to the node home. Other paths are relative to the working directory"`
+	Storage    StorageConfig    `toml:"storage" comment:"Configuration of the backend storing the slices"`
 	Keys       KeysConfig       `toml:"keys"`
 	Node       NodeConfig       `toml:"node" comment:"Configuration of this node"`
 	Monitor    MonitorConfig    `toml:"monitor" comment:"Configuration for the monitor server"`
 	Streaming  StreamingConfig  `toml:"streaming" comment:"Configuration for video streaming"`
 	Traffic    TrafficConfig    `toml:"traffic"`
+	Bandwidth  BandwidthConfig  `toml:"bandwidth" comment:"Configuration of the bandwidth shaping. It can be changed while the node runs with the owner_setBandwidth RPC"`
+	Scrub      ScrubConfig      `toml:"scrub" comment:"Configuration of the background verification of the stored slices"`
+	Webhook    WebhookConfig    `toml:"webhook" comment:"Configuration of the webhook notifications. Webhooks are registered with the \"webhook\" command or the owner_requestWebhook RPC"`
 	WebServer  WebServerConfig  `toml:"web_server" comment:"Configuration for the web server (when running sdsweb)"`
+	S3Gateway  S3GatewayConfig  `toml:"s3_gateway" comment:"Configuration for the S3-compatible gateway"`
 }
 
 func SetupRoot(root string) {
@@ -177,16 +258,35 @@ func LoadConfig(configPath string) error {
 		IsWindows = false
 	}
 
-	cf.SetMaxDownloadRate(Config.Traffic.MaxDownloadRate)
-	cf.SetMaxUploadRate(Config.Traffic.MaxUploadRate)
+	applyDeprecatedTrafficRates()
+	if Config.Webhook.MaxAttempts <= 0 {
+		Config.Webhook.MaxAttempts = DefaultConfig().Webhook.MaxAttempts
+	}
 
-	// todo: we shouldn't call grpc package to setup a global variable
-	grpc.SERVER = Config.Blockchain.GrpcServer
-	grpc.INSECURE = Config.Blockchain.Insecure
+	grpc.SetEndpoints(append([]string{Config.Blockchain.GrpcServer}, Config.Blockchain.GrpcServers...), Config.Blockchain.Insecure)
 
 	return nil
 }
 
+// applyDeprecatedTrafficRates uses traffic.max_download_rate and traffic.max_upload_rate as the default bandwidth
+// limits when these aren't set. They were limits per connection in messages/sec, and are now node-wide in KB/sec
+func applyDeprecatedTrafficRates() {
+	if Config.Traffic.MaxDownloadRate != 0 {
+		utils.WarnLog("traffic.max_download_rate is deprecated, use bandwidth.default.download.inbound instead. It is now a node-wide limit of",
+			Config.Traffic.MaxDownloadRate, "KB/sec, no longer a number of messages/sec per connection")
+		if Config.Bandwidth.Default.Download.Inbound == 0 {
+			Config.Bandwidth.Default.Download.Inbound = Config.Traffic.MaxDownloadRate
+		}
+	}
+	if Config.Traffic.MaxUploadRate != 0 {
+		utils.WarnLog("traffic.max_upload_rate is deprecated, use bandwidth.default.upload.outbound instead. It is now a node-wide limit of",
+			Config.Traffic.MaxUploadRate, "KB/sec, no longer a number of messages/sec per connection")
+		if Config.Bandwidth.Default.Upload.Outbound == 0 {
+			Config.Bandwidth.Default.Upload.Outbound = Config.Traffic.MaxUploadRate
+		}
+	}
+}
+
 func CheckLogin() bool {
 	if WalletAddress == "" {
 		utils.ErrorLog("please login")
@@ -258,6 +358,9 @@ func DefaultConfig() *config {
 			PeersPath:    "./peers",
 			StoragePath:  "./storage",
 		},
+		Storage: StorageConfig{
+			Backend: "local",
+		},
 		Keys: KeysConfig{
 			P2PAddress:         "",
 			P2PPassword:        "",
@@ -274,13 +377,14 @@ func DefaultConfig() *config {
 					P2PPublicKey:   meta_pubkey,
 					NetworkAddress: meta_net,
 				},
-				Internal:       false,
-				NetworkAddress: "127.0.0.1",
-				NetworkPort:    "18081",
-				LocalPort:      "",
-				MetricsPort:    "18181",
-				RpcPort:        "18281",
-				RpcNamespaces:  "user",
+				Internal:        false,
+				NetworkAddress:  "127.0.0.1",
+				NetworkPort:     "18081",
+				LocalPort:       "",
+				MetricsPort:     "18181",
+				RpcPort:         "18281",
+				RpcNamespaces:   "user",
+				RpcRequireToken: false,
 			},
 		},
 		Monitor: MonitorConfig{
@@ -300,11 +404,23 @@ func DefaultConfig() *config {
 			MaxDownloadRate: 0,
 			MaxUploadRate:   0,
 		},
+		Scrub: ScrubConfig{
+			Interval:    168,
+			MaxReadRate: 20,
+		},
+		Webhook: WebhookConfig{
+			MaxAttempts:       5,
+			LowOzoneThreshold: 0,
+		},
 		WebServer: WebServerConfig{
 			Path:           "./web",
 			Port:           "18681",
 			TokenOnStartup: false,
 		},
+		S3Gateway: S3GatewayConfig{
+			Port:   "",
+			Region: "us-east-1",
+		},
 	}
 }
 
@@ -332,6 +448,12 @@ func formalizePaths() (err error) {
 		return err
 	}
 
+	for i, disk := range Config.Storage.Disks {
+		if Config.Storage.Disks[i].Path, err = filepath.Abs(disk.Path); err != nil {
+			return err
+		}
+	}
+
 	Config.Home.DownloadPath, err = formalizePath(Config.Home.DownloadPath, defaultValues.Home.DownloadPath)
 	if err != nil {
 		return err
@@ -0,0 +1,261 @@
+package signer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
+	sdkmath "cosmossdk.io/math"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/stratosnet/sds/framework/utils"
+	txclienttypes "github.com/stratosnet/sds/tx-client/types"
+)
+
+const coinMessageName = protoreflect.FullName("cosmos.base.v1beta1.Coin")
+
+// PolicyConfig is what the signer process allows the node to sign. Empty lists and amounts don't restrict anything,
+// except for the secrets: only the listed ones can be derived
+type PolicyConfig struct {
+	AllowedMessages []string `toml:"allowed_messages" comment:"Wallet messages the node can ask for. Eg: [\"upload\", \"download\", \"file_info\", \"list\", \"register\"]"`
+	AllowedSecrets  []string `toml:"allowed_secrets" comment:"Secrets derived from the wallet key the node can ask for, none when empty. Eg: [\"slice_encryption\", \"file_encryption\"]"`
+	AllowedTxTypes  []string `toml:"allowed_tx_types" comment:"Type urls of the transaction messages the node can sign. Eg: [\"/stratos.sds.v1.MsgPrepay\"]"`
+	ConfirmTxTypes  []string `toml:"confirm_tx_types" comment:"Transaction messages confirmed in the terminal of the signer before signing. Eg: [\"/cosmos.bank.v1beta1.MsgSend\"]"`
+	MaxTxSpend      string   `toml:"max_tx_spend" comment:"Most tokens spent by a transaction, fees included. Eg: \"10stos\""`
+	MaxDailySpend   string   `toml:"max_daily_spend" comment:"Most tokens spent by the transactions of a day. Eg: \"100stos\""`
+	ConfirmAbove    string   `toml:"confirm_above" comment:"Transactions spending more are confirmed in the terminal of the signer. Eg: \"1stos\""`
+}
+
+// Policy checks the requests of the node against a PolicyConfig, and keeps the amount spent today
+type Policy struct {
+	config        PolicyConfig
+	maxTxSpend    *sdkmath.Int
+	maxDailySpend *sdkmath.Int
+	confirmAbove  *sdkmath.Int
+	baseDenom     string
+
+	day   string
+	spent sdkmath.Int
+	mtx   sync.Mutex
+	now   func() time.Time
+}
+
+// txSummary is what a transaction does, as seen by the policy
+type txSummary struct {
+	types        []string
+	spend        sdkmath.Int // in the base denom
+	needsConfirm bool
+}
+
+func (t txSummary) String() string {
+	return fmt.Sprintf("%v spending %v", strings.Join(t.types, ", "), t.spend)
+}
+
+// NewPolicy parses the amounts of a PolicyConfig. The denoms must be registered before setting any amount
+func NewPolicy(config PolicyConfig) (*Policy, error) {
+	p := &Policy{config: config, spent: sdkmath.ZeroInt(), now: time.Now}
+	p.baseDenom, _ = txclienttypes.GetBaseDenom()
+	for _, limit := range []struct {
+		value  string
+		amount **sdkmath.Int
+	}{
+		{config.MaxTxSpend, &p.maxTxSpend},
+		{config.MaxDailySpend, &p.maxDailySpend},
+		{config.ConfirmAbove, &p.confirmAbove},
+	} {
+		if limit.value == "" {
+			continue
+		}
+		coin, err := txclienttypes.ParseCoinNormalized(limit.value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid amount [%v] in the signer policy", limit.value)
+		}
+		if p.baseDenom == "" || coin.Denom != p.baseDenom {
+			return nil, errors.Errorf("unknown denom in [%v] in the signer policy", limit.value)
+		}
+		*limit.amount = &coin.Amount
+	}
+	return p, nil
+}
+
+// LoadPolicy reads a policy file. Without a file, everything but deriving secrets is allowed
+func LoadPolicy(path string) (*Policy, error) {
+	config := PolicyConfig{}
+	if path != "" {
+		if err := utils.LoadTomlConfig(&config, path); err != nil {
+			return nil, errors.Wrap(err, "failed loading the signer policy")
+		}
+	}
+	return NewPolicy(config)
+}
+
+func (p *Policy) hasSpendLimits() bool {
+	return p.maxTxSpend != nil || p.maxDailySpend != nil || p.confirmAbove != nil
+}
+
+// CheckMessage checks that a wallet message type is allowed
+func (p *Policy) CheckMessage(msgType string) error {
+	if len(p.config.AllowedMessages) > 0 && !contains(p.config.AllowedMessages, msgType) {
+		return errors.Errorf("message type [%v] is not allowed", msgType)
+	}
+	return nil
+}
+
+// CheckSecret checks that a secret purpose is explicitly allowed. A secret gives access to the data of the wallet, so
+// none can be derived by default
+func (p *Policy) CheckSecret(purpose string) error {
+	if !contains(p.config.AllowedSecrets, purpose) {
+		return errors.Errorf("secret [%v] is not allowed", purpose)
+	}
+	return nil
+}
+
+// checkTx decodes the sign bytes of a transaction and checks its messages and spend
+func (p *Policy) checkTx(signBytes []byte) (txSummary, error) {
+	summary := txSummary{spend: sdkmath.ZeroInt()}
+	signDoc := &txv1beta1.SignDoc{}
+	if err := proto.Unmarshal(signBytes, signDoc); err != nil {
+		return summary, errors.Wrap(err, "invalid sign doc")
+	}
+	body := &txv1beta1.TxBody{}
+	if err := proto.Unmarshal(signDoc.BodyBytes, body); err != nil {
+		return summary, errors.Wrap(err, "invalid tx body")
+	}
+	authInfo := &txv1beta1.AuthInfo{}
+	if err := proto.Unmarshal(signDoc.AuthInfoBytes, authInfo); err != nil {
+		return summary, errors.Wrap(err, "invalid tx auth info")
+	}
+
+	coins := make(map[string]sdkmath.Int)
+	for _, msgAny := range body.Messages {
+		typeUrl := normalizeTypeUrl(msgAny.TypeUrl)
+		summary.types = append(summary.types, typeUrl)
+		if len(p.config.AllowedTxTypes) > 0 && !containsTypeUrl(p.config.AllowedTxTypes, typeUrl) {
+			return summary, errors.Errorf("transaction message [%v] is not allowed", typeUrl)
+		}
+		if containsTypeUrl(p.config.ConfirmTxTypes, typeUrl) {
+			summary.needsConfirm = true
+		}
+		msg, err := anypb.UnmarshalNew(msgAny, proto.UnmarshalOptions{})
+		if err != nil {
+			if p.hasSpendLimits() {
+				return summary, errors.Wrapf(err, "can't check the spend of transaction message [%v]", typeUrl)
+			}
+			continue
+		}
+		addCoins(msg.ProtoReflect(), coins)
+	}
+	if authInfo.Fee != nil {
+		addCoins(authInfo.Fee.ProtoReflect(), coins)
+	}
+
+	for denom, amount := range coins {
+		coin := txclienttypes.NormalizeCoin(txclienttypes.Coin{Denom: denom, Amount: amount})
+		if coin.Denom != p.baseDenom {
+			if p.hasSpendLimits() {
+				return summary, errors.Errorf("can't check the spend of denom [%v]", denom)
+			}
+			continue
+		}
+		summary.spend = summary.spend.Add(coin.Amount)
+	}
+	sort.Strings(summary.types)
+
+	if p.maxTxSpend != nil && summary.spend.GT(*p.maxTxSpend) {
+		return summary, errors.Errorf("transaction spends %v%v, more than the limit of %v", summary.spend, p.baseDenom, p.config.MaxTxSpend)
+	}
+	if p.maxDailySpend != nil {
+		p.mtx.Lock()
+		spent := p.spentToday()
+		p.mtx.Unlock()
+		if spent.Add(summary.spend).GT(*p.maxDailySpend) {
+			return summary, errors.Errorf("transaction would exceed the daily limit of %v", p.config.MaxDailySpend)
+		}
+	}
+	if p.confirmAbove != nil && summary.spend.GT(*p.confirmAbove) {
+		summary.needsConfirm = true
+	}
+	return summary, nil
+}
+
+// commitSpend counts a signed transaction in the spend of the day. The daily limit is checked again, since other
+// transactions may have been signed while this one was confirmed
+func (p *Policy) commitSpend(spend sdkmath.Int) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	spent := p.spentToday().Add(spend)
+	if p.maxDailySpend != nil && spent.GT(*p.maxDailySpend) {
+		return errors.Errorf("transaction would exceed the daily limit of %v", p.config.MaxDailySpend)
+	}
+	p.spent = spent
+	return nil
+}
+
+func (p *Policy) spentToday() sdkmath.Int {
+	if day := p.now().Format("2006-01-02"); day != p.day {
+		p.day = day
+		p.spent = sdkmath.ZeroInt()
+	}
+	return p.spent
+}
+
+// addCoins sums the coins found anywhere in a message, by denom
+func addCoins(m protoreflect.Message, coins map[string]sdkmath.Int) {
+	if m.Descriptor().FullName() == coinMessageName {
+		fields := m.Descriptor().Fields()
+		denom := m.Get(fields.ByName("denom")).String()
+		amount, ok := sdkmath.NewIntFromString(m.Get(fields.ByName("amount")).String())
+		if !ok {
+			return
+		}
+		if total, found := coins[denom]; found {
+			amount = amount.Add(total)
+		}
+		coins[denom] = amount
+		return
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsMap() {
+			return true
+		}
+		if fd.IsList() {
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				addCoins(list.Get(i).Message(), coins)
+			}
+			return true
+		}
+		addCoins(v.Message(), coins)
+		return true
+	})
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTypeUrl keeps the message name of a type url, so that "type.googleapis.com/cosmos.bank.v1beta1.MsgSend"
+// and "/cosmos.bank.v1beta1.MsgSend" are the same message
+func normalizeTypeUrl(typeUrl string) string {
+	return "/" + typeUrl[strings.LastIndex(typeUrl, "/")+1:]
+}
+
+func containsTypeUrl(list []string, typeUrl string) bool {
+	for _, item := range list {
+		if normalizeTypeUrl(item) == typeUrl {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package signer
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/crypto/secp256k1"
+	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
+)
+
+const (
+	METHOD_PUBKEY = "pubkey"
+	METHOD_SIGN   = "sign"
+	METHOD_SIGNTX = "sign_tx"
+	METHOD_DERIVE = "derive_secret"
+
+	// REMOTE_SIGNER_TIMEOUT leaves time to answer a confirmation prompt of the signer
+	REMOTE_SIGNER_TIMEOUT = 2 * time.Minute
+	UNIX_SCHEME           = "unix://"
+)
+
+// request is sent to the signer process as one line of JSON
+type request struct {
+	Method string `json:"method"`
+	Type   string `json:"type,omitempty"` // message type, or purpose of the secret
+	Data   []byte `json:"data,omitempty"`
+	Nonce  uint32 `json:"nonce,omitempty"`
+}
+
+type response struct {
+	Data  []byte `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// RemoteSigner asks a signer process listening on a Unix socket to sign for the wallet. The connection is opened again
+// after a failure
+type RemoteSigner struct {
+	socketPath string
+	pubKey     fwcryptotypes.PubKey
+	conn       net.Conn
+	reader     *bufio.Reader
+	mtx        sync.Mutex
+}
+
+// DialRemoteSigner connects to a signer process, eg: "unix:///path/signer.sock"
+func DialRemoteSigner(address string) (*RemoteSigner, error) {
+	if !strings.HasPrefix(address, UNIX_SCHEME) {
+		return nil, errors.Errorf("unsupported signer address [%v], expecting %v<path>", address, UNIX_SCHEME)
+	}
+	s := &RemoteSigner{socketPath: strings.TrimPrefix(address, UNIX_SCHEME)}
+	pubKey, err := s.call(request{Method: METHOD_PUBKEY})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting the public key from the signer")
+	}
+	s.pubKey = secp256k1.PubKeyFromBytes(pubKey)
+	return s, nil
+}
+
+func (s *RemoteSigner) PubKey() fwcryptotypes.PubKey {
+	return s.pubKey
+}
+
+func (s *RemoteSigner) Sign(msgType string, msg []byte) ([]byte, error) {
+	return s.call(request{Method: METHOD_SIGN, Type: msgType, Data: msg})
+}
+
+func (s *RemoteSigner) SignTx(signBytes []byte) ([]byte, error) {
+	return s.call(request{Method: METHOD_SIGNTX, Data: signBytes})
+}
+
+func (s *RemoteSigner) DeriveSecret(purpose string, nonce uint32) ([]byte, error) {
+	return s.call(request{Method: METHOD_DERIVE, Type: purpose, Nonce: nonce})
+}
+
+func (s *RemoteSigner) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *RemoteSigner) call(req request) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout("unix", s.socketPath, 5*time.Second)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed connecting to the signer")
+		}
+		s.conn = conn
+		s.reader = bufio.NewReader(conn)
+	}
+
+	rsp, err := s.roundTrip(req)
+	if err != nil {
+		// The connection may hold a late response, don't reuse it
+		_ = s.conn.Close()
+		s.conn = nil
+		return nil, err
+	}
+	if rsp.Error != "" {
+		return nil, errors.Errorf("signer refused to %v: %v", req.Method, rsp.Error)
+	}
+	return rsp.Data, nil
+}
+
+func (s *RemoteSigner) roundTrip(req request) (*response, error) {
+	if err := s.conn.SetDeadline(time.Now().Add(REMOTE_SIGNER_TIMEOUT)); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.conn.Write(append(data, '\n')); err != nil {
+		return nil, errors.Wrap(err, "failed sending to the signer")
+	}
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading from the signer")
+	}
+	rsp := &response{}
+	if err = json.Unmarshal(line, rsp); err != nil {
+		return nil, errors.Wrap(err, "invalid response from the signer")
+	}
+	return rsp, nil
+}
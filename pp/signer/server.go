@@ -0,0 +1,137 @@
+package signer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	fwtypes "github.com/stratosnet/sds/framework/types"
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+// ConfirmFunc asks the owner of the wallet to approve a transaction
+type ConfirmFunc func(description string) bool
+
+// Server answers the requests of a node for a Signer, within the limits of a Policy
+type Server struct {
+	signer     Signer
+	address    string // bech32 wallet address, included in every wallet message
+	policy     *Policy
+	confirm    ConfirmFunc
+	confirmMtx sync.Mutex // one prompt at a time
+}
+
+// NewServer creates a signer server. Transactions needing a confirmation are refused when confirm is nil
+func NewServer(signer Signer, policy *Policy, confirm ConfirmFunc) *Server {
+	return &Server{
+		signer:  signer,
+		address: fwtypes.WalletAddress(signer.PubKey().Address()).String(),
+		policy:  policy,
+		confirm: confirm,
+	}
+}
+
+// Serve handles the connections of the listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		req := request{}
+		rsp := response{}
+		if err = json.Unmarshal(line, &req); err != nil {
+			rsp.Error = "invalid request"
+		} else if rsp.Data, err = s.handle(req); err != nil {
+			utils.ErrorLogf("refused %v request: %v", req.Method, err)
+			rsp.Error = err.Error()
+		}
+		data, err := json.Marshal(rsp)
+		if err != nil {
+			return
+		}
+		if _, err = conn.Write(append(data, '\n')); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(req request) ([]byte, error) {
+	switch req.Method {
+	case METHOD_PUBKEY:
+		return s.signer.PubKey().Bytes(), nil
+	case METHOD_SIGN:
+		if err := s.policy.CheckMessage(req.Type); err != nil {
+			return nil, err
+		}
+		if err := checkWalletMessage(req.Data, s.address); err != nil {
+			return nil, err
+		}
+		return s.signer.Sign(req.Type, req.Data)
+	case METHOD_DERIVE:
+		if err := s.policy.CheckSecret(req.Type); err != nil {
+			return nil, err
+		}
+		return s.signer.DeriveSecret(req.Type, req.Nonce)
+	case METHOD_SIGNTX:
+		return s.signTx(req.Data)
+	default:
+		return nil, errors.Errorf("unknown method [%v]", req.Method)
+	}
+}
+
+func (s *Server) signTx(signBytes []byte) ([]byte, error) {
+	summary, err := s.policy.checkTx(signBytes)
+	if err != nil {
+		return nil, err
+	}
+	if summary.needsConfirm {
+		if s.confirm == nil {
+			return nil, errors.New("transaction needs a confirmation")
+		}
+		s.confirmMtx.Lock()
+		approved := s.confirm(summary.String())
+		s.confirmMtx.Unlock()
+		if !approved {
+			return nil, errors.New("transaction was not confirmed")
+		}
+	}
+	if err = s.policy.commitSpend(summary.spend); err != nil {
+		return nil, err
+	}
+	utils.Logf("signing transaction: %v", summary)
+	return s.signer.SignTx(signBytes)
+}
+
+// checkWalletMessage checks that data is a wallet message, so that the sign bytes of a transaction can't be signed
+// without going through the transaction policy. Wallet messages are text including the wallet address, while sign docs
+// are binary protobuf starting with a control character
+func checkWalletMessage(data []byte, address string) error {
+	if !utf8.Valid(data) || bytes.IndexFunc(data, unicode.IsControl) != -1 {
+		return errors.New("wallet message is not text")
+	}
+	if !bytes.Contains(data, []byte(address)) {
+		return errors.New("wallet message doesn't include the wallet address")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package signer
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+
+	fwed25519 "github.com/stratosnet/sds/framework/crypto/ed25519"
+	"github.com/stratosnet/sds/framework/crypto/encryption/hdkey"
+	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+	txclienttypes "github.com/stratosnet/sds/tx-client/types"
+)
+
+// Types of the wallet messages signed by the node. The sign messages don't carry their type, so the caller declares it
+// and a remote signer applies its policy to it
+const (
+	MSG_UPLOAD    = "upload"
+	MSG_DOWNLOAD  = "download"
+	MSG_FILE_INFO = "file_info"
+	MSG_DELETE    = "delete"
+	MSG_SHARE     = "share"
+	MSG_LIST      = "list"
+	MSG_PREPAY    = "prepay"
+	MSG_REGISTER  = "register"
+	MSG_MANIFEST  = "manifest"
+)
+
+// Purposes of the secrets derived from the wallet key
+const (
+	SECRET_SLICE_ENCRYPTION = "slice_encryption"
+	SECRET_FILE_ENCRYPTION  = "file_encryption"
+)
+
+const fileEncryptionKeySecret = "sds file encryption key"
+
+// Signer signs for the wallet of the node. The private key stays with the implementation, which may be another process
+type Signer interface {
+	txclienttypes.TxSigner
+	// Sign signs a wallet message of the given type
+	Sign(msgType string, msg []byte) ([]byte, error)
+	// DeriveSecret returns a secret derived from the wallet key, like the keys encrypting the slices of the wallet
+	DeriveSecret(purpose string, nonce uint32) ([]byte, error)
+}
+
+// LocalSigner signs with a wallet key decrypted in the current process
+type LocalSigner struct {
+	privKey fwcryptotypes.PrivKey
+}
+
+func NewLocalSigner(privKey fwcryptotypes.PrivKey) *LocalSigner {
+	return &LocalSigner{privKey: privKey}
+}
+
+// LoadKeystore decrypts a wallet keystore file
+func LoadKeystore(filePath, password string) (*LocalSigner, error) {
+	keyjson, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := fwtypes.DecryptKey(keyjson, password, true)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalSigner(key.PrivateKey), nil
+}
+
+func (s *LocalSigner) PubKey() fwcryptotypes.PubKey {
+	return s.privKey.PubKey()
+}
+
+func (s *LocalSigner) Sign(_ string, msg []byte) ([]byte, error) {
+	return s.privKey.Sign(msg)
+}
+
+func (s *LocalSigner) SignTx(signBytes []byte) ([]byte, error) {
+	return s.privKey.Sign(signBytes)
+}
+
+func (s *LocalSigner) DeriveSecret(purpose string, nonce uint32) ([]byte, error) {
+	switch purpose {
+	case SECRET_SLICE_ENCRYPTION:
+		key, err := hdkey.MasterKeyForSliceEncryption(s.privKey.Bytes(), nonce)
+		if err != nil {
+			return nil, err
+		}
+		return key.PrivateKey(), nil
+	case SECRET_FILE_ENCRYPTION:
+		return fwed25519.GenPrivKeyFromSecret(append([]byte(fileEncryptionKeySecret), s.privKey.Bytes()...)).Bytes(), nil
+	default:
+		return nil, errors.Errorf("unknown secret purpose [%v]", purpose)
+	}
+}
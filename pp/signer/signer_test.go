@@ -0,0 +1,190 @@
+package signer
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bankv1beta1 "cosmossdk.io/api/cosmos/bank/v1beta1"
+	basev1beta1 "cosmossdk.io/api/cosmos/base/v1beta1"
+	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
+	sdkmath "cosmossdk.io/math"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/stratosnet/sds/framework/crypto/secp256k1"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+	msgutils "github.com/stratosnet/sds/sds-msg/utils"
+	txclienttypes "github.com/stratosnet/sds/tx-client/types"
+)
+
+func testSignDoc(t *testing.T, msg proto.Message, fee string) []byte {
+	msgAny, err := anypb.New(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := proto.Marshal(&txv1beta1.TxBody{Messages: []*anypb.Any{msgAny}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authInfo, err := proto.Marshal(&txv1beta1.AuthInfo{Fee: &txv1beta1.Fee{Amount: []*basev1beta1.Coin{{Denom: "wei", Amount: fee}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.Marshal(&txv1beta1.SignDoc{BodyBytes: body, AuthInfoBytes: authInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRemoteSigner(t *testing.T) {
+	privKey, err := secp256k1.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := NewLocalSigner(privKey)
+	policy, err := NewPolicy(PolicyConfig{AllowedMessages: []string{MSG_UPLOAD}, AllowedSecrets: []string{SECRET_FILE_ENCRYPTION}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unix socket paths are short, so t.TempDir() may be too long
+	dir, err := os.MkdirTemp("", "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	socketPath := filepath.Join(dir, "signer.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		_ = NewServer(local, policy, nil).Serve(listener)
+	}()
+
+	remote, err := DialRemoteSigner(UNIX_SCHEME + socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = remote.Close()
+	}()
+	if !bytes.Equal(remote.PubKey().Bytes(), privKey.PubKey().Bytes()) {
+		t.Fatal("the remote signer should have the public key of the wallet")
+	}
+
+	address := fwtypes.WalletAddress(privKey.PubKey().Address()).String()
+	msg := []byte(msgutils.GetFileUploadWalletSignMessage("v05ahm51atjqkpte7gnqa94bhgpfpe4c6lkq0jh8", address, "1", 1700000000))
+	sign, err := remote.Sign(MSG_UPLOAD, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !privKey.PubKey().VerifySignature(msg, sign) {
+		t.Fatal("the remote signature should be valid")
+	}
+	if _, err = remote.Sign(MSG_DELETE, msg); err == nil {
+		t.Fatal("a message type not allowed should be refused")
+	}
+	send := &bankv1beta1.MsgSend{FromAddress: address, ToAddress: address, Amount: []*basev1beta1.Coin{{Denom: "wei", Amount: "1"}}}
+	if _, err = remote.Sign(MSG_UPLOAD, testSignDoc(t, send, "1")); err == nil {
+		t.Fatal("the sign bytes of a transaction should be refused as a wallet message")
+	}
+
+	secret, err := remote.DeriveSecret(SECRET_FILE_ENCRYPTION, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localSecret, err := local.DeriveSecret(SECRET_FILE_ENCRYPTION, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret, localSecret) {
+		t.Fatal("the remote secret should be the local one")
+	}
+	if _, err = remote.DeriveSecret(SECRET_SLICE_ENCRYPTION, 1); err == nil {
+		t.Fatal("a secret not allowed should be refused")
+	}
+
+	defaultPolicy, err := LoadPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = defaultPolicy.CheckSecret(SECRET_FILE_ENCRYPTION); err == nil {
+		t.Fatal("secrets should be refused without a policy file")
+	}
+}
+
+func TestPolicyTx(t *testing.T) {
+	if _, err := txclienttypes.GetBaseDenom(); err != nil {
+		if err = txclienttypes.RegisterDenom(txclienttypes.Stos, sdkmath.LegacyOneDec()); err != nil {
+			t.Fatal(err)
+		}
+		if err = txclienttypes.RegisterDenom(txclienttypes.Wei, sdkmath.LegacyNewDecWithPrec(1, txclienttypes.WeiDenomUnit)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy, err := NewPolicy(PolicyConfig{
+		AllowedTxTypes: []string{"/cosmos.bank.v1beta1.MsgSend"},
+		MaxTxSpend:     "1000wei",
+		MaxDailySpend:  "1500wei",
+		ConfirmAbove:   "500wei",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	policy.now = func() time.Time { return now }
+
+	signDoc := func(msg proto.Message, fee string) []byte {
+		return testSignDoc(t, msg, fee)
+	}
+	send := func(amount string) proto.Message {
+		return &bankv1beta1.MsgSend{Amount: []*basev1beta1.Coin{{Denom: "wei", Amount: amount}}}
+	}
+
+	summary, err := policy.checkTx(signDoc(send("600"), "100"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.spend.Equal(sdkmath.NewInt(700)) || !summary.needsConfirm {
+		t.Fatalf("the spend should be 700 with a confirmation, got %v %v", summary.spend, summary.needsConfirm)
+	}
+	if err = policy.commitSpend(summary.spend); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = policy.checkTx(signDoc(send("1000"), "1")); err == nil {
+		t.Fatal("a transaction above the limit should be refused")
+	}
+	summary, err = policy.checkTx(signDoc(send("400"), "100"))
+	if err != nil || summary.needsConfirm {
+		t.Fatalf("a small transaction should be allowed without confirmation: %v", err)
+	}
+	if err = policy.commitSpend(summary.spend); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = policy.checkTx(signDoc(send("400"), "100")); err == nil {
+		t.Fatal("the daily limit should be reached")
+	}
+
+	now = now.Add(24 * time.Hour)
+	if _, err = policy.checkTx(signDoc(send("400"), "100")); err != nil {
+		t.Fatalf("the daily spend should be reset the next day: %v", err)
+	}
+
+	multiSend := &bankv1beta1.MsgMultiSend{}
+	if _, err = policy.checkTx(signDoc(multiSend, "1")); err == nil {
+		t.Fatal("a transaction type not allowed should be refused")
+	}
+}
@@ -22,11 +22,15 @@ import (
 	"github.com/stratosnet/sds/pp/metrics"
 	"github.com/stratosnet/sds/pp/p2pserver"
 	"github.com/stratosnet/sds/pp/setting"
+	"github.com/stratosnet/sds/pp/webhook"
 	"github.com/stratosnet/sds/sds-msg/protos"
 )
 
 const LOCAL_REQID string = "local"
 
+// RANGE_READ_REQID prefixes the reqId of downloads whose slices are fetched one at a time, on demand
+const RANGE_READ_REQID string = "rangeread"
+
 var (
 	// File related maps
 	// DownloadTaskMap PP passway download task map   make(map[string]*DownloadTask)
@@ -47,6 +51,9 @@ var (
 	// This is used because slices can only be decrypted after being fully downloaded
 	DownloadEncryptedSlices = &sync.Map{}
 
+	// DownloadErasureGroups stores the shards received for each slice of erasure coded files, indexed by file hash + file req id + "#" + slice number
+	DownloadErasureGroups = &sync.Map{}
+
 	downloadEndMutex sync.Mutex
 )
 
@@ -233,6 +240,12 @@ func CleanDownloadFileAndConnMap(ctx context.Context, fileHash, fileReqId string
 		}
 	}
 	DownloadFileMap.Delete(fileHash + fileReqId)
+	DownloadErasureGroups.Range(func(key, _ any) bool {
+		if strings.HasPrefix(key.(string), fileHash+fileReqId+"#") {
+			DownloadErasureGroups.Delete(key)
+		}
+		return true
+	})
 }
 
 func CancelDownloadTask(fileHash string) {
@@ -279,6 +292,7 @@ func DownloadResult(ctx context.Context, filehash string, success bool, reason s
 	if success {
 		pp.Log(ctx, "* File ", filehash)
 		pp.Log(ctx, "* has been successfully downloaded")
+		webhook.Publish(webhook.EVENT_DOWNLOAD_COMPLETE, webhook.FileEvent{FileHash: filehash})
 	} else {
 		pp.Log(ctx, "* The task to download file ", filehash)
 		pp.Log(ctx, "* has failed, ", reason)
@@ -286,6 +300,7 @@ func DownloadResult(ctx context.Context, filehash string, success bool, reason s
 		pp.Log(ctx, "* Another task to the same file could be started by ")
 		pp.Log(ctx, "* 'get' or 'getsharefile' command. New task will resume")
 		pp.Log(ctx, "* downloading from slices already downloaded.")
+		webhook.Publish(webhook.EVENT_DOWNLOAD_FAILED, webhook.FileEvent{FileHash: filehash, Reason: reason})
 	}
 	pp.Log(ctx, "******************************************************")
 }
@@ -407,7 +422,7 @@ func DownloadProgress(ctx context.Context, fileHash, fileReqId string, size uint
 		p := float32(sp.DownloadedSize) / float32(sp.TotalSize) * 100
 		pp.Logf(ctx, "downloaded：%.2f %% \n", p)
 		setting.DownloadProgressMap.Store(fileHash, p)
-		setting.ShowProgress(ctx, p)
+		pp.ShowProgress(ctx, p)
 
 		// all bytes downloaded
 		if sp.DownloadedSize >= sp.TotalSize {
@@ -132,13 +132,23 @@ func SaveTransferData(target *protos.RspTransferDownload) (bool, error) {
 	if err != nil {
 		return false, errors.Wrap(err, "Failed getting slice data")
 	}
-	sliceHash, err := crypto.CalcSliceHash(sliceData, tTask.FileHash, tTask.SliceNum)
+	valid, err := crypto.VerifySliceHash(sliceData, tTask.FileHash, tTask.SliceNum, tTask.SliceStorageInfo.SliceHash)
 	if err != nil {
 		return false, err
 	}
-	if tTask.SliceStorageInfo.SliceHash != sliceHash {
+	if !valid {
 		return false, errors.New("whole slice received, but slice hash doesn't match")
 	}
+	if file.IsDeduplicatedSlice(tTask.SliceStorageInfo.SliceHash, sliceData) {
+		if err = file.AddSliceRef(tTask.SliceStorageInfo.SliceHash, tTask.FileHash); err != nil {
+			return false, err
+		}
+	} else if err = file.SaveSliceOrigin(tTask.SliceStorageInfo.SliceHash, tTask.FileHash, tTask.SliceNum); err != nil {
+		return false, err
+	}
+	if err = file.CommitSlice(tTask.SliceStorageInfo.SliceHash); err != nil {
+		return false, err
+	}
 	utils.DebugLogf("whole slice received, sliceHash=%v", tTask.SliceStorageInfo.SliceHash)
 	return true, nil
 
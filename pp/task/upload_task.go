@@ -67,6 +67,7 @@ type UploadFileTask struct {
 	lastTouch         time.Time
 	scheduledJob      clock.Job
 	helper            func(ctx context.Context, fileHash string)
+	savedState        []byte // last state written to disk
 }
 
 type SlicesPerDestination struct {
@@ -162,6 +163,7 @@ func CreateUploadFileTask(target *protos.RspUploadFile, fn func(ctx context.Cont
 		}
 		task.destinations[slice.PpInfo.P2PAddress].slices = append(task.destinations[slice.PpInfo.P2PAddress].slices, sws)
 	}
+	task.SaveState()
 	metrics.TaskCount.WithLabelValues("upload").Inc()
 	return task
 }
@@ -280,6 +282,13 @@ func (u *UploadFileTask) GetUploadType() protos.UploadType {
 	return u.uploadType
 }
 
+// GetOwnerWalletAddress returns the wallet the file is uploaded for
+func (u *UploadFileTask) GetOwnerWalletAddress() string {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+	return u.rspUploadFile[0].OwnerWalletAddress
+}
+
 func (u *UploadFileTask) GetUploadSpP2pAddress() string {
 	u.mutex.RLock()
 	defer u.mutex.RUnlock()
@@ -287,8 +296,8 @@ func (u *UploadFileTask) GetUploadSpP2pAddress() string {
 }
 
 func (u *UploadFileTask) SetRspUploadFile(rspUploadFile *protos.RspUploadFile) {
-	u.mutex.RLock()
-	defer u.mutex.RUnlock()
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
 	u.rspUploadFile[u.retryCount] = rspUploadFile
 }
 
@@ -318,13 +327,59 @@ func (u *UploadFileTask) SliceFailuresToReport() ([]*protos.SliceHashAddr, []boo
 	return slicesToReDownload, failedSlices
 }
 
+// SliceDestinations returns the slices of the task with their current destination
+func (u *UploadFileTask) SliceDestinations() []*protos.SliceHashAddr {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	var slices []*protos.SliceHashAddr
+	for _, destination := range u.destinations {
+		for _, slice := range destination.slices {
+			if slice.Status != SLICE_STATUS_REPLACED {
+				slices = append(slices, slice.slice)
+			}
+		}
+	}
+	return slices
+}
+
+// ReassignSlices holds back slices that were not uploaded yet until the SP gives them a new destination, and counts as a
+// retry. It returns the slices to report, and a boolean list of the same length indicating which slices actually failed
+func (u *UploadFileTask) ReassignSlices(sliceNumbers []uint64) ([]*protos.SliceHashAddr, []bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	reassign := make(map[uint64]bool)
+	for _, sliceNumber := range sliceNumbers {
+		reassign[sliceNumber] = true
+	}
+	var slicesToReport []*protos.SliceHashAddr
+	var failedSlices []bool
+	for _, destination := range u.destinations {
+		for _, slice := range destination.slices {
+			if slice.Status != SLICE_STATUS_STARTED || !reassign[slice.slice.SliceNumber] {
+				continue
+			}
+			slice.Status = SLICE_STATUS_WAITING_FOR_SP
+			slicesToReport = append(slicesToReport, slice.slice)
+			failedSlices = append(failedSlices, false)
+		}
+	}
+	if len(slicesToReport) > 0 && u.rspUploadFile != nil {
+		// the other slices keep uploading with the current response until the SP answers
+		u.rspUploadFile[u.retryCount+1] = u.rspUploadFile[u.retryCount]
+		u.retryCount++
+	}
+	return slicesToReport, failedSlices
+}
+
 func (u *UploadFileTask) CanRetry() bool {
 	return u.retryCount < MAX_UPLOAD_RETRY
 }
 
 func (u *UploadFileTask) UpdateRetryCount() {
-	u.mutex.RLock()
-	defer u.mutex.RUnlock()
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
 	u.retryCount++
 }
 
@@ -490,6 +545,10 @@ func (u *UploadFileTask) uploadSlicesToDestination(ctx context.Context, destinat
 		if slice.Status == SLICE_STATUS_FINISHED || slice.Status == SLICE_STATUS_REPLACED {
 			continue
 		}
+		// the slice is uploaded to its new destination once the SP answers, or reported again after UPLOAD_WAIT_TIMEOUT
+		if slice.Status == SLICE_STATUS_WAITING_FOR_SP {
+			continue
+		}
 
 		var uploadSliceTask *UploadSliceTask
 		var err error
@@ -0,0 +1,207 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/pp/file"
+	"github.com/stratosnet/sds/sds-msg/protos"
+)
+
+// uploadTaskState is the part of an UploadFileTask that is persisted to disk, so that the upload can be resumed after a restart
+type uploadTaskState struct {
+	FilePath      string             `json:"file_path"`
+	FileCRC       uint32             `json:"file_crc"`
+	RspUploadFile map[int][]byte     `json:"rsp_upload_file"` // proto encoded responses from the SP, indexed by retry count
+	RetryCount    int                `json:"retry_count"`
+	Slices        []uploadSliceState `json:"slices"`
+	Stopped       bool               `json:"stopped"` // the upload was paused by the user, it is only resumed on request
+}
+
+type uploadSliceState struct {
+	Slice  []byte `json:"slice"` // proto encoded SliceHashAddr, including the destination PP
+	Status int    `json:"status"`
+}
+
+// SaveState persists the state of a new upload task. Nothing is written if the state didn't change since the last call
+func (u *UploadFileTask) SaveState() {
+	if u.uploadType != protos.UploadType_NEW_UPLOAD {
+		return
+	}
+
+	u.mutex.RLock()
+	fileHash := u.rspUploadFile[0].FileHash
+	state := &uploadTaskState{
+		FilePath:      file.GetFilePath(fileHash),
+		FileCRC:       u.fileCRC,
+		RspUploadFile: make(map[int][]byte),
+		RetryCount:    u.retryCount,
+	}
+	var err error
+	for retry, rsp := range u.rspUploadFile {
+		if rsp == nil {
+			continue
+		}
+		if state.RspUploadFile[retry], err = proto.Marshal(rsp); err != nil {
+			break
+		}
+	}
+	for _, destination := range u.destinations {
+		for _, slice := range destination.slices {
+			if err != nil {
+				break
+			}
+			sliceState := uploadSliceState{Status: slice.Status}
+			sliceState.Slice, err = proto.Marshal(slice.slice)
+			state.Slices = append(state.Slices, sliceState)
+		}
+	}
+	u.mutex.RUnlock()
+
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(state)
+	}
+	if err != nil {
+		utils.ErrorLog("failed encoding upload task state", err)
+		return
+	}
+	if bytes.Equal(data, u.savedState) {
+		return
+	}
+	if err = file.SaveUploadTaskState(fileHash, data); err != nil {
+		utils.ErrorLog("failed saving upload task state", err)
+		return
+	}
+	u.savedState = data
+}
+
+// GetUploadedSize returns the size of the slices already uploaded, and the total size of the slices to upload
+func (u *UploadFileTask) GetUploadedSize() (int64, int64) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	var uploaded, total int64
+	for _, destination := range u.destinations {
+		for _, slice := range destination.slices {
+			if slice.Status == SLICE_STATUS_REPLACED {
+				continue
+			}
+			total += int64(slice.slice.SliceSize)
+			if slice.Status == SLICE_STATUS_FINISHED {
+				uploaded += int64(slice.slice.SliceSize)
+			}
+		}
+	}
+	return uploaded, total
+}
+
+// LoadUploadFileTask restores an upload task saved by SaveState. The slices that were not finished will be uploaded again.
+// The returned bool indicates whether the upload was stopped by the user
+func LoadUploadFileTask(fileHash string, fn func(ctx context.Context, fileHash string)) (*UploadFileTask, bool, error) {
+	data, err := file.ReadUploadTaskState(fileHash)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "no unfinished upload found for the file")
+	}
+	state := &uploadTaskState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, false, errors.Wrap(err, "invalid upload task state")
+	}
+	if len(state.RspUploadFile[0]) == 0 {
+		return nil, false, errors.New("invalid upload task state, missing the response from the SP")
+	}
+
+	task := &UploadFileTask{
+		rspUploadFile: make(map[int]*protos.RspUploadFile),
+		fileCRC:       state.FileCRC,
+		uploadType:    protos.UploadType_NEW_UPLOAD,
+		destinations:  make(map[string]*SlicesPerDestination),
+		retryCount:    state.RetryCount,
+		lastTouch:     time.Now(),
+		helper:        fn,
+		savedState:    data,
+	}
+	for retry, rspData := range state.RspUploadFile {
+		rsp := &protos.RspUploadFile{}
+		if err = proto.Unmarshal(rspData, rsp); err != nil {
+			return nil, false, errors.Wrap(err, "invalid upload task state")
+		}
+		task.rspUploadFile[retry] = rsp
+	}
+	if task.rspUploadFile[0].FileHash != fileHash {
+		return nil, false, errors.New("upload task state doesn't belong to this file")
+	}
+
+	for _, sliceState := range state.Slices {
+		slice := &protos.SliceHashAddr{}
+		if err = proto.Unmarshal(sliceState.Slice, slice); err != nil {
+			return nil, false, errors.Wrap(err, "invalid upload task state")
+		}
+		if slice.PpInfo == nil {
+			continue
+		}
+		status := sliceState.Status
+		if status != SLICE_STATUS_FINISHED && status != SLICE_STATUS_REPLACED {
+			status = SLICE_STATUS_STARTED
+		}
+		if _, ok := task.destinations[slice.PpInfo.P2PAddress]; !ok {
+			task.destinations[slice.PpInfo.P2PAddress] = &SlicesPerDestination{ppInfo: slice.PpInfo}
+		}
+		task.destinations[slice.PpInfo.P2PAddress].slices = append(task.destinations[slice.PpInfo.P2PAddress].slices,
+			&SliceWithStatus{slice: slice, Status: status})
+	}
+	if state.FilePath != "" {
+		file.SaveFilePath(fileHash, state.FilePath)
+	}
+	return task, state.Stopped, nil
+}
+
+// StopUploadTaskState marks a persisted upload task as stopped by the user, so that it is not resumed automatically on restart
+func StopUploadTaskState(fileHash string) {
+	data, err := file.ReadUploadTaskState(fileHash)
+	if err != nil {
+		return
+	}
+	state := &uploadTaskState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return
+	}
+	state.Stopped = true
+	if data, err = json.Marshal(state); err == nil {
+		err = file.SaveUploadTaskState(fileHash, data)
+	}
+	if err != nil {
+		utils.ErrorLog("failed saving upload task state", err)
+	}
+}
+
+// DeleteUploadTaskState removes the persisted state of an upload task that can't be resumed anymore
+func DeleteUploadTaskState(fileHash string) {
+	file.DeleteUploadTaskState(fileHash)
+}
+
+// ListUploadTaskStates returns the hashes of the files with a persisted upload task
+func ListUploadTaskStates() []string {
+	return file.ListUploadTaskStates()
+}
+
+// FindUploadTaskState returns the hash of the file uploaded from filePath, if its upload task was persisted
+func FindUploadTaskState(filePath string) (string, bool) {
+	for _, fileHash := range file.ListUploadTaskStates() {
+		data, err := file.ReadUploadTaskState(fileHash)
+		if err != nil {
+			continue
+		}
+		state := &uploadTaskState{}
+		if err = json.Unmarshal(data, state); err == nil && state.FilePath == filePath {
+			return fileHash, true
+		}
+	}
+	return "", false
+}
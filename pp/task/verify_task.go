@@ -81,9 +81,9 @@ func SaveVerifyData(target *protos.RspVerifyDownload) (bool, error) {
 			return false, errors.Wrap(err, "Failed getting slice data")
 		}
 
-		sliceHash, err := crypto.CalcSliceHash(sliceData, tTask.FileHash, tTask.SliceNum)
+		valid, err := crypto.VerifySliceHash(sliceData, tTask.FileHash, tTask.SliceNum, tTask.SliceStorageInfo.SliceHash)
 		_ = file.DeleteVerifySlice(tTask.SliceStorageInfo.SliceHash)
-		if tTask.SliceStorageInfo.SliceHash != sliceHash {
+		if !valid {
 			return false, errors.New("verify: the whole slice is received, but the content doesn't pass the validation.")
 		}
 		if err != nil {
@@ -0,0 +1,56 @@
+package tx
+
+import (
+	"fmt"
+)
+
+const (
+	sdkCodespace = "sdk"
+
+	codeOutOfGas = 11
+)
+
+// sdkErrors names the errors of the sdk codespace returned by the chain
+var sdkErrors = map[uint32]string{
+	2:  "tx parse error",
+	3:  "invalid sequence",
+	4:  "unauthorized",
+	5:  "insufficient funds",
+	6:  "unknown request",
+	7:  "invalid address",
+	8:  "invalid pubkey",
+	9:  "unknown address",
+	10: "invalid coins",
+	11: "out of gas",
+	12: "memo too large",
+	13: "insufficient fee",
+	14: "maximum number of signatures exceeded",
+	15: "no signatures supplied",
+	18: "invalid request",
+	19: "tx already in mempool",
+	20: "mempool is full",
+	21: "tx too large",
+	32: "incorrect account sequence",
+	41: "invalid gas limit",
+}
+
+// decodeAbciError describes the result code of a tx, with the log of the chain
+func decodeAbciError(codespace string, code uint32, rawLog string) string {
+	if code == 0 {
+		return ""
+	}
+	name := fmt.Sprintf("%v error %v", codespace, code)
+	if codespace == sdkCodespace {
+		if sdkName, found := sdkErrors[code]; found {
+			name = sdkName
+		}
+	}
+	if rawLog == "" {
+		return name
+	}
+	return name + ": " + rawLog
+}
+
+func isOutOfGas(codespace string, code uint32) bool {
+	return codespace == sdkCodespace && code == codeOutOfGas
+}
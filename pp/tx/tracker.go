@@ -0,0 +1,421 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	abciv1beta1 "cosmossdk.io/api/cosmos/base/abci/v1beta1"
+	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
+	sdkmath "cosmossdk.io/math"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/tx-client/grpc"
+	txclienttypes "github.com/stratosnet/sds/tx-client/types"
+)
+
+const (
+	TX_PENDING  = "pending"
+	TX_INCLUDED = "included"
+	TX_FAILED   = "failed"
+	TX_TIMEOUT  = "timeout"
+	TX_REPLACED = "replaced"
+
+	TX_POLL_INTERVAL = 2 * time.Second
+	// TX_RESULT_WAIT is how long a request waits for its tx to be included before returning it as pending
+	TX_RESULT_WAIT = 10 * time.Second
+	// TX_STUCK_TIMEOUT is how long a tx can wait for a block before it is resubmitted with more gas
+	TX_STUCK_TIMEOUT   = time.Minute
+	TX_CONFIRM_TIMEOUT = 5 * time.Minute
+	TX_MAX_RESUBMITS   = 3
+	TX_HISTORY_TTL     = 24 * time.Hour
+
+	// A resubmitted tx has 3/2 of the gas and fee of the previous one
+	gasBumpNumerator   = 3
+	gasBumpDenominator = 2
+)
+
+// TrackedTx is the state of a tx broadcast by the node
+type TrackedTx struct {
+	Hash          string `json:"hash"`
+	Type          string `json:"type"` // type url of the first message
+	Status        string `json:"status"`
+	Height        int64  `json:"height,omitempty"`
+	GasWanted     int64  `json:"gas_wanted,omitempty"`
+	GasUsed       int64  `json:"gas_used,omitempty"`
+	Code          uint32 `json:"code,omitempty"`
+	Codespace     string `json:"codespace,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Attempt       int    `json:"attempt"`
+	ReplacedBy    string `json:"replaced_by,omitempty"` // hash of the tx resubmitted in place of this one, even while pending
+	BroadcastTime int64  `json:"broadcast_time"`
+	UpdateTime    int64  `json:"update_time"`
+}
+
+func (t TrackedTx) Final() bool {
+	return t.Status != TX_PENDING
+}
+
+func (t TrackedTx) String() string {
+	switch t.Status {
+	case TX_INCLUDED:
+		return fmt.Sprintf("tx %v included at height %v, gas used %v/%v", t.Hash, t.Height, t.GasUsed, t.GasWanted)
+	case TX_PENDING:
+		if t.ReplacedBy != "" {
+			return fmt.Sprintf("tx %v waiting to be included, or its replacement %v", t.Hash, t.ReplacedBy)
+		}
+		return fmt.Sprintf("tx %v waiting to be included", t.Hash)
+	default:
+		return fmt.Sprintf("tx %v %v: %v", t.Hash, t.Status, t.Error)
+	}
+}
+
+// RebuildFunc builds and signs a tx again with a new fee, to resubmit it
+type RebuildFunc func(txFee txclienttypes.TxFee) ([]byte, error)
+
+type txEntry struct {
+	tx       TrackedTx
+	txBytes  []byte
+	rebuild  RebuildFunc
+	done     chan struct{}
+	isClosed bool
+	mtx      sync.Mutex
+}
+
+var trackedTxs = &sync.Map{} // tx hash → *txEntry
+
+// Broadcast broadcasts a tx and tracks it until it is included in a block. The tx is resubmitted with rebuild when it
+// runs out of gas or is stuck, unless rebuild is nil
+func Broadcast(txBytes []byte, rebuild RebuildFunc) (TrackedTx, error) {
+	return broadcast(txBytes, rebuild, 1)
+}
+
+func broadcast(txBytes []byte, rebuild RebuildFunc, attempt int) (TrackedTx, error) {
+	rsp, err := grpc.BroadcastTx(txBytes, txv1beta1.BroadcastMode_BROADCAST_MODE_SYNC)
+	if err != nil {
+		return TrackedTx{}, err
+	}
+	txResponse := rsp.GetTxResponse()
+	if txResponse == nil {
+		return TrackedTx{}, errors.New("empty broadcast response")
+	}
+
+	now := time.Now().Unix()
+	entry := &txEntry{
+		tx: TrackedTx{
+			Hash:          txResponse.Txhash,
+			Type:          txType(txBytes),
+			Status:        TX_PENDING,
+			Attempt:       attempt,
+			BroadcastTime: now,
+			UpdateTime:    now,
+		},
+		txBytes: txBytes,
+		rebuild: rebuild,
+		done:    make(chan struct{}),
+	}
+	pruneTrackedTxs()
+	trackedTxs.Store(entry.tx.Hash, entry)
+
+	if txResponse.Code != 0 {
+		// Rejected by the mempool, the tx will never be included
+		entry.update(txResponse)
+		if isOutOfGas(txResponse.Codespace, txResponse.Code) {
+			if replacement, err := entry.resubmit(); err == nil {
+				entry.close(replacement.Hash)
+				return replacement, nil
+			}
+		}
+		entry.close("")
+		rejected := entry.snapshot()
+		return rejected, errors.New(rejected.String())
+	}
+	utils.Logf("tx %v broadcast, waiting to be included", entry.tx.Hash)
+	go entry.watch()
+	return entry.snapshot(), nil
+}
+
+// watch polls the chain until the tx is included or times out. A stuck tx is resubmitted with more gas, and stays
+// pending until either of them is final, as it can still be included before its replacement
+func (e *txEntry) watch() {
+	start := time.Now()
+	resubmitted := false
+	ticker := time.NewTicker(TX_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if e.closed() {
+			// superseded by the tx it replaced
+			return
+		}
+		current := e.snapshot()
+		txResponse, err := grpc.QueryTxResultByHash(current.Hash)
+		if err == nil && txResponse.Height > 0 {
+			e.update(txResponse)
+			if current.ReplacedBy != "" {
+				supersede(current.ReplacedBy, current.Hash)
+			}
+			replacedBy := ""
+			if isOutOfGas(txResponse.Codespace, txResponse.Code) {
+				if replacement, err := e.resubmit(); err == nil {
+					replacedBy = replacement.Hash
+				}
+			}
+			e.close(replacedBy)
+			return
+		}
+
+		if current.ReplacedBy != "" {
+			if replacement, found := GetTrackedTx(current.ReplacedBy); !found || replacement.Final() {
+				e.setStatus(TX_REPLACED, "")
+				e.close(current.ReplacedBy)
+				return
+			}
+		}
+		elapsed := time.Since(start)
+		if elapsed > TX_CONFIRM_TIMEOUT {
+			if current.ReplacedBy != "" {
+				// the replacement has its own timeout
+				e.setStatus(TX_REPLACED, "")
+				e.close(current.ReplacedBy)
+				return
+			}
+			e.setStatus(TX_TIMEOUT, "not included after "+TX_CONFIRM_TIMEOUT.String())
+			e.close("")
+			return
+		}
+		if elapsed > TX_STUCK_TIMEOUT && !resubmitted {
+			resubmitted = true
+			// The mempool refuses the replacement while it still holds this tx, so keep waiting for it in that case
+			if replacement, err := e.resubmit(); err == nil {
+				e.setReplacedBy(replacement.Hash)
+			}
+		}
+	}
+}
+
+// supersede fails a replacement tx, and the ones replacing it, once the tx it replaced was included
+func supersede(hash, includedHash string) {
+	value, found := trackedTxs.Load(hash)
+	if !found {
+		return
+	}
+	entry := value.(*txEntry)
+	if entry.closed() {
+		return
+	}
+	replacedBy := entry.snapshot().ReplacedBy
+	entry.setStatus(TX_FAILED, "tx "+includedHash+" was included first")
+	entry.close("")
+	if replacedBy != "" {
+		supersede(replacedBy, includedHash)
+	}
+}
+
+// resubmit builds the tx again with more gas and fee, and broadcasts it
+func (e *txEntry) resubmit() (TrackedTx, error) {
+	current := e.snapshot()
+	if e.rebuild == nil {
+		return TrackedTx{}, errors.New("the tx can't be rebuilt")
+	}
+	if current.Attempt > TX_MAX_RESUBMITS {
+		return TrackedTx{}, errors.New("too many resubmits")
+	}
+	txFee, err := bumpTxFee(e.txBytes)
+	if err != nil {
+		return TrackedTx{}, err
+	}
+	txBytes, err := e.rebuild(txFee)
+	if err != nil {
+		utils.ErrorLogf("failed rebuilding tx %v: %v", current.Hash, err)
+		return TrackedTx{}, err
+	}
+	replacement, err := broadcast(txBytes, e.rebuild, current.Attempt+1)
+	if err != nil {
+		utils.ErrorLogf("failed resubmitting tx %v: %v", current.Hash, err)
+		return TrackedTx{}, err
+	}
+	utils.Logf("tx %v resubmitted as %v with gas %v", current.Hash, replacement.Hash, txFee.Gas)
+	return replacement, nil
+}
+
+func (e *txEntry) update(txResponse *abciv1beta1.TxResponse) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.tx.Height = txResponse.Height
+	e.tx.GasWanted = txResponse.GasWanted
+	e.tx.GasUsed = txResponse.GasUsed
+	e.tx.Code = txResponse.Code
+	e.tx.Codespace = txResponse.Codespace
+	e.tx.Error = decodeAbciError(txResponse.Codespace, txResponse.Code, txResponse.RawLog)
+	e.tx.Status = TX_INCLUDED
+	if txResponse.Code != 0 {
+		e.tx.Status = TX_FAILED
+	}
+	e.tx.UpdateTime = time.Now().Unix()
+}
+
+func (e *txEntry) setStatus(status, errMsg string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.tx.Status = status
+	e.tx.Error = errMsg
+	e.tx.UpdateTime = time.Now().Unix()
+}
+
+// setReplacedBy records the replacement of a tx that is still pending
+func (e *txEntry) setReplacedBy(hash string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.tx.ReplacedBy = hash
+	e.tx.UpdateTime = time.Now().Unix()
+}
+
+// close marks the tx as final. The waiters follow replacedBy when it is set. A tx is only closed once
+func (e *txEntry) close(replacedBy string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.isClosed {
+		return
+	}
+	e.isClosed = true
+	e.tx.ReplacedBy = replacedBy
+	close(e.done)
+}
+
+func (e *txEntry) closed() bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.isClosed
+}
+
+func (e *txEntry) snapshot() TrackedTx {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.tx
+}
+
+// BroadcastAndWait broadcasts a tx, and waits for it to be included at most for the given duration. A tx that failed
+// is returned with an error
+func BroadcastAndWait(ctx context.Context, txBytes []byte, rebuild RebuildFunc, wait time.Duration) (TrackedTx, error) {
+	trackedTx, err := Broadcast(txBytes, rebuild)
+	if err != nil {
+		return trackedTx, err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	if latest, err := Wait(waitCtx, trackedTx.Hash); latest.Hash != "" {
+		trackedTx = latest
+	} else if err != nil {
+		return trackedTx, err
+	}
+	if trackedTx.Final() && trackedTx.Status != TX_INCLUDED {
+		return trackedTx, errors.New(trackedTx.String())
+	}
+	return trackedTx, nil
+}
+
+// Wait waits until a tx, or the tx that replaced it, is final. The last known state is returned when ctx is done first
+func Wait(ctx context.Context, hash string) (TrackedTx, error) {
+	for {
+		value, found := trackedTxs.Load(hash)
+		if !found {
+			return TrackedTx{}, errors.Errorf("unknown tx %v", hash)
+		}
+		entry := value.(*txEntry)
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return entry.snapshot(), ctx.Err()
+		}
+		tracked := entry.snapshot()
+		if tracked.ReplacedBy == "" {
+			return tracked, nil
+		}
+		hash = tracked.ReplacedBy
+	}
+}
+
+// GetTrackedTx returns the state of a tx broadcast by the node
+func GetTrackedTx(hash string) (TrackedTx, bool) {
+	value, found := trackedTxs.Load(hash)
+	if !found {
+		return TrackedTx{}, false
+	}
+	return value.(*txEntry).snapshot(), true
+}
+
+// GetTrackedTxs returns the txs broadcast by the node recently, the latest first
+func GetTrackedTxs() []TrackedTx {
+	var txs []TrackedTx
+	trackedTxs.Range(func(_, value any) bool {
+		txs = append(txs, value.(*txEntry).snapshot())
+		return true
+	})
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].BroadcastTime > txs[j].BroadcastTime
+	})
+	return txs
+}
+
+func pruneTrackedTxs() {
+	expiry := time.Now().Add(-TX_HISTORY_TTL).Unix()
+	trackedTxs.Range(func(key, value any) bool {
+		tracked := value.(*txEntry).snapshot()
+		if tracked.Final() && tracked.UpdateTime < expiry {
+			trackedTxs.Delete(key)
+		}
+		return true
+	})
+}
+
+func decodeTx(txBytes []byte) (*txv1beta1.TxBody, *txv1beta1.AuthInfo, error) {
+	txRaw := &txv1beta1.TxRaw{}
+	if err := proto.Unmarshal(txBytes, txRaw); err != nil {
+		return nil, nil, err
+	}
+	body := &txv1beta1.TxBody{}
+	if err := proto.Unmarshal(txRaw.BodyBytes, body); err != nil {
+		return nil, nil, err
+	}
+	authInfo := &txv1beta1.AuthInfo{}
+	if err := proto.Unmarshal(txRaw.AuthInfoBytes, authInfo); err != nil {
+		return nil, nil, err
+	}
+	return body, authInfo, nil
+}
+
+func txType(txBytes []byte) string {
+	body, _, err := decodeTx(txBytes)
+	if err != nil || len(body.Messages) == 0 {
+		return ""
+	}
+	return body.Messages[0].TypeUrl
+}
+
+// bumpTxFee returns the gas and fee of a tx, increased to resubmit it
+func bumpTxFee(txBytes []byte) (txclienttypes.TxFee, error) {
+	_, authInfo, err := decodeTx(txBytes)
+	if err != nil {
+		return txclienttypes.TxFee{}, err
+	}
+	fee := authInfo.GetFee()
+	if fee == nil || len(fee.Amount) == 0 {
+		return txclienttypes.TxFee{}, errors.New("the tx has no fee")
+	}
+	amount, ok := sdkmath.NewIntFromString(fee.Amount[0].Amount)
+	if !ok {
+		return txclienttypes.TxFee{}, errors.Errorf("invalid fee amount %v", fee.Amount[0].Amount)
+	}
+	return txclienttypes.TxFee{
+		Fee: txclienttypes.Coin{
+			Denom:  fee.Amount[0].Denom,
+			Amount: amount.MulRaw(gasBumpNumerator).QuoRaw(gasBumpDenominator),
+		},
+		Gas: fee.GasLimit * gasBumpNumerator / gasBumpDenominator,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package tx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	basev1beta1 "cosmossdk.io/api/cosmos/base/v1beta1"
+	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestBumpTxFee(t *testing.T) {
+	authInfo, err := proto.Marshal(&txv1beta1.AuthInfo{Fee: &txv1beta1.Fee{
+		Amount:   []*basev1beta1.Coin{{Denom: "wei", Amount: "1000"}},
+		GasLimit: 200000,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txBytes, err := proto.Marshal(&txv1beta1.TxRaw{AuthInfoBytes: authInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txFee, err := bumpTxFee(txBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txFee.Gas != 300000 || txFee.Fee.Denom != "wei" || txFee.Fee.Amount.Int64() != 1500 || txFee.Simulate {
+		t.Fatalf("the gas and fee should be increased by half, got %v %v", txFee.Gas, txFee.Fee)
+	}
+}
+
+func TestDecodeAbciError(t *testing.T) {
+	if msg := decodeAbciError("sdk", 0, "ok"); msg != "" {
+		t.Fatalf("a successful tx has no error, got %v", msg)
+	}
+	if msg := decodeAbciError("sdk", 11, "out of gas in location: WriteFlat"); msg != "out of gas: out of gas in location: WriteFlat" {
+		t.Fatalf("unexpected error %v", msg)
+	}
+	if msg := decodeAbciError("register", 5, ""); msg != "register error 5" {
+		t.Fatalf("unexpected error %v", msg)
+	}
+	if !isOutOfGas("sdk", 11) || isOutOfGas("register", 11) {
+		t.Fatal("only the sdk code 11 is out of gas")
+	}
+}
+
+func TestWaitReplacement(t *testing.T) {
+	first := &txEntry{tx: TrackedTx{Hash: "first", Status: TX_PENDING}, done: make(chan struct{})}
+	second := &txEntry{tx: TrackedTx{Hash: "second", Status: TX_PENDING}, done: make(chan struct{})}
+	trackedTxs.Store(first.tx.Hash, first)
+	trackedTxs.Store(second.tx.Hash, second)
+	defer trackedTxs.Delete(first.tx.Hash)
+	defer trackedTxs.Delete(second.tx.Hash)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if tracked, err := Wait(ctx, "first"); err == nil || tracked.Status != TX_PENDING {
+		t.Fatalf("a pending tx should be returned when the wait times out, got %v %v", tracked, err)
+	}
+
+	first.setStatus(TX_REPLACED, "")
+	first.close("second")
+	second.setStatus(TX_INCLUDED, "")
+	second.close("")
+	tracked, err := Wait(context.Background(), "first")
+	if err != nil || tracked.Hash != "second" || tracked.Status != TX_INCLUDED {
+		t.Fatalf("the replacement should be waited for, got %v %v", tracked, err)
+	}
+}
+
+func TestSupersede(t *testing.T) {
+	second := &txEntry{tx: TrackedTx{Hash: "second", Status: TX_PENDING, ReplacedBy: "third"}, done: make(chan struct{})}
+	third := &txEntry{tx: TrackedTx{Hash: "third", Status: TX_PENDING}, done: make(chan struct{})}
+	trackedTxs.Store(second.tx.Hash, second)
+	trackedTxs.Store(third.tx.Hash, third)
+	defer trackedTxs.Delete(second.tx.Hash)
+	defer trackedTxs.Delete(third.tx.Hash)
+
+	// the first tx was included while its replacements were pending
+	supersede("second", "first")
+	for _, entry := range []*txEntry{second, third} {
+		tracked := entry.snapshot()
+		if !entry.closed() || tracked.Status != TX_FAILED || tracked.ReplacedBy != "" {
+			t.Fatalf("the replacements of an included tx should fail, got %v", tracked)
+		}
+	}
+	// the watch of a superseded tx may close it again
+	second.close("")
+}
@@ -0,0 +1,307 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+const (
+	DELIVERY_TIMEOUT = 10 * time.Second
+	RETRY_INTERVAL   = 5 * time.Second // doubled after each failed attempt
+
+	HEADER_SIGNATURE = "X-Sds-Signature"
+	HEADER_TIMESTAMP = "X-Sds-Timestamp"
+	HEADER_EVENT     = "X-Sds-Event"
+	HEADER_DELIVERY  = "X-Sds-Delivery"
+
+	DELIVERY_SUCCEEDED = "succeeded"
+	DELIVERY_RETRYING  = "retrying"
+	DELIVERY_FAILED    = "failed"
+
+	deliveryWorkers = 4
+	deliveryQueue   = 256
+	// maxDeliveryLog is the number of delivery attempts kept in the log
+	maxDeliveryLog = 500
+	// maxResponseBody is the part of the response of a webhook read to report an error
+	maxResponseBody = 256
+)
+
+// Delivery is an attempt to notify a webhook of an event
+type Delivery struct {
+	Id         string `json:"id"`
+	WebhookId  string `json:"webhook_id"`
+	EventId    string `json:"event_id"`
+	EventType  string `json:"event_type"`
+	Attempt    int    `json:"attempt"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Time       int64  `json:"time"`
+}
+
+type delivery struct {
+	webhook Webhook
+	event   Event
+	body    []byte
+	attempt int
+}
+
+// Notifier sends the events to the webhooks of a store. Failed deliveries are retried with an exponential backoff
+type Notifier struct {
+	store         *Store
+	nodeAddress   string // P2P address of the node, sent with the events
+	maxAttempts   int
+	retryInterval time.Duration
+	queue         chan *delivery
+	ctx           context.Context
+	cancel        context.CancelFunc
+
+	logMtx sync.Mutex
+	log    []Delivery
+
+	// key: unix socket path, value: *http.Client
+	unixClients *sync.Map
+	httpClient  *http.Client
+}
+
+func NewNotifier(store *Store, nodeAddress string, maxAttempts int, retryInterval time.Duration) *Notifier {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		store:         store,
+		nodeAddress:   nodeAddress,
+		maxAttempts:   maxAttempts,
+		retryInterval: retryInterval,
+		queue:         make(chan *delivery, deliveryQueue),
+		ctx:           ctx,
+		cancel:        cancel,
+		unixClients:   &sync.Map{},
+		httpClient:    &http.Client{Timeout: DELIVERY_TIMEOUT},
+	}
+	for i := 0; i < deliveryWorkers; i++ {
+		go n.work()
+	}
+	return n
+}
+
+// NewEvent creates an event of the node
+func (n *Notifier) NewEvent(eventType string, data any) Event {
+	return Event{
+		Id:   uuid.New().String(),
+		Type: eventType,
+		Time: time.Now().Unix(),
+		Node: n.nodeAddress,
+		Data: data,
+	}
+}
+
+// Stop drops the pending deliveries
+func (n *Notifier) Stop() {
+	n.cancel()
+}
+
+// Notify sends the event to the webhooks subscribed to it
+func (n *Notifier) Notify(event Event) {
+	webhooks, err := n.store.List()
+	if err != nil {
+		utils.ErrorLog("couldn't load the webhooks", err)
+		return
+	}
+	var body []byte
+	for _, w := range webhooks {
+		if !w.Accepts(event.Type) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(event); err != nil {
+				utils.ErrorLogf("couldn't encode the %v event: %v", event.Type, err)
+				return
+			}
+		}
+		n.enqueue(&delivery{webhook: w, event: event, body: body, attempt: 1})
+	}
+}
+
+// NotifyWebhook sends the event to one webhook, even if it isn't subscribed to it
+func (n *Notifier) NotifyWebhook(id string, event Event) error {
+	webhooks, err := n.store.List()
+	if err != nil {
+		return err
+	}
+	for _, w := range webhooks {
+		if w.Id != id {
+			continue
+		}
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		n.enqueue(&delivery{webhook: w, event: event, body: body, attempt: 1})
+		return nil
+	}
+	return errors.Errorf("webhook %v not found", id)
+}
+
+func (n *Notifier) enqueue(d *delivery) {
+	if n.ctx.Err() != nil {
+		return
+	}
+	select {
+	case n.queue <- d:
+	default:
+		n.record(d, DELIVERY_FAILED, 0, errors.New("too many pending notifications"))
+	}
+}
+
+func (n *Notifier) work() {
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case d := <-n.queue:
+			n.deliver(d)
+		}
+	}
+}
+
+func (n *Notifier) deliver(d *delivery) {
+	statusCode, err := n.send(d)
+	if err == nil {
+		n.record(d, DELIVERY_SUCCEEDED, statusCode, nil)
+		return
+	}
+	if d.attempt >= n.maxAttempts {
+		n.record(d, DELIVERY_FAILED, statusCode, err)
+		utils.ErrorLogf("couldn't notify webhook %v of the %v event after %v attempts: %v", d.webhook.Url, d.event.Type, d.attempt, err)
+		return
+	}
+	n.record(d, DELIVERY_RETRYING, statusCode, err)
+	retry := &delivery{webhook: d.webhook, event: d.event, body: d.body, attempt: d.attempt + 1}
+	time.AfterFunc(n.retryInterval*time.Duration(1<<(d.attempt-1)), func() {
+		n.enqueue(retry)
+	})
+}
+
+// send posts the event to the webhook. Any status other than 2xx is a failure
+func (n *Notifier) send(d *delivery) (int, error) {
+	client, target, err := n.client(d.webhook.Url)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(n.ctx, DELIVERY_TIMEOUT)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(d.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HEADER_EVENT, d.event.Type)
+	req.Header.Set(HEADER_DELIVERY, d.event.Id)
+	req.Header.Set(HEADER_TIMESTAMP, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HEADER_SIGNATURE, Sign(d.webhook.Secret, timestamp, d.body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		return resp.StatusCode, errors.Errorf("the webhook answered %v %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// client returns the http client reaching a webhook, and the url to post to
+func (n *Notifier) client(rawUrl string) (*http.Client, string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "invalid webhook url")
+	}
+	if u.Scheme != "unix" {
+		return n.httpClient, rawUrl, nil
+	}
+
+	socketPath := u.Path
+	if c, ok := n.unixClients.Load(socketPath); ok {
+		return c.(*http.Client), "http://unix/", nil
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	c, _ := n.unixClients.LoadOrStore(socketPath, &http.Client{Transport: transport, Timeout: DELIVERY_TIMEOUT})
+	return c.(*http.Client), "http://unix/", nil
+}
+
+func (n *Notifier) record(d *delivery, status string, statusCode int, err error) {
+	entry := Delivery{
+		Id:         uuid.New().String(),
+		WebhookId:  d.webhook.Id,
+		EventId:    d.event.Id,
+		EventType:  d.event.Type,
+		Attempt:    d.attempt,
+		Status:     status,
+		StatusCode: statusCode,
+		Time:       time.Now().Unix(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	n.logMtx.Lock()
+	defer n.logMtx.Unlock()
+	n.log = append(n.log, entry)
+	if len(n.log) > maxDeliveryLog {
+		n.log = append([]Delivery(nil), n.log[len(n.log)-maxDeliveryLog:]...)
+	}
+}
+
+// Deliveries returns up to limit delivery attempts, the most recent first. All the webhooks are included when
+// webhookId is empty, and a limit of 0 returns the whole log
+func (n *Notifier) Deliveries(webhookId string, limit int) []Delivery {
+	n.logMtx.Lock()
+	defer n.logMtx.Unlock()
+	result := make([]Delivery, 0)
+	for i := len(n.log) - 1; i >= 0; i-- {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		if webhookId == "" || n.log[i].WebhookId == webhookId {
+			result = append(result, n.log[i])
+		}
+	}
+	return result
+}
+
+// Sign returns the signature of a notification, sent in the X-Sds-Signature header. Receivers recompute it with the
+// secret of the webhook, and reject the notifications whose timestamp is too old
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
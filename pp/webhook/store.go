@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+const (
+	webhookFile       = "webhooks.json"
+	webhookSecretSize = 32
+)
+
+// Webhook is an endpoint notified of the events of the node. The url is either a http(s) url, or the path of a Unix
+// socket served over HTTP (eg: "unix:///run/myapp.sock")
+type Webhook struct {
+	Id        string   `json:"id"`
+	Url       string   `json:"url"`
+	Events    []string `json:"events"` // all the events when empty
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+// Accepts returns true if the webhook is subscribed to the event
+func (w *Webhook) Accepts(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Store keeps the webhooks in a JSON file, reloaded whenever it changes
+type Store struct {
+	path     string
+	mtx      sync.Mutex
+	modTime  time.Time
+	webhooks []Webhook
+}
+
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// DefaultStorePath is the webhook file of the node, next to its keys
+func DefaultStorePath() string {
+	return filepath.Join(setting.Config.Home.AccountsPath, webhookFile)
+}
+
+// load returns the webhooks of the file, reading it again only if it was modified. The caller holds the lock
+func (s *Store) load() ([]Webhook, error) {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.webhooks, s.modTime = nil, time.Time{}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't stat the webhook file")
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return s.webhooks, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read the webhook file")
+	}
+	var webhooks []Webhook
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &webhooks); err != nil {
+			return nil, errors.Wrap(err, "couldn't parse the webhook file")
+		}
+	}
+	s.webhooks, s.modTime = webhooks, info.ModTime()
+	return webhooks, nil
+}
+
+// save replaces the content of the webhook file. The caller holds the lock
+func (s *Store) save(webhooks []Webhook) error {
+	data, err := json.MarshalIndent(webhooks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return errors.Wrap(err, "couldn't create the webhook folder")
+	}
+	tmpPath := s.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.Wrap(err, "couldn't write the webhook file")
+	}
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "couldn't write the webhook file")
+	}
+	s.modTime = time.Time{}
+	return nil
+}
+
+// List returns the webhooks sorted by creation time
+func (s *Store) List() ([]Webhook, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	webhooks, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	result := append([]Webhook(nil), webhooks...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt < result[j].CreatedAt
+	})
+	return result, nil
+}
+
+// Add registers a webhook. A secret is generated when none is given
+func (s *Store) Add(rawUrl string, events []string, secret string) (Webhook, error) {
+	if err := ValidateUrl(rawUrl); err != nil {
+		return Webhook{}, err
+	}
+	for _, e := range events {
+		if !IsEvent(e) {
+			return Webhook{}, errors.Errorf("unknown event %v", e)
+		}
+	}
+	if secret == "" {
+		b := make([]byte, webhookSecretSize)
+		if _, err := rand.Read(b); err != nil {
+			return Webhook{}, errors.Wrap(err, "couldn't generate the webhook secret")
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	webhooks, err := s.load()
+	if err != nil {
+		return Webhook{}, err
+	}
+	webhook := Webhook{
+		Id:        uuid.New().String(),
+		Url:       rawUrl,
+		Events:    events,
+		Secret:    secret,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err = s.save(append(append([]Webhook(nil), webhooks...), webhook)); err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// Remove deletes a webhook
+func (s *Store) Remove(id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	webhooks, err := s.load()
+	if err != nil {
+		return err
+	}
+	var result []Webhook
+	for _, w := range webhooks {
+		if w.Id != id {
+			result = append(result, w)
+		}
+	}
+	if len(result) == len(webhooks) {
+		return errors.Errorf("webhook %v not found", id)
+	}
+	return s.save(result)
+}
+
+// ValidateUrl checks that a webhook url can be notified
+func ValidateUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return errors.Wrap(err, "invalid webhook url")
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return errors.New("the webhook url has no host")
+		}
+	case "unix":
+		if u.Path == "" {
+			return errors.New("the webhook url has no socket path")
+		}
+	default:
+		return errors.New("the webhook url should start with http://, https:// or unix://")
+	}
+	return nil
+}
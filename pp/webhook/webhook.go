@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/pp/setting"
+)
+
+const (
+	EVENT_UPLOAD_COMPLETE    = "upload.complete"
+	EVENT_UPLOAD_FAILED      = "upload.failed"
+	EVENT_DOWNLOAD_COMPLETE  = "download.complete"
+	EVENT_DOWNLOAD_FAILED    = "download.failed"
+	EVENT_SHARE_EXPIRED      = "share.expired"
+	EVENT_NODE_STATE_CHANGED = "node.state_changed"
+	EVENT_NODE_SUSPENDED     = "node.suspended"
+	EVENT_NODE_MAINTENANCE   = "node.maintenance"
+	EVENT_OZONE_LOW          = "ozone.low"
+	// EVENT_PING is only sent by Test, to check that a webhook is reachable
+	EVENT_PING = "ping"
+
+	// names of the states of the node state machine, in pp/network
+	stateSuspended   = "STATE_SUSPENDED"
+	stateMaintenance = "STATE_MAINTANENCE"
+)
+
+var Events = []string{
+	EVENT_UPLOAD_COMPLETE,
+	EVENT_UPLOAD_FAILED,
+	EVENT_DOWNLOAD_COMPLETE,
+	EVENT_DOWNLOAD_FAILED,
+	EVENT_SHARE_EXPIRED,
+	EVENT_NODE_STATE_CHANGED,
+	EVENT_NODE_SUSPENDED,
+	EVENT_NODE_MAINTENANCE,
+	EVENT_OZONE_LOW,
+}
+
+var errNotStarted = errors.New("the webhook notifications are not started")
+
+var (
+	notifier    *Notifier
+	notifierMtx sync.Mutex
+)
+
+// Event is the body of the notifications posted to the webhooks
+type Event struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Time int64  `json:"time"`
+	Node string `json:"node"` // P2P address of the node
+	Data any    `json:"data,omitempty"`
+}
+
+type FileEvent struct {
+	FileHash string `json:"file_hash"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ShareEvent is an expired share link of the wallet
+type ShareEvent struct {
+	ShareId   string `json:"share_id"`
+	ShareLink string `json:"share_link"`
+	FileHash  string `json:"file_hash"`
+	FileName  string `json:"file_name"`
+	ExpTime   int64  `json:"exp_time"`
+}
+
+type StateChange struct {
+	Time  int64  `json:"time"`
+	Event string `json:"event"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Cause string `json:"cause"`
+}
+
+type OzoneEvent struct {
+	WalletAddress string `json:"wallet_address"`
+	Ozone         string `json:"ozone"`
+	Threshold     uint64 `json:"threshold"`
+}
+
+// IsEvent returns true if webhooks can subscribe to the event
+func IsEvent(eventType string) bool {
+	for _, e := range Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Init starts notifying the webhooks registered in the node home
+func Init() error {
+	n := NewNotifier(NewStore(DefaultStorePath()), setting.Config.Keys.P2PAddress, setting.Config.Webhook.MaxAttempts, RETRY_INTERVAL)
+	if _, err := n.store.List(); err != nil {
+		n.Stop()
+		return err
+	}
+	notifierMtx.Lock()
+	defer notifierMtx.Unlock()
+	if notifier != nil {
+		notifier.Stop()
+	}
+	notifier = n
+	return nil
+}
+
+func Stop() {
+	notifierMtx.Lock()
+	defer notifierMtx.Unlock()
+	if notifier != nil {
+		notifier.Stop()
+		notifier = nil
+	}
+}
+
+func getNotifier() *Notifier {
+	notifierMtx.Lock()
+	defer notifierMtx.Unlock()
+	return notifier
+}
+
+// Publish notifies the webhooks subscribed to the event. It never blocks the caller
+func Publish(eventType string, data any) {
+	if n := getNotifier(); n != nil {
+		n.Notify(n.NewEvent(eventType, data))
+	}
+}
+
+// Subscribed returns true when a webhook accepts the event, so that it is worth looking for
+func Subscribed(eventType string) bool {
+	n := getNotifier()
+	if n == nil {
+		return false
+	}
+	webhooks, err := n.store.List()
+	if err != nil {
+		return false
+	}
+	for _, w := range webhooks {
+		if w.Accepts(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// PublishStateChange notifies a change of state of the node, and its suspension or maintenance
+func PublishStateChange(change StateChange) {
+	Publish(EVENT_NODE_STATE_CHANGED, change)
+	switch {
+	case change.To == stateSuspended:
+		Publish(EVENT_NODE_SUSPENDED, change)
+	case change.To == stateMaintenance || change.From == stateMaintenance:
+		Publish(EVENT_NODE_MAINTENANCE, change)
+	}
+}
+
+func Add(rawUrl string, events []string, secret string) (Webhook, error) {
+	n := getNotifier()
+	if n == nil {
+		return Webhook{}, errNotStarted
+	}
+	return n.store.Add(rawUrl, events, secret)
+}
+
+func Remove(id string) error {
+	n := getNotifier()
+	if n == nil {
+		return errNotStarted
+	}
+	return n.store.Remove(id)
+}
+
+// List returns the webhooks, without their secrets
+func List() ([]Webhook, error) {
+	n := getNotifier()
+	if n == nil {
+		return nil, errNotStarted
+	}
+	webhooks, err := n.store.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// Test sends a ping event to a webhook. The result shows up in the delivery log
+func Test(id string) error {
+	n := getNotifier()
+	if n == nil {
+		return errNotStarted
+	}
+	return n.NotifyWebhook(id, n.NewEvent(EVENT_PING, nil))
+}
+
+// Deliveries returns up to limit delivery attempts, the most recent first
+func Deliveries(webhookId string, limit int) []Delivery {
+	if n := getNotifier(); n != nil {
+		return n.Deliveries(webhookId, limit)
+	}
+	return []Delivery{}
+}
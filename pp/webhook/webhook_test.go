@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitDeliveries waits until the log holds count delivery attempts
+func waitDeliveries(t *testing.T, n *Notifier, count int) []Delivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if deliveries := n.Deliveries("", 0); len(deliveries) >= count {
+			return deliveries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %v delivery attempts, got %v", count, len(n.Deliveries("", 0)))
+	return nil
+}
+
+func TestNotifyRetry(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := atomic.AddInt32(&requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HEADER_TIMESTAMP), 10, 64)
+		if r.Header.Get(HEADER_SIGNATURE) != Sign("secret", timestamp, body) {
+			t.Error("the signature should match the body")
+		}
+		if r.Header.Get(HEADER_EVENT) != EVENT_UPLOAD_COMPLETE {
+			t.Errorf("unexpected event %v", r.Header.Get(HEADER_EVENT))
+		}
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	store := NewStore(filepath.Join(t.TempDir(), webhookFile))
+	webhook, err := store.Add(server.URL, []string{EVENT_UPLOAD_COMPLETE}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Add(server.URL, []string{"upload.unknown"}, ""); err == nil {
+		t.Fatal("an unknown event should be rejected")
+	}
+	n := NewNotifier(store, "", 3, 10*time.Millisecond)
+	defer n.Stop()
+
+	n.Notify(n.NewEvent(EVENT_DOWNLOAD_COMPLETE, nil))
+	n.Notify(n.NewEvent(EVENT_UPLOAD_COMPLETE, FileEvent{FileHash: "v05ahm51atjqkpte7gnqa94bhgpfpe4c6lkq0jh8"}))
+	deliveries := waitDeliveries(t, n, 2)
+	if len(deliveries) != 2 || atomic.LoadInt32(&requests) != 2 {
+		t.Fatalf("only the subscribed event should be sent, got %v attempts and %v requests", len(deliveries), atomic.LoadInt32(&requests))
+	}
+	if d := deliveries[1]; d.Status != DELIVERY_RETRYING || d.StatusCode != http.StatusServiceUnavailable || d.Attempt != 1 {
+		t.Fatalf("the first attempt should fail, got %+v", d)
+	}
+	if d := deliveries[0]; d.Status != DELIVERY_SUCCEEDED || d.Attempt != 2 || d.WebhookId != webhook.Id {
+		t.Fatalf("the second attempt should succeed, got %+v", d)
+	}
+}
+
+func TestNotifyUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "webhook.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(HEADER_EVENT)
+	})}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	store := NewStore(filepath.Join(t.TempDir(), webhookFile))
+	webhook, err := store.Add("unix://"+socketPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewNotifier(store, "", 1, time.Millisecond)
+	defer n.Stop()
+
+	if err = n.NotifyWebhook(webhook.Id, n.NewEvent(EVENT_PING, nil)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case eventType := <-received:
+		if eventType != EVENT_PING {
+			t.Fatalf("unexpected event %v", eventType)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the unix socket listener wasn't notified")
+	}
+	if d := waitDeliveries(t, n, 1)[0]; d.Status != DELIVERY_SUCCEEDED {
+		t.Fatalf("the delivery should succeed, got %+v", d)
+	}
+}
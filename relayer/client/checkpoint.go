@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+
+	"github.com/stratosnet/sds/relayer/stratoschain"
+)
+
+const (
+	backfillBatchSize     = 100
+	backfillRetryInterval = 5 * time.Second
+)
+
+// heightRange is an inclusive range of block heights
+type heightRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type checkpointData struct {
+	Height int64         `json:"height"` // last block whose events were all received from the websocket
+	Gaps   []heightRange `json:"gaps,omitempty"`
+}
+
+// blockCheckpoint persists the last block height processed by relayd, along with the ranges of blocks
+// that were missed while the websocket was down. The missed blocks are backfilled by querying their txs
+type blockCheckpoint struct {
+	path string
+
+	mtx          sync.Mutex
+	data         checkpointData
+	needBackfill bool
+	backfilling  bool
+}
+
+func loadBlockCheckpoint(path string) (*blockCheckpoint, error) {
+	c := &blockCheckpoint{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read block checkpoint")
+	}
+	if err = json.Unmarshal(data, &c.data); err != nil {
+		return nil, errors.Wrap(err, "invalid block checkpoint file")
+	}
+	utils.Logf("Last block processed by relayd: %v (%v ranges of blocks to backfill)", c.data.Height, len(c.data.Gaps))
+	return c, nil
+}
+
+// markMissed is called when events might have been missed. The gap is computed on the next new block
+func (c *blockCheckpoint) markMissed() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.needBackfill = true
+}
+
+// newBlock records that all the events up to the block before height were processed.
+// It returns true if there are blocks to backfill and no backfill is running yet
+func (c *blockCheckpoint) newBlock(height int64) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	processed := height - 1
+	if c.needBackfill {
+		c.needBackfill = false
+		if c.data.Height > 0 && processed > c.data.Height {
+			c.data.Gaps = append(c.data.Gaps, heightRange{From: c.data.Height + 1, To: processed})
+			utils.Logf("Blocks %v to %v were missed by relayd, backfilling them", c.data.Height+1, processed)
+		}
+	}
+	if processed > c.data.Height {
+		c.data.Height = processed
+		if err := c.save(); err != nil {
+			utils.ErrorLogf("couldn't save block checkpoint: %v", err)
+		}
+	}
+
+	if c.backfilling || len(c.data.Gaps) == 0 {
+		return false
+	}
+	c.backfilling = true
+	return true
+}
+
+// backfill syncs the missed blocks until there is no gap left or ctx is cancelled
+func (c *blockCheckpoint) backfill(ctx context.Context) {
+	for {
+		c.mtx.Lock()
+		if len(c.data.Gaps) == 0 || ctx.Err() != nil {
+			c.backfilling = false
+			c.mtx.Unlock()
+			return
+		}
+		gap := c.data.Gaps[0]
+		c.mtx.Unlock()
+
+		to := gap.From + backfillBatchSize - 1
+		if to > gap.To {
+			to = gap.To
+		}
+		lastHeight, err := stratoschain.SyncBlocks(ctx, gap.From, to)
+		c.backfilled(gap, lastHeight)
+		if err != nil {
+			utils.ErrorLogf("Failed backfilling block %v: %v", lastHeight+1, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backfillRetryInterval):
+			}
+		}
+	}
+}
+
+func (c *blockCheckpoint) backfilled(gap heightRange, lastHeight int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if lastHeight < gap.From || len(c.data.Gaps) == 0 {
+		return
+	}
+	if lastHeight >= gap.To {
+		c.data.Gaps = c.data.Gaps[1:]
+		utils.Logf("Finished backfilling blocks %v to %v", gap.From, gap.To)
+	} else {
+		c.data.Gaps[0].From = lastHeight + 1
+	}
+	if err := c.save(); err != nil {
+		utils.ErrorLogf("couldn't save block checkpoint: %v", err)
+	}
+}
+
+func (c *blockCheckpoint) save() error {
+	data, err := json.Marshal(c.data)
+	if err != nil {
+		return err
+	}
+	tmpPath := c.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path)
+}
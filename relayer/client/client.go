@@ -5,13 +5,21 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
 	fwtypes "github.com/stratosnet/sds/framework/types"
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/tx-client/grpc"
 
+	"github.com/stratosnet/sds/relayer/client/txqueue"
 	"github.com/stratosnet/sds/relayer/cmd/relayd/setting"
+	"github.com/stratosnet/sds/relayer/stratoschain/handlers"
+)
+
+const (
+	txQueueFolder = "tx_queue"
+	outboxFolder  = "outbox"
 )
 
 type MultiClient struct {
@@ -25,6 +33,7 @@ type MultiClient struct {
 	WalletAddress    fwtypes.WalletAddress
 	WalletPrivateKey fwcryptotypes.PrivKey
 	NewBlockChan     chan bool
+	TxQueue          *txqueue.Queue // Msgs from the SP waiting to be broadcast to stratos-chain
 }
 
 // connection is a generic interface for a client connection to an external service (sds or stchain)
@@ -47,6 +56,28 @@ func NewClient(spHomePath string) (*MultiClient, error) {
 	newClient.stchainConn = newStchainConnection(newClient)
 
 	err := newClient.loadKeys(spHomePath)
+	if err != nil {
+		return newClient, err
+	}
+
+	broadcastConfig := setting.Config.StratosChain.Broadcast
+	newClient.TxQueue, err = txqueue.New(
+		filepath.Join(setting.HomePath, txQueueFolder),
+		broadcastConfig.MaxAttempts,
+		time.Duration(broadcastConfig.RetryInterval)*time.Millisecond,
+		time.Duration(broadcastConfig.MaxRetryInterval)*time.Millisecond,
+	)
+	if err != nil {
+		return newClient, err
+	}
+
+	outboxConfig := setting.Config.SDS.Outbox
+	err = handlers.InitOutbox(
+		filepath.Join(setting.HomePath, outboxFolder),
+		outboxConfig.MaxAttempts,
+		time.Duration(outboxConfig.RetryInterval)*time.Millisecond,
+		time.Duration(outboxConfig.MaxRetryInterval)*time.Millisecond,
+	)
 	return newClient, err
 }
 
@@ -70,8 +101,11 @@ func (m *MultiClient) loadKeys(spHomePath string) error {
 
 func (m *MultiClient) Start() error {
 	// GRPC client to send msgs to stratos-chain
-	grpc.SERVER = setting.Config.StratosChain.GrpcServer.GrpcServer
-	grpc.INSECURE = setting.Config.StratosChain.GrpcServer.Insecure
+	grpcConfig := setting.Config.StratosChain.GrpcServer
+	grpc.SetEndpoints(append([]string{grpcConfig.GrpcServer}, grpcConfig.GrpcServers...), grpcConfig.Insecure)
+
+	// Deliver chain events to the SP, including the ones left over from the last run
+	go handlers.RunOutbox(m.Ctx)
 
 	// Start client connections
 	go m.sdsConn.refresh()
@@ -86,5 +120,6 @@ func (m *MultiClient) Stop() {
 		m.cancel()
 		m.sdsConn.stop()
 		m.stchainConn.stop()
+		grpc.CloseConnections()
 	})
 }
@@ -8,6 +8,9 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 
@@ -21,6 +24,7 @@ import (
 	"github.com/stratosnet/sds/tx-client/tx"
 	txclienttypes "github.com/stratosnet/sds/tx-client/types"
 
+	"github.com/stratosnet/sds/relayer/client/txqueue"
 	"github.com/stratosnet/sds/relayer/cmd/relayd/setting"
 	"github.com/stratosnet/sds/relayer/sds"
 	"github.com/stratosnet/sds/relayer/stratoschain"
@@ -211,65 +215,87 @@ func (s *sdsConnection) txBroadcasterLoop() {
 	}()
 
 	s.txBroadcasterChan = make(chan txclienttypes.UnsignedMsg, setting.Config.StratosChain.Broadcast.ChannelSize)
+	txQueue := s.client.TxQueue
 
 	recentBroadcast := false
-	var unsignedMsgs []*txclienttypes.UnsignedMsg
 	broadcastTxs := func() {
-		utils.Logf("Tx broadcaster loop will try to broadcast %v msgs %v", len(unsignedMsgs), countMsgsByType(unsignedMsgs))
+		batch := s.loadQueuedMsgs(txQueue.Ready(setting.Config.StratosChain.Broadcast.MaxMsgPerTx))
+		if len(batch) == 0 {
+			return
+		}
+		utils.Logf("Tx broadcaster loop will try to broadcast %v msgs %v", len(batch), countQueuedMsgsByType(batch))
 		if recentBroadcast {
 			<-s.client.NewBlockChan
 			recentBroadcast = false
 		}
 
-		var unsignedSdkMsgs []*anypb.Any
-		txConfig, unsignedTx := tx.CreateTxConfigAndTxBuilder()
-		for _, unsignedMsg := range unsignedMsgs {
-			unsignedSdkMsgs = append(unsignedSdkMsgs, unsignedMsg.Msg)
+		failAll := func(msgs []*queuedMsg, err error) {
+			for _, msg := range msgs {
+				txQueue.Fail(msg.entry.Id, err)
+			}
 		}
-		defer func() {
-			unsignedMsgs = nil // Clearing msg list
-		}()
 
-		setMsgInfoToTxBuilder(unsignedTx, unsignedSdkMsgs)
-		txBytes, err := tx.BuildTxBytes(txConfig, unsignedTx, setting.Config.BlockchainInfo.ChainId, unsignedMsgs)
-		if err != nil {
-			utils.ErrorLog("couldn't build tx bytes", err)
-			return
+		// The chain being unreachable says nothing about the msgs. Wait for it without counting the attempts
+		chainUnavailable := func(err error) bool {
+			if !isTransportError(err) {
+				return false
+			}
+			utils.ErrorLogf("stratos-chain is unreachable, pausing the tx queue for %v: %v", txQueue.Backoff(), err)
+			return true
 		}
 
-		gasInfo, err := grpc.Simulate(txBytes)
-		if err != nil {
-			utils.ErrorLog("couldn't simulate tx bytes", err)
+		gasUsed, err := simulateMsgs(batch)
+		if chainUnavailable(err) {
 			return
 		}
-		gasLimit := uint64(float64(gasInfo.GasUsed) * setting.Config.BlockchainInfo.Transactions.GasAdjustment)
-		unsignedTx.AuthInfo.Fee.GasLimit = gasLimit
-
-		gasPrice, err := txclienttypes.ParseCoinNormalized(setting.Config.BlockchainInfo.Transactions.GasPrice)
+		if err != nil && len(batch) > 1 {
+			// Take out the msgs failing simulation, so the rest of the batch can still be broadcast
+			utils.ErrorLog("couldn't simulate tx bytes, isolating the failing msgs", err)
+			failed := make(map[*queuedMsg]error)
+			batch, err = isolateFailingMsgs(batch, failed, err)
+			if chainUnavailable(err) {
+				return
+			}
+			for msg, simulateErr := range failed {
+				txQueue.Fail(msg.entry.Id, errors.Wrap(simulateErr, "couldn't simulate tx bytes"))
+			}
+			if len(batch) == 0 {
+				return
+			}
+			utils.Logf("Tx broadcaster loop isolated %v failing msgs, broadcasting the %v remaining msgs", len(failed), len(batch))
+			gasUsed, err = simulateMsgs(batch)
+			if chainUnavailable(err) {
+				return
+			}
+		}
 		if err != nil {
-			utils.ErrorLog("couldn't parse gas price", err)
+			utils.ErrorLog("couldn't simulate tx bytes", err)
+			failAll(batch, errors.Wrap(err, "couldn't simulate tx bytes"))
 			return
 		}
-		feeAmount := gasPrice.Amount.Mul(sdkmath.NewIntFromUint64(gasLimit))
-		fee := txclienttypes.NewCoin(gasPrice.Denom, feeAmount)
-		unsignedTx.AuthInfo.Fee.Amount = []*basev1beta1.Coin{
-			{
-				Denom:  fee.Denom,
-				Amount: fee.Amount.String(),
-			},
-		}
 
-		txBytes, err = tx.BuildTxBytes(txConfig, unsignedTx, setting.Config.BlockchainInfo.ChainId, unsignedMsgs)
+		txBytes, err := buildTxBytesWithFee(batch, gasUsed)
 		if err != nil {
 			utils.ErrorLog("couldn't build tx bytes", err)
+			failAll(batch, err)
 			return
 		}
 
 		err = stratoschain.BroadcastTx(txBytes)
+		if chainUnavailable(err) {
+			return
+		}
 		if err != nil {
 			utils.ErrorLog("couldn't broadcast transaction", err)
+			failAll(batch, errors.Wrap(err, "couldn't broadcast transaction"))
 			return
 		}
+
+		var ids []string
+		for _, msg := range batch {
+			ids = append(ids, msg.entry.Id)
+		}
+		txQueue.Done(ids...)
 		recentBroadcast = true
 	}
 
@@ -286,21 +312,17 @@ func (s *sdsConnection) txBroadcasterLoop() {
 			if msg.Type != types.MSG_TYPE_SLASHING_RESOURCE_NODE { // Not printing slashing messages, since SP can slash up to 500 PPs at once, polluting the logs
 				utils.DebugLogf("Received a new msg of type [%v] to broadcast! ", msg.Type)
 			}
-			for i := range msg.SignatureKeys {
-				// For messages coming from SP, add the wallet private key that was loaded on start-up
-				if len(msg.SignatureKeys[i].PrivateKey) == 0 && msg.SignatureKeys[i].Address == s.client.WalletAddress.String() {
-					msg.SignatureKeys[i].PrivateKey = s.client.WalletPrivateKey.Bytes()
-				}
+			if _, err := txQueue.Add(&msg); err != nil {
+				utils.ErrorLog("couldn't persist msg in the tx queue", err)
 			}
-			unsignedMsgs = append(unsignedMsgs, &msg)
-			if len(unsignedMsgs) >= setting.Config.StratosChain.Broadcast.MaxMsgPerTx {
+			if txQueue.ReadyCount() >= setting.Config.StratosChain.Broadcast.MaxMsgPerTx {
 				// Max broadcast size is reached. Broadcasting now
 				broadcastTxs()
 				timeOver = time.After(txBroadcastMaxInterval * time.Millisecond)
 			}
 		case <-timeOver:
-			// No new messages are waiting to broadcast. Broadcasting existing messages now
-			if len(unsignedMsgs) > 0 {
+			// No new messages are waiting to broadcast. Broadcasting existing messages now, including the ones due for a retry
+			if txQueue.ReadyCount() > 0 {
 				broadcastTxs()
 			}
 			timeOver = time.After(txBroadcastMaxInterval * time.Millisecond)
@@ -308,6 +330,146 @@ func (s *sdsConnection) txBroadcasterLoop() {
 	}
 }
 
+// queuedMsg is a msg from the tx queue, ready to be signed
+type queuedMsg struct {
+	entry *txqueue.Entry
+	msg   *txclienttypes.UnsignedMsg
+}
+
+func (s *sdsConnection) loadQueuedMsgs(entries []*txqueue.Entry) []*queuedMsg {
+	var msgs []*queuedMsg
+	for _, entry := range entries {
+		unsignedMsg, err := entry.Msg.FromBytes()
+		if err != nil {
+			utils.ErrorLog(err)
+			s.client.TxQueue.DeadLetter(entry.Id, err)
+			continue
+		}
+
+		// Copy the signature keys, so that the wallet private key never ends up in the tx queue on disk
+		signatureKeys := make([]*txclienttypes.SignatureKey, 0, len(unsignedMsg.SignatureKeys))
+		for _, signatureKey := range unsignedMsg.SignatureKeys {
+			if signatureKey == nil {
+				continue
+			}
+			keyCopy := *signatureKey
+			// For messages coming from SP, add the wallet private key that was loaded on start-up
+			if len(keyCopy.PrivateKey) == 0 && keyCopy.Address == s.client.WalletAddress.String() {
+				keyCopy.PrivateKey = s.client.WalletPrivateKey.Bytes()
+			}
+			signatureKeys = append(signatureKeys, &keyCopy)
+		}
+		unsignedMsg.SignatureKeys = signatureKeys
+		msgs = append(msgs, &queuedMsg{entry: entry, msg: unsignedMsg})
+	}
+	return msgs
+}
+
+func buildTxBytes(msgs []*queuedMsg, gasLimit uint64, fee []*basev1beta1.Coin) ([]byte, error) {
+	var unsignedMsgs []*txclienttypes.UnsignedMsg
+	var unsignedSdkMsgs []*anypb.Any
+	for _, msg := range msgs {
+		unsignedMsgs = append(unsignedMsgs, msg.msg)
+		unsignedSdkMsgs = append(unsignedSdkMsgs, msg.msg.Msg)
+	}
+
+	txConfig, unsignedTx := tx.CreateTxConfigAndTxBuilder()
+	setMsgInfoToTxBuilder(unsignedTx, unsignedSdkMsgs)
+	unsignedTx.AuthInfo.Fee.GasLimit = gasLimit
+	if fee != nil {
+		unsignedTx.AuthInfo.Fee.Amount = fee
+	}
+	return tx.BuildTxBytes(txConfig, unsignedTx, setting.Config.BlockchainInfo.ChainId, unsignedMsgs)
+}
+
+// simulateMsgs returns the gas used by a tx containing all the given msgs
+func simulateMsgs(msgs []*queuedMsg) (uint64, error) {
+	txBytes, err := buildTxBytes(msgs, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	gasInfo, err := grpc.Simulate(txBytes)
+	if err != nil {
+		return 0, err
+	}
+	return gasInfo.GasUsed, nil
+}
+
+// isolateFailingMsgs bisects a batch of msgs rejected by the simulation, until the failing msgs are isolated.
+// It returns the msgs that can still be broadcast together, and adds the failing ones to the failed map.
+// The bisection stops with an error if stratos-chain becomes unreachable, as the msgs can't be blamed then
+func isolateFailingMsgs(msgs []*queuedMsg, failed map[*queuedMsg]error, cause error) ([]*queuedMsg, error) {
+	return bisectMsgs(msgs, failed, cause, simulateMsgs)
+}
+
+func bisectMsgs(msgs []*queuedMsg, failed map[*queuedMsg]error, cause error, simulate func([]*queuedMsg) (uint64, error)) ([]*queuedMsg, error) {
+	if len(msgs) == 1 {
+		failed[msgs[0]] = cause
+		return nil, nil
+	}
+
+	var valid []*queuedMsg
+	mid := len(msgs) / 2
+	for _, half := range [][]*queuedMsg{msgs[:mid], msgs[mid:]} {
+		_, err := simulate(half)
+		if isTransportError(err) {
+			return nil, err
+		}
+		if err == nil {
+			valid = append(valid, half...)
+			continue
+		}
+		isolated, err := bisectMsgs(half, failed, err, simulate)
+		if err != nil {
+			return nil, err
+		}
+		valid = append(valid, isolated...)
+	}
+	return valid, nil
+}
+
+// isTransportError tells whether a call to stratos-chain failed because the chain couldn't be reached, rather than
+// because the msgs were rejected
+func isTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	switch status.Code(errors.Cause(err)) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Canceled:
+		return true
+	default:
+		return false
+	}
+}
+
+func buildTxBytesWithFee(msgs []*queuedMsg, gasUsed uint64) ([]byte, error) {
+	gasLimit := uint64(float64(gasUsed) * setting.Config.BlockchainInfo.Transactions.GasAdjustment)
+
+	gasPrice, err := txclienttypes.ParseCoinNormalized(setting.Config.BlockchainInfo.Transactions.GasPrice)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse gas price")
+	}
+	feeAmount := gasPrice.Amount.Mul(sdkmath.NewIntFromUint64(gasLimit))
+	fee := txclienttypes.NewCoin(gasPrice.Denom, feeAmount)
+	return buildTxBytes(msgs, gasLimit, []*basev1beta1.Coin{
+		{
+			Denom:  fee.Denom,
+			Amount: fee.Amount.String(),
+		},
+	})
+}
+
+func countQueuedMsgsByType(msgs []*queuedMsg) string {
+	var unsignedMsgs []*txclienttypes.UnsignedMsg
+	for _, msg := range msgs {
+		unsignedMsgs = append(unsignedMsgs, msg.msg)
+	}
+	return countMsgsByType(unsignedMsgs)
+}
+
 func countMsgsByType(unsignedMsgs []*txclienttypes.UnsignedMsg) string {
 	msgCount := make(map[string]int)
 	for _, msg := range unsignedMsgs {
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/stratosnet/sds/relayer/client/txqueue"
+)
+
+func TestBisectMsgs(t *testing.T) {
+	var msgs []*queuedMsg
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		msgs = append(msgs, &queuedMsg{entry: &txqueue.Entry{Id: id}})
+	}
+	rejected := map[string]bool{"b": true, "e": true}
+	simulate := func(batch []*queuedMsg) (uint64, error) {
+		for _, msg := range batch {
+			if rejected[msg.entry.Id] {
+				return 0, errors.Errorf("msg %v rejected", msg.entry.Id)
+			}
+		}
+		return 1, nil
+	}
+
+	failed := make(map[*queuedMsg]error)
+	valid, err := bisectMsgs(msgs, failed, errors.New("batch rejected"), simulate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(valid) != 3 || len(failed) != 2 {
+		t.Fatalf("expected 3 valid and 2 failed msgs, got %v and %v", len(valid), len(failed))
+	}
+	for msg := range failed {
+		if !rejected[msg.entry.Id] {
+			t.Fatalf("msg %v shouldn't fail", msg.entry.Id)
+		}
+	}
+
+	unavailable := func(batch []*queuedMsg) (uint64, error) {
+		return 0, status.Error(codes.Unavailable, "connection refused")
+	}
+	failed = make(map[*queuedMsg]error)
+	if _, err = bisectMsgs(msgs, failed, errors.New("batch rejected"), unavailable); !isTransportError(err) {
+		t.Fatalf("the bisection should stop when the chain is unreachable, got %v", err)
+	}
+	if len(failed) != 0 {
+		t.Fatal("no msg should be blamed when the chain is unreachable")
+	}
+}
+
+func TestIsTransportError(t *testing.T) {
+	for _, err := range []error{
+		status.Error(codes.Unavailable, "connection refused"),
+		errors.Wrap(status.Error(codes.DeadlineExceeded, "timeout"), "couldn't simulate tx bytes"),
+	} {
+		if !isTransportError(err) {
+			t.Fatalf("%v should be a transport error", err)
+		}
+	}
+	for _, err := range []error{
+		nil,
+		status.Error(codes.Unknown, "account sequence mismatch"),
+		errors.New("tx was rejected with code 5"),
+	} {
+		if isTransportError(err) {
+			t.Fatalf("%v shouldn't be a transport error", err)
+		}
+	}
+}
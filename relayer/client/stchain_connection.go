@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +26,8 @@ import (
 const (
 	ENABLE_WSCLIENT_LOG = false
 	NEW_BLOCK_QUERY     = "tm.event='NewBlock'"
+
+	checkpointFile = "block_checkpoint.json"
 )
 
 // stchainConnection is used to subscribe to stratos-chain events and receive messages via websocket
@@ -33,9 +36,16 @@ type stchainConnection struct {
 	client                *MultiClient
 	stratosEventsChannels *sync.Map
 	ws                    *wsclient.WSClient
+	checkpoint            *blockCheckpoint
 }
 
 func newStchainConnection(client *MultiClient) *stchainConnection {
+	checkpoint, err := loadBlockCheckpoint(filepath.Join(setting.HomePath, checkpointFile))
+	if err != nil {
+		utils.ErrorLog(err)
+		return nil
+	}
+
 	url, err := utils.ParseUrl(setting.Config.StratosChain.WebsocketServer)
 	if err != nil {
 		return nil
@@ -50,6 +60,7 @@ func newStchainConnection(client *MultiClient) *stchainConnection {
 		client:                client,
 		stratosEventsChannels: &sync.Map{},
 		ws:                    wsClient,
+		checkpoint:            checkpoint,
 	}
 
 	if ENABLE_WSCLIENT_LOG {
@@ -88,6 +99,8 @@ func (s *stchainConnection) subscribeAllQueries() error {
 }
 
 func (s *stchainConnection) onReconnect() {
+	// Events emitted while the connection was down are backfilled once the next block is received
+	s.checkpoint.markMissed()
 	// wsclient doesn't take care of the re-subscription operation when reconnect to ws conn
 	err := s.subscribeAllQueries()
 	if err != nil {
@@ -96,6 +109,7 @@ func (s *stchainConnection) onReconnect() {
 }
 
 func (s *stchainConnection) start() error {
+	s.checkpoint.markMissed()
 	s.ws.OnStart()
 	if err := s.subscribeAllQueries(); err != nil {
 		utils.ErrorLog("Failed subscribing queries:", err.Error())
@@ -127,6 +141,7 @@ func (s *stchainConnection) readerLoop() {
 					// Resubscribe after 1 second to give CometBFT time to restart (if
 					// crashed).
 					time.Sleep(1 * time.Second)
+					s.checkpoint.markMissed()
 					go s.subscribeAllQueries()
 				}
 				continue
@@ -143,6 +158,7 @@ func (s *stchainConnection) readerLoop() {
 				case s.client.NewBlockChan <- true:
 				default:
 				}
+				s.onNewBlock(*result)
 				continue
 			}
 			msgType := ""
@@ -162,6 +178,18 @@ func (s *stchainConnection) readerLoop() {
 	}
 }
 
+// onNewBlock moves the checkpoint forward. The tx events of a block are emitted before the next NewBlock event,
+// so all the events up to the previous block have been processed at this point
+func (s *stchainConnection) onNewBlock(result coretypes.ResultEvent) {
+	newBlock, ok := result.Data.(comettypes.EventDataNewBlock)
+	if !ok || newBlock.Block == nil {
+		return
+	}
+	if s.checkpoint.newBlock(newBlock.Block.Height) {
+		go s.checkpoint.backfill(s.client.Ctx)
+	}
+}
+
 func (s *stchainConnection) refresh() {
 	s.start()
 }
@@ -0,0 +1,346 @@
+package txqueue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+	txclienttypes "github.com/stratosnet/sds/tx-client/types"
+)
+
+const (
+	pendingDir    = "pending"
+	deadLetterDir = "dead_letter"
+	entryFileExt  = ".json"
+
+	DefaultMaxAttempts      = 10
+	DefaultRetryInterval    = 2 * time.Second
+	DefaultMaxRetryInterval = 5 * time.Minute
+)
+
+// Entry is a msg waiting to be broadcast to stratos-chain. Each entry is persisted as its own json file
+type Entry struct {
+	Id          string                          `json:"id"`
+	Msg         *txclienttypes.UnsignedMsgBytes `json:"msg"`
+	Attempts    int                             `json:"attempts"`
+	NextAttempt int64                           `json:"next_attempt"` // unix milliseconds
+	LastError   string                          `json:"last_error,omitempty"`
+	CreatedAt   int64                           `json:"created_at"` // unix milliseconds
+}
+
+// Queue is a durable queue of msgs to broadcast. Msgs failing too many times are moved to the dead-letter queue,
+// where they stay until they are replayed manually
+type Queue struct {
+	dir              string
+	maxAttempts      int
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+
+	mtx      sync.Mutex
+	pending  map[string]*Entry
+	seq      uint64
+	backoffs int   // consecutive failures of the chain, reset by a successful broadcast
+	resumeAt int64 // unix milliseconds. No entry is ready before it
+}
+
+// New opens the queue stored in dir, and reloads the msgs that were still pending when relayd stopped
+func New(dir string, maxAttempts int, retryInterval, maxRetryInterval time.Duration) (*Queue, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+	if maxRetryInterval < retryInterval {
+		maxRetryInterval = DefaultMaxRetryInterval
+	}
+
+	q := &Queue{
+		dir:              dir,
+		maxAttempts:      maxAttempts,
+		retryInterval:    retryInterval,
+		maxRetryInterval: maxRetryInterval,
+		pending:          make(map[string]*Entry),
+	}
+	for _, subDir := range []string{pendingDir, deadLetterDir} {
+		if err := os.MkdirAll(filepath.Join(dir, subDir), 0700); err != nil {
+			return nil, errors.Wrap(err, "couldn't create tx queue folder")
+		}
+	}
+
+	entries, err := q.loadEntries(pendingDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		q.pending[entry.Id] = entry
+	}
+	if len(entries) > 0 {
+		utils.Logf("Reloaded %v pending msgs from the tx queue", len(entries))
+	}
+	return q, nil
+}
+
+// Add persists a new msg in the pending queue. The msg is kept in memory even if it couldn't be written to disk
+func (q *Queue) Add(msg *txclienttypes.UnsignedMsg) (*Entry, error) {
+	msgBytes, err := msg.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := &Entry{
+		Id:          fmt.Sprintf("%020d-%06d", now.UnixNano(), atomic.AddUint64(&q.seq, 1)%1000000),
+		Msg:         msgBytes,
+		NextAttempt: now.UnixMilli(),
+		CreatedAt:   now.UnixMilli(),
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.pending[entry.Id] = entry
+	return entry, q.writeEntry(pendingDir, entry)
+}
+
+// Ready returns up to max pending entries that are due for a broadcast attempt, oldest first
+func (q *Queue) Ready(max int) []*Entry {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	now := time.Now().UnixMilli()
+	if now < q.resumeAt {
+		return nil
+	}
+	var ready []*Entry
+	for _, entry := range q.pending {
+		if entry.NextAttempt <= now {
+			ready = append(ready, entry)
+		}
+	}
+	sortEntries(ready)
+	if max > 0 && len(ready) > max {
+		ready = ready[:max]
+	}
+	return ready
+}
+
+// ReadyCount returns the number of pending entries that are due for a broadcast attempt
+func (q *Queue) ReadyCount() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	now := time.Now().UnixMilli()
+	if now < q.resumeAt {
+		return 0
+	}
+	count := 0
+	for _, entry := range q.pending {
+		if entry.NextAttempt <= now {
+			count++
+		}
+	}
+	return count
+}
+
+// PendingCount returns the number of msgs that haven't been broadcast yet
+func (q *Queue) PendingCount() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.pending)
+}
+
+// Done removes successfully broadcast entries from the queue
+func (q *Queue) Done(ids ...string) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.backoffs = 0
+	for _, id := range ids {
+		delete(q.pending, id)
+		if err := q.removeEntry(pendingDir, id); err != nil {
+			utils.ErrorLogf("couldn't remove broadcast msg [%v] from the tx queue: %v", id, err)
+		}
+	}
+}
+
+// Fail records a failed broadcast attempt. The entry is retried later with an exponential backoff,
+// or moved to the dead-letter queue once it reaches the max number of attempts
+func (q *Queue) Fail(id string, cause error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	entry, ok := q.pending[id]
+	if !ok {
+		return
+	}
+	entry.Attempts++
+	entry.LastError = cause.Error()
+	if entry.Attempts >= q.maxAttempts {
+		q.deadLetter(entry)
+		return
+	}
+
+	backoff := q.retryInterval << (entry.Attempts - 1)
+	if backoff <= 0 || backoff > q.maxRetryInterval {
+		backoff = q.maxRetryInterval
+	}
+	entry.NextAttempt = time.Now().Add(backoff).UnixMilli()
+	if err := q.writeEntry(pendingDir, entry); err != nil {
+		utils.ErrorLogf("couldn't update msg [%v] in the tx queue: %v", id, err)
+	}
+}
+
+// Backoff pauses the whole queue after a failure that doesn't depend on the msgs, like stratos-chain being unreachable.
+// The attempts of the msgs are not counted, and the pause doubles until a broadcast succeeds
+func (q *Queue) Backoff() time.Duration {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.backoffs++
+	backoff := q.retryInterval << (q.backoffs - 1)
+	if backoff <= 0 || backoff > q.maxRetryInterval {
+		backoff = q.maxRetryInterval
+	}
+	q.resumeAt = time.Now().Add(backoff).UnixMilli()
+	return backoff
+}
+
+// DeadLetter moves an entry straight to the dead-letter queue, for msgs that can never succeed as they are
+func (q *Queue) DeadLetter(id string, cause error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	entry, ok := q.pending[id]
+	if !ok {
+		return
+	}
+	entry.Attempts++
+	entry.LastError = cause.Error()
+	q.deadLetter(entry)
+}
+
+// DeadLetters returns all the entries of the dead-letter queue, oldest first
+func (q *Queue) DeadLetters() ([]*Entry, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.loadEntries(deadLetterDir)
+}
+
+// Replay moves entries from the dead-letter queue back to the pending queue, with a fresh attempt count.
+// All dead letters are replayed when no id is given
+func (q *Queue) Replay(ids ...string) (int, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	entries, err := q.loadEntries(deadLetterDir)
+	if err != nil {
+		return 0, err
+	}
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	replayed := 0
+	now := time.Now().UnixMilli()
+	for _, entry := range entries {
+		if len(ids) > 0 && !wanted[entry.Id] {
+			continue
+		}
+		entry.Attempts = 0
+		entry.NextAttempt = now
+		if err = q.writeEntry(pendingDir, entry); err != nil {
+			return replayed, err
+		}
+		if err = q.removeEntry(deadLetterDir, entry.Id); err != nil {
+			return replayed, err
+		}
+		q.pending[entry.Id] = entry
+		delete(wanted, entry.Id)
+		replayed++
+	}
+	if len(wanted) > 0 {
+		var missing []string
+		for id := range wanted {
+			missing = append(missing, id)
+		}
+		sort.Strings(missing)
+		return replayed, errors.Errorf("no dead letter found for ids %v", missing)
+	}
+	return replayed, nil
+}
+
+func (q *Queue) deadLetter(entry *Entry) {
+	utils.ErrorLogf("msg [%v] of type [%v] moved to the dead-letter queue after %v attempts: %v",
+		entry.Id, entry.Msg.Type, entry.Attempts, entry.LastError)
+	delete(q.pending, entry.Id)
+	if err := q.writeEntry(deadLetterDir, entry); err != nil {
+		utils.ErrorLogf("couldn't write msg [%v] to the dead-letter queue: %v", entry.Id, err)
+		return
+	}
+	if err := q.removeEntry(pendingDir, entry.Id); err != nil {
+		utils.ErrorLogf("couldn't remove msg [%v] from the tx queue: %v", entry.Id, err)
+	}
+}
+
+func (q *Queue) writeEntry(subDir string, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.dir, subDir, entry.Id+entryFileExt)
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (q *Queue) removeEntry(subDir, id string) error {
+	err := os.Remove(filepath.Join(q.dir, subDir, id+entryFileExt))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (q *Queue) loadEntries(subDir string) ([]*Entry, error) {
+	files, err := os.ReadDir(filepath.Join(q.dir, subDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), entryFileExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(q.dir, subDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entry := &Entry{}
+		if err = json.Unmarshal(data, entry); err != nil || entry.Msg == nil {
+			utils.ErrorLogf("skipping invalid tx queue file [%v]", file.Name())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Id < entries[j].Id
+	})
+}
@@ -0,0 +1,143 @@
+package txqueue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	txclienttypes "github.com/stratosnet/sds/tx-client/types"
+)
+
+func newTestQueue(t *testing.T, dir string, maxAttempts int) *Queue {
+	q, err := New(dir, maxAttempts, 20*time.Millisecond, 80*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func addMsg(t *testing.T, q *Queue, msgType string) *Entry {
+	entry, err := q.Add(&txclienttypes.UnsignedMsg{
+		Msg:  &anypb.Any{TypeUrl: "/stratos.pot.v1.MsgVolumeReport", Value: []byte{1, 2, 3}},
+		Type: msgType,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestQueueFailBackoff(t *testing.T) {
+	q := newTestQueue(t, t.TempDir(), 5)
+	first := addMsg(t, q, "first")
+	second := addMsg(t, q, "second")
+	if ready := q.Ready(0); len(ready) != 2 || ready[0].Id != first.Id {
+		t.Fatalf("both msgs should be ready, oldest first, got %v", ready)
+	}
+
+	q.Fail(first.Id, errors.New("rejected"))
+	if ready := q.Ready(0); len(ready) != 1 || ready[0].Id != second.Id {
+		t.Fatal("the failed msg should wait for its backoff")
+	}
+	time.Sleep(25 * time.Millisecond)
+	if q.ReadyCount() != 2 {
+		t.Fatal("the failed msg should be ready again after its backoff")
+	}
+	if ready := q.Ready(1); len(ready) != 1 || ready[0].Id != first.Id || ready[0].Attempts != 1 {
+		t.Fatalf("the failed msg should be retried first, got %v", ready)
+	}
+}
+
+func TestQueueChainBackoff(t *testing.T) {
+	q := newTestQueue(t, t.TempDir(), 2)
+	entry := addMsg(t, q, "msg")
+
+	if backoff := q.Backoff(); backoff != 20*time.Millisecond {
+		t.Fatalf("unexpected first backoff %v", backoff)
+	}
+	if q.ReadyCount() != 0 || len(q.Ready(0)) != 0 {
+		t.Fatal("no msg should be ready while the queue is paused")
+	}
+	for i := 0; i < 4; i++ {
+		q.Backoff()
+	}
+	if backoff := q.Backoff(); backoff != 80*time.Millisecond {
+		t.Fatalf("the backoff should be capped, got %v", backoff)
+	}
+	q.mtx.Lock()
+	q.resumeAt = 0
+	q.mtx.Unlock()
+	ready := q.Ready(0)
+	if len(ready) != 1 || ready[0].Attempts != 0 {
+		t.Fatal("pausing the queue shouldn't count the attempts of the msgs")
+	}
+
+	q.Done(entry.Id)
+	if backoff := q.Backoff(); backoff != 20*time.Millisecond {
+		t.Fatalf("a successful broadcast should reset the backoff, got %v", backoff)
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	q := newTestQueue(t, dir, 2)
+	failing := addMsg(t, q, "failing")
+	invalid := addMsg(t, q, "invalid")
+
+	q.Fail(failing.Id, errors.New("rejected"))
+	q.Fail(failing.Id, errors.New("rejected again"))
+	q.DeadLetter(invalid.Id, errors.New("can't be decoded"))
+	if q.PendingCount() != 0 {
+		t.Fatal("the msgs should have left the pending queue")
+	}
+	deadLetters, err := q.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters) != 2 || deadLetters[0].Attempts != 2 || deadLetters[0].LastError != "rejected again" {
+		t.Fatalf("unexpected dead letters %+v", deadLetters)
+	}
+
+	if _, err = q.Replay("unknown"); err == nil {
+		t.Fatal("replaying an unknown id should fail")
+	}
+	replayed, err := q.Replay(failing.Id)
+	if err != nil || replayed != 1 {
+		t.Fatalf("expected 1 replayed msg, got %v, err %v", replayed, err)
+	}
+	if ready := q.Ready(0); len(ready) != 1 || ready[0].Id != failing.Id || ready[0].Attempts != 0 {
+		t.Fatal("the replayed msg should be pending with a fresh attempt count")
+	}
+	if deadLetters, _ = q.DeadLetters(); len(deadLetters) != 1 || deadLetters[0].Id != invalid.Id {
+		t.Fatal("the other dead letter should be kept")
+	}
+}
+
+func TestQueueReload(t *testing.T) {
+	dir := t.TempDir()
+	q := newTestQueue(t, dir, 5)
+	done := addMsg(t, q, "done")
+	failed := addMsg(t, q, "failed")
+	q.Done(done.Id)
+	q.Fail(failed.Id, errors.New("rejected"))
+	if err := os.WriteFile(filepath.Join(dir, pendingDir, "broken"+entryFileExt), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newTestQueue(t, dir, 5)
+	if reloaded.PendingCount() != 1 {
+		t.Fatalf("only the failed msg should be reloaded, got %v msgs", reloaded.PendingCount())
+	}
+	entry := reloaded.pending[failed.Id]
+	if entry == nil || entry.Attempts != 1 || entry.LastError != "rejected" {
+		t.Fatalf("the reloaded msg should keep its attempts, got %+v", entry)
+	}
+	msg, err := entry.Msg.FromBytes()
+	if err != nil || msg.Type != "failed" || msg.Msg.TypeUrl != "/stratos.pot.v1.MsgVolumeReport" {
+		t.Fatalf("the reloaded msg should be decoded, got %+v, err %v", msg, err)
+	}
+}
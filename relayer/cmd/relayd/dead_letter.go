@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/stratosnet/sds/framework/utils"
+
+	"github.com/stratosnet/sds/relayer/cmd/relayd/setting"
+	"github.com/stratosnet/sds/relayer/rpc"
+)
+
+func listDeadLetters(cmd *cobra.Command, args []string) error {
+	c, err := rpc.Dial(setting.IpcEndpoint)
+	if err != nil {
+		utils.ErrorLog(err)
+		return err
+	}
+	defer c.Close()
+
+	callRpc(c, "deadLetters", args)
+	return nil
+}
+
+func replayDeadLetters(cmd *cobra.Command, args []string) error {
+	c, err := rpc.Dial(setting.IpcEndpoint)
+	if err != nil {
+		utils.ErrorLog(err)
+		return err
+	}
+	defer c.Close()
+
+	callRpc(c, "replayDeadLetters", args)
+	return nil
+}
@@ -18,11 +18,13 @@ func main() {
 	startCmd := getStartCmd()
 	configCmd := getGenConfigCmd()
 	syncCmd := getSyncCmd()
+	deadLetterCmd := getDeadLetterCmd()
 	versionCmd := getVersionCmd()
 
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(deadLetterCmd)
 	rootCmd.AddCommand(versionCmd)
 
 	err := rootCmd.Execute()
@@ -93,8 +95,8 @@ func rootPreRunE(cmd *cobra.Command, _ []string) error {
 
 func getSyncCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "sync",
-		Short:   "sync stchain tx to sp",
+		Use:     "sync [txHash]",
+		Short:   "sync stchain tx to sp, or all the txs of a range of blocks with --from-height",
 		RunE:    sync,
 		PreRunE: syncPreRunE,
 	}
@@ -104,6 +106,37 @@ func getSyncCmd() *cobra.Command {
 		panic(err)
 	}
 
+	cmd.PersistentFlags().StringP(Home, "r", dir, "home path for the relayd process")
+	cmd.Flags().Int64(FromHeight, 0, "first block height to sync")
+	cmd.Flags().Int64(ToHeight, 0, "last block height to sync (default: latest block)")
+	return cmd
+}
+
+func getDeadLetterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dead-letter",
+		Short: "inspect and replay the msgs that relayd failed to broadcast",
+	}
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Short:   "list the msgs in the dead-letter queue",
+		RunE:    listDeadLetters,
+		PreRunE: syncPreRunE,
+	}
+	replayCmd := &cobra.Command{
+		Use:     "replay [id...]",
+		Short:   "move msgs from the dead-letter queue back to the tx queue. All msgs are replayed when no id is given",
+		RunE:    replayDeadLetters,
+		PreRunE: syncPreRunE,
+	}
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(replayCmd)
+
+	dir, err := os.Getwd()
+	if err != nil {
+		utils.ErrorLog("failed to get working directory")
+		panic(err)
+	}
 	cmd.PersistentFlags().StringP(Home, "r", dir, "home path for the relayd process")
 	return cmd
 }
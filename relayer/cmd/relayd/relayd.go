@@ -50,6 +50,7 @@ func startRunE(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
+	server.BaseServer.SetTxQueue(multiClient.TxQueue)
 	err = server.BaseServer.Start()
 	defer server.BaseServer.Stop()
 	if err != nil {
@@ -22,8 +22,15 @@ type connectionRetries struct {
 }
 
 type grpcConfig struct {
-	GrpcServer string `toml:"grpc_server" comment:"Network address of the chain Eg: \"127.0.0.1:9090\""`
-	Insecure   bool   `toml:"insecure"`
+	GrpcServer  string   `toml:"grpc_server" comment:"Network address of the chain Eg: \"127.0.0.1:9090\""`
+	GrpcServers []string `toml:"grpc_servers" comment:"Other chain addresses, used when grpc_server is unavailable or slower Eg: [\"127.0.0.1:9091\"]"`
+	Insecure    bool     `toml:"insecure"`
+}
+
+type outboxConfig struct {
+	MaxAttempts      int `toml:"max_attempts" comment:"Number of failed deliveries before an event is moved to the dead-letter folder of the outbox"`
+	RetryInterval    int `toml:"retry_interval"`     // Milliseconds
+	MaxRetryInterval int `toml:"max_retry_interval"` // Milliseconds
 }
 
 type sds struct {
@@ -31,11 +38,15 @@ type sds struct {
 	NetworkAddress    string            `toml:"network_address"`
 	WebsocketPort     string            `toml:"websocket_port"`
 	ConnectionRetries connectionRetries `toml:"connection_retries"`
+	Outbox            outboxConfig      `toml:"outbox" comment:"Retries of the chain events relayed to the SP, until the SP acknowledges them"`
 }
 
 type broadcast struct {
-	ChannelSize int `toml:"channel_size"`
-	MaxMsgPerTx int `toml:"max_msg_per_tx"`
+	ChannelSize      int `toml:"channel_size"`
+	MaxMsgPerTx      int `toml:"max_msg_per_tx"`
+	MaxAttempts      int `toml:"max_attempts" comment:"Number of failed broadcasts before a msg is moved to the dead-letter queue"`
+	RetryInterval    int `toml:"retry_interval"`     // Milliseconds
+	MaxRetryInterval int `toml:"max_retry_interval"` // Milliseconds
 }
 
 type stratoschain struct {
@@ -119,6 +130,11 @@ func defaultConfig() *config {
 				SleepDuration:   3000,
 				RefreshInterval: 24 * 60 * 60,
 			},
+			Outbox: outboxConfig{
+				MaxAttempts:      30,
+				RetryInterval:    2000,
+				MaxRetryInterval: 2 * 60 * 1000,
+			},
 		},
 		StratosChain: stratoschain{
 			GrpcServer: grpcConfig{
@@ -132,8 +148,11 @@ func defaultConfig() *config {
 				RefreshInterval: 24 * 60 * 60,
 			},
 			Broadcast: broadcast{
-				ChannelSize: 2000,
-				MaxMsgPerTx: 250,
+				ChannelSize:      2000,
+				MaxMsgPerTx:      250,
+				MaxAttempts:      10,
+				RetryInterval:    2000,
+				MaxRetryInterval: 5 * 60 * 1000,
 			},
 		},
 		Version: Version{AppVer: APP_VER, MinAppVer: MIN_APP_VER, Show: VERSION},
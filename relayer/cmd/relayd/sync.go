@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -13,7 +14,24 @@ import (
 	"github.com/stratosnet/sds/relayer/server"
 )
 
+const (
+	FromHeight = "from-height"
+	ToHeight   = "to-height"
+)
+
 func sync(cmd *cobra.Command, args []string) error {
+	fromHeight, err := cmd.Flags().GetInt64(FromHeight)
+	if err != nil {
+		return err
+	}
+	toHeight, err := cmd.Flags().GetInt64(ToHeight)
+	if err != nil {
+		return err
+	}
+	if fromHeight > 0 {
+		return syncHeights(fromHeight, toHeight)
+	}
+
 	if len(args) != 1 || len(args[0]) == 0 {
 		utils.ErrorLog("wrong number of arguments")
 		return nil
@@ -36,6 +54,26 @@ func sync(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func syncHeights(fromHeight, toHeight int64) error {
+	if toHeight > 0 && toHeight < fromHeight {
+		return errors.Errorf("invalid height range [%v, %v]", fromHeight, toHeight)
+	}
+
+	c, err := rpc.Dial(setting.IpcEndpoint)
+	if err != nil {
+		utils.ErrorLog(err)
+		return err
+	}
+	defer c.Close()
+
+	params := []string{strconv.FormatInt(fromHeight, 10)}
+	if toHeight > 0 {
+		params = append(params, strconv.FormatInt(toHeight, 10))
+	}
+	callRpc(c, "syncHeights", params)
+	return nil
+}
+
 func callRpc(c *rpc.Client, line string, param []string) bool {
 	var result server.CmdResult
 
@@ -11,10 +11,11 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/rs/cors v1.8.2
 	github.com/spf13/cobra v1.6.1
-	github.com/stratosnet/sds/framework v0.0.0-20240522153956-2c0193243442
-	github.com/stratosnet/sds/sds-msg v0.0.0-20240522153956-2c0193243442
+	github.com/stratosnet/sds/framework v0.0.0-20250513175657-fdf35145ec7a
+	github.com/stratosnet/sds/sds-msg v0.0.0-20250513175657-fdf35145ec7a
 	github.com/stratosnet/sds/tx-client v0.0.0-20240725194703-e4a8b75b91f5
 	github.com/stratosnet/stratos-chain/api v0.0.0-20240509211914-ee516857645d
+	google.golang.org/grpc v1.58.3
 	google.golang.org/protobuf v1.31.0
 	gopkg.in/natefinch/npipe.v2 v2.0.0-20160621034901-c1b8fa8bdcce
 )
@@ -88,7 +89,12 @@ require (
 	google.golang.org/genproto v0.0.0-20231002182017-d307bd883b97 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20230920204549-e6e6cdab5c13 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20231009173412-8bfb1ae86b6c // indirect
-	google.golang.org/grpc v1.58.3 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	lukechampine.com/blake3 v1.1.6 // indirect
 )
+
+replace github.com/stratosnet/sds/framework => ../framework
+
+replace github.com/stratosnet/sds/sds-msg => ../sds-msg
+
+replace github.com/stratosnet/sds/tx-client => ../tx-client
@@ -3,11 +3,15 @@ package server
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/tx-client/grpc"
 
-	"github.com/stratosnet/sds/relayer/stratoschain/handlers"
+	"github.com/stratosnet/sds/relayer/client/txqueue"
+	"github.com/stratosnet/sds/relayer/stratoschain"
 )
 
 const (
@@ -19,10 +23,11 @@ type CmdResult struct {
 }
 
 type relayCmd struct {
+	txQueue *txqueue.Queue
 }
 
-func RelayAPI() *relayCmd {
-	return &relayCmd{}
+func RelayAPI(txQueue *txqueue.Queue) *relayCmd {
+	return &relayCmd{txQueue: txQueue}
 }
 
 func (api *relayCmd) Sync(ctx context.Context, param []string) (CmdResult, error) {
@@ -39,15 +44,77 @@ func (api *relayCmd) Sync(ctx context.Context, param []string) (CmdResult, error
 	}
 
 	// process relayed events
-	events := handlers.ExtractEventsFromTxResponse(txResponse)
-	for _, event := range events {
-		msgType := handlers.GetMsgType(event)
-		if handler, ok := handlers.Handlers[msgType]; ok {
-			go handler(event)
-		} else {
-			utils.ErrorLogf("No handler for event type [%v]", msgType)
+	stratoschain.HandleTxResponse(txResponse, false)
+
+	return CmdResult{Msg: DefaultMsg}, nil
+}
+
+// SyncHeights relays the events of all the txs included in blocks [from, to]. The latest block is used when to is omitted
+func (api *relayCmd) SyncHeights(ctx context.Context, param []string) (CmdResult, error) {
+	if len(param) < 1 || len(param) > 2 {
+		utils.ErrorLog("wrong number of arguments")
+		return CmdResult{Msg: ""}, fmt.Errorf("wrong number of arguments")
+	}
+	fromHeight, err := strconv.ParseInt(param[0], 10, 64)
+	if err != nil || fromHeight <= 0 {
+		return CmdResult{Msg: ""}, fmt.Errorf("invalid from height [%v]", param[0])
+	}
+
+	var toHeight int64
+	if len(param) == 2 {
+		toHeight, err = strconv.ParseInt(param[1], 10, 64)
+		if err != nil {
+			return CmdResult{Msg: ""}, fmt.Errorf("invalid to height [%v]", param[1])
 		}
+	} else {
+		toHeight, err = grpc.QueryLatestBlockHeight()
+		if err != nil {
+			return CmdResult{Msg: ""}, fmt.Errorf("couldn't query the latest block height: %v", err.Error())
+		}
+	}
+	if toHeight < fromHeight {
+		return CmdResult{Msg: ""}, fmt.Errorf("invalid height range [%v, %v]", fromHeight, toHeight)
 	}
 
-	return CmdResult{Msg: DefaultMsg}, nil
+	go func() {
+		lastHeight, err := stratoschain.SyncBlocks(context.Background(), fromHeight, toHeight)
+		if err != nil {
+			utils.ErrorLogf("sync stopped after block %v: %v", lastHeight, err)
+			return
+		}
+		utils.Logf("Synced blocks %v to %v", fromHeight, toHeight)
+	}()
+
+	return CmdResult{Msg: fmt.Sprintf("Syncing blocks %v to %v", fromHeight, toHeight)}, nil
+}
+
+func (api *relayCmd) DeadLetters(ctx context.Context, param []string) (CmdResult, error) {
+	if api.txQueue == nil {
+		return CmdResult{Msg: ""}, fmt.Errorf("the tx queue is not started")
+	}
+	entries, err := api.txQueue.DeadLetters()
+	if err != nil {
+		return CmdResult{Msg: ""}, err
+	}
+	if len(entries) == 0 {
+		return CmdResult{Msg: fmt.Sprintf("No dead letter (%v msgs pending broadcast)", api.txQueue.PendingCount())}, nil
+	}
+
+	lines := []string{fmt.Sprintf("%v dead letters (%v msgs pending broadcast):", len(entries), api.txQueue.PendingCount())}
+	for _, entry := range entries {
+		lines = append(lines, fmt.Sprintf("%v  type: %v  attempts: %v  created: %v  last error: %v",
+			entry.Id, entry.Msg.Type, entry.Attempts, time.UnixMilli(entry.CreatedAt).Format(time.RFC3339), entry.LastError))
+	}
+	return CmdResult{Msg: strings.Join(lines, "\n")}, nil
+}
+
+func (api *relayCmd) ReplayDeadLetters(ctx context.Context, param []string) (CmdResult, error) {
+	if api.txQueue == nil {
+		return CmdResult{Msg: ""}, fmt.Errorf("the tx queue is not started")
+	}
+	replayed, err := api.txQueue.Replay(param...)
+	if err != nil {
+		return CmdResult{Msg: ""}, fmt.Errorf("replayed %v dead letters before failing: %v", replayed, err.Error())
+	}
+	return CmdResult{Msg: fmt.Sprintf("%v dead letters moved back to the tx queue", replayed)}, nil
 }
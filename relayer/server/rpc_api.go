@@ -10,6 +10,8 @@ import (
 	potv1 "github.com/stratosnet/stratos-chain/api/stratos/pot/v1"
 	registerv1 "github.com/stratosnet/stratos-chain/api/stratos/register/v1"
 	sdsv1 "github.com/stratosnet/stratos-chain/api/stratos/sds/v1"
+
+	"github.com/stratosnet/sds/relayer/stratoschain/handlers"
 )
 
 type rpcApi struct {
@@ -47,3 +49,7 @@ func (api *rpcApi) VolumeReport(ctx context.Context, epoch int64) (*potv1.QueryV
 func (api *rpcApi) NozSupply(ctx context.Context) (*sdsv1.QueryNozSupplyResponse, error) {
 	return grpc.QueryNozSupply()
 }
+
+func (api *rpcApi) OutboxStatus(ctx context.Context) (handlers.OutboxStatus, error) {
+	return handlers.GetOutboxStatus(), nil
+}
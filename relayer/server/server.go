@@ -6,6 +6,7 @@ import (
 
 	"github.com/stratosnet/sds/framework/utils"
 
+	"github.com/stratosnet/sds/relayer/client/txqueue"
 	"github.com/stratosnet/sds/relayer/cmd/relayd/setting"
 	"github.com/stratosnet/sds/relayer/namespace"
 	"github.com/stratosnet/sds/relayer/rpc"
@@ -24,6 +25,12 @@ var BaseServer = &BaseRelayServer{}
 type BaseRelayServer struct {
 	ipcServ     *namespace.IpcServer
 	httpRpcServ *namespace.HttpServer
+	txQueue     *txqueue.Queue
+}
+
+// SetTxQueue sets the tx broadcast queue managed through the relayer IPC commands
+func (bs *BaseRelayServer) SetTxQueue(txQueue *txqueue.Queue) {
+	bs.txQueue = txQueue
 }
 
 func (bs *BaseRelayServer) Start() error {
@@ -41,7 +48,7 @@ func (bs *BaseRelayServer) startIPC() error {
 		{
 			Namespace: "relayer",
 			Version:   "1.0",
-			Service:   RelayAPI(),
+			Service:   RelayAPI(bs.txQueue),
 			Public:    false,
 		},
 	}
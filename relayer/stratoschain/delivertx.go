@@ -2,12 +2,11 @@ package stratoschain
 
 import (
 	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
+	"github.com/pkg/errors"
 
-	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/tx-client/grpc"
 
 	"github.com/stratosnet/sds/relayer/cmd/relayd/setting"
-	"github.com/stratosnet/sds/relayer/stratoschain/handlers"
 )
 
 func BroadcastTx(txBytes []byte) error {
@@ -17,6 +16,10 @@ func BroadcastTx(txBytes []byte) error {
 		return err
 	}
 
+	if resp.TxResponse.Code != 0 {
+		return errors.Errorf("tx [%v] was rejected with code %v: %v", resp.TxResponse.Txhash, resp.TxResponse.Code, resp.TxResponse.RawLog)
+	}
+
 	if setting.Config == nil {
 		return nil // If the relayd config is nil, then this is ppd broadcasting a tx. We don't want to call the event handler in this case
 	}
@@ -25,14 +28,6 @@ func BroadcastTx(txBytes []byte) error {
 		return nil
 	}
 
-	events := handlers.ExtractEventsFromTxResponse(resp.TxResponse)
-	for _, event := range events {
-		msgType := handlers.GetMsgType(event)
-		if handler, ok := handlers.Handlers[msgType]; ok {
-			go handler(event)
-		} else {
-			utils.ErrorLogf("No handler for event type [%v]", msgType)
-		}
-	}
+	HandleTxResponse(resp.TxResponse, false)
 	return nil
 }
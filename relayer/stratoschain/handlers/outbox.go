@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+const (
+	outboxFileExt       = ".json"
+	outboxDeadLetterDir = "dead_letter"
+
+	DefaultOutboxMaxAttempts      = 30
+	DefaultOutboxRetryInterval    = 2 * time.Second
+	DefaultOutboxMaxRetryInterval = 2 * time.Minute
+	outboxPollInterval            = time.Second
+)
+
+// OutboxEntry is an event waiting to be acknowledged by the SP. Each entry is persisted as its own json file
+type OutboxEntry struct {
+	Key         string          `json:"key"` // hex encoded cache key of the event
+	Endpoint    string          `json:"endpoint"`
+	Data        json.RawMessage `json:"data"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt int64           `json:"next_attempt"` // unix milliseconds
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   int64           `json:"created_at"` // unix nanoseconds, to keep the events in order
+}
+
+// OutboxStatus summarizes the events that were not acknowledged by the SP yet
+type OutboxStatus struct {
+	Pending     int    `json:"pending"`      // events not acknowledged yet, including the failed ones
+	Failed      int    `json:"failed"`       // events for which at least one delivery attempt failed
+	DeadLetters int    `json:"dead_letters"` // events given up on since relayd started
+	Oldest      int64  `json:"oldest"`       // creation time of the oldest pending event, in unix milliseconds
+	LastErr     string `json:"last_error,omitempty"`
+}
+
+// Outbox persists the events relayed to the SP, and retries their delivery with a backoff until the SP acknowledges them.
+// Events failing too many times are moved to the dead-letter folder. Moving them back to the outbox folder replays them
+// on the next start
+type Outbox struct {
+	dir              string
+	maxAttempts      int
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+	deliver          func(endpoint string, data []byte) error
+	deadLetters      int
+
+	mtx     sync.Mutex
+	entries map[string]*OutboxEntry
+	wakeUp  chan struct{}
+}
+
+var outbox *Outbox
+
+// InitOutbox opens the outbox stored in dir. Events that were not acknowledged before relayd stopped are delivered again once RunOutbox is called
+func InitOutbox(dir string, maxAttempts int, retryInterval, maxRetryInterval time.Duration) error {
+	o, err := newOutbox(dir, maxAttempts, retryInterval, maxRetryInterval)
+	if err != nil {
+		return err
+	}
+	if len(o.entries) > 0 {
+		utils.Logf("Reloaded %v events not yet acknowledged by the SP from the outbox", len(o.entries))
+	}
+	outbox = o
+	return nil
+}
+
+func newOutbox(dir string, maxAttempts int, retryInterval, maxRetryInterval time.Duration) (*Outbox, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultOutboxMaxAttempts
+	}
+	if retryInterval <= 0 {
+		retryInterval = DefaultOutboxRetryInterval
+	}
+	if maxRetryInterval < retryInterval {
+		maxRetryInterval = DefaultOutboxMaxRetryInterval
+	}
+	if err := os.MkdirAll(filepath.Join(dir, outboxDeadLetterDir), 0700); err != nil {
+		return nil, errors.Wrap(err, "couldn't create outbox folder")
+	}
+
+	o := &Outbox{
+		dir:              dir,
+		maxAttempts:      maxAttempts,
+		retryInterval:    retryInterval,
+		maxRetryInterval: maxRetryInterval,
+		deliver:          deliverToSP,
+		entries:          make(map[string]*OutboxEntry),
+		wakeUp:           make(chan struct{}, 1),
+	}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// RunOutbox delivers the pending events to the SP until ctx is cancelled
+func RunOutbox(ctx context.Context) {
+	if outbox == nil {
+		return
+	}
+	outbox.wake()
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-outbox.wakeUp:
+		}
+		outbox.deliverDue(ctx)
+	}
+}
+
+// GetOutboxStatus returns the counts of pending and failed events in the outbox
+func GetOutboxStatus() OutboxStatus {
+	if outbox == nil {
+		return OutboxStatus{}
+	}
+	return outbox.status()
+}
+
+func (o *Outbox) add(key, endpoint string, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return errors.New("Error when trying to marshal data to json: " + err.Error())
+	}
+
+	now := time.Now()
+	entry := &OutboxEntry{
+		Key:         hex.EncodeToString([]byte(key)),
+		Endpoint:    endpoint,
+		Data:        jsonData,
+		NextAttempt: now.UnixMilli(),
+		CreatedAt:   now.UnixNano(),
+	}
+
+	o.mtx.Lock()
+	if existing, ok := o.entries[entry.Key]; ok {
+		entry.CreatedAt = existing.CreatedAt
+	}
+	o.entries[entry.Key] = entry
+	err = o.write(entry)
+	o.mtx.Unlock()
+
+	o.wake()
+	return err
+}
+
+func (o *Outbox) wake() {
+	select {
+	case o.wakeUp <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) dueEntries() []*OutboxEntry {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	now := time.Now().UnixMilli()
+	var due []*OutboxEntry
+	for _, entry := range o.entries {
+		if entry.NextAttempt <= now {
+			due = append(due, entry)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].CreatedAt < due[j].CreatedAt
+	})
+	return due
+}
+
+func (o *Outbox) deliverDue(ctx context.Context) {
+	for _, entry := range o.dueEntries() {
+		if ctx.Err() != nil {
+			return
+		}
+		err := o.deliver(entry.Endpoint, entry.Data)
+		if err != nil {
+			utils.ErrorLog(err)
+			if o.retryLater(entry, err) {
+				return // The SP is most likely unreachable. Keep the remaining events in order for the next round
+			}
+			continue
+		}
+		o.acknowledged(entry)
+	}
+}
+
+func (o *Outbox) acknowledged(entry *OutboxEntry) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if current, ok := o.entries[entry.Key]; ok && current == entry {
+		delete(o.entries, entry.Key)
+		if err := os.Remove(filepath.Join(o.dir, entry.Key+outboxFileExt)); err != nil && !os.IsNotExist(err) {
+			utils.ErrorLogf("couldn't remove acknowledged event from the outbox: %v", err)
+		}
+	}
+}
+
+// retryLater schedules the next delivery attempt of an entry. It returns false if the entry was moved to the dead-letter
+// folder instead
+func (o *Outbox) retryLater(entry *OutboxEntry, cause error) bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if current, ok := o.entries[entry.Key]; !ok || current != entry {
+		return true // The entry was replaced by a newer copy of the same event
+	}
+	entry.Attempts++
+	entry.LastError = cause.Error()
+	if entry.Attempts >= o.maxAttempts {
+		o.deadLetter(entry)
+		return false
+	}
+	backoff := o.retryInterval
+	for i := 1; i < entry.Attempts && backoff < o.maxRetryInterval; i++ {
+		backoff *= 2
+	}
+	if backoff > o.maxRetryInterval {
+		backoff = o.maxRetryInterval
+	}
+	entry.NextAttempt = time.Now().Add(backoff).UnixMilli()
+	if err := o.write(entry); err != nil {
+		utils.ErrorLogf("couldn't update event in the outbox: %v", err)
+	}
+	return true
+}
+
+// deadLetter gives up on an entry. The caller holds the lock
+func (o *Outbox) deadLetter(entry *OutboxEntry) {
+	utils.ErrorLogf("event for endpoint [%v] moved to the outbox dead-letter folder after %v attempts: %v",
+		entry.Endpoint, entry.Attempts, entry.LastError)
+	delete(o.entries, entry.Key)
+	o.deadLetters++
+	path := filepath.Join(o.dir, entry.Key+outboxFileExt)
+	if err := o.write(entry); err != nil {
+		utils.ErrorLogf("couldn't update event in the outbox: %v", err)
+	}
+	if err := os.Rename(path, filepath.Join(o.dir, outboxDeadLetterDir, entry.Key+outboxFileExt)); err != nil {
+		utils.ErrorLogf("couldn't move event to the outbox dead-letter folder: %v", err)
+	}
+}
+
+func (o *Outbox) status() OutboxStatus {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	status := OutboxStatus{Pending: len(o.entries), DeadLetters: o.deadLetters}
+	var oldest, lastFailure int64
+	for _, entry := range o.entries {
+		if oldest == 0 || entry.CreatedAt < oldest {
+			oldest = entry.CreatedAt
+			status.Oldest = time.Unix(0, oldest).UnixMilli()
+		}
+		if entry.Attempts == 0 {
+			continue
+		}
+		status.Failed++
+		if entry.NextAttempt > lastFailure {
+			lastFailure = entry.NextAttempt
+			status.LastErr = entry.LastError
+		}
+	}
+	return status
+}
+
+func (o *Outbox) write(entry *OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(o.dir, entry.Key+outboxFileExt)
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (o *Outbox) load() error {
+	files, err := os.ReadDir(o.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), outboxFileExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(o.dir, file.Name()))
+		if err != nil {
+			return err
+		}
+		entry := &OutboxEntry{}
+		if err = json.Unmarshal(data, entry); err != nil || entry.Key == "" {
+			utils.ErrorLogf("skipping invalid outbox file [%v]", file.Name())
+			continue
+		}
+		entry.NextAttempt = 0 // Replay right away after a restart
+		o.entries[entry.Key] = entry
+	}
+	return nil
+}
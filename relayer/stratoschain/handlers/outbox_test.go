@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type deliveryRecorder struct {
+	delivered []string
+	failing   map[string]bool
+}
+
+func (r *deliveryRecorder) deliver(endpoint string, _ []byte) error {
+	if r.failing[endpoint] {
+		return errors.New("SP unreachable")
+	}
+	r.delivered = append(r.delivered, endpoint)
+	return nil
+}
+
+func newTestOutbox(t *testing.T, dir string, maxAttempts int) (*Outbox, *deliveryRecorder) {
+	o, err := newOutbox(dir, maxAttempts, 50*time.Millisecond, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &deliveryRecorder{failing: make(map[string]bool)}
+	o.deliver = recorder.deliver
+	return o, recorder
+}
+
+func TestOutboxRetry(t *testing.T) {
+	o, recorder := newTestOutbox(t, t.TempDir(), 10)
+	recorder.failing["first"] = true
+	for _, endpoint := range []string{"first", "second"} {
+		if err := o.add(endpoint, endpoint, map[string]string{"endpoint": endpoint}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o.deliverDue(context.Background())
+	if len(recorder.delivered) != 0 {
+		t.Fatalf("the events should be delivered in order, got %v", recorder.delivered)
+	}
+	status := o.status()
+	if status.Pending != 2 || status.Failed != 1 || status.LastErr == "" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if due := o.dueEntries(); len(due) != 1 || due[0].Endpoint != "second" {
+		t.Fatal("the failed event should wait for its backoff")
+	}
+
+	recorder.failing["first"] = false
+	time.Sleep(60 * time.Millisecond)
+	o.deliverDue(context.Background())
+	if len(recorder.delivered) != 2 || recorder.delivered[0] != "first" {
+		t.Fatalf("both events should be delivered in order, got %v", recorder.delivered)
+	}
+	if status = o.status(); status.Pending != 0 {
+		t.Fatalf("the acknowledged events should leave the outbox, got %+v", status)
+	}
+}
+
+func TestOutboxDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	o, recorder := newTestOutbox(t, dir, 2)
+	recorder.failing["rejected"] = true
+	if err := o.add("rejected", "rejected", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.add("accepted", "accepted", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	o.deliverDue(context.Background())
+	time.Sleep(60 * time.Millisecond)
+	o.deliverDue(context.Background())
+	status := o.status()
+	if status.Pending != 0 || status.DeadLetters != 1 {
+		t.Fatalf("the event should be dead-lettered after 2 attempts, got %+v", status)
+	}
+	if len(recorder.delivered) != 1 || recorder.delivered[0] != "accepted" {
+		t.Fatalf("the next events should be delivered once an event is dead-lettered, got %v", recorder.delivered)
+	}
+	files, err := os.ReadDir(filepath.Join(dir, outboxDeadLetterDir))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("the event should be kept in the dead-letter folder, got %v files, err %v", len(files), err)
+	}
+
+	reloaded, _ := newTestOutbox(t, dir, 2)
+	if status = reloaded.status(); status.Pending != 0 {
+		t.Fatalf("the dead letters shouldn't be replayed, got %+v", status)
+	}
+}
+
+func TestOutboxReload(t *testing.T) {
+	dir := t.TempDir()
+	o, recorder := newTestOutbox(t, dir, 10)
+	recorder.failing["endpoint"] = true
+	if err := o.add("key", "endpoint", map[string]int{"epoch": 1}); err != nil {
+		t.Fatal(err)
+	}
+	o.deliverDue(context.Background())
+
+	reloaded, recorder := newTestOutbox(t, dir, 10)
+	due := reloaded.dueEntries()
+	if len(due) != 1 || due[0].Attempts != 1 || string(due[0].Data) != `{"epoch":1}` {
+		t.Fatalf("the pending event should be replayed right away after a restart, got %+v", due)
+	}
+	reloaded.deliverDue(context.Background())
+	if len(recorder.delivered) != 1 {
+		t.Fatal("the reloaded event should be delivered")
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			t.Fatalf("the acknowledged event should be removed, found %v", file.Name())
+		}
+	}
+}
+
+func TestPostJson(t *testing.T) {
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusBadRequest {
+			_, _ = w.Write([]byte(`{"Msg":"invalid epoch"}`))
+		}
+	}))
+	defer server.Close()
+
+	if err := postJson(server.URL, "/volume/report", []byte("{}")); err != nil {
+		t.Fatalf("a 2xx response without body should acknowledge the event: %v", err)
+	}
+	status = http.StatusBadRequest
+	if err := postJson(server.URL, "/volume/report", []byte("{}")); err == nil {
+		t.Fatal("a 4xx response shouldn't acknowledge the event")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"io"
 	"math/big"
 	"net/http"
 	"strconv"
@@ -26,6 +27,9 @@ import (
 	"github.com/stratosnet/sds/sds-msg/relay"
 )
 
+// maxSpResponseSize is the part of the responses of the SP read to log them
+const maxSpResponseSize = 4096
+
 var Handlers map[string]func(coretypes.ResultEvent)
 var cache *utils.AutoCleanMap // Cache with a TTL to make sure each event is only handled once
 
@@ -169,7 +173,7 @@ func CreateResourceNodeMsgHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/pp/activated", req)
+		err := postToSP(key, "/pp/activated", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -215,7 +219,7 @@ func UpdateResourceNodeMsgHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/pp/updateBeneficiaryAddress", req)
+		err := postToSP(key, "/pp/updateBeneficiaryAddress", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -269,7 +273,7 @@ func UpdateResourceNodeDepositMsgHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/pp/updatedDeposit", req)
+		err := postToSP(key, "/pp/updatedDeposit", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -317,7 +321,7 @@ func UnbondingResourceNodeMsgHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/pp/unbonding", req)
+		err := postToSP(key, "/pp/unbonding", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -361,7 +365,7 @@ func CompleteUnbondingResourceNodeMsgHandler() func(event coretypes.ResultEvent)
 			return
 		}
 
-		err := postToSP("/pp/deactivated", req)
+		err := postToSP(key, "/pp/deactivated", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -422,7 +426,7 @@ func UpdateMetaNodeDepositMsgHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/chain/updatedDeposit", req)
+		err := postToSP(key, "/chain/updatedDeposit", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -470,7 +474,7 @@ func UnbondingMetaNodeMsgHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/chain/unbonding", req)
+		err := postToSP(key, "/chain/unbonding", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -530,7 +534,7 @@ func MetaNodeVoteMsgHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/chain/activated", req)
+		err := postToSP(key, "/chain/activated", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -597,7 +601,7 @@ func FileUploadMsgHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/pp/uploaded", req)
+		err := postToSP(key, "/pp/uploaded", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -638,7 +642,7 @@ func VolumeReportHandler() func(event coretypes.ResultEvent) {
 			return
 		}
 
-		err := postToSP("/volume/reported", req)
+		err := postToSP(key, "/volume/reported", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -700,7 +704,7 @@ func SlashingResourceNodeHandler() func(event coretypes.ResultEvent) {
 			PPList: slashedPPs,
 			TxHash: txHash,
 		}
-		err := postToSP("/pp/slashed", req)
+		err := postToSP(key, "/pp/slashed", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -771,7 +775,7 @@ func UpdateEffectiveDepositHandler() func(event coretypes.ResultEvent) {
 			PPList: updatedPPs,
 			TxHash: txHash,
 		}
-		err := postToSP("/pp/updatedEffectiveDeposit", req)
+		err := postToSP(key, "/pp/updatedEffectiveDeposit", req)
 		if err != nil {
 			utils.ErrorLog(err)
 			return
@@ -804,7 +808,7 @@ func processPrePayEvent(requiredAttributes []string, processedEvents []map[strin
 		return
 	}
 
-	err := postToSP("/pp/prepaid", req)
+	err := postToSP(key, "/pp/prepaid", req)
 	if err != nil {
 		utils.ErrorLog(err)
 		return
@@ -863,30 +867,50 @@ func processEvmTxEvents(events []abcitypes.Event) (
 	return nil, ""
 }
 
-func postToSP(endpoint string, data interface{}) error {
+// postToSP stores the event in the outbox, from which it is delivered to the SP until it is acknowledged
+func postToSP(key, endpoint string, data interface{}) error {
+	if outbox != nil {
+		return outbox.add(key, endpoint, data)
+	}
+
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return errors.New("Error when trying to marshal data to json: " + err.Error())
 	}
+	return deliverToSP(endpoint, jsonData)
+}
 
+func deliverToSP(endpoint string, jsonData []byte) error {
 	url := utils.Url{
 		Scheme: "http",
 		Host:   setting.Config.SDS.NetworkAddress,
 		Port:   setting.Config.SDS.ApiPort,
 		Path:   endpoint,
 	}
+	return postJson(url.String(true, true, true, false), endpoint, jsonData)
+}
 
-	resp, err := http.Post(url.String(true, true, true, false), "application/json", bytes.NewBuffer(jsonData))
+// postJson posts an event to an endpoint of the SP. Any 2xx status acknowledges the event, whatever the response body
+func postJson(url, endpoint string, jsonData []byte) error {
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return errors.New("Error when calling " + endpoint + " endpoint in SP node: " + err.Error())
 	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxSpResponseSize))
+	msg := interface{}(string(bytes.TrimSpace(body)))
 	var res map[string]interface{}
-	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return err
+	if err = json.Unmarshal(body, &res); err == nil {
+		msg = res["Msg"]
 	}
 
-	utils.Log(endpoint+" endpoint response from SP node", resp.StatusCode, res["Msg"])
+	utils.Log(endpoint+" endpoint response from SP node", resp.StatusCode, msg)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return errors.Errorf("%v endpoint in SP node returned status %v: %v", endpoint, resp.StatusCode, msg)
+	}
 	return nil
 }
 
@@ -0,0 +1,58 @@
+package stratoschain
+
+import (
+	"context"
+
+	abciv1beta1 "cosmossdk.io/api/cosmos/base/abci/v1beta1"
+
+	"github.com/stratosnet/sds/framework/utils"
+	"github.com/stratosnet/sds/tx-client/grpc"
+
+	"github.com/stratosnet/sds/relayer/stratoschain/handlers"
+)
+
+// HandleTxResponse runs the events of a tx through the relayer handlers. The handlers run in the background unless wait is true
+func HandleTxResponse(txResponse *abciv1beta1.TxResponse, wait bool) {
+	events := handlers.ExtractEventsFromTxResponse(txResponse)
+	for _, event := range events {
+		msgType := handlers.GetMsgType(event)
+		handler, ok := handlers.Handlers[msgType]
+		if !ok {
+			utils.ErrorLogf("No handler for event type [%v]", msgType)
+			continue
+		}
+		if wait {
+			handler(event)
+		} else {
+			go handler(event)
+		}
+	}
+}
+
+// SyncBlocks queries the txs of each block from fromHeight to toHeight included, and runs their events through the handlers.
+// It returns the last height that was entirely processed
+func SyncBlocks(ctx context.Context, fromHeight, toHeight int64) (int64, error) {
+	lastHeight := fromHeight - 1
+	for height := fromHeight; height <= toHeight; height++ {
+		if ctx.Err() != nil {
+			return lastHeight, ctx.Err()
+		}
+
+		txResponses, err := grpc.QueryTxsByHeight(height)
+		if err != nil {
+			return lastHeight, err
+		}
+		for _, txResponse := range txResponses {
+			if txResponse.Code != 0 {
+				continue // skip non-successful tx
+			}
+			HandleTxResponse(txResponse, true)
+		}
+		lastHeight = height
+
+		if len(txResponses) > 0 {
+			utils.DebugLogf("Synced %v txs from block %v", len(txResponses), height)
+		}
+	}
+	return lastHeight, nil
+}
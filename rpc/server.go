@@ -53,6 +53,14 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 	return s.services.registerName(name, receiver)
 }
 
+// SetAuthorizer installs a check run before every method call, including subscriptions. Calls are rejected
+// with an error response when it returns an error.
+func (s *Server) SetAuthorizer(authorize Authorizer) {
+	s.services.mu.Lock()
+	defer s.services.mu.Unlock()
+	s.services.authorize = authorize
+}
+
 // ServeCodec reads incoming requests from codec, calls the appropriate callback and writes
 // the response back using the given codec. It will block until the codec is closed or the
 // server is stopped. In either case the codec is closed.
@@ -21,10 +21,14 @@ var (
 )
 
 type serviceRegistry struct {
-	mu       sync.Mutex
-	services map[string]service
+	mu        sync.Mutex
+	services  map[string]service
+	authorize Authorizer
 }
 
+// Authorizer decides whether the caller identified by the context of a call may invoke a method
+type Authorizer func(ctx context.Context, method string) error
+
 // service represents a registered object.
 type service struct {
 	name          string               // name for service
@@ -87,6 +91,20 @@ func (r *serviceRegistry) callback(method string) *callback {
 	return r.services[elem[0]].callbacks[elem[1]]
 }
 
+// authorized returns an error if the authorizer of the registry denies the method call.
+func (r *serviceRegistry) authorized(ctx context.Context, method string) error {
+	r.mu.Lock()
+	authorize := r.authorize
+	r.mu.Unlock()
+	if authorize == nil {
+		return nil
+	}
+	if err := authorize(ctx, method); err != nil {
+		return &unauthorizedError{method: method, message: err.Error()}
+	}
+	return nil
+}
+
 // subscription returns a subscription callback in the given service.
 func (r *serviceRegistry) subscription(service, name string) *callback {
 	r.mu.Lock()
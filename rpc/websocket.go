@@ -46,7 +46,13 @@ func (s *Server) WebsocketHandler(allowedOrigins []string, ctx context.Context)
 			return
 		}
 		codec := newWebsocketCodec(conn)
-		s.ServeCodecWithContext(codec, ctx)
+		connCtx := ctx
+		if auth := r.Context().Value(ContextKey{Key: "auth"}); auth != nil {
+			// Keep the credentials checked during the upgrade for the calls made over the connection
+			connCtx = context.WithValue(ctx, ContextKey{Key: "auth"}, auth)
+		}
+		connCtx = context.WithValue(connCtx, ContextKey{Key: "remote"}, r.RemoteAddr)
+		s.ServeCodecWithContext(codec, connCtx)
 	})
 }
 
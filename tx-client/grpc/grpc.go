@@ -2,35 +2,92 @@ package grpc
 
 import (
 	"crypto/tls"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// the chain grpc server drops the clients pinging more often than every 5 minutes
+	KEEPALIVE_TIME    = 5 * time.Minute
+	KEEPALIVE_TIMEOUT = 20 * time.Second
 )
 
 var (
-	SERVER   string
-	INSECURE bool
+	endpoints         []Endpoint
+	connManager       *ConnManager
+	connManagerMutex  sync.Mutex
+	errNoGrpcEndpoint = errors.New("the stratos-chain GRPC server URL is not set")
 )
 
-func CreateGrpcConn() (*grpc.ClientConn, error) {
-	if SERVER == "" {
-		return nil, errors.New("the stratos-chain GRPC server URL is not set")
+// Endpoint is the grpc server of a chain node
+type Endpoint struct {
+	Address  string
+	Insecure bool
+}
+
+// SetEndpoints sets the chain grpc servers used by the queries and broadcasts of this package, the preferred one first.
+// Empty addresses are ignored
+func SetEndpoints(addresses []string, insecure bool) {
+	connManagerMutex.Lock()
+	defer connManagerMutex.Unlock()
+
+	endpoints = nil
+	for _, address := range addresses {
+		if address != "" {
+			endpoints = append(endpoints, Endpoint{Address: address, Insecure: insecure})
+		}
 	}
-	dialOptions, err := getDialOptions()
+	if connManager != nil {
+		connManager.Close()
+		connManager = nil
+	}
+}
+
+// getConnManager returns the connection manager of the endpoints, created on first use
+func getConnManager() (*ConnManager, error) {
+	connManagerMutex.Lock()
+	defer connManagerMutex.Unlock()
+
+	if connManager != nil {
+		return connManager, nil
+	}
+	if len(endpoints) == 0 {
+		return nil, errNoGrpcEndpoint
+	}
+	manager, err := NewConnManager(endpoints)
 	if err != nil {
 		return nil, err
 	}
-	return grpc.Dial(SERVER, dialOptions...)
+	connManager = manager
+	return connManager, nil
+}
+
+// CloseConnections closes the connections to the chain. They are opened again by the next query
+func CloseConnections() {
+	connManagerMutex.Lock()
+	defer connManagerMutex.Unlock()
+	if connManager != nil {
+		connManager.Close()
+		connManager = nil
+	}
+}
+
+func dial(endpoint Endpoint) (*grpc.ClientConn, error) {
+	return grpc.Dial(endpoint.Address, getDialOptions(endpoint)...)
 }
 
-func getDialOptions() (options []grpc.DialOption, err error) {
+func getDialOptions(endpoint Endpoint) (options []grpc.DialOption) {
 	options = make([]grpc.DialOption, 0)
 
 	var tpCredentials credentials.TransportCredentials
 
-	if INSECURE {
+	if endpoint.Insecure {
 		tpCredentials = insecure.NewCredentials()
 	} else {
 		tpCredentials = credentials.NewTLS(&tls.Config{})
@@ -39,5 +96,11 @@ func getDialOptions() (options []grpc.DialOption, err error) {
 	securityOpt := grpc.WithTransportCredentials(tpCredentials)
 	options = append(options, securityOpt)
 
+	keepaliveOpt := grpc.WithKeepaliveParams(keepalive.ClientParameters{
+		Time:    KEEPALIVE_TIME,
+		Timeout: KEEPALIVE_TIMEOUT,
+	})
+	options = append(options, keepaliveOpt)
+
 	return
 }
@@ -0,0 +1,243 @@
+package grpc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	cmtservice "cosmossdk.io/api/cosmos/base/tendermint/v1beta1"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/stratosnet/sds/framework/utils"
+)
+
+const (
+	HEALTH_CHECK_INTERVAL = 15 * time.Second
+	HEALTH_CHECK_TIMEOUT  = 5 * time.Second
+	QUERY_TIMEOUT         = 30 * time.Second
+	QUERY_MAX_ATTEMPTS    = 3
+	QUERY_RETRY_INTERVAL  = 500 * time.Millisecond
+	BROADCAST_TIMEOUT     = 30 * time.Second
+
+	// weight of the last health check in the latency of an endpoint, in percent
+	latencyWeight = 30
+)
+
+// CallFunc is a grpc call made on the connection chosen by the ConnManager. ctx carries the deadline of the call
+type CallFunc func(ctx context.Context, conn *grpc.ClientConn) error
+
+type endpointConn struct {
+	endpoint Endpoint
+	index    int
+	conn     *grpc.ClientConn
+
+	mtx     sync.Mutex
+	healthy bool
+	latency time.Duration
+}
+
+// ConnManager keeps a connection to each chain endpoint. Calls go to the healthy endpoint with the lowest latency,
+// and idempotent queries fail over to the other endpoints
+type ConnManager struct {
+	conns  []*endpointConn
+	cancel context.CancelFunc
+}
+
+// NewConnManager connects to the endpoints and starts checking their health
+func NewConnManager(endpoints []Endpoint) (*ConnManager, error) {
+	if len(endpoints) == 0 {
+		return nil, errNoGrpcEndpoint
+	}
+	m := &ConnManager{}
+	for i, endpoint := range endpoints {
+		conn, err := dial(endpoint)
+		if err != nil {
+			m.closeConns()
+			return nil, errors.Wrapf(err, "failed connecting to the chain grpc server %v", endpoint.Address)
+		}
+		// endpoints are healthy until a check or a call fails
+		m.conns = append(m.conns, &endpointConn{endpoint: endpoint, index: i, conn: conn, healthy: true})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	go m.checkHealth(ctx)
+	return m, nil
+}
+
+// Close stops the health checks and closes the connections
+func (m *ConnManager) Close() {
+	m.cancel()
+	m.closeConns()
+}
+
+func (m *ConnManager) closeConns() {
+	for _, c := range m.conns {
+		_ = c.conn.Close()
+	}
+}
+
+// Query makes an idempotent call. It is retried on another endpoint when the endpoint is unavailable or too slow
+func (m *ConnManager) Query(call CallFunc) error {
+	tried := make(map[*endpointConn]bool)
+	var err error
+	for attempt := 0; attempt < QUERY_MAX_ATTEMPTS; attempt++ {
+		if attempt > 0 {
+			time.Sleep(QUERY_RETRY_INTERVAL * time.Duration(attempt))
+		}
+		c := m.pick(tried)
+		if c == nil {
+			// every endpoint failed once, try them again
+			tried = make(map[*endpointConn]bool)
+			c = m.pick(tried)
+		}
+		tried[c] = true
+
+		err = m.call(c, QUERY_TIMEOUT, call)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		utils.DebugLogf("chain grpc query failed on %v, attempt %v: %v", c.endpoint.Address, attempt+1, err)
+	}
+	return err
+}
+
+// Send makes a call that must not be repeated, like broadcasting a tx, on the best endpoint
+func (m *ConnManager) Send(timeout time.Duration, call CallFunc) error {
+	return m.call(m.pick(nil), timeout, call)
+}
+
+func (m *ConnManager) call(c *endpointConn, timeout time.Duration, call CallFunc) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := call(ctx, c.conn)
+	if err != nil && isRetryable(err) {
+		c.setHealth(false, 0, err)
+	}
+	return err
+}
+
+// pick returns the healthy endpoint with the lowest latency, or the first unhealthy one when none is healthy.
+// The endpoints in skip are left out
+func (m *ConnManager) pick(skip map[*endpointConn]bool) *endpointConn {
+	var healthy, unhealthy []*endpointConn
+	latencies := make(map[*endpointConn]time.Duration)
+	for _, c := range m.conns {
+		if skip[c] {
+			continue
+		}
+		c.mtx.Lock()
+		isHealthy, latency := c.healthy, c.latency
+		c.mtx.Unlock()
+		if isHealthy {
+			healthy = append(healthy, c)
+			latencies[c] = latency
+		} else {
+			unhealthy = append(unhealthy, c)
+		}
+	}
+	if len(healthy) > 0 {
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return latencies[healthy[i]] < latencies[healthy[j]]
+		})
+		return healthy[0]
+	}
+	if len(unhealthy) > 0 {
+		return unhealthy[0]
+	}
+	return nil
+}
+
+func (m *ConnManager) checkHealth(ctx context.Context) {
+	ticker := time.NewTicker(HEALTH_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for _, c := range m.conns {
+			wg.Add(1)
+			go func(c *endpointConn) {
+				defer wg.Done()
+				c.check(ctx)
+			}(c)
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check asks the node whether it is still syncing, and measures the latency of the endpoint
+func (c *endpointConn) check(ctx context.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx, HEALTH_CHECK_TIMEOUT)
+	defer cancel()
+	start := time.Now()
+	resp, err := cmtservice.NewServiceClient(c.conn).GetSyncing(checkCtx, &cmtservice.GetSyncingRequest{})
+	if ctx.Err() != nil {
+		return
+	}
+	switch {
+	case err != nil:
+		c.setHealth(false, 0, err)
+	case resp.GetSyncing():
+		c.setHealth(false, 0, errors.New("the node is syncing"))
+	default:
+		c.setHealth(true, time.Since(start), nil)
+	}
+}
+
+func (c *endpointConn) setHealth(healthy bool, latency time.Duration, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if healthy != c.healthy {
+		if healthy {
+			utils.Logf("chain grpc server %v is available again", c.endpoint.Address)
+		} else {
+			utils.ErrorLogf("chain grpc server %v is unavailable: %v", c.endpoint.Address, err)
+		}
+	}
+	c.healthy = healthy
+	if !healthy {
+		return
+	}
+	if c.latency == 0 {
+		c.latency = latency
+	} else {
+		c.latency = (c.latency*(100-latencyWeight) + latency*latencyWeight) / 100
+	}
+}
+
+// isRetryable tells whether a call failed because of the endpoint, rather than the request
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// query makes an idempotent call with the connection manager of the endpoints
+func query(call CallFunc) error {
+	m, err := getConnManager()
+	if err != nil {
+		return err
+	}
+	return m.Query(call)
+}
+
+// send makes a call that must not be repeated with the connection manager of the endpoints
+func send(timeout time.Duration, call CallFunc) error {
+	m, err := getConnManager()
+	if err != nil {
+		return err
+	}
+	return m.Send(timeout, call)
+}
@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testConnManager(latencies ...time.Duration) *ConnManager {
+	m := &ConnManager{}
+	for i, latency := range latencies {
+		m.conns = append(m.conns, &endpointConn{index: i, healthy: true, latency: latency})
+	}
+	return m
+}
+
+func TestPick(t *testing.T) {
+	m := testConnManager(30*time.Millisecond, 10*time.Millisecond, 20*time.Millisecond)
+	if c := m.pick(nil); c.index != 1 {
+		t.Fatalf("the fastest endpoint should be picked, got %v", c.index)
+	}
+	if c := m.pick(map[*endpointConn]bool{m.conns[1]: true}); c.index != 2 {
+		t.Fatalf("the skipped endpoints should be left out, got %v", c.index)
+	}
+
+	for _, c := range m.conns {
+		c.healthy = false
+	}
+	m.conns[0].healthy = true
+	if c := m.pick(nil); c.index != 0 {
+		t.Fatalf("the only healthy endpoint should be picked, got %v", c.index)
+	}
+	m.conns[0].healthy = false
+	if c := m.pick(nil); c.index != 0 {
+		t.Fatalf("the first endpoint should be picked when none is healthy, got %v", c.index)
+	}
+}
+
+func TestQueryFailover(t *testing.T) {
+	m := testConnManager(0, 0)
+	var calls int
+	err := m.Query(func(ctx context.Context, conn *grpc.ClientConn) error {
+		calls++
+		if calls == 1 {
+			return status.Error(codes.Unavailable, "connection refused")
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("the query should succeed on the second endpoint, got %v after %v calls", err, calls)
+	}
+	if m.conns[0].healthy || !m.conns[1].healthy {
+		t.Fatal("the failed endpoint should be unhealthy")
+	}
+
+	calls = 0
+	err = m.Query(func(ctx context.Context, conn *grpc.ClientConn) error {
+		calls++
+		return status.Error(codes.NotFound, "tx not found")
+	})
+	if status.Code(err) != codes.NotFound || calls != 1 {
+		t.Fatalf("a failed request should not be retried, got %v after %v calls", err, calls)
+	}
+	if !m.conns[1].healthy {
+		t.Fatal("a failed request should not make the endpoint unhealthy")
+	}
+}
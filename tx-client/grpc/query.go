@@ -8,9 +8,11 @@ import (
 	"github.com/pkg/errors"
 	potv1 "github.com/stratosnet/stratos-chain/api/stratos/pot/v1"
 	sdsv1 "github.com/stratosnet/stratos-chain/api/stratos/sds/v1"
+	"google.golang.org/grpc"
 
 	authv1beta1 "cosmossdk.io/api/cosmos/auth/v1beta1"
 	abciv1beta1 "cosmossdk.io/api/cosmos/base/abci/v1beta1"
+	cmtservice "cosmossdk.io/api/cosmos/base/tendermint/v1beta1"
 	stakingv1beta1 "cosmossdk.io/api/cosmos/staking/v1beta1"
 	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
 
@@ -22,17 +24,13 @@ import (
 )
 
 func QueryAccount(address string) (*authv1beta1.BaseAccount, error) {
-	conn, err := CreateGrpcConn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	client := authv1beta1.NewQueryClient(conn)
-	ctx := context.Background()
-	req := authv1beta1.QueryAccountRequest{Address: address}
-
-	resp, err := client.Account(ctx, &req)
+	var resp *authv1beta1.QueryAccountResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := authv1beta1.NewQueryClient(conn)
+		req := authv1beta1.QueryAccountRequest{Address: address}
+		resp, err = client.Account(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -46,15 +44,13 @@ func QueryAccount(address string) (*authv1beta1.BaseAccount, error) {
 }
 
 func QueryResourceNode(p2pAddress string) (*registerv1.ResourceNode, error) {
-	conn, err := CreateGrpcConn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-	client := registerv1.NewQueryClient(conn)
-	ctx := context.Background()
-	req := registerv1.QueryResourceNodeRequest{NetworkAddr: p2pAddress}
-	resp, err := client.ResourceNode(ctx, &req)
+	var resp *registerv1.QueryResourceNodeResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := registerv1.NewQueryClient(conn)
+		req := registerv1.QueryResourceNodeRequest{NetworkAddr: p2pAddress}
+		resp, err = client.ResourceNode(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -67,12 +63,6 @@ func QueryResourceNodeState(p2pAddress string) (state types.ResourceNodeState, e
 		IsActive:  msgtypes.PP_INACTIVE,
 		Suspended: true,
 	}
-	conn, err := CreateGrpcConn()
-	if err != nil {
-		return state, err
-	}
-	defer conn.Close()
-
 	resourceNode, err := QueryResourceNode(p2pAddress)
 	if err != nil {
 		return state, err
@@ -102,15 +92,13 @@ func QueryResourceNodeState(p2pAddress string) (state types.ResourceNodeState, e
 }
 
 func QueryMetaNode(p2pAddress string) (*registerv1.MetaNode, error) {
-	conn, err := CreateGrpcConn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-	client := registerv1.NewQueryClient(conn)
-	ctx := context.Background()
-	req := registerv1.QueryMetaNodeRequest{NetworkAddr: p2pAddress}
-	resp, err := client.MetaNode(ctx, &req)
+	var resp *registerv1.QueryMetaNodeResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := registerv1.NewQueryClient(conn)
+		req := registerv1.QueryMetaNodeRequest{NetworkAddr: p2pAddress}
+		resp, err = client.MetaNode(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -119,43 +107,88 @@ func QueryMetaNode(p2pAddress string) (*registerv1.MetaNode, error) {
 }
 
 func QueryTxByHash(txHash string) (*abciv1beta1.TxResponse, error) {
-	conn, err := CreateGrpcConn()
+	txResponse, err := QueryTxResultByHash(txHash)
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
-	client := txv1beta1.NewServiceClient(conn)
-	ctx := context.Background()
-	req := txv1beta1.GetTxRequest{Hash: txHash}
-	resp, err := client.GetTx(ctx, &req)
+	utils.Logf("--- resp is %v", txResponse)
+	// skip non-successful tx
+	if txResponse.Code != 0 {
+		errMsg := fmt.Sprintf("Tx with hash[%v] failed: [%v]", txHash, txResponse.String())
+		return nil, errors.New(errMsg)
+	}
+	return txResponse, nil
+}
+
+// QueryTxResultByHash returns the response of an included tx, whether it succeeded or not
+func QueryTxResultByHash(txHash string) (*abciv1beta1.TxResponse, error) {
+	var resp *txv1beta1.GetTxResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := txv1beta1.NewServiceClient(conn)
+		req := txv1beta1.GetTxRequest{Hash: txHash}
+		resp, err = client.GetTx(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if resp == nil {
+	if resp == nil || resp.TxResponse == nil {
 		errMsg := fmt.Sprintf("QueryTxByHash returned nil response for transaction hash [%v]", txHash)
 		return nil, errors.New(errMsg)
 	}
-	utils.Logf("--- resp is %v", *resp.TxResponse)
-	// skip non-successful tx
-	if resp.GetTxResponse().Code != 0 {
-		errMsg := fmt.Sprintf("Tx with hash[%v] failed: [%v]", txHash, resp.GetTxResponse().String())
-		return nil, errors.New(errMsg)
-	}
 	return resp.TxResponse, nil
 }
 
-func QueryVolumeReport(epoch int64) (*potv1.QueryVolumeReportResponse, error) {
-	conn, err := CreateGrpcConn()
+// QueryTxsByHeight returns the responses of all the txs included in the block at the given height
+func QueryTxsByHeight(height int64) ([]*abciv1beta1.TxResponse, error) {
+	const pageSize = 100
+	heightQuery := fmt.Sprintf("tx.height=%v", height)
+	var txResponses []*abciv1beta1.TxResponse
+	for page := uint64(1); ; page++ {
+		var resp *txv1beta1.GetTxsEventResponse
+		err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+			client := txv1beta1.NewServiceClient(conn)
+			req := txv1beta1.GetTxsEventRequest{
+				Events: []string{heightQuery},
+				Page:   page,
+				Limit:  pageSize,
+			}
+			resp, err = client.GetTxsEvent(ctx, &req)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		txResponses = append(txResponses, resp.GetTxResponses()...)
+		if len(resp.GetTxResponses()) < pageSize || uint64(len(txResponses)) >= resp.GetTotal() {
+			return txResponses, nil
+		}
+	}
+}
+
+// QueryLatestBlockHeight returns the height of the latest block committed by stratos-chain
+func QueryLatestBlockHeight() (int64, error) {
+	var resp *cmtservice.GetLatestBlockResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := cmtservice.NewServiceClient(conn)
+		resp, err = client.GetLatestBlock(ctx, &cmtservice.GetLatestBlockRequest{})
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer conn.Close()
-	client := potv1.NewQueryClient(conn)
-	ctx := context.Background()
-	req := potv1.QueryVolumeReportRequest{Epoch: epoch}
+	return resp.GetBlock().GetHeader().GetHeight(), nil
+}
 
-	resp, err := client.VolumeReport(ctx, &req)
+func QueryVolumeReport(epoch int64) (*potv1.QueryVolumeReportResponse, error) {
+	var resp *potv1.QueryVolumeReportResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := potv1.NewQueryClient(conn)
+		req := potv1.QueryVolumeReportRequest{Epoch: epoch}
+		resp, err = client.VolumeReport(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -164,16 +197,13 @@ func QueryVolumeReport(epoch int64) (*potv1.QueryVolumeReportResponse, error) {
 
 // QueryNozSupply queries the remaining ozone limit and the total ozone supply from stchain
 func QueryNozSupply() (*sdsv1.QueryNozSupplyResponse, error) {
-	conn, err := CreateGrpcConn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	client := sdsv1.NewQueryClient(conn)
-	ctx := context.Background()
-	req := sdsv1.QueryNozSupplyRequest{}
-	resp, err := client.NozSupply(ctx, &req)
+	var resp *sdsv1.QueryNozSupplyResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := sdsv1.NewQueryClient(conn)
+		req := sdsv1.QueryNozSupplyRequest{}
+		resp, err = client.NozSupply(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -182,16 +212,13 @@ func QueryNozSupply() (*sdsv1.QueryNozSupplyResponse, error) {
 
 // SimPrepay simulate the prepay and get the estimated noz
 func SimPrepay(amount types.Coin) (*sdsv1.QuerySimPrepayResponse, error) {
-	conn, err := CreateGrpcConn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	client := sdsv1.NewQueryClient(conn)
-	ctx := context.Background()
-	req := sdsv1.QuerySimPrepayRequest{Amount: amount.String()}
-	resp, err := client.SimPrepay(ctx, &req)
+	var resp *sdsv1.QuerySimPrepayResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := sdsv1.NewQueryClient(conn)
+		req := sdsv1.QuerySimPrepayRequest{Amount: amount.String()}
+		resp, err = client.SimPrepay(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -5,21 +5,19 @@ import (
 
 	abciv1beta1 "cosmossdk.io/api/cosmos/base/abci/v1beta1"
 	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
+	"google.golang.org/grpc"
+
 	"github.com/stratosnet/sds/framework/utils"
 )
 
 func BroadcastTx(txBytes []byte, mode txv1beta1.BroadcastMode) (*txv1beta1.BroadcastTxResponse, error) {
-	conn, err := CreateGrpcConn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	client := txv1beta1.NewServiceClient(conn)
-	ctx := context.Background()
-	req := txv1beta1.BroadcastTxRequest{TxBytes: txBytes, Mode: mode}
-
-	resp, err := client.BroadcastTx(ctx, &req)
+	var resp *txv1beta1.BroadcastTxResponse
+	err := send(BROADCAST_TIMEOUT, func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := txv1beta1.NewServiceClient(conn)
+		req := txv1beta1.BroadcastTxRequest{TxBytes: txBytes, Mode: mode}
+		resp, err = client.BroadcastTx(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -30,17 +28,13 @@ func BroadcastTx(txBytes []byte, mode txv1beta1.BroadcastMode) (*txv1beta1.Broad
 }
 
 func Simulate(txBytes []byte) (*abciv1beta1.GasInfo, error) {
-	conn, err := CreateGrpcConn()
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-
-	client := txv1beta1.NewServiceClient(conn)
-	ctx := context.Background()
-	req := txv1beta1.SimulateRequest{TxBytes: txBytes}
-
-	resp, err := client.Simulate(ctx, &req)
+	var resp *txv1beta1.SimulateResponse
+	err := query(func(ctx context.Context, conn *grpc.ClientConn) (err error) {
+		client := txv1beta1.NewServiceClient(conn)
+		req := txv1beta1.SimulateRequest{TxBytes: txBytes}
+		resp, err = client.Simulate(ctx, &req)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -10,6 +10,5 @@ const (
 )
 
 func initGrpcTestSettings() {
-	grpc.SERVER = grpcServerTest
-	grpc.INSECURE = grpcInsecureTest
+	grpc.SetEndpoints([]string{grpcServerTest}, grpcInsecureTest)
 }
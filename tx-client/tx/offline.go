@@ -0,0 +1,400 @@
+package tx
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/cosmos/cosmos-proto/anyutil"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"cosmossdk.io/api/cosmos/crypto/multisig"
+	multisigv1beta1 "cosmossdk.io/api/cosmos/crypto/multisig/v1beta1"
+	signingv1beta1 "cosmossdk.io/api/cosmos/tx/signing/v1beta1"
+	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
+	sdksecp256k1 "github.com/stratosnet/stratos-chain/api/stratos/crypto/v1/ethsecp256k1"
+
+	fwsecp256k1 "github.com/stratosnet/sds/framework/crypto/secp256k1"
+	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+
+	"github.com/stratosnet/sds/tx-client/grpc"
+	"github.com/stratosnet/sds/tx-client/types"
+	authsigning "github.com/stratosnet/sds/tx-client/types/auth/signing"
+	"github.com/stratosnet/sds/tx-client/types/tx/signing"
+)
+
+// OfflineTx is a tx with what its signer needs to sign it without a connection to the chain. The signer is the
+// account of the messages, possibly a multisig account
+type OfflineTx struct {
+	ChainId       string
+	Signer        string
+	AccountNumber uint64
+	Sequence      uint64
+	Tx            *txv1beta1.Tx
+}
+
+type offlineTxJson struct {
+	ChainId       string          `json:"chain_id"`
+	Signer        string          `json:"signer"`
+	AccountNumber uint64          `json:"account_number,string"`
+	Sequence      uint64          `json:"sequence,string"`
+	Tx            json.RawMessage `json:"tx"`
+}
+
+// OfflineSignature is the signature of an OfflineTx by a member of its multisig account
+type OfflineSignature struct {
+	PubKey    string `json:"pub_key"` // bech32 wallet public key of the member
+	Signature []byte `json:"signature"`
+}
+
+// MultisigKey is the key of a multisig account, with the members signing a tx
+type MultisigKey struct {
+	Threshold uint32
+	PubKeys   []fwcryptotypes.PubKey
+	Signers   []int // indexes in PubKeys of the members signing, the first Threshold members when empty
+}
+
+func (o *OfflineTx) MarshalJSON() ([]byte, error) {
+	txJson, err := protojson.Marshal(o.Tx)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(offlineTxJson{
+		ChainId:       o.ChainId,
+		Signer:        o.Signer,
+		AccountNumber: o.AccountNumber,
+		Sequence:      o.Sequence,
+		Tx:            txJson,
+	})
+}
+
+func (o *OfflineTx) UnmarshalJSON(data []byte) error {
+	var txJson offlineTxJson
+	if err := json.Unmarshal(data, &txJson); err != nil {
+		return err
+	}
+	o.ChainId = txJson.ChainId
+	o.Signer = txJson.Signer
+	o.AccountNumber = txJson.AccountNumber
+	o.Sequence = txJson.Sequence
+	o.Tx = &txv1beta1.Tx{}
+	return protojson.Unmarshal(txJson.Tx, o.Tx)
+}
+
+// GenerateOfflineTx builds an unsigned tx for the signer account, with its account number and sequence from the chain.
+// The gas of a multisig tx can't be simulated
+func GenerateOfflineTx(msgs []*anypb.Any, txFee types.TxFee, memo, chainId, signer string, multisigKey *MultisigKey,
+	gasAdjustment float64) (*OfflineTx, error) {
+
+	if len(msgs) == 0 {
+		return nil, errors.New("cannot build tx: no msgs")
+	}
+	account, err := grpc.QueryAccount(signer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed fetching the account info of %v", signer)
+	}
+
+	_, unsignedTx := CreateTxConfigAndTxBuilder()
+	setMsgInfosToTxBuilder(unsignedTx, msgs, txFee.Fee, txFee.Gas, memo)
+	offlineTx := &OfflineTx{
+		ChainId:       chainId,
+		Signer:        signer,
+		AccountNumber: account.GetAccountNumber(),
+		Sequence:      account.GetSequence(),
+		Tx:            unsignedTx,
+	}
+
+	if multisigKey != nil {
+		if txFee.Simulate {
+			return nil, errors.New("the gas of a multisig tx must be given")
+		}
+		signerInfo, err := multisigSignerInfo(multisigKey, offlineTx.Sequence)
+		if err != nil {
+			return nil, err
+		}
+		unsignedTx.AuthInfo.SignerInfos = []*txv1beta1.SignerInfo{signerInfo}
+		return offlineTx, nil
+	}
+
+	if txFee.Simulate {
+		// The chain simulates a tx without public key nor signature
+		_, err = SetSignatures(unsignedTx, signing.SignatureV2{
+			Data:     &signing.SingleSignatureData{SignMode: signingv1beta1.SignMode_SIGN_MODE_DIRECT},
+			Sequence: offlineTx.Sequence,
+		})
+		if err != nil {
+			return nil, err
+		}
+		txBytes, err := proto.Marshal(unsignedTx)
+		if err != nil {
+			return nil, err
+		}
+		gasInfo, err := grpc.Simulate(txBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get gasInfo from chain")
+		}
+		unsignedTx.AuthInfo.Fee.GasLimit = uint64(float64(gasInfo.GasUsed) * gasAdjustment)
+		unsignedTx.AuthInfo.SignerInfos = nil
+		unsignedTx.Signatures = nil
+	}
+	return offlineTx, nil
+}
+
+// multisigSignerInfo returns the signer info of a multisig account. The members signing are set in advance, so that
+// all of them sign the same sign doc
+func multisigSignerInfo(multisigKey *MultisigKey, sequence uint64) (*txv1beta1.SignerInfo, error) {
+	if multisigKey.Threshold == 0 || int(multisigKey.Threshold) > len(multisigKey.PubKeys) {
+		return nil, errors.Errorf("invalid multisig threshold %v for %v keys", multisigKey.Threshold, len(multisigKey.PubKeys))
+	}
+	signers := multisigKey.Signers
+	if len(signers) == 0 {
+		for i := 0; i < int(multisigKey.Threshold); i++ {
+			signers = append(signers, i)
+		}
+	}
+	if len(signers) < int(multisigKey.Threshold) {
+		return nil, errors.Errorf("%v members can't reach the multisig threshold %v", len(signers), multisigKey.Threshold)
+	}
+
+	legacyPubKey := &multisig.LegacyAminoPubKey{Threshold: multisigKey.Threshold}
+	for _, pubKey := range multisigKey.PubKeys {
+		pubKeyAny, err := getPackedPubKeyAny(pubKey)
+		if err != nil {
+			return nil, err
+		}
+		legacyPubKey.PublicKeys = append(legacyPubKey.PublicKeys, pubKeyAny)
+	}
+	pubKeyAny, err := anyutil.New(legacyPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	bitArray := newCompactBitArray(len(multisigKey.PubKeys))
+	for _, i := range signers {
+		if i < 0 || i >= len(multisigKey.PubKeys) {
+			return nil, errors.Errorf("invalid multisig member index %v", i)
+		}
+		if bitArrayGet(bitArray, i) {
+			return nil, errors.Errorf("multisig member %v is set twice", i)
+		}
+		bitArraySet(bitArray, i)
+	}
+	modeInfos := make([]*txv1beta1.ModeInfo, len(signers))
+	for i := range modeInfos {
+		modeInfos[i] = &txv1beta1.ModeInfo{
+			Sum: &txv1beta1.ModeInfo_Single_{
+				Single: &txv1beta1.ModeInfo_Single{Mode: signingv1beta1.SignMode_SIGN_MODE_DIRECT},
+			},
+		}
+	}
+
+	return &txv1beta1.SignerInfo{
+		PublicKey: pubKeyAny,
+		ModeInfo: &txv1beta1.ModeInfo{
+			Sum: &txv1beta1.ModeInfo_Multi_{
+				Multi: &txv1beta1.ModeInfo_Multi{Bitarray: bitArray, ModeInfos: modeInfos},
+			},
+		},
+		Sequence: sequence,
+	}, nil
+}
+
+// IsMultisig tells whether the tx is signed by a multisig account
+func (o *OfflineTx) IsMultisig() bool {
+	signerInfos := o.Tx.GetAuthInfo().GetSignerInfos()
+	return len(signerInfos) == 1 && signerInfos[0].GetModeInfo().GetMulti() != nil
+}
+
+// Sign signs the tx of a single signer account
+func (o *OfflineTx) Sign(signer types.TxSigner) error {
+	if o.IsMultisig() {
+		return errors.New("the tx of a multisig account is signed with SignMultisig")
+	}
+	if address := fwtypes.WalletAddress(signer.PubKey().Address()).String(); address != o.Signer {
+		return errors.Errorf("the tx must be signed by %v, not %v", o.Signer, address)
+	}
+
+	pubKeyAny, err := getPackedPubKeyAny(signer.PubKey())
+	if err != nil {
+		return err
+	}
+	txConfig, _ := CreateTxConfigAndTxBuilder()
+	signMode := txConfig.SignModeHandler().DefaultMode()
+	_, err = SetSignatures(o.Tx, signing.SignatureV2{
+		PubKey:   pubKeyAny,
+		Data:     &signing.SingleSignatureData{SignMode: signMode},
+		Sequence: o.Sequence,
+	})
+	if err != nil {
+		return err
+	}
+
+	signerData := authsigning.SignerData{
+		ChainID:       o.ChainId,
+		AccountNumber: o.AccountNumber,
+		Sequence:      o.Sequence,
+	}
+	sigV2, err := SignWithSigner(signMode, signerData, o.Tx, signer, txConfig, o.Sequence)
+	if err != nil {
+		return err
+	}
+	_, err = SetSignatures(o.Tx, sigV2)
+	return err
+}
+
+// SignMultisig signs the tx of a multisig account as one of the members chosen to sign it
+func (o *OfflineTx) SignMultisig(signer types.TxSigner) (*OfflineSignature, error) {
+	members, signers, err := o.multisigMembers()
+	if err != nil {
+		return nil, err
+	}
+	if memberIndex(members, signers, signer.PubKey()) < 0 {
+		return nil, errors.New("the key is not one of the multisig members chosen to sign the tx")
+	}
+
+	signBytes, err := o.signBytes()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.SignTx(signBytes)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := fwtypes.WalletPubKeyToBech32(signer.PubKey())
+	if err != nil {
+		return nil, err
+	}
+	return &OfflineSignature{PubKey: pubKey, Signature: signature}, nil
+}
+
+// CombineSignatures adds the signatures of the multisig members to the tx. Each member chosen to sign must have
+// signed it
+func (o *OfflineTx) CombineSignatures(signatures []*OfflineSignature) error {
+	members, signers, err := o.multisigMembers()
+	if err != nil {
+		return err
+	}
+	signBytes, err := o.signBytes()
+	if err != nil {
+		return err
+	}
+
+	memberSigs := make(map[int][]byte)
+	for _, sig := range signatures {
+		pubKey, err := fwtypes.WalletPubKeyFromBech32(sig.PubKey)
+		if err != nil {
+			return errors.Wrapf(err, "invalid public key %v", sig.PubKey)
+		}
+		index := memberIndex(members, signers, pubKey)
+		if index < 0 {
+			return errors.Errorf("%v is not one of the multisig members chosen to sign the tx", sig.PubKey)
+		}
+		if !pubKey.VerifySignature(signBytes, sig.Signature) {
+			return errors.Errorf("invalid signature from %v", sig.PubKey)
+		}
+		memberSigs[index] = sig.Signature
+	}
+
+	multiSig := &multisigv1beta1.MultiSignature{}
+	for _, index := range signers {
+		sig, found := memberSigs[index]
+		if !found {
+			return errors.Errorf("missing the signature of multisig member %v", index)
+		}
+		multiSig.Signatures = append(multiSig.Signatures, sig)
+	}
+	sigBytes, err := proto.Marshal(multiSig)
+	if err != nil {
+		return err
+	}
+	o.Tx.Signatures = [][]byte{sigBytes}
+	return nil
+}
+
+// TxBytes returns the bytes of a signed tx, to broadcast
+func (o *OfflineTx) TxBytes() ([]byte, error) {
+	signerInfos := o.Tx.GetAuthInfo().GetSignerInfos()
+	if len(signerInfos) == 0 || len(o.Tx.Signatures) != len(signerInfos) {
+		return nil, errors.New("the tx is not signed")
+	}
+	for _, sig := range o.Tx.Signatures {
+		if len(sig) == 0 {
+			return nil, errors.New("the tx is not signed")
+		}
+	}
+	return proto.Marshal(o.Tx)
+}
+
+func (o *OfflineTx) signBytes() ([]byte, error) {
+	txConfig, _ := CreateTxConfigAndTxBuilder()
+	signerData := authsigning.SignerData{
+		ChainID:       o.ChainId,
+		AccountNumber: o.AccountNumber,
+		Sequence:      o.Sequence,
+	}
+	return txConfig.SignModeHandler().GetSignBytes(txConfig.SignModeHandler().DefaultMode(), signerData, o.Tx)
+}
+
+// multisigMembers returns the public keys of the multisig account, and the indexes of the members chosen to sign
+func (o *OfflineTx) multisigMembers() ([]fwcryptotypes.PubKey, []int, error) {
+	if !o.IsMultisig() {
+		return nil, nil, errors.New("the tx is not signed by a multisig account")
+	}
+	signerInfo := o.Tx.AuthInfo.SignerInfos[0]
+	legacyPubKey := &multisig.LegacyAminoPubKey{}
+	if err := signerInfo.GetPublicKey().UnmarshalTo(legacyPubKey); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid multisig public key")
+	}
+
+	var members []fwcryptotypes.PubKey
+	for _, pubKeyAny := range legacyPubKey.PublicKeys {
+		pubKey := &sdksecp256k1.PubKey{}
+		if err := pubKeyAny.UnmarshalTo(pubKey); err != nil {
+			return nil, nil, errors.Wrapf(err, "unsupported multisig member key %v", pubKeyAny.TypeUrl)
+		}
+		members = append(members, fwsecp256k1.MakePubKey(pubKey.Key))
+	}
+
+	bitArray := signerInfo.ModeInfo.GetMulti().GetBitarray()
+	var signers []int
+	for i := range members {
+		if bitArrayGet(bitArray, i) {
+			signers = append(signers, i)
+		}
+	}
+	sort.Ints(signers)
+	return members, signers, nil
+}
+
+// memberIndex returns the index of a multisig member chosen to sign, or -1
+func memberIndex(members []fwcryptotypes.PubKey, signers []int, pubKey fwcryptotypes.PubKey) int {
+	for _, i := range signers {
+		if bytes.Equal(members[i].Bytes(), pubKey.Bytes()) {
+			return i
+		}
+	}
+	return -1
+}
+
+// newCompactBitArray returns a bit array of the given size, encoded like the bit arrays of cosmos multisig
+func newCompactBitArray(size int) *multisigv1beta1.CompactBitArray {
+	return &multisigv1beta1.CompactBitArray{
+		ExtraBitsStored: uint32(size % 8),
+		Elems:           make([]byte, (size+7)/8),
+	}
+}
+
+func bitArraySet(bitArray *multisigv1beta1.CompactBitArray, i int) {
+	bitArray.Elems[i>>3] |= 1 << uint8(7-i%8)
+}
+
+func bitArrayGet(bitArray *multisigv1beta1.CompactBitArray, i int) bool {
+	if bitArray == nil || i>>3 >= len(bitArray.Elems) {
+		return false
+	}
+	return bitArray.Elems[i>>3]&(1<<uint8(7-i%8)) > 0
+}
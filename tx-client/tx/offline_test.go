@@ -0,0 +1,127 @@
+package tx
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cosmos/cosmos-proto/anyutil"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	txv1beta1 "cosmossdk.io/api/cosmos/tx/v1beta1"
+	sdkmath "cosmossdk.io/math"
+
+	"github.com/stratosnet/sds/framework/crypto/secp256k1"
+	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
+	fwtypes "github.com/stratosnet/sds/framework/types"
+
+	"github.com/stratosnet/sds/tx-client/types"
+)
+
+func newTestOfflineTx(t *testing.T, signer string) *OfflineTx {
+	sender, err := fwtypes.WalletAddressFromBech32(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgAny, err := anyutil.New(BuildSendMsg(sender, sender, types.Coin{Denom: "wei", Amount: sdkmath.NewInt(1000)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, unsignedTx := CreateTxConfigAndTxBuilder()
+	setMsgInfosToTxBuilder(unsignedTx, []*anypb.Any{msgAny}, types.Coin{Denom: "wei", Amount: sdkmath.NewInt(10)}, 200000, "")
+	return &OfflineTx{ChainId: "stratos-test", Signer: signer, AccountNumber: 7, Sequence: 3, Tx: unsignedTx}
+}
+
+// jsonRoundTrip writes and reads back a tx, like the files passed between the machines
+func jsonRoundTrip(t *testing.T, offlineTx *OfflineTx) *OfflineTx {
+	data, err := json.Marshal(offlineTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &OfflineTx{}
+	if err = json.Unmarshal(data, result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestOfflineSign(t *testing.T) {
+	privKey, err := secp256k1.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := fwtypes.WalletAddress(privKey.PubKey().Address()).String()
+	offlineTx := jsonRoundTrip(t, newTestOfflineTx(t, address))
+	if _, err = offlineTx.TxBytes(); err == nil {
+		t.Fatal("an unsigned tx can't be broadcast")
+	}
+
+	other, err := secp256k1.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = offlineTx.Sign(privKeySigner{other}); err == nil {
+		t.Fatal("another account shouldn't sign the tx")
+	}
+	if err = offlineTx.Sign(privKeySigner{privKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	signedTx := jsonRoundTrip(t, offlineTx)
+	if _, err = signedTx.TxBytes(); err != nil {
+		t.Fatal(err)
+	}
+	signBytes, err := signedTx.signBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !privKey.PubKey().VerifySignature(signBytes, signedTx.Tx.Signatures[0]) {
+		t.Fatal("the signature should be valid")
+	}
+}
+
+func TestOfflineMultisig(t *testing.T) {
+	var privKeys []fwcryptotypes.PrivKey
+	var pubKeys []fwcryptotypes.PubKey
+	for i := 0; i < 3; i++ {
+		privKey, err := secp256k1.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		privKeys = append(privKeys, privKey)
+		pubKeys = append(pubKeys, privKey.PubKey())
+	}
+
+	// the address of the multisig account doesn't matter offline
+	offlineTx := newTestOfflineTx(t, fwtypes.WalletAddress(pubKeys[0].Address()).String())
+	signerInfo, err := multisigSignerInfo(&MultisigKey{Threshold: 2, PubKeys: pubKeys, Signers: []int{2, 0}}, offlineTx.Sequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offlineTx.Tx.AuthInfo.SignerInfos = []*txv1beta1.SignerInfo{signerInfo}
+	offlineTx = jsonRoundTrip(t, offlineTx)
+	if !offlineTx.IsMultisig() {
+		t.Fatal("the tx should be signed by a multisig account")
+	}
+
+	if _, err = offlineTx.SignMultisig(privKeySigner{privKeys[1]}); err == nil {
+		t.Fatal("a member not chosen to sign shouldn't sign the tx")
+	}
+	var signatures []*OfflineSignature
+	for _, i := range []int{0, 2} {
+		signature, err := jsonRoundTrip(t, offlineTx).SignMultisig(privKeySigner{privKeys[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		signatures = append(signatures, signature)
+	}
+
+	if err = offlineTx.CombineSignatures(signatures[:1]); err == nil {
+		t.Fatal("a missing signature should be detected")
+	}
+	if err = offlineTx.CombineSignatures(signatures); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = offlineTx.TxBytes(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	fwsecp256k1 "github.com/stratosnet/sds/framework/crypto/secp256k1"
 	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
 
+	"github.com/stratosnet/sds/tx-client/types"
 	authsigning "github.com/stratosnet/sds/tx-client/types/auth/signing"
 	txsigning "github.com/stratosnet/sds/tx-client/types/tx/signing"
 )
@@ -25,6 +26,16 @@ func SignWithPrivKey(
 	signMode signingv1beta1.SignMode, signerData authsigning.SignerData,
 	tx *txv1beta1.Tx, priv fwcryptotypes.PrivKey, txConfig TxConfig,
 	accSeq uint64,
+) (txsigning.SignatureV2, error) {
+	return SignWithSigner(signMode, signerData, tx, privKeySigner{priv}, txConfig, accSeq)
+}
+
+// SignWithSigner signs a given tx with the given signer, and returns the
+// corresponding SignatureV2 if the signing is successful.
+func SignWithSigner(
+	signMode signingv1beta1.SignMode, signerData authsigning.SignerData,
+	tx *txv1beta1.Tx, signer types.TxSigner, txConfig TxConfig,
+	accSeq uint64,
 ) (txsigning.SignatureV2, error) {
 	var sigV2 txsigning.SignatureV2
 
@@ -35,7 +46,7 @@ func SignWithPrivKey(
 	}
 
 	// Sign those bytes
-	signature, err := priv.Sign(signBytes)
+	signature, err := signer.SignTx(signBytes)
 	if err != nil {
 		return sigV2, err
 	}
@@ -46,7 +57,7 @@ func SignWithPrivKey(
 		Signature: signature,
 	}
 
-	pubKeyAny, err := getPackedPubKeyAnyByPrivKey(priv)
+	pubKeyAny, err := getPackedPubKeyAny(signer.PubKey())
 	if err != nil {
 		return sigV2, err
 	}
@@ -60,14 +71,21 @@ func SignWithPrivKey(
 	return sigV2, nil
 }
 
-func getPackedPubKeyAnyByPrivKey(priv fwcryptotypes.PrivKey) (pubKeyAny *anypb.Any, err error) {
-	switch priv.Type() {
+// privKeySigner signs with a private key held in memory
+type privKeySigner struct {
+	fwcryptotypes.PrivKey
+}
+
+func (s privKeySigner) SignTx(signBytes []byte) ([]byte, error) {
+	return s.Sign(signBytes)
+}
+
+func getPackedPubKeyAny(pubKey fwcryptotypes.PubKey) (pubKeyAny *anypb.Any, err error) {
+	switch pubKey.Type() {
 	case fwsecp256k1.KeyType:
-		pubKey := &sdksecp256k1.PubKey{Key: priv.PubKey().Bytes()}
-		pubKeyAny, err = anyutil.New(pubKey)
+		pubKeyAny, err = anyutil.New(&sdksecp256k1.PubKey{Key: pubKey.Bytes()})
 	case fwed25519.KeyType:
-		pubKey := &sdked25519.PubKey{Key: priv.PubKey().Bytes()}
-		pubKeyAny, err = anyutil.New(pubKey)
+		pubKeyAny, err = anyutil.New(&sdked25519.PubKey{Key: pubKey.Bytes()})
 	default:
 		return nil, fmt.Errorf("Key type is not supported. ")
 	}
@@ -17,7 +17,6 @@ import (
 
 	"github.com/stratosnet/sds/framework/crypto/ed25519"
 	"github.com/stratosnet/sds/framework/crypto/secp256k1"
-	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
 
 	"github.com/stratosnet/sds/framework/utils"
 	"github.com/stratosnet/sds/tx-client/grpc"
@@ -163,20 +162,15 @@ func buildAndSignStdTx(txConfig TxConfig, unsignedTx *txv1beta1.Tx, chainId stri
 	var sigsV2 []signing.SignatureV2
 	// First round: we gather all the signer infos. We use the "set empty
 	// signature" hack to do that.
-	for _, signatureKey := range signaturesToDo {
-		var privKey fwcryptotypes.PrivKey
+	signers := make([]types.TxSigner, len(signaturesToDo))
+	for i, signatureKey := range signaturesToDo {
 		var err error
-		switch signatureKey.Type {
-		case types.SignatureEd25519:
-			if len(signatureKey.PrivateKey) != ed25519crypto.PrivateKeySize {
-				return []byte{}, fmt.Errorf("ed25519 private key has wrong length: " + hex.EncodeToString(signatureKey.PrivateKey))
-			}
-			privKey = &ed25519.PrivKey{Key: signatureKey.PrivateKey}
-		default:
-			privKey = secp256k1.Generate(signatureKey.PrivateKey)
+		signers[i], err = txSigner(signatureKey)
+		if err != nil {
+			return []byte{}, err
 		}
 
-		pubKeyAny, err := getPackedPubKeyAnyByPrivKey(privKey)
+		pubKeyAny, err := getPackedPubKeyAny(signers[i].PubKey())
 		if err != nil {
 			return nil, err
 		}
@@ -200,23 +194,16 @@ func buildAndSignStdTx(txConfig TxConfig, unsignedTx *txv1beta1.Tx, chainId stri
 
 	var signedTx *txv1beta1.Tx
 	// Second round: all signer infos are set, so each signer can sign.
-	for _, signatureKey := range signaturesToDo {
+	for i, signatureKey := range signaturesToDo {
 		signerData := authsigning.SignerData{
 			ChainID:       chainId,
 			AccountNumber: signatureKey.AccountNum,
 			Sequence:      signatureKey.AccountSequence,
 		}
 
-		var privKey fwcryptotypes.PrivKey
-		switch signatureKey.Type {
-		case types.SignatureEd25519:
-			privKey = &ed25519.PrivKey{Key: signatureKey.PrivateKey}
-		default:
-			privKey = secp256k1.Generate(signatureKey.PrivateKey)
-		}
-		sigV2, err := SignWithPrivKey(
+		sigV2, err := SignWithSigner(
 			txConfig.SignModeHandler().DefaultMode(), signerData,
-			unsignedTx, privKey, txConfig, signerData.Sequence)
+			unsignedTx, signers[i], txConfig, signerData.Sequence)
 		if err != nil {
 			return []byte{}, err
 		}
@@ -235,6 +222,22 @@ func buildAndSignStdTx(txConfig TxConfig, unsignedTx *txv1beta1.Tx, chainId stri
 	return txBytes, nil
 }
 
+// txSigner returns the signer of a signature key, or a signer for its private key when it has none
+func txSigner(signatureKey *types.SignatureKey) (types.TxSigner, error) {
+	if signatureKey.Signer != nil {
+		return signatureKey.Signer, nil
+	}
+	switch signatureKey.Type {
+	case types.SignatureEd25519:
+		if len(signatureKey.PrivateKey) != ed25519crypto.PrivateKeySize {
+			return nil, fmt.Errorf("ed25519 private key has wrong length: " + hex.EncodeToString(signatureKey.PrivateKey))
+		}
+		return privKeySigner{&ed25519.PrivKey{Key: signatureKey.PrivateKey}}, nil
+	default:
+		return privKeySigner{secp256k1.Generate(signatureKey.PrivateKey)}, nil
+	}
+}
+
 func SetSignatures(tx *txv1beta1.Tx, signatures ...signing.SignatureV2) (*txv1beta1.Tx, error) {
 	n := len(signatures)
 	signerInfos := make([]*txv1beta1.SignerInfo, n)
@@ -262,7 +265,7 @@ func filterInvalidSignatures(msgs []*types.UnsignedMsg) []*types.UnsignedMsg {
 	for _, msg := range msgs {
 		invalidSignature := false
 		for _, signature := range msg.SignatureKeys {
-			if len(signature.Address) == 0 || len(signature.PrivateKey) == 0 {
+			if len(signature.Address) == 0 || (len(signature.PrivateKey) == 0 && signature.Signer == nil) {
 				invalidSignature = true
 				break
 			}
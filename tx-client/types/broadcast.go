@@ -7,11 +7,12 @@ import (
 
 // SignatureKey --------------------------------------
 type SignatureKey struct {
-	AccountNum      uint64 `json:"account_num,omitempty"`
-	AccountSequence uint64 `json:"account_sequence,omitempty"`
-	Address         string `json:"address,omitempty"`
-	PrivateKey      []byte `json:"private_key,omitempty"`
-	Type            int    `json:"type,omitempty"`
+	AccountNum      uint64   `json:"account_num,omitempty"`
+	AccountSequence uint64   `json:"account_sequence,omitempty"`
+	Address         string   `json:"address,omitempty"`
+	PrivateKey      []byte   `json:"private_key,omitempty"`
+	Signer          TxSigner `json:"-"` // signs instead of PrivateKey when set
+	Type            int      `json:"type,omitempty"`
 }
 
 // UnsignedMsgs --------------------------------------
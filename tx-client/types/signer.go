@@ -0,0 +1,12 @@
+package types
+
+import (
+	fwcryptotypes "github.com/stratosnet/sds/framework/crypto/types"
+)
+
+// TxSigner signs transactions for a wallet without handing out its private key, which may be kept by another process
+type TxSigner interface {
+	PubKey() fwcryptotypes.PubKey
+	// SignTx signs the SIGN_MODE_DIRECT sign bytes of a transaction
+	SignTx(signBytes []byte) ([]byte, error)
+}
@@ -0,0 +1,134 @@
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Helpers for AWS signature version 4, shared by the S3 gateway verifying requests and the S3 slice store signing them
+
+const (
+	Algorithm      = "AWS4-HMAC-SHA256"
+	ChunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	Terminator     = "aws4_request"
+	TimeFormat     = "20060102T150405Z"
+	DateFormat     = "20060102"
+)
+
+// Sign signs a request to an S3-compatible service, setting its X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers
+func Sign(req *http.Request, payload []byte, accessKey, secretKey, region string, now time.Time) {
+	payloadHash := sha256.Sum256(payload)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+	amzDate := now.UTC().Format(TimeFormat)
+	date := now.UTC().Format(DateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHex + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		CanonicalURI(req.URL),
+		CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHex,
+	}, "\n")
+
+	scope := Scope(date, region, "s3")
+	key := SigningKey(secretKey, date, region, "s3")
+	signature := hex.EncodeToString(HmacSHA256(key, []byte(StringToSign(amzDate, scope, canonicalRequest))))
+
+	req.Header.Set("Authorization", Algorithm+" Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// Scope returns the credential scope of a signature
+func Scope(date, region, service string) string {
+	return strings.Join([]string{date, region, service, Terminator}, "/")
+}
+
+// StringToSign returns the string signed with the signing key, for a canonical request
+func StringToSign(amzDate, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{Algorithm, amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+}
+
+// CanonicalURI returns the path of the url, with each segment encoded as required by SigV4
+func CanonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	// Re-encode each segment the way the SDKs do, as Go leaves some characters like '=' or '!' unescaped
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments[i] = UriEncode(unescaped)
+	}
+	return strings.Join(segments, "/")
+}
+
+// CanonicalQuery returns the query parameters sorted by key then value, leaving out the excluded keys
+func CanonicalQuery(query url.Values, exclude ...string) string {
+	var keys []string
+	for key := range query {
+		excluded := false
+		for _, e := range exclude {
+			excluded = excluded || key == e
+		}
+		if !excluded {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, UriEncode(key)+"="+UriEncode(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// UriEncode percent-encodes everything except the unreserved characters, as required by SigV4
+func UriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+// SigningKey derives the key signing the requests of a day, for a region and a service
+func SigningKey(secretKey, date, region, service string) []byte {
+	key := HmacSHA256([]byte("AWS4"+secretKey), []byte(date))
+	key = HmacSHA256(key, []byte(region))
+	key = HmacSHA256(key, []byte(service))
+	return HmacSHA256(key, []byte(Terminator))
+}
+
+func HmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}